@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An Accumulator collects a request's observations privately and folds them
+// into a registry once, when the request completes, so that a chatty
+// handler which increments the same counters and marks the same meters many
+// times touches the shared metrics, and the atomic operations and locks
+// they entail, once per metric rather than once per observation.
+// Observations aren't visible in the registry until Flush.  Carry one in the
+// request's context:
+//
+//	a := metrics.NewAccumulator(r)
+//	defer a.Flush()
+//	ctx = metrics.WithAccumulator(ctx, a)
+//	...
+//	metrics.AccumulatorFrom(ctx).Inc("cache.hits", 1)
+//
+// A nil *Accumulator, as returned by AccumulatorFrom for a context without
+// one, updates the default registry's metrics directly.
+type Accumulator struct {
+	counters   map[string]int64
+	gauges     map[string]int64
+	histograms map[string][]int64
+	meters     map[string]int64
+	mutex      sync.Mutex
+	registry   Registry
+	timers     map[string][]time.Duration
+}
+
+// accumulatorKey is the context key of an Accumulator.
+type accumulatorKey struct{}
+
+// AccumulatorFrom returns the Accumulator carried by the given context or
+// nil if it carries none.
+func AccumulatorFrom(ctx context.Context) *Accumulator {
+	a, _ := ctx.Value(accumulatorKey{}).(*Accumulator)
+	return a
+}
+
+// NewAccumulator constructs a new Accumulator which folds its observations
+// into the given registry.
+func NewAccumulator(r Registry) *Accumulator {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &Accumulator{registry: r}
+}
+
+// WithAccumulator returns a copy of the given context which carries the
+// given Accumulator.
+func WithAccumulator(ctx context.Context, a *Accumulator) context.Context {
+	return context.WithValue(ctx, accumulatorKey{}, a)
+}
+
+// Flush folds the observations accumulated since the last flush into the
+// registry: counters are incremented and meters marked by their totals,
+// gauges take the last value set, and histograms and timers are updated
+// with each value.  Metrics which don't exist are constructed and
+// registered as by GetOrRegisterCounter and its kin.
+func (a *Accumulator) Flush() {
+	if nil == a {
+		return
+	}
+	a.mutex.Lock()
+	counters, gauges, histograms, meters, timers := a.counters, a.gauges, a.histograms, a.meters, a.timers
+	a.counters, a.gauges, a.histograms, a.meters, a.timers = nil, nil, nil, nil, nil
+	a.mutex.Unlock()
+	for name, n := range counters {
+		GetOrRegisterCounter(name, a.registry).Inc(n)
+	}
+	for name, v := range gauges {
+		GetOrRegisterGauge(name, a.registry).Update(v)
+	}
+	for name, values := range histograms {
+		h := GetOrRegisterHistogram(name, a.registry, nil)
+		for _, v := range values {
+			h.Update(v)
+		}
+	}
+	for name, n := range meters {
+		GetOrRegisterMeter(name, a.registry).Mark(n)
+	}
+	for name, durations := range timers {
+		t := GetOrRegisterTimer(name, a.registry)
+		for _, d := range durations {
+			t.Update(d)
+		}
+	}
+}
+
+// Inc increments the counter of the given name by n.
+func (a *Accumulator) Inc(name string, n int64) {
+	if nil == a {
+		GetOrRegisterCounter(name, nil).Inc(n)
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if nil == a.counters {
+		a.counters = make(map[string]int64)
+	}
+	a.counters[name] += n
+}
+
+// Mark marks n events on the meter of the given name.
+func (a *Accumulator) Mark(name string, n int64) {
+	if nil == a {
+		GetOrRegisterMeter(name, nil).Mark(n)
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if nil == a.meters {
+		a.meters = make(map[string]int64)
+	}
+	a.meters[name] += n
+}
+
+// Update updates the histogram of the given name with a new value.
+func (a *Accumulator) Update(name string, v int64) {
+	if nil == a {
+		GetOrRegisterHistogram(name, nil, nil).Update(v)
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if nil == a.histograms {
+		a.histograms = make(map[string][]int64)
+	}
+	a.histograms[name] = append(a.histograms[name], v)
+}
+
+// UpdateGauge sets the gauge of the given name, which takes the last value
+// set when the accumulator is flushed.
+func (a *Accumulator) UpdateGauge(name string, v int64) {
+	if nil == a {
+		GetOrRegisterGauge(name, nil).Update(v)
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if nil == a.gauges {
+		a.gauges = make(map[string]int64)
+	}
+	a.gauges[name] = v
+}
+
+// UpdateTimer records a duration on the timer of the given name.
+func (a *Accumulator) UpdateTimer(name string, d time.Duration) {
+	if nil == a {
+		GetOrRegisterTimer(name, nil).Update(d)
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if nil == a.timers {
+		a.timers = make(map[string][]time.Duration)
+	}
+	a.timers[name] = append(a.timers[name], d)
+}
+
+// UpdateTimerSince records the time elapsed since ts on the timer of the
+// given name.
+func (a *Accumulator) UpdateTimerSince(name string, ts time.Time) {
+	a.UpdateTimer(name, time.Since(ts))
+}
@@ -0,0 +1,80 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func BenchmarkAccumulator(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < b.N; i++ {
+		a := NewAccumulator(r)
+		for j := 0; j < 100; j++ {
+			a.Inc("foo", 1)
+		}
+		a.Flush()
+	}
+}
+
+func BenchmarkAccumulatorDirect(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			GetOrRegisterCounter("foo", r).Inc(1)
+		}
+	}
+}
+
+func TestAccumulator(t *testing.T) {
+	r := NewRegistry()
+	ctx := WithAccumulator(context.Background(), NewAccumulator(r))
+	a := AccumulatorFrom(ctx)
+	for i := 0; i < 10; i++ {
+		a.Inc("requests", 1)
+		a.Mark("bytes", 100)
+		a.Update("size", int64(i))
+		a.UpdateGauge("queue", int64(i))
+	}
+	a.UpdateTimer("latency", time.Millisecond)
+	if nil != r.Get("requests") {
+		t.Error("requests was registered before Flush")
+	}
+	a.Flush()
+	if count := GetOrRegisterCounter("requests", r).Count(); 10 != count {
+		t.Errorf("requests.Count(): 10 != %v\n", count)
+	}
+	if count := GetOrRegisterMeter("bytes", r).Count(); 1000 != count {
+		t.Errorf("bytes.Count(): 1000 != %v\n", count)
+	}
+	if count := GetOrRegisterHistogram("size", r, nil).Count(); 10 != count {
+		t.Errorf("size.Count(): 10 != %v\n", count)
+	}
+	if value := GetOrRegisterGauge("queue", r).Value(); 9 != value {
+		t.Errorf("queue.Value(): 9 != %v\n", value)
+	}
+	if count := GetOrRegisterTimer("latency", r).Count(); 1 != count {
+		t.Errorf("latency.Count(): 1 != %v\n", count)
+	}
+	a.Flush()
+	if count := GetOrRegisterCounter("requests", r).Count(); 10 != count {
+		t.Errorf("requests.Count(): 10 != %v after a second Flush\n", count)
+	}
+}
+
+func TestAccumulatorNil(t *testing.T) {
+	a := AccumulatorFrom(context.Background())
+	if nil != a {
+		t.Fatal("AccumulatorFrom(): expected nil")
+	}
+	name := "metrics.TestAccumulatorNil"
+	defer DefaultRegistry.Unregister(name)
+	a.Inc(name, 2)
+	a.Flush()
+	if count := GetOrRegisterCounter(name, nil).Count(); 2 != count {
+		t.Errorf("%s.Count(): 2 != %v\n", name, count)
+	}
+}
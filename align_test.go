@@ -0,0 +1,57 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAtomicAlignment updates metrics embedded after a single byte, where on
+// 32-bit platforms a plain int64 accessed atomically would be misaligned and
+// panic.  Run it with GOARCH=386 or GOARCH=arm to be sure.
+func TestAtomicAlignment(t *testing.T) {
+	var s struct {
+		_       byte
+		counter StandardCounter
+		_       byte
+		gauge   StandardGauge
+		_       byte
+		ewma    StandardEWMA
+		_       byte
+		meter   StandardMeter
+		_       byte
+		tenant  TenantRegistry
+		_       byte
+		entry   tenantEntry
+	}
+	s.counter.Inc(1)
+	if count := s.counter.Count(); 1 != count {
+		t.Errorf("s.counter.Count(): 1 != %v\n", count)
+	}
+	s.gauge.Update(1)
+	if value := s.gauge.Value(); 1 != value {
+		t.Errorf("s.gauge.Value(): 1 != %v\n", value)
+	}
+	s.ewma.alpha = NewEWMA1().(*StandardEWMA).alpha
+	s.ewma.Update(5)
+	s.ewma.Tick()
+	if rate := s.ewma.Rate(); 1.0 != rate {
+		t.Errorf("s.ewma.Rate(): 1.0 != %v\n", rate)
+	}
+	s.meter.snapshot, s.meter.startTime = &MeterSnapshot{}, time.Now()
+	s.meter.a1, s.meter.a5, s.meter.a15 = NewEWMA1(), NewEWMA5(), NewEWMA15()
+	s.meter.Mark(1)
+	if count := s.meter.Count(); 1 != count {
+		t.Errorf("s.meter.Count(): 1 != %v\n", count)
+	}
+	s.tenant.dropped.Add(1)
+	if dropped := s.tenant.Dropped(); 1 != dropped {
+		t.Errorf("s.tenant.Dropped(): 1 != %v\n", dropped)
+	}
+	s.entry.updated.Store(1)
+	if updated := s.entry.updated.Load(); 1 != updated {
+		t.Errorf("s.entry.updated.Load(): 1 != %v\n", updated)
+	}
+}
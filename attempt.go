@@ -0,0 +1,102 @@
+package metrics
+
+import "time"
+
+// AttemptTimer bundles the metrics of an operation which is retried, so that
+// every caller instruments retries alike: the duration of each attempt, the
+// duration of the operation as a whole, and the number of attempts it took.
+// A bundle named "fetch" registers the duration histogram "fetch.attempt",
+// the timer "fetch.total", and the histogram "fetch.attempts".  A name made
+// by TaggedName keeps its tags on each metric.
+type AttemptTimer struct {
+	attempt  DurationHistogram
+	attempts Histogram
+	total    Timer
+}
+
+// GetOrRegisterAttemptTimer returns the attempt timer of the given name in
+// the given registry, constructing and registering any of its metrics which
+// don't yet exist.
+func GetOrRegisterAttemptTimer(name string, r Registry) *AttemptTimer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &AttemptTimer{
+		attempt:  GetOrRegisterDurationHistogram(bundleName(name, "attempt"), r, nil),
+		attempts: GetOrRegisterHistogram(bundleName(name, "attempts"), r, nil),
+		total:    GetOrRegisterTimer(bundleName(name, "total"), r),
+	}
+}
+
+// NewAttemptTimer constructs a new, unregistered attempt timer.
+func NewAttemptTimer() *AttemptTimer {
+	return &AttemptTimer{
+		attempt:  NewDurationHistogram(DefaultSampleConfig.NewSample()),
+		attempts: NewHistogram(DefaultSampleConfig.NewSample()),
+		total:    NewTimer(),
+	}
+}
+
+// NewRegisteredAttemptTimer constructs and registers a new attempt timer
+// under the given name.
+func NewRegisteredAttemptTimer(name string, r Registry) *AttemptTimer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	t := &AttemptTimer{
+		attempt:  NewDurationHistogram(r.SampleConfig().NewSample()),
+		attempts: NewHistogram(r.SampleConfig().NewSample()),
+		total:    newTimer(r.SampleConfig()),
+	}
+	r.Register(bundleName(name, "attempt"), t.attempt)
+	r.Register(bundleName(name, "attempts"), t.attempts)
+	r.Register(bundleName(name, "total"), t.total)
+	return t
+}
+
+// Attempt returns the duration histogram of individual attempts.
+func (t *AttemptTimer) Attempt() DurationHistogram {
+	return t.attempt
+}
+
+// Attempts returns the histogram of the number of attempts per operation.
+func (t *AttemptTimer) Attempts() Histogram {
+	return t.attempts
+}
+
+// Observe records an operation made of attempts of the given durations,
+// whose total is their sum.  An operation with no attempts isn't recorded.
+func (t *AttemptTimer) Observe(attempts []time.Duration) {
+	var total time.Duration
+	for _, d := range attempts {
+		total += d
+	}
+	t.observe(total, attempts)
+}
+
+// ObserveSince records an operation which started at the given time and was
+// made of attempts of the given durations, so that the total includes the
+// time spent backing off between them.
+func (t *AttemptTimer) ObserveSince(start time.Time, attempts []time.Duration) {
+	t.observe(time.Since(start), attempts)
+}
+
+// String formats the statistics of the attempts, their number, and the
+// totals for debugging.
+func (t *AttemptTimer) String() string { return attemptTimerString(t) }
+
+// Total returns the timer of whole operations.
+func (t *AttemptTimer) Total() Timer {
+	return t.total
+}
+
+func (t *AttemptTimer) observe(total time.Duration, attempts []time.Duration) {
+	if 0 == len(attempts) {
+		return
+	}
+	for _, d := range attempts {
+		t.attempt.Update(d)
+	}
+	t.attempts.Update(int64(len(attempts)))
+	t.total.Update(total)
+}
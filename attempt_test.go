@@ -0,0 +1,41 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttemptTimer(t *testing.T) {
+	r := NewRegistry()
+	at := GetOrRegisterAttemptTimer("fetch", r)
+	at.Observe([]time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond})
+	at.Observe([]time.Duration{time.Millisecond})
+	at.Observe(nil)
+	if count := r.Get("fetch.attempt").(DurationHistogram).Count(); 4 != count {
+		t.Errorf("fetch.attempt.Count(): 4 != %v\n", count)
+	}
+	if max := r.Get("fetch.attempts").(Histogram).Max(); 3 != max {
+		t.Errorf("fetch.attempts.Max(): 3 != %v\n", max)
+	}
+	total := r.Get("fetch.total").(Timer)
+	if count := total.Count(); 2 != count {
+		t.Errorf("fetch.total.Count(): 2 != %v\n", count)
+	}
+	if max := total.Max(); int64(6*time.Millisecond) != max {
+		t.Errorf("fetch.total.Max(): %v != %v\n", 6*time.Millisecond, max)
+	}
+	if GetOrRegisterAttemptTimer("fetch", r).Total() != at.Total() {
+		t.Error("GetOrRegisterAttemptTimer(): expected the registered timer")
+	}
+}
+
+func TestAttemptTimerObserveSince(t *testing.T) {
+	at := NewRegisteredAttemptTimer(TaggedName("fetch", map[string]string{"backend": "s3"}), NewRegistry())
+	at.ObserveSince(time.Now().Add(-time.Second), []time.Duration{time.Millisecond, time.Millisecond})
+	if max := at.Total().Max(); max < int64(time.Second) {
+		t.Errorf("at.Total().Max(): %v < %v\n", max, time.Second)
+	}
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// hoursPerWeek is the number of baselines a Baseline keeps.
+const hoursPerWeek = 7 * 24
+
+// Baselines learn the usual rate of a meter for each hour of the week and
+// expose how far its current one-minute rate deviates from the usual rate
+// for the current hour as a GaugeFloat64, so that regressions in traffic
+// patterns stand out from the daily and weekly cycles around them.
+//
+// Each hour's baseline is an exponentially-weighted moving average, across
+// weeks, of the meter's mean rate during that hour, so with an alpha of 0.5
+// last week counts as much as every earlier week together.  The deviation is
+// the fraction by which the current rate exceeds the baseline, negative when
+// it falls short, and zero until the hour has a baseline.  Hours are those of
+// the local time zone.
+type Baseline struct {
+	alpha     float64
+	baselines [hoursPerWeek]float64
+	deviation GaugeFloat64
+	hour      int // the hour of the week being observed or -1
+	meter     Meter
+	mutex     sync.Mutex
+	observed  [hoursPerWeek]bool
+	sum       float64 // of the rates observed during the current hour
+	n         int     // rates observed during the current hour
+}
+
+// NewBaseline constructs a new Baseline of the given meter whose baselines
+// are updated with the given alpha each week.
+func NewBaseline(m Meter, alpha float64) *Baseline {
+	return &Baseline{
+		alpha:     alpha,
+		deviation: NewGaugeFloat64(),
+		hour:      -1,
+		meter:     m,
+	}
+}
+
+// NewRegisteredBaseline constructs a new Baseline of the given meter and
+// registers its deviation under the given name.
+func NewRegisteredBaseline(name string, r Registry, m Meter, alpha float64) *Baseline {
+	b := NewBaseline(m, alpha)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, b.deviation)
+	return b
+}
+
+// Baseline returns the baseline rate for the hour of the week of the given
+// time and whether that hour has been observed in an earlier week.
+func (b *Baseline) Baseline(t time.Time) (float64, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	hour := hourOfWeek(t)
+	return b.baselines[hour], b.observed[hour]
+}
+
+// Capture observes the meter's rate periodically.  This is designed to be
+// called as a goroutine.
+func (b *Baseline) Capture(d time.Duration) {
+	for _ = range tick("baseline", priorityCollect, d) {
+		b.CaptureOnce()
+	}
+}
+
+// CaptureOnce observes the meter's rate now.
+func (b *Baseline) CaptureOnce() {
+	b.Observe(time.Now())
+}
+
+// Deviation returns the gauge of the current rate's deviation from its
+// baseline.
+func (b *Baseline) Deviation() GaugeFloat64 {
+	return b.deviation
+}
+
+// Observe records the meter's one-minute rate as of the given time, which
+// must not be earlier than the last time observed, and updates the
+// deviation.  When the hour of the week changes, the mean of the rates
+// observed during the hour that ended is folded into its baseline.
+func (b *Baseline) Observe(t time.Time) {
+	rate := b.meter.Rate1()
+	hour := hourOfWeek(t)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if hour != b.hour {
+		b.fold()
+		b.hour, b.sum, b.n = hour, 0, 0
+	}
+	b.sum += rate
+	b.n++
+	deviation := 0.0
+	if baseline := b.baselines[hour]; b.observed[hour] && 0 != baseline {
+		deviation = (rate - baseline) / baseline
+	}
+	b.deviation.Update(deviation)
+}
+
+// fold folds the mean rate observed during the current hour into its
+// baseline.  It must be called with b.mutex held.
+func (b *Baseline) fold() {
+	if b.hour < 0 || 0 == b.n {
+		return
+	}
+	mean := b.sum / float64(b.n)
+	if b.observed[b.hour] {
+		b.baselines[b.hour] += b.alpha * (mean - b.baselines[b.hour])
+	} else {
+		b.baselines[b.hour], b.observed[b.hour] = mean, true
+	}
+}
+
+// hourOfWeek returns the hour of the week of the given time, counting from
+// midnight on Sunday.
+func hourOfWeek(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
@@ -0,0 +1,46 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBaseline(t *testing.T) {
+	b := NewBaseline(&MeterSnapshot{rate1: 10}, 0.5)
+	monday := time.Date(2015, 6, 1, 9, 0, 0, 0, time.Local)
+	b.Observe(monday)
+	b.Observe(monday.Add(30 * time.Minute))
+	if deviation := b.Deviation().Value(); 0 != deviation {
+		t.Errorf("b.Deviation().Value(): 0 != %v\n", deviation)
+	}
+	b.meter = &MeterSnapshot{rate1: 20}
+	b.Observe(monday.Add(time.Hour))
+	if baseline, ok := b.Baseline(monday); !ok || 10 != baseline {
+		t.Errorf("b.Baseline(monday): 10 != %v, %v\n", baseline, ok)
+	}
+	if _, ok := b.Baseline(monday.Add(time.Hour)); ok {
+		t.Error("b.Baseline(monday.Add(time.Hour)): observed")
+	}
+
+	nextMonday := monday.AddDate(0, 0, 7)
+	b.meter = &MeterSnapshot{rate1: 15}
+	b.Observe(nextMonday)
+	if deviation := b.Deviation().Value(); 0.5 != deviation {
+		t.Errorf("b.Deviation().Value(): 0.5 != %v\n", deviation)
+	}
+	b.Observe(nextMonday.Add(time.Hour))
+	if baseline, _ := b.Baseline(monday); 12.5 != baseline {
+		t.Errorf("b.Baseline(monday): 12.5 != %v\n", baseline)
+	}
+}
+
+func TestNewRegisteredBaseline(t *testing.T) {
+	r := NewRegistry()
+	b := NewRegisteredBaseline("requests.baseline-deviation", r, NewMeter(), 0.5)
+	if r.Get("requests.baseline-deviation") != b.Deviation() {
+		t.Errorf("r.Get(\"requests.baseline-deviation\"): %v\n", r.Get("requests.baseline-deviation"))
+	}
+}
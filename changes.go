@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+)
+
+// A ChangeFilter lets a push reporter send only the metrics whose values
+// have changed since its previous flush.  Counters, gauges, and Histogram2Ds
+// are considered changed when their count or value differs.  Histograms,
+// meters, summaries, and timers are also considered changed when their
+// one-, five-, or fifteen-minute rates or exported quantiles differ, since
+// those decay or age without any update, so they're sent on every flush
+// until they settle.  Healthchecks always are.  Every FullSyncEvery flushes,
+// every metric is sent regardless so that a backend which missed an update, or
+// which expires idle series, is brought back into agreement.
+//
+// A metric is considered sent once the filter has yielded it, so a flush
+// which fails part way is only repaired by the next change or full sync.
+// Each reporter needs a ChangeFilter of its own.
+type ChangeFilter struct {
+	FullSyncEvery int // Flushes between full syncs; 0 means only the first flush is one
+
+	mutex   sync.Mutex
+	flushes int
+	states  map[string]metricState
+}
+
+// metricState is the part of a metric a ChangeFilter compares between
+// flushes.
+type metricState struct {
+	count  int64
+	value  uint64
+	digest uint64 // Of the rates and quantiles, which change without updates
+}
+
+// NewChangeFilter constructs a new ChangeFilter which sends every metric on
+// its first flush and every fullSyncEvery flushes thereafter.
+func NewChangeFilter(fullSyncEvery int) *ChangeFilter {
+	return &ChangeFilter{FullSyncEvery: fullSyncEvery}
+}
+
+// Each calls f for each metric in r which has changed since the previous
+// call, or for every metric in r when a full sync is due.
+func (cf *ChangeFilter) Each(r Registry, f func(string, interface{})) {
+	cf.mutex.Lock()
+	defer cf.mutex.Unlock()
+	full := nil == cf.states || 0 < cf.FullSyncEvery && 0 == cf.flushes%cf.FullSyncEvery
+	cf.flushes++
+	if full {
+		cf.states = make(map[string]metricState)
+	}
+	r.Each(func(name string, i interface{}) {
+		state, ok := stateOf(r, i)
+		if !ok {
+			f(name, i)
+			return
+		}
+		if last, seen := cf.states[name]; full || !seen || last != state {
+			cf.states[name] = state
+			f(name, i)
+		}
+	})
+}
+
+// each returns a function which calls its argument for each metric in r
+// that passes the filter, or for every metric when cf is nil.
+func (cf *ChangeFilter) each(r Registry) func(func(string, interface{})) {
+	if nil == cf {
+		return r.Each
+	}
+	return func(f func(string, interface{})) { cf.Each(r, f) }
+}
+
+// Reset forgets every metric's state so that the next flush is a full sync.
+func (cf *ChangeFilter) Reset() {
+	cf.mutex.Lock()
+	defer cf.mutex.Unlock()
+	cf.flushes = 0
+	cf.states = nil
+}
+
+// stateOf returns the state of the given metric in r that a ChangeFilter
+// compares and whether it has one at all.
+func stateOf(r Registry, i interface{}) (metricState, bool) {
+	switch metric := i.(type) {
+	case Counter:
+		return metricState{count: metric.Count()}, true
+	case CounterFloat64:
+		return metricState{value: math.Float64bits(metric.Count())}, true
+	case DurationHistogram:
+		h := metric.Snapshot()
+		d := uint64(digestBasis)
+		for _, p := range h.Percentiles(ExportedPercentiles(r, i)) {
+			d = digest(d, float64(p))
+		}
+		return metricState{count: h.Count(), digest: d}, true
+	case Gauge:
+		return metricState{count: metric.Value()}, true
+	case GaugeFloat64:
+		return metricState{value: math.Float64bits(metric.Value())}, true
+	case Histogram:
+		h := metric.Snapshot()
+		return metricState{count: h.Count(), digest: digest(digestBasis, h.Percentiles(ExportedPercentiles(r, i))...)}, true
+	case Histogram2D:
+		return metricState{count: metric.Count()}, true
+	case Meter:
+		m := metric.Snapshot()
+		return metricState{count: m.Count(), digest: digest(digestBasis, m.Rate1(), m.Rate5(), m.Rate15())}, true
+	case StagedTimer:
+		t := metric.Snapshot()
+		d := uint64(digestBasis)
+		for _, stage := range append(t.Stages(), TotalStage) {
+			h := t.Stage(stage)
+			for _, p := range h.Percentiles(ExportedPercentiles(r, h)) {
+				d = digest(d, float64(p))
+			}
+		}
+		return metricState{count: t.Count(), digest: d}, true
+	case Summary:
+		s := metric.Snapshot()
+		return metricState{count: s.Count(), digest: digest(digestBasis, s.Quantiles()...)}, true
+	case Timer:
+		t := metric.Snapshot()
+		d := digest(digestBasis, t.Rate1(), t.Rate5(), t.Rate15())
+		return metricState{count: t.Count(), digest: digest(d, t.Percentiles(ExportedPercentiles(r, i))...)}, true
+	}
+	return metricState{}, false
+}
+
+// digestBasis begins a digest.
+const digestBasis = 14695981039346656037
+
+// digest folds the bits of the given values into d by FNV-1a, a word at a
+// time rather than a byte.
+func digest(d uint64, vs ...float64) uint64 {
+	for _, v := range vs {
+		d = (d ^ math.Float64bits(v)) * 1099511628211
+	}
+	return d
+}
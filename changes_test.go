@@ -0,0 +1,83 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+func changedNames(cf *ChangeFilter, r Registry) []string {
+	var names []string
+	cf.Each(r, func(name string, i interface{}) {
+		names = append(names, name)
+	})
+	sort.Strings(names)
+	return names
+}
+
+func TestChangeFilter(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("counter", r)
+	g := NewRegisteredGaugeFloat64("gauge", r)
+	g.Update(math.NaN())
+	NewRegisteredMeter("meter", r)
+	cf := NewChangeFilter(3)
+	if names := changedNames(cf, r); 3 != len(names) {
+		t.Errorf("first flush: %v\n", names)
+	}
+	if names := changedNames(cf, r); 0 != len(names) {
+		t.Errorf("idle flush: %v\n", names)
+	}
+	c.Inc(1)
+	if names := changedNames(cf, r); 1 != len(names) || "counter" != names[0] {
+		t.Errorf("changed flush: %v\n", names)
+	}
+	if names := changedNames(cf, r); 3 != len(names) {
+		t.Errorf("full sync: %v\n", names)
+	}
+	NewRegisteredGauge("new", r)
+	if names := changedNames(cf, r); 1 != len(names) || "new" != names[0] {
+		t.Errorf("new metric flush: %v\n", names)
+	}
+	cf.Reset()
+	if names := changedNames(cf, r); 4 != len(names) {
+		t.Errorf("flush after reset: %v\n", names)
+	}
+}
+
+func TestChangeFilterNoFullSync(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("counter", r)
+	cf := NewChangeFilter(0)
+	if names := changedNames(cf, r); 1 != len(names) {
+		t.Errorf("first flush: %v\n", names)
+	}
+	for i := 0; i < 10; i++ {
+		if names := changedNames(cf, r); 0 != len(names) {
+			t.Errorf("flush %d: %v\n", i, names)
+		}
+	}
+}
+
+func TestChangeFilterRates(t *testing.T) {
+	r := NewRegistry()
+	ts := NewManualTickSource()
+	m := NewMeterWithTickSource(ts)
+	r.Register("meter", m)
+	cf := NewChangeFilter(0)
+	m.Mark(10)
+	ts.Tick()
+	if names := changedNames(cf, r); 1 != len(names) {
+		t.Errorf("first flush: %v\n", names)
+	}
+	if names := changedNames(cf, r); 0 != len(names) {
+		t.Errorf("idle flush: %v\n", names)
+	}
+	ts.Tick()
+	if names := changedNames(cf, r); 1 != len(names) || "meter" != names[0] {
+		t.Errorf("decayed flush: %v\n", names)
+	}
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// checkpointVersion is the version of the checkpoint format written.
+const checkpointVersion = 1
+
+// checkpoint is the JSON form of a checkpoint.
+type checkpoint struct {
+	Version         int                `json:"version"`
+	Counters        map[string]int64   `json:"counters,omitempty"`
+	CountersFloat64 map[string]float64 `json:"counters_float64,omitempty"`
+	Meters          map[string]int64   `json:"meters,omitempty"`
+	Histograms      map[string][]byte  `json:"histograms,omitempty"`
+}
+
+// LoadCheckpoint restores the checkpoint in the file at the given path, as
+// by ReadCheckpoint.  A missing file, as on first startup, isn't an error.
+func LoadCheckpoint(r Registry, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+	return ReadCheckpoint(r, f)
+}
+
+// ReadCheckpoint restores the lifetime totals recorded by WriteCheckpoint so
+// that they survive a restart.  Each checkpointed count is added to that of
+// the counter, CounterFloat64, or meter by the same name, which is
+// registered if need be, without affecting a meter's rates.  Histograms are
+// restored only if they are already registered and their samples implement
+// encoding.BinaryUnmarshaler.
+func ReadCheckpoint(r Registry, rd io.Reader) error {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	var c checkpoint
+	if err := json.NewDecoder(rd).Decode(&c); nil != err {
+		return fmt.Errorf("metrics: checkpoint: %v", err)
+	}
+	if checkpointVersion != c.Version {
+		return fmt.Errorf("metrics: checkpoint: unknown version %d", c.Version)
+	}
+	for name, count := range c.Counters {
+		if counter, ok := r.GetOrRegister(name, NewCounter).(Counter); ok {
+			counter.Inc(count)
+		}
+	}
+	for name, count := range c.CountersFloat64 {
+		if counter, ok := r.GetOrRegister(name, NewCounterFloat64).(CounterFloat64); ok {
+			counter.Inc(count)
+		}
+	}
+	for name, count := range c.Meters {
+		m, ok := r.GetOrRegister(name, NewMeter).(Meter)
+		if !ok {
+			continue
+		}
+		if sm, ok := unwrap(m).(*StandardMeter); ok {
+			sm.restore(count)
+		} else {
+			m.Mark(count)
+		}
+	}
+	for name, state := range c.Histograms {
+		h, ok := r.Get(name).(Histogram)
+		if !ok {
+			continue
+		}
+		if u, ok := h.Sample().(encoding.BinaryUnmarshaler); ok {
+			if err := u.UnmarshalBinary(state); nil != err {
+				return fmt.Errorf("metrics: checkpoint: %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SaveCheckpoint writes a checkpoint, as by WriteCheckpoint, to the file at
+// the given path, replacing it atomically so that a crash while saving
+// leaves the previous checkpoint intact.  It's meant to be called during an
+// orderly shutdown and, if totals should survive crashes too, periodically.
+func SaveCheckpoint(r Registry, path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if nil != err {
+		return err
+	}
+	if err := WriteCheckpoint(r, f); nil != err {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); nil != err {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); nil != err {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// WriteCheckpoint writes the counts of the registry's counters,
+// CounterFloat64s, and meters and the states of its histograms whose samples
+// implement encoding.BinaryMarshaler, such as UniformSample, as JSON.
+func WriteCheckpoint(r Registry, w io.Writer) error {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	c := checkpoint{
+		Version:         checkpointVersion,
+		Counters:        make(map[string]int64),
+		CountersFloat64: make(map[string]float64),
+		Meters:          make(map[string]int64),
+		Histograms:      make(map[string][]byte),
+	}
+	var err error
+	r.Each(func(name string, i interface{}) {
+		switch metric := i.(type) {
+		case Counter:
+			c.Counters[name] = metric.Count()
+		case CounterFloat64:
+			c.CountersFloat64[name] = metric.Count()
+		case Meter:
+			c.Meters[name] = metric.Count()
+		case Histogram:
+			m, ok := metric.Sample().(encoding.BinaryMarshaler)
+			if !ok {
+				return
+			}
+			state, e := m.MarshalBinary()
+			if nil != e && nil == err {
+				err = fmt.Errorf("metrics: checkpoint: %s: %v", name, e)
+			}
+			c.Histograms[name] = state
+		}
+	})
+	if nil != err {
+		return err
+	}
+	return json.NewEncoder(w).Encode(c)
+}
+
+// unwrap returns the metric wrapped by a tenant's metric or the metric
+// itself.
+func unwrap(i interface{}) interface{} {
+	if w, ok := i.(interface {
+		unwrapMetric() interface{}
+	}); ok {
+		return w.unwrapMetric()
+	}
+	return i
+}
@@ -0,0 +1,143 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("requests", r).Inc(47)
+	GetOrRegisterCounterFloat64("cpu", r).Inc(1.5)
+	GetOrRegisterMeter("bytes", r).Mark(1000)
+	h := GetOrRegisterHistogram("latency", r, NewUniformSample(100))
+	for i := int64(1); i <= 10; i++ {
+		h.Update(i)
+	}
+	GetOrRegisterHistogram("size", r, NewExpDecaySample(100, 0.015)).Update(1)
+	var buf bytes.Buffer
+	if err := WriteCheckpoint(r, &buf); nil != err {
+		t.Fatal(err)
+	}
+
+	restarted := NewRegistry()
+	GetOrRegisterCounter("requests", restarted).Inc(3)
+	GetOrRegisterCounterFloat64("cpu", restarted).Inc(0.25)
+	h = GetOrRegisterHistogram("latency", restarted, NewUniformSample(100))
+	if err := ReadCheckpoint(restarted, &buf); nil != err {
+		t.Fatal(err)
+	}
+	if count := GetOrRegisterCounter("requests", restarted).Count(); 50 != count {
+		t.Errorf("requests.Count(): 50 != %v\n", count)
+	}
+	if count := GetOrRegisterCounterFloat64("cpu", restarted).Count(); 1.75 != count {
+		t.Errorf("cpu.Count(): 1.75 != %v\n", count)
+	}
+	m := GetOrRegisterMeter("bytes", restarted)
+	if count := m.Count(); 1000 != count {
+		t.Errorf("bytes.Count(): 1000 != %v\n", count)
+	}
+	m.(*StandardMeter).Tick()
+	if rate := m.Rate1(); 0 != rate {
+		t.Errorf("bytes.Rate1(): 0 != %v\n", rate)
+	}
+	if rate := m.RateMean(); 0 != rate {
+		t.Errorf("bytes.RateMean(): 0 != %v\n", rate)
+	}
+	if count := h.Count(); 10 != count {
+		t.Errorf("latency.Count(): 10 != %v\n", count)
+	}
+	if sum := h.Sum(); 55 != sum {
+		t.Errorf("latency.Sum(): 55 != %v\n", sum)
+	}
+	if nil != restarted.Get("size") {
+		t.Error("size was registered")
+	}
+}
+
+func TestLoadCheckpointMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := LoadCheckpoint(NewRegistry(), filepath.Join(dir, "metrics.json")); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestSaveCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.json")
+	r := NewRegistry()
+	GetOrRegisterCounter("requests", r).Inc(47)
+	if err := SaveCheckpoint(r, path); nil != err {
+		t.Fatal(err)
+	}
+	GetOrRegisterCounter("requests", r).Inc(1)
+	if err := SaveCheckpoint(r, path); nil != err {
+		t.Fatal(err)
+	}
+	restarted := NewRegistry()
+	if err := LoadCheckpoint(restarted, path); nil != err {
+		t.Fatal(err)
+	}
+	if count := GetOrRegisterCounter("requests", restarted).Count(); 48 != count {
+		t.Errorf("requests.Count(): 48 != %v\n", count)
+	}
+	if files, _ := ioutil.ReadDir(dir); 1 != len(files) {
+		t.Errorf("len(files): 1 != %v\n", len(files))
+	}
+}
+
+func TestUniformSampleBinary(t *testing.T) {
+	s := NewUniformSample(5)
+	for i := int64(-3); i < 100; i++ {
+		s.Update(i)
+	}
+	data, err := s.(*UniformSample).MarshalBinary()
+	if nil != err {
+		t.Fatal(err)
+	}
+	restored := NewUniformSample(5)
+	if err := restored.(*UniformSample).UnmarshalBinary(data); nil != err {
+		t.Fatal(err)
+	}
+	if restored.Count() != s.Count() || restored.Sum() != s.Sum() || restored.Size() != s.Size() {
+		t.Errorf("restored: %v != %v\n", restored.Values(), s.Values())
+	}
+	if total, expected := sampleTotalSum(restored), sampleTotalSum(s); expected != total {
+		t.Errorf("sampleTotalSum(restored): %v != %v\n", expected, total)
+	}
+	if err := restored.(*UniformSample).UnmarshalBinary(data[:len(data)-1]); nil == err {
+		t.Error("UnmarshalBinary(): expected an error for truncated data")
+	}
+}
+
+func TestUniformSampleBinaryVersion1(t *testing.T) {
+	data := []byte{1}
+	data = binary.AppendVarint(data, 10)                    // count
+	data = binary.AppendUvarint(data, math.Float64bits(10)) // weight
+	data = binary.AppendUvarint(data, 2)                    // size
+	data = binary.AppendVarint(data, 4)
+	data = binary.AppendVarint(data, 6)
+	s := NewUniformSample(5)
+	if err := s.(*UniformSample).UnmarshalBinary(data); nil != err {
+		t.Fatal(err)
+	}
+	if total := sampleTotalSum(s); 50 != total {
+		t.Errorf("sampleTotalSum(s): 50 != %v\n", total)
+	}
+}
@@ -1,15 +1,13 @@
 package metrics
 
-import "sync/atomic"
+import (
+	"fmt"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
 
 // Counters hold an int64 value that can be incremented and decremented.
-type Counter interface {
-	Clear()
-	Count() int64
-	Dec(int64)
-	Inc(int64)
-	Snapshot() Counter
-}
+type Counter = metricsiface.Counter
 
 // GetOrRegisterCounter returns an existing Counter or constructs and registers
 // a new StandardCounter.
@@ -22,10 +20,10 @@ func GetOrRegisterCounter(name string, r Registry) Counter {
 
 // NewCounter constructs a new StandardCounter.
 func NewCounter() Counter {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
 		return NilCounter{}
 	}
-	return &StandardCounter{0}
+	return &StandardCounter{}
 }
 
 // NewRegisteredCounter constructs and registers a new StandardCounter.
@@ -54,6 +52,11 @@ func (CounterSnapshot) Dec(int64) {
 	panic("Dec called on a CounterSnapshot")
 }
 
+// GoString formats the snapshot for %#v.
+func (c CounterSnapshot) GoString() string {
+	return fmt.Sprintf("metrics.CounterSnapshot(%d)", int64(c))
+}
+
 // Inc panics.
 func (CounterSnapshot) Inc(int64) {
 	panic("Inc called on a CounterSnapshot")
@@ -62,6 +65,9 @@ func (CounterSnapshot) Inc(int64) {
 // Snapshot returns the snapshot.
 func (c CounterSnapshot) Snapshot() Counter { return c }
 
+// String formats the count for debugging.
+func (c CounterSnapshot) String() string { return counterString(c) }
+
 // NilCounter is a no-op Counter.
 type NilCounter struct{}
 
@@ -80,33 +86,16 @@ func (NilCounter) Inc(i int64) {}
 // Snapshot is a no-op.
 func (NilCounter) Snapshot() Counter { return NilCounter{} }
 
-// StandardCounter is the standard implementation of a Counter and uses the
-// sync/atomic package to manage a single int64 value.
+// StandardCounter is the standard implementation of a Counter: a
+// CounterOf[int64], which manages its count atomically.
 type StandardCounter struct {
-	count int64
-}
-
-// Clear sets the counter to zero.
-func (c *StandardCounter) Clear() {
-	atomic.StoreInt64(&c.count, 0)
-}
-
-// Count returns the current count.
-func (c *StandardCounter) Count() int64 {
-	return atomic.LoadInt64(&c.count)
-}
-
-// Dec decrements the counter by the given amount.
-func (c *StandardCounter) Dec(i int64) {
-	atomic.AddInt64(&c.count, -i)
-}
-
-// Inc increments the counter by the given amount.
-func (c *StandardCounter) Inc(i int64) {
-	atomic.AddInt64(&c.count, i)
+	CounterOf[int64]
 }
 
 // Snapshot returns a read-only copy of the counter.
 func (c *StandardCounter) Snapshot() Counter {
 	return CounterSnapshot(c.Count())
 }
+
+// String formats the count for debugging.
+func (c *StandardCounter) String() string { return counterString(c) }
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
+
+// CounterFloat64s hold a float64 value that can be incremented and
+// decremented, for counting fractional amounts such as money or scores
+// without scaling them to integers.
+type CounterFloat64 = metricsiface.CounterFloat64
+
+// GetOrRegisterCounterFloat64 returns an existing CounterFloat64 or constructs
+// and registers a new StandardCounterFloat64.
+func GetOrRegisterCounterFloat64(name string, r Registry) CounterFloat64 {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, NewCounterFloat64).(CounterFloat64)
+}
+
+// NewCounterFloat64 constructs a new StandardCounterFloat64.
+func NewCounterFloat64() CounterFloat64 {
+	if metricsDisabled || UseNilMetrics {
+		return NilCounterFloat64{}
+	}
+	return &StandardCounterFloat64{}
+}
+
+// NewRegisteredCounterFloat64 constructs and registers a new
+// StandardCounterFloat64.
+func NewRegisteredCounterFloat64(name string, r Registry) CounterFloat64 {
+	c := NewCounterFloat64()
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// CounterFloat64Snapshot is a read-only copy of another CounterFloat64.
+type CounterFloat64Snapshot float64
+
+// Clear panics.
+func (CounterFloat64Snapshot) Clear() {
+	panic("Clear called on a CounterFloat64Snapshot")
+}
+
+// Count returns the count at the time the snapshot was taken.
+func (c CounterFloat64Snapshot) Count() float64 { return float64(c) }
+
+// Dec panics.
+func (CounterFloat64Snapshot) Dec(float64) {
+	panic("Dec called on a CounterFloat64Snapshot")
+}
+
+// GoString formats the snapshot for %#v.
+func (c CounterFloat64Snapshot) GoString() string {
+	return fmt.Sprintf("metrics.CounterFloat64Snapshot(%v)", float64(c))
+}
+
+// Inc panics.
+func (CounterFloat64Snapshot) Inc(float64) {
+	panic("Inc called on a CounterFloat64Snapshot")
+}
+
+// Snapshot returns the snapshot.
+func (c CounterFloat64Snapshot) Snapshot() CounterFloat64 { return c }
+
+// String formats the count for debugging.
+func (c CounterFloat64Snapshot) String() string { return counterFloat64String(c) }
+
+// NilCounterFloat64 is a no-op CounterFloat64.
+type NilCounterFloat64 struct{}
+
+// Clear is a no-op.
+func (NilCounterFloat64) Clear() {}
+
+// Count is a no-op.
+func (NilCounterFloat64) Count() float64 { return 0.0 }
+
+// Dec is a no-op.
+func (NilCounterFloat64) Dec(v float64) {}
+
+// Inc is a no-op.
+func (NilCounterFloat64) Inc(v float64) {}
+
+// Snapshot is a no-op.
+func (NilCounterFloat64) Snapshot() CounterFloat64 { return NilCounterFloat64{} }
+
+// StandardCounterFloat64 is the standard implementation of a CounterFloat64:
+// a CounterOf[float64], which adds to its count with a compare-and-swap loop.
+type StandardCounterFloat64 struct {
+	CounterOf[float64]
+}
+
+// Snapshot returns a read-only copy of the counter.
+func (c *StandardCounterFloat64) Snapshot() CounterFloat64 {
+	return CounterFloat64Snapshot(c.Count())
+}
+
+// String formats the count for debugging.
+func (c *StandardCounterFloat64) String() string { return counterFloat64String(c) }
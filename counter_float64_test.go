@@ -0,0 +1,49 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func BenchmarkCounterFloat64(b *testing.B) {
+	c := NewCounterFloat64()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Inc(0.5)
+	}
+}
+
+func TestCounterFloat64(t *testing.T) {
+	c := NewCounterFloat64()
+	c.Inc(1.25)
+	c.Inc(2.5)
+	c.Dec(0.5)
+	if count := c.Count(); 3.25 != count {
+		t.Errorf("c.Count(): 3.25 != %v\n", count)
+	}
+	c.Clear()
+	if count := c.Count(); 0.0 != count {
+		t.Errorf("c.Count(): 0.0 != %v\n", count)
+	}
+}
+
+func TestCounterFloat64Snapshot(t *testing.T) {
+	c := NewCounterFloat64()
+	c.Inc(1.5)
+	snapshot := c.Snapshot()
+	c.Inc(1)
+	if count := snapshot.Count(); 1.5 != count {
+		t.Errorf("c.Count(): 1.5 != %v\n", count)
+	}
+}
+
+func TestGetOrRegisterCounterFloat64(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounterFloat64("foo", r).Inc(47.5)
+	if c := GetOrRegisterCounterFloat64("foo", r); 47.5 != c.Count() {
+		t.Fatal(c)
+	}
+	if v, ok := MetricField(r.Get("foo"), "count"); !ok || 47.5 != v {
+		t.Errorf("MetricField(foo, count): 47.5 != %v (%v)\n", v, ok)
+	}
+}
@@ -1,3 +1,6 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
 import "testing"
@@ -0,0 +1,342 @@
+// Package custommetrics serves metrics in a Registry through the Kubernetes
+// custom metrics API, custom.metrics.k8s.io/v1beta2, so that a
+// HorizontalPodAutoscaler can scale on an application's own meters and
+// gauges without a separate adapter and the monitoring stack behind it.
+// Register the handler's service with an APIService and serve it over TLS:
+//
+//	http.Handle("/apis/custom.metrics.k8s.io/", custommetrics.Handler(custommetrics.Config{
+//		Objects: []custommetrics.Object{
+//			custommetrics.Pod(os.Getenv("POD_NAMESPACE"), os.Getenv("POD_NAME"), nil),
+//		},
+//		Metrics: []string{"requests", "queue.depth"},
+//	}))
+//
+// It answers with the value of each metric as the process sees it, so it
+// suits objects whose metrics one process knows in full, such as a
+// coordinator describing its workers or a pod describing itself.
+package custommetrics
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	// Group is the API group of the custom metrics API.
+	Group = "custom.metrics.k8s.io"
+	// Version is the version of the API served.
+	Version = "v1beta2"
+)
+
+// Config configures the objects and metrics served by Handler.
+type Config struct {
+	Objects []Object // Objects described by the metrics
+	Metrics []string // Names of the metrics served; nil serves every one
+}
+
+// An Object is a Kubernetes object described by the metrics in a registry.
+// A metric named by metrics.TaggedName is served under the name of its
+// family, and its tags are the labels matched by a request's
+// metricSelector.  Counters and CounterFloat64s are served by their count,
+// gauges and GaugeFloat64s by their value, and meters and timers by their
+// one-minute rate, with a window of 60 seconds.  When several metrics of a
+// family match a selector, their values are summed.  Other metrics are
+// skipped.
+type Object struct {
+	Resource   string            // Plural resource, such as "pods"
+	Kind       string            // Kind, such as "Pod"
+	APIVersion string            // API version of the object, such as "v1"
+	Namespace  string            // Namespace, or empty for a cluster-scoped object
+	Name       string            // Name
+	Labels     map[string]string // Labels matched by a request's labelSelector
+	Registry   metrics.Registry  // Registry of the object's metrics; nil means metrics.DefaultRegistry
+}
+
+// Pod returns the Object of the named pod, whose metrics are those in the
+// given registry.  A pod usually learns its own namespace and name from
+// environment variables set through the downward API.
+func Pod(namespace, name string, r metrics.Registry) Object {
+	return Object{Resource: "pods", Kind: "Pod", APIVersion: "v1", Namespace: namespace, Name: name, Registry: r}
+}
+
+// Handler returns an http.Handler which serves the custom metrics API under
+// /apis/custom.metrics.k8s.io: discovery of the group and of the resources
+// and metrics served, and the values of a metric for a named object or, for
+// the name "*", every object of a resource matching the labelSelector.
+// Namespaces themselves are described by Objects of the resource
+// "namespaces" without a namespace of their own.
+func Handler(c Config) http.Handler {
+	h := &handler{objects: c.Objects}
+	if nil != c.Metrics {
+		h.selected = make(map[string]bool, len(c.Metrics))
+		for _, name := range c.Metrics {
+			h.selected[name] = true
+		}
+	}
+	return h
+}
+
+type handler struct {
+	objects  []Object
+	selected map[string]bool // nil selects every metric
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if "GET" != req.Method {
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "only GET is supported")
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, "/apis/"+Group), "/")
+	if "" == path {
+		writeJSON(w, h.group())
+		return
+	}
+	parts := strings.Split(path, "/")
+	if Version != parts[0] {
+		writeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+		return
+	}
+	var namespace, resource, name, metric string
+	switch parts = parts[1:]; {
+	case 0 == len(parts):
+		writeJSON(w, h.resources())
+		return
+	case 4 == len(parts) && "namespaces" == parts[0] && "metrics" == parts[2]:
+		resource, name, metric = "namespaces", parts[1], parts[3]
+	case 5 == len(parts) && "namespaces" == parts[0]:
+		namespace, resource, name, metric = parts[1], parts[2], parts[3], parts[4]
+	case 3 == len(parts):
+		resource, name, metric = parts[0], parts[1], parts[2]
+	default:
+		writeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+		return
+	}
+	metricSelector, err := parseSelector(req.URL.Query().Get("metricSelector"))
+	if nil != err {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	labelSelector, err := parseSelector(req.URL.Query().Get("labelSelector"))
+	if nil != err {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	if nil != h.selected && !h.selected[metric] {
+		writeStatus(w, http.StatusNotFound, "NotFound", "metric "+metric+" is not served")
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	items := []metricValue{}
+	for _, o := range h.objects {
+		if resource != o.Resource || namespace != o.Namespace {
+			continue
+		}
+		if "*" == name && !labelSelector.matches(o.Labels) || "*" != name && name != o.Name {
+			continue
+		}
+		v, window, ok := value(o.Registry, metric, metricSelector)
+		if !ok {
+			continue
+		}
+		items = append(items, metricValue{
+			DescribedObject: objectReference{Kind: o.Kind, Namespace: o.Namespace, Name: o.Name, APIVersion: o.APIVersion},
+			Metric:          metricIdentifier{Name: metric, Selector: metricSelector.labelSelector()},
+			Timestamp:       now,
+			WindowSeconds:   window,
+			Value:           quantity(v),
+		})
+	}
+	if "*" != name && 0 == len(items) {
+		writeStatus(w, http.StatusNotFound, "NotFound", "metric "+metric+" for "+resource+" "+name+" not found")
+		return
+	}
+	writeJSON(w, metricValueList{Kind: "MetricValueList", APIVersion: Group + "/" + Version, Items: items})
+}
+
+// group returns the APIGroup of discovery.
+func (h *handler) group() interface{} {
+	gv := map[string]string{"groupVersion": Group + "/" + Version, "version": Version}
+	return map[string]interface{}{
+		"kind":             "APIGroup",
+		"apiVersion":       "v1",
+		"name":             Group,
+		"versions":         []interface{}{gv},
+		"preferredVersion": gv,
+	}
+}
+
+// resources returns the APIResourceList of discovery, with a resource for
+// each metric of each resource of the objects.
+func (h *handler) resources() interface{} {
+	type resource struct {
+		Name         string   `json:"name"`
+		SingularName string   `json:"singularName"`
+		Namespaced   bool     `json:"namespaced"`
+		Kind         string   `json:"kind"`
+		Verbs        []string `json:"verbs"`
+	}
+	seen := make(map[string]bool)
+	resources := []resource{}
+	for _, o := range h.objects {
+		r := o.Registry
+		if nil == r {
+			r = metrics.DefaultRegistry
+		}
+		r.Each(func(name string, i interface{}) {
+			family, _ := metrics.SplitTaggedName(name)
+			if _, _, ok := valueOf(i); !ok || nil != h.selected && !h.selected[family] {
+				return
+			}
+			name = o.Resource + "/" + family
+			if seen[name] {
+				return
+			}
+			seen[name] = true
+			resources = append(resources, resource{
+				Name:       name,
+				Namespaced: "" != o.Namespace,
+				Kind:       "MetricValueList",
+				Verbs:      []string{"get"},
+			})
+		})
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	return map[string]interface{}{
+		"kind":         "APIResourceList",
+		"apiVersion":   "v1",
+		"groupVersion": Group + "/" + Version,
+		"resources":    resources,
+	}
+}
+
+// value returns the sum of the values of the metrics of the given family
+// in a registry whose tags match the selector, with the window of any meter
+// among them, and whether there are any.
+func value(r metrics.Registry, family string, s selector) (float64, *int64, bool) {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	var (
+		sum    float64
+		window *int64
+		found  bool
+	)
+	r.Each(func(name string, i interface{}) {
+		f, tags := metrics.SplitTaggedName(name)
+		if family != f || !s.matches(tags) {
+			return
+		}
+		v, w, ok := valueOf(i)
+		if !ok {
+			return
+		}
+		sum += v
+		if nil != w {
+			window = w
+		}
+		found = true
+	})
+	return sum, window, found
+}
+
+// valueOf returns the value served of a metric, its window if it's a rate,
+// and whether it's of a kind which is served.
+func valueOf(i interface{}) (float64, *int64, bool) {
+	minute := int64(60)
+	switch metric := i.(type) {
+	case metrics.Counter:
+		return float64(metric.Count()), nil, true
+	case metrics.CounterFloat64:
+		return metric.Count(), nil, true
+	case metrics.Gauge:
+		return float64(metric.Value()), nil, true
+	case metrics.GaugeFloat64:
+		return metric.Value(), nil, true
+	case metrics.Meter:
+		return metric.Rate1(), &minute, true
+	case metrics.Timer:
+		return metric.Rate1(), &minute, true
+	}
+	return 0, nil, false
+}
+
+// quantity formats a value as a Kubernetes quantity, in thousandths if it
+// isn't whole.  NaN and ±Inf, which quantities can't represent, are zero.
+func quantity(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "0"
+	}
+	if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	milli := math.Round(v * 1000)
+	if milli == math.Trunc(milli/1000)*1000 {
+		return strconv.FormatInt(int64(milli/1000), 10)
+	}
+	return strconv.FormatInt(int64(milli), 10) + "m"
+}
+
+type metricValueList struct {
+	Kind       string        `json:"kind"`
+	APIVersion string        `json:"apiVersion"`
+	Metadata   struct{}      `json:"metadata"`
+	Items      []metricValue `json:"items"`
+}
+
+type metricValue struct {
+	DescribedObject objectReference  `json:"describedObject"`
+	Metric          metricIdentifier `json:"metric"`
+	Timestamp       string           `json:"timestamp"`
+	WindowSeconds   *int64           `json:"windowSeconds,omitempty"`
+	Value           string           `json:"value"`
+}
+
+type objectReference struct {
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	APIVersion string `json:"apiVersion"`
+}
+
+type metricIdentifier struct {
+	Name     string         `json:"name"`
+	Selector *labelSelector `json:"selector,omitempty"`
+}
+
+type labelSelector struct {
+	MatchLabels      map[string]string `json:"matchLabels,omitempty"`
+	MatchExpressions []requirement     `json:"matchExpressions,omitempty"`
+}
+
+type requirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeStatus responds with a failed Status, as the Kubernetes API does.
+func writeStatus(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   struct{}{},
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       code,
+	})
+}
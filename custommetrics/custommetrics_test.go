@@ -0,0 +1,169 @@
+package custommetrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func get(t *testing.T, h http.Handler, url string, v interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if nil != v {
+		if err := json.Unmarshal(w.Body.Bytes(), v); nil != err {
+			t.Fatalf("%s: %v: %s", url, err, w.Body)
+		}
+	}
+	return w.Code
+}
+
+func testHandler() http.Handler {
+	web1, web2 := metrics.NewRegistry(), metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("queue.depth", web1).Update(3)
+	metrics.GetOrRegisterGauge("queue.depth", web2).Update(5)
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"code": "200"}), web1).Inc(7)
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"code": "500"}), web1).Inc(2)
+	metrics.GetOrRegisterGaugeFloat64("load", web1).Update(1.5)
+	metrics.GetOrRegisterGauge("secret", web1).Update(42)
+	w1 := Pod("default", "web-1", web1)
+	w1.Labels = map[string]string{"app": "web"}
+	w2 := Pod("default", "web-2", web2)
+	w2.Labels = map[string]string{"app": "web"}
+	return Handler(Config{
+		Objects: []Object{w1, w2},
+		Metrics: []string{"queue.depth", "requests", "load"},
+	})
+}
+
+func TestDiscovery(t *testing.T) {
+	h := testHandler()
+	var group struct {
+		Kind, Name       string
+		PreferredVersion struct{ GroupVersion string }
+	}
+	if code := get(t, h, "/apis/custom.metrics.k8s.io", &group); 200 != code || "APIGroup" != group.Kind || "custom.metrics.k8s.io/v1beta2" != group.PreferredVersion.GroupVersion {
+		t.Errorf("group: %d %+v", code, group)
+	}
+	var list struct {
+		Kind      string
+		Resources []struct {
+			Name       string
+			Namespaced bool
+		}
+	}
+	get(t, h, "/apis/custom.metrics.k8s.io/v1beta2", &list)
+	if 3 != len(list.Resources) {
+		t.Fatalf("resources: %+v", list.Resources)
+	}
+	for i, name := range []string{"pods/load", "pods/queue.depth", "pods/requests"} {
+		if r := list.Resources[i]; name != r.Name || !r.Namespaced {
+			t.Errorf("resources[%d]: %+v", i, r)
+		}
+	}
+}
+
+type valueList struct {
+	Kind  string
+	Items []struct {
+		DescribedObject struct{ Kind, Namespace, Name string }
+		Metric          struct {
+			Name     string
+			Selector *struct{ MatchLabels map[string]string }
+		}
+		WindowSeconds *int64
+		Value         string
+	}
+}
+
+func TestMetricValues(t *testing.T) {
+	h := testHandler()
+	var list valueList
+	if code := get(t, h, "/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/*/queue.depth?labelSelector=app%3Dweb", &list); 200 != code {
+		t.Fatalf("code: %d", code)
+	}
+	if "MetricValueList" != list.Kind || 2 != len(list.Items) || "web-1" != list.Items[0].DescribedObject.Name || "3" != list.Items[0].Value || "web-2" != list.Items[1].DescribedObject.Name || "5" != list.Items[1].Value {
+		t.Errorf("queue.depth: %+v", list)
+	}
+
+	list = valueList{}
+	get(t, h, "/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/web-1/requests", &list)
+	if 1 != len(list.Items) || "9" != list.Items[0].Value {
+		t.Errorf("requests: %+v", list)
+	}
+	list = valueList{}
+	get(t, h, "/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/web-1/requests?metricSelector=code%3D500", &list)
+	if 1 != len(list.Items) || "2" != list.Items[0].Value || "500" != list.Items[0].Metric.Selector.MatchLabels["code"] {
+		t.Errorf("requests{code=500}: %+v", list)
+	}
+	list = valueList{}
+	get(t, h, "/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/web-1/load", &list)
+	if 1 != len(list.Items) || "1500m" != list.Items[0].Value {
+		t.Errorf("load: %+v", list)
+	}
+
+	list = valueList{}
+	get(t, h, "/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/*/queue.depth?labelSelector=app%3Ddb", &list)
+	if 0 != len(list.Items) {
+		t.Errorf("app=db: %+v", list)
+	}
+	for _, url := range []string{
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/web-3/queue.depth",
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/other/pods/web-1/queue.depth",
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/web-1/secret",
+		"/apis/custom.metrics.k8s.io/v1beta1/namespaces/default/pods/web-1/queue.depth",
+	} {
+		var status struct{ Kind, Reason string }
+		if code := get(t, h, url, &status); 404 != code || "Status" != status.Kind || "NotFound" != status.Reason {
+			t.Errorf("%s: %d %+v", url, code, status)
+		}
+	}
+}
+
+func TestMeterWindow(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterMeter("jobs", r)
+	h := Handler(Config{Objects: []Object{Pod("default", "worker", r)}})
+	var list valueList
+	get(t, h, "/apis/custom.metrics.k8s.io/v1beta2/namespaces/default/pods/worker/jobs", &list)
+	if 1 != len(list.Items) || nil == list.Items[0].WindowSeconds || 60 != *list.Items[0].WindowSeconds {
+		t.Errorf("jobs: %+v", list)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"code": "200", "method": "GET"}
+	for s, match := range map[string]bool{
+		"":                         true,
+		"code=200":                 true,
+		"code==200,method=GET":     true,
+		"code!=200":                false,
+		"code in (200, 204)":       true,
+		"code notin (200,204)":     false,
+		"method,!tier":             true,
+		"tier":                     false,
+		"code in (500),method=GET": false,
+	} {
+		sel, err := parseSelector(s)
+		if nil != err {
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if m := sel.matches(labels); match != m {
+			t.Errorf("%q: %v != %v", s, match, m)
+		}
+	}
+	if _, err := parseSelector("code ~ 200"); nil == err {
+		t.Error("no error from an invalid selector")
+	}
+}
+
+func TestQuantity(t *testing.T) {
+	for v, s := range map[float64]string{0: "0", 3: "3", -2: "-2", 1.5: "1500m", 0.0004: "0", 2.9999: "3", 0.25: "250m"} {
+		if q := quantity(v); s != q {
+			t.Errorf("quantity(%v): %q != %q", v, s, q)
+		}
+	}
+}
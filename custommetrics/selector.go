@@ -0,0 +1,153 @@
+package custommetrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A selector is a parsed Kubernetes label selector, such as
+// "code=200,method!=GET" or "tier in (web,api)".  The empty selector matches
+// everything.
+type selector []requirement
+
+// parseSelector parses the string form of a label selector.
+func parseSelector(s string) (selector, error) {
+	var sel selector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if "" == term {
+			continue
+		}
+		r, err := parseRequirement(term)
+		if nil != err {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// splitTerms splits a selector at the commas which aren't within the
+// parentheses of a set of values.
+func splitTerms(s string) []string {
+	var (
+		terms []string
+		depth int
+		start int
+	)
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if 0 == depth {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (requirement, error) {
+	if strings.HasPrefix(term, "!") {
+		return requirement{Key: strings.TrimSpace(term[1:]), Operator: "DoesNotExist"}, nil
+	}
+	for _, op := range []struct{ token, operator string }{
+		{"!=", "NotIn"},
+		{"==", "In"},
+		{"=", "In"},
+	} {
+		if i := strings.Index(term, op.token); 0 <= i {
+			key, value := strings.TrimSpace(term[:i]), strings.TrimSpace(term[i+len(op.token):])
+			if "" == key {
+				return requirement{}, fmt.Errorf("invalid selector %q", term)
+			}
+			return requirement{Key: key, Operator: op.operator, Values: []string{value}}, nil
+		}
+	}
+	if fields := strings.Fields(term); 2 <= len(fields) {
+		key := fields[0]
+		rest := strings.TrimSpace(strings.TrimPrefix(term, key))
+		for _, op := range []struct{ token, operator string }{
+			{"notin", "NotIn"},
+			{"in", "In"},
+		} {
+			if !strings.HasPrefix(rest, op.token) {
+				continue
+			}
+			set := strings.TrimSpace(rest[len(op.token):])
+			if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+				break
+			}
+			var values []string
+			for _, v := range strings.Split(set[1:len(set)-1], ",") {
+				values = append(values, strings.TrimSpace(v))
+			}
+			return requirement{Key: key, Operator: op.operator, Values: values}, nil
+		}
+		return requirement{}, fmt.Errorf("invalid selector %q", term)
+	}
+	return requirement{Key: term, Operator: "Exists"}, nil
+}
+
+// matches returns whether the given labels satisfy every requirement.
+func (s selector) matches(labels map[string]string) bool {
+	for _, r := range s {
+		v, ok := labels[r.Key]
+		switch r.Operator {
+		case "Exists":
+			if !ok {
+				return false
+			}
+		case "DoesNotExist":
+			if ok {
+				return false
+			}
+		case "In":
+			if !ok || !contains(r.Values, v) {
+				return false
+			}
+		case "NotIn":
+			if ok && contains(r.Values, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// labelSelector returns the structured form of the selector served in each
+// MetricValue, with single-valued equalities as matchLabels, or nil if it's
+// empty.
+func (s selector) labelSelector() *labelSelector {
+	if 0 == len(s) {
+		return nil
+	}
+	ls := &labelSelector{}
+	for _, r := range s {
+		if "In" == r.Operator && 1 == len(r.Values) {
+			if nil == ls.MatchLabels {
+				ls.MatchLabels = make(map[string]string)
+			}
+			ls.MatchLabels[r.Key] = r.Values[0]
+			continue
+		}
+		values := append([]string(nil), r.Values...)
+		sort.Strings(values)
+		ls.MatchExpressions = append(ls.MatchExpressions, requirement{Key: r.Key, Operator: r.Operator, Values: values})
+	}
+	return ls
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultResolveEvery is how often a Dialer re-resolves its host name unless
+// configured otherwise.
+const DefaultResolveEvery = time.Minute
+
+// A Dialer keeps a push reporter's TCP connection to a backend named by its
+// host name open from one flush to the next.  Every ResolveEvery it resolves
+// the name again and, if the address it's connected to is no longer among
+// the results, as when a load balancer fails over, it reconnects.  It also
+// reconnects once the connection is MaxAge old and after any flush fails.
+// Connections are raced across the name's IPv4 and IPv6 addresses as by
+// net.Dialer, which implements Happy Eyeballs (RFC 6555).  Each reporter
+// needs a Dialer of its own.
+type Dialer struct {
+	Address       string        // Host name and port of the backend
+	ResolveEvery  time.Duration // Interval between resolutions; zero means DefaultResolveEvery
+	MaxAge        time.Duration // Age at which to reconnect; zero means never
+	FallbackDelay time.Duration // Head start of the preferred address family; zero means net.Dialer's default
+	TLSConfig     *tls.Config   // If not nil, connects over TLS
+
+	mutex      sync.Mutex
+	conn       net.Conn
+	connected  time.Time
+	resolved   time.Time
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// open returns the connection, connecting first if there isn't one or it's
+// due to be replaced, with its reads and writes bounded by the context's
+// deadline and interrupted if it's cancelled.  The returned function must be
+// called once the flush is done; it closes the connection if the flush
+// failed or was cancelled so that the next flush reconnects.
+func (d *Dialer) open(ctx context.Context) (net.Conn, func(), error) {
+	d.mutex.Lock()
+	if err := d.refresh(ctx, time.Now()); nil != err {
+		d.mutex.Unlock()
+		return nil, nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	d.conn.SetDeadline(deadline)
+	conn := &dialerConn{Conn: d.conn}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return conn, func() {
+		close(done)
+		if conn.failed || nil != ctx.Err() {
+			d.conn.Close()
+			d.conn = nil
+		}
+		d.mutex.Unlock()
+	}, nil
+}
+
+// Close closes the connection, if any.
+func (d *Dialer) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if nil == d.conn {
+		return nil
+	}
+	err := d.conn.Close()
+	d.conn = nil
+	return err
+}
+
+// refresh closes the connection if it's too old or its address no longer
+// resolves from the host name and connects if there's no connection.  The
+// caller must hold d.mutex.
+func (d *Dialer) refresh(ctx context.Context, now time.Time) error {
+	if nil != d.conn && 0 < d.MaxAge && d.MaxAge <= now.Sub(d.connected) {
+		d.conn.Close()
+		d.conn = nil
+	}
+	resolveEvery := d.ResolveEvery
+	if 0 == resolveEvery {
+		resolveEvery = DefaultResolveEvery
+	}
+	if nil != d.conn && resolveEvery <= now.Sub(d.resolved) {
+		d.resolved = now
+		if !d.stillResolves(ctx) {
+			d.conn.Close()
+			d.conn = nil
+		}
+	}
+	if nil != d.conn {
+		return nil
+	}
+	dialer := &net.Dialer{FallbackDelay: d.FallbackDelay}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if nil != d.TLSConfig {
+		tlsDialer := tls.Dialer{NetDialer: dialer, Config: d.TLSConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", d.Address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", d.Address)
+	}
+	if nil != err {
+		return err
+	}
+	d.conn, d.connected, d.resolved = conn, now, now
+	return nil
+}
+
+// stillResolves returns whether the host name still resolves to the address
+// of the connection.  Failing to resolve it isn't taken as a change, so that
+// a DNS outage doesn't also disconnect every reporter.
+func (d *Dialer) stillResolves(ctx context.Context) bool {
+	host, _, err := net.SplitHostPort(d.Address)
+	if nil != err {
+		return true
+	}
+	lookupHost := d.lookupHost
+	if nil == lookupHost {
+		lookupHost = net.DefaultResolver.LookupHost
+	}
+	addrs, err := lookupHost(ctx, host)
+	if nil != err {
+		return true
+	}
+	remote, ok := d.conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); nil != ip && ip.Equal(remote.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialerConn is a Dialer's connection as used by one flush, which records
+// whether any write failed.
+type dialerConn struct {
+	net.Conn
+	failed bool
+}
+
+func (c *dialerConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if nil != err {
+		c.failed = true
+	}
+	return n, err
+}
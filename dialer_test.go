@@ -0,0 +1,116 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// acceptAll accepts connections from l, sending what's read from each to
+// out once it's closed.
+func acceptAll(l net.Listener, out chan<- string) {
+	for {
+		conn, err := l.Accept()
+		if nil != err {
+			return
+		}
+		go func() {
+			b, _ := ioutil.ReadAll(conn)
+			out <- string(b)
+		}()
+	}
+}
+
+func TestDialerReusesConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	out := make(chan string, 3)
+	go acceptAll(l, out)
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	d := &Dialer{Address: net.JoinHostPort("localhost", port), MaxAge: time.Hour}
+	d.lookupHost = func(context.Context, string) ([]string, error) { return []string{"127.0.0.1"}, nil }
+	c := GraphiteConfig{Dialer: d, Registry: r, DurationUnit: time.Nanosecond, Prefix: "prefix"}
+	for i := 0; i < 2; i++ {
+		if err := GraphiteOnce(c); nil != err {
+			t.Fatal(err)
+		}
+	}
+	first := d.conn
+	d.Close()
+	if s := <-out; 2 != bytes.Count([]byte(s), []byte("prefix.requests.count 47 ")) {
+		t.Errorf("graphite: %q\n", s)
+	}
+
+	if err := GraphiteOnce(c); nil != err {
+		t.Fatal(err)
+	}
+	if first == d.conn {
+		t.Error("d.conn: not reconnected after Close")
+	}
+	second := d.conn
+	d.connected = d.connected.Add(-2 * time.Hour)
+	if err := GraphiteOnce(c); nil != err {
+		t.Fatal(err)
+	}
+	if second == d.conn {
+		t.Error("d.conn: not reconnected after MaxAge")
+	}
+	d.Close()
+	<-out
+	<-out
+}
+
+func TestDialerReresolves(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	out := make(chan string, 2)
+	go acceptAll(l, out)
+	addrs := []string{"127.0.0.1"}
+	d := &Dialer{Address: l.Addr().String(), ResolveEvery: time.Minute}
+	d.lookupHost = func(context.Context, string) ([]string, error) { return addrs, nil }
+	for i := 0; i < 2; i++ {
+		_, done, err := d.open(context.Background())
+		if nil != err {
+			t.Fatal(err)
+		}
+		done()
+	}
+	first := d.conn
+	d.resolved = d.resolved.Add(-2 * time.Minute)
+	if _, done, err := d.open(context.Background()); nil != err {
+		t.Fatal(err)
+	} else {
+		done()
+	}
+	if first != d.conn {
+		t.Error("d.conn: reconnected though the address still resolves")
+	}
+	addrs = []string{"192.0.2.1"}
+	d.resolved = d.resolved.Add(-2 * time.Minute)
+	if _, done, err := d.open(context.Background()); nil != err {
+		t.Fatal(err)
+	} else {
+		done()
+	}
+	if first == d.conn {
+		t.Error("d.conn: not reconnected after the address changed")
+	}
+	d.Close()
+	<-out
+	<-out
+}
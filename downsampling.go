@@ -0,0 +1,77 @@
+package metrics
+
+// Downsampling reduces the detail with which a reporter exports histograms,
+// independently of the precision they keep in memory, so that the cost of an
+// expensive backend can be controlled without losing the detail available to
+// local diagnostics such as the JSON handler.  A nil *Downsampling exports
+// every detail.
+type Downsampling struct {
+
+	// Percentiles, if not nil, replaces the percentiles the reporter would
+	// otherwise export from histograms and timers.  An empty, non-nil slice
+	// exports none.
+	Percentiles []float64
+
+	// BucketFactor, if greater than one, merges the buckets of each axis of
+	// a Histogram2D that many at a time, so a factor of 2 exports a quarter
+	// as many cells.  Each merged bucket takes the upper bound of the last
+	// bucket merged into it and the overflow bucket is never merged.
+	BucketFactor int
+}
+
+// percentiles returns the percentiles to export in place of the given
+// defaults.
+func (d *Downsampling) percentiles(defaults []float64) []float64 {
+	if nil == d || nil == d.Percentiles {
+		return defaults
+	}
+	return d.Percentiles
+}
+
+// histogram2D returns a snapshot of the given Histogram2D with its buckets
+// merged according to BucketFactor.
+func (d *Downsampling) histogram2D(h Histogram2D) Histogram2D {
+	h = h.Snapshot()
+	if nil == d || d.BucketFactor <= 1 {
+		return h
+	}
+	n := d.BucketFactor
+	xBounds, yBounds := mergeBounds(h.XBounds(), n), mergeBounds(h.YBounds(), n)
+	snapshot := &Histogram2DSnapshot{
+		xBounds: xBounds,
+		yBounds: yBounds,
+		count:   h.Count(),
+		counts:  make([][]int64, len(xBounds)+1),
+	}
+	for i := range snapshot.counts {
+		snapshot.counts[i] = make([]int64, len(yBounds)+1)
+	}
+	xs, ys := len(h.XBounds()), len(h.YBounds())
+	for i, row := range h.Counts() {
+		for j, count := range row {
+			snapshot.counts[mergedIndex(i, xs, n)][mergedIndex(j, ys, n)] += count
+		}
+	}
+	return snapshot
+}
+
+// mergeBounds returns the bounds of buckets merged n at a time.
+func mergeBounds(bounds []int64, n int) []int64 {
+	merged := make([]int64, 0, (len(bounds)+n-1)/n)
+	for i := n - 1; i < len(bounds)+n-1; i += n {
+		if i >= len(bounds) {
+			i = len(bounds) - 1
+		}
+		merged = append(merged, bounds[i])
+	}
+	return merged
+}
+
+// mergedIndex returns the index of the merged bucket which holds bucket i of
+// an axis with the given number of bounds.
+func mergedIndex(i, bounds, n int) int {
+	if bounds == i {
+		return (bounds + n - 1) / n
+	}
+	return i / n
+}
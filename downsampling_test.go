@@ -0,0 +1,44 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestDownsamplingHistogram2D(t *testing.T) {
+	h := NewHistogram2D([]int64{1, 2, 3, 4, 5}, []int64{10, 20})
+	h.Update(1, 10)
+	h.Update(2, 20)
+	h.Update(5, 30)
+	h.Update(6, 30)
+	d := &Downsampling{BucketFactor: 2}
+	s := d.histogram2D(h)
+	if xs := s.XBounds(); 3 != len(xs) || 2 != xs[0] || 4 != xs[1] || 5 != xs[2] {
+		t.Errorf("s.XBounds(): [2 4 5] != %v\n", xs)
+	}
+	if ys := s.YBounds(); 1 != len(ys) || 20 != ys[0] {
+		t.Errorf("s.YBounds(): [20] != %v\n", ys)
+	}
+	counts := s.Counts()
+	if 4 != len(counts) || 2 != len(counts[0]) {
+		t.Fatalf("s.Counts(): %v\n", counts)
+	}
+	if 2 != counts[0][0] || 1 != counts[2][1] || 1 != counts[3][1] || 4 != s.Count() {
+		t.Errorf("s.Counts(): %v\n", counts)
+	}
+}
+
+func TestDownsamplingPercentiles(t *testing.T) {
+	defaults := []float64{0.5, 0.99}
+	var d *Downsampling
+	if ps := d.percentiles(defaults); 2 != len(ps) {
+		t.Errorf("d.percentiles(): %v\n", ps)
+	}
+	d = &Downsampling{Percentiles: []float64{0.999}}
+	if ps := d.percentiles(defaults); 1 != len(ps) || 0.999 != ps[0] {
+		t.Errorf("d.percentiles(): %v\n", ps)
+	}
+	if key := openTSDBPercentileKey(0.999); "999-percentile" != key {
+		t.Errorf("openTSDBPercentileKey(0.999): 999-percentile != %v\n", key)
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// A Backend is one of the destinations of a dual write.
+type Backend struct {
+	Name  string                                      // Reporter name under which the backend's errors are emitted
+	Flush func(ctx context.Context, r Registry) error // Sends one flush of r to the backend
+}
+
+// GraphiteBackend returns a Backend named "graphite" which flushes to
+// Graphite as by GraphiteOnceContext with the given configuration, whose
+// Registry, FlushInterval, and FlushTimeout are ignored.
+func GraphiteBackend(c GraphiteConfig) Backend {
+	return Backend{Name: "graphite", Flush: func(ctx context.Context, r Registry) error {
+		flush := c
+		flush.Registry = r
+		return graphite(ctx, &flush)
+	}}
+}
+
+// OpenTSDBBackend returns a Backend named "opentsdb" which flushes to
+// OpenTSDB as by OpenTSDBOnceContext with the given configuration, whose
+// Registry, FlushInterval, and FlushTimeout are ignored.
+func OpenTSDBBackend(c OpenTSDBConfig) Backend {
+	return Backend{Name: "opentsdb", Flush: func(ctx context.Context, r Registry) error {
+		flush := c
+		flush.Registry = r
+		return openTSDB(ctx, &flush)
+	}}
+}
+
+// DualWriteConfig provides a container with configuration parameters for a
+// dual write, which sends each flush of a registry to two or more backends
+// at once so that a migration from one to another can overlap them safely.
+type DualWriteConfig struct {
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	FlushTimeout  time.Duration // Deadline for each flush; zero means FlushInterval
+	Backends      []Backend     // Backends to which every flush is sent
+}
+
+// DualWriteWithConfig is a blocking exporter function which flushes the
+// metrics in c.Registry to every backend concurrently every c.FlushInterval.
+// Each backend's errors are handled independently: a failed or timed out
+// flush to one neither stops nor delays the others beyond c.FlushTimeout and
+// is logged and emitted as EventReporterError under the backend's name.
+func DualWriteWithConfig(c DualWriteConfig) {
+	DualWriteWithConfigContext(context.Background(), c)
+}
+
+// DualWriteWithConfigContext is a blocking exporter function just like
+// DualWriteWithConfig, but it returns once ctx is done, interrupting any
+// flush in progress.
+func DualWriteWithConfigContext(ctx context.Context, c DualWriteConfig) {
+	runFlushes(ctx, "dualwrite", c.Registry, c.FlushInterval, c.FlushTimeout, func(flushCtx context.Context) error {
+		errs := dualWrite(flushCtx, c)
+		for i, b := range c.Backends {
+			reportFlushError(ctx, flushCtx, b.Name, c.Registry, errs[i])
+		}
+		return nil
+	})
+}
+
+// DualWriteOnce performs a single flush to every backend, returning the
+// errors of those which failed joined as by errors.Join.
+func DualWriteOnce(c DualWriteConfig) error {
+	return DualWriteOnceContext(context.Background(), c)
+}
+
+// DualWriteOnceContext performs a single flush to every backend just like
+// DualWriteOnce, but abandons it when ctx is done.
+func DualWriteOnceContext(ctx context.Context, c DualWriteConfig) error {
+	return errors.Join(dualWrite(ctx, c)...)
+}
+
+// dualWrite flushes c.Registry to every backend concurrently and returns each
+// backend's error.
+func dualWrite(ctx context.Context, c DualWriteConfig) []error {
+	errs := make([]error, len(c.Backends))
+	var wg sync.WaitGroup
+	for i, b := range c.Backends {
+		wg.Add(1)
+		go func(i int, b Backend) {
+			defer wg.Done()
+			errs[i] = b.Flush(ctx, c.Registry)
+		}(i, b)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,37 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDualWriteOnce(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	var graphite, opentsdb bytes.Buffer
+	refused := errors.New("connection refused")
+	err := DualWriteOnce(DualWriteConfig{
+		Registry: r,
+		Backends: []Backend{
+			GraphiteBackend(GraphiteConfig{DurationUnit: time.Nanosecond, Prefix: "prefix", DryRun: &graphite}),
+			OpenTSDBBackend(OpenTSDBConfig{DurationUnit: time.Nanosecond, Prefix: "prefix", DryRun: &opentsdb}),
+			{Name: "broken", Flush: func(context.Context, Registry) error { return refused }},
+		},
+	})
+	if !errors.Is(err, refused) {
+		t.Errorf("DualWriteOnce(): %v\n", err)
+	}
+	if s := graphite.String(); !strings.HasPrefix(s, "prefix.requests.count 47 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+	if s := opentsdb.String(); !strings.HasPrefix(s, "put prefix.requests.count ") {
+		t.Errorf("opentsdb: %q\n", s)
+	}
+}
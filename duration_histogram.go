@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
+
+// DurationHistograms calculate distribution statistics from a series of
+// time.Duration values.  Unlike a Histogram of int64s there is no question of
+// whether values are nanoseconds or milliseconds: they are recorded and
+// reported as time.Durations and exporters convert them to their configured
+// DurationUnit.
+type DurationHistogram = metricsiface.DurationHistogram
+
+// GetOrRegisterDurationHistogram returns an existing DurationHistogram or
+// constructs and registers a new StandardDurationHistogram.  If s is nil the
+// new histogram is given a Sample as described by the registry's
+// SampleConfig.
+func GetOrRegisterDurationHistogram(name string, r Registry, s Sample) DurationHistogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() DurationHistogram {
+		if nil == s {
+			s = r.SampleConfig().NewSample()
+		}
+		return NewDurationHistogram(s)
+	}).(DurationHistogram)
+}
+
+// NewDurationHistogram constructs a new StandardDurationHistogram from a
+// Sample.
+func NewDurationHistogram(s Sample) DurationHistogram {
+	if metricsDisabled || UseNilMetrics {
+		return NilDurationHistogram{}
+	}
+	return &StandardDurationHistogram{HistogramOf[time.Duration]{sample: s}}
+}
+
+// NewRegisteredDurationHistogram constructs and registers a new
+// StandardDurationHistogram from a Sample or, if s is nil, from a Sample as
+// described by the registry's SampleConfig.
+func NewRegisteredDurationHistogram(name string, r Registry, s Sample) DurationHistogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	if nil == s {
+		s = r.SampleConfig().NewSample()
+	}
+	c := NewDurationHistogram(s)
+	r.Register(name, c)
+	return c
+}
+
+// DurationHistogramSnapshot is a read-only copy of another DurationHistogram.
+type DurationHistogramSnapshot struct {
+	percentiles []float64
+	sample      Sample
+}
+
+// Clear panics.
+func (*DurationHistogramSnapshot) Clear() {
+	panic("Clear called on a DurationHistogramSnapshot")
+}
+
+// Count returns the number of samples recorded at the time the snapshot was
+// taken.
+func (h *DurationHistogramSnapshot) Count() int64 { return h.sample.Count() }
+
+// ExportedPercentiles returns the percentiles set for the histogram at the
+// time the snapshot was taken or nil if none had been.
+func (h *DurationHistogramSnapshot) ExportedPercentiles() []float64 {
+	return h.percentiles
+}
+
+// GoString formats the statistics of the snapshot for %#v.
+func (h *DurationHistogramSnapshot) GoString() string {
+	return goString("DurationHistogramSnapshot", durationHistogramString(h))
+}
+
+// Max returns the maximum duration in the sample at the time the snapshot
+// was taken.
+func (h *DurationHistogramSnapshot) Max() time.Duration {
+	return time.Duration(h.sample.Max())
+}
+
+// Mean returns the mean of the durations in the sample at the time the
+// snapshot was taken.
+func (h *DurationHistogramSnapshot) Mean() time.Duration {
+	return floatDuration(h.sample.Mean())
+}
+
+// Min returns the minimum duration in the sample at the time the snapshot
+// was taken.
+func (h *DurationHistogramSnapshot) Min() time.Duration {
+	return time.Duration(h.sample.Min())
+}
+
+// Percentile returns an arbitrary percentile of durations in the sample at
+// the time the snapshot was taken.
+func (h *DurationHistogramSnapshot) Percentile(p float64) time.Duration {
+	return floatDuration(h.sample.Percentile(p))
+}
+
+// Percentiles returns a slice of arbitrary percentiles of durations in the
+// sample at the time the snapshot was taken.
+func (h *DurationHistogramSnapshot) Percentiles(ps []float64) []time.Duration {
+	return floatDurations(h.sample.Percentiles(ps))
+}
+
+// Sample returns the Sample underlying the histogram.
+func (h *DurationHistogramSnapshot) Sample() Sample { return h.sample }
+
+// Snapshot returns the snapshot.
+func (h *DurationHistogramSnapshot) Snapshot() DurationHistogram { return h }
+
+// StdDev returns the standard deviation of the durations in the sample at
+// the time the snapshot was taken.
+func (h *DurationHistogramSnapshot) StdDev() time.Duration {
+	return floatDuration(h.sample.StdDev())
+}
+
+// String formats the count, sum, extremes, mean, standard deviation, and
+// percentiles for debugging.
+func (h *DurationHistogramSnapshot) String() string { return durationHistogramString(h) }
+
+// Sum returns the sum of every duration recorded at the time the snapshot was
+// taken.
+func (h *DurationHistogramSnapshot) Sum() time.Duration {
+	return time.Duration(sampleTotalSum(h.sample))
+}
+
+// Update panics.
+func (*DurationHistogramSnapshot) Update(time.Duration) {
+	panic("Update called on a DurationHistogramSnapshot")
+}
+
+// UpdateSince panics.
+func (*DurationHistogramSnapshot) UpdateSince(time.Time) {
+	panic("UpdateSince called on a DurationHistogramSnapshot")
+}
+
+// NilDurationHistogram is a no-op DurationHistogram.
+type NilDurationHistogram struct{}
+
+// Clear is a no-op.
+func (NilDurationHistogram) Clear() {}
+
+// Count is a no-op.
+func (NilDurationHistogram) Count() int64 { return 0 }
+
+// Max is a no-op.
+func (NilDurationHistogram) Max() time.Duration { return 0 }
+
+// Mean is a no-op.
+func (NilDurationHistogram) Mean() time.Duration { return 0 }
+
+// Min is a no-op.
+func (NilDurationHistogram) Min() time.Duration { return 0 }
+
+// Percentile is a no-op.
+func (NilDurationHistogram) Percentile(p float64) time.Duration { return 0 }
+
+// Percentiles is a no-op.
+func (NilDurationHistogram) Percentiles(ps []float64) []time.Duration {
+	return make([]time.Duration, len(ps))
+}
+
+// Sample is a no-op.
+func (NilDurationHistogram) Sample() Sample { return NilSample{} }
+
+// Snapshot is a no-op.
+func (NilDurationHistogram) Snapshot() DurationHistogram {
+	return NilDurationHistogram{}
+}
+
+// StdDev is a no-op.
+func (NilDurationHistogram) StdDev() time.Duration { return 0 }
+
+// Sum is a no-op.
+func (NilDurationHistogram) Sum() time.Duration { return 0 }
+
+// Update is a no-op.
+func (NilDurationHistogram) Update(time.Duration) {}
+
+// UpdateSince is a no-op.
+func (NilDurationHistogram) UpdateSince(time.Time) {}
+
+// StandardDurationHistogram is the standard implementation of a
+// DurationHistogram.  It's a HistogramOf[time.Duration], which records
+// durations in nanoseconds in a Sample, with the statistics its methods
+// return as float64s rounded to time.Durations.
+type StandardDurationHistogram struct {
+	HistogramOf[time.Duration]
+}
+
+// Mean returns the mean of the durations in the sample.
+func (h *StandardDurationHistogram) Mean() time.Duration {
+	return floatDuration(h.HistogramOf.Mean())
+}
+
+// Percentile returns an arbitrary percentile of the durations in the sample.
+func (h *StandardDurationHistogram) Percentile(p float64) time.Duration {
+	return floatDuration(h.HistogramOf.Percentile(p))
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the durations in
+// the sample.
+func (h *StandardDurationHistogram) Percentiles(ps []float64) []time.Duration {
+	return floatDurations(h.HistogramOf.Percentiles(ps))
+}
+
+// Snapshot returns a read-only copy of the histogram.
+func (h *StandardDurationHistogram) Snapshot() DurationHistogram {
+	return &DurationHistogramSnapshot{
+		percentiles: h.percentiles.load(),
+		sample:      h.sample.Snapshot(),
+	}
+}
+
+// StdDev returns the standard deviation of the durations in the sample.
+func (h *StandardDurationHistogram) StdDev() time.Duration {
+	return floatDuration(h.HistogramOf.StdDev())
+}
+
+// String formats the count, sum, extremes, mean, standard deviation, and
+// percentiles for debugging.
+func (h *StandardDurationHistogram) String() string { return durationHistogramString(h) }
+
+// floatDuration rounds a number of nanoseconds to the nearest time.Duration.
+func floatDuration(f float64) time.Duration {
+	return time.Duration(math.Floor(f + 0.5))
+}
+
+func floatDurations(fs []float64) []time.Duration {
+	ds := make([]time.Duration, len(fs))
+	for i, f := range fs {
+		ds[i] = floatDuration(f)
+	}
+	return ds
+}
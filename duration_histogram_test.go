@@ -0,0 +1,96 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func BenchmarkDurationHistogram(b *testing.B) {
+	h := NewDurationHistogram(NewUniformSample(100))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Update(time.Duration(i))
+	}
+}
+
+func TestGetOrRegisterDurationHistogram(t *testing.T) {
+	r := NewRegistry()
+	s := NewUniformSample(100)
+	NewRegisteredDurationHistogram("foo", r, s).Update(47 * time.Millisecond)
+	if h := GetOrRegisterDurationHistogram("foo", r, s); 1 != h.Count() {
+		t.Fatal(h)
+	}
+}
+
+func TestDurationHistogram10000(t *testing.T) {
+	h := NewDurationHistogram(NewUniformSample(100000))
+	for i := 1; i <= 10000; i++ {
+		h.Update(time.Duration(i) * time.Millisecond)
+	}
+	testDurationHistogram10000(t, h)
+}
+
+func TestDurationHistogramEmpty(t *testing.T) {
+	h := NewDurationHistogram(NewUniformSample(100))
+	if count := h.Count(); 0 != count {
+		t.Errorf("h.Count(): 0 != %v\n", count)
+	}
+	if min := h.Min(); 0 != min {
+		t.Errorf("h.Min(): 0 != %v\n", min)
+	}
+	if mean := h.Mean(); 0 != mean {
+		t.Errorf("h.Mean(): 0 != %v\n", mean)
+	}
+	if ps := h.Percentiles([]float64{0.5, 0.99}); 0 != ps[0] || 0 != ps[1] {
+		t.Errorf("h.Percentiles(): %v\n", ps)
+	}
+}
+
+func TestDurationHistogramSnapshot(t *testing.T) {
+	h := NewDurationHistogram(NewUniformSample(100000))
+	for i := 1; i <= 10000; i++ {
+		h.Update(time.Duration(i) * time.Millisecond)
+	}
+	snapshot := h.Snapshot()
+	h.Update(0)
+	testDurationHistogram10000(t, snapshot)
+}
+
+func TestDurationHistogramUpdateSince(t *testing.T) {
+	h := NewDurationHistogram(NewUniformSample(100))
+	h.UpdateSince(time.Now().Add(-time.Second))
+	if min := h.Min(); min < time.Second {
+		t.Errorf("h.Min(): %v < 1s\n", min)
+	}
+}
+
+func testDurationHistogram10000(t *testing.T, h DurationHistogram) {
+	if count := h.Count(); 10000 != count {
+		t.Errorf("h.Count(): 10000 != %v\n", count)
+	}
+	if min := h.Min(); time.Millisecond != min {
+		t.Errorf("h.Min(): 1ms != %v\n", min)
+	}
+	if max := h.Max(); 10*time.Second != max {
+		t.Errorf("h.Max(): 10s != %v\n", max)
+	}
+	if mean := h.Mean(); 5000500*time.Microsecond != mean {
+		t.Errorf("h.Mean(): 5.0005s != %v\n", mean)
+	}
+	if stdDev := h.StdDev(); 2886751332 != stdDev {
+		t.Errorf("h.StdDev(): 2.886751332s != %v\n", stdDev)
+	}
+	ps := h.Percentiles([]float64{0.5, 0.75, 0.99})
+	if 5000500*time.Microsecond != ps[0] {
+		t.Errorf("median: 5.0005s != %v\n", ps[0])
+	}
+	if 7500750*time.Microsecond != ps[1] {
+		t.Errorf("75th percentile: 7.50075s != %v\n", ps[1])
+	}
+	if 9900990*time.Microsecond != ps[2] {
+		t.Errorf("99th percentile: 9.90099s != %v\n", ps[2])
+	}
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// EventType identifies what happened to a metric or reporter.
+type EventType int
+
+const (
+	// EventRegistered is emitted when a metric is registered.
+	EventRegistered EventType = iota
+
+	// EventUnregistered is emitted when a metric is unregistered.
+	EventUnregistered
+
+	// EventExpired is emitted when a tenant's metric is unregistered
+	// because it hasn't been updated within the tenant's Expiry.  It is
+	// followed by the metric's EventUnregistered.
+	EventExpired
+
+	// EventConflicted is emitted when a metric can't be registered because
+	// another is already registered under its name.
+	EventConflicted
+
+	// EventInvalid is emitted when a value which isn't of a type a registry
+	// can hold is registered and so ignored.
+	EventInvalid
+
+	// EventReporterError is emitted when a reporter fails to flush.  The
+	// event's Name is the reporter's, such as "graphite".
+	EventReporterError
+)
+
+var eventTypeNames = [...]string{
+	EventRegistered:    "registered",
+	EventUnregistered:  "unregistered",
+	EventExpired:       "expired",
+	EventConflicted:    "conflicted",
+	EventInvalid:       "invalid",
+	EventReporterError: "reporter error",
+}
+
+func (t EventType) String() string {
+	if 0 <= t && int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// An Event describes something which happened to a metric or reporter.
+type Event struct {
+	Type   EventType
+	Name   string      // Of the metric or, for EventReporterError, reporter
+	Metric interface{} // The metric concerned, if any
+	Err    error       // The error concerned, if any
+}
+
+func (e Event) String() string {
+	if nil != e.Err {
+		return fmt.Sprintf("metrics: %v %s: %v", e.Type, e.Name, e.Err)
+	}
+	return fmt.Sprintf("metrics: %v %s", e.Type, e.Name)
+}
+
+// An EventHook is notified of the events emitted by registries and
+// reporters.  HandleEvent is called synchronously, possibly while the
+// registry which emitted the event holds a lock, so it must not use that
+// registry and should return quickly, as by handing the event to a logger.
+type EventHook interface {
+	HandleEvent(Event)
+}
+
+// The EventHookFunc type is an adapter to allow the use of ordinary
+// functions as EventHooks.
+type EventHookFunc func(Event)
+
+// HandleEvent calls f(e).
+func (f EventHookFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// LogEventHook returns an EventHook which logs every event to the given
+// logger, or the standard logger if it's nil.
+func LogEventHook(l *log.Logger) EventHook {
+	return EventHookFunc(func(e Event) {
+		if nil == l {
+			log.Println(e)
+		} else {
+			l.Println(e)
+		}
+	})
+}
+
+// eventHook holds an EventHook, since an atomic.Value must always hold
+// values of the same concrete type.
+type eventHook struct {
+	EventHook
+}
+
+var currentEventHook atomic.Value // eventHook
+
+// SetEventHook sets the hook notified of every event emitted from now on.
+// A nil hook, the default, discards them.
+func SetEventHook(h EventHook) {
+	currentEventHook.Store(eventHook{h})
+}
+
+// EmitEvent notifies the current EventHook, if any, of an event.  Reporters
+// outside this package use it to emit EventReporterError.
+func EmitEvent(e Event) {
+	if h, ok := currentEventHook.Load().(eventHook); ok && nil != h.EventHook {
+		h.HandleEvent(e)
+	}
+}
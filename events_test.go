@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordEvents sets an EventHook which records every event and returns a
+// function which unsets it and returns the events recorded.
+func recordEvents() func() []Event {
+	var events []Event
+	SetEventHook(EventHookFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	return func() []Event {
+		SetEventHook(nil)
+		return events
+	}
+}
+
+func TestEventsRegistry(t *testing.T) {
+	r := NewRegistry()
+	stop := recordEvents()
+	c := NewCounter()
+	r.Register("foo", c)
+	r.Register("foo", NewCounter())
+	r.Register("bar", "not a metric")
+	r.Unregister("foo")
+	r.Unregister("foo")
+	events := stop()
+	expected := []EventType{EventRegistered, EventConflicted, EventInvalid, EventUnregistered}
+	if len(expected) != len(events) {
+		t.Fatalf("events: %v != %v\n", expected, events)
+	}
+	for i, e := range events {
+		if expected[i] != e.Type {
+			t.Errorf("events[%d].Type: %v != %v\n", i, expected[i], e.Type)
+		}
+	}
+	if "foo" != events[0].Name || c != events[0].Metric {
+		t.Errorf("events[0]: %v\n", events[0])
+	}
+	if _, ok := events[1].Err.(DuplicateMetric); !ok {
+		t.Errorf("events[1].Err: DuplicateMetric != %v\n", events[1].Err)
+	}
+}
+
+func TestEventsRegisterAll(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewCounter())
+	stop := recordEvents()
+	r.RegisterAll(map[string]interface{}{"bar": NewCounter(), "foo": NewCounter()})
+	r.RegisterAll(map[string]interface{}{"bar": NewCounter(), "baz": NewGauge()})
+	events := stop()
+	if 3 != len(events) {
+		t.Fatalf("events: 3 != %v\n", events)
+	}
+	if EventConflicted != events[0].Type || "foo" != events[0].Name {
+		t.Errorf("events[0]: %v\n", events[0])
+	}
+	if EventRegistered != events[1].Type || "bar" != events[1].Name {
+		t.Errorf("events[1]: %v\n", events[1])
+	}
+	if EventRegistered != events[2].Type || "baz" != events[2].Name {
+		t.Errorf("events[2]: %v\n", events[2])
+	}
+}
+
+func TestEventsTenantExpiry(t *testing.T) {
+	r := NewRegistry()
+	tenant := r.Tenant("acme")
+	tenant.SetQuota(TenantQuota{Expiry: time.Hour})
+	GetOrRegisterCounter("foo", tenant)
+	tenant.entries["foo"].updated.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+	stop := recordEvents()
+	tenant.Expire()
+	events := stop()
+	if 2 != len(events) {
+		t.Fatalf("events: 2 != %v\n", events)
+	}
+	if EventExpired != events[0].Type || "foo;tenant=acme" != events[0].Name {
+		t.Errorf("events[0]: %v\n", events[0])
+	}
+	if EventUnregistered != events[1].Type || "foo;tenant=acme" != events[1].Name {
+		t.Errorf("events[1]: %v\n", events[1])
+	}
+}
+
+func TestLogEventHook(t *testing.T) {
+	var buf bytes.Buffer
+	LogEventHook(log.New(&buf, "", 0)).HandleEvent(Event{
+		Type: EventReporterError,
+		Name: "graphite",
+		Err:  errors.New("connection refused"),
+	})
+	if s := strings.TrimSpace(buf.String()); "metrics: reporter error graphite: connection refused" != s {
+		t.Errorf("LogEventHook(): %q\n", s)
+	}
+}
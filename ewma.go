@@ -1,46 +1,100 @@
 package metrics
 
 import (
+	"fmt"
 	"math"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
 )
 
 // EWMAs continuously calculate an exponentially-weighted moving average
 // based on an outside source of clock ticks.
-type EWMA interface {
-	Rate() float64
-	Snapshot() EWMA
-	Tick()
-	Update(int64)
-}
+type EWMA = metricsiface.EWMA
 
-// NewEWMA constructs a new EWMA with the given alpha.
+// NewEWMA constructs a new EWMA with the given alpha, which assumes that it's
+// ticked every TickInterval.
 func NewEWMA(alpha float64) EWMA {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
+		return NilEWMA{}
+	}
+	return &StandardEWMA{alpha: alpha, ticked: time.Now()}
+}
+
+// NewBurstLimitedEWMA constructs a new EWMA with the given alpha which
+// accounts for at most b.Limit events on each tick.
+func NewBurstLimitedEWMA(alpha float64, b BurstPolicy) EWMA {
+	if metricsDisabled || UseNilMetrics {
 		return NilEWMA{}
 	}
-	return &StandardEWMA{alpha: alpha}
+	return &StandardEWMA{alpha: alpha, burst: b, ticked: time.Now()}
 }
 
 // NewEWMA1 constructs a new EWMA for a one-minute moving average.
 func NewEWMA1() EWMA {
-	return NewEWMA(1 - math.Exp(-5.0/60.0/1))
+	return newWindowedEWMA(time.Minute, BurstPolicy{})
 }
 
 // NewEWMA5 constructs a new EWMA for a five-minute moving average.
 func NewEWMA5() EWMA {
-	return NewEWMA(1 - math.Exp(-5.0/60.0/5))
+	return newWindowedEWMA(5*time.Minute, BurstPolicy{})
 }
 
 // NewEWMA15 constructs a new EWMA for a fifteen-minute moving average.
 func NewEWMA15() EWMA {
-	return NewEWMA(1 - math.Exp(-5.0/60.0/15))
+	return newWindowedEWMA(15*time.Minute, BurstPolicy{})
+}
+
+// newWindowedEWMA constructs a new EWMA for a moving average over the given
+// window whose alpha is derived from TickInterval on every tick, so that it
+// stays correct if SetTickInterval changes the interval.
+func newWindowedEWMA(window time.Duration, b BurstPolicy) EWMA {
+	if metricsDisabled || UseNilMetrics {
+		return NilEWMA{}
+	}
+	return &StandardEWMA{burst: b, window: window, ticked: time.Now()}
+}
+
+// ewmaAlpha returns the alpha for a moving average over the given window
+// which is ticked every interval.
+func ewmaAlpha(window, interval time.Duration) float64 {
+	return 1 - math.Exp(-interval.Seconds()/window.Seconds())
+}
+
+// ewmaWindow returns the window of a moving average with the given alpha
+// which is ticked every interval, the inverse of ewmaAlpha, or zero unless
+// the alpha is strictly between zero and one.
+func ewmaWindow(alpha float64, interval time.Duration) time.Duration {
+	if alpha <= 0 || 1 <= alpha {
+		return 0
+	}
+	return time.Duration(-float64(interval) / math.Log(1-alpha))
+}
+
+// BurstPolicy bounds the number of events a single tick of an EWMA accounts
+// for.  Without a limit, one enormous Update produces a rate spike which
+// takes a very long time to decay.
+type BurstPolicy struct {
+	// Limit is the maximum number of events counted per tick.  Zero or a
+	// negative number means there is no limit.
+	Limit int64
+
+	// Spread carries events in excess of Limit over to following ticks
+	// rather than discarding them, so that the burst is accounted for in
+	// full at no more than Limit events per tick.
+	Spread bool
 }
 
 // EWMASnapshot is a read-only copy of another EWMA.
 type EWMASnapshot float64
 
+// GoString formats the snapshot for %#v.
+func (a EWMASnapshot) GoString() string {
+	return fmt.Sprintf("metrics.EWMASnapshot(%v)", float64(a))
+}
+
 // Rate returns the rate of events per second at the time the snapshot was
 // taken.
 func (a EWMASnapshot) Rate() float64 { return float64(a) }
@@ -48,6 +102,9 @@ func (a EWMASnapshot) Rate() float64 { return float64(a) }
 // Snapshot returns the snapshot.
 func (a EWMASnapshot) Snapshot() EWMA { return a }
 
+// String formats the rate for debugging.
+func (a EWMASnapshot) String() string { return ewmaString(a) }
+
 // Tick panics.
 func (EWMASnapshot) Tick() {
 	panic("Tick called on an EWMASnapshot")
@@ -77,11 +134,42 @@ func (NilEWMA) Update(n int64) {}
 // of uncounted events and processes them on each tick.  It uses the
 // sync/atomic package to manage uncounted events.
 type StandardEWMA struct {
-	uncounted int64 // /!\ this should be the first member to ensure 64-bit alignment
+	uncounted atomic.Int64
+	fraction  atomicNumber[float64] // the fractional parts of UpdateFloat's events
 	alpha     float64
 	rate      float64
 	init      bool
 	mutex     sync.Mutex
+	burst     BurstPolicy
+	carry     int64         // events held back for later ticks by burst.Spread
+	window    time.Duration // if not zero, alpha is derived from it on every tick
+	ticked    time.Time     // when the EWMA was last ticked or constructed
+}
+
+// Alpha returns the EWMA's alpha, which for the EWMAs of NewEWMA1, NewEWMA5,
+// and NewEWMA15 is derived from their windows and TickInterval.
+func (a *StandardEWMA) Alpha() float64 {
+	return a.alphaFor(TickInterval())
+}
+
+// alphaFor returns the EWMA's alpha when it's ticked every interval.
+func (a *StandardEWMA) alphaFor(interval time.Duration) float64 {
+	if 0 != a.window {
+		return ewmaAlpha(a.window, interval)
+	}
+	return a.alpha
+}
+
+// Window returns the window the EWMA averages over, one, five, or fifteen
+// minutes for the EWMAs of NewEWMA1, NewEWMA5, and NewEWMA15 and otherwise
+// derived from its alpha and TickInterval, so that exporters may label rates
+// with their actual window.  It's zero for an alpha of one or more, which
+// doesn't average at all.
+func (a *StandardEWMA) Window() time.Duration {
+	if 0 != a.window {
+		return a.window
+	}
+	return ewmaWindow(a.alpha, TickInterval())
 }
 
 // Rate returns the moving average rate of events per second.
@@ -96,23 +184,195 @@ func (a *StandardEWMA) Snapshot() EWMA {
 	return EWMASnapshot(a.Rate())
 }
 
+// SnapshotPending returns a read-only copy of the EWMA whose rate folds in
+// the events updated since its last tick, as though it were ticked now with
+// its alpha pro-rated by the fraction of TickInterval elapsed since then, so
+// that a low-rate EWMA reads a fresh rate between ticks.  The EWMA itself is
+// unchanged and its next tick accounts for the events as usual.
+func (a *StandardEWMA) SnapshotPending() EWMA {
+	return EWMASnapshot(a.ratePending(float64(a.uncounted.Load())+a.fraction.load(), time.Now()))
+}
+
+// String formats the rate for debugging.
+func (a *StandardEWMA) String() string { return ewmaString(a) }
+
 // Tick ticks the clock to update the moving average.  It assumes it is called
-// every five seconds.
+// every TickInterval.
 func (a *StandardEWMA) Tick() {
-	count := atomic.LoadInt64(&a.uncounted)
-	atomic.AddInt64(&a.uncounted, -count)
-	instantRate := float64(count) / float64(5e9)
+	count := a.uncounted.Load()
+	a.uncounted.Add(-count)
+	fraction := a.fraction.swap(0)
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
+	a.tick(count, fraction)
+	a.ticked = time.Now()
+}
+
+// catchUp ticks the clock n times at once, as though the uncounted events
+// had arrived evenly over the n intervals since the last tick.  It is used
+// when ticks have been delayed so that a backlog of events is not attributed
+// to a single interval.
+func (a *StandardEWMA) catchUp(n int) {
+	count := a.uncounted.Load()
+	a.uncounted.Add(-count)
+	fraction := a.fraction.swap(0)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	share, remainder := count/int64(n), count%int64(n)
+	for i := 0; i < n; i++ {
+		c := share
+		if int64(i) < remainder {
+			c++
+		}
+		a.tick(c, fraction/float64(n))
+	}
+	a.ticked = time.Now()
+}
+
+// ratePending returns the rate of events per second as though the EWMA were
+// ticked at the given time with the given events pending, at most its burst
+// limit, and its alpha pro-rated by the fraction of TickInterval elapsed
+// since its last tick.
+func (a *StandardEWMA) ratePending(pending float64, now time.Time) float64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	elapsed := now.Sub(a.ticked)
+	if elapsed <= 0 {
+		return a.rate * float64(1e9)
+	}
+	if 0 < a.burst.Limit && float64(a.burst.Limit) < pending {
+		pending = float64(a.burst.Limit)
+	}
+	instantRate := pending / float64(elapsed)
+	if !a.init {
+		return instantRate * float64(1e9)
+	}
+	interval := TickInterval()
+	alpha := a.alphaFor(interval)
+	if alpha < 1 {
+		alpha = 1 - math.Pow(1-alpha, float64(elapsed)/float64(interval))
+	}
+	return (a.rate + alpha*(instantRate-a.rate)) * float64(1e9)
+}
+
+// tick folds count events and a fraction of an event, or more, into the
+// moving average.  It must be called with a.mutex held.
+func (a *StandardEWMA) tick(count int64, fraction float64) {
+	interval := TickInterval()
+	instantRate := (float64(a.limit(count)) + fraction) / float64(interval)
+	alpha := a.alphaFor(interval)
 	if a.init {
-		a.rate += a.alpha * (instantRate - a.rate)
+		a.rate += alpha * (instantRate - a.rate)
 	} else {
 		a.init = true
 		a.rate = instantRate
 	}
 }
 
-// Update adds n uncounted events.
+// Update adds n uncounted events.  When the EWMA has a burst limit the
+// uncounted events saturate rather than overflow.
 func (a *StandardEWMA) Update(n int64) {
-	atomic.AddInt64(&a.uncounted, n)
+	if a.burst.Limit <= 0 {
+		a.uncounted.Add(n)
+		return
+	}
+	for {
+		old := a.uncounted.Load()
+		if a.uncounted.CompareAndSwap(old, saturatingAdd(old, n)) {
+			return
+		}
+	}
+}
+
+// UpdateFloat adds v uncounted events, which may be fractional, such as an
+// amount of money, so that the moving average is of the amounts rather than
+// of whole events.  The whole part of v is added as by Update, and so is
+// subject to the burst limit, and the fractional part is added atomically
+// with a compare-and-swap loop.
+func (a *StandardEWMA) UpdateFloat(v float64) {
+	whole := math.Trunc(v)
+	if 0 != whole {
+		a.Update(int64(whole))
+	}
+	if fraction := v - whole; 0 != fraction {
+		a.fraction.add(fraction)
+	}
+}
+
+// UpdateAt adds n events which happened at the given time.  Events since the
+// last tick are uncounted, as they are by Update, but events before it are
+// added to the moving average as though they'd been counted by the tick
+// which followed them and decayed by every tick since, for pipelines which
+// process batches of events a little late, so that the rate is as it would
+// have been had they been on time.  Late events aren't subject to the burst
+// limit, and events late by maxCatchUpTicks intervals or more, whose share of
+// the rate would be negligible, are dropped.
+func (a *StandardEWMA) UpdateAt(n int64, t time.Time) {
+	if a.isLate(t) {
+		a.updateLate(n, t)
+		return
+	}
+	a.Update(n)
+}
+
+// isLate returns whether events at the given time would be late, having
+// happened before the EWMA's last tick.
+func (a *StandardEWMA) isLate(t time.Time) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.init && t.Before(a.ticked)
+}
+
+// updateLate adds n events at the given time, before the EWMA's last tick,
+// to its moving average as UpdateAt does.
+func (a *StandardEWMA) updateLate(n int64, t time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	interval := TickInterval()
+	late := a.ticked.Sub(t) / interval
+	if late < 0 || maxCatchUpTicks <= late {
+		return
+	}
+	alpha := a.alphaFor(interval)
+	a.rate += alpha * float64(n) / float64(interval) * math.Pow(1-alpha, float64(late))
+}
+
+// updateFloat adds v events to an EWMA, fractions and all if it's a
+// StandardEWMA and rounded to whole events otherwise.
+func updateFloat(a EWMA, v float64) {
+	if a, ok := a.(*StandardEWMA); ok {
+		a.UpdateFloat(v)
+		return
+	}
+	a.Update(int64(math.Round(v)))
+}
+
+// limit applies the burst policy to the count of events for one tick.  It
+// must be called with a.mutex held.
+func (a *StandardEWMA) limit(count int64) int64 {
+	if a.burst.Limit <= 0 {
+		return count
+	}
+	if a.burst.Spread {
+		count, a.carry = saturatingAdd(a.carry, count), 0
+		if count > a.burst.Limit {
+			a.carry = count - a.burst.Limit
+		}
+	}
+	if count > a.burst.Limit {
+		count = a.burst.Limit
+	}
+	return count
+}
+
+// saturatingAdd returns a + b, clamped to the range of an int64.
+func saturatingAdd(a, b int64) int64 {
+	sum := a + b
+	if a > 0 && b > 0 && sum < 0 {
+		return math.MaxInt64
+	}
+	if a < 0 && b < 0 && sum >= 0 {
+		return math.MinInt64
+	}
+	return sum
 }
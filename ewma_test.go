@@ -1,6 +1,16 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+	"testing/quick"
+	"time"
+)
 
 func BenchmarkEWMA(b *testing.B) {
 	a := NewEWMA1()
@@ -223,3 +233,291 @@ func elapseMinute(a EWMA) {
 		a.Tick()
 	}
 }
+
+func TestEWMABurstLimitClamp(t *testing.T) {
+	a := NewBurstLimitedEWMA(ewmaAlpha(time.Minute, DefaultTickInterval), BurstPolicy{Limit: 10})
+	a.Update(25)
+	a.Tick()
+	if rate := a.Rate(); 2.0 != rate {
+		t.Errorf("initial a.Rate(): 2.0 != %v\n", rate)
+	}
+	a.Tick()
+	if rate := a.Rate(); 2.0 <= rate {
+		t.Errorf("a.Rate(): 2.0 <= %v\n", rate)
+	}
+}
+
+func TestEWMABurstLimitSpread(t *testing.T) {
+	a := NewBurstLimitedEWMA(1.0, BurstPolicy{Limit: 10, Spread: true})
+	a.Update(25)
+	for i, expected := range []float64{2.0, 2.0, 1.0, 0.0} {
+		a.Tick()
+		if rate := a.Rate(); expected != rate {
+			t.Errorf("tick %d a.Rate(): %v != %v\n", i, expected, rate)
+		}
+	}
+}
+
+func TestEWMABurstLimitSaturates(t *testing.T) {
+	a := NewBurstLimitedEWMA(1.0, BurstPolicy{Limit: math.MaxInt64, Spread: true})
+	a.Update(math.MaxInt64)
+	a.Update(math.MaxInt64)
+	a.Tick()
+	if rate := a.Rate(); rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		t.Errorf("a.Rate(): %v\n", rate)
+	}
+	a.Tick()
+	if rate := a.Rate(); 0.0 != rate {
+		t.Errorf("a.Rate(): 0.0 != %v\n", rate)
+	}
+}
+
+func TestEWMAExtremes(t *testing.T) {
+	a := NewEWMA1()
+	a.Update(math.MaxInt64)
+	a.Tick()
+	if rate := a.Rate(); float64(math.MaxInt64)/5 != rate {
+		t.Errorf("a.Rate(): %v != %v\n", float64(math.MaxInt64)/5, rate)
+	}
+}
+
+func TestEWMACatchUp(t *testing.T) {
+	a, b := NewEWMA1(), NewEWMA1()
+	a.Update(10)
+	a.(*StandardEWMA).catchUp(3)
+	for _, n := range []int64{4, 3, 3} {
+		b.Update(n)
+		b.Tick()
+	}
+	if a.Rate() != b.Rate() {
+		t.Errorf("a.Rate(): %v != %v\n", a.Rate(), b.Rate())
+	}
+}
+
+func TestEWMAWindow(t *testing.T) {
+	if w := NewEWMA5().(*StandardEWMA).Window(); 5*time.Minute != w {
+		t.Errorf("NewEWMA5().Window(): %v != %v\n", 5*time.Minute, w)
+	}
+	a := NewEWMA(ewmaAlpha(10*time.Minute, TickInterval())).(*StandardEWMA)
+	if w := a.Window(); 1e-6 < math.Abs(w.Minutes()-10) {
+		t.Errorf("a.Window(): %v != %v\n", 10*time.Minute, w)
+	}
+	if alpha := NewEWMA1().(*StandardEWMA).Alpha(); ewmaAlpha(time.Minute, TickInterval()) != alpha {
+		t.Errorf("NewEWMA1().Alpha(): %v != %v\n", ewmaAlpha(time.Minute, TickInterval()), alpha)
+	}
+	if w := NewEWMA(1).(*StandardEWMA).Window(); 0 != w {
+		t.Errorf("NewEWMA(1).Window(): 0 != %v\n", w)
+	}
+}
+
+func TestEWMASnapshotPending(t *testing.T) {
+	a := NewEWMA1().(*StandardEWMA)
+	a.Update(60)
+	a.ticked = time.Now().Add(-TickInterval())
+	if rate := a.SnapshotPending().Rate(); 1e-3 < math.Abs(12.0-rate) {
+		t.Errorf("a.SnapshotPending().Rate(): 12.0 != %v\n", rate)
+	}
+	if rate := a.Rate(); 0.0 != rate {
+		t.Errorf("a.Rate(): 0.0 != %v\n", rate)
+	}
+	b, c := NewEWMA1().(*StandardEWMA), NewEWMA1()
+	b.Tick()
+	c.Tick()
+	b.Update(60)
+	c.Update(60)
+	c.Tick()
+	b.ticked = time.Now().Add(-TickInterval())
+	if rate := b.SnapshotPending().Rate(); 1e-3 < math.Abs(c.Rate()-rate) {
+		t.Errorf("b.SnapshotPending().Rate(): %v != %v\n", c.Rate(), rate)
+	}
+	b.ticked = time.Now().Add(-TickInterval() / 2)
+	if rate := b.SnapshotPending().Rate(); rate <= c.Rate() {
+		t.Errorf("b.SnapshotPending().Rate() half way to a tick: %v <= %v\n", rate, c.Rate())
+	}
+}
+
+func TestEWMAUpdateFloat(t *testing.T) {
+	a := NewEWMA(1.0).(*StandardEWMA)
+	a.UpdateFloat(2.5)
+	a.UpdateFloat(0.25)
+	a.Tick()
+	if rate := a.Rate(); 1e-9 < math.Abs(2.75/5-rate) {
+		t.Errorf("a.Rate(): %v != %v\n", 2.75/5, rate)
+	}
+	a.Tick()
+	if rate := a.Rate(); 0.0 != rate {
+		t.Errorf("a.Rate(): 0.0 != %v\n", rate)
+	}
+}
+
+func TestEWMATickInterval(t *testing.T) {
+	SetTickInterval(time.Second)
+	defer SetTickInterval(0)
+	if d := TickInterval(); time.Second != d {
+		t.Errorf("TickInterval(): %v != %v\n", time.Second, d)
+	}
+	a := NewEWMA1()
+	a.Update(3)
+	a.Tick()
+	if rate := a.Rate(); 3 != rate {
+		t.Errorf("initial a.Rate(): 3 != %v\n", rate)
+	}
+	for i := 0; i < 60; i++ {
+		a.Tick()
+	}
+	if rate := a.Rate(); math.Abs(3*math.Exp(-1)-rate) > 1e-9 {
+		t.Errorf("1 minute a.Rate(): %v != %v\n", 3*math.Exp(-1), rate)
+	}
+}
+
+// TestEWMAReference checks that EWMAs fed arbitrary sequences of events and
+// ticks, including delayed ticks caught up on at once, at arbitrary tick
+// intervals track a high-precision model of the decay, so that optimizations
+// of the arithmetic don't drift from it.
+func TestEWMAReference(t *testing.T) {
+	defer SetTickInterval(0)
+	f := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		interval := ewmaReferenceInterval(r)
+		SetTickInterval(interval)
+		alpha := 1 - r.Float64()
+		as := []EWMA{NewEWMA(alpha), NewEWMA1(), NewEWMA5(), NewEWMA15()}
+		refs := []*ewmaReference{
+			newEWMAReference(alpha),
+			newEWMAReference(ewmaAlpha(time.Minute, interval)),
+			newEWMAReference(ewmaAlpha(5*time.Minute, interval)),
+			newEWMAReference(ewmaAlpha(15*time.Minute, interval)),
+		}
+		for step := 0; step < 200; step++ {
+			count, n := ewmaReferenceStep(r)
+			for i, a := range as {
+				a.Update(count)
+				if 1 == n {
+					a.Tick()
+				} else {
+					a.(*StandardEWMA).catchUp(n)
+				}
+				refs[i].catchUp(count, n, interval)
+				if !refs[i].near(a.Rate()) {
+					t.Logf("seed %d, step %d, EWMA %d: %v != %v\n", seed, step, i, refs[i].rate(), a.Rate())
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 50}); nil != err {
+		t.Error(err)
+	}
+}
+
+// TestMeterEWMAReference checks a meter's three moving averages against the
+// same model as TestEWMAReference.
+func TestMeterEWMAReference(t *testing.T) {
+	defer SetTickInterval(0)
+	f := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		interval := ewmaReferenceInterval(r)
+		SetTickInterval(interval)
+		m := newStandardMeter()
+		refs := []*ewmaReference{
+			newEWMAReference(ewmaAlpha(time.Minute, interval)),
+			newEWMAReference(ewmaAlpha(5*time.Minute, interval)),
+			newEWMAReference(ewmaAlpha(15*time.Minute, interval)),
+		}
+		for step := 0; step < 200; step++ {
+			count, n := ewmaReferenceStep(r)
+			m.Mark(count)
+			if 1 == n {
+				m.Tick()
+			} else {
+				m.catchUp(n)
+			}
+			for i, rate := range []float64{m.Rate1(), m.Rate5(), m.Rate15()} {
+				refs[i].catchUp(count, n, interval)
+				if !refs[i].near(rate) {
+					t.Logf("seed %d, step %d, rate %d: %v != %v\n", seed, step, i, refs[i].rate(), rate)
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 50}); nil != err {
+		t.Error(err)
+	}
+}
+
+// ewmaReference models an EWMA in 256-bit floating point: it takes alpha
+// from the implementation, since that's a definition rather than arithmetic
+// to check, and accumulates the rate, in events per second, exactly enough
+// that its own rounding is negligible.
+type ewmaReference struct {
+	alpha *big.Float
+	init  bool
+	value *big.Float
+}
+
+func newEWMAReference(alpha float64) *ewmaReference {
+	return &ewmaReference{alpha: ewmaFloat(alpha), value: ewmaFloat(0)}
+}
+
+// catchUp folds count events arriving evenly over n ticks into the rate.
+func (r *ewmaReference) catchUp(count int64, n int, interval time.Duration) {
+	share, remainder := count/int64(n), count%int64(n)
+	for i := 0; i < n; i++ {
+		c := share
+		if int64(i) < remainder {
+			c++
+		}
+		instant := ewmaFloat(0).Quo(ewmaFloat(float64(c)), ewmaFloat(interval.Seconds()))
+		if !r.init {
+			r.init = true
+			r.value = instant
+			continue
+		}
+		d := ewmaFloat(0).Sub(instant, r.value)
+		r.value.Add(r.value, d.Mul(d, r.alpha))
+	}
+}
+
+// near reports whether the given rate is within a relative 1e-9 of the
+// model's.
+func (r *ewmaReference) near(rate float64) bool {
+	want := r.rate()
+	return math.Abs(rate-want) <= 1e-9*math.Max(math.Abs(want), 1e-9)
+}
+
+func (r *ewmaReference) rate() float64 {
+	f, _ := r.value.Float64()
+	return f
+}
+
+func ewmaFloat(f float64) *big.Float {
+	return new(big.Float).SetPrec(256).SetFloat64(f)
+}
+
+// ewmaReferenceInterval returns a tick interval between a millisecond and a
+// minute.
+func ewmaReferenceInterval(r *rand.Rand) time.Duration {
+	return time.Millisecond + time.Duration(r.Int63n(int64(time.Minute)))
+}
+
+// ewmaReferenceStep returns a number of events, usually few and sometimes
+// none or a burst, and a number of ticks over which they arrive, usually
+// one.
+func ewmaReferenceStep(r *rand.Rand) (int64, int) {
+	var count int64
+	switch r.Intn(4) {
+	case 0:
+	case 1:
+		count = r.Int63n(1000000000)
+	default:
+		count = r.Int63n(100)
+	}
+	n := 1
+	if 0 == r.Intn(5) {
+		n += r.Intn(10)
+	}
+	return count, n
+}
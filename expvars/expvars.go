@@ -0,0 +1,57 @@
+// Package expvars mirrors the variables published by the expvar package in
+// a Registry.  It's kept out of the metrics package because importing
+// expvar registers a handler for /debug/vars on http.DefaultServeMux.
+package expvars
+
+import (
+	"encoding/json"
+	"expvar"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Capture new values of the variables published by the expvar package
+// periodically.  This is designed to be called as a goroutine.
+func Capture(r metrics.Registry, prefix string, d time.Duration) {
+	for _ = range time.Tick(d) {
+		CaptureOnce(r, prefix)
+	}
+}
+
+// Capture new values of the variables published by the expvar package, so
+// that legacy expvar instrumentation is exported by the same reporters as
+// everything else.  Each variable is mirrored by a metric named by its name
+// with the given prefix, registering it if need be.  An expvar.Int becomes
+// a Counter, an expvar.Float a GaugeFloat64, and each member of an
+// expvar.Map, recursively, a metric named by the map's name, a dot, and its
+// key.  Any other variable whose value is a JSON number, such as an
+// expvar.Func returning one, becomes a GaugeFloat64; the rest, such as the
+// standard "cmdline" and "memstats", are skipped.
+func CaptureOnce(r metrics.Registry, prefix string) {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	expvar.Do(func(kv expvar.KeyValue) {
+		capture(r, prefix+kv.Key, kv.Value)
+	})
+}
+
+func capture(r metrics.Registry, name string, v expvar.Var) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		c := metrics.GetOrRegisterCounter(name, r)
+		c.Inc(v.Value() - c.Count())
+	case *expvar.Float:
+		metrics.GetOrRegisterGaugeFloat64(name, r).Update(v.Value())
+	case *expvar.Map:
+		v.Do(func(kv expvar.KeyValue) {
+			capture(r, name+"."+kv.Key, kv.Value)
+		})
+	default:
+		var f float64
+		if nil == json.Unmarshal([]byte(v.String()), &f) {
+			metrics.GetOrRegisterGaugeFloat64(name, r).Update(f)
+		}
+	}
+}
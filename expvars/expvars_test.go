@@ -0,0 +1,37 @@
+package expvars
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestCaptureOnce(t *testing.T) {
+	i := expvar.NewInt("TestCaptureOnce.int")
+	f := expvar.NewFloat("TestCaptureOnce.float")
+	m := expvar.NewMap("TestCaptureOnce.map")
+	expvar.Publish("TestCaptureOnce.func", expvar.Func(func() interface{} { return 2.5 }))
+	i.Set(47)
+	f.Set(0.5)
+	m.Add("requests", 3)
+	r := metrics.NewRegistry()
+	CaptureOnce(r, "expvar.")
+	i.Add(-7)
+	CaptureOnce(r, "expvar.")
+	if c, ok := r.Get("expvar.TestCaptureOnce.int").(metrics.Counter); !ok || 40 != c.Count() {
+		t.Errorf("expvar.TestCaptureOnce.int: %v\n", r.Get("expvar.TestCaptureOnce.int"))
+	}
+	if g, ok := r.Get("expvar.TestCaptureOnce.float").(metrics.GaugeFloat64); !ok || 0.5 != g.Value() {
+		t.Errorf("expvar.TestCaptureOnce.float: %v\n", r.Get("expvar.TestCaptureOnce.float"))
+	}
+	if c, ok := r.Get("expvar.TestCaptureOnce.map.requests").(metrics.Counter); !ok || 3 != c.Count() {
+		t.Errorf("expvar.TestCaptureOnce.map.requests: %v\n", r.Get("expvar.TestCaptureOnce.map.requests"))
+	}
+	if g, ok := r.Get("expvar.TestCaptureOnce.func").(metrics.GaugeFloat64); !ok || 2.5 != g.Value() {
+		t.Errorf("expvar.TestCaptureOnce.func: %v\n", r.Get("expvar.TestCaptureOnce.func"))
+	}
+	if nil != r.Get("expvar.cmdline") {
+		t.Errorf("expvar.cmdline: %v\n", r.Get("expvar.cmdline"))
+	}
+}
@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MetricField returns the value of the named field of a metric and whether
+// the metric has such a field, so that exporters and queries can select one
+// number from a metric by name.  The fields are
+//
+//	count                   Counter, CounterFloat64, Histogram, Meter, ...
+//	value                   Gauge, GaugeFloat64
+//	min, max, mean, stddev  Histogram, DurationHistogram, Timer
+//	sum                     Histogram, DurationHistogram, Summary, Timer
+//	rate1, rate5, rate15    Meter, Timer
+//	rateMean                Meter, Timer
+//	p50, p99, p999, ...     Histogram, DurationHistogram, Summary, Timer
+//
+// where the digits of a percentile field follow a decimal point, so p9 and
+// p90 both name the 90th percentile and p999 the 99.9th.  Durations are in
+// nanoseconds.  A StagedTimer's fields are those of its total.
+func MetricField(i interface{}, field string) (float64, bool) {
+	if p, ok := percentileField(field); ok {
+		switch metric := i.(type) {
+		case DurationHistogram:
+			return float64(metric.Snapshot().Percentile(p)), true
+		case Histogram:
+			return metric.Snapshot().Percentile(p), true
+		case StagedTimer:
+			return float64(metric.Total().Snapshot().Percentile(p)), true
+		case Summary:
+			return metric.Snapshot().Quantile(p), true
+		case Timer:
+			return metric.Snapshot().Percentile(p), true
+		}
+		return 0, false
+	}
+	switch metric := i.(type) {
+	case Counter:
+		if "count" == field {
+			return float64(metric.Count()), true
+		}
+	case CounterFloat64:
+		if "count" == field {
+			return metric.Count(), true
+		}
+	case Gauge:
+		if "value" == field {
+			return float64(metric.Value()), true
+		}
+	case GaugeFloat64:
+		if "value" == field {
+			return metric.Value(), true
+		}
+	case DurationHistogram:
+		return durationHistogramField(metric.Snapshot(), field)
+	case Histogram:
+		h := metric.Snapshot()
+		switch field {
+		case "count":
+			return float64(h.Count()), true
+		case "min":
+			return float64(h.Min()), true
+		case "max":
+			return float64(h.Max()), true
+		case "mean":
+			return h.Mean(), true
+		case "stddev":
+			return h.StdDev(), true
+		case "sum":
+			return float64(h.Sum()), true
+		}
+	case Histogram2D:
+		if "count" == field {
+			return float64(metric.Count()), true
+		}
+	case Meter:
+		m := metric.Snapshot()
+		switch field {
+		case "count":
+			return float64(m.Count()), true
+		case "rate1":
+			return m.Rate1(), true
+		case "rate5":
+			return m.Rate5(), true
+		case "rate15":
+			return m.Rate15(), true
+		case "rateMean":
+			return m.RateMean(), true
+		}
+	case StagedTimer:
+		return durationHistogramField(metric.Total().Snapshot(), field)
+	case Summary:
+		s := metric.Snapshot()
+		switch field {
+		case "count":
+			return float64(s.Count()), true
+		case "sum":
+			return s.Sum(), true
+		}
+	case Timer:
+		t := metric.Snapshot()
+		switch field {
+		case "count":
+			return float64(t.Count()), true
+		case "min":
+			return float64(t.Min()), true
+		case "max":
+			return float64(t.Max()), true
+		case "mean":
+			return t.Mean(), true
+		case "stddev":
+			return t.StdDev(), true
+		case "sum":
+			return float64(t.Sum()), true
+		case "rate1":
+			return t.Rate1(), true
+		case "rate5":
+			return t.Rate5(), true
+		case "rate15":
+			return t.Rate15(), true
+		case "rateMean":
+			return t.RateMean(), true
+		}
+	}
+	return 0, false
+}
+
+func durationHistogramField(h DurationHistogram, field string) (float64, bool) {
+	switch field {
+	case "count":
+		return float64(h.Count()), true
+	case "min":
+		return float64(h.Min()), true
+	case "max":
+		return float64(h.Max()), true
+	case "mean":
+		return float64(h.Mean()), true
+	case "stddev":
+		return float64(h.StdDev()), true
+	case "sum":
+		return float64(h.Sum()), true
+	}
+	return 0, false
+}
+
+// percentileField returns the percentile named by a field such as p99 and
+// whether the field names one.
+func percentileField(field string) (float64, bool) {
+	if len(field) < 2 || 'p' != field[0] || strings.IndexFunc(field[1:], func(r rune) bool {
+		return r < '0' || '9' < r
+	}) >= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat("0."+field[1:], 64)
+	return p, nil == err
+}
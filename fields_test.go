@@ -0,0 +1,36 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestMetricField(t *testing.T) {
+	c := NewCounter()
+	c.Inc(47)
+	if v, ok := MetricField(c, "count"); !ok || 47 != v {
+		t.Errorf("MetricField(c, \"count\"): 47 != %v, %v\n", v, ok)
+	}
+	if v, ok := MetricField(c, "value"); ok {
+		t.Errorf("MetricField(c, \"value\"): %v, %v\n", v, ok)
+	}
+	h := NewHistogram(NewUniformSample(1000))
+	for i := int64(1); i <= 1000; i++ {
+		h.Update(i)
+	}
+	if v, ok := MetricField(h, "p99"); !ok || 990.99 != v {
+		t.Errorf("MetricField(h, \"p99\"): 990.99 != %v, %v\n", v, ok)
+	}
+	if v, ok := MetricField(h, "p9"); !ok || 900.9 != v {
+		t.Errorf("MetricField(h, \"p9\"): 900.9 != %v, %v\n", v, ok)
+	}
+	if v, ok := MetricField(h, "max"); !ok || 1000 != v {
+		t.Errorf("MetricField(h, \"max\"): 1000 != %v, %v\n", v, ok)
+	}
+	if v, ok := MetricField(h, "p"); ok {
+		t.Errorf("MetricField(h, \"p\"): %v, %v\n", v, ok)
+	}
+	if v, ok := MetricField(h, "p9x"); ok {
+		t.Errorf("MetricField(h, \"p9x\"): %v, %v\n", v, ok)
+	}
+}
@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"hash/crc32"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// FlushTimeouts returns the "metrics.FlushTimeouts" counter in the given
+// registry, which reporters increment each time a flush is abandoned because
+// its deadline passed.
+func FlushTimeouts(r Registry) Counter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return GetOrRegisterCounter("metrics.FlushTimeouts", r)
+}
+
+// IsFlushTimeout reports whether a flush failed with the given error because
+// the deadline of the given context passed or a network write timed out.
+func IsFlushTimeout(ctx context.Context, err error) bool {
+	if nil == err {
+		return false
+	}
+	if context.DeadlineExceeded == ctx.Err() {
+		return true
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// flushContext returns a context for one flush, bounded by the given timeout
+// or, if it's zero, by the flush interval, so that a stalled server can't
+// delay the flushes which follow it.
+func flushContext(ctx context.Context, timeout, interval time.Duration) (context.Context, context.CancelFunc) {
+	if 0 == timeout {
+		timeout = interval
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// flushChecksum counts the lines written through it and computes their
+// CRC-32 (IEEE) checksum, so that a push reporter can end a flush with a
+// record of them from which a downstream pipeline can tell that a batch was
+// truncated or corrupted.
+type flushChecksum struct {
+	w     io.Writer
+	crc   uint32
+	lines int64
+}
+
+// checksum returns w wrapped in a flushChecksum if enabled, or w itself and
+// nil if not.
+func checksum(w io.Writer, enabled bool) (io.Writer, *flushChecksum) {
+	if !enabled {
+		return w, nil
+	}
+	fc := &flushChecksum{w: w}
+	return fc, fc
+}
+
+func (fc *flushChecksum) Write(p []byte) (int, error) {
+	n, err := fc.w.Write(p)
+	fc.crc = crc32.Update(fc.crc, crc32.IEEETable, p[:n])
+	fc.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	return n, err
+}
+
+// dialContext connects to addr, bounding the connection's reads and writes
+// by the context's deadline and closing it if the context is cancelled, so
+// that shutdown interrupts writes in flight.  The returned function must be
+// called once the connection is no longer needed; it closes the connection.
+func dialContext(ctx context.Context, addr net.Addr) (net.Conn, func(), error) {
+	return dialTLSContext(ctx, addr, nil)
+}
+
+// dialTLSContext connects to addr as dialContext does, over TLS if config
+// isn't nil.
+func dialTLSContext(ctx context.Context, addr net.Addr, config *tls.Config) (net.Conn, func(), error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if nil != config {
+		d := tls.Dialer{Config: config}
+		conn, err = d.DialContext(ctx, addr.Network(), addr.String())
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, addr.Network(), addr.String())
+	}
+	if nil != err {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return conn, func() {
+		close(done)
+		conn.Close()
+	}, nil
+}
+
+// openFlush returns the writer to which a flush is sent: dryRun, unless it's
+// nil, or else the dialer's connection, unless it's nil, or else a
+// connection to addr as by dialTLSContext.
+func openFlush(ctx context.Context, addr *net.TCPAddr, tlsConfig *tls.Config, dialer *Dialer, dryRun io.Writer) (io.Writer, func(), error) {
+	if nil != dryRun {
+		return dryRun, func() {}, nil
+	}
+	if nil != dialer {
+		return dialer.open(ctx)
+	}
+	return dialTLSContext(ctx, addr, tlsConfig)
+}
+
+// runFlushes calls flush every interval, each time with a context bounded as
+// by flushContext, until ctx is done.  Errors are logged and emitted as
+// EventReporterError under the given reporter name and timeouts are counted
+// in the given registry.  Like time.Tick, a non-positive interval
+// never flushes.  It also returns if StopScheduledTasks stops its ticker.
+func runFlushes(ctx context.Context, reporter string, r Registry, interval, timeout time.Duration, flush func(context.Context) error) {
+	if interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+	ticker := tasks.ticker(reporter, priorityReport, interval)
+	defer tasks.stop(ticker)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-ticker.c:
+			if !ok || nil != ctx.Err() {
+				return
+			}
+		}
+		flushCtx, cancel := flushContext(ctx, timeout, interval)
+		reportFlushError(ctx, flushCtx, reporter, r, flush(flushCtx))
+		cancel()
+	}
+}
+
+// reportFlushError counts a flush which failed with the given error in the
+// given registry's FlushTimeouts if it timed out and logs and emits the error
+// as EventReporterError under the given reporter name unless ctx, the
+// reporter's own, is done.
+func reportFlushError(ctx, flushCtx context.Context, reporter string, r Registry, err error) {
+	if IsFlushTimeout(flushCtx, err) {
+		FlushTimeouts(r).Inc(1)
+	}
+	if nil != err && nil == ctx.Err() {
+		log.Println(err)
+		EmitEvent(Event{Type: EventReporterError, Name: reporter, Err: err})
+	}
+}
@@ -0,0 +1,91 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialContextCancel(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, closeConn, err := dialContext(ctx, l.Addr().(*net.TCPAddr))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer closeConn()
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for nil == err && time.Now().Before(deadline) {
+		_, err = conn.Write([]byte("foo 1 1\n"))
+		time.Sleep(time.Millisecond)
+	}
+	if nil == err {
+		t.Error("conn.Write(): expected an error once the context was cancelled")
+	}
+}
+
+func TestIsFlushTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	if !IsFlushTimeout(ctx, ctx.Err()) {
+		t.Error("IsFlushTimeout(): expected true for an expired context")
+	}
+	if IsFlushTimeout(ctx, nil) {
+		t.Error("IsFlushTimeout(): expected false without an error")
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if IsFlushTimeout(ctx, ctx.Err()) {
+		t.Error("IsFlushTimeout(): expected false for a cancelled context")
+	}
+}
+
+func TestRunFlushesTimeout(t *testing.T) {
+	r := NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runFlushes(ctx, "test", r, time.Millisecond, time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			cancel()
+			return ctx.Err()
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runFlushes(): expected to return once its context was cancelled")
+	}
+	if count := FlushTimeouts(r).Count(); 1 != count {
+		t.Errorf("FlushTimeouts(r).Count(): 1 != %v\n", count)
+	}
+}
+
+func TestGraphiteOnceContextTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	err = GraphiteOnceContext(ctx, GraphiteConfig{
+		Addr:         l.Addr().(*net.TCPAddr),
+		Registry:     NewRegistry(),
+		DurationUnit: time.Nanosecond,
+	})
+	if !IsFlushTimeout(ctx, err) {
+		t.Errorf("GraphiteOnceContext(): expected a timeout, got %v\n", err)
+	}
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// ForecastMethod is how a Forecast extrapolates a meter's rate.
+type ForecastMethod int
+
+const (
+	// ForecastLinear fits a line by least squares to the rates observed
+	// most recently and extends it.
+	ForecastLinear ForecastMethod = iota
+	// ForecastHolt smooths the level and trend of the rate exponentially,
+	// as Holt-Winters does without its seasonal term, and extends the
+	// trend from the level.  It follows changes in trend sooner than a
+	// line fitted to a long history and forgets old ones gradually.
+	ForecastHolt
+)
+
+// ForecastConfig configures a Forecast.  The zero value projects a line
+// fitted to the last 60 observations one minute ahead.
+type ForecastConfig struct {
+	Method  ForecastMethod
+	Horizon time.Duration // How far ahead to project; zero means a minute
+	History int           // Observations fitted by ForecastLinear; fewer than two means 60
+	Alpha   float64       // Smoothing of ForecastHolt's level; zero means 0.5
+	Beta    float64       // Smoothing of ForecastHolt's trend; zero means 0.1
+}
+
+// Forecasts project a meter's one-minute rate a fixed horizon ahead from the
+// rates observed so far and expose the projection as a GaugeFloat64, so that
+// autoscalers can act on where load is heading rather than where it is.
+// Projections are never negative, and are the latest rate observed until
+// there are two observations to draw a trend from.
+type Forecast struct {
+	config    ForecastConfig
+	meter     Meter
+	mutex     sync.Mutex
+	projected GaugeFloat64
+
+	// ForecastLinear's ring of observations, oldest at next once full.
+	rates []float64
+	times []time.Time
+	next  int
+
+	// ForecastHolt's level and trend, in events per second per second, as
+	// of last.
+	level, trend float64
+	last         time.Time
+	n            int // observations so far, counted up to two
+}
+
+// NewForecast constructs a new Forecast of the given meter.
+func NewForecast(m Meter, c ForecastConfig) *Forecast {
+	if 0 == c.Horizon {
+		c.Horizon = time.Minute
+	}
+	if c.History < 2 {
+		c.History = 60
+	}
+	if 0 == c.Alpha {
+		c.Alpha = 0.5
+	}
+	if 0 == c.Beta {
+		c.Beta = 0.1
+	}
+	return &Forecast{config: c, meter: m, projected: NewGaugeFloat64()}
+}
+
+// NewRegisteredForecast constructs a new Forecast of the given meter and
+// registers its projection under the given name.
+func NewRegisteredForecast(name string, r Registry, m Meter, c ForecastConfig) *Forecast {
+	f := NewForecast(m, c)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, f.projected)
+	return f
+}
+
+// Capture observes the meter's rate periodically.  This is designed to be
+// called as a goroutine.
+func (f *Forecast) Capture(d time.Duration) {
+	for _ = range tick("forecast", priorityCollect, d) {
+		f.CaptureOnce()
+	}
+}
+
+// CaptureOnce observes the meter's rate now.
+func (f *Forecast) CaptureOnce() {
+	f.Observe(time.Now())
+}
+
+// Horizon returns how far ahead the forecast projects.
+func (f *Forecast) Horizon() time.Duration { return f.config.Horizon }
+
+// Observe records the meter's one-minute rate as of the given time, which
+// must be later than the last time observed, and updates the projection.
+func (f *Forecast) Observe(t time.Time) {
+	rate := f.meter.Rate1()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var projected float64
+	switch f.config.Method {
+	case ForecastHolt:
+		projected = f.observeHolt(t, rate)
+	default:
+		projected = f.observeLinear(t, rate)
+	}
+	if projected < 0 {
+		projected = 0
+	}
+	f.projected.Update(projected)
+}
+
+// Projected returns the gauge of the rate projected Horizon ahead of the
+// last observation.
+func (f *Forecast) Projected() GaugeFloat64 {
+	return f.projected
+}
+
+// observeHolt updates the smoothed level and trend and returns the
+// projection.  It must be called with f.mutex held.
+func (f *Forecast) observeHolt(t time.Time, rate float64) float64 {
+	switch f.n {
+	case 0:
+		f.level = rate
+		f.n++
+	case 1:
+		f.trend = (rate - f.level) / t.Sub(f.last).Seconds()
+		f.level = rate
+		f.n++
+	default:
+		dt := t.Sub(f.last).Seconds()
+		level := f.config.Alpha*rate + (1-f.config.Alpha)*(f.level+f.trend*dt)
+		f.trend = f.config.Beta*(level-f.level)/dt + (1-f.config.Beta)*f.trend
+		f.level = level
+	}
+	f.last = t
+	return f.level + f.trend*f.config.Horizon.Seconds()
+}
+
+// observeLinear adds an observation to the ring, fits a line to the ring,
+// and returns the projection.  It must be called with f.mutex held.
+func (f *Forecast) observeLinear(t time.Time, rate float64) float64 {
+	if len(f.rates) < f.config.History {
+		f.rates = append(f.rates, rate)
+		f.times = append(f.times, t)
+	} else {
+		f.rates[f.next], f.times[f.next] = rate, t
+		f.next = (f.next + 1) % f.config.History
+	}
+	if len(f.rates) < 2 {
+		return rate
+	}
+
+	// Fit with times in seconds relative to the latest, which keeps the sums
+	// small and makes the intercept the fitted rate now.
+	n := float64(len(f.rates))
+	var sumX, sumY, sumXX, sumXY float64
+	for i, y := range f.rates {
+		x := f.times[i].Sub(t).Seconds()
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	d := n*sumXX - sumX*sumX
+	if 0 == d {
+		return rate
+	}
+	slope := (n*sumXY - sumX*sumY) / d
+	intercept := (sumY - slope*sumX) / n
+	return intercept + slope*f.config.Horizon.Seconds()
+}
@@ -0,0 +1,70 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestForecastLinear(t *testing.T) {
+	f := NewForecast(&MeterSnapshot{rate1: 10}, ForecastConfig{Horizon: time.Minute, History: 3})
+	start := time.Unix(1500000000, 0)
+	f.Observe(start)
+	if projected := f.Projected().Value(); 10 != projected {
+		t.Errorf("f.Projected().Value(): 10 != %v\n", projected)
+	}
+	for i, rate := range []float64{12, 14, 16} {
+		f.meter = &MeterSnapshot{rate1: rate}
+		f.Observe(start.Add(time.Duration(i+1) * 10 * time.Second))
+	}
+	// Rising by 2 every 10s, so by 12 a minute from 16.
+	if projected := f.Projected().Value(); 1e-9 < math.Abs(28-projected) {
+		t.Errorf("f.Projected().Value(): 28 != %v\n", projected)
+	}
+
+	// Only the last three observations are fitted.
+	for i, rate := range []float64{16, 16, 16} {
+		f.meter = &MeterSnapshot{rate1: rate}
+		f.Observe(start.Add(time.Duration(i+4) * 10 * time.Second))
+	}
+	if projected := f.Projected().Value(); 1e-9 < math.Abs(16-projected) {
+		t.Errorf("f.Projected().Value(): 16 != %v\n", projected)
+	}
+
+	// Projections aren't negative.
+	for i, rate := range []float64{10, 4, 0} {
+		f.meter = &MeterSnapshot{rate1: rate}
+		f.Observe(start.Add(time.Duration(i+7) * 10 * time.Second))
+	}
+	if projected := f.Projected().Value(); 0 != projected {
+		t.Errorf("f.Projected().Value(): 0 != %v\n", projected)
+	}
+}
+
+func TestForecastHolt(t *testing.T) {
+	f := NewForecast(&MeterSnapshot{}, ForecastConfig{Method: ForecastHolt, Horizon: time.Minute})
+	start := time.Unix(1500000000, 0)
+	for i := 0; i < 20; i++ {
+		f.meter = &MeterSnapshot{rate1: float64(10 + i)}
+		f.Observe(start.Add(time.Duration(i) * 5 * time.Second))
+	}
+	// A steady trend of 1 every 5s is followed exactly: 29 now, 41 a minute
+	// from now.
+	if projected := f.Projected().Value(); 1e-9 < math.Abs(41-projected) {
+		t.Errorf("f.Projected().Value(): 41 != %v\n", projected)
+	}
+}
+
+func TestNewRegisteredForecast(t *testing.T) {
+	r := NewRegistry()
+	f := NewRegisteredForecast("requests.forecast", r, NewMeter(), ForecastConfig{})
+	if r.Get("requests.forecast") != f.Projected() {
+		t.Errorf("r.Get(\"requests.forecast\"): %v\n", r.Get("requests.forecast"))
+	}
+	if time.Minute != f.Horizon() {
+		t.Errorf("f.Horizon(): %v\n", f.Horizon())
+	}
+}
@@ -0,0 +1,512 @@
+package metrics
+
+import (
+	"reflect"
+	"time"
+)
+
+// A ForeignRegistry is any registry which can enumerate its metrics, such as
+// one from the upstream rcrowley/go-metrics package or another fork of it,
+// so that a program part-way through migrating to this package can export
+// both its old and new metrics through one registry and set of reporters.
+//
+// Those packages share this one's import path, so their types can't be
+// named here.  Their metrics are instead recognized by their method sets:
+// anything with the methods of a Counter, Gauge, GaugeFloat64, Healthcheck,
+// Histogram, Meter, or Timer, other than Snapshot, which returns a type of
+// the foreign package and is called by reflection.
+type ForeignRegistry interface {
+	Each(func(string, interface{}))
+}
+
+// CaptureForeign imports the metrics in a ForeignRegistry into a Registry
+// periodically so that foreign metrics registered later are imported too.
+// This is designed to be called as a goroutine.
+func CaptureForeign(src ForeignRegistry, r Registry, prefix string, d time.Duration) {
+	for _ = range tick("foreign", priorityCollect, d) {
+		CaptureForeignOnce(src, r, prefix)
+	}
+}
+
+// CaptureForeignOnce registers in r, under prefix, an adapter for each
+// metric in a ForeignRegistry which isn't registered already.  Adapters read
+// and write through to the foreign metric, so its values needn't be copied
+// again.  Metrics which are not recognized are skipped.
+func CaptureForeignOnce(src ForeignRegistry, r Registry, prefix string) {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	src.Each(func(name string, i interface{}) {
+		if m, ok := WrapForeign(i); ok && nil == r.Get(prefix+name) {
+			r.Register(prefix+name, m)
+		}
+	})
+}
+
+// WrapForeign returns a metric of this package which reads and writes
+// through to the given foreign metric and whether the foreign metric was
+// recognized.  Metrics of this package are returned as they are.
+func WrapForeign(i interface{}) (interface{}, bool) {
+	if isMetric(i) {
+		return i, true
+	}
+	switch m := i.(type) {
+	case foreignTimerMethods:
+		return &ForeignTimer{m}, true
+	case foreignHistogramMethods:
+		return &ForeignHistogram{m}, true
+	case foreignMeterMethods:
+		return &ForeignMeter{m}, true
+	case foreignCounterMethods:
+		return &ForeignCounter{m}, true
+	case foreignGaugeFloat64Methods:
+		return &ForeignGaugeFloat64{m}, true
+	case foreignGaugeMethods:
+		return &ForeignGauge{m}, true
+	case foreignHealthcheckMethods:
+		return &ForeignHealthcheck{m}, true
+	}
+	return nil, false
+}
+
+type foreignCounterMethods interface {
+	Clear()
+	Count() int64
+	Dec(int64)
+	Inc(int64)
+}
+
+type foreignGaugeMethods interface {
+	Update(int64)
+	Value() int64
+}
+
+type foreignGaugeFloat64Methods interface {
+	Update(float64)
+	Value() float64
+}
+
+type foreignHealthcheckMethods interface {
+	Check()
+	Error() error
+	Healthy()
+	Unhealthy(error)
+}
+
+type foreignHistogramMethods interface {
+	Clear()
+	Count() int64
+	Max() int64
+	Mean() float64
+	Min() int64
+	Percentile(float64) float64
+	Percentiles([]float64) []float64
+	StdDev() float64
+	Sum() int64
+	Update(int64)
+	Variance() float64
+}
+
+type foreignMeterMethods interface {
+	Count() int64
+	Mark(int64)
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+}
+
+type foreignSampleMethods interface {
+	foreignHistogramMethods
+	Size() int
+	Values() []int64
+}
+
+type foreignTimerMethods interface {
+	Count() int64
+	Max() int64
+	Mean() float64
+	Min() int64
+	Percentile(float64) float64
+	Percentiles([]float64) []float64
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+	StdDev() float64
+	Sum() int64
+	Time(func())
+	Update(time.Duration)
+	UpdateSince(time.Time)
+	Variance() float64
+}
+
+// ForeignCounter adapts a foreign counter to a Counter.
+type ForeignCounter struct {
+	counter foreignCounterMethods
+}
+
+// Clear sets the foreign counter to zero.
+func (c *ForeignCounter) Clear() { c.counter.Clear() }
+
+// Count returns the foreign counter's count.
+func (c *ForeignCounter) Count() int64 { return c.counter.Count() }
+
+// Dec decrements the foreign counter by the given amount.
+func (c *ForeignCounter) Dec(i int64) { c.counter.Dec(i) }
+
+// Inc increments the foreign counter by the given amount.
+func (c *ForeignCounter) Inc(i int64) { c.counter.Inc(i) }
+
+// Snapshot returns a read-only copy of the foreign counter.
+func (c *ForeignCounter) Snapshot() Counter { return CounterSnapshot(c.counter.Count()) }
+
+// ForeignGauge adapts a foreign gauge to a Gauge.
+type ForeignGauge struct {
+	gauge foreignGaugeMethods
+}
+
+// Add adds to the foreign gauge's value.  Since a foreign gauge has only
+// Value and Update, this and the other read-modify-write methods aren't
+// atomic: concurrent updates may be lost.
+func (g *ForeignGauge) Add(d int64) { g.gauge.Update(g.gauge.Value() + d) }
+
+// SetMax updates the foreign gauge's value if the given value is greater and
+// returns whether it did.
+func (g *ForeignGauge) SetMax(v int64) bool {
+	if v <= g.gauge.Value() {
+		return false
+	}
+	g.gauge.Update(v)
+	return true
+}
+
+// SetMin updates the foreign gauge's value if the given value is less and
+// returns whether it did.
+func (g *ForeignGauge) SetMin(v int64) bool {
+	if g.gauge.Value() <= v {
+		return false
+	}
+	g.gauge.Update(v)
+	return true
+}
+
+// Snapshot returns a read-only copy of the foreign gauge.
+func (g *ForeignGauge) Snapshot() Gauge { return GaugeSnapshot(g.gauge.Value()) }
+
+// Sub subtracts from the foreign gauge's value.
+func (g *ForeignGauge) Sub(d int64) { g.Add(-d) }
+
+// Update updates the foreign gauge's value.
+func (g *ForeignGauge) Update(v int64) { g.gauge.Update(v) }
+
+// Value returns the foreign gauge's value.
+func (g *ForeignGauge) Value() int64 { return g.gauge.Value() }
+
+// ForeignGaugeFloat64 adapts a foreign float64 gauge to a GaugeFloat64.
+type ForeignGaugeFloat64 struct {
+	gauge foreignGaugeFloat64Methods
+}
+
+// Snapshot returns a read-only copy of the foreign gauge.
+func (g *ForeignGaugeFloat64) Snapshot() GaugeFloat64 {
+	return GaugeFloat64Snapshot(g.gauge.Value())
+}
+
+// Update updates the foreign gauge's value.
+func (g *ForeignGaugeFloat64) Update(v float64) { g.gauge.Update(v) }
+
+// Value returns the foreign gauge's value.
+func (g *ForeignGaugeFloat64) Value() float64 { return g.gauge.Value() }
+
+// ForeignHealthcheck adapts a foreign healthcheck to a Healthcheck.
+type ForeignHealthcheck struct {
+	healthcheck foreignHealthcheckMethods
+}
+
+// Check runs the foreign healthcheck.
+func (h *ForeignHealthcheck) Check() { h.healthcheck.Check() }
+
+// Error returns the foreign healthcheck's status, which will be nil if it
+// is healthy.
+func (h *ForeignHealthcheck) Error() error { return h.healthcheck.Error() }
+
+// Healthy marks the foreign healthcheck as healthy.
+func (h *ForeignHealthcheck) Healthy() { h.healthcheck.Healthy() }
+
+// Unhealthy marks the foreign healthcheck as unhealthy.
+func (h *ForeignHealthcheck) Unhealthy(err error) { h.healthcheck.Unhealthy(err) }
+
+// ForeignHistogram adapts a foreign histogram, or its snapshot, to a
+// Histogram.
+type ForeignHistogram struct {
+	histogram foreignHistogramMethods
+}
+
+// Clear clears the foreign histogram.
+func (h *ForeignHistogram) Clear() { h.histogram.Clear() }
+
+// Count returns the number of samples recorded by the foreign histogram.
+func (h *ForeignHistogram) Count() int64 { return h.histogram.Count() }
+
+// Max returns the maximum value in the foreign histogram's sample.
+func (h *ForeignHistogram) Max() int64 { return h.histogram.Max() }
+
+// Mean returns the mean of the values in the foreign histogram's sample.
+func (h *ForeignHistogram) Mean() float64 { return h.histogram.Mean() }
+
+// Min returns the minimum value in the foreign histogram's sample.
+func (h *ForeignHistogram) Min() int64 { return h.histogram.Min() }
+
+// Percentile returns an arbitrary percentile of the values in the foreign
+// histogram's sample.
+func (h *ForeignHistogram) Percentile(p float64) float64 {
+	return h.histogram.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the
+// foreign histogram's sample.
+func (h *ForeignHistogram) Percentiles(ps []float64) []float64 {
+	return h.histogram.Percentiles(ps)
+}
+
+// Sample returns an adapter for the foreign histogram's Sample or, if it
+// doesn't have one, a NilSample.
+func (h *ForeignHistogram) Sample() Sample {
+	if s, ok := callForeign(h.histogram, "Sample").(foreignSampleMethods); ok {
+		return &ForeignSample{s}
+	}
+	return NilSample{}
+}
+
+// Snapshot returns a read-only copy of the foreign histogram.
+func (h *ForeignHistogram) Snapshot() Histogram {
+	if s, ok := callForeign(h.histogram, "Snapshot").(foreignHistogramMethods); ok {
+		return &ForeignHistogram{s}
+	}
+	return &ForeignHistogram{h.histogram}
+}
+
+// StdDev returns the standard deviation of the values in the foreign
+// histogram's sample.
+func (h *ForeignHistogram) StdDev() float64 { return h.histogram.StdDev() }
+
+// Sum returns the sum of the values in the foreign histogram's sample.
+func (h *ForeignHistogram) Sum() int64 { return h.histogram.Sum() }
+
+// Update samples a new value.
+func (h *ForeignHistogram) Update(v int64) { h.histogram.Update(v) }
+
+// UpdateWeighted samples a new value standing for weight observations.
+// Foreign histograms without weights of their own are updated once for each
+// observation.
+func (h *ForeignHistogram) UpdateWeighted(v int64, weight float64) {
+	updateForeignWeighted(h.histogram, v, weight)
+}
+
+// Variance returns the variance of the values in the foreign histogram's
+// sample.
+func (h *ForeignHistogram) Variance() float64 { return h.histogram.Variance() }
+
+// ForeignMeter adapts a foreign meter to a Meter.
+type ForeignMeter struct {
+	meter foreignMeterMethods
+}
+
+// Count returns the number of events recorded by the foreign meter.
+func (m *ForeignMeter) Count() int64 { return m.meter.Count() }
+
+// Mark records the occurance of n events.
+func (m *ForeignMeter) Mark(n int64) { m.meter.Mark(n) }
+
+// Rate1 returns the foreign meter's one-minute moving average rate of events
+// per second.
+func (m *ForeignMeter) Rate1() float64 { return m.meter.Rate1() }
+
+// Rate5 returns the foreign meter's five-minute moving average rate of
+// events per second.
+func (m *ForeignMeter) Rate5() float64 { return m.meter.Rate5() }
+
+// Rate15 returns the foreign meter's fifteen-minute moving average rate of
+// events per second.
+func (m *ForeignMeter) Rate15() float64 { return m.meter.Rate15() }
+
+// RateMean returns the foreign meter's mean rate of events per second.
+func (m *ForeignMeter) RateMean() float64 { return m.meter.RateMean() }
+
+// Snapshot returns a read-only copy of the foreign meter.
+func (m *ForeignMeter) Snapshot() Meter {
+	meter := m.meter
+	if s, ok := callForeign(meter, "Snapshot").(foreignMeterMethods); ok {
+		meter = s
+	}
+	count := meter.Count()
+	return &MeterSnapshot{
+		count:      count,
+		countFloat: float64(count),
+		rate1:      meter.Rate1(),
+		rate5:      meter.Rate5(),
+		rate15:     meter.Rate15(),
+		rateMean:   meter.RateMean(),
+	}
+}
+
+// ForeignSample adapts a foreign sample to a Sample.
+type ForeignSample struct {
+	sample foreignSampleMethods
+}
+
+// Clear clears the foreign sample.
+func (s *ForeignSample) Clear() { s.sample.Clear() }
+
+// Count returns the number of samples recorded by the foreign sample, which
+// may exceed its reservoir size.
+func (s *ForeignSample) Count() int64 { return s.sample.Count() }
+
+// Max returns the maximum value in the foreign sample.
+func (s *ForeignSample) Max() int64 { return s.sample.Max() }
+
+// Mean returns the mean of the values in the foreign sample.
+func (s *ForeignSample) Mean() float64 { return s.sample.Mean() }
+
+// Min returns the minimum value in the foreign sample.
+func (s *ForeignSample) Min() int64 { return s.sample.Min() }
+
+// Percentile returns an arbitrary percentile of the values in the foreign
+// sample.
+func (s *ForeignSample) Percentile(p float64) float64 { return s.sample.Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the
+// foreign sample.
+func (s *ForeignSample) Percentiles(ps []float64) []float64 {
+	return s.sample.Percentiles(ps)
+}
+
+// Size returns the size of the foreign sample, which is at most the
+// reservoir size.
+func (s *ForeignSample) Size() int { return s.sample.Size() }
+
+// Snapshot returns a read-only copy of the foreign sample.
+func (s *ForeignSample) Snapshot() Sample {
+	return &SampleSnapshot{count: s.sample.Count(), sum: s.sample.Sum(), values: s.sample.Values()}
+}
+
+// StdDev returns the standard deviation of the values in the foreign sample.
+func (s *ForeignSample) StdDev() float64 { return s.sample.StdDev() }
+
+// Sum returns the sum of the values in the foreign sample.
+func (s *ForeignSample) Sum() int64 { return s.sample.Sum() }
+
+// Update samples a new value.
+func (s *ForeignSample) Update(v int64) { s.sample.Update(v) }
+
+// UpdateWeighted samples a new value standing for weight observations.
+// Foreign samples without weights of their own are updated once for each
+// observation.
+func (s *ForeignSample) UpdateWeighted(v int64, weight float64) {
+	updateForeignWeighted(s.sample, v, weight)
+}
+
+// Values returns a copy of the values in the foreign sample.
+func (s *ForeignSample) Values() []int64 { return s.sample.Values() }
+
+// Variance returns the variance of the values in the foreign sample.
+func (s *ForeignSample) Variance() float64 { return s.sample.Variance() }
+
+// ForeignTimer adapts a foreign timer, or its snapshot, to a Timer.
+type ForeignTimer struct {
+	timer foreignTimerMethods
+}
+
+// Count returns the number of events recorded by the foreign timer.
+func (t *ForeignTimer) Count() int64 { return t.timer.Count() }
+
+// Max returns the maximum value in the foreign timer's sample.
+func (t *ForeignTimer) Max() int64 { return t.timer.Max() }
+
+// Mean returns the mean of the values in the foreign timer's sample.
+func (t *ForeignTimer) Mean() float64 { return t.timer.Mean() }
+
+// Min returns the minimum value in the foreign timer's sample.
+func (t *ForeignTimer) Min() int64 { return t.timer.Min() }
+
+// Percentile returns an arbitrary percentile of the values in the foreign
+// timer's sample.
+func (t *ForeignTimer) Percentile(p float64) float64 { return t.timer.Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the
+// foreign timer's sample.
+func (t *ForeignTimer) Percentiles(ps []float64) []float64 {
+	return t.timer.Percentiles(ps)
+}
+
+// Rate1 returns the foreign timer's one-minute moving average rate of events
+// per second.
+func (t *ForeignTimer) Rate1() float64 { return t.timer.Rate1() }
+
+// Rate5 returns the foreign timer's five-minute moving average rate of
+// events per second.
+func (t *ForeignTimer) Rate5() float64 { return t.timer.Rate5() }
+
+// Rate15 returns the foreign timer's fifteen-minute moving average rate of
+// events per second.
+func (t *ForeignTimer) Rate15() float64 { return t.timer.Rate15() }
+
+// RateMean returns the foreign timer's mean rate of events per second.
+func (t *ForeignTimer) RateMean() float64 { return t.timer.RateMean() }
+
+// Snapshot returns a read-only copy of the foreign timer.
+func (t *ForeignTimer) Snapshot() Timer {
+	if s, ok := callForeign(t.timer, "Snapshot").(foreignTimerMethods); ok {
+		return &ForeignTimer{s}
+	}
+	return &ForeignTimer{t.timer}
+}
+
+// StdDev returns the standard deviation of the values in the foreign timer's
+// sample.
+func (t *ForeignTimer) StdDev() float64 { return t.timer.StdDev() }
+
+// Sum returns the sum of the values in the foreign timer's sample.
+func (t *ForeignTimer) Sum() int64 { return t.timer.Sum() }
+
+// Time records the duration of the execution of the given function.
+func (t *ForeignTimer) Time(f func()) { t.timer.Time(f) }
+
+// Update records the duration of an event.
+func (t *ForeignTimer) Update(d time.Duration) { t.timer.Update(d) }
+
+// UpdateSince records the duration of an event that started at a time and
+// ends now.
+func (t *ForeignTimer) UpdateSince(ts time.Time) { t.timer.UpdateSince(ts) }
+
+// Variance returns the variance of the values in the foreign timer's sample.
+func (t *ForeignTimer) Variance() float64 { return t.timer.Variance() }
+
+// callForeign calls the named method of a foreign metric, which takes no
+// arguments and returns a value of a type this package can't name, and
+// returns its result or nil if the metric has no such method.
+func callForeign(i interface{}, method string) interface{} {
+	m := reflect.ValueOf(i).MethodByName(method)
+	if !m.IsValid() || 0 != m.Type().NumIn() || 1 != m.Type().NumOut() {
+		return nil
+	}
+	return m.Call(nil)[0].Interface()
+}
+
+func updateForeignWeighted(h interface {
+	Update(int64)
+}, v int64, weight float64) {
+	if w, ok := h.(interface {
+		UpdateWeighted(int64, float64)
+	}); ok {
+		w.UpdateWeighted(v, weight)
+		return
+	}
+	if !validWeight(weight) {
+		return
+	}
+	for n := weightCount(weight); 0 < n; n-- {
+		h.Update(v)
+	}
+}
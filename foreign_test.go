@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+// upstreamCounter and upstreamHistogram stand in for the metrics of another
+// package, whose Snapshot methods return that package's types.
+type upstreamCounter struct {
+	count int64
+}
+
+func (c *upstreamCounter) Clear()                     { c.count = 0 }
+func (c *upstreamCounter) Count() int64               { return c.count }
+func (c *upstreamCounter) Dec(i int64)                { c.count -= i }
+func (c *upstreamCounter) Inc(i int64)                { c.count += i }
+func (c *upstreamCounter) Snapshot() *upstreamCounter { return &upstreamCounter{c.count} }
+
+type upstreamHistogram struct {
+	sample *upstreamSample
+}
+
+func (h *upstreamHistogram) Clear()                             { h.sample.Clear() }
+func (h *upstreamHistogram) Count() int64                       { return h.sample.Count() }
+func (h *upstreamHistogram) Max() int64                         { return h.sample.Max() }
+func (h *upstreamHistogram) Mean() float64                      { return h.sample.Mean() }
+func (h *upstreamHistogram) Min() int64                         { return h.sample.Min() }
+func (h *upstreamHistogram) Percentile(p float64) float64       { return h.sample.Percentile(p) }
+func (h *upstreamHistogram) Percentiles(ps []float64) []float64 { return h.sample.Percentiles(ps) }
+func (h *upstreamHistogram) Sample() interface{}                { return h.sample }
+func (h *upstreamHistogram) StdDev() float64                    { return h.sample.StdDev() }
+func (h *upstreamHistogram) Sum() int64                         { return h.sample.Sum() }
+func (h *upstreamHistogram) Update(v int64)                     { h.sample.Update(v) }
+func (h *upstreamHistogram) Variance() float64                  { return h.sample.Variance() }
+
+func (h *upstreamHistogram) Snapshot() *upstreamHistogram {
+	return &upstreamHistogram{&upstreamSample{h.sample.Values()}}
+}
+
+type upstreamSample struct {
+	values []int64
+}
+
+func (s *upstreamSample) Clear()                       { s.values = nil }
+func (s *upstreamSample) Count() int64                 { return int64(len(s.values)) }
+func (s *upstreamSample) Max() int64                   { return SampleMax(s.values) }
+func (s *upstreamSample) Mean() float64                { return SampleMean(s.values) }
+func (s *upstreamSample) Min() int64                   { return SampleMin(s.values) }
+func (s *upstreamSample) Percentile(p float64) float64 { return SamplePercentile(s.Values(), p) }
+func (s *upstreamSample) Percentiles(ps []float64) []float64 {
+	return SamplePercentiles(s.Values(), ps)
+}
+func (s *upstreamSample) Size() int         { return len(s.values) }
+func (s *upstreamSample) StdDev() float64   { return SampleStdDev(s.values) }
+func (s *upstreamSample) Sum() int64        { return SampleSum(s.values) }
+func (s *upstreamSample) Update(v int64)    { s.values = append(s.values, v) }
+func (s *upstreamSample) Values() []int64   { return append([]int64(nil), s.values...) }
+func (s *upstreamSample) Variance() float64 { return SampleVariance(s.values) }
+
+type upstreamRegistry map[string]interface{}
+
+func (r upstreamRegistry) Each(f func(string, interface{})) {
+	for name, i := range r {
+		f(name, i)
+	}
+}
+
+func TestCaptureForeignOnce(t *testing.T) {
+	c := &upstreamCounter{}
+	src := upstreamRegistry{
+		"counter":   c,
+		"histogram": &upstreamHistogram{&upstreamSample{}},
+		"unknown":   "foo",
+	}
+	r := NewRegistry()
+	CaptureForeignOnce(src, r, "old.")
+	c.Inc(47)
+	if counter, ok := r.Get("old.counter").(Counter); !ok {
+		t.Fatalf("r.Get(\"old.counter\"): %T\n", r.Get("old.counter"))
+	} else if count := counter.Snapshot().Count(); 47 != count {
+		t.Errorf("counter.Snapshot().Count(): 47 != %v\n", count)
+	}
+	if nil != r.Get("old.unknown") {
+		t.Errorf("r.Get(\"old.unknown\"): %v\n", r.Get("old.unknown"))
+	}
+	h := r.Get("old.histogram").(Histogram)
+	CaptureForeignOnce(src, r, "old.")
+	if h != r.Get("old.histogram") {
+		t.Errorf("r.Get(\"old.histogram\"): %v != %v\n", h, r.Get("old.histogram"))
+	}
+}
+
+func TestForeignHistogram(t *testing.T) {
+	i, ok := WrapForeign(&upstreamHistogram{&upstreamSample{}})
+	if !ok {
+		t.Fatal("WrapForeign: not ok")
+	}
+	h := i.(Histogram)
+	for v := int64(1); v <= 100; v++ {
+		h.Update(v)
+	}
+	h.UpdateWeighted(200, 2)
+	snapshot := h.Snapshot()
+	h.Update(300)
+	if count := snapshot.Count(); 102 != count {
+		t.Errorf("snapshot.Count(): 102 != %v\n", count)
+	}
+	if max := snapshot.Max(); 200 != max {
+		t.Errorf("snapshot.Max(): 200 != %v\n", max)
+	}
+	if values := h.Sample().Snapshot().Values(); 103 != len(values) {
+		t.Errorf("len(h.Sample().Snapshot().Values()): 103 != %v\n", len(values))
+	}
+}
+
+func TestWrapForeign(t *testing.T) {
+	c := NewCounter()
+	if i, ok := WrapForeign(c); !ok || c != i {
+		t.Errorf("WrapForeign(c): %v, %v\n", i, ok)
+	}
+	if i, ok := WrapForeign(time.Now()); ok {
+		t.Errorf("WrapForeign(time.Now()): %v, %v\n", i, ok)
+	}
+}
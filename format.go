@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A FloatFormat controls how a reporter formats floating-point values, such
+// as for a backend whose parser rejects exponents or which needs more than
+// the two decimal places reporters use by default to tell a very small rate
+// from zero.  Values are formatted the same regardless of locale, with a
+// period as the decimal point and no grouping.  A nil *FloatFormat keeps the
+// reporter's default for each value.
+type FloatFormat struct {
+
+	// Decimals is the number of digits after the decimal point or, if
+	// Scientific is set, the number of significant digits.  -1 means the
+	// fewest digits which represent the value exactly.
+	Decimals int
+
+	// Scientific permits exponents, as in 1.5e-07, for very large and very
+	// small values.  Without it values are always written out in full.
+	Scientific bool
+}
+
+// format formats a value according to the FloatFormat or, if it's nil, the
+// given fmt format.
+func (f *FloatFormat) format(defaultFormat string, v float64) string {
+	if nil == f {
+		return fmt.Sprintf(defaultFormat, v)
+	}
+	if f.Scientific {
+		return strconv.FormatFloat(v, 'g', f.Decimals, 64)
+	}
+	return strconv.FormatFloat(v, 'f', f.Decimals, 64)
+}
@@ -0,0 +1,50 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFloatFormat(t *testing.T) {
+	for _, c := range []struct {
+		f        *FloatFormat
+		v        float64
+		expected string
+	}{
+		{nil, 0.000012, "0.00"},
+		{&FloatFormat{Decimals: 6}, 0.000012, "0.000012"},
+		{&FloatFormat{Decimals: -1}, 0.000000125, "0.000000125"},
+		{&FloatFormat{Decimals: -1}, 1e21, "1000000000000000000000"},
+		{&FloatFormat{Decimals: -1, Scientific: true}, 0.000000125, "1.25e-07"},
+		{&FloatFormat{Decimals: 2, Scientific: true}, 1234.5, "1.2e+03"},
+		{&FloatFormat{Decimals: 2}, math.Inf(1), "+Inf"},
+	} {
+		if s := c.f.format("%.2f", c.v); c.expected != s {
+			t.Errorf("format(%v, %v): %q != %q\n", c.f, c.v, c.expected, s)
+		}
+	}
+}
+
+func TestGraphiteFloatFormat(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("ratio", r).Update(0.000012)
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+		FloatFormat:  &FloatFormat{Decimals: -1},
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.HasPrefix(s, "prefix.ratio.value 0.000012 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
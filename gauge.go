@@ -1,13 +1,14 @@
 package metrics
 
-import "sync/atomic"
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
 
 // Gauges hold an int64 value that can be set arbitrarily.
-type Gauge interface {
-	Snapshot() Gauge
-	Update(int64)
-	Value() int64
-}
+type Gauge = metricsiface.Gauge
 
 // GetOrRegisterGauge returns an existing Gauge or constructs and registers a
 // new StandardGauge.
@@ -20,10 +21,10 @@ func GetOrRegisterGauge(name string, r Registry) Gauge {
 
 // NewGauge constructs a new StandardGauge.
 func NewGauge() Gauge {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
 		return NilGauge{}
 	}
-	return &StandardGauge{0}
+	return &StandardGauge{}
 }
 
 // NewRegisteredGauge constructs and registers a new StandardGauge.
@@ -39,9 +40,37 @@ func NewRegisteredGauge(name string, r Registry) Gauge {
 // GaugeSnapshot is a read-only copy of another Gauge.
 type GaugeSnapshot int64
 
+// Add panics.
+func (GaugeSnapshot) Add(int64) {
+	panic("Add called on a GaugeSnapshot")
+}
+
+// GoString formats the snapshot for %#v.
+func (g GaugeSnapshot) GoString() string {
+	return fmt.Sprintf("metrics.GaugeSnapshot(%d)", int64(g))
+}
+
+// SetMax panics.
+func (GaugeSnapshot) SetMax(int64) bool {
+	panic("SetMax called on a GaugeSnapshot")
+}
+
+// SetMin panics.
+func (GaugeSnapshot) SetMin(int64) bool {
+	panic("SetMin called on a GaugeSnapshot")
+}
+
 // Snapshot returns the snapshot.
 func (g GaugeSnapshot) Snapshot() Gauge { return g }
 
+// String formats the value for debugging.
+func (g GaugeSnapshot) String() string { return gaugeString(g) }
+
+// Sub panics.
+func (GaugeSnapshot) Sub(int64) {
+	panic("Sub called on a GaugeSnapshot")
+}
+
 // Update panics.
 func (GaugeSnapshot) Update(int64) {
 	panic("Update called on a GaugeSnapshot")
@@ -53,19 +82,60 @@ func (g GaugeSnapshot) Value() int64 { return int64(g) }
 // NilGauge is a no-op Gauge.
 type NilGauge struct{}
 
+// Add is a no-op.
+func (NilGauge) Add(d int64) {}
+
+// SetMax is a no-op.
+func (NilGauge) SetMax(v int64) bool { return false }
+
+// SetMin is a no-op.
+func (NilGauge) SetMin(v int64) bool { return false }
+
 // Snapshot is a no-op.
 func (NilGauge) Snapshot() Gauge { return NilGauge{} }
 
+// Sub is a no-op.
+func (NilGauge) Sub(d int64) {}
+
 // Update is a no-op.
 func (NilGauge) Update(v int64) {}
 
 // Value is a no-op.
 func (NilGauge) Value() int64 { return 0 }
 
-// StandardGauge is the standard implementation of a Gauge and uses the
-// sync/atomic package to manage a single int64 value.
+// StandardGauge is the standard implementation of a Gauge and keeps its value
+// in a GaugeOf[int64], which manages it atomically.
 type StandardGauge struct {
-	value int64
+	value       GaugeOf[int64]
+	subscribers atomic.Value // []*GaugeSubscription, replaced, never modified
+}
+
+// Add adds to the gauge's value atomically.
+func (g *StandardGauge) Add(d int64) {
+	if 0 != d {
+		v := g.value.value.add(d)
+		g.notify(v-d, v)
+	}
+}
+
+// SetMax updates the gauge's value if the given value is greater, atomically,
+// and returns whether it did.
+func (g *StandardGauge) SetMax(v int64) bool {
+	old, ok := g.value.value.replace(v, func(old int64) bool { return old < v })
+	if ok {
+		g.notify(old, v)
+	}
+	return ok
+}
+
+// SetMin updates the gauge's value if the given value is less, atomically,
+// and returns whether it did.
+func (g *StandardGauge) SetMin(v int64) bool {
+	old, ok := g.value.value.replace(v, func(old int64) bool { return v < old })
+	if ok {
+		g.notify(old, v)
+	}
+	return ok
 }
 
 // Snapshot returns a read-only copy of the gauge.
@@ -73,12 +143,28 @@ func (g *StandardGauge) Snapshot() Gauge {
 	return GaugeSnapshot(g.Value())
 }
 
+// String formats the value for debugging.
+func (g *StandardGauge) String() string { return gaugeString(g) }
+
+// Sub subtracts from the gauge's value atomically.
+func (g *StandardGauge) Sub(d int64) { g.Add(-d) }
+
 // Update updates the gauge's value.
 func (g *StandardGauge) Update(v int64) {
-	atomic.StoreInt64(&g.value, v)
+	if old := g.value.Swap(v); old != v {
+		g.notify(old, v)
+	}
 }
 
 // Value returns the gauge's current value.
 func (g *StandardGauge) Value() int64 {
-	return atomic.LoadInt64(&g.value)
+	return g.value.Value()
+}
+
+// notify notifies the gauge's subscribers that its value changed.
+func (g *StandardGauge) notify(old, v int64) {
+	subscribers, _ := g.subscribers.Load().([]*GaugeSubscription)
+	for _, s := range subscribers {
+		s.notify(old, v)
+	}
 }
@@ -1,13 +1,13 @@
 package metrics
 
-import "sync"
+import (
+	"fmt"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
 
 // GaugeFloat64s hold a float64 value that can be set arbitrarily.
-type GaugeFloat64 interface {
-	Snapshot() GaugeFloat64
-	Update(float64)
-	Value() float64
-}
+type GaugeFloat64 = metricsiface.GaugeFloat64
 
 // GetOrRegisterGaugeFloat64 returns an existing GaugeFloat64 or constructs and registers a
 // new StandardGaugeFloat64.
@@ -20,12 +20,10 @@ func GetOrRegisterGaugeFloat64(name string, r Registry) GaugeFloat64 {
 
 // NewGaugeFloat64 constructs a new StandardGaugeFloat64.
 func NewGaugeFloat64() GaugeFloat64 {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
 		return NilGaugeFloat64{}
 	}
-	return &StandardGaugeFloat64{
-		value: 0.0,
-	}
+	return &StandardGaugeFloat64{}
 }
 
 // NewRegisteredGaugeFloat64 constructs and registers a new StandardGaugeFloat64.
@@ -41,9 +39,17 @@ func NewRegisteredGaugeFloat64(name string, r Registry) GaugeFloat64 {
 // GaugeFloat64Snapshot is a read-only copy of another GaugeFloat64.
 type GaugeFloat64Snapshot float64
 
+// GoString formats the snapshot for %#v.
+func (g GaugeFloat64Snapshot) GoString() string {
+	return fmt.Sprintf("metrics.GaugeFloat64Snapshot(%v)", float64(g))
+}
+
 // Snapshot returns the snapshot.
 func (g GaugeFloat64Snapshot) Snapshot() GaugeFloat64 { return g }
 
+// String formats the value for debugging.
+func (g GaugeFloat64Snapshot) String() string { return gaugeFloat64String(g) }
+
 // Update panics.
 func (GaugeFloat64Snapshot) Update(float64) {
 	panic("Update called on a GaugeFloat64Snapshot")
@@ -64,11 +70,10 @@ func (NilGaugeFloat64) Update(v float64) {}
 // Value is a no-op.
 func (NilGaugeFloat64) Value() float64 { return 0.0 }
 
-// StandardGaugeFloat64 is the standard implementation of a GaugeFloat64 and uses
-// sync.Mutex to manage a single float64 value.
+// StandardGaugeFloat64 is the standard implementation of a GaugeFloat64: a
+// GaugeOf[float64], which manages its value atomically.
 type StandardGaugeFloat64 struct {
-	mutex sync.Mutex
-	value float64
+	GaugeOf[float64]
 }
 
 // Snapshot returns a read-only copy of the gauge.
@@ -76,16 +81,5 @@ func (g *StandardGaugeFloat64) Snapshot() GaugeFloat64 {
 	return GaugeFloat64Snapshot(g.Value())
 }
 
-// Update updates the gauge's value.
-func (g *StandardGaugeFloat64) Update(v float64) {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-	g.value = v
-}
-
-// Value returns the gauge's current value.
-func (g *StandardGaugeFloat64) Value() float64 {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-	return g.value
-}
+// String formats the value for debugging.
+func (g *StandardGaugeFloat64) String() string { return gaugeFloat64String(g) }
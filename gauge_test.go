@@ -1,6 +1,12 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
-import "testing"
+import (
+	"sync"
+	"testing"
+)
 
 func BenchmarkGuage(b *testing.B) {
 	g := NewGauge()
@@ -18,6 +24,55 @@ func TestGauge(t *testing.T) {
 	}
 }
 
+func TestGaugeAddSub(t *testing.T) {
+	g := NewGauge()
+	g.Add(47)
+	g.Sub(5)
+	if v := g.Value(); 42 != v {
+		t.Errorf("g.Value(): 42 != %v\n", v)
+	}
+}
+
+func TestGaugeSetMaxSetMin(t *testing.T) {
+	g := NewGauge()
+	if !g.SetMax(47) {
+		t.Error("g.SetMax(47): false")
+	}
+	if g.SetMax(46) {
+		t.Error("g.SetMax(46): true")
+	}
+	if v := g.Value(); 47 != v {
+		t.Errorf("g.Value(): 47 != %v\n", v)
+	}
+	if g.SetMin(48) {
+		t.Error("g.SetMin(48): true")
+	}
+	if !g.SetMin(-1) {
+		t.Error("g.SetMin(-1): false")
+	}
+	if v := g.Value(); -1 != v {
+		t.Errorf("g.Value(): -1 != %v\n", v)
+	}
+}
+
+func TestGaugeSetMaxConcurrent(t *testing.T) {
+	g := NewGauge()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := int64(0); j < 1000; j++ {
+				g.SetMax(j*8 + int64(i))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if v := g.Value(); 7999 != v {
+		t.Errorf("g.Value(): 7999 != %v\n", v)
+	}
+}
+
 func TestGaugeSnapshot(t *testing.T) {
 	g := NewGauge()
 	g.Update(int64(47))
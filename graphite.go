@@ -2,8 +2,14 @@ package metrics
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net"
 	"strconv"
 	"strings"
@@ -14,11 +20,45 @@ import (
 // the Graphite exporter
 type GraphiteConfig struct {
 	Addr          *net.TCPAddr  // Network address to connect to
+	TLSConfig     *tls.Config   // If not nil, connects to Addr over TLS; a Dialer has a TLSConfig of its own
+	Dialer        *Dialer       // If not nil, connects to a host name in place of Addr; see Dialer
+	UDPAddr       *net.UDPAddr  // If not nil, address to send datagrams to instead of Addr
+	MaxPacketSize int           // Largest datagram sent to UDPAddr; zero means DefaultMaxPacketSize
 	Registry      Registry      // Registry to be exported
 	FlushInterval time.Duration // Flush interval
+	FlushTimeout  time.Duration // Deadline for each flush; zero means FlushInterval
 	DurationUnit  time.Duration // Time conversion unit for durations
 	Prefix        string        // Prefix to be prepended to metric names
-	Percentiles   []float64     // Percentiles to export from timers and histograms
+	Percentiles   []float64     // Percentiles to export from timers and histograms; nil means each metric's ExportedPercentiles
+	ValuePolicy   *ValuePolicy  // NaN, ±Inf and negative value handling; nil means DefaultValuePolicy
+	Concurrency   Concurrency   // Goroutines encoding metrics; the zero value encodes serially
+	Changes       *ChangeFilter // Send only changed metrics; nil sends every metric
+	Downsampling  *Downsampling // Histogram detail to export; nil exports every detail
+	Schedules     []Schedule    // Metrics flushed at intervals of their own; see Schedule
+	DryRun        io.Writer     // If not nil, receives what would be sent instead of Addr
+	FloatFormat   *FloatFormat  // Formatting of floating-point values; nil keeps the defaults
+	Restricted    *Restriction  // Strip potentially sensitive tag values; nil exports every tag as it is
+
+	// IntervalExtremes sends each IntervalTimer's exact minimum and maximum
+	// since the previous flush as interval-min and interval-max, resetting
+	// them, so only one reporter of a registry should set it.
+	IntervalExtremes bool
+	// Pickle sends each flush to carbon's pickle receiver, usually on port
+	// 2004, in batches of pickled (path, (timestamp, value)) tuples, which
+	// carbon parses more cheaply than lines.  It doesn't apply to UDPAddr.
+	Pickle bool
+	// Retries is how many times a flush which fails to connect or write is
+	// sent again over a new connection, after waiting RetryBackoff, which
+	// doubles before each retry after the first, or 100ms if it's zero.
+	// Retries stop once the flush times out.  Each flush is encoded in full
+	// before it's sent so that a retry sends the same lines again, which
+	// carbon stores as before.  It doesn't apply to UDPAddr.
+	Retries      int
+	RetryBackoff time.Duration
+	// Checksum ends each flush with flush.lines, the number of lines before
+	// it, and flush.crc32, the CRC-32 (IEEE) checksum of those lines, so
+	// that downstream pipelines can detect truncated or corrupted batches.
+	Checksum bool
 }
 
 // Graphite is a blocking exporter function which reports metrics in r
@@ -31,83 +71,297 @@ func Graphite(r Registry, d time.Duration, prefix string, addr *net.TCPAddr) {
 		FlushInterval: d,
 		DurationUnit:  time.Nanosecond,
 		Prefix:        prefix,
-		Percentiles:   []float64{0.5, 0.75, 0.95, 0.99, 0.999},
 	})
 }
 
 // GraphiteWithConfig is a blocking exporter function just like Graphite,
 // but it takes a GraphiteConfig instead.
 func GraphiteWithConfig(c GraphiteConfig) {
+	GraphiteWithConfigContext(context.Background(), c)
+}
+
+// GraphiteWithConfigContext is a blocking exporter function just like
+// GraphiteWithConfig, but it returns once ctx is done, interrupting any
+// flush in progress.  Each flush is bounded by c.FlushTimeout and those
+// which time out are counted by FlushTimeouts in c.Registry.
+func GraphiteWithConfigContext(ctx context.Context, c GraphiteConfig) {
 	log.Printf("WARNING: This go-metrics client has been DEPRECATED! It has been moved to https://github.com/cyberdelia/go-metrics-graphite and will be removed from rcrowley/go-metrics on August 12th 2015")
-	for _ = range time.Tick(c.FlushInterval) {
-		if err := graphite(&c); nil != err {
-			log.Println(err)
-		}
-	}
+	runSchedules(ctx, "graphite", c.Registry, c.FlushInterval, c.FlushTimeout, c.Schedules, func(ctx context.Context, r Registry) error {
+		scheduled := c
+		scheduled.Registry = r
+		return graphite(ctx, &scheduled)
+	})
 }
 
 // GraphiteOnce performs a single submission to Graphite, returning a
 // non-nil error on failed connections. This can be used in a loop
 // similar to GraphiteWithConfig for custom error handling.
 func GraphiteOnce(c GraphiteConfig) error {
+	return GraphiteOnceContext(context.Background(), c)
+}
+
+// GraphiteOnceContext performs a single submission to Graphite just like
+// GraphiteOnce, but abandons it when ctx is done.
+func GraphiteOnceContext(ctx context.Context, c GraphiteConfig) error {
 	log.Printf("WARNING: This go-metrics client has been DEPRECATED! It has been moved to https://github.com/cyberdelia/go-metrics-graphite and will be removed from rcrowley/go-metrics on August 12th 2015")
-	return graphite(&c)
+	return graphite(ctx, &c)
 }
 
-func graphite(c *GraphiteConfig) error {
+func graphite(ctx context.Context, c *GraphiteConfig) error {
 	now := time.Now().Unix()
 	du := float64(c.DurationUnit)
-	conn, err := net.DialTCP("tcp", nil, c.Addr)
+	policy := valuePolicy(c.ValuePolicy)
+	var (
+		conn      io.Writer
+		closeConn func()
+		err       error
+		packets   *packetWriter
+		batch     *bytes.Buffer
+	)
+	switch {
+	case nil != c.UDPAddr && nil == c.DryRun:
+		packets, closeConn, err = dialPacketContext(ctx, c.UDPAddr, c.MaxPacketSize)
+		conn = packets
+	case c.Pickle || 0 < c.Retries:
+		batch = new(bytes.Buffer)
+		conn, closeConn = batch, func() {}
+	default:
+		conn, closeConn, err = openFlush(ctx, c.Addr, c.TLSConfig, c.Dialer, c.DryRun)
+	}
 	if nil != err {
 		return err
 	}
-	defer conn.Close()
+	defer closeConn()
 	w := bufio.NewWriter(conn)
-	c.Registry.Each(func(name string, i interface{}) {
+	out, sum := checksum(w, c.Checksum)
+	err = encodeConcurrently(out, c.Changes.each(c.Restricted.registry(c.Registry)), c.Concurrency, func(w io.Writer, name string, i interface{}) {
+		path, tags := graphiteTaggedPath(name)
+		putInt := func(key string, v int64) {
+			if v, ok := policy.Int(v); ok {
+				fmt.Fprintf(w, "%s.%s.%s%s %d %d\n", c.Prefix, path, key, tags, v, now)
+			}
+		}
+		putFloat := func(key, format string, v float64) {
+			if v, ok := policy.Float(v); ok {
+				fmt.Fprintf(w, "%s.%s.%s%s %s %d\n", c.Prefix, path, key, tags, c.FloatFormat.format(format, v), now)
+			}
+		}
 		switch metric := i.(type) {
 		case Counter:
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, metric.Count(), now)
+			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, path, tags, metric.Count(), now)
+		case CounterFloat64:
+			putFloat("count", "%f", metric.Count())
 		case Gauge:
-			fmt.Fprintf(w, "%s.%s.value %d %d\n", c.Prefix, name, metric.Value(), now)
+			putInt("value", metric.Value())
 		case GaugeFloat64:
-			fmt.Fprintf(w, "%s.%s.value %f %d\n", c.Prefix, name, metric.Value(), now)
+			putFloat("value", "%f", metric.Value())
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles(c.Percentiles)
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, h.Count(), now)
-			fmt.Fprintf(w, "%s.%s.min %d %d\n", c.Prefix, name, h.Min(), now)
-			fmt.Fprintf(w, "%s.%s.max %d %d\n", c.Prefix, name, h.Max(), now)
-			fmt.Fprintf(w, "%s.%s.mean %.2f %d\n", c.Prefix, name, h.Mean(), now)
-			fmt.Fprintf(w, "%s.%s.std-dev %.2f %d\n", c.Prefix, name, h.StdDev(), now)
-			for psIdx, psKey := range c.Percentiles {
+			percentiles := c.Downsampling.percentiles(exportedPercentiles(c.Registry, i, c.Percentiles))
+			ps := h.Percentiles(percentiles)
+			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, path, tags, h.Count(), now)
+			putInt("sum", h.Sum())
+			putInt("min", h.Min())
+			putInt("max", h.Max())
+			putFloat("mean", "%.2f", h.Mean())
+			putFloat("std-dev", "%.2f", h.StdDev())
+			for psIdx, psKey := range percentiles {
 				key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-				fmt.Fprintf(w, "%s.%s.%s-percentile %.2f %d\n", c.Prefix, name, key, ps[psIdx], now)
+				putFloat(key+"-percentile", "%.2f", ps[psIdx])
 			}
+		case DurationHistogram:
+			h := metric.Snapshot()
+			percentiles := c.Downsampling.percentiles(exportedPercentiles(c.Registry, i, c.Percentiles))
+			ps := h.Percentiles(percentiles)
+			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, path, tags, h.Count(), now)
+			putFloat("sum", "%.2f", float64(h.Sum())/du)
+			putInt("min", int64(h.Min())/int64(du))
+			putInt("max", int64(h.Max())/int64(du))
+			putFloat("mean", "%.2f", float64(h.Mean())/du)
+			putFloat("std-dev", "%.2f", float64(h.StdDev())/du)
+			for psIdx, psKey := range percentiles {
+				key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
+				putFloat(key+"-percentile", "%.2f", float64(ps[psIdx])/du)
+			}
+		case Histogram2D:
+			h := c.Downsampling.histogram2D(metric)
+			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, path, tags, h.Count(), now)
+			eachHistogram2DCell(h, func(x, y string, count int64) {
+				fmt.Fprintf(w, "%s.%s.x-%s.y-%s%s %d %d\n", c.Prefix, path, x, y, tags, count, now)
+			})
 		case Meter:
 			m := metric.Snapshot()
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, m.Count(), now)
-			fmt.Fprintf(w, "%s.%s.one-minute %.2f %d\n", c.Prefix, name, m.Rate1(), now)
-			fmt.Fprintf(w, "%s.%s.five-minute %.2f %d\n", c.Prefix, name, m.Rate5(), now)
-			fmt.Fprintf(w, "%s.%s.fifteen-minute %.2f %d\n", c.Prefix, name, m.Rate15(), now)
-			fmt.Fprintf(w, "%s.%s.mean %.2f %d\n", c.Prefix, name, m.RateMean(), now)
+			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, path, tags, m.Count(), now)
+			fmt.Fprintf(w, "%s.%s.one-minute%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", m.Rate1()), now)
+			fmt.Fprintf(w, "%s.%s.five-minute%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", m.Rate5()), now)
+			fmt.Fprintf(w, "%s.%s.fifteen-minute%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", m.Rate15()), now)
+			fmt.Fprintf(w, "%s.%s.mean%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", m.RateMean()), now)
+		case Summary:
+			s := metric.Snapshot()
+			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, path, tags, s.Count(), now)
+			putFloat("sum", "%.2f", s.Sum())
+			qs := s.Quantiles()
+			for qsIdx, qsKey := range s.Objectives() {
+				key := strings.Replace(strconv.FormatFloat(qsKey*100.0, 'f', -1, 64), ".", "", 1)
+				putFloat(key+"-percentile", "%.2f", qs[qsIdx])
+			}
+		case StagedTimer:
+			eachStage(metric.Snapshot(), func(stage string, h DurationHistogram) {
+				tag := ";stage=" + GraphiteName(stage)
+				percentiles := c.Downsampling.percentiles(exportedPercentiles(c.Registry, h, c.Percentiles))
+				ps := h.Percentiles(percentiles)
+				fmt.Fprintf(w, "%s.%s.count%s%s %d %d\n", c.Prefix, path, tag, tags, h.Count(), now)
+				putFloat("sum"+tag, "%.2f", float64(h.Sum())/du)
+				putInt("min"+tag, int64(h.Min())/int64(du))
+				putInt("max"+tag, int64(h.Max())/int64(du))
+				putFloat("mean"+tag, "%.2f", float64(h.Mean())/du)
+				putFloat("std-dev"+tag, "%.2f", float64(h.StdDev())/du)
+				for psIdx, psKey := range percentiles {
+					key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
+					putFloat(key+"-percentile"+tag, "%.2f", float64(ps[psIdx])/du)
+				}
+			})
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles(c.Percentiles)
-			fmt.Fprintf(w, "%s.%s.count %d %d\n", c.Prefix, name, t.Count(), now)
-			fmt.Fprintf(w, "%s.%s.min %d %d\n", c.Prefix, name, t.Min()/int64(du), now)
-			fmt.Fprintf(w, "%s.%s.max %d %d\n", c.Prefix, name, t.Max()/int64(du), now)
-			fmt.Fprintf(w, "%s.%s.mean %.2f %d\n", c.Prefix, name, t.Mean()/du, now)
-			fmt.Fprintf(w, "%s.%s.std-dev %.2f %d\n", c.Prefix, name, t.StdDev()/du, now)
-			for psIdx, psKey := range c.Percentiles {
+			percentiles := c.Downsampling.percentiles(exportedPercentiles(c.Registry, i, c.Percentiles))
+			ps := t.Percentiles(percentiles)
+			fmt.Fprintf(w, "%s.%s.count%s %d %d\n", c.Prefix, path, tags, t.Count(), now)
+			putFloat("sum", "%.2f", float64(t.Sum())/du)
+			putInt("min", t.Min()/int64(du))
+			putInt("max", t.Max()/int64(du))
+			putFloat("mean", "%.2f", t.Mean()/du)
+			putFloat("std-dev", "%.2f", t.StdDev()/du)
+			for psIdx, psKey := range percentiles {
 				key := strings.Replace(strconv.FormatFloat(psKey*100.0, 'f', -1, 64), ".", "", 1)
-				fmt.Fprintf(w, "%s.%s.%s-percentile %.2f %d\n", c.Prefix, name, key, ps[psIdx], now)
+				putFloat(key+"-percentile", "%.2f", ps[psIdx])
+			}
+			fmt.Fprintf(w, "%s.%s.one-minute%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", t.Rate1()), now)
+			fmt.Fprintf(w, "%s.%s.five-minute%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", t.Rate5()), now)
+			fmt.Fprintf(w, "%s.%s.fifteen-minute%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", t.Rate15()), now)
+			fmt.Fprintf(w, "%s.%s.mean-rate%s %s %d\n", c.Prefix, path, tags, c.FloatFormat.format("%.2f", t.RateMean()), now)
+			if min, max, ok := resetInterval(c.IntervalExtremes, i); ok {
+				putInt("interval-min", min/int64(du))
+				putInt("interval-max", max/int64(du))
 			}
-			fmt.Fprintf(w, "%s.%s.one-minute %.2f %d\n", c.Prefix, name, t.Rate1(), now)
-			fmt.Fprintf(w, "%s.%s.five-minute %.2f %d\n", c.Prefix, name, t.Rate5(), now)
-			fmt.Fprintf(w, "%s.%s.fifteen-minute %.2f %d\n", c.Prefix, name, t.Rate15(), now)
-			fmt.Fprintf(w, "%s.%s.mean-rate %.2f %d\n", c.Prefix, name, t.RateMean(), now)
 		}
-		w.Flush()
 	})
-	return nil
+	if nil != err {
+		return err
+	}
+	if nil != sum {
+		fmt.Fprintf(w, "%s.flush.lines %d %d\n", c.Prefix, sum.lines, now)
+		fmt.Fprintf(w, "%s.flush.crc32 %d %d\n", c.Prefix, sum.crc, now)
+	}
+	if err := w.Flush(); nil != err {
+		return err
+	}
+	if nil != batch {
+		return sendGraphite(ctx, c, batch.Bytes())
+	}
+	if nil == packets {
+		return nil
+	}
+	return packets.Flush()
+}
+
+// sendGraphite sends the lines of a flush, pickled if c.Pickle is set, and
+// sends them again over a new connection as many as c.Retries times if
+// connecting or writing fails.
+func sendGraphite(ctx context.Context, c *GraphiteConfig, lines []byte) error {
+	payload := lines
+	if c.Pickle {
+		payload = graphitePickle(lines)
+	}
+	backoff := c.RetryBackoff
+	if 0 == backoff {
+		backoff = 100 * time.Millisecond
+	}
+	for attempt := 0; ; attempt++ {
+		err := sendGraphiteOnce(ctx, c, payload)
+		if nil == err || c.Retries <= attempt || nil != ctx.Err() {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+func sendGraphiteOnce(ctx context.Context, c *GraphiteConfig, payload []byte) error {
+	conn, closeConn, err := openFlush(ctx, c.Addr, c.TLSConfig, c.Dialer, c.DryRun)
+	if nil != err {
+		return err
+	}
+	defer closeConn()
+	_, err = conn.Write(payload)
+	return err
+}
+
+// graphitePickleBatch is the most metrics in one pickled message, which
+// keeps messages well within carbon's limit of a megabyte.
+const graphitePickleBatch = 500
+
+// graphitePickle converts lines of the plaintext protocol to messages of the
+// pickle protocol, each a four-byte big-endian length followed by a list of
+// (path, (timestamp, value)) tuples pickled with protocol 2.  Lines which
+// don't parse are dropped.
+func graphitePickle(lines []byte) []byte {
+	var out, msg []byte
+	n := 0
+	send := func() {
+		msg = append(msg, 'e', '.') // APPENDS, STOP
+		out = binary.BigEndian.AppendUint32(out, uint32(len(msg)))
+		out = append(out, msg...)
+		msg, n = nil, 0
+	}
+	for _, line := range strings.Split(string(lines), "\n") {
+		fields := strings.Fields(line)
+		if 3 != len(fields) {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if nil != err {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+		if nil != err {
+			continue
+		}
+		if 0 == n {
+			msg = append(msg, 0x80, 2, ']', '(') // PROTO 2, EMPTY_LIST, MARK
+		}
+		msg = append(msg, 'X') // BINUNICODE
+		msg = binary.LittleEndian.AppendUint32(msg, uint32(len(fields[0])))
+		msg = append(msg, fields[0]...)
+		if math.MinInt32 <= timestamp && timestamp <= math.MaxInt32 {
+			msg = append(msg, 'J') // BININT
+			msg = binary.LittleEndian.AppendUint32(msg, uint32(int32(timestamp)))
+		} else {
+			msg = append(msg, 'G') // BINFLOAT
+			msg = binary.BigEndian.AppendUint64(msg, math.Float64bits(float64(timestamp)))
+		}
+		msg = append(msg, 'G') // BINFLOAT
+		msg = binary.BigEndian.AppendUint64(msg, math.Float64bits(value))
+		msg = append(msg, 0x86, 0x86) // TUPLE2, TUPLE2
+		if n++; graphitePickleBatch == n {
+			send()
+		}
+	}
+	if 0 < n {
+		send()
+	}
+	return out
+}
+
+// graphiteTaggedPath returns the path of a name, as it has always been sent,
+// and, if it was made by TaggedName, its tags in the ";k=v" form which
+// follows a tagged series' path.  Both are cached by DefaultNameTable.
+func graphiteTaggedPath(name string) (path, tags string) {
+	n := DefaultNameTable.lookup(name)
+	return n.graphitePath, n.graphiteTags
 }
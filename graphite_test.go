@@ -1,7 +1,21 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"math"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
 	"time"
 )
 
@@ -20,3 +34,302 @@ func ExampleGraphiteWithConfig() {
 		Percentiles:   []float64{0.5, 0.75, 0.99, 0.999},
 	})
 }
+
+func TestGraphiteOnceTags(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	out := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if nil != err {
+			out <- err.Error()
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		out <- string(b)
+	}()
+	r := NewRegistry()
+	NewRegisteredCounter(TaggedName("requests", map[string]string{"status": "200"}), r).Inc(47)
+	if err := GraphiteOnce(GraphiteConfig{
+		Addr:         ln.Addr().(*net.TCPAddr),
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := <-out; !strings.HasPrefix(s, "prefix.requests.count;status=200 47 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
+
+func TestGraphiteOnceDryRun(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.HasPrefix(s, "prefix.requests.count 47 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
+
+func TestGraphiteOnceNameUnchanged(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests from\tclients", r).Inc(47)
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.HasPrefix(s, "prefix.requests from\tclients.count 47 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
+
+func TestGraphiteOnceSum(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredHistogram("latency", r, NewUniformSample(2))
+	for i := 1; i <= 10; i++ {
+		h.Update(int64(i))
+	}
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, "prefix.latency.count 10 ") || !strings.Contains(s, "prefix.latency.sum 55 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
+
+func TestGraphiteOnceIntervalExtremes(t *testing.T) {
+	r := NewRegistry()
+	tm := NewRegisteredTimer("latency", r)
+	tm.Update(2 * time.Millisecond)
+	tm.Update(7 * time.Millisecond)
+	c := GraphiteConfig{
+		Registry:         r,
+		DurationUnit:     time.Millisecond,
+		Prefix:           "prefix",
+		IntervalExtremes: true,
+	}
+	var buf bytes.Buffer
+	c.DryRun = &buf
+	if err := GraphiteOnce(c); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, "prefix.latency.interval-min 2 ") || !strings.Contains(s, "prefix.latency.interval-max 7 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+	buf.Reset()
+	if err := GraphiteOnce(c); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); strings.Contains(s, "interval-max") {
+		t.Errorf("graphite: %q, expected no interval extremes without new durations\n", s)
+	}
+}
+
+func TestGraphiteOncePercentiles(t *testing.T) {
+	r := NewRegistry()
+	r.(*StandardRegistry).SetPercentiles([]float64{0.5, 0.999})
+	NewRegisteredHistogram("size", r, NewUniformSample(100)).Update(47)
+	h := NewRegisteredHistogram("latency", r, NewUniformSample(100)).(*StandardHistogram)
+	h.SetPercentiles([]float64{0.9999})
+	h.Update(47)
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	if !strings.Contains(s, "prefix.size.50-percentile 47.00 ") || !strings.Contains(s, "prefix.size.999-percentile 47.00 ") || strings.Contains(s, "prefix.size.99-percentile ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+	if !strings.Contains(s, "prefix.latency.9999-percentile 47.00 ") || strings.Contains(s, "prefix.latency.50-percentile ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
+
+func TestGraphiteOnceChecksum(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	NewRegisteredGauge("goroutines", r).Update(7)
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+		Checksum:     true,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(buf.String(), "\n")
+	if 5 != len(lines) || "" != lines[4] {
+		t.Fatalf("graphite: %q\n", buf.String())
+	}
+	batch := lines[0] + lines[1]
+	if !strings.HasPrefix(lines[2], "prefix.flush.lines 2 ") {
+		t.Errorf("lines[2]: %q\n", lines[2])
+	}
+	if crc := fmt.Sprintf("prefix.flush.crc32 %d ", crc32.ChecksumIEEE([]byte(batch))); !strings.HasPrefix(lines[3], crc) {
+		t.Errorf("lines[3]: %q != %q\n", lines[3], crc)
+	}
+}
+
+func TestGraphiteOncePickle(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+		Pickle:       true,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if len(b) < 4 || int(binary.BigEndian.Uint32(b)) != len(b)-4 {
+		t.Fatalf("graphite: %q\n", b)
+	}
+	ts := binary.LittleEndian.Uint32(b[4+4+1+4+len("prefix.requests.count")+1:])
+	want := []byte("\x80\x02](X\x15\x00\x00\x00prefix.requests.countJ")
+	want = binary.LittleEndian.AppendUint32(want, ts)
+	want = append(want, 'G')
+	want = binary.BigEndian.AppendUint64(want, math.Float64bits(47))
+	want = append(want, "\x86\x86e."...)
+	if !bytes.Equal(b[4:], want) {
+		t.Errorf("graphite: %q != %q\n", b[4:], want)
+	}
+	if now := time.Now().Unix(); now-int64(ts) < 0 || 60 < now-int64(ts) {
+		t.Errorf("timestamp: %d\n", ts)
+	}
+}
+
+func TestGraphitePickleBatches(t *testing.T) {
+	var lines bytes.Buffer
+	for i := 0; i < graphitePickleBatch+1; i++ {
+		fmt.Fprintf(&lines, "m%d %d 1500000000\n", i, i)
+	}
+	fmt.Fprintf(&lines, "unparsed line\n")
+	b := graphitePickle(lines.Bytes())
+	var sizes []int
+	for 0 < len(b) {
+		n := int(binary.BigEndian.Uint32(b))
+		sizes = append(sizes, n)
+		if !bytes.HasPrefix(b[4:], []byte("\x80\x02](")) || !bytes.HasSuffix(b[4:4+n], []byte("e.")) {
+			t.Fatalf("message %d: %q\n", len(sizes), b[4:4+n])
+		}
+		b = b[4+n:]
+	}
+	if 2 != len(sizes) {
+		t.Fatalf("messages: %v\n", sizes)
+	}
+	// PROTO 2, EMPTY_LIST, MARK, the one tuple, APPENDS, STOP.
+	if n := 4 + (1 + 4 + len("m500")) + (1 + 4) + (1 + 8) + 2 + 2; n != sizes[1] {
+		t.Errorf("last message: %d bytes, want %d\n", sizes[1], n)
+	}
+}
+
+// failingWriter fails its first n writes.
+type failingWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if 0 < w.n {
+		w.n--
+		return 0, fmt.Errorf("connection reset")
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestGraphiteOnceRetries(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	w := &failingWriter{n: 2}
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       w,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := w.String(); !strings.HasPrefix(s, "prefix.requests.count 47 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+
+	w = &failingWriter{n: 2}
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		DryRun:       w,
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+	}); nil == err {
+		t.Errorf("graphite: no error once retries are exhausted\n")
+	}
+}
+
+func TestGraphiteOnceTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srv.TLS)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	out := make(chan string)
+	go func() {
+		conn, err := ln.Accept()
+		if nil != err {
+			out <- err.Error()
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		out <- string(b)
+	}()
+	r := NewRegistry()
+	NewRegisteredCounter("requests", r).Inc(47)
+	if err := GraphiteOnce(GraphiteConfig{
+		Addr:         ln.Addr().(*net.TCPAddr),
+		TLSConfig:    srv.Client().Transport.(*http.Transport).TLSClientConfig,
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := <-out; !strings.HasPrefix(s, "prefix.requests.count 47 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
@@ -0,0 +1,445 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// GetOrRegisterHdrHistogram returns an existing Histogram or constructs and
+// registers a new one backed by an HdrSample as by NewHdrHistogram.
+func GetOrRegisterHdrHistogram(name string, r Registry, min, max int64, sigfigs int) Histogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() Histogram {
+		return NewHdrHistogram(min, max, sigfigs)
+	}).(Histogram)
+}
+
+// NewHdrHistogram constructs a new StandardHistogram backed by an HdrSample
+// which tracks values between min and max to sigfigs significant figures,
+// as an alternative to the sampled histograms for recording latencies at
+// high rates: every value is counted, so the tail percentiles, p99.9 and
+// beyond, are as accurate as the rest and aren't biased by which values a
+// reservoir happened to keep or decay.
+func NewHdrHistogram(min, max int64, sigfigs int) Histogram {
+	return NewHistogram(NewHdrSample(min, max, sigfigs))
+}
+
+// NewRegisteredHdrHistogram constructs and registers a new Histogram backed
+// by an HdrSample as by NewHdrHistogram.
+func NewRegisteredHdrHistogram(name string, r Registry, min, max int64, sigfigs int) Histogram {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	h := NewHdrHistogram(min, max, sigfigs)
+	r.Register(name, h)
+	return h
+}
+
+// HdrSample is a Sample which counts every value in one of a fixed set of
+// buckets, as Gil Tene's HdrHistogram does, rather than keeping a reservoir
+// of some of them.  The buckets are spaced so that each is narrower than the
+// values in it to the given number of significant figures, so its memory is
+// bounded by the range and precision it's constructed with, not by the
+// number of values: tracking nanoseconds from 1 to an hour to 3 significant
+// figures takes about 256KiB.
+//
+// Count, Max, Mean, Min, and Sum are exact.  Percentiles are the highest
+// value of the bucket in which they fall, so they're never understated and
+// are within the precision of the truth, and they don't depend on
+// DefaultInterpolation.  Values below 0 are counted as 0 and those above the
+// maximum as the maximum, although Max and Min still report them.  Values
+// returns as many evenly spaced percentiles as DefaultSampleConfig's
+// reservoir holds values, so that an HdrSample is pooled with the samples of
+// other histograms in proportion to theirs.
+type HdrSample struct {
+	mutex sync.Mutex
+	hdrCounts
+}
+
+// NewHdrSample constructs a new HdrSample which tracks values between min,
+// which must be at least 1, and max, which must be at least twice min, to
+// sigfigs significant figures, from 1 to 5.  It panics if they're invalid.
+func NewHdrSample(min, max int64, sigfigs int) Sample {
+	if min < 1 || max < 2*min || sigfigs < 1 || 5 < sigfigs {
+		panic(fmt.Sprintf("metrics: invalid HdrSample range [%d, %d] to %d significant figures", min, max, sigfigs))
+	}
+	if metricsDisabled || UseNilMetrics {
+		return NilSample{}
+	}
+	l := newHdrLayout(min, max, sigfigs)
+	return &HdrSample{hdrCounts: hdrCounts{layout: l, counts: make([]int64, l.countsLen)}}
+}
+
+// Clear clears all counts.
+func (s *HdrSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count, s.max, s.min, s.sum = 0, 0, 0, 0
+	for i := range s.counts {
+		s.counts[i] = 0
+	}
+}
+
+// Count returns the number of values recorded.
+func (s *HdrSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value recorded.
+func (s *HdrSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.max
+}
+
+// Mean returns the mean of the values recorded.
+func (s *HdrSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.mean()
+}
+
+// Min returns the minimum value recorded.
+func (s *HdrSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.min
+}
+
+// Percentile returns an arbitrary percentile of the values recorded.
+func (s *HdrSample) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values
+// recorded.
+func (s *HdrSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.percentiles(ps)
+}
+
+// Size returns the number of values returned by Values.
+func (s *HdrSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.size()
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *HdrSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c := s.hdrCounts
+	c.counts = make([]int64, len(s.counts))
+	copy(c.counts, s.counts)
+	return &HdrSampleSnapshot{c}
+}
+
+// StdDev returns the standard deviation of the values recorded, each taken
+// as the middle of its bucket.
+func (s *HdrSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return math.Sqrt(s.variance())
+}
+
+// String formats the statistics of the values recorded for debugging.
+func (s *HdrSample) String() string { return sampleString(s) }
+
+// Sum returns the sum of the values recorded.
+func (s *HdrSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
+// Update counts a new value.
+func (s *HdrSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.update(v, 1)
+}
+
+// UpdateWeighted counts a new value as weight values, rounded to the nearest
+// whole number, such as a pre-aggregated value imported from another system.
+// Non-positive weights are ignored.
+func (s *HdrSample) UpdateWeighted(v int64, weight float64) {
+	if !validWeight(weight) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.update(v, weightCount(weight))
+}
+
+// Values returns evenly spaced percentiles of the values recorded.
+func (s *HdrSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.values()
+}
+
+// Variance returns the variance of the values recorded, each taken as the
+// middle of its bucket.
+func (s *HdrSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.variance()
+}
+
+// HdrSampleSnapshot is a read-only copy of an HdrSample.
+type HdrSampleSnapshot struct {
+	hdrCounts
+}
+
+// Clear panics.
+func (*HdrSampleSnapshot) Clear() {
+	panic("Clear called on an HdrSampleSnapshot")
+}
+
+// Count returns the number of values recorded at the time the snapshot was
+// taken.
+func (s *HdrSampleSnapshot) Count() int64 { return s.count }
+
+// GoString formats the statistics of the snapshot for %#v.
+func (s *HdrSampleSnapshot) GoString() string { return goString("HdrSampleSnapshot", sampleString(s)) }
+
+// Max returns the maximum value recorded at the time the snapshot was taken.
+func (s *HdrSampleSnapshot) Max() int64 { return s.max }
+
+// Mean returns the mean of the values recorded at the time the snapshot was
+// taken.
+func (s *HdrSampleSnapshot) Mean() float64 { return s.mean() }
+
+// Min returns the minimum value recorded at the time the snapshot was taken.
+func (s *HdrSampleSnapshot) Min() int64 { return s.min }
+
+// Percentile returns an arbitrary percentile of the values recorded at the
+// time the snapshot was taken.
+func (s *HdrSampleSnapshot) Percentile(p float64) float64 {
+	return s.percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values recorded
+// at the time the snapshot was taken.
+func (s *HdrSampleSnapshot) Percentiles(ps []float64) []float64 {
+	return s.percentiles(ps)
+}
+
+// Size returns the number of values returned by Values.
+func (s *HdrSampleSnapshot) Size() int { return s.size() }
+
+// Snapshot returns the snapshot.
+func (s *HdrSampleSnapshot) Snapshot() Sample { return s }
+
+// StdDev returns the standard deviation of the values recorded at the time
+// the snapshot was taken.
+func (s *HdrSampleSnapshot) StdDev() float64 { return math.Sqrt(s.variance()) }
+
+// String formats the statistics of the values recorded for debugging.
+func (s *HdrSampleSnapshot) String() string { return sampleString(s) }
+
+// Sum returns the sum of the values recorded at the time the snapshot was
+// taken.
+func (s *HdrSampleSnapshot) Sum() int64 { return s.sum }
+
+// Update panics.
+func (*HdrSampleSnapshot) Update(int64) {
+	panic("Update called on an HdrSampleSnapshot")
+}
+
+// UpdateWeighted panics.
+func (*HdrSampleSnapshot) UpdateWeighted(int64, float64) {
+	panic("UpdateWeighted called on an HdrSampleSnapshot")
+}
+
+// Values returns evenly spaced percentiles of the values recorded at the
+// time the snapshot was taken.
+func (s *HdrSampleSnapshot) Values() []int64 { return s.values() }
+
+// Variance returns the variance of the values recorded at the time the
+// snapshot was taken.
+func (s *HdrSampleSnapshot) Variance() float64 { return s.variance() }
+
+// hdrCounts is the state shared by an HdrSample and its snapshots.
+type hdrCounts struct {
+	count, max, min, sum int64
+	counts               []int64
+	layout               *hdrLayout
+}
+
+func (c *hdrCounts) mean() float64 {
+	if 0 == c.count {
+		return 0.0
+	}
+	return float64(c.sum) / float64(c.count)
+}
+
+// percentiles returns the highest value of the bucket in which each
+// percentile falls, bounded by the exact extremes.
+func (c *hdrCounts) percentiles(ps []float64) []float64 {
+	scores := make([]float64, len(ps))
+	if 0 == c.count {
+		return scores
+	}
+	for j, p := range ps {
+		if p <= 0 {
+			scores[j] = float64(c.min)
+			continue
+		}
+		rank := int64(math.Ceil(p * float64(c.count)))
+		if rank > c.count {
+			rank = c.count
+		}
+		var seen int64
+		for i, n := range c.counts {
+			if seen += n; seen >= rank {
+				v := c.layout.highestEquivalent(i)
+				if v > c.max {
+					v = c.max
+				} else if v < c.min {
+					v = c.min
+				}
+				scores[j] = float64(v)
+				break
+			}
+		}
+	}
+	return scores
+}
+
+func (c *hdrCounts) size() int {
+	if c.count < defaultSampleSize {
+		return int(c.count)
+	}
+	return defaultSampleSize
+}
+
+func (c *hdrCounts) update(v, n int64) {
+	if 0 == c.count || v > c.max {
+		c.max = v
+	}
+	if 0 == c.count || v < c.min {
+		c.min = v
+	}
+	c.count += n
+	c.sum += v * n
+	if v < 0 {
+		v = 0
+	} else if v > c.layout.highest {
+		v = c.layout.highest
+	}
+	c.counts[c.layout.index(v)] += n
+}
+
+func (c *hdrCounts) values() []int64 {
+	n := c.size()
+	ps := make([]float64, n)
+	for i := range ps {
+		ps[i] = (float64(i) + 0.5) / float64(n)
+	}
+	values := make([]int64, n)
+	for i, v := range c.percentiles(ps) {
+		values[i] = int64(v)
+	}
+	return values
+}
+
+func (c *hdrCounts) variance() float64 {
+	if 0 == c.count {
+		return 0.0
+	}
+	m := c.mean()
+	var sum float64
+	for i, n := range c.counts {
+		if 0 != n {
+			d := float64(c.layout.middleEquivalent(i)) - m
+			sum += d * d * float64(n)
+		}
+	}
+	return sum / float64(c.count)
+}
+
+// hdrLayout maps values to buckets: the first holds subBucketCount values at
+// unit resolution and each after it subBucketHalfCount values, twice as wide
+// as those of the one before, so that each is narrower than its values to
+// the requested precision.
+type hdrLayout struct {
+	countsLen                   int
+	highest                     int64
+	subBucketHalfCount          int64
+	subBucketHalfCountMagnitude uint
+	subBucketMask               int64
+	unitMagnitude               uint
+}
+
+func newHdrLayout(lowest, highest int64, sigfigs int) *hdrLayout {
+	largest := 2 * int64(math.Pow10(sigfigs))
+	subBucketCountMagnitude := uint(bits.Len64(uint64(largest - 1)))
+	l := &hdrLayout{
+		highest:                     highest,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		unitMagnitude:               uint(bits.Len64(uint64(lowest)) - 1),
+	}
+	if 62 < l.unitMagnitude+subBucketCountMagnitude {
+		l.unitMagnitude = 62 - subBucketCountMagnitude
+	}
+	subBucketCount := int64(1) << subBucketCountMagnitude
+	l.subBucketHalfCount = subBucketCount / 2
+	l.subBucketMask = (subBucketCount - 1) << l.unitMagnitude
+	buckets := 1
+	for untrackable := subBucketCount << l.unitMagnitude; untrackable <= highest; untrackable <<= 1 {
+		buckets++
+		if untrackable > math.MaxInt64/2 {
+			break
+		}
+	}
+	l.countsLen = (buckets + 1) * int(l.subBucketHalfCount)
+	return l
+}
+
+// highestEquivalent returns the highest value counted at the given index.
+func (l *hdrLayout) highestEquivalent(i int) int64 {
+	return l.value(i) + l.width(i) - 1
+}
+
+// index returns the index at which the given value, from 0 to highest, is
+// counted.
+func (l *hdrLayout) index(v int64) int {
+	bucket := 63 - bits.LeadingZeros64(uint64(v|l.subBucketMask)) - int(l.unitMagnitude) - int(l.subBucketHalfCountMagnitude)
+	subBucket := v >> (uint(bucket) + l.unitMagnitude)
+	return int((int64(bucket+1) << l.subBucketHalfCountMagnitude) + subBucket - l.subBucketHalfCount)
+}
+
+// middleEquivalent returns the value in the middle of those counted at the
+// given index.
+func (l *hdrLayout) middleEquivalent(i int) int64 {
+	return l.value(i) + l.width(i)/2
+}
+
+// value returns the lowest value counted at the given index.
+func (l *hdrLayout) value(i int) int64 {
+	bucket := i>>l.subBucketHalfCountMagnitude - 1
+	subBucket := int64(i)&(l.subBucketHalfCount-1) + l.subBucketHalfCount
+	if bucket < 0 {
+		subBucket -= l.subBucketHalfCount
+		bucket = 0
+	}
+	return subBucket << (uint(bucket) + l.unitMagnitude)
+}
+
+// width returns the number of values counted at the given index.
+func (l *hdrLayout) width(i int) int64 {
+	bucket := i>>l.subBucketHalfCountMagnitude - 1
+	if bucket < 0 {
+		bucket = 0
+	}
+	return int64(1) << (uint(bucket) + l.unitMagnitude)
+}
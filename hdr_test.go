@@ -0,0 +1,134 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func BenchmarkHdrHistogram(b *testing.B) {
+	h := NewHdrHistogram(1, int64(time.Hour), 3)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Update(int64(i))
+	}
+}
+
+func TestGetOrRegisterHdrHistogram(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredHdrHistogram("foo", r, 1, 1000, 2).Update(47)
+	if h := GetOrRegisterHdrHistogram("foo", r, 1, 1000, 2); 1 != h.Count() {
+		t.Fatal(h)
+	}
+}
+
+func TestHdrHistogram(t *testing.T) {
+	h := NewHdrHistogram(1, int64(time.Hour), 3)
+	for i := 1; i <= 100000; i++ {
+		h.Update(int64(i))
+	}
+	if count := h.Count(); 100000 != count {
+		t.Errorf("h.Count(): 100000 != %v\n", count)
+	}
+	if min := h.Min(); 1 != min {
+		t.Errorf("h.Min(): 1 != %v\n", min)
+	}
+	if max := h.Max(); 100000 != max {
+		t.Errorf("h.Max(): 100000 != %v\n", max)
+	}
+	if sum := h.Sum(); 5000050000 != sum {
+		t.Errorf("h.Sum(): 5000050000 != %v\n", sum)
+	}
+	if mean := h.Mean(); 50000.5 != mean {
+		t.Errorf("h.Mean(): 50000.5 != %v\n", mean)
+	}
+	if stdDev := h.StdDev(); math.Abs(stdDev-28867.5) > 30 {
+		t.Errorf("h.StdDev(): 28867.5 != %v\n", stdDev)
+	}
+	expected := []float64{50000, 99000, 99900, 99990, 100000}
+	for i, p := range h.Percentiles([]float64{0.5, 0.99, 0.999, 0.9999, 1}) {
+		if p < expected[i] || p > expected[i]*1.001 {
+			t.Errorf("h.Percentiles()[%d]: %v != %v\n", i, expected[i], p)
+		}
+	}
+}
+
+func TestHdrHistogramClamped(t *testing.T) {
+	h := NewHdrHistogram(1, 1000, 2)
+	h.Update(-5)
+	h.Update(5000)
+	if min := h.Min(); -5 != min {
+		t.Errorf("h.Min(): -5 != %v\n", min)
+	}
+	if max := h.Max(); 5000 != max {
+		t.Errorf("h.Max(): 5000 != %v\n", max)
+	}
+	if p := h.Percentile(0.25); 0 != p {
+		t.Errorf("h.Percentile(0.25): 0 != %v\n", p)
+	}
+	if p := h.Percentile(1); p < 1000 || p > 1010 {
+		t.Errorf("h.Percentile(1): 1000 != %v\n", p)
+	}
+}
+
+func TestHdrHistogramSnapshot(t *testing.T) {
+	h := NewHdrHistogram(1, 1000000, 3)
+	h.Update(10)
+	h.UpdateWeighted(20, 3)
+	snapshot := h.Snapshot()
+	h.Update(1000)
+	if count := snapshot.Count(); 4 != count {
+		t.Errorf("snapshot.Count(): 4 != %v\n", count)
+	}
+	if sum := snapshot.Sum(); 70 != sum {
+		t.Errorf("snapshot.Sum(): 70 != %v\n", sum)
+	}
+	if max := snapshot.Max(); 20 != max {
+		t.Errorf("snapshot.Max(): 20 != %v\n", max)
+	}
+	if values := snapshot.Sample().Values(); 4 != len(values) || 10 != values[0] || 20 != values[3] {
+		t.Errorf("snapshot.Sample().Values(): [10 20 20 20] != %v\n", values)
+	}
+	h.Clear()
+	if count := h.Count(); 0 != count {
+		t.Errorf("h.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestHdrHistogramTimer(t *testing.T) {
+	tm := NewCustomTimer(NewHdrHistogram(1, int64(time.Minute), 3), NewMeter())
+	tm.Update(time.Millisecond)
+	if p := tm.Snapshot().Percentile(0.5); p < 1e6 || p > 1.001e6 {
+		t.Errorf("tm.Snapshot().Percentile(0.5): 1e6 != %v\n", p)
+	}
+}
+
+func TestHdrLayout(t *testing.T) {
+	for _, sigfigs := range []int{1, 3, 5} {
+		l := newHdrLayout(1, math.MaxInt64, sigfigs)
+		precision := math.Pow10(-sigfigs)
+		for v := int64(0); v < math.MaxInt64/3; v = v*3 + 1 {
+			i := l.index(v)
+			if lowest, highest := l.value(i), l.highestEquivalent(i); v < lowest || v > highest {
+				t.Errorf("%d significant figures: %d not in [%d, %d]\n", sigfigs, v, lowest, highest)
+			} else if float64(highest-lowest) > precision*float64(v) && highest != lowest {
+				t.Errorf("%d significant figures: [%d, %d] is too wide for %d\n", sigfigs, lowest, highest, v)
+			}
+			if i >= l.countsLen {
+				t.Errorf("%d significant figures: index %d >= %d\n", sigfigs, i, l.countsLen)
+			}
+		}
+	}
+}
+
+func TestNewHdrSampleInvalid(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Error("NewHdrSample(0, 100, 3) didn't panic")
+		}
+	}()
+	NewHdrSample(0, 100, 3)
+}
@@ -1,17 +1,14 @@
 package metrics
 
+import "github.com/rcrowley/go-metrics/metricsiface"
+
 // Healthchecks hold an error value describing an arbitrary up/down status.
-type Healthcheck interface {
-	Check()
-	Error() error
-	Healthy()
-	Unhealthy(error)
-}
+type Healthcheck = metricsiface.Healthcheck
 
 // NewHealthcheck constructs a new Healthcheck which will use the given
 // function to update its status.
 func NewHealthcheck(f func(Healthcheck)) Healthcheck {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
 		return NilHealthcheck{}
 	}
 	return &StandardHealthcheck{nil, f}
@@ -54,6 +51,9 @@ func (h *StandardHealthcheck) Healthy() {
 	h.err = nil
 }
 
+// String formats the error, if any, for debugging.
+func (h *StandardHealthcheck) String() string { return healthcheckString(h) }
+
 // Unhealthy marks the healthcheck as unhealthy.  The error is stored and
 // may be retrieved by the Error method.
 func (h *StandardHealthcheck) Unhealthy(err error) {
@@ -1,53 +1,52 @@
 package metrics
 
+import "github.com/rcrowley/go-metrics/metricsiface"
+
 // Histograms calculate distribution statistics from a series of int64 values.
-type Histogram interface {
-	Clear()
-	Count() int64
-	Max() int64
-	Mean() float64
-	Min() int64
-	Percentile(float64) float64
-	Percentiles([]float64) []float64
-	Sample() Sample
-	Snapshot() Histogram
-	StdDev() float64
-	Sum() int64
-	Update(int64)
-	Variance() float64
-}
+type Histogram = metricsiface.Histogram
 
 // GetOrRegisterHistogram returns an existing Histogram or constructs and
-// registers a new StandardHistogram.
+// registers a new StandardHistogram.  If s is nil the new histogram is given
+// a Sample as described by the registry's SampleConfig.
 func GetOrRegisterHistogram(name string, r Registry, s Sample) Histogram {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, func() Histogram { return NewHistogram(s) }).(Histogram)
+	return r.GetOrRegister(name, func() Histogram {
+		if nil == s {
+			s = r.SampleConfig().NewSample()
+		}
+		return NewHistogram(s)
+	}).(Histogram)
 }
 
 // NewHistogram constructs a new StandardHistogram from a Sample.
 func NewHistogram(s Sample) Histogram {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
 		return NilHistogram{}
 	}
-	return &StandardHistogram{sample: s}
+	return &StandardHistogram{HistogramOf[int64]{sample: s}}
 }
 
 // NewRegisteredHistogram constructs and registers a new StandardHistogram from
-// a Sample.
+// a Sample or, if s is nil, from a Sample as described by the registry's
+// SampleConfig.
 func NewRegisteredHistogram(name string, r Registry, s Sample) Histogram {
-	c := NewHistogram(s)
 	if nil == r {
 		r = DefaultRegistry
 	}
+	if nil == s {
+		s = r.SampleConfig().NewSample()
+	}
+	c := NewHistogram(s)
 	r.Register(name, c)
 	return c
 }
 
 // HistogramSnapshot is a read-only copy of another Histogram.
 type HistogramSnapshot struct {
-	sample *SampleSnapshot
+	percentiles []float64
+	sample      Sample
 }
 
 // Clear panics.
@@ -59,6 +58,15 @@ func (*HistogramSnapshot) Clear() {
 // taken.
 func (h *HistogramSnapshot) Count() int64 { return h.sample.Count() }
 
+// ExportedPercentiles returns the percentiles set for the histogram at the
+// time the snapshot was taken or nil if none had been.
+func (h *HistogramSnapshot) ExportedPercentiles() []float64 { return h.percentiles }
+
+// GoString formats the statistics of the snapshot for %#v.
+func (h *HistogramSnapshot) GoString() string {
+	return goString("HistogramSnapshot", histogramString(h))
+}
+
 // Max returns the maximum value in the sample at the time the snapshot was
 // taken.
 func (h *HistogramSnapshot) Max() int64 { return h.sample.Max() }
@@ -93,14 +101,24 @@ func (h *HistogramSnapshot) Snapshot() Histogram { return h }
 // time the snapshot was taken.
 func (h *HistogramSnapshot) StdDev() float64 { return h.sample.StdDev() }
 
-// Sum returns the sum in the sample at the time the snapshot was taken.
-func (h *HistogramSnapshot) Sum() int64 { return h.sample.Sum() }
+// String formats the count, sum, extremes, mean, standard deviation, and
+// percentiles for debugging.
+func (h *HistogramSnapshot) String() string { return histogramString(h) }
+
+// Sum returns the sum of every value recorded at the time the snapshot was
+// taken.
+func (h *HistogramSnapshot) Sum() int64 { return sampleTotalSum(h.sample) }
 
 // Update panics.
 func (*HistogramSnapshot) Update(int64) {
 	panic("Update called on a HistogramSnapshot")
 }
 
+// UpdateWeighted panics.
+func (*HistogramSnapshot) UpdateWeighted(int64, float64) {
+	panic("UpdateWeighted called on a HistogramSnapshot")
+}
+
 // Variance returns the variance of inputs at the time the snapshot was taken.
 func (h *HistogramSnapshot) Variance() float64 { return h.sample.Variance() }
 
@@ -145,58 +163,32 @@ func (NilHistogram) Sum() int64 { return 0 }
 // Update is a no-op.
 func (NilHistogram) Update(v int64) {}
 
+// UpdateWeighted is a no-op.
+func (NilHistogram) UpdateWeighted(v int64, weight float64) {}
+
 // Variance is a no-op.
 func (NilHistogram) Variance() float64 { return 0.0 }
 
-// StandardHistogram is the standard implementation of a Histogram and uses a
-// Sample to bound its memory use.
+// StandardHistogram is the standard implementation of a Histogram: a
+// HistogramOf[int64], which uses a Sample to bound its memory use.
 type StandardHistogram struct {
-	sample Sample
-}
-
-// Clear clears the histogram and its sample.
-func (h *StandardHistogram) Clear() { h.sample.Clear() }
-
-// Count returns the number of samples recorded since the histogram was last
-// cleared.
-func (h *StandardHistogram) Count() int64 { return h.sample.Count() }
-
-// Max returns the maximum value in the sample.
-func (h *StandardHistogram) Max() int64 { return h.sample.Max() }
-
-// Mean returns the mean of the values in the sample.
-func (h *StandardHistogram) Mean() float64 { return h.sample.Mean() }
-
-// Min returns the minimum value in the sample.
-func (h *StandardHistogram) Min() int64 { return h.sample.Min() }
-
-// Percentile returns an arbitrary percentile of the values in the sample.
-func (h *StandardHistogram) Percentile(p float64) float64 {
-	return h.sample.Percentile(p)
+	HistogramOf[int64]
 }
 
-// Percentiles returns a slice of arbitrary percentiles of the values in the
-// sample.
-func (h *StandardHistogram) Percentiles(ps []float64) []float64 {
-	return h.sample.Percentiles(ps)
-}
-
-// Sample returns the Sample underlying the histogram.
-func (h *StandardHistogram) Sample() Sample { return h.sample }
-
 // Snapshot returns a read-only copy of the histogram.
 func (h *StandardHistogram) Snapshot() Histogram {
-	return &HistogramSnapshot{sample: h.sample.Snapshot().(*SampleSnapshot)}
+	return &HistogramSnapshot{
+		percentiles: h.percentiles.load(),
+		sample:      h.sample.Snapshot(),
+	}
 }
 
-// StdDev returns the standard deviation of the values in the sample.
-func (h *StandardHistogram) StdDev() float64 { return h.sample.StdDev() }
+// String formats the count, sum, extremes, mean, standard deviation, and
+// percentiles for debugging.
+func (h *StandardHistogram) String() string { return histogramString(h) }
 
-// Sum returns the sum in the sample.
-func (h *StandardHistogram) Sum() int64 { return h.sample.Sum() }
-
-// Update samples a new value.
-func (h *StandardHistogram) Update(v int64) { h.sample.Update(v) }
-
-// Variance returns the variance of the values in the sample.
-func (h *StandardHistogram) Variance() float64 { return h.sample.Variance() }
+// UpdateWeighted samples a new value which stands for weight observations,
+// such as a pre-aggregated value imported from another system.
+func (h *StandardHistogram) UpdateWeighted(v int64, weight float64) {
+	h.sample.UpdateWeighted(v, weight)
+}
@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
+
+// Histogram2Ds count correlated pairs of int64 values, such as a request's
+// size and its latency, in a coarse grid of buckets so that the way one
+// varies with the other can be seen without tracing individual requests.
+//
+// Each axis is divided by a sorted slice of upper bounds.  A value falls in
+// the first bucket whose bound it does not exceed or, if it exceeds every
+// bound, in a final overflow bucket, so a grid with m x bounds and n y
+// bounds has (m+1)×(n+1) cells.
+type Histogram2D = metricsiface.Histogram2D
+
+// GetOrRegisterHistogram2D returns an existing Histogram2D or constructs and
+// registers a new StandardHistogram2D.
+func GetOrRegisterHistogram2D(name string, r Registry, xBounds, yBounds []int64) Histogram2D {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() Histogram2D {
+		return NewHistogram2D(xBounds, yBounds)
+	}).(Histogram2D)
+}
+
+// NewHistogram2D constructs a new StandardHistogram2D with the given bucket
+// bounds on each axis.  It panics if either slice of bounds is not sorted.
+func NewHistogram2D(xBounds, yBounds []int64) Histogram2D {
+	if metricsDisabled || UseNilMetrics {
+		return NilHistogram2D{}
+	}
+	if !sort.IsSorted(int64Slice(xBounds)) || !sort.IsSorted(int64Slice(yBounds)) {
+		panic(fmt.Sprintf("metrics: unsorted Histogram2D bounds %v, %v", xBounds, yBounds))
+	}
+	return &StandardHistogram2D{
+		xBounds: copyInt64s(xBounds),
+		yBounds: copyInt64s(yBounds),
+		counts:  make([]int64, (len(xBounds)+1)*(len(yBounds)+1)),
+	}
+}
+
+// NewRegisteredHistogram2D constructs and registers a new
+// StandardHistogram2D.
+func NewRegisteredHistogram2D(name string, r Registry, xBounds, yBounds []int64) Histogram2D {
+	c := NewHistogram2D(xBounds, yBounds)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// LinearBounds returns n bucket bounds beginning at start and width apart.
+func LinearBounds(start, width int64, n int) []int64 {
+	bounds := make([]int64, n)
+	for i := range bounds {
+		bounds[i] = start + int64(i)*width
+	}
+	return bounds
+}
+
+// ExponentialBounds returns n bucket bounds beginning at start, each factor
+// times the last, rounded to the nearest integer.
+func ExponentialBounds(start int64, factor float64, n int) []int64 {
+	bounds := make([]int64, n)
+	f := float64(start)
+	for i := range bounds {
+		bounds[i] = int64(math.Floor(f + 0.5))
+		f *= factor
+	}
+	return bounds
+}
+
+// Histogram2DSnapshot is a read-only copy of another Histogram2D.
+type Histogram2DSnapshot struct {
+	xBounds, yBounds []int64
+	count            int64
+	counts           [][]int64
+}
+
+// Clear panics.
+func (*Histogram2DSnapshot) Clear() {
+	panic("Clear called on a Histogram2DSnapshot")
+}
+
+// Count returns the number of pairs recorded at the time the snapshot was
+// taken.
+func (h *Histogram2DSnapshot) Count() int64 { return h.count }
+
+// Counts returns the number of pairs in each cell at the time the snapshot
+// was taken, indexed first by x bucket and then by y bucket.
+func (h *Histogram2DSnapshot) Counts() [][]int64 { return h.counts }
+
+// GoString formats the statistics of the snapshot for %#v.
+func (h *Histogram2DSnapshot) GoString() string {
+	return goString("Histogram2DSnapshot", histogram2DString(h))
+}
+
+// Snapshot returns the snapshot.
+func (h *Histogram2DSnapshot) Snapshot() Histogram2D { return h }
+
+// String formats the count, bounds, and cells for debugging.
+func (h *Histogram2DSnapshot) String() string { return histogram2DString(h) }
+
+// Update panics.
+func (*Histogram2DSnapshot) Update(int64, int64) {
+	panic("Update called on a Histogram2DSnapshot")
+}
+
+// XBounds returns the upper bounds of the x buckets.
+func (h *Histogram2DSnapshot) XBounds() []int64 { return h.xBounds }
+
+// YBounds returns the upper bounds of the y buckets.
+func (h *Histogram2DSnapshot) YBounds() []int64 { return h.yBounds }
+
+// NilHistogram2D is a no-op Histogram2D.
+type NilHistogram2D struct{}
+
+// Clear is a no-op.
+func (NilHistogram2D) Clear() {}
+
+// Count is a no-op.
+func (NilHistogram2D) Count() int64 { return 0 }
+
+// Counts is a no-op.
+func (NilHistogram2D) Counts() [][]int64 { return [][]int64{{0}} }
+
+// Snapshot is a no-op.
+func (NilHistogram2D) Snapshot() Histogram2D { return NilHistogram2D{} }
+
+// Update is a no-op.
+func (NilHistogram2D) Update(x, y int64) {}
+
+// XBounds is a no-op.
+func (NilHistogram2D) XBounds() []int64 { return []int64{} }
+
+// YBounds is a no-op.
+func (NilHistogram2D) YBounds() []int64 { return []int64{} }
+
+// StandardHistogram2D is the standard implementation of a Histogram2D and
+// uses atomic operations on a fixed grid of counts, so its memory use is
+// bounded by the number of buckets.
+type StandardHistogram2D struct {
+	xBounds, yBounds []int64
+	counts           []int64
+}
+
+// Clear sets every count to zero.
+func (h *StandardHistogram2D) Clear() {
+	for i := range h.counts {
+		atomic.StoreInt64(&h.counts[i], 0)
+	}
+}
+
+// Count returns the number of pairs recorded.
+func (h *StandardHistogram2D) Count() int64 {
+	var count int64
+	for i := range h.counts {
+		count += atomic.LoadInt64(&h.counts[i])
+	}
+	return count
+}
+
+// Counts returns the number of pairs in each cell, indexed first by x bucket
+// and then by y bucket.
+func (h *StandardHistogram2D) Counts() [][]int64 {
+	return h.Snapshot().Counts()
+}
+
+// Snapshot returns a read-only copy of the histogram.
+func (h *StandardHistogram2D) Snapshot() Histogram2D {
+	snapshot := &Histogram2DSnapshot{
+		xBounds: h.xBounds,
+		yBounds: h.yBounds,
+		counts:  make([][]int64, len(h.xBounds)+1),
+	}
+	columns := len(h.yBounds) + 1
+	for i := range snapshot.counts {
+		snapshot.counts[i] = make([]int64, columns)
+		for j := range snapshot.counts[i] {
+			c := atomic.LoadInt64(&h.counts[i*columns+j])
+			snapshot.counts[i][j] = c
+			snapshot.count += c
+		}
+	}
+	return snapshot
+}
+
+// String formats the count, bounds, and cells for debugging.
+func (h *StandardHistogram2D) String() string { return histogram2DString(h) }
+
+// Update records a pair of values.
+func (h *StandardHistogram2D) Update(x, y int64) {
+	i := bucketIndex(h.xBounds, x)
+	j := bucketIndex(h.yBounds, y)
+	atomic.AddInt64(&h.counts[i*(len(h.yBounds)+1)+j], 1)
+}
+
+// XBounds returns the upper bounds of the x buckets.
+func (h *StandardHistogram2D) XBounds() []int64 { return h.xBounds }
+
+// YBounds returns the upper bounds of the y buckets.
+func (h *StandardHistogram2D) YBounds() []int64 { return h.yBounds }
+
+// eachHistogram2DCell calls f with the upper bounds of each cell's x and y
+// buckets, "inf" for the overflow buckets, and the cell's count.
+func eachHistogram2DCell(h Histogram2D, f func(x, y string, count int64)) {
+	xs, ys := h.XBounds(), h.YBounds()
+	for i, row := range h.Counts() {
+		for j, count := range row {
+			f(boundLabel(xs, i), boundLabel(ys, j), count)
+		}
+	}
+}
+
+func boundLabel(bounds []int64, i int) string {
+	if len(bounds) == i {
+		return "inf"
+	}
+	return strconv.FormatInt(bounds[i], 10)
+}
+
+// bucketIndex returns the index of the first bound v does not exceed or
+// len(bounds) if it exceeds them all.
+func bucketIndex(bounds []int64, v int64) int {
+	return sort.Search(len(bounds), func(i int) bool { return v <= bounds[i] })
+}
+
+func copyInt64s(values []int64) []int64 {
+	c := make([]int64, len(values))
+	copy(c, values)
+	return c
+}
@@ -0,0 +1,74 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func BenchmarkHistogram2D(b *testing.B) {
+	h := NewHistogram2D(ExponentialBounds(1024, 2, 10), ExponentialBounds(1000, 2, 10))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Update(int64(i), int64(i))
+	}
+}
+
+func TestGetOrRegisterHistogram2D(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredHistogram2D("foo", r, []int64{10}, []int64{10}).Update(1, 1)
+	if h := GetOrRegisterHistogram2D("foo", r, []int64{10}, []int64{10}); 1 != h.Count() {
+		t.Fatal(h)
+	}
+}
+
+func TestHistogram2D(t *testing.T) {
+	h := NewHistogram2D([]int64{10, 100}, []int64{5})
+	h.Update(1, 1)
+	h.Update(10, 5)
+	h.Update(11, 6)
+	h.Update(1000, -1)
+	if count := h.Count(); 4 != count {
+		t.Errorf("h.Count(): 4 != %v\n", count)
+	}
+	if counts := h.Counts(); !reflect.DeepEqual([][]int64{{2, 0}, {0, 1}, {1, 0}}, counts) {
+		t.Errorf("h.Counts(): %v\n", counts)
+	}
+	h.Clear()
+	if count := h.Count(); 0 != count {
+		t.Errorf("h.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestHistogram2DSnapshot(t *testing.T) {
+	h := NewHistogram2D([]int64{10}, []int64{10})
+	h.Update(1, 1)
+	snapshot := h.Snapshot()
+	h.Update(100, 100)
+	if count := snapshot.Count(); 1 != count {
+		t.Errorf("snapshot.Count(): 1 != %v\n", count)
+	}
+	if counts := snapshot.Counts(); !reflect.DeepEqual([][]int64{{1, 0}, {0, 0}}, counts) {
+		t.Errorf("snapshot.Counts(): %v\n", counts)
+	}
+}
+
+func TestHistogram2DUnsortedBounds(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Error("NewHistogram2D didn't panic")
+		}
+	}()
+	NewHistogram2D([]int64{10, 1}, nil)
+}
+
+func TestBounds(t *testing.T) {
+	if bounds := LinearBounds(10, 5, 3); !reflect.DeepEqual([]int64{10, 15, 20}, bounds) {
+		t.Errorf("LinearBounds(10, 5, 3): %v\n", bounds)
+	}
+	if bounds := ExponentialBounds(1, 2.5, 4); !reflect.DeepEqual([]int64{1, 3, 6, 16}, bounds) {
+		t.Errorf("ExponentialBounds(1, 2.5, 4): %v\n", bounds)
+	}
+}
@@ -1,3 +1,6 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
 import "testing"
@@ -56,6 +59,18 @@ func TestHistogramEmpty(t *testing.T) {
 	}
 }
 
+func TestHistogramUpdateWeighted(t *testing.T) {
+	h := NewHistogram(NewUniformSample(100))
+	h.UpdateWeighted(47, 10)
+	h.UpdateWeighted(48, 0.4)
+	if count := h.Count(); 10 != count {
+		t.Errorf("h.Count(): 10 != %v\n", count)
+	}
+	if size := h.Sample().Size(); 2 != size {
+		t.Errorf("h.Sample().Size(): 2 != %v\n", size)
+	}
+}
+
 func TestHistogramSnapshot(t *testing.T) {
 	h := NewHistogram(NewUniformSample(100000))
 	for i := 1; i <= 10000; i++ {
@@ -93,3 +108,21 @@ func testHistogram10000(t *testing.T, h Histogram) {
 		t.Errorf("99th percentile: 9900.99 != %v\n", ps[2])
 	}
 }
+
+func TestHistogramSumBeyondReservoir(t *testing.T) {
+	h := NewHistogram(NewUniformSample(10))
+	for i := 1; i <= 100; i++ {
+		h.Update(int64(i))
+	}
+	h.UpdateWeighted(1000, 2)
+	if sum := h.Sum(); 7050 != sum {
+		t.Errorf("h.Sum(): 7050 != %v\n", sum)
+	}
+	if sum := h.Snapshot().Sum(); 7050 != sum {
+		t.Errorf("h.Snapshot().Sum(): 7050 != %v\n", sum)
+	}
+	h.Clear()
+	if sum := h.Sum(); 0 != sum {
+		t.Errorf("h.Sum(): 0 != %v after Clear\n", sum)
+	}
+}
@@ -0,0 +1,415 @@
+// Package influxdb writes a Registry to an InfluxDB 1.x database, or any
+// server accepting its /write endpoint, in the line protocol over HTTP.  It
+// replaces the client which was pulled out of this repository when the
+// InfluxDB API was still in flux.
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// DefaultBatchSize is the most lines a Reporter writes in one request unless
+// Config.BatchSize says otherwise.
+const DefaultBatchSize = 5000
+
+// DefaultPercentiles are the percentiles written of histograms and timers
+// which export none of their own unless Config.Percentiles says otherwise.
+var DefaultPercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// Config provides a container with configuration parameters for the
+// InfluxDB exporter.
+type Config struct {
+	URL           string               // Base URL of the server, such as http://127.0.0.1:8086
+	Database      string               // Database to write to
+	Username      string               // If not empty, authenticates with Password
+	Password      string               // Password of Username
+	Registry      metrics.Registry     // Registry to be exported
+	FlushInterval time.Duration        // Flush interval
+	FlushTimeout  time.Duration        // Deadline for each flush, retries included; zero means FlushInterval
+	Tags          map[string]string    // Tags written with every metric
+	Percentiles   []float64            // Percentiles to write of timers and histograms; nil means each metric's ExportedPercentiles
+	BatchSize     int                  // Most lines written per request; zero means DefaultBatchSize
+	Retries       int                  // Attempts after a write which fails for want of the server
+	RetryBackoff  time.Duration        // Wait before the first retry, doubled before each after it; zero means 100ms
+	Client        *http.Client         // Client making requests; nil means http.DefaultClient
+	ValuePolicy   *metrics.ValuePolicy // NaN, ±Inf and negative value handling; nil means metrics.DefaultValuePolicy
+}
+
+// A Reporter writes a registry to InfluxDB in its line protocol.  Each
+// metric is a point of the measurement named by its name, with the tags of
+// a name made by metrics.TaggedName along with Config.Tags.  Counters and
+// gauges have a count or value field; meters, their count and rates;
+// histograms, duration histograms, and timers, their count, minimum,
+// maximum, mean, standard deviation, and percentiles, as p50, p99, and so
+// on, with durations in nanoseconds; and summaries, their count, sum, and
+// quantiles.  Values which are NaN or ±Inf, which the line protocol can't
+// represent, are left out, and Histogram2Ds, staged timers, and
+// healthchecks are skipped.
+//
+// The points of a flush are written in batches of at most BatchSize lines,
+// each retried with exponential backoff when the server can't be reached,
+// responds 5xx, or asks to be retried later with 429.  A batch the server
+// rejects otherwise isn't retried, since it would be rejected again.
+type Reporter struct {
+	config Config
+	write  string // URL of the write endpoint
+}
+
+// NewReporter constructs a new Reporter with the given configuration, or
+// returns an error if its URL doesn't parse.
+func NewReporter(c Config) (*Reporter, error) {
+	u, err := url.Parse(c.URL)
+	if nil != err {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+	q := u.Query()
+	q.Set("db", c.Database)
+	q.Set("precision", "s")
+	u.RawQuery = q.Encode()
+	if nil == c.Registry {
+		c.Registry = metrics.DefaultRegistry
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if 0 == c.RetryBackoff {
+		c.RetryBackoff = 100 * time.Millisecond
+	}
+	if nil == c.Client {
+		c.Client = http.DefaultClient
+	}
+	return &Reporter{config: c, write: u.String()}, nil
+}
+
+// Influx is a blocking exporter function which reports metrics in r to the
+// database db of the InfluxDB server at url, flushing them every d duration,
+// tagging every point with tags, and retrying each write three times.
+func Influx(r metrics.Registry, d time.Duration, url, db string, tags map[string]string) {
+	WithConfig(Config{
+		URL:           url,
+		Database:      db,
+		Registry:      r,
+		FlushInterval: d,
+		Tags:          tags,
+		Retries:       3,
+	})
+}
+
+// WithConfig is a blocking exporter function just like Influx, but it takes
+// a Config instead.
+func WithConfig(c Config) {
+	WithConfigContext(context.Background(), c)
+}
+
+// WithConfigContext is a blocking exporter function just like WithConfig,
+// but it returns once ctx is done, interrupting any flush in progress.
+func WithConfigContext(ctx context.Context, c Config) {
+	r, err := NewReporter(c)
+	if nil != err {
+		log.Println(err)
+		metrics.EmitEvent(metrics.Event{Type: metrics.EventReporterError, Name: "influxdb", Err: err})
+		return
+	}
+	r.Run(ctx)
+}
+
+// Run flushes the registry every FlushInterval until ctx is done, logging
+// failed flushes and emitting them as metrics.EventReporterError.  Flushes
+// which outlast FlushTimeout are counted by metrics.FlushTimeouts in the
+// reporter's registry.  This is designed to be called as a goroutine.
+func (r *Reporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		timeout := r.config.FlushTimeout
+		if 0 == timeout {
+			timeout = r.config.FlushInterval
+		}
+		flushCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := r.flush(flushCtx, now)
+		if metrics.IsFlushTimeout(flushCtx, err) {
+			metrics.FlushTimeouts(r.config.Registry).Inc(1)
+		}
+		cancel()
+		if nil != err && nil == ctx.Err() {
+			log.Println(err)
+			metrics.EmitEvent(metrics.Event{Type: metrics.EventReporterError, Name: "influxdb", Err: err})
+		}
+	}
+}
+
+// Flush writes the registry once, returning a non-nil error if any batch
+// couldn't be written.  Later batches are written even if earlier ones fail.
+func (r *Reporter) Flush(ctx context.Context) error {
+	return r.flush(ctx, time.Now())
+}
+
+func (r *Reporter) flush(ctx context.Context, now time.Time) error {
+	lines := r.lines(now)
+	var firstErr error
+	for 0 < len(lines) {
+		n := r.config.BatchSize
+		if len(lines) < n {
+			n = len(lines)
+		}
+		if err := r.post(ctx, lines[:n]); nil != err {
+			if nil != ctx.Err() {
+				return err
+			}
+			if nil == firstErr {
+				firstErr = err
+			}
+		}
+		lines = lines[n:]
+	}
+	return firstErr
+}
+
+// post writes one batch of lines, retrying with exponential backoff.
+func (r *Reporter) post(ctx context.Context, lines []string) error {
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	backoff := r.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := r.postOnce(ctx, body)
+		if nil == err || !retry || r.config.Retries <= attempt {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// postOnce writes a body once, returning an error if it wasn't written and
+// whether it's worth retrying.
+func (r *Reporter) postOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", r.write, bytes.NewReader(body))
+	if nil != err {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if "" != r.config.Username {
+		req.SetBasicAuth(r.config.Username, r.config.Password)
+	}
+	resp, err := r.config.Client.Do(req)
+	if nil != err {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if 2 == resp.StatusCode/100 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("influxdb: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return 5 == resp.StatusCode/100 || http.StatusTooManyRequests == resp.StatusCode, err
+}
+
+// lines returns a line of the line protocol for each metric in the registry,
+// in order of name.
+func (r *Reporter) lines(now time.Time) []string {
+	var (
+		lines  []string
+		ts     = strconv.FormatInt(now.Unix(), 10)
+		policy = metrics.DefaultValuePolicy
+	)
+	if nil != r.config.ValuePolicy {
+		policy = *r.config.ValuePolicy
+	}
+	r.config.Registry.Each(func(name string, i interface{}) {
+		f := fields{policy: policy}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			f.int("count", metric.Count())
+		case metrics.CounterFloat64:
+			f.value("count", metric.Count())
+		case metrics.Gauge:
+			f.intValue("value", metric.Value())
+		case metrics.GaugeFloat64:
+			f.value("value", metric.Value())
+		case metrics.Meter:
+			m := metric.Snapshot()
+			f.int("count", m.Count())
+			f.float("m1", m.Rate1())
+			f.float("m5", m.Rate5())
+			f.float("m15", m.Rate15())
+			f.float("mean", m.RateMean())
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			ps := r.percentiles(h)
+			f.int("count", h.Count())
+			f.intValue("min", h.Min())
+			f.intValue("max", h.Max())
+			f.value("mean", h.Mean())
+			f.value("stddev", h.StdDev())
+			f.percentiles(ps, h.Percentiles(ps))
+		case metrics.DurationHistogram:
+			h := metric.Snapshot()
+			ps := r.percentiles(h)
+			ds := h.Percentiles(ps)
+			vs := make([]float64, len(ds))
+			for j, d := range ds {
+				vs[j] = float64(d)
+			}
+			f.int("count", h.Count())
+			f.intValue("min", int64(h.Min()))
+			f.intValue("max", int64(h.Max()))
+			f.intValue("mean", int64(h.Mean()))
+			f.intValue("stddev", int64(h.StdDev()))
+			f.percentiles(ps, vs)
+		case metrics.Summary:
+			s := metric.Snapshot()
+			f.int("count", s.Count())
+			f.value("sum", s.Sum())
+			f.percentiles(s.Objectives(), s.Quantiles())
+		case metrics.Timer:
+			t := metric.Snapshot()
+			ps := r.percentiles(t)
+			f.int("count", t.Count())
+			f.intValue("min", t.Min())
+			f.intValue("max", t.Max())
+			f.value("mean", t.Mean())
+			f.value("stddev", t.StdDev())
+			f.percentiles(ps, t.Percentiles(ps))
+			f.float("m1", t.Rate1())
+			f.float("m5", t.Rate5())
+			f.float("m15", t.Rate15())
+			f.float("meanrate", t.RateMean())
+		}
+		if 0 == len(f.b) {
+			return
+		}
+		measurement, tags := metrics.SplitTaggedName(name)
+		lines = append(lines, escape(measurement, ", ")+r.tags(tags)+" "+string(f.b)+" "+ts)
+	})
+	return lines
+}
+
+// tags returns the tag set of a point, with Config.Tags, in order of key.
+// A metric's own tags override those of the same key in Config.Tags.
+func (r *Reporter) tags(tags map[string]string) string {
+	merged := make(map[string]string, len(tags)+len(r.config.Tags))
+	for k, v := range r.config.Tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	keys := make([]string, 0, len(merged))
+	for k, v := range merged {
+		if "" != k && "" != v { // The line protocol has no empty keys or values
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(escape(k, ",= "))
+		b.WriteByte('=')
+		b.WriteString(escape(merged[k], ",= "))
+	}
+	return b.String()
+}
+
+// percentiles returns the percentiles to write of a histogram or timer.
+func (r *Reporter) percentiles(i interface{}) []float64 {
+	if nil != r.config.Percentiles {
+		return r.config.Percentiles
+	}
+	if e, ok := i.(interface{ ExportedPercentiles() []float64 }); ok {
+		if ps := e.ExportedPercentiles(); nil != ps {
+			return ps
+		}
+	}
+	return DefaultPercentiles
+}
+
+// fields accumulates the field set of a point.  Values subject to the
+// ValuePolicy are added by value and intValue; the rest by float and int.
+type fields struct {
+	b      []byte
+	policy metrics.ValuePolicy
+}
+
+func (f *fields) float(key string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	f.key(key)
+	f.b = strconv.AppendFloat(f.b, v, 'f', -1, 64)
+}
+
+func (f *fields) int(key string, v int64) {
+	f.key(key)
+	f.b = strconv.AppendInt(f.b, v, 10)
+	f.b = append(f.b, 'i')
+}
+
+func (f *fields) value(key string, v float64) {
+	if v, ok := f.policy.Float(v); ok {
+		f.float(key, v)
+	}
+}
+
+func (f *fields) intValue(key string, v int64) {
+	if v, ok := f.policy.Int(v); ok {
+		f.int(key, v)
+	}
+}
+
+func (f *fields) key(key string) {
+	if 0 < len(f.b) {
+		f.b = append(f.b, ',')
+	}
+	f.b = append(f.b, key...)
+	f.b = append(f.b, '=')
+}
+
+// percentiles adds a field for each percentile, such as p99 or p999.
+func (f *fields) percentiles(ps, vs []float64) {
+	for j, p := range ps {
+		f.value("p"+strings.Replace(strconv.FormatFloat(p*100, 'f', -1, 64), ".", "", 1), vs[j])
+	}
+}
+
+// escape backslash-escapes the given special characters of s, and replaces
+// newlines, which can't be escaped, with spaces, escaped if need be.
+func escape(s, special string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if '\n' == c || '\r' == c {
+			c = ' '
+		}
+		if strings.ContainsRune(special, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
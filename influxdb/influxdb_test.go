@@ -0,0 +1,164 @@
+package influxdb
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// server records the bodies of writes, responding with the given statuses in
+// turn and then 204.
+type server struct {
+	sync.Mutex
+	bodies   []string
+	queries  []string
+	statuses []int
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	s.Lock()
+	defer s.Unlock()
+	s.bodies = append(s.bodies, string(body))
+	s.queries = append(s.queries, req.URL.Path+"?"+req.URL.RawQuery)
+	status := http.StatusNoContent
+	if 0 < len(s.statuses) {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestFlush(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"code": "200"}), r).Inc(3)
+	metrics.GetOrRegisterGaugeFloat64("load avg", r).Update(1.5)
+	h := metrics.GetOrRegisterHistogram("sizes", r, metrics.NewUniformSample(100))
+	h.Update(10)
+	h.Update(20)
+	rep, err := NewReporter(Config{
+		URL:         ts.URL + "/",
+		Database:    "metrics",
+		Registry:    r,
+		Tags:        map[string]string{"host": "web1", "code": "overridden"},
+		Percentiles: []float64{0.5},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	if err := rep.flush(context.Background(), now); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(s.bodies) {
+		t.Fatalf("%d requests, want 1", len(s.bodies))
+	}
+	if q := s.queries[0]; "/write?db=metrics&precision=s" != q {
+		t.Errorf("query: %q", q)
+	}
+	want := strings.Join([]string{
+		`load\ avg,code=overridden,host=web1 value=1.5 1500000000`,
+		`requests,code=200,host=web1 count=3i 1500000000`,
+		`sizes,code=overridden,host=web1 count=2i,min=10i,max=20i,mean=15,stddev=5,p50=15 1500000000`,
+	}, "\n") + "\n"
+	if s.bodies[0] != want {
+		t.Errorf("body:\n%s\nwant:\n%s", s.bodies[0], want)
+	}
+}
+
+func TestFlushValuePolicy(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("temperature", r).Update(-4)
+	metrics.GetOrRegisterGaugeFloat64("ratio", r).Update(math.Inf(1))
+	rep, err := NewReporter(Config{
+		URL:         ts.URL + "/",
+		Database:    "metrics",
+		Registry:    r,
+		ValuePolicy: &metrics.ValuePolicy{Inf: metrics.ValueClamp, Negative: metrics.ValueReject},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := rep.flush(context.Background(), time.Unix(1500000000, 0)); nil != err {
+		t.Fatal(err)
+	}
+	want := "ratio value=" + strconv.FormatFloat(math.MaxFloat64, 'f', -1, 64) + " 1500000000\n"
+	if 1 != len(s.bodies) || s.bodies[0] != want {
+		t.Errorf("bodies: %q, want %q", s.bodies, want)
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	s := &server{}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	r := metrics.NewRegistry()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		metrics.GetOrRegisterCounter(name, r).Inc(1)
+	}
+	rep, err := NewReporter(Config{URL: ts.URL, Database: "metrics", Registry: r, BatchSize: 2})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := rep.Flush(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(s.bodies) {
+		t.Fatalf("%d requests, want 3", len(s.bodies))
+	}
+	for i, n := range []int{2, 2, 1} {
+		if lines := strings.Count(s.bodies[i], "\n"); n != lines {
+			t.Errorf("batch %d: %d lines, want %d", i, lines, n)
+		}
+	}
+}
+
+func TestFlushRetries(t *testing.T) {
+	s := &server{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("a", r).Inc(1)
+	rep, err := NewReporter(Config{URL: ts.URL, Database: "metrics", Registry: r, Retries: 2, RetryBackoff: time.Millisecond})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := rep.Flush(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	if 3 != len(s.bodies) {
+		t.Fatalf("%d requests, want 3", len(s.bodies))
+	}
+
+	s.statuses = []int{http.StatusBadRequest}
+	s.bodies = nil
+	if err := rep.Flush(context.Background()); nil == err {
+		t.Fatal("no error from a rejected write")
+	}
+	if 1 != len(s.bodies) {
+		t.Fatalf("%d requests of a rejected write, want 1", len(s.bodies))
+	}
+
+	s.statuses = []int{500, 500, 500}
+	s.bodies = nil
+	if err := rep.Flush(context.Background()); nil == err {
+		t.Fatal("no error once retries are exhausted")
+	}
+	if 3 != len(s.bodies) {
+		t.Fatalf("%d requests once retries are exhausted, want 3", len(s.bodies))
+	}
+}
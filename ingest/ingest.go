@@ -0,0 +1,231 @@
+// Package ingest merges the metrics of other processes, posted in the JSON
+// form written by metrics.WriteJSONOnce, into a local registry, so that any
+// service built on go-metrics can act as a lightweight aggregation point for
+// sidecars and batch jobs which can't be scraped themselves.
+//
+//	http.Handle("/metrics/ingest", ingest.Handler(metrics.DefaultRegistry))
+//
+// and, in each source:
+//
+//	var buf bytes.Buffer
+//	metrics.WriteJSONOnce(metrics.DefaultRegistry, &buf)
+//	http.Post("http://aggregator/metrics/ingest?source=job-42", "application/json", &buf)
+//
+// Sources post cumulative snapshots, which are merged as follows:
+//
+//   - Counters, whose JSON has only a count, are incremented by the growth of
+//     each source's count since its last post.  A count which goes backwards
+//     is taken to mean the source restarted.
+//   - Gauges, whose JSON has only a value, are GaugeFloat64s whose value is
+//     the sum of the latest values posted by each source.
+//   - Meters are marked with the growth of each source's count, in the same
+//     way as counters, so that their rates are those of the sources combined.
+//
+// Histograms, timers, summaries, and the rest carry percentiles or other
+// statistics which can't be merged, so they're ignored, as are metrics whose
+// names are registered locally as another type, which are reported as a
+// metrics.EventConflicted.
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// An Ingester merges snapshots posted by other processes into a registry.
+type Ingester struct {
+	counts   map[sourceName]int64
+	gauges   map[string]map[string]float64 // name to source to value
+	mutex    sync.Mutex
+	registry metrics.Registry
+}
+
+type sourceName struct {
+	source, name string
+}
+
+// Handler returns an http.Handler which merges snapshots POSTed to it into
+// r, identifying their source by the source query parameter or, if there
+// is none, the client's host.
+func Handler(r metrics.Registry) http.Handler {
+	return NewIngester(r)
+}
+
+// NewIngester constructs a new Ingester which merges snapshots into r.
+func NewIngester(r metrics.Registry) *Ingester {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return &Ingester{
+		counts:   make(map[sourceName]int64),
+		gauges:   make(map[string]map[string]float64),
+		registry: r,
+	}
+}
+
+// Forget discards the state kept for a source, removing its values from the
+// gauges it contributed to, as when it has been decommissioned.  If it posts
+// again its counts are merged as though it had restarted.
+func (in *Ingester) Forget(source string) {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	for key := range in.counts {
+		if source == key.source {
+			delete(in.counts, key)
+		}
+	}
+	for name, values := range in.gauges {
+		if _, ok := values[source]; ok {
+			delete(values, source)
+			in.updateGauge(name)
+		}
+	}
+}
+
+// Ingest merges a snapshot of the metrics of the given source, in the JSON
+// form written by metrics.WriteJSONOnce, into the registry.
+func (in *Ingester) Ingest(source string, rd io.Reader) error {
+	var snapshot map[string]map[string]interface{}
+	if err := json.NewDecoder(rd).Decode(&snapshot); nil != err {
+		return fmt.Errorf("ingest: %v", err)
+	}
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	for name, values := range snapshot {
+		switch {
+		case isCounter(values):
+			if c, ok := in.getOrRegister(name, metrics.NewCounter).(metrics.Counter); ok {
+				c.Inc(in.delta(source, name, values["count"]))
+			}
+		case isGauge(values):
+			if _, ok := in.getOrRegister(name, metrics.NewGaugeFloat64).(metrics.GaugeFloat64); ok {
+				if nil == in.gauges[name] {
+					in.gauges[name] = make(map[string]float64)
+				}
+				in.gauges[name][source] = float(values["value"])
+				in.updateGauge(name)
+			}
+		case isMeter(values):
+			if m, ok := in.getOrRegister(name, metrics.NewMeter).(metrics.Meter); ok {
+				m.Mark(in.delta(source, name, values["count"]))
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP merges the snapshot in the body of a POST request, responding
+// 204 No Content once it's merged and 400 Bad Request if it's malformed.
+func (in *Ingester) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if "POST" != req.Method {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	source := req.FormValue("source")
+	if "" == source {
+		if host, _, err := net.SplitHostPort(req.RemoteAddr); nil == err {
+			source = host
+		} else {
+			source = req.RemoteAddr
+		}
+	}
+	if err := in.Ingest(source, req.Body); nil != err {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delta returns the growth of a source's count since its last post.  It must
+// be called with in.mutex held.
+func (in *Ingester) delta(source, name string, v interface{}) int64 {
+	key := sourceName{source, name}
+	count := int64(float(v))
+	last, ok := in.counts[key]
+	in.counts[key] = count
+	if !ok || count < last {
+		return count
+	}
+	return count - last
+}
+
+// getOrRegister returns the metric registered under the given name or
+// registers a new one, returning nil if a metric of another type is already
+// registered.  It must be called with in.mutex held.
+func (in *Ingester) getOrRegister(name string, constructor interface{}) interface{} {
+	i := in.registry.GetOrRegister(name, constructor)
+	var ok bool
+	switch constructor.(type) {
+	case func() metrics.Counter:
+		_, ok = i.(metrics.Counter)
+	case func() metrics.GaugeFloat64:
+		_, ok = i.(metrics.GaugeFloat64)
+	case func() metrics.Meter:
+		_, ok = i.(metrics.Meter)
+	}
+	if !ok {
+		metrics.EmitEvent(metrics.Event{
+			Type:   metrics.EventConflicted,
+			Name:   name,
+			Metric: i,
+			Err:    metrics.DuplicateMetric(name),
+		})
+		return nil
+	}
+	return i
+}
+
+// updateGauge sets a gauge to the sum of its sources' values.  It must be
+// called with in.mutex held.
+func (in *Ingester) updateGauge(name string) {
+	g, ok := in.registry.Get(name).(metrics.GaugeFloat64)
+	if !ok {
+		return
+	}
+	var sum float64
+	for _, v := range in.gauges[name] {
+		sum += v
+	}
+	g.Update(sum)
+}
+
+// float returns the value of a number decoded from JSON, including NaN and
+// ±Inf, which are encoded as strings.
+func float(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		switch v {
+		case "+Inf":
+			return math.Inf(1)
+		case "-Inf":
+			return math.Inf(-1)
+		}
+	}
+	return math.NaN()
+}
+
+func isCounter(values map[string]interface{}) bool {
+	_, ok := values["count"]
+	return ok && 1 == len(values)
+}
+
+func isGauge(values map[string]interface{}) bool {
+	_, ok := values["value"]
+	return ok && 1 == len(values)
+}
+
+func isMeter(values map[string]interface{}) bool {
+	_, ok := values["1m.rate"]
+	_, min := values["min"]
+	return ok && !min
+}
@@ -0,0 +1,104 @@
+package ingest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func post(h http.Handler, source string, r metrics.Registry) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	metrics.WriteJSONOnce(r, &buf)
+	req := httptest.NewRequest("POST", "/ingest?source="+source, &buf)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	local := metrics.NewRegistry()
+	h := Handler(local)
+	a, b := metrics.NewRegistry(), metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("requests", a).Inc(3)
+	metrics.GetOrRegisterCounter("requests", b).Inc(4)
+	metrics.GetOrRegisterGauge("queue", a).Update(10)
+	metrics.GetOrRegisterGauge("queue", b).Update(5)
+	metrics.GetOrRegisterMeter("bytes", a).Mark(100)
+	metrics.GetOrRegisterTimer("latency", a).Update(1)
+	for source, r := range map[string]metrics.Registry{"a": a, "b": b} {
+		if w := post(h, source, r); http.StatusNoContent != w.Code {
+			t.Fatalf("w.Code: %v != %v\n", http.StatusNoContent, w.Code)
+		}
+	}
+	metrics.GetOrRegisterCounter("requests", a).Inc(1)
+	metrics.GetOrRegisterGauge("queue", a).Update(2)
+	metrics.GetOrRegisterMeter("bytes", a).Mark(50)
+	post(h, "a", a)
+	if count := local.Get("requests").(metrics.Counter).Count(); 8 != count {
+		t.Errorf("requests.Count(): 8 != %v\n", count)
+	}
+	if value := local.Get("queue").(metrics.GaugeFloat64).Value(); 7 != value {
+		t.Errorf("queue.Value(): 7 != %v\n", value)
+	}
+	if count := local.Get("bytes").(metrics.Meter).Count(); 150 != count {
+		t.Errorf("bytes.Count(): 150 != %v\n", count)
+	}
+	if nil != local.Get("latency") {
+		t.Error("latency was ingested")
+	}
+}
+
+func TestIngesterForget(t *testing.T) {
+	local := metrics.NewRegistry()
+	in := NewIngester(local)
+	in.Ingest("a", strings.NewReader(`{"requests": {"count": 5}, "queue": {"value": 3}}`))
+	in.Ingest("b", strings.NewReader(`{"queue": {"value": 4}}`))
+	in.Forget("a")
+	if value := local.Get("queue").(metrics.GaugeFloat64).Value(); 4 != value {
+		t.Errorf("queue.Value(): 4 != %v\n", value)
+	}
+	in.Ingest("a", strings.NewReader(`{"requests": {"count": 2}}`))
+	if count := local.Get("requests").(metrics.Counter).Count(); 7 != count {
+		t.Errorf("requests.Count(): 7 != %v\n", count)
+	}
+}
+
+func TestIngesterReset(t *testing.T) {
+	local := metrics.NewRegistry()
+	in := NewIngester(local)
+	in.Ingest("a", strings.NewReader(`{"requests": {"count": 5}}`))
+	in.Ingest("a", strings.NewReader(`{"requests": {"count": 2}}`))
+	if count := local.Get("requests").(metrics.Counter).Count(); 7 != count {
+		t.Errorf("requests.Count(): 7 != %v\n", count)
+	}
+}
+
+func TestIngesterConflict(t *testing.T) {
+	local := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("requests", local)
+	in := NewIngester(local)
+	if err := in.Ingest("a", strings.NewReader(`{"requests": {"count": 5}}`)); nil != err {
+		t.Fatal(err)
+	}
+	if _, ok := local.Get("requests").(metrics.Gauge); !ok {
+		t.Error("requests was replaced")
+	}
+}
+
+func TestHandlerBadRequest(t *testing.T) {
+	h := Handler(metrics.NewRegistry())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/ingest", strings.NewReader("{")))
+	if http.StatusBadRequest != w.Code {
+		t.Errorf("w.Code: %v != %v\n", http.StatusBadRequest, w.Code)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/ingest", nil))
+	if http.StatusMethodNotAllowed != w.Code {
+		t.Errorf("w.Code: %v != %v\n", http.StatusMethodNotAllowed, w.Code)
+	}
+}
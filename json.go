@@ -3,22 +3,51 @@ package metrics
 import (
 	"encoding/json"
 	"io"
+	"strconv"
 	"time"
 )
 
+// JSONConfig provides a container with configuration parameters for the
+// JSON reporter.
+type JSONConfig struct {
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	Writer        io.Writer     // Writer to which each flush is written as a line of JSON
+	ValuePolicy   *ValuePolicy  // NaN, ±Inf and negative value handling; nil means DefaultValuePolicy
+}
+
 // MarshalJSON returns a byte slice containing a JSON representation of all
-// the metrics in the Registry.
+// the metrics in the Registry.  Values are subject to DefaultValuePolicy and
+// NaN and ±Inf are encoded as the strings "NaN", "+Inf", and "-Inf".
 func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
+	return marshalJSON(r, DefaultValuePolicy)
+}
+
+// marshalJSON returns the JSON representation of the metrics in r with
+// values subject to the given policy.
+func marshalJSON(r Registry, policy ValuePolicy) ([]byte, error) {
 	data := make(map[string]map[string]interface{})
 	r.Each(func(name string, i interface{}) {
 		values := make(map[string]interface{})
+		setInt := func(key string, v int64) {
+			if v, ok := policy.Int(v); ok {
+				values[key] = v
+			}
+		}
+		setFloat := func(key string, v float64) {
+			if v, ok := policy.Float(v); ok {
+				values[key] = jsonFloat(v)
+			}
+		}
 		switch metric := i.(type) {
 		case Counter:
 			values["count"] = metric.Count()
+		case CounterFloat64:
+			setFloat("count", metric.Count())
 		case Gauge:
-			values["value"] = metric.Value()
+			setInt("value", metric.Value())
 		case GaugeFloat64:
-			values["value"] = metric.Value()
+			setFloat("value", metric.Value())
 		case Healthcheck:
 			values["error"] = nil
 			metric.Check()
@@ -27,17 +56,36 @@ func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
 			}
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			percentiles := ExportedPercentiles(r, i)
+			ps := h.Percentiles(percentiles)
+			values["count"] = h.Count()
+			setInt("sum", h.Sum())
+			setInt("min", h.Min())
+			setInt("max", h.Max())
+			setFloat("mean", h.Mean())
+			setFloat("stddev", h.StdDev())
+			for j, p := range percentiles {
+				setFloat(percentileLabel(p), ps[j])
+			}
+		case DurationHistogram:
+			h := metric.Snapshot()
+			percentiles := ExportedPercentiles(r, i)
+			ps := h.Percentiles(percentiles)
 			values["count"] = h.Count()
-			values["min"] = h.Min()
-			values["max"] = h.Max()
-			values["mean"] = h.Mean()
-			values["stddev"] = h.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
+			setInt("sum", int64(h.Sum()))
+			setInt("min", int64(h.Min()))
+			setInt("max", int64(h.Max()))
+			setInt("mean", int64(h.Mean()))
+			setInt("stddev", int64(h.StdDev()))
+			for j, p := range percentiles {
+				setInt(percentileLabel(p), int64(ps[j]))
+			}
+		case Histogram2D:
+			h := metric.Snapshot()
+			values["count"] = h.Count()
+			values["x"] = h.XBounds()
+			values["y"] = h.YBounds()
+			values["counts"] = h.Counts()
 		case Meter:
 			m := metric.Snapshot()
 			values["count"] = m.Count()
@@ -45,19 +93,46 @@ func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
 			values["5m.rate"] = m.Rate5()
 			values["15m.rate"] = m.Rate15()
 			values["mean.rate"] = m.RateMean()
+		case Summary:
+			s := metric.Snapshot()
+			values["count"] = s.Count()
+			setFloat("sum", s.Sum())
+			qs := s.Quantiles()
+			for i, q := range s.Objectives() {
+				setFloat(strconv.FormatFloat(q*100.0, 'f', -1, 64)+"%", qs[i])
+			}
+		case StagedTimer:
+			t := metric.Snapshot()
+			stages := make(map[string]interface{})
+			eachStage(t, func(stage string, h DurationHistogram) {
+				values = make(map[string]interface{})
+				percentiles := ExportedPercentiles(r, h)
+				ps := h.Percentiles(percentiles)
+				values["count"] = h.Count()
+				setInt("sum", int64(h.Sum()))
+				setInt("min", int64(h.Min()))
+				setInt("max", int64(h.Max()))
+				setInt("mean", int64(h.Mean()))
+				setInt("stddev", int64(h.StdDev()))
+				for j, p := range percentiles {
+					setInt(percentileLabel(p), int64(ps[j]))
+				}
+				stages[stage] = values
+			})
+			values = map[string]interface{}{"count": t.Count(), "stages": stages}
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			percentiles := ExportedPercentiles(r, i)
+			ps := t.Percentiles(percentiles)
 			values["count"] = t.Count()
-			values["min"] = t.Min()
-			values["max"] = t.Max()
-			values["mean"] = t.Mean()
-			values["stddev"] = t.StdDev()
-			values["median"] = ps[0]
-			values["75%"] = ps[1]
-			values["95%"] = ps[2]
-			values["99%"] = ps[3]
-			values["99.9%"] = ps[4]
+			setInt("sum", t.Sum())
+			setInt("min", t.Min())
+			setInt("max", t.Max())
+			setFloat("mean", t.Mean())
+			setFloat("stddev", t.StdDev())
+			for j, p := range percentiles {
+				setFloat(percentileLabel(p), ps[j])
+			}
 			values["1m.rate"] = t.Rate1()
 			values["5m.rate"] = t.Rate5()
 			values["15m.rate"] = t.Rate15()
@@ -71,7 +146,7 @@ func (r *StandardRegistry) MarshalJSON() ([]byte, error) {
 // WriteJSON writes metrics from the given registry  periodically to the
 // specified io.Writer as JSON.
 func WriteJSON(r Registry, d time.Duration, w io.Writer) {
-	for _ = range time.Tick(d) {
+	for _ = range tick("json", priorityReport, d) {
 		WriteJSONOnce(r, w)
 	}
 }
@@ -81,3 +156,23 @@ func WriteJSON(r Registry, d time.Duration, w io.Writer) {
 func WriteJSONOnce(r Registry, w io.Writer) {
 	json.NewEncoder(w).Encode(r)
 }
+
+// WriteJSONWithConfig is a blocking reporter function just like WriteJSON,
+// but it takes a JSONConfig instead.
+func WriteJSONWithConfig(c JSONConfig) {
+	for _ = range tick("json", priorityReport, c.FlushInterval) {
+		WriteJSONOnceWithConfig(c)
+	}
+}
+
+// WriteJSONOnceWithConfig writes metrics from the configured registry to the
+// configured io.Writer as JSON, with values subject to the configured
+// ValuePolicy.
+func WriteJSONOnceWithConfig(c JSONConfig) error {
+	b, err := marshalJSON(c.Registry, valuePolicy(c.ValuePolicy))
+	if nil != err {
+		return err
+	}
+	_, err = c.Writer.Write(append(b, '\n'))
+	return err
+}
@@ -2,6 +2,7 @@ package librato
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -65,7 +66,13 @@ type Batch struct {
 	Source      string        `json:"source"`
 }
 
-func (self *LibratoClient) PostMetrics(batch Batch) (err error) {
+func (self *LibratoClient) PostMetrics(batch Batch) error {
+	return self.PostMetricsContext(context.Background(), batch)
+}
+
+// PostMetricsContext posts a batch just like PostMetrics, but abandons the
+// request once ctx is done.
+func (self *LibratoClient) PostMetricsContext(ctx context.Context, batch Batch) (err error) {
 	var (
 		js   []byte
 		req  *http.Request
@@ -84,12 +91,14 @@ func (self *LibratoClient) PostMetrics(batch Batch) (err error) {
 		return
 	}
 
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
 	req.SetBasicAuth(self.Email, self.Token)
 
 	if resp, err = http.DefaultClient.Do(req); err != nil {
 		return
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		var body []byte
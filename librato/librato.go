@@ -1,7 +1,10 @@
 package librato
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"regexp"
@@ -28,11 +31,14 @@ type Reporter struct {
 	Registry        metrics.Registry
 	Percentiles     []float64              // percentiles to report on histogram metrics
 	TimerAttributes map[string]interface{} // units in which timers will be displayed
+	FlushTimeout    time.Duration          // deadline for each post; zero means Interval
+	DryRun          io.Writer              // if not nil, receives the JSON bodies instead of librato
+	ValuePolicy     *metrics.ValuePolicy   // NaN, ±Inf and negative value handling; nil means metrics.DefaultValuePolicy
 	intervalSec     int64
 }
 
 func NewReporter(r metrics.Registry, d time.Duration, e string, t string, s string, p []float64, u time.Duration) *Reporter {
-	return &Reporter{e, t, s, d, r, p, translateTimerAttributes(u), int64(d / time.Second)}
+	return &Reporter{e, t, s, d, r, p, translateTimerAttributes(u), 0, nil, nil, int64(d / time.Second)}
 }
 
 func Librato(r metrics.Registry, d time.Duration, e string, t string, s string, p []float64, u time.Duration) {
@@ -40,23 +46,59 @@ func Librato(r metrics.Registry, d time.Duration, e string, t string, s string,
 }
 
 func (self *Reporter) Run() {
+	self.RunContext(context.Background())
+}
+
+// RunContext reports just like Run, but returns once ctx is done, abandoning
+// any post in progress.  Posts which outlast FlushTimeout are counted by
+// metrics.FlushTimeouts in the reporter's registry.
+func (self *Reporter) RunContext(ctx context.Context) {
 	log.Printf("WARNING: This client has been DEPRECATED! It has been moved to https://github.com/mihasya/go-metrics-librato and will be removed from rcrowley/go-metrics on August 5th 2015")
-	ticker := time.Tick(self.Interval)
+	ticker := time.NewTicker(self.Interval)
+	defer ticker.Stop()
 	metricsApi := &LibratoClient{self.Email, self.Token}
-	for now := range ticker {
-		var metrics Batch
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		var batch Batch
 		var err error
-		if metrics, err = self.BuildRequest(now, self.Registry); err != nil {
+		if batch, err = self.BuildRequest(now, self.Registry); err != nil {
 			log.Printf("ERROR constructing librato request body %s", err)
+			metrics.EmitEvent(metrics.Event{Type: metrics.EventReporterError, Name: "librato", Err: err})
 			continue
 		}
-		if err := metricsApi.PostMetrics(metrics); err != nil {
+		if err := self.post(ctx, metricsApi, batch); err != nil && nil == ctx.Err() {
 			log.Printf("ERROR sending metrics to librato %s", err)
+			metrics.EmitEvent(metrics.Event{Type: metrics.EventReporterError, Name: "librato", Err: err})
 			continue
 		}
 	}
 }
 
+func (self *Reporter) post(ctx context.Context, metricsApi *LibratoClient, batch Batch) error {
+	if nil != self.DryRun {
+		if 0 == len(batch.Counters) && 0 == len(batch.Gauges) {
+			return nil
+		}
+		return json.NewEncoder(self.DryRun).Encode(batch)
+	}
+	timeout := self.FlushTimeout
+	if 0 == timeout {
+		timeout = self.Interval
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := metricsApi.PostMetricsContext(ctx, batch)
+	if metrics.IsFlushTimeout(ctx, err) {
+		metrics.FlushTimeouts(self.Registry).Inc(1)
+	}
+	return err
+}
+
 // calculate sum of squares from data provided by metrics.Histogram
 // see http://en.wikipedia.org/wiki/Standard_deviation#Rapid_calculation_methods
 func sumSquares(s metrics.Sample) float64 {
@@ -78,6 +120,20 @@ func sumSquaresTimer(t metrics.Timer) float64 {
 	return sumSquares
 }
 
+// value applies the reporter's ValuePolicy to v.  JSON has no representation
+// for NaN or ±Inf so they are dropped even when the policy exports them.
+func (self *Reporter) value(v float64) (float64, bool) {
+	policy := metrics.DefaultValuePolicy
+	if nil != self.ValuePolicy {
+		policy = *self.ValuePolicy
+	}
+	v, ok := policy.Float(v)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
 func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot Batch, err error) {
 	snapshot = Batch{
 		// coerce timestamps to a stepping fn so that they line up in Librato graphs
@@ -103,16 +159,42 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 				snapshot.Counters = append(snapshot.Counters, measurement)
 			}
 		case metrics.Gauge:
-			measurement[Name] = name
-			measurement[Value] = float64(m.Value())
-			snapshot.Gauges = append(snapshot.Gauges, measurement)
+			if v, ok := self.value(float64(m.Value())); ok {
+				measurement[Name] = name
+				measurement[Value] = v
+				snapshot.Gauges = append(snapshot.Gauges, measurement)
+			}
 		case metrics.GaugeFloat64:
-			measurement[Name] = name
-			measurement[Value] = float64(m.Value())
-			snapshot.Gauges = append(snapshot.Gauges, measurement)
+			if v, ok := self.value(m.Value()); ok {
+				measurement[Name] = name
+				measurement[Value] = v
+				snapshot.Gauges = append(snapshot.Gauges, measurement)
+			}
 		case metrics.Histogram:
 			if m.Count() > 0 {
-				gauges := make([]Measurement, histogramGaugeCount, histogramGaugeCount)
+				gauges := make([]Measurement, 1, histogramGaugeCount)
+				s := m.Sample()
+				measurement[Name] = fmt.Sprintf("%s.%s", name, "hist")
+				measurement[Count] = uint64(s.Count())
+				measurement[Max] = float64(s.Max())
+				measurement[Min] = float64(s.Min())
+				measurement[Sum] = float64(s.Sum())
+				measurement[SumSquares] = sumSquares(s)
+				gauges[0] = measurement
+				for _, p := range self.Percentiles {
+					if v, ok := self.value(s.Percentile(p)); ok {
+						gauges = append(gauges, Measurement{
+							Name:   fmt.Sprintf("%s.%.2f", measurement[Name], p),
+							Value:  v,
+							Period: measurement[Period],
+						})
+					}
+				}
+				snapshot.Gauges = append(snapshot.Gauges, gauges...)
+			}
+		case metrics.DurationHistogram:
+			if m.Count() > 0 {
+				gauges := make([]Measurement, 1, histogramGaugeCount)
 				s := m.Sample()
 				measurement[Name] = fmt.Sprintf("%s.%s", name, "hist")
 				measurement[Count] = uint64(s.Count())
@@ -120,12 +202,16 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 				measurement[Min] = float64(s.Min())
 				measurement[Sum] = float64(s.Sum())
 				measurement[SumSquares] = sumSquares(s)
+				measurement[Attributes] = self.TimerAttributes
 				gauges[0] = measurement
-				for i, p := range self.Percentiles {
-					gauges[i+1] = Measurement{
-						Name:   fmt.Sprintf("%s.%.2f", measurement[Name], p),
-						Value:  s.Percentile(p),
-						Period: measurement[Period],
+				for _, p := range self.Percentiles {
+					if v, ok := self.value(s.Percentile(p)); ok {
+						gauges = append(gauges, Measurement{
+							Name:       fmt.Sprintf("%s.%.2f", measurement[Name], p),
+							Value:      v,
+							Period:     measurement[Period],
+							Attributes: self.TimerAttributes,
+						})
 					}
 				}
 				snapshot.Gauges = append(snapshot.Gauges, gauges...)
@@ -166,13 +252,61 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 					},
 				},
 			)
+		case metrics.Summary:
+			s := m.Snapshot()
+			measurement[Name] = name
+			measurement[Value] = float64(s.Count())
+			snapshot.Counters = append(snapshot.Counters, measurement)
+			if s.Count() > 0 {
+				qs := s.Quantiles()
+				for i, q := range s.Objectives() {
+					if v, ok := self.value(qs[i]); ok {
+						snapshot.Gauges = append(snapshot.Gauges, Measurement{
+							Name:   fmt.Sprintf("%s.%.2f", name, q),
+							Value:  v,
+							Period: int64(self.Interval.Seconds()),
+						})
+					}
+				}
+			}
+		case metrics.StagedTimer:
+			t := m.Snapshot()
+			for _, stage := range append(t.Stages(), metrics.TotalStage) {
+				h := t.Stage(stage)
+				if 0 == h.Count() {
+					continue
+				}
+				gauges := make([]Measurement, 1, histogramGaugeCount)
+				s := h.Sample()
+				measurement := Measurement{}
+				measurement[Period] = self.Interval.Seconds()
+				measurement[Name] = fmt.Sprintf("%s.%s.%s", name, stage, "hist")
+				measurement[Count] = uint64(s.Count())
+				measurement[Max] = float64(s.Max())
+				measurement[Min] = float64(s.Min())
+				measurement[Sum] = float64(s.Sum())
+				measurement[SumSquares] = sumSquares(s)
+				measurement[Attributes] = self.TimerAttributes
+				gauges[0] = measurement
+				for _, p := range self.Percentiles {
+					if v, ok := self.value(s.Percentile(p)); ok {
+						gauges = append(gauges, Measurement{
+							Name:       fmt.Sprintf("%s.%.2f", measurement[Name], p),
+							Value:      v,
+							Period:     measurement[Period],
+							Attributes: self.TimerAttributes,
+						})
+					}
+				}
+				snapshot.Gauges = append(snapshot.Gauges, gauges...)
+			}
 		case metrics.Timer:
 			measurement[Name] = name
 			measurement[Value] = float64(m.Count())
 			snapshot.Counters = append(snapshot.Counters, measurement)
 			if m.Count() > 0 {
 				libratoName := fmt.Sprintf("%s.%s", name, "timer.mean")
-				gauges := make([]Measurement, histogramGaugeCount, histogramGaugeCount)
+				gauges := make([]Measurement, 1, histogramGaugeCount)
 				gauges[0] = Measurement{
 					Name:       libratoName,
 					Count:      uint64(m.Count()),
@@ -183,12 +317,14 @@ func (self *Reporter) BuildRequest(now time.Time, r metrics.Registry) (snapshot
 					Period:     int64(self.Interval.Seconds()),
 					Attributes: self.TimerAttributes,
 				}
-				for i, p := range self.Percentiles {
-					gauges[i+1] = Measurement{
-						Name:       fmt.Sprintf("%s.timer.%2.0f", name, p*100),
-						Value:      m.Percentile(p),
-						Period:     int64(self.Interval.Seconds()),
-						Attributes: self.TimerAttributes,
+				for _, p := range self.Percentiles {
+					if v, ok := self.value(m.Percentile(p)); ok {
+						gauges = append(gauges, Measurement{
+							Name:       fmt.Sprintf("%s.timer.%2.0f", name, p*100),
+							Value:      v,
+							Period:     int64(self.Interval.Seconds()),
+							Attributes: self.TimerAttributes,
+						})
 					}
 				}
 				snapshot.Gauges = append(snapshot.Gauges, gauges...)
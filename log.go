@@ -2,42 +2,98 @@ package metrics
 
 import (
 	"log"
+	"strconv"
 	"time"
 )
 
+// LogConfig provides a container with configuration parameters for the Log
+// reporter.
+type LogConfig struct {
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	Logger        *log.Logger   // Logger to which metrics are written
+	ValuePolicy   *ValuePolicy  // NaN, ±Inf and negative value handling; nil means DefaultValuePolicy
+}
+
 // Output each metric in the given registry periodically using the given
 // logger.
 func Log(r Registry, d time.Duration, l *log.Logger) {
-	for _ = range time.Tick(d) {
+	LogWithConfig(LogConfig{Registry: r, FlushInterval: d, Logger: l})
+}
+
+// LogWithConfig is a blocking reporter function just like Log, but it takes
+// a LogConfig instead.  Values its ValuePolicy rejects are left out.
+func LogWithConfig(c LogConfig) {
+	r, l, policy := c.Registry, c.Logger, valuePolicy(c.ValuePolicy)
+	putInt := func(format, key string, v int64) {
+		if v, ok := policy.Int(v); ok {
+			l.Printf(format, key, v)
+		}
+	}
+	putFloat := func(format, key string, v float64) {
+		if v, ok := policy.Float(v); ok {
+			l.Printf(format, key, v)
+		}
+	}
+	putDuration := func(format, key string, d time.Duration) {
+		if v, ok := policy.Int(int64(d)); ok {
+			l.Printf(format, key, time.Duration(v))
+		}
+	}
+	for _ = range tick("log", priorityReport, c.FlushInterval) {
 		r.Each(func(name string, i interface{}) {
 			switch metric := i.(type) {
 			case Counter:
 				l.Printf("counter %s\n", name)
 				l.Printf("  count:       %9d\n", metric.Count())
+			case CounterFloat64:
+				l.Printf("counter %s\n", name)
+				putFloat("  %-13s%f\n", "count:", metric.Count())
 			case Gauge:
 				l.Printf("gauge %s\n", name)
-				l.Printf("  value:       %9d\n", metric.Value())
+				putInt("  %-13s%9d\n", "value:", metric.Value())
 			case GaugeFloat64:
 				l.Printf("gauge %s\n", name)
-				l.Printf("  value:       %f\n", metric.Value())
+				putFloat("  %-13s%f\n", "value:", metric.Value())
 			case Healthcheck:
 				metric.Check()
 				l.Printf("healthcheck %s\n", name)
 				l.Printf("  error:       %v\n", metric.Error())
 			case Histogram:
 				h := metric.Snapshot()
-				ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+				percentiles := ExportedPercentiles(r, i)
+				ps := h.Percentiles(percentiles)
 				l.Printf("histogram %s\n", name)
 				l.Printf("  count:       %9d\n", h.Count())
-				l.Printf("  min:         %9d\n", h.Min())
-				l.Printf("  max:         %9d\n", h.Max())
-				l.Printf("  mean:        %12.2f\n", h.Mean())
-				l.Printf("  stddev:      %12.2f\n", h.StdDev())
-				l.Printf("  median:      %12.2f\n", ps[0])
-				l.Printf("  75%%:         %12.2f\n", ps[1])
-				l.Printf("  95%%:         %12.2f\n", ps[2])
-				l.Printf("  99%%:         %12.2f\n", ps[3])
-				l.Printf("  99.9%%:       %12.2f\n", ps[4])
+				putInt("  %-13s%9d\n", "sum:", h.Sum())
+				putInt("  %-13s%9d\n", "min:", h.Min())
+				putInt("  %-13s%9d\n", "max:", h.Max())
+				putFloat("  %-13s%12.2f\n", "mean:", h.Mean())
+				putFloat("  %-13s%12.2f\n", "stddev:", h.StdDev())
+				for j, p := range percentiles {
+					putFloat("  %-13s%12.2f\n", percentileLabel(p)+":", ps[j])
+				}
+			case DurationHistogram:
+				h := metric.Snapshot()
+				percentiles := ExportedPercentiles(r, i)
+				ps := h.Percentiles(percentiles)
+				l.Printf("duration histogram %s\n", name)
+				l.Printf("  count:       %9d\n", h.Count())
+				putDuration("  %-13s%12v\n", "sum:", h.Sum())
+				putDuration("  %-13s%12v\n", "min:", h.Min())
+				putDuration("  %-13s%12v\n", "max:", h.Max())
+				putDuration("  %-13s%12v\n", "mean:", h.Mean())
+				putDuration("  %-13s%12v\n", "stddev:", h.StdDev())
+				for j, p := range percentiles {
+					putDuration("  %-13s%12v\n", percentileLabel(p)+":", ps[j])
+				}
+			case Histogram2D:
+				h := metric.Snapshot()
+				l.Printf("histogram2d %s\n", name)
+				l.Printf("  count:       %9d\n", h.Count())
+				eachHistogram2DCell(h, func(x, y string, count int64) {
+					l.Printf("  %-24s %9d\n", "x<="+x+" y<="+y+":", count)
+				})
 			case Meter:
 				m := metric.Snapshot()
 				l.Printf("meter %s\n", name)
@@ -46,20 +102,45 @@ func Log(r Registry, d time.Duration, l *log.Logger) {
 				l.Printf("  5-min rate:  %12.2f\n", m.Rate5())
 				l.Printf("  15-min rate: %12.2f\n", m.Rate15())
 				l.Printf("  mean rate:   %12.2f\n", m.RateMean())
+			case Summary:
+				s := metric.Snapshot()
+				l.Printf("summary %s\n", name)
+				l.Printf("  count:       %9d\n", s.Count())
+				putFloat("  %-13s%12.2f\n", "sum:", s.Sum())
+				qs := s.Quantiles()
+				for i, q := range s.Objectives() {
+					putFloat("  %-12s %12.2f\n", strconv.FormatFloat(q*100.0, 'f', -1, 64)+"%:", qs[i])
+				}
+			case StagedTimer:
+				l.Printf("staged timer %s\n", name)
+				eachStage(metric.Snapshot(), func(stage string, h DurationHistogram) {
+					percentiles := ExportedPercentiles(r, h)
+					ps := h.Percentiles(percentiles)
+					l.Printf("  stage %s\n", stage)
+					l.Printf("    count:     %9d\n", h.Count())
+					putDuration("    %-11s%12v\n", "sum:", h.Sum())
+					putDuration("    %-11s%12v\n", "min:", h.Min())
+					putDuration("    %-11s%12v\n", "max:", h.Max())
+					putDuration("    %-11s%12v\n", "mean:", h.Mean())
+					putDuration("    %-11s%12v\n", "stddev:", h.StdDev())
+					for j, p := range percentiles {
+						putDuration("    %-11s%12v\n", percentileLabel(p)+":", ps[j])
+					}
+				})
 			case Timer:
 				t := metric.Snapshot()
-				ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+				percentiles := ExportedPercentiles(r, i)
+				ps := t.Percentiles(percentiles)
 				l.Printf("timer %s\n", name)
 				l.Printf("  count:       %9d\n", t.Count())
-				l.Printf("  min:         %9d\n", t.Min())
-				l.Printf("  max:         %9d\n", t.Max())
-				l.Printf("  mean:        %12.2f\n", t.Mean())
-				l.Printf("  stddev:      %12.2f\n", t.StdDev())
-				l.Printf("  median:      %12.2f\n", ps[0])
-				l.Printf("  75%%:         %12.2f\n", ps[1])
-				l.Printf("  95%%:         %12.2f\n", ps[2])
-				l.Printf("  99%%:         %12.2f\n", ps[3])
-				l.Printf("  99.9%%:       %12.2f\n", ps[4])
+				putInt("  %-13s%9d\n", "sum:", t.Sum())
+				putInt("  %-13s%9d\n", "min:", t.Min())
+				putInt("  %-13s%9d\n", "max:", t.Max())
+				putFloat("  %-13s%12.2f\n", "mean:", t.Mean())
+				putFloat("  %-13s%12.2f\n", "stddev:", t.StdDev())
+				for j, p := range percentiles {
+					putFloat("  %-13s%12.2f\n", percentileLabel(p)+":", ps[j])
+				}
 				l.Printf("  1-min rate:  %12.2f\n", t.Rate1())
 				l.Printf("  5-min rate:  %12.2f\n", t.Rate5())
 				l.Printf("  15-min rate: %12.2f\n", t.Rate15())
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"reflect"
+	"time"
+)
+
+// registryEntryOverhead approximates the bytes a registry spends on each
+// entry beyond its name and metric: a map bucket slot holding the string
+// header and interface value, counted once per copy-on-write map.
+const registryEntryOverhead = 48
+
+// EstimateMetricMemory returns an approximation of the bytes of heap used by
+// the given metric, including its sample reservoirs, quantile streams, and
+// bucket grids.  Metrics of types this package doesn't define are counted as
+// the size of their struct alone.
+func EstimateMetricMemory(i interface{}) int64 {
+	var n int64
+	if v := reflect.ValueOf(i); reflect.Ptr == v.Kind() && !v.IsNil() {
+		n = int64(v.Elem().Type().Size())
+	}
+	switch metric := i.(type) {
+	case *StandardDurationHistogram:
+		n += EstimateMetricMemory(metric.sample)
+	case *StandardHistogram:
+		n += EstimateMetricMemory(metric.sample)
+	case *StandardHistogram2D:
+		n += int64(len(metric.counts)+len(metric.xBounds)+len(metric.yBounds)) * 8
+	case *StandardMeter:
+		n += EstimateMetricMemory(metric.a1) + EstimateMetricMemory(metric.a5) + EstimateMetricMemory(metric.a15)
+		n += int64(reflect.TypeOf(MeterSnapshot{}).Size())
+		n += int64(len(metric.shards)) * int64(reflect.TypeOf(counterShard{}).Size())
+	case *ShardedCounter:
+		n += int64(len(metric.shards)) * int64(reflect.TypeOf(counterShard{}).Size())
+	case *StandardStagedTimer:
+		n += EstimateMetricMemory(metric.total)
+		metric.mutex.RLock()
+		for stage, h := range metric.stages {
+			n += int64(len(stage)) + registryEntryOverhead + EstimateMetricMemory(h)
+		}
+		metric.mutex.RUnlock()
+	case *StandardSummary:
+		metric.mutex.Lock()
+		for _, stream := range metric.streams {
+			n += int64(reflect.TypeOf(quantileStream{}).Size())
+			n += int64(cap(stream.samples)) * int64(reflect.TypeOf(quantileSample{}).Size())
+			n += int64(cap(stream.buffer)) * 8
+		}
+		metric.mutex.Unlock()
+	case *StandardTimer:
+		n += EstimateMetricMemory(metric.histogram) + EstimateMetricMemory(metric.meter)
+	case *HdrSample:
+		n += int64(len(metric.counts)) * 8
+	case *ExpDecaySample:
+		n += int64(metric.reservoirSize) * int64(reflect.TypeOf(expDecaySample{}).Size())
+		n += EstimateMetricMemory(metric.rand)
+	case *SlidingWindowSample:
+		n += int64(metric.reservoirSize) * 8
+	case *SlidingTimeWindowSample:
+		metric.mutex.Lock()
+		n += int64(cap(metric.times)+cap(metric.values)) * 8
+		metric.mutex.Unlock()
+	case *UniformSample:
+		n += int64(metric.reservoirSize) * 8
+		n += EstimateMetricMemory(metric.rand)
+	case interface {
+		unwrapMetric() interface{}
+	}:
+		n += EstimateMetricMemory(metric.unwrapMetric())
+	}
+	return n
+}
+
+// estimateEntryMemory returns an approximation of the bytes of heap used by
+// a registry entry: its name, its metric, and the registry's bookkeeping.
+func estimateEntryMemory(name string, i interface{}) int64 {
+	return int64(len(name)) + registryEntryOverhead + EstimateMetricMemory(i)
+}
+
+// CaptureMemoryEstimate updates the "metrics.EstimatedMemory" gauge in the
+// given registry with its own estimated memory use periodically.  This is
+// designed to be called as a goroutine.
+func CaptureMemoryEstimate(r Registry, d time.Duration) {
+	for _ = range tick("metrics.EstimatedMemory", priorityCollect, d) {
+		CaptureMemoryEstimateOnce(r)
+	}
+}
+
+// CaptureMemoryEstimateOnce updates the "metrics.EstimatedMemory" gauge in
+// the given registry, registering it if need be, with the registry's
+// estimated memory use so that operators can see when the cardinality of
+// their metrics is eating into the heap.
+func CaptureMemoryEstimateOnce(r Registry) {
+	GetOrRegisterGauge("metrics.EstimatedMemory", r).Update(r.EstimateMemory())
+}
@@ -0,0 +1,82 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func BenchmarkEstimateMemory(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < 100; i++ {
+		NewRegisteredTimer(string(rune('a'+i%26))+string(rune('a'+i/26)), r)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.EstimateMemory()
+	}
+}
+
+func TestEstimateMetricMemoryReservoir(t *testing.T) {
+	small := EstimateMetricMemory(NewHistogram(NewUniformSample(10)))
+	large := EstimateMetricMemory(NewHistogram(NewUniformSample(1000)))
+	if n := large - small; 990*8 != n {
+		t.Errorf("large - small: 7920 != %v\n", n)
+	}
+}
+
+func TestEstimateMetricMemoryTimer(t *testing.T) {
+	timer := NewTimer()
+	histogram := NewHistogram(NewExpDecaySample(defaultSampleSize, 0.015))
+	if n, m := EstimateMetricMemory(timer), EstimateMetricMemory(histogram); n <= m {
+		t.Errorf("EstimateMetricMemory(timer): %v <= %v\n", n, m)
+	}
+}
+
+func TestEstimateMetricMemoryTenant(t *testing.T) {
+	tenant := NewRegistry().Tenant("acme")
+	c := GetOrRegisterCounterFloat64("foo", tenant)
+	if _, ok := c.(*tenantCounterFloat64); !ok {
+		t.Fatalf("GetOrRegisterCounterFloat64(\"foo\", tenant): %T\n", c)
+	}
+	if n, m := EstimateMetricMemory(c), EstimateMetricMemory(NewCounterFloat64()); n <= m {
+		t.Errorf("EstimateMetricMemory(c): %v <= %v\n", n, m)
+	}
+}
+
+func TestEstimateMetricMemoryNil(t *testing.T) {
+	if n := EstimateMetricMemory(NilCounter{}); 0 != n {
+		t.Errorf("EstimateMetricMemory(NilCounter{}): 0 != %v\n", n)
+	}
+}
+
+func TestRegistryEstimateMemory(t *testing.T) {
+	r := NewRegistry()
+	empty := r.EstimateMemory()
+	h := NewHistogram(NewUniformSample(100))
+	r.Register("foo", h)
+	n := r.EstimateMemory() - empty
+	if m := EstimateMetricMemory(h) + 3 + registryEntryOverhead; m != n {
+		t.Errorf("r.EstimateMemory(): %v != %v\n", m, n)
+	}
+}
+
+func TestPrefixedRegistryEstimateMemory(t *testing.T) {
+	r := NewPrefixedRegistry("prefix.")
+	NewRegisteredHistogram("foo", r, NewUniformSample(100))
+	if m, n := r.(*PrefixedRegistry).underlying.EstimateMemory(), r.EstimateMemory(); m != n {
+		t.Errorf("r.EstimateMemory(): %v != %v\n", m, n)
+	}
+}
+
+func TestCaptureMemoryEstimateOnce(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredHistogram("foo", r, NewUniformSample(100))
+	CaptureMemoryEstimateOnce(r)
+	g, ok := r.Get("metrics.EstimatedMemory").(Gauge)
+	if !ok {
+		t.Fatal("metrics.EstimatedMemory not registered")
+	}
+	if v := g.Value(); v < 800 {
+		t.Errorf("g.Value(): 800 > %v\n", v)
+	}
+}
@@ -2,19 +2,47 @@ package metrics
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
 )
 
 // Meters count events to produce exponentially-weighted moving average rates
 // at one-, five-, and fifteen-minutes and a mean rate.
-type Meter interface {
-	Count() int64
-	Mark(int64)
-	Rate1() float64
-	Rate5() float64
-	Rate15() float64
-	RateMean() float64
-	Snapshot() Meter
+type Meter = metricsiface.Meter
+
+// MeterFloat64s are Meters which may also be marked with fractional numbers
+// of events, such as amounts of money, whose moving averages are of the
+// amounts marked.  StandardMeter, its snapshots, and NilMeter are all
+// MeterFloat64s, so a Meter from NewMeter may be asserted to be one.
+type MeterFloat64 interface {
+	Meter
+	CountFloat() float64
+	MarkFloat(float64)
+}
+
+// A WindowSet is a meter or timer which knows the windows its Rate1, Rate5,
+// and Rate15 moving averages are over, as the standard meters and timers and
+// their snapshots do.
+type WindowSet interface {
+	Windows() []time.Duration
+}
+
+// DefaultWindows are the windows of a meter's Rate1, Rate5, and Rate15
+// moving averages unless it's a WindowSet saying otherwise.
+var DefaultWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// MeterWindows returns the windows of the given meter's Rate1, Rate5, and
+// Rate15 moving averages, so that exporters may label rates with their
+// actual windows: its own, if it's a WindowSet, or else DefaultWindows.
+func MeterWindows(i interface{}) []time.Duration {
+	if s, ok := unwrap(i).(WindowSet); ok {
+		if ws := s.Windows(); nil != ws {
+			return ws
+		}
+	}
+	return DefaultWindows
 }
 
 // GetOrRegisterMeter returns an existing Meter or constructs and registers a
@@ -26,22 +54,103 @@ func GetOrRegisterMeter(name string, r Registry) Meter {
 	return r.GetOrRegister(name, NewMeter).(Meter)
 }
 
-// NewMeter constructs a new StandardMeter and launches a goroutine.
+// NewMeter constructs a new StandardMeter ticked by DefaultTickSource, which
+// launches a goroutine unless it has been replaced.
 func NewMeter() Meter {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
+		return NilMeter{}
+	}
+	m := newStandardMeter()
+	m.tickBy(DefaultTickSource)
+	return m
+}
+
+// NewMeterWithTickSource constructs a new StandardMeter which is ticked by
+// the given TickSource.
+func NewMeterWithTickSource(ts TickSource) Meter {
+	if metricsDisabled || UseNilMetrics {
 		return NilMeter{}
 	}
 	m := newStandardMeter()
-	arbiter.Lock()
-	defer arbiter.Unlock()
-	arbiter.meters = append(arbiter.meters, m)
-	if !arbiter.started {
-		arbiter.started = true
-		go arbiter.tick()
+	m.tickBy(ts)
+	return m
+}
+
+// NewBurstLimitedMeter constructs a new StandardMeter ticked by
+// DefaultTickSource whose moving averages account for at most b.Limit events
+// per tick.  The count and mean rate are not limited.
+func NewBurstLimitedMeter(b BurstPolicy) Meter {
+	if metricsDisabled || UseNilMetrics {
+		return NilMeter{}
 	}
+	m := newStandardMeter()
+	m.a1 = newWindowedEWMA(time.Minute, b)
+	m.a5 = newWindowedEWMA(5*time.Minute, b)
+	m.a15 = newWindowedEWMA(15*time.Minute, b)
+	m.tickBy(DefaultTickSource)
 	return m
 }
 
+// A CounterSource reads a monotonically increasing count of events kept
+// outside the process, such as a packet counter in an eBPF map or a network
+// interface's statistics read via netlink.
+type CounterSource interface {
+	ReadCount() (uint64, error)
+}
+
+// CounterSourceFunc adapts an ordinary function to a CounterSource.
+type CounterSourceFunc func() (uint64, error)
+
+// ReadCount calls f().
+func (f CounterSourceFunc) ReadCount() (uint64, error) { return f() }
+
+// GetOrRegisterSourcedMeter returns an existing Meter or constructs and
+// registers a new StandardMeter which reads its events from a CounterSource.
+func GetOrRegisterSourcedMeter(name string, r Registry, s CounterSource) Meter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() Meter {
+		return NewSourcedMeter(s)
+	}).(Meter)
+}
+
+// NewSourcedMeter constructs a new StandardMeter ticked by DefaultTickSource
+// which, before each tick, marks as many events as the CounterSource's count
+// has grown by since the last tick, so that counters kept by the kernel get
+// the same moving averages as those kept in-process.  The meter counts from
+// the first count read from the source, when it's constructed if possible.
+// A count which goes backwards is taken to have been reset to zero, and one
+// which can't be read is read again on the next tick.  Mark may still be
+// called to add events of its own.
+//
+// The source is read on a goroutine of its own and a tick waits at most
+// sourceReadTimeout for it, so that a source which blocks doesn't hold up
+// the ticking of every other meter.  A read which returns later marks its
+// events then, and they're fed to the moving averages on the next tick; the
+// source isn't read again until it has returned.
+func NewSourcedMeter(s CounterSource) Meter {
+	if metricsDisabled || UseNilMetrics {
+		return NilMeter{}
+	}
+	m := newStandardMeter()
+	m.source = s
+	m.readSource()
+	m.tickBy(DefaultTickSource)
+	return m
+}
+
+// NewRegisteredSourcedMeter constructs and registers a new StandardMeter
+// which reads its events from a CounterSource.
+func NewRegisteredSourcedMeter(name string, r Registry, s CounterSource) Meter {
+	c := NewSourcedMeter(s)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
 // NewMeter constructs and registers a new StandardMeter and launches a
 // goroutine.
 func NewRegisteredMeter(name string, r Registry) Meter {
@@ -56,17 +165,36 @@ func NewRegisteredMeter(name string, r Registry) Meter {
 // MeterSnapshot is a read-only copy of another Meter.
 type MeterSnapshot struct {
 	count                          int64
+	countFloat                     float64
 	rate1, rate5, rate15, rateMean float64
+	windows                        []time.Duration // nil if unknown
 }
 
 // Count returns the count of events at the time the snapshot was taken.
 func (m *MeterSnapshot) Count() int64 { return m.count }
 
+// CountFloat returns the count of events, fractions included, at the time
+// the snapshot was taken.
+func (m *MeterSnapshot) CountFloat() float64 { return m.countFloat }
+
+// GoString formats the statistics of the snapshot for %#v.
+func (m *MeterSnapshot) GoString() string { return goString("MeterSnapshot", meterString(m)) }
+
 // Mark panics.
 func (*MeterSnapshot) Mark(n int64) {
 	panic("Mark called on a MeterSnapshot")
 }
 
+// MarkAt panics.
+func (*MeterSnapshot) MarkAt(int64, time.Time) {
+	panic("MarkAt called on a MeterSnapshot")
+}
+
+// MarkFloat panics.
+func (*MeterSnapshot) MarkFloat(float64) {
+	panic("MarkFloat called on a MeterSnapshot")
+}
+
 // Rate1 returns the one-minute moving average rate of events per second at the
 // time the snapshot was taken.
 func (m *MeterSnapshot) Rate1() float64 { return m.rate1 }
@@ -86,15 +214,31 @@ func (m *MeterSnapshot) RateMean() float64 { return m.rateMean }
 // Snapshot returns the snapshot.
 func (m *MeterSnapshot) Snapshot() Meter { return m }
 
+// Windows returns the windows of the moving averages of the meter the
+// snapshot was taken of, or nil if they aren't known.
+func (m *MeterSnapshot) Windows() []time.Duration { return m.windows }
+
+// String formats the count and rates for debugging.
+func (m *MeterSnapshot) String() string { return meterString(m) }
+
 // NilMeter is a no-op Meter.
 type NilMeter struct{}
 
 // Count is a no-op.
 func (NilMeter) Count() int64 { return 0 }
 
+// CountFloat is a no-op.
+func (NilMeter) CountFloat() float64 { return 0.0 }
+
 // Mark is a no-op.
 func (NilMeter) Mark(n int64) {}
 
+// MarkAt is a no-op.
+func (NilMeter) MarkAt(n int64, t time.Time) {}
+
+// MarkFloat is a no-op.
+func (NilMeter) MarkFloat(v float64) {}
+
 // Rate1 is a no-op.
 func (NilMeter) Rate1() float64 { return 0.0 }
 
@@ -112,10 +256,38 @@ func (NilMeter) Snapshot() Meter { return NilMeter{} }
 
 // StandardMeter is the standard implementation of a Meter.
 type StandardMeter struct {
+	count       atomic.Int64
+	shards      counterShards         // if not nil, where Mark counts, for NewShardedMeter
+	fraction    atomicNumber[float64] // the total of MarkFloat's events
 	lock        sync.RWMutex
 	snapshot    *MeterSnapshot
 	a1, a5, a15 EWMA
+	restored    int64 // restored from a checkpoint, so not in the mean rate
 	startTime   time.Time
+
+	// ticked and tickedFraction are the count and the total of MarkFloat's
+	// events last fed to the moving averages, guarded by lock.
+	ticked         int64
+	tickedFraction float64
+
+	// foldPending is set by SetFoldPending.
+	foldPending atomic.Bool
+
+	// lazy, if not nil, is how many ticks are due when the meter is read,
+	// for meters ticked by a LazyTickSource.
+	lazy *lazyTicks
+
+	// source, if not nil, is read before every tick and sourceCount holds
+	// the count last read from it, guarded by lock.  sourceReading is set
+	// while a read is in flight.
+	source        CounterSource
+	sourceCount   uint64
+	sourceRead    bool
+	sourceReading atomic.Bool
+
+	// ticks is the TickSource ticking the meter until it's stopped,
+	// guarded by lock.
+	ticks TickSource
 }
 
 func newStandardMeter() *StandardMeter {
@@ -128,27 +300,85 @@ func newStandardMeter() *StandardMeter {
 	}
 }
 
-// Count returns the number of events recorded.
+// Count returns the number of events recorded, those marked by MarkFloat
+// included but truncated to a whole number.
 func (m *StandardMeter) Count() int64 {
-	m.lock.RLock()
-	count := m.snapshot.count
-	m.lock.RUnlock()
-	return count
+	return m.loadCount() + int64(m.fraction.load())
+}
+
+// loadCount returns the number of whole events recorded, summing the
+// meter's shards if it has them.
+func (m *StandardMeter) loadCount() int64 {
+	return m.count.Load() + m.shards.sum()
 }
 
-// Mark records the occurance of n events.
+// CountFloat returns the number of events recorded, fractions included.
+func (m *StandardMeter) CountFloat() float64 {
+	return float64(m.loadCount()) + m.fraction.load()
+}
+
+// Mark records the occurance of n events.  It never blocks: the count is
+// updated atomically, and the mean rate is refreshed only if no other
+// goroutine holds the meter's lock, and otherwise by the next Mark or tick.
+// The moving averages are fed the events counted since the last tick on
+// each tick.  A sharded meter's Mark adds to one of its shards alone.
 func (m *StandardMeter) Mark(n int64) {
+	if nil != m.shards {
+		m.shards.add(n)
+		return
+	}
+	m.count.Add(n)
+	if m.lock.TryLock() {
+		m.updateMean()
+		m.lock.Unlock()
+	}
+}
+
+// MarkAt records the occurance of n events at the given time, such as in a
+// batch processed a little late.  Events since the meter's last tick are
+// marked as by Mark, but events before it are added to the moving averages
+// as StandardEWMA's UpdateAt adds them, so that the rates are as they would
+// have been had the events been marked on time.
+func (m *StandardMeter) MarkAt(n int64, t time.Time) {
+	m.tickLazily()
 	m.lock.Lock()
+	if a1, ok := m.a1.(*StandardEWMA); !ok || !a1.isLate(t) {
+		m.lock.Unlock()
+		m.Mark(n)
+		return
+	}
 	defer m.lock.Unlock()
-	m.snapshot.count += n
-	m.a1.Update(n)
-	m.a5.Update(n)
-	m.a15.Update(n)
+	m.count.Add(n)
+	m.ticked += n
+	for _, a := range []EWMA{m.a1, m.a5, m.a15} {
+		if a, ok := a.(*StandardEWMA); ok {
+			a.updateLate(n, t)
+			continue
+		}
+		a.Update(n)
+	}
 	m.updateSnapshot()
 }
 
+// MarkFloat records the occurance of v events, which may be fractional, such
+// as an amount of money or a normalized score, so that the moving averages
+// are rates of the amounts marked without scaling them to integers.  Like
+// Mark, it never blocks, though the total is added to with a
+// compare-and-swap loop.
+func (m *StandardMeter) MarkFloat(v float64) {
+	m.fraction.add(v)
+	if m.lock.TryLock() {
+		m.updateMean()
+		m.lock.Unlock()
+	}
+}
+
 // Rate1 returns the one-minute moving average rate of events per second.
 func (m *StandardMeter) Rate1() float64 {
+	if m.foldPending.Load() {
+		return m.Snapshot().Rate1()
+	}
+	m.tickLazily()
 	m.lock.RLock()
 	rate1 := m.snapshot.rate1
 	m.lock.RUnlock()
@@ -157,6 +387,10 @@ func (m *StandardMeter) Rate1() float64 {
 
 // Rate5 returns the five-minute moving average rate of events per second.
 func (m *StandardMeter) Rate5() float64 {
+	if m.foldPending.Load() {
+		return m.Snapshot().Rate5()
+	}
+	m.tickLazily()
 	m.lock.RLock()
 	rate5 := m.snapshot.rate5
 	m.lock.RUnlock()
@@ -165,6 +399,10 @@ func (m *StandardMeter) Rate5() float64 {
 
 // Rate15 returns the fifteen-minute moving average rate of events per second.
 func (m *StandardMeter) Rate15() float64 {
+	if m.foldPending.Load() {
+		return m.Snapshot().Rate15()
+	}
+	m.tickLazily()
 	m.lock.RLock()
 	rate15 := m.snapshot.rate15
 	m.lock.RUnlock()
@@ -173,61 +411,482 @@ func (m *StandardMeter) Rate15() float64 {
 
 // RateMean returns the meter's mean rate of events per second.
 func (m *StandardMeter) RateMean() float64 {
+	m.tickLazily()
 	m.lock.RLock()
 	rateMean := m.snapshot.rateMean
 	m.lock.RUnlock()
 	return rateMean
 }
 
-// Snapshot returns a read-only copy of the meter.
+// Snapshot returns a read-only copy of the meter.  Its count and mean rate
+// are computed from a single read of the count, and its moving averages all
+// account for the same events, those counted as of the meter's last tick.
 func (m *StandardMeter) Snapshot() Meter {
-	m.lock.RLock()
+	m.tickLazily()
+	m.lock.Lock()
+	m.updateMean()
 	snapshot := *m.snapshot
-	m.lock.RUnlock()
+	if m.foldPending.Load() {
+		m.foldPendingInto(&snapshot)
+	}
+	m.lock.Unlock()
+	snapshot.windows = m.Windows()
 	return &snapshot
 }
 
+// SetFoldPending sets whether the meter's moving averages, as read by Rate1,
+// Rate5, Rate15, and Snapshot, fold in the events marked since its last tick,
+// pro-rated by the time elapsed since then, as StandardEWMA's
+// SnapshotPending does, so that a low-rate meter reads fresh rates between
+// ticks.  Its moving averages then account for every event counted in the
+// snapshot rather than those counted as of its last tick.
+func (m *StandardMeter) SetFoldPending(fold bool) {
+	m.foldPending.Store(fold)
+}
+
+// Stop stops ticking the meter, removing it from its TickSource if that has
+// a Remove method, as the default arbiter and ManualTickSource do, so that
+// the meter is garbage collected once it's otherwise unreferenced.  Its count
+// and mean rate are still updated by Mark but its moving averages no longer
+// decay.  Registries stop the meters they unregister, so a meter registered
+// in more than one place is stopped as soon as it's unregistered from any.
+func (m *StandardMeter) Stop() {
+	m.lock.Lock()
+	ts := m.ticks
+	m.ticks = nil
+	m.lock.Unlock()
+	if r, ok := ts.(interface{ Remove(*StandardMeter) }); ok {
+		r.Remove(m)
+	}
+}
+
+// String formats the count and rates for debugging.
+func (m *StandardMeter) String() string { return meterString(m) }
+
+// Windows returns the windows of the meter's moving averages, read from
+// its EWMAs, which differ from DefaultWindows only if they've been given
+// other alphas.
+func (m *StandardMeter) Windows() []time.Duration {
+	windows := append([]time.Duration(nil), DefaultWindows...)
+	for i, a := range []EWMA{m.a1, m.a5, m.a15} {
+		if a, ok := a.(*StandardEWMA); ok {
+			windows[i] = a.Window()
+		}
+	}
+	return windows
+}
+
 func (m *StandardMeter) updateSnapshot() {
 	// should run with write lock held on m.lock
 	snapshot := m.snapshot
 	snapshot.rate1 = m.a1.Rate()
 	snapshot.rate5 = m.a5.Rate()
 	snapshot.rate15 = m.a15.Rate()
-	snapshot.rateMean = float64(snapshot.count) / time.Since(m.startTime).Seconds()
+	m.updateMean()
+}
+
+// updateMean refreshes the snapshot's count and mean rate, which, unlike the
+// moving averages, change with every event, from a single read of the count.
+func (m *StandardMeter) updateMean() {
+	// should run with write lock held on m.lock
+	count, fraction := m.loadCount(), m.fraction.load()
+	m.snapshot.count = count + int64(fraction)
+	m.snapshot.countFloat = float64(count) + fraction
+	m.snapshot.rateMean = (m.snapshot.countFloat - float64(m.restored)) / time.Since(m.startTime).Seconds()
+}
+
+// foldPendingInto folds the events counted in a snapshot since the last tick
+// into its moving averages.
+func (m *StandardMeter) foldPendingInto(snapshot *MeterSnapshot) {
+	// should run with write lock held on m.lock
+	pending, now := snapshot.countFloat-(float64(m.ticked)+m.tickedFraction), time.Now()
+	for _, r := range []struct {
+		a    EWMA
+		rate *float64
+	}{{m.a1, &snapshot.rate1}, {m.a5, &snapshot.rate5}, {m.a15, &snapshot.rate15}} {
+		if a, ok := r.a.(*StandardEWMA); ok {
+			*r.rate = a.ratePending(pending, now)
+		}
+	}
 }
 
-func (m *StandardMeter) tick() {
+// updateEWMAs feeds the moving averages the events counted since they were
+// last fed, from a single read of the count, so that all three account for
+// the same events however many are marked meanwhile.
+func (m *StandardMeter) updateEWMAs() {
+	// should run with write lock held on m.lock
+	count, fraction := m.loadCount(), m.fraction.load()
+	n, f := count-m.ticked, fraction-m.tickedFraction
+	m.ticked, m.tickedFraction = count, fraction
+	for _, a := range []EWMA{m.a1, m.a5, m.a15} {
+		if 0 != n {
+			a.Update(n)
+		}
+		if 0 != f {
+			updateFloat(a, f)
+		}
+	}
+}
+
+// restore adds a count restored from a checkpoint to the meter's count
+// without affecting its rates.
+func (m *StandardMeter) restore(count int64) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	m.count.Add(count)
+	m.restored += count
+	m.ticked += count
+}
+
+// tickBy adds the meter to the given TickSource, which ticks it until it's
+// stopped.
+func (m *StandardMeter) tickBy(ts TickSource) {
+	m.lock.Lock()
+	m.ticks = ts
+	m.lock.Unlock()
+	ts.Add(m)
+}
+
+// Tick ticks the moving averages and refreshes every rate read by the Rate
+// methods and Snapshot whether or not any events were marked since the last
+// tick, so that an idle meter's rates decay towards zero rather than
+// remaining at their last value.  It is meant to be called every TickInterval
+// by a TickSource.
+func (m *StandardMeter) Tick() {
+	m.readSource()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.updateEWMAs()
 	m.a1.Tick()
 	m.a5.Tick()
 	m.a15.Tick()
 	m.updateSnapshot()
 }
 
+// catchUp ticks the meter n times at once, spreading the events marked since
+// the last tick evenly over those n intervals.
+func (m *StandardMeter) catchUp(n int) {
+	m.readSource()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.updateEWMAs()
+	for _, a := range []EWMA{m.a1, m.a5, m.a15} {
+		if a, ok := a.(*StandardEWMA); ok {
+			a.catchUp(n)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			a.Tick()
+		}
+	}
+	m.updateSnapshot()
+}
+
+// tickLazily ticks a meter added to a LazyTickSource as many times as
+// intervals have elapsed since it was last ticked.
+func (m *StandardMeter) tickLazily() {
+	if nil == m.lazy {
+		return
+	}
+	switch n := m.lazy.due(time.Now()); {
+	case 1 == n:
+		m.Tick()
+	case 1 < n:
+		m.catchUp(n)
+	}
+}
+
+// sourceReadTimeout is how long a tick waits for a sourced meter's
+// CounterSource to be read before going on without its latest count.
+const sourceReadTimeout = 100 * time.Millisecond
+
+// readSource marks the events counted by the meter's CounterSource since it
+// was last read.  The source is read on a goroutine of its own, without
+// holding the lock since reading it may mean a system call, and readSource
+// returns after sourceReadTimeout if the read hasn't by then.  It returns at
+// once if an earlier read is still in flight.
+func (m *StandardMeter) readSource() {
+	if nil == m.source || !m.sourceReading.CompareAndSwap(false, true) {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer m.sourceReading.Store(false)
+		count, err := m.source.ReadCount()
+		if nil != err {
+			return
+		}
+		m.markSource(count)
+	}()
+	t := time.NewTimer(sourceReadTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+	}
+}
+
+// markSource marks the events by which the given count read from the
+// meter's CounterSource exceeds the last.
+func (m *StandardMeter) markSource(count uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	n := count
+	if count >= m.sourceCount {
+		n = count - m.sourceCount
+	}
+	first := !m.sourceRead
+	m.sourceCount, m.sourceRead = count, true
+	if first || 0 == n {
+		return
+	}
+	m.count.Add(int64(n))
+}
+
+// A TickSource drives the ticks on which meters update their moving
+// averages.  Ticks are expected every TickInterval.  The default TickSource is
+// an arbiter which ticks every meter from a single goroutine;
+// ManualTickSource lets an external scheduler, such as an application's own
+// timing wheel or a test harness, tick meters instead.  A TickSource which
+// also has a Remove(*StandardMeter) method is called on to stop ticking a
+// meter by the meter's Stop method.
+type TickSource interface {
+
+	// Add begins ticking the given meter.
+	Add(*StandardMeter)
+}
+
+// DefaultTickSource ticks meters constructed by NewMeter and NewTimer.
+// Replace it before constructing any meters to take over ticking.  It's the
+// arbiter except under js, wasip1, and TinyGo, where it's a LazyTickSource.
+var DefaultTickSource TickSource = defaultTickSource
+
+// DefaultTickInterval is the interval at which meters are ticked unless
+// SetTickInterval changes it.
+const DefaultTickInterval = 5 * time.Second
+
+var tickInterval atomic.Int64 // in nanoseconds; zero means DefaultTickInterval
+
+// SetTickInterval sets the interval at which the arbiter and LazyTickSources
+// tick meters and at which every TickSource is expected to, such as one
+// second for finer resolution or 30 seconds for less work.  The moving
+// averages of meters and timers derive their decay from the interval on
+// every tick, so their rates remain correct whenever it's changed, though
+// the arbiter's next tick is a whole new interval away.  A non-positive
+// interval restores DefaultTickInterval.
+func SetTickInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultTickInterval
+	}
+	tickInterval.Store(int64(d))
+	arbiter.setInterval(d)
+}
+
+// TickInterval returns the interval at which meters are ticked.
+func TickInterval() time.Duration {
+	if d := tickInterval.Load(); 0 != d {
+		return time.Duration(d)
+	}
+	return DefaultTickInterval
+}
+
+// ManualTickSource is a TickSource whose meters are ticked only when its Tick
+// or TickN methods are called.
+type ManualTickSource struct {
+	mutex  sync.Mutex
+	meters map[*StandardMeter]struct{}
+}
+
+// NewManualTickSource constructs a new ManualTickSource.
+func NewManualTickSource() *ManualTickSource {
+	return &ManualTickSource{}
+}
+
+// Add begins ticking the given meter whenever Tick or TickN is called.
+func (ts *ManualTickSource) Add(m *StandardMeter) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	if nil == ts.meters {
+		ts.meters = make(map[*StandardMeter]struct{})
+	}
+	ts.meters[m] = struct{}{}
+}
+
+// Remove stops ticking the given meter.
+func (ts *ManualTickSource) Remove(m *StandardMeter) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	delete(ts.meters, m)
+}
+
+// Tick ticks every meter once.
+func (ts *ManualTickSource) Tick() {
+	ts.TickN(1)
+}
+
+// TickN ticks every meter n times at once, spreading the events marked since
+// the last tick evenly over n intervals.  It is meant for schedulers which
+// notice they have fallen behind.
+func (ts *ManualTickSource) TickN(n int) {
+	if n < 1 {
+		return
+	}
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	for m := range ts.meters {
+		if 1 == n {
+			m.Tick()
+		} else {
+			m.catchUp(n)
+		}
+	}
+}
+
+// LazyTickSource is a TickSource which ticks each of its meters only when
+// one of the meter's rates or a snapshot is read, as many times as intervals
+// have elapsed since it was last ticked.  It needs no goroutine or timer, so
+// rates stay correct on platforms such as js/wasm, where a goroutine waiting
+// on a ticker may not run until the host yields, and under TinyGo.
+type LazyTickSource struct{}
+
+// NewLazyTickSource constructs a new LazyTickSource.
+func NewLazyTickSource() *LazyTickSource {
+	return &LazyTickSource{}
+}
+
+// Add begins ticking the given meter whenever it's read.
+func (*LazyTickSource) Add(m *StandardMeter) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.lazy = &lazyTicks{last: time.Now()}
+}
+
+// lazyTicks counts the tick intervals which have elapsed since a
+// meter ticked by a LazyTickSource was last ticked.
+type lazyTicks struct {
+	mutex sync.Mutex
+	last  time.Time
+}
+
+// due returns the number of ticks due by the given time, at most
+// maxCatchUpTicks, and accounts for them.
+func (l *lazyTicks) due(now time.Time) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	interval := TickInterval()
+	n := int64(now.Sub(l.last) / interval)
+	if n < 1 {
+		return 0
+	}
+	l.last = l.last.Add(time.Duration(n) * interval)
+	if n > maxCatchUpTicks {
+		n = maxCatchUpTicks
+	}
+	return int(n)
+}
+
+// maxCatchUpTicks bounds the number of ticks the arbiter replays after it
+// has been starved.  An hour of silence decays even the fifteen-minute moving
+// average to a negligible fraction of its value.
+const maxCatchUpTicks = 720
+
 type meterArbiter struct {
 	sync.RWMutex
-	started bool
-	meters  []*StandardMeter
-	ticker  *time.Ticker
+	started  bool
+	meters   map[*StandardMeter]struct{}
+	task     *task         // ticks the meters once started
+	interval time.Duration // the tick interval
+	start    time.Time     // when ticking began
+	ticks    int64         // the number of intervals accounted for since start
 }
 
-var arbiter = meterArbiter{ticker: time.NewTicker(5e9)}
+var arbiter = &meterArbiter{interval: DefaultTickInterval}
 
-// Ticks meters on the scheduled interval
-func (ma *meterArbiter) tick() {
-	for {
-		select {
-		case <-ma.ticker.C:
-			ma.tickMeters()
-		}
+// Add starts ticking the given meter, starting the arbiter if necessary.
+func (ma *meterArbiter) Add(m *StandardMeter) {
+	ma.Lock()
+	defer ma.Unlock()
+	if nil == ma.meters {
+		ma.meters = make(map[*StandardMeter]struct{})
+	}
+	ma.meters[m] = struct{}{}
+	if !ma.started {
+		ma.started = true
+		ma.start = time.Now()
+		ma.task = tasks.every("meters", priorityTick, ma.interval, false, ma.tick)
+	}
+}
+
+// Remove stops ticking the given meter.  The arbiter keeps running, if only
+// to tick meters added later.
+func (ma *meterArbiter) Remove(m *StandardMeter) {
+	ma.Lock()
+	defer ma.Unlock()
+	delete(ma.meters, m)
+}
+
+// reset forgets the arbiter's meters and stops its task, so that the next
+// meter added starts it again.
+func (ma *meterArbiter) reset() {
+	ma.Lock()
+	defer ma.Unlock()
+	if ma.started {
+		tasks.stop(ma.task)
 	}
+	ma.meters, ma.started, ma.task = nil, false, nil
 }
 
-func (ma *meterArbiter) tickMeters() {
+// setInterval changes the tick interval, rescheduling the ticks if the
+// arbiter has started.
+func (ma *meterArbiter) setInterval(d time.Duration) {
+	ma.Lock()
+	defer ma.Unlock()
+	ma.interval = d
+	if ma.started {
+		tasks.stop(ma.task)
+		ma.start, ma.ticks = time.Now(), 0
+		ma.task = tasks.every("meters", priorityTick, ma.interval, false, ma.tick)
+	}
+}
+
+// tick ticks meters on the scheduled interval.
+func (ma *meterArbiter) tick(now time.Time) {
+	ma.Lock()
+	n := ma.ticksDue(now)
+	ma.Unlock()
+	ma.tickMeters(n)
+}
+
+// ticksDue returns the number of intervals which have elapsed since the
+// previous tick.  It is one unless the arbiter goroutine was starved (by GC
+// pauses or CPU saturation, for instance) and the ticker dropped ticks, in
+// which case the events marked in the meantime must be spread over every
+// interval that was missed.
+func (ma *meterArbiter) ticksDue(now time.Time) int {
+	if ma.interval <= 0 {
+		return 1
+	}
+	due := int64((now.Sub(ma.start) + ma.interval/2) / ma.interval)
+	n := due - ma.ticks
+	if n < 1 {
+		n = 1
+	}
+	ma.ticks += n
+	if n > maxCatchUpTicks {
+		n = maxCatchUpTicks
+	}
+	return int(n)
+}
+
+func (ma *meterArbiter) tickMeters(n int) {
 	ma.RLock()
 	defer ma.RUnlock()
-	for _, meter := range ma.meters {
-		meter.tick()
+	for meter := range ma.meters {
+		if 1 == n {
+			meter.Tick()
+		} else {
+			meter.catchUp(n)
+		}
 	}
 }
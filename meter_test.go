@@ -1,6 +1,12 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
 import (
+	"errors"
+	"math"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -22,20 +28,143 @@ func TestGetOrRegisterMeter(t *testing.T) {
 }
 
 func TestMeterDecay(t *testing.T) {
-	ma := meterArbiter{
-		ticker: time.NewTicker(1),
-	}
+	ma := &meterArbiter{interval: time.Millisecond}
 	m := newStandardMeter()
-	ma.meters = append(ma.meters, m)
-	go ma.tick()
+	ma.Add(m)
+	defer tasks.stop(ma.task)
 	m.Mark(1)
 	rateMean := m.RateMean()
-	time.Sleep(1)
+	for i := 0; i < 1000 && m.RateMean() >= rateMean; i++ {
+		time.Sleep(time.Millisecond)
+	}
 	if m.RateMean() >= rateMean {
 		t.Error("m.RateMean() didn't decrease")
 	}
 }
 
+func TestMeterMarkWhileLocked(t *testing.T) {
+	m := newStandardMeter()
+	m.lock.Lock()
+	done := make(chan struct{})
+	go func() {
+		m.Mark(3)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("m.Mark(3) blocked while the meter was locked")
+	}
+	if count := m.Count(); 3 != count {
+		t.Errorf("m.Count(): 3 != %v\n", count)
+	}
+	m.lock.Unlock()
+	if count := m.Snapshot().Count(); 3 != count {
+		t.Errorf("m.Snapshot().Count(): 3 != %v\n", count)
+	}
+	m.Mark(1)
+	if 0.0 == m.RateMean() {
+		t.Errorf("m.RateMean(): 0.0 after marking unlocked\n")
+	}
+}
+
+func TestMeterMarkAt(t *testing.T) {
+	a, b := newStandardMeter(), newStandardMeter()
+	a.Tick()
+	a.Mark(60)
+	a.Tick()
+	a.Tick()
+	b.Tick()
+	b.Tick()
+	b.Tick()
+	b.MarkAt(60, time.Now().Add(-3*TickInterval()/2))
+	if count := b.Count(); 60 != count {
+		t.Errorf("b.Count(): 60 != %v\n", count)
+	}
+	for _, rates := range [][2]float64{{a.Rate1(), b.Rate1()}, {a.Rate5(), b.Rate5()}, {a.Rate15(), b.Rate15()}} {
+		if 0 == rates[0] || 1e-9 < math.Abs(rates[0]-rates[1]) {
+			t.Errorf("rate of events marked late: %v != %v\n", rates[0], rates[1])
+		}
+	}
+	b.Tick()
+	a.Tick()
+	if rate := b.Rate1(); 1e-9 < math.Abs(a.Rate1()-rate) {
+		t.Errorf("b.Rate1() after another tick: %v != %v\n", a.Rate1(), rate)
+	}
+	rate1 := b.Rate1()
+	b.MarkAt(10, time.Now())
+	if rate := b.Rate1(); rate1 != rate {
+		t.Errorf("b.Rate1() after marking on time: %v != %v\n", rate1, rate)
+	}
+	b.MarkAt(10, time.Now().Add(-(maxCatchUpTicks+1)*TickInterval()))
+	if rate := b.Rate1(); rate1 != rate {
+		t.Errorf("b.Rate1() after marking too late: %v != %v\n", rate1, rate)
+	}
+	if count := b.Count(); 80 != count {
+		t.Errorf("b.Count(): 80 != %v\n", count)
+	}
+}
+
+func TestMeterMarkFloat(t *testing.T) {
+	m := newStandardMeter()
+	m.a1 = NewEWMA(1.0)
+	m.Mark(1)
+	m.MarkFloat(0.75)
+	m.MarkFloat(1.5)
+	if count := m.CountFloat(); 3.25 != count {
+		t.Errorf("m.CountFloat(): 3.25 != %v\n", count)
+	}
+	if count := m.Count(); 3 != count {
+		t.Errorf("m.Count(): 3 != %v\n", count)
+	}
+	m.Tick()
+	snapshot := m.Snapshot().(MeterFloat64)
+	if rate := snapshot.Rate1(); 1e-9 < math.Abs(3.25/5-rate) {
+		t.Errorf("snapshot.Rate1(): %v != %v\n", 3.25/5, rate)
+	}
+	if count := snapshot.CountFloat(); 3.25 != count {
+		t.Errorf("snapshot.CountFloat(): 3.25 != %v\n", count)
+	}
+	if _, ok := NewMeter().(MeterFloat64); !ok {
+		t.Error("NewMeter() isn't a MeterFloat64")
+	}
+}
+
+func TestMeterFoldPending(t *testing.T) {
+	m := newStandardMeter()
+	m.Tick()
+	m.Mark(10)
+	if rate := m.Rate1(); 0.0 != rate {
+		t.Errorf("m.Rate1(): 0.0 != %v\n", rate)
+	}
+	m.SetFoldPending(true)
+	if rate := m.Rate1(); 0.0 == rate {
+		t.Errorf("m.Rate1(): 0.0 with pending events folded in\n")
+	}
+	if snapshot := m.Snapshot(); 0.0 == snapshot.Rate15() || 10 != snapshot.Count() {
+		t.Errorf("m.Snapshot(): %v\n", snapshot)
+	}
+	m.Tick()
+	if rate := m.a1.Rate(); 0.0 == rate {
+		t.Errorf("m.a1.Rate(): 0.0 after the pending events were ticked\n")
+	}
+}
+
+func TestMeterWindows(t *testing.T) {
+	m := newStandardMeter()
+	if ws := MeterWindows(m.Snapshot()); !reflect.DeepEqual(DefaultWindows, ws) {
+		t.Errorf("MeterWindows(m.Snapshot()): %v != %v\n", DefaultWindows, ws)
+	}
+	m.a5 = NewEWMA(ewmaAlpha(2*time.Minute, TickInterval()))
+	ws := MeterWindows(m.Snapshot())
+	if time.Minute != ws[0] || 1e-6 < math.Abs(ws[1].Minutes()-2) || 15*time.Minute != ws[2] {
+		t.Errorf("MeterWindows(m.Snapshot()): %v\n", ws)
+	}
+	if ws := MeterWindows(NilMeter{}); !reflect.DeepEqual(DefaultWindows, ws) {
+		t.Errorf("MeterWindows(NilMeter{}): %v != %v\n", DefaultWindows, ws)
+	}
+}
+
 func TestMeterNonzero(t *testing.T) {
 	m := NewMeter()
 	m.Mark(3)
@@ -58,3 +187,249 @@ func TestMeterZero(t *testing.T) {
 		t.Errorf("m.Count(): 0 != %v\n", count)
 	}
 }
+
+func TestMeterBurstLimited(t *testing.T) {
+	m := NewBurstLimitedMeter(BurstPolicy{Limit: 5})
+	m.Mark(1000)
+	m.(*StandardMeter).Tick()
+	if count := m.Count(); 1000 != count {
+		t.Errorf("m.Count(): 1000 != %v\n", count)
+	}
+	if rate1 := m.Rate1(); 1.0 != rate1 {
+		t.Errorf("m.Rate1(): 1.0 != %v\n", rate1)
+	}
+}
+
+func TestMeterIdleDecay(t *testing.T) {
+	m := newStandardMeter()
+	m.Mark(100)
+	m.Tick()
+	rate1, snapshot := m.Rate1(), m.Snapshot()
+	if 20.0 != rate1 || rate1 != snapshot.Rate1() {
+		t.Fatalf("m.Rate1(): 20.0 != %v, snapshot %v\n", rate1, snapshot.Rate1())
+	}
+	for i := 0; i < 12*60; i++ {
+		m.Tick()
+		if r := m.Rate1(); r >= rate1 {
+			t.Fatalf("tick %d m.Rate1(): %v >= %v\n", i, r, rate1)
+		} else {
+			rate1 = r
+		}
+	}
+	if rate1 > 1e-20 {
+		t.Errorf("m.Rate1() after an idle hour: %v\n", rate1)
+	}
+	if r := m.Snapshot().Rate1(); rate1 != r {
+		t.Errorf("m.Snapshot().Rate1(): %v != %v\n", rate1, r)
+	}
+	if r := m.Snapshot().Rate15(); r >= 20.0 || r <= 0 {
+		t.Errorf("m.Snapshot().Rate15(): %v\n", r)
+	}
+}
+
+func TestMeterRateMeanIdleDecay(t *testing.T) {
+	m := newStandardMeter()
+	m.Mark(1)
+	rateMean := m.RateMean()
+	time.Sleep(time.Millisecond)
+	m.Tick()
+	if m.RateMean() >= rateMean {
+		t.Error("m.RateMean() didn't decrease")
+	}
+	if m.Snapshot().RateMean() != m.RateMean() {
+		t.Error("m.Snapshot().RateMean() != m.RateMean()")
+	}
+}
+
+func TestMeterArbiterTicksDue(t *testing.T) {
+	ma := meterArbiter{interval: 5 * time.Second}
+	ma.start = time.Now()
+	for i, c := range []struct {
+		elapsed time.Duration
+		due     int
+	}{
+		{5 * time.Second, 1},
+		{10*time.Second + 100*time.Millisecond, 1},
+		{27 * time.Second, 3},
+		{30 * time.Second, 1},
+		{2 * time.Hour, maxCatchUpTicks},
+		{2*time.Hour + 5*time.Second, 1},
+	} {
+		if due := ma.ticksDue(ma.start.Add(c.elapsed)); c.due != due {
+			t.Errorf("%d: ma.ticksDue(): %v != %v\n", i, c.due, due)
+		}
+	}
+}
+
+func TestMeterCatchUp(t *testing.T) {
+	m := newStandardMeter()
+	m.Mark(15)
+	m.catchUp(3)
+	if rate1 := m.Rate1(); 1.0 != rate1 {
+		t.Errorf("m.Rate1(): 1.0 != %v\n", rate1)
+	}
+	if count := m.Count(); 15 != count {
+		t.Errorf("m.Count(): 15 != %v\n", count)
+	}
+}
+
+func TestManualTickSource(t *testing.T) {
+	ts := NewManualTickSource()
+	m := NewMeterWithTickSource(ts)
+	m.Mark(10)
+	if rate1 := m.Rate1(); 0.0 != rate1 {
+		t.Errorf("m.Rate1(): 0.0 != %v\n", rate1)
+	}
+	ts.Tick()
+	if rate1 := m.Rate1(); 2.0 != rate1 {
+		t.Errorf("m.Rate1(): 2.0 != %v\n", rate1)
+	}
+	m.Mark(20)
+	ts.TickN(2)
+	if rate1 := m.Rate1(); 2.0 != rate1 {
+		t.Errorf("m.Rate1(): 2.0 != %v\n", rate1)
+	}
+}
+
+func TestMeterStop(t *testing.T) {
+	ts := NewManualTickSource()
+	m := NewMeterWithTickSource(ts).(*StandardMeter)
+	m.Stop()
+	if _, ok := ts.meters[m]; ok {
+		t.Error("m.Stop() didn't remove m from its tick source")
+	}
+	m.Mark(10)
+	ts.Tick()
+	if rate1 := m.Rate1(); 0.0 != rate1 {
+		t.Errorf("m.Rate1(): 0.0 != %v\n", rate1)
+	}
+	if count := m.Count(); 10 != count {
+		t.Errorf("m.Count(): 10 != %v\n", count)
+	}
+	m.Stop()
+}
+
+func TestMeterArbiterRemove(t *testing.T) {
+	ma := &meterArbiter{interval: time.Hour}
+	m := newStandardMeter()
+	m.tickBy(ma)
+	defer tasks.stop(ma.task)
+	m.Stop()
+	ma.Lock()
+	defer ma.Unlock()
+	if _, ok := ma.meters[m]; ok {
+		t.Error("m.Stop() didn't remove m from the arbiter")
+	}
+}
+
+func TestMeterAfterStopScheduledTasks(t *testing.T) {
+	SetTickInterval(time.Millisecond)
+	defer SetTickInterval(0)
+	NewMeter()
+	StopScheduledTasks()
+	m := NewMeter()
+	m.Mark(10)
+	for deadline := time.Now().Add(time.Second); 0 == m.Rate1(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("m.Rate1(): 0 a second after StopScheduledTasks")
+		}
+	}
+}
+
+func TestDefaultTickSource(t *testing.T) {
+	defer func(ts TickSource) { DefaultTickSource = ts }(DefaultTickSource)
+	ts := NewManualTickSource()
+	DefaultTickSource = ts
+	tm := NewTimer()
+	tm.Update(time.Second)
+	ts.Tick()
+	if rate1 := tm.Rate1(); 0.2 != rate1 {
+		t.Errorf("tm.Rate1(): 0.2 != %v\n", rate1)
+	}
+}
+
+func TestSourcedMeter(t *testing.T) {
+	var (
+		count uint64 = 1000
+		err   error
+	)
+	m := newStandardMeter()
+	m.source = CounterSourceFunc(func() (uint64, error) { return count, err })
+	m.readSource()
+	count += 100
+	m.Tick()
+	if c := m.Count(); 100 != c {
+		t.Errorf("m.Count(): 100 != %v\n", c)
+	}
+	if rate1 := m.Rate1(); 20.0 != rate1 {
+		t.Errorf("m.Rate1(): 20.0 != %v\n", rate1)
+	}
+	count, err = 2000, errors.New("unreadable")
+	m.Tick()
+	if c := m.Count(); 100 != c {
+		t.Errorf("m.Count(): 100 != %v\n", c)
+	}
+	count, err = 50, nil
+	m.Tick()
+	if c := m.Count(); 150 != c {
+		t.Errorf("m.Count(): 150 != %v\n", c)
+	}
+}
+
+func TestSourcedMeterSlowSource(t *testing.T) {
+	var count uint64 = 1000
+	release := make(chan struct{})
+	ts := NewManualTickSource()
+	slow := newStandardMeter()
+	slow.source = CounterSourceFunc(func() (uint64, error) {
+		<-release
+		return count, nil
+	})
+	slow.tickBy(ts)
+	m := NewMeterWithTickSource(ts)
+	m.Mark(100)
+
+	ticked := make(chan struct{})
+	go func() {
+		ts.Tick()
+		close(ticked)
+	}()
+	select {
+	case <-ticked:
+	case <-time.After(10 * sourceReadTimeout):
+		t.Fatal("ts.Tick() blocked on a slow CounterSource")
+	}
+	if rate1 := m.Rate1(); 20.0 != rate1 {
+		t.Errorf("m.Rate1(): 20.0 != %v\n", rate1)
+	}
+
+	// The read in flight returns the first count and the next the grown one.
+	release <- struct{}{}
+	for deadline := time.Now().Add(time.Second); slow.sourceReading.Load(); {
+		if time.Now().After(deadline) {
+			t.Fatal("slow.sourceReading still set after the read returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	count += 50
+	close(release)
+	ts.Tick()
+	if c := slow.Count(); 50 != c {
+		t.Errorf("slow.Count(): 50 != %v\n", c)
+	}
+}
+
+func TestLazyTickSource(t *testing.T) {
+	m := NewMeterWithTickSource(NewLazyTickSource()).(*StandardMeter)
+	m.Mark(10)
+	if rate := m.Rate1(); 0.0 != rate {
+		t.Errorf("m.Rate1(): 0.0 != %v before an interval has elapsed\n", rate)
+	}
+	m.lazy.last = m.lazy.last.Add(-2 * arbiter.interval)
+	if rate := m.Rate1(); 0.0 == rate {
+		t.Error("m.Rate1(): 0.0 after two intervals have elapsed")
+	}
+	if n := m.lazy.due(time.Now()); 0 != n {
+		t.Errorf("m.lazy.due(): %d ticks due after reading\n", n)
+	}
+}
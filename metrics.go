@@ -3,6 +3,59 @@
 // <https://github.com/rcrowley/go-metrics>
 //
 // Coda Hale's original work: <https://github.com/codahale/metrics>
+//
+// # Recording from finalizers and signal handlers
+//
+// Every metric is safe for concurrent use, and none calls back into the
+// caller's code while holding a lock, so metrics may be updated from
+// finalizers and from the goroutines which receive from os/signal's channels
+// without risk of deadlock.  Go has no asynchronous signal handlers in which
+// to record, but finalizers all run on one goroutine, which a metric waiting
+// for its lock holds up.  These methods of the standard metrics never wait
+// for a lock and may be called anywhere:
+//
+//	Counter.Inc, Counter.Dec, Counter.Clear
+//	Gauge.Update, Add, Sub, SetMax, and SetMin, unless the gauge has
+//	subscribers (see SubscribeGauge)
+//	GaugeFloat64.Update
+//	Meter.Mark, for meters using the standard EWMAs
+//
+// Histograms and timers take locks, and so may wait briefly while another
+// goroutine records or reads them, as do a tenant's metrics if its Quota
+// limits their update rate.
+//
+// # Memory model
+//
+// The standard metrics and registries make these guarantees about what a
+// goroutine reading them sees of updates made by others, in the terms of the
+// Go memory model:
+//
+//   - Every update happens before any read of the same metric which
+//     observes it, and reads observe updates in the order in which they
+//     were made, since every metric keeps its state in sync/atomic values
+//     or behind a mutex.  In particular, an update which returns before a
+//     read begins is observed by it.
+//   - A metric's Snapshot is immutable, so it may be shared between
+//     goroutines without synchronization.  It's consistent, reflecting one
+//     instant, for metrics kept behind a single lock: histograms, samples,
+//     timers, whose histogram and meter are updated and copied under the
+//     timer's own lock, staged timers, and summaries.  A meter's snapshot
+//     pairs its count and mean rate, both from one read of the count at the
+//     Snapshot call, with its moving averages as of its last tick, since
+//     they're only computed on ticks, and all three of those account for
+//     exactly the events counted as of that tick, or, if it's been set to
+//     fold in pending events, for those counted by the Snapshot call.
+//   - Snapshots of different metrics are taken at different instants, so
+//     a reporter may see an update of one metric and not that of another
+//     which preceded it.  Metrics which must agree, such as the two
+//     durations of a PairedTimer, belong in one metric.
+//   - Each calls its function with every metric registered, and not
+//     unregistered, before it began, even if it's unregistered meanwhile.
+//     A metric registered or unregistered while Each runs may or may not
+//     be seen.
+//
+// The stress tests in stress_test.go exercise these guarantees under the
+// race detector: go test -race -run Stress.
 package metrics
 
 // UseNilMetrics is checked by the constructor functions for all of the
@@ -10,4 +63,7 @@ package metrics
 //
 // This global kill-switch helps quantify the observer effect and makes
 // for less cluttered pprof profiles.
+//
+// Building with the metrics_disabled tag has the same effect without even
+// the check, for builds in which instrumentation must cost nothing.
 var UseNilMetrics bool = false
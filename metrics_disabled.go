@@ -0,0 +1,11 @@
+//go:build metrics_disabled
+// +build metrics_disabled
+
+package metrics
+
+// metricsDisabled is true in builds tagged metrics_disabled, in which every
+// constructor of the standard metrics returns a stub, as though UseNilMetrics
+// were always true.  Being a constant, it lets the compiler discard the
+// standard implementations' construction altogether, so instrumented code
+// costs no more than calls to no-op methods.
+const metricsDisabled = true
@@ -0,0 +1,115 @@
+//go:build metrics_disabled
+// +build metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMetricsDisabled checks the constructors under the metrics_disabled tag.
+// Tests which expect the standard metrics are built only without the tag.
+func TestMetricsDisabled(t *testing.T) {
+	r := NewRegistry()
+	for name, m := range map[string]interface{}{
+		"NewCounter":                      NewCounter(),
+		"NewCounterFloat64":               NewCounterFloat64(),
+		"NewShardedCounter":               NewShardedCounter(),
+		"NewRegisteredCounter":            NewRegisteredCounter("counter", r),
+		"NewRegisteredCounterFloat64":     NewRegisteredCounterFloat64("counterfloat64", r),
+		"NewRegisteredShardedCounter":     NewRegisteredShardedCounter("shardedcounter", r),
+		"NewGauge":                        NewGauge(),
+		"NewGaugeFloat64":                 NewGaugeFloat64(),
+		"NewRegisteredGauge":              NewRegisteredGauge("gauge", r),
+		"NewRegisteredGaugeFloat64":       NewRegisteredGaugeFloat64("gaugefloat64", r),
+		"NewEWMA":                         NewEWMA(0.5),
+		"NewEWMA1":                        NewEWMA1(),
+		"NewEWMA5":                        NewEWMA5(),
+		"NewEWMA15":                       NewEWMA15(),
+		"NewBurstLimitedEWMA":             NewBurstLimitedEWMA(0.5, BurstPolicy{}),
+		"NewHealthcheck":                  NewHealthcheck(func(Healthcheck) {}),
+		"NewHistogram":                    NewHistogram(NewUniformSample(10)),
+		"NewHdrHistogram":                 NewHdrHistogram(1, 1000, 3),
+		"NewRegisteredHistogram":          NewRegisteredHistogram("histogram", r, nil),
+		"NewRegisteredHdrHistogram":       NewRegisteredHdrHistogram("hdrhistogram", r, 1, 1000, 3),
+		"NewDurationHistogram":            NewDurationHistogram(NewUniformSample(10)),
+		"NewRegisteredDurationHistogram":  NewRegisteredDurationHistogram("durationhistogram", r, nil),
+		"NewHistogram2D":                  NewHistogram2D([]int64{1}, []int64{1}),
+		"NewRegisteredHistogram2D":        NewRegisteredHistogram2D("histogram2d", r, []int64{1}, []int64{1}),
+		"NewMeter":                        NewMeter(),
+		"NewMeterWithTickSource":          NewMeterWithTickSource(NewManualTickSource()),
+		"NewBurstLimitedMeter":            NewBurstLimitedMeter(BurstPolicy{}),
+		"NewShardedMeter":                 NewShardedMeter(),
+		"NewSourcedMeter":                 NewSourcedMeter(nil),
+		"NewRegisteredMeter":              NewRegisteredMeter("meter", r),
+		"NewRegisteredShardedMeter":       NewRegisteredShardedMeter("shardedmeter", r),
+		"NewRegisteredSourcedMeter":       NewRegisteredSourcedMeter("sourcedmeter", r, nil),
+		"NewUniformSample":                NewUniformSample(10),
+		"NewUniformSampleWithRand":        NewUniformSampleWithRand(10, NewXorShiftRand(1)),
+		"NewExpDecaySample":               NewExpDecaySample(10, 0.015),
+		"NewExpDecaySampleWithRand":       NewExpDecaySampleWithRand(10, 0.015, NewXorShiftRand(1)),
+		"NewAdaptiveExpDecaySample":       NewAdaptiveExpDecaySample(10, 100, 0.015),
+		"NewSlidingWindowSample":          NewSlidingWindowSample(10),
+		"NewSlidingTimeWindowSample":      NewSlidingTimeWindowSample(time.Minute),
+		"NewHdrSample":                    NewHdrSample(1, 1000, 3),
+		"NewStagedTimer":                  NewStagedTimer(),
+		"NewRegisteredStagedTimer":        NewRegisteredStagedTimer("stagedtimer", r),
+		"NewSummary":                      NewSummary(map[float64]float64{0.5: 0.05}, time.Minute, 5),
+		"NewRegisteredSummary":            NewRegisteredSummary("summary", r, map[float64]float64{0.5: 0.05}, time.Minute, 5),
+		"NewTimer":                        NewTimer(),
+		"NewCustomTimer":                  NewCustomTimer(NewHistogram(NewUniformSample(10)), NewMeter()),
+		"NewRegisteredTimer":              NewRegisteredTimer("timer", r),
+		"GetOrRegisterCounter":            GetOrRegisterCounter("counter2", r),
+		"GetOrRegisterGauge":              GetOrRegisterGauge("gauge2", r),
+		"GetOrRegisterHistogram":          GetOrRegisterHistogram("histogram2", r, nil),
+		"GetOrRegisterMeter":              GetOrRegisterMeter("meter2", r),
+		"GetOrRegisterTimer":              GetOrRegisterTimer("timer2", r),
+		"NewAttemptTimer().Attempt":       NewAttemptTimer().Attempt(),
+		"NewAttemptTimer().Attempts":      NewAttemptTimer().Attempts(),
+		"NewAttemptTimer().Total":         NewAttemptTimer().Total(),
+		"NewREDMetrics().Duration":        NewREDMetrics().Duration(),
+		"NewREDMetrics().Errors":          NewREDMetrics().Errors(),
+		"NewREDMetrics().Requests":        NewREDMetrics().Requests(),
+		"NewUSEMetrics().Errors":          NewUSEMetrics().Errors(),
+		"NewUSEMetrics().Saturation":      NewUSEMetrics().Saturation(),
+		"NewUSEMetrics().Utilization":     NewUSEMetrics().Utilization(),
+		"NewRollupMeter().Meter":          NewRollupMeter().Meter,
+		"NewBaseline().Deviation":         NewBaseline(NewMeter(), 0.5).Deviation(),
+		"NewForecast().Projected":         NewForecast(NewMeter(), ForecastConfig{}).Projected(),
+		"NewPairedTimer().Snapshot":       NewPairedTimer("first_byte").Snapshot(),
+		"NewRegisteredPairedTimer().Snap": NewRegisteredPairedTimer("pairedtimer", "first_byte", r).Snapshot(),
+	} {
+		if !isNilMetric(m) {
+			t.Errorf("%s(): %T is not a stub\n", name, m)
+		}
+	}
+
+	p := NewPairedTimer("first_byte")
+	p.Update(time.Millisecond, 2*time.Millisecond)
+	p.Start().Stop()
+	if 0 != p.Count() || nil != p.Pairs() {
+		t.Errorf("PairedTimer: %d pairs recorded\n", p.Count())
+	}
+
+	sli := NewLatencySLI(nil, time.Millisecond, time.Minute)
+	sli.Update(time.Second)
+	if 0 != sli.Total() || 1 != sli.Ratio() {
+		t.Errorf("LatencySLI: %d observed, ratio %v\n", sli.Total(), sli.Ratio())
+	}
+	if 1 != NewRegisteredLatencySLI("sli", r, nil, time.Millisecond, time.Minute).Ratio() {
+		t.Error("NewRegisteredLatencySLI(): observed")
+	}
+}
+
+// isNilMetric returns whether i is one of the Nil stubs.
+func isNilMetric(i interface{}) bool {
+	switch i.(type) {
+	case NilCounter, NilCounterFloat64, NilDurationHistogram, NilEWMA,
+		NilGauge, NilGaugeFloat64, NilHealthcheck, NilHistogram,
+		NilHistogram2D, NilMeter, NilSample, NilStagedTimer, NilSummary,
+		NilTimer:
+		return true
+	}
+	return false
+}
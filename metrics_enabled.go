@@ -0,0 +1,7 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+// metricsDisabled is false unless the build is tagged metrics_disabled.
+const metricsDisabled = false
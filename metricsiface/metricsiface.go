@@ -0,0 +1,215 @@
+// Package metricsiface declares the interfaces of go-metrics' metrics and
+// registries, and nothing else: no implementations, goroutines, or globals.
+// A library may accept and record to these interfaces while depending on
+// nothing more, leaving the application to choose the implementation, be it
+// package metrics or another backend.
+//
+// Package metrics declares its Counter, Gauge, Meter, and the rest as aliases
+// of these, so its metrics may be passed wherever these are expected and vice
+// versa.
+package metricsiface
+
+import "time"
+
+// Counters hold an int64 value that can be incremented and decremented.
+type Counter interface {
+	Clear()
+	Count() int64
+	Dec(int64)
+	Inc(int64)
+	Snapshot() Counter
+}
+
+// CounterFloat64s hold a float64 value that can be incremented and
+// decremented, for counting fractional amounts such as money or scores.
+type CounterFloat64 interface {
+	Clear()
+	Count() float64
+	Dec(float64)
+	Inc(float64)
+	Snapshot() CounterFloat64
+}
+
+// DurationHistograms calculate distribution statistics from a series of
+// time.Duration values.  Unlike a Histogram of int64s there is no question of
+// whether values are nanoseconds or milliseconds: they are recorded and
+// reported as time.Durations and exporters convert them to their configured
+// DurationUnit.
+type DurationHistogram interface {
+	Clear()
+	Count() int64
+	Max() time.Duration
+	Mean() time.Duration
+	Min() time.Duration
+	Percentile(float64) time.Duration
+	Percentiles([]float64) []time.Duration
+	Sample() Sample
+	Snapshot() DurationHistogram
+	StdDev() time.Duration
+	Sum() time.Duration
+	Update(time.Duration)
+	UpdateSince(time.Time)
+}
+
+// EWMAs continuously calculate an exponentially-weighted moving average
+// based on an outside source of clock ticks.
+type EWMA interface {
+	Rate() float64
+	Snapshot() EWMA
+	Tick()
+	Update(int64)
+}
+
+// Gauges hold an int64 value that can be set arbitrarily.  Add, Sub, SetMax,
+// and SetMin change it atomically; SetMax and SetMin return whether they did.
+type Gauge interface {
+	Add(int64)
+	SetMax(int64) bool
+	SetMin(int64) bool
+	Snapshot() Gauge
+	Sub(int64)
+	Update(int64)
+	Value() int64
+}
+
+// GaugeFloat64s hold a float64 value that can be set arbitrarily.
+type GaugeFloat64 interface {
+	Snapshot() GaugeFloat64
+	Update(float64)
+	Value() float64
+}
+
+// Healthchecks hold an error value describing an arbitrary up/down status.
+type Healthcheck interface {
+	Check()
+	Error() error
+	Healthy()
+	Unhealthy(error)
+}
+
+// Histograms calculate distribution statistics from a series of int64 values.
+type Histogram interface {
+	Clear()
+	Count() int64
+	Max() int64
+	Mean() float64
+	Min() int64
+	Percentile(float64) float64
+	Percentiles([]float64) []float64
+	Sample() Sample
+	Snapshot() Histogram
+	StdDev() float64
+	Sum() int64
+	Update(int64)
+	UpdateWeighted(int64, float64)
+	Variance() float64
+}
+
+// Histogram2Ds count correlated pairs of int64 values, such as a request's
+// size and its latency, in a coarse grid of buckets so that the way one
+// varies with the other can be seen without tracing individual requests.
+//
+// Each axis is divided by a sorted slice of upper bounds.  A value falls in
+// the first bucket whose bound it does not exceed or, if it exceeds every
+// bound, in a final overflow bucket, so a grid with m x bounds and n y
+// bounds has (m+1)×(n+1) cells.
+type Histogram2D interface {
+	Clear()
+	Count() int64
+	Counts() [][]int64
+	Snapshot() Histogram2D
+	Update(x, y int64)
+	XBounds() []int64
+	YBounds() []int64
+}
+
+// Meters count events to produce exponentially-weighted moving average rates
+// at one-, five-, and fifteen-minutes and a mean rate.
+type Meter interface {
+	Count() int64
+	Mark(int64)
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+	Snapshot() Meter
+}
+
+// Registry is the part of a registry needed to look up, register, and
+// enumerate metrics.  Every metrics.Registry is one.
+type Registry interface {
+
+	// Call the given function for each registered metric.
+	Each(func(string, interface{}))
+
+	// Get the metric by the given name or nil if none is registered.
+	Get(string) interface{}
+
+	// Gets an existing metric or registers the given one.
+	// The interface can be the metric to register if not found in registry,
+	// or a function returning the metric for lazy instantiation.
+	GetOrRegister(string, interface{}) interface{}
+
+	// Register the given metric under the given name.
+	Register(string, interface{}) error
+
+	// Unregister the metric with the given name.
+	Unregister(string)
+}
+
+// Samples maintain a statistically-significant selection of values from
+// a stream.
+type Sample interface {
+	Clear()
+	Count() int64
+	Max() int64
+	Mean() float64
+	Min() int64
+	Percentile(float64) float64
+	Percentiles([]float64) []float64
+	Size() int
+	Snapshot() Sample
+	StdDev() float64
+	Sum() int64
+	Update(int64)
+	UpdateWeighted(int64, float64)
+	Values() []int64
+	Variance() float64
+}
+
+// Summaries track the count and sum of a series of float64 values and
+// estimate quantiles of those seen in a sliding time window.  Each quantile
+// is estimated to within its own absolute error target, so a summary with
+// objectives {0.5: 0.05, 0.99: 0.001} reports as its median a value ranked
+// between the 45th and 55th percentiles and as its 99th percentile one
+// ranked between the 98.9th and 99.1st.
+type Summary interface {
+	Count() int64
+	Objectives() []float64
+	Quantile(float64) float64
+	Quantiles() []float64
+	Snapshot() Summary
+	Sum() float64
+	Update(float64)
+}
+
+// Timers capture the duration and rate of events.
+type Timer interface {
+	Count() int64
+	Max() int64
+	Mean() float64
+	Min() int64
+	Percentile(float64) float64
+	Percentiles([]float64) []float64
+	Rate1() float64
+	Rate5() float64
+	Rate15() float64
+	RateMean() float64
+	Snapshot() Timer
+	StdDev() float64
+	Sum() int64
+	Time(func())
+	Update(time.Duration)
+	UpdateSince(time.Time)
+	Variance() float64
+}
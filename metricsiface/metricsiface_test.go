@@ -0,0 +1,36 @@
+package metricsiface_test
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
+
+// countRequests stands for a library which records to whatever Registry the
+// application gives it, depending only on metricsiface.
+func countRequests(r metricsiface.Registry) {
+	r.GetOrRegister("requests", metrics.NewCounter).(metricsiface.Counter).Inc(1)
+}
+
+func TestStandardRegistry(t *testing.T) {
+	r := metrics.NewRegistry()
+	countRequests(r)
+	countRequests(r)
+	if count := metrics.GetOrRegisterCounter("requests", r).Count(); 2 != count {
+		t.Errorf("requests.Count(): 2 != %v\n", count)
+	}
+}
+
+func TestStandardMetrics(t *testing.T) {
+	var _ metricsiface.Counter = metrics.NewCounter()
+	var _ metricsiface.CounterFloat64 = metrics.NewCounterFloat64()
+	var _ metricsiface.DurationHistogram = metrics.NewDurationHistogram(metrics.NewUniformSample(10))
+	var _ metricsiface.EWMA = metrics.NewEWMA1()
+	var _ metricsiface.Gauge = metrics.NewGauge()
+	var _ metricsiface.GaugeFloat64 = metrics.NewGaugeFloat64()
+	var _ metricsiface.Histogram = metrics.NewHistogram(metrics.NewUniformSample(10))
+	var _ metricsiface.Meter = metrics.NewMeter()
+	var _ metricsiface.Registry = metrics.NewRegistry()
+	var _ metricsiface.Timer = metrics.NewTimer()
+}
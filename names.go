@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxInternedNames bounds the size of a NameTable.  A table which outgrows it,
+// typically because of per-request dynamic names, is emptied and begins
+// again.
+const maxInternedNames = 1 << 16
+
+// A NameTable interns metric names and caches the sanitized forms exporters
+// derive from them, so that flushing a large registry every few seconds does
+// not rebuild the same strings over and over.
+type NameTable struct {
+	mutex sync.RWMutex
+	names map[string]*internedName
+}
+
+type internedName struct {
+	name         string
+	graphite     string
+	graphitePath string // As the Graphite exporter sends it, without tags
+	graphiteTags string // The ";k=v" tags of a name made by TaggedName
+	prometheus   string
+}
+
+// DefaultNameTable is used by the registries and exporters in this package.
+var DefaultNameTable = NewNameTable()
+
+// NewNameTable constructs a new, empty NameTable.
+func NewNameTable() *NameTable {
+	return &NameTable{names: make(map[string]*internedName)}
+}
+
+// Intern returns the canonical copy of the given name.
+func (t *NameTable) Intern(name string) string {
+	return t.lookup(name).name
+}
+
+// Graphite returns the given name with the characters that are significant
+// in Graphite's plaintext protocol, whitespace, replaced by underscores.
+func (t *NameTable) Graphite(name string) string {
+	return t.lookup(name).graphite
+}
+
+// Prometheus returns the given name as a valid Prometheus metric name, with
+// every character other than letters, digits, underscores, and colons
+// replaced by an underscore and a leading underscore added if the name begins
+// with a digit.
+func (t *NameTable) Prometheus(name string) string {
+	return t.lookup(name).prometheus
+}
+
+// Len returns the number of names in the table.
+func (t *NameTable) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.names)
+}
+
+func (t *NameTable) lookup(name string) *internedName {
+	t.mutex.RLock()
+	n, ok := t.names[name]
+	t.mutex.RUnlock()
+	if ok {
+		return n
+	}
+	n = &internedName{
+		name:         name,
+		graphite:     sanitizeGraphiteName(name),
+		graphitePath: name,
+		prometheus:   sanitizePrometheusName(name),
+	}
+	if i := strings.IndexByte(name, ';'); 0 <= i {
+		n.graphitePath, n.graphiteTags = name[:i], name[i:]
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if existing, ok := t.names[name]; ok {
+		return existing
+	}
+	if len(t.names) >= maxInternedNames {
+		t.names = make(map[string]*internedName)
+	}
+	t.names[name] = n
+	return n
+}
+
+// Intern returns the canonical copy of the given name from
+// DefaultNameTable.
+func Intern(name string) string {
+	return DefaultNameTable.Intern(name)
+}
+
+// GraphiteName returns the Graphite form of the given name from
+// DefaultNameTable.
+func GraphiteName(name string) string {
+	return DefaultNameTable.Graphite(name)
+}
+
+// PrometheusName returns the Prometheus form of the given name from
+// DefaultNameTable.
+func PrometheusName(name string) string {
+	return DefaultNameTable.Prometheus(name)
+}
+
+// TaggedName returns a name for one member of a family of metrics which
+// share the given name and are distinguished by tags, in the form
+// "name;k1=v1;k2=v2" with the tags sorted by key.  Semicolons, equals signs,
+// and whitespace in keys and values are replaced by underscores.  Exporters
+// which support tags, such as Graphite and OpenTSDB, export them as tags
+// and the rest use the name as is.
+func TaggedName(name string, tags map[string]string) string {
+	if 0 == len(tags) {
+		return name
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := []byte(name)
+	for _, k := range keys {
+		b = append(b, ';')
+		b = append(b, sanitizeTag(k)...)
+		b = append(b, '=')
+		b = append(b, sanitizeTag(tags[k])...)
+	}
+	return string(b)
+}
+
+// SplitTaggedName splits a name returned by TaggedName into the name of the
+// family and its tags, which are nil if it has none.
+func SplitTaggedName(tagged string) (string, map[string]string) {
+	parts := strings.Split(tagged, ";")
+	if 1 == len(parts) {
+		return tagged, nil
+	}
+	tags := make(map[string]string, len(parts)-1)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if 2 == len(kv) {
+			tags[kv[0]] = kv[1]
+		} else {
+			tags[kv[0]] = ""
+		}
+	}
+	return parts[0], tags
+}
+
+func sanitizeTag(s string) string {
+	return sanitizeName(s, func(i int, c byte) bool {
+		return ';' != c && '=' != c && ' ' != c && '\t' != c && '\n' != c && '\r' != c
+	}, false)
+}
+
+func sanitizeGraphiteName(name string) string {
+	return sanitizeName(name, func(i int, c byte) bool {
+		return ' ' != c && '\t' != c && '\n' != c && '\r' != c
+	}, false)
+}
+
+func sanitizePrometheusName(name string) string {
+	return sanitizeName(name, func(i int, c byte) bool {
+		return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '_' == c || ':' == c || 0 < i && '0' <= c && c <= '9'
+	}, true)
+}
+
+// sanitizeName replaces each byte of name for which valid returns false with
+// an underscore, returning name itself when no byte needs replacing.  A name
+// whose first byte is a digit and which is to be made a valid identifier is
+// prefixed with an underscore rather than losing the digit.
+func sanitizeName(name string, valid func(int, byte) bool, identifier bool) string {
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		if valid(i, name[i]) {
+			continue
+		}
+		if nil == b {
+			b = []byte(name)
+		}
+		b[i] = '_'
+	}
+	if nil == b {
+		return name
+	}
+	if identifier && 0 < len(name) && '0' <= name[0] && name[0] <= '9' {
+		b[0] = name[0]
+		return "_" + string(b)
+	}
+	return string(b)
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import "testing"
+
+func BenchmarkNameTableGraphite(b *testing.B) {
+	t := NewNameTable()
+	t.Intern("foo.bar baz")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.Graphite("foo.bar baz")
+	}
+}
+
+func TestNameTableGraphite(t *testing.T) {
+	nt := NewNameTable()
+	if s := nt.Graphite("foo.bar"); "foo.bar" != s {
+		t.Errorf("nt.Graphite(\"foo.bar\"): %q\n", s)
+	}
+	if s := nt.Graphite("foo bar\tbaz"); "foo_bar_baz" != s {
+		t.Errorf("nt.Graphite(\"foo bar\\tbaz\"): %q\n", s)
+	}
+}
+
+func TestNameTablePrometheus(t *testing.T) {
+	nt := NewNameTable()
+	for name, expected := range map[string]string{
+		"foo_bar:baz":   "foo_bar:baz",
+		"foo.bar-baz":   "foo_bar_baz",
+		"5xx.responses": "_5xx_responses",
+		"5xx":           "_5xx",
+		"":              "",
+	} {
+		if s := nt.Prometheus(name); expected != s {
+			t.Errorf("nt.Prometheus(%q): %q != %q\n", name, expected, s)
+		}
+	}
+}
+
+func TestNameTableAllocs(t *testing.T) {
+	nt := NewNameTable()
+	nt.Intern("foo.bar baz")
+	if n := testing.AllocsPerRun(100, func() {
+		nt.Graphite("foo.bar baz")
+		nt.Prometheus("foo.bar baz")
+	}); 0 != n {
+		t.Errorf("allocations per lookup: %v != 0\n", n)
+	}
+	if n := nt.Len(); 1 != n {
+		t.Errorf("nt.Len(): 1 != %v\n", n)
+	}
+}
+
+func TestNameTableLimit(t *testing.T) {
+	nt := NewNameTable()
+	for i := 0; i <= maxInternedNames; i++ {
+		nt.Intern(string([]byte{byte(i >> 16), byte(i >> 8), byte(i)}))
+	}
+	if n := nt.Len(); 1 != n {
+		t.Errorf("nt.Len(): 1 != %v\n", n)
+	}
+}
+
+func TestTaggedName(t *testing.T) {
+	tagged := TaggedName("requests", map[string]string{"status": "200", "endpoint": "/a;b=c"})
+	if "requests;endpoint=/a_b_c;status=200" != tagged {
+		t.Errorf("TaggedName: %q\n", tagged)
+	}
+	name, tags := SplitTaggedName(tagged)
+	if "requests" != name || 2 != len(tags) || "200" != tags["status"] || "/a_b_c" != tags["endpoint"] {
+		t.Errorf("SplitTaggedName(%q): %q, %v\n", tagged, name, tags)
+	}
+	if s := TaggedName("requests", nil); "requests" != s {
+		t.Errorf("TaggedName(\"requests\", nil): %q\n", s)
+	}
+	if name, tags := SplitTaggedName("requests"); "requests" != name || nil != tags {
+		t.Errorf("SplitTaggedName(\"requests\"): %q, %v\n", name, tags)
+	}
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Number is the constraint on the values of the generic metrics: any type
+// whose underlying type is int64 or float64, such as time.Duration.
+type Number interface {
+	~int64 | ~float64
+}
+
+// CounterOf is the implementation shared by counters of every Number type.
+// StandardCounter and StandardCounterFloat64 are a CounterOf[int64] and a
+// CounterOf[float64] with Snapshot methods; a CounterOf[time.Duration] may be
+// used as it is.  Its zero value is ready to use and it never blocks.
+type CounterOf[T Number] struct {
+	count atomicNumber[T]
+}
+
+// Clear sets the counter to zero.
+func (c *CounterOf[T]) Clear() { c.count.store(0) }
+
+// Count returns the current count.
+func (c *CounterOf[T]) Count() T { return c.count.load() }
+
+// Dec decrements the counter by the given amount.
+func (c *CounterOf[T]) Dec(v T) { c.count.add(-v) }
+
+// Inc increments the counter by the given amount.
+func (c *CounterOf[T]) Inc(v T) { c.count.add(v) }
+
+// GaugeOf is the implementation shared by gauges of every Number type.
+// StandardGauge and StandardGaugeFloat64 keep their values in a GaugeOf[int64]
+// and a GaugeOf[float64].  Its zero value is ready to use and it never
+// blocks.
+type GaugeOf[T Number] struct {
+	value atomicNumber[T]
+}
+
+// Add adds to the gauge's value atomically.
+func (g *GaugeOf[T]) Add(d T) { g.value.add(d) }
+
+// SetMax updates the gauge's value if the given value is greater, atomically,
+// so that it tracks a high-water mark without a lock around Value and Update.
+// It returns whether the value was updated.
+func (g *GaugeOf[T]) SetMax(v T) bool {
+	_, ok := g.value.replace(v, func(old T) bool { return old < v })
+	return ok
+}
+
+// SetMin updates the gauge's value if the given value is less, atomically.
+// It returns whether the value was updated.
+func (g *GaugeOf[T]) SetMin(v T) bool {
+	_, ok := g.value.replace(v, func(old T) bool { return v < old })
+	return ok
+}
+
+// Sub subtracts from the gauge's value atomically.
+func (g *GaugeOf[T]) Sub(d T) { g.value.add(-d) }
+
+// Swap updates the gauge's value and returns its previous value.
+func (g *GaugeOf[T]) Swap(v T) T { return g.value.swap(v) }
+
+// Update updates the gauge's value.
+func (g *GaugeOf[T]) Update(v T) { g.value.store(v) }
+
+// Value returns the gauge's current value.
+func (g *GaugeOf[T]) Value() T { return g.value.load() }
+
+// HistogramOf is the implementation shared by histograms of int64s and of
+// types such as time.Duration whose underlying type is int64, which is what a
+// Sample holds.  StandardHistogram and StandardDurationHistogram are built on
+// a HistogramOf[int64] and a HistogramOf[time.Duration].
+type HistogramOf[T ~int64] struct {
+	percentiles percentilesValue
+	sample      Sample
+}
+
+// NewHistogramOf constructs a new HistogramOf from a Sample.
+func NewHistogramOf[T ~int64](s Sample) *HistogramOf[T] {
+	return &HistogramOf[T]{sample: s}
+}
+
+// Clear clears the histogram and its sample.
+func (h *HistogramOf[T]) Clear() { h.sample.Clear() }
+
+// Count returns the number of samples recorded since the histogram was last
+// cleared.
+func (h *HistogramOf[T]) Count() int64 { return h.sample.Count() }
+
+// ExportedPercentiles returns the percentiles set by SetPercentiles or nil if
+// none have been.
+func (h *HistogramOf[T]) ExportedPercentiles() []float64 {
+	return h.percentiles.load()
+}
+
+// Max returns the maximum value in the sample.
+func (h *HistogramOf[T]) Max() T { return T(h.sample.Max()) }
+
+// Mean returns the mean of the values in the sample.
+func (h *HistogramOf[T]) Mean() float64 { return h.sample.Mean() }
+
+// Min returns the minimum value in the sample.
+func (h *HistogramOf[T]) Min() T { return T(h.sample.Min()) }
+
+// Percentile returns an arbitrary percentile of the values in the sample.
+func (h *HistogramOf[T]) Percentile(p float64) float64 {
+	return h.sample.Percentile(p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of the values in the
+// sample.
+func (h *HistogramOf[T]) Percentiles(ps []float64) []float64 {
+	return h.sample.Percentiles(ps)
+}
+
+// Sample returns the Sample underlying the histogram.
+func (h *HistogramOf[T]) Sample() Sample { return h.sample }
+
+// SetPercentiles sets the percentiles reporters export from the histogram in
+// place of its registry's or DefaultPercentiles, or, given nil, unsets them.
+func (h *HistogramOf[T]) SetPercentiles(ps []float64) {
+	h.percentiles.store(ps)
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (h *HistogramOf[T]) StdDev() float64 { return h.sample.StdDev() }
+
+// Sum returns the sum of every value recorded since the histogram was last
+// cleared.  Like Count, and unlike Mean and the percentiles, it isn't limited
+// to the values the sample retains, so backends can divide the increase in
+// Sum by the increase in Count to find the mean over any window.
+func (h *HistogramOf[T]) Sum() T { return T(sampleTotalSum(h.sample)) }
+
+// Update samples a new value.
+func (h *HistogramOf[T]) Update(v T) { h.sample.Update(int64(v)) }
+
+// UpdateSince samples the time elapsed since ts, which is meaningful only if
+// T is time.Duration or another count of nanoseconds.
+func (h *HistogramOf[T]) UpdateSince(ts time.Time) {
+	h.sample.Update(int64(time.Since(ts)))
+}
+
+// Variance returns the variance of the values in the sample.
+func (h *HistogramOf[T]) Variance() float64 { return h.sample.Variance() }
+
+// atomicNumber holds a Number in a uint64 so that integers and floats alike
+// may be loaded, stored, and added to atomically.  Integers are added to with
+// a single atomic add; floats, with a compare-and-swap loop.
+type atomicNumber[T Number] struct {
+	bits atomic.Uint64
+}
+
+func (a *atomicNumber[T]) add(d T) T {
+	if !isFloat[T]() {
+		return fromBits[T](a.bits.Add(toBits(d)))
+	}
+	for {
+		old := a.bits.Load()
+		v := fromBits[T](old) + d
+		if a.bits.CompareAndSwap(old, toBits(v)) {
+			return v
+		}
+	}
+}
+
+func (a *atomicNumber[T]) load() T { return fromBits[T](a.bits.Load()) }
+
+// replace stores v if f, given the current value, returns true, retrying
+// with a compare-and-swap loop until the value doesn't change between the
+// two.  It returns the value replaced, if any.
+func (a *atomicNumber[T]) replace(v T, f func(old T) bool) (T, bool) {
+	for {
+		bits := a.bits.Load()
+		old := fromBits[T](bits)
+		if !f(old) {
+			return old, false
+		}
+		if a.bits.CompareAndSwap(bits, toBits(v)) {
+			return old, true
+		}
+	}
+}
+
+func (a *atomicNumber[T]) store(v T) { a.bits.Store(toBits(v)) }
+
+func (a *atomicNumber[T]) swap(v T) T { return fromBits[T](a.bits.Swap(toBits(v))) }
+
+// isFloat returns whether T's underlying type is float64, which is the only
+// Number type in which one half isn't truncated to zero.
+func isFloat[T Number]() bool {
+	var half T = 1
+	half /= 2
+	return 0 != half
+}
+
+func fromBits[T Number](b uint64) T {
+	if isFloat[T]() {
+		return T(math.Float64frombits(b))
+	}
+	return T(int64(b))
+}
+
+func toBits[T Number](v T) uint64 {
+	if isFloat[T]() {
+		return math.Float64bits(float64(v))
+	}
+	return uint64(int64(v))
+}
@@ -0,0 +1,94 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func BenchmarkCounterOfFloat64(b *testing.B) {
+	var c CounterOf[float64]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Inc(0.5)
+	}
+}
+
+func TestCounterOfFloat64(t *testing.T) {
+	var c CounterOf[float64]
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	c.Dec(0.25)
+	if count := c.Count(); 4999.75 != count {
+		t.Errorf("c.Count(): 4999.75 != %v\n", count)
+	}
+	c.Clear()
+	if count := c.Count(); 0.0 != count {
+		t.Errorf("c.Count(): 0.0 != %v\n", count)
+	}
+}
+
+func TestCounterOfInt64Negative(t *testing.T) {
+	var c CounterOf[int64]
+	c.Dec(3)
+	c.Inc(1)
+	if count := c.Count(); -2 != count {
+		t.Errorf("c.Count(): -2 != %v\n", count)
+	}
+}
+
+func TestGaugeOfDuration(t *testing.T) {
+	var g GaugeOf[time.Duration]
+	g.Update(time.Second)
+	if old := g.Swap(-time.Millisecond); time.Second != old {
+		t.Errorf("g.Swap(): time.Second != %v\n", old)
+	}
+	if value := g.Value(); -time.Millisecond != value {
+		t.Errorf("g.Value(): -time.Millisecond != %v\n", value)
+	}
+}
+
+func TestGaugeOfFloat64(t *testing.T) {
+	var g GaugeOf[float64]
+	for _, v := range []float64{-1.5, math.MaxFloat64, math.Inf(1), 0.1} {
+		g.Update(v)
+		if value := g.Value(); v != value {
+			t.Errorf("g.Value(): %v != %v\n", v, value)
+		}
+	}
+	g.Update(math.NaN())
+	if value := g.Value(); !math.IsNaN(value) {
+		t.Errorf("g.Value(): NaN != %v\n", value)
+	}
+}
+
+func TestHistogramOfDuration(t *testing.T) {
+	h := NewHistogramOf[time.Duration](NewUniformSample(100))
+	h.Update(time.Millisecond)
+	h.Update(3 * time.Millisecond)
+	if max := h.Max(); 3*time.Millisecond != max {
+		t.Errorf("h.Max(): 3ms != %v\n", max)
+	}
+	if min := h.Min(); time.Millisecond != min {
+		t.Errorf("h.Min(): 1ms != %v\n", min)
+	}
+	if sum := h.Sum(); 4*time.Millisecond != sum {
+		t.Errorf("h.Sum(): 4ms != %v\n", sum)
+	}
+	if mean := h.Mean(); 2e6 != mean {
+		t.Errorf("h.Mean(): 2e6 != %v\n", mean)
+	}
+}
@@ -2,10 +2,13 @@ package metrics
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"log"
+	"io"
 	"net"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,10 +19,27 @@ var shortHostName string = ""
 // the OpenTSDB exporter
 type OpenTSDBConfig struct {
 	Addr          *net.TCPAddr  // Network address to connect to
+	Dialer        *Dialer       // If not nil, connects to a host name in place of Addr; see Dialer
 	Registry      Registry      // Registry to be exported
 	FlushInterval time.Duration // Flush interval
+	FlushTimeout  time.Duration // Deadline for each flush; zero means FlushInterval
 	DurationUnit  time.Duration // Time conversion unit for durations
 	Prefix        string        // Prefix to be prepended to metric names
+	ValuePolicy   *ValuePolicy  // NaN, ±Inf and negative value handling; nil means DefaultValuePolicy
+	Concurrency   Concurrency   // Goroutines encoding metrics; the zero value encodes serially
+	Changes       *ChangeFilter // Send only changed metrics; nil sends every metric
+	Downsampling  *Downsampling // Histogram detail to export; nil exports every detail
+	Schedules     []Schedule    // Metrics flushed at intervals of their own; see Schedule
+	DryRun        io.Writer     // If not nil, receives what would be sent instead of Addr
+	FloatFormat   *FloatFormat  // Formatting of floating-point values; nil keeps the defaults
+	Restricted    *Restriction  // Strip potentially sensitive tag values; nil exports every tag as it is
+
+	// IntervalExtremes sends each IntervalTimer's exact minimum and maximum
+	// since the previous flush; see GraphiteConfig.
+	IntervalExtremes bool
+	// Checksum ends each flush with a count and checksum of its lines; see
+	// GraphiteConfig.
+	Checksum bool
 }
 
 // OpenTSDB is a blocking exporter function which reports metrics in r
@@ -38,11 +58,25 @@ func OpenTSDB(r Registry, d time.Duration, prefix string, addr *net.TCPAddr) {
 // OpenTSDBWithConfig is a blocking exporter function just like OpenTSDB,
 // but it takes a OpenTSDBConfig instead.
 func OpenTSDBWithConfig(c OpenTSDBConfig) {
-	for _ = range time.Tick(c.FlushInterval) {
-		if err := openTSDB(&c); nil != err {
-			log.Println(err)
-		}
-	}
+	OpenTSDBWithConfigContext(context.Background(), c)
+}
+
+// OpenTSDBWithConfigContext is a blocking exporter function just like
+// OpenTSDBWithConfig, but it returns once ctx is done, interrupting any
+// flush in progress.  Each flush is bounded by c.FlushTimeout and those
+// which time out are counted by FlushTimeouts in c.Registry.
+func OpenTSDBWithConfigContext(ctx context.Context, c OpenTSDBConfig) {
+	runSchedules(ctx, "opentsdb", c.Registry, c.FlushInterval, c.FlushTimeout, c.Schedules, func(ctx context.Context, r Registry) error {
+		scheduled := c
+		scheduled.Registry = r
+		return openTSDB(ctx, &scheduled)
+	})
+}
+
+// OpenTSDBOnceContext performs a single submission to OpenTSDB, returning
+// a non-nil error on failed connections or once ctx is done.
+func OpenTSDBOnceContext(ctx context.Context, c OpenTSDBConfig) error {
+	return openTSDB(ctx, &c)
 }
 
 func getShortHostname() string {
@@ -57,63 +91,156 @@ func getShortHostname() string {
 	return shortHostName
 }
 
-func openTSDB(c *OpenTSDBConfig) error {
+func openTSDB(ctx context.Context, c *OpenTSDBConfig) error {
 	shortHostname := getShortHostname()
 	now := time.Now().Unix()
 	du := float64(c.DurationUnit)
-	conn, err := net.DialTCP("tcp", nil, c.Addr)
+	policy := valuePolicy(c.ValuePolicy)
+	conn, closeConn, err := openFlush(ctx, c.Addr, nil, c.Dialer, c.DryRun)
 	if nil != err {
 		return err
 	}
-	defer conn.Close()
+	defer closeConn()
 	w := bufio.NewWriter(conn)
-	c.Registry.Each(func(name string, i interface{}) {
+	out, sum := checksum(w, c.Checksum)
+	err = encodeConcurrently(out, c.Changes.each(c.Restricted.registry(c.Registry)), c.Concurrency, func(w io.Writer, name string, i interface{}) {
+		name, tags := openTSDBTaggedName(name, shortHostname)
+		hostTags := tags
+		putInt := func(key string, v int64) {
+			if v, ok := policy.Int(v); ok {
+				fmt.Fprintf(w, "put %s.%s.%s %d %d %s\n", c.Prefix, name, key, now, v, tags)
+			}
+		}
+		// OpenTSDB has no representation for NaN or ±Inf so they are
+		// dropped even when the policy says to export them.
+		putFloat := func(key, format string, v float64) {
+			if v, ok := policy.Float(v); ok && isFinite(v) {
+				fmt.Fprintf(w, "put %s.%s.%s %d %s %s\n", c.Prefix, name, key, now, c.FloatFormat.format(format, v), tags)
+			}
+		}
 		switch metric := i.(type) {
 		case Counter:
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, metric.Count(), shortHostname)
+			fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, metric.Count(), tags)
+		case CounterFloat64:
+			putFloat("count", "%f", metric.Count())
 		case Gauge:
-			fmt.Fprintf(w, "put %s.%s.value %d %d host=%s\n", c.Prefix, name, now, metric.Value(), shortHostname)
+			putInt("value", metric.Value())
 		case GaugeFloat64:
-			fmt.Fprintf(w, "put %s.%s.value %d %f host=%s\n", c.Prefix, name, now, metric.Value(), shortHostname)
+			putFloat("value", "%f", metric.Value())
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, h.Count(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.min %d %d host=%s\n", c.Prefix, name, now, h.Min(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.max %d %d host=%s\n", c.Prefix, name, now, h.Max(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, h.Mean(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.std-dev %d %.2f host=%s\n", c.Prefix, name, now, h.StdDev(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.50-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[0], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.75-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[1], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.95-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[2], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.99-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[3], shortHostname)
-			fmt.Fprintf(w, "put %s.%s.999-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[4], shortHostname)
+			percentiles := c.Downsampling.percentiles(ExportedPercentiles(c.Registry, i))
+			ps := h.Percentiles(percentiles)
+			fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, h.Count(), tags)
+			putInt("sum", h.Sum())
+			putInt("min", h.Min())
+			putInt("max", h.Max())
+			putFloat("mean", "%.2f", h.Mean())
+			putFloat("std-dev", "%.2f", h.StdDev())
+			for psIdx, psKey := range percentiles {
+				putFloat(openTSDBPercentileKey(psKey), "%.2f", ps[psIdx])
+			}
+		case DurationHistogram:
+			h := metric.Snapshot()
+			percentiles := c.Downsampling.percentiles(ExportedPercentiles(c.Registry, i))
+			ps := h.Percentiles(percentiles)
+			fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, h.Count(), tags)
+			putFloat("sum", "%.2f", float64(h.Sum())/du)
+			putInt("min", int64(h.Min())/int64(du))
+			putInt("max", int64(h.Max())/int64(du))
+			putFloat("mean", "%.2f", float64(h.Mean())/du)
+			putFloat("std-dev", "%.2f", float64(h.StdDev())/du)
+			for psIdx, psKey := range percentiles {
+				putFloat(openTSDBPercentileKey(psKey), "%.2f", float64(ps[psIdx])/du)
+			}
+		case Histogram2D:
+			h := c.Downsampling.histogram2D(metric)
+			fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, h.Count(), tags)
+			eachHistogram2DCell(h, func(x, y string, count int64) {
+				fmt.Fprintf(w, "put %s.%s.cell %d %d %s x=%s y=%s\n", c.Prefix, name, now, count, tags, x, y)
+			})
 		case Meter:
 			m := metric.Snapshot()
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, m.Count(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.one-minute %d %.2f host=%s\n", c.Prefix, name, now, m.Rate1(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.five-minute %d %.2f host=%s\n", c.Prefix, name, now, m.Rate5(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.fifteen-minute %d %.2f host=%s\n", c.Prefix, name, now, m.Rate15(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, m.RateMean(), shortHostname)
+			fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, m.Count(), tags)
+			fmt.Fprintf(w, "put %s.%s.one-minute %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", m.Rate1()), tags)
+			fmt.Fprintf(w, "put %s.%s.five-minute %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", m.Rate5()), tags)
+			fmt.Fprintf(w, "put %s.%s.fifteen-minute %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", m.Rate15()), tags)
+			fmt.Fprintf(w, "put %s.%s.mean %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", m.RateMean()), tags)
+		case Summary:
+			s := metric.Snapshot()
+			fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, s.Count(), tags)
+			putFloat("sum", "%.2f", s.Sum())
+			qs := s.Quantiles()
+			for qsIdx, qsKey := range s.Objectives() {
+				key := strings.Replace(strconv.FormatFloat(qsKey*100.0, 'f', -1, 64), ".", "", 1)
+				putFloat(key+"-percentile", "%.2f", qs[qsIdx])
+			}
+		case StagedTimer:
+			eachStage(metric.Snapshot(), func(stage string, h DurationHistogram) {
+				tags = hostTags + " stage=" + stage
+				percentiles := c.Downsampling.percentiles(ExportedPercentiles(c.Registry, h))
+				ps := h.Percentiles(percentiles)
+				fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, h.Count(), tags)
+				putFloat("sum", "%.2f", float64(h.Sum())/du)
+				putInt("min", int64(h.Min())/int64(du))
+				putInt("max", int64(h.Max())/int64(du))
+				putFloat("mean", "%.2f", float64(h.Mean())/du)
+				putFloat("std-dev", "%.2f", float64(h.StdDev())/du)
+				for psIdx, psKey := range percentiles {
+					putFloat(openTSDBPercentileKey(psKey), "%.2f", float64(ps[psIdx])/du)
+				}
+			})
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			fmt.Fprintf(w, "put %s.%s.count %d %d host=%s\n", c.Prefix, name, now, t.Count(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.min %d %d host=%s\n", c.Prefix, name, now, t.Min()/int64(du), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.max %d %d host=%s\n", c.Prefix, name, now, t.Max()/int64(du), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean %d %.2f host=%s\n", c.Prefix, name, now, t.Mean()/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.std-dev %d %.2f host=%s\n", c.Prefix, name, now, t.StdDev()/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.50-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[0]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.75-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[1]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.95-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[2]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.99-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[3]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.999-percentile %d %.2f host=%s\n", c.Prefix, name, now, ps[4]/du, shortHostname)
-			fmt.Fprintf(w, "put %s.%s.one-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate1(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.five-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate5(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.fifteen-minute %d %.2f host=%s\n", c.Prefix, name, now, t.Rate15(), shortHostname)
-			fmt.Fprintf(w, "put %s.%s.mean-rate %d %.2f host=%s\n", c.Prefix, name, now, t.RateMean(), shortHostname)
+			percentiles := c.Downsampling.percentiles(ExportedPercentiles(c.Registry, i))
+			ps := t.Percentiles(percentiles)
+			fmt.Fprintf(w, "put %s.%s.count %d %d %s\n", c.Prefix, name, now, t.Count(), tags)
+			putFloat("sum", "%.2f", float64(t.Sum())/du)
+			putInt("min", t.Min()/int64(du))
+			putInt("max", t.Max()/int64(du))
+			putFloat("mean", "%.2f", t.Mean()/du)
+			putFloat("std-dev", "%.2f", t.StdDev()/du)
+			for psIdx, psKey := range percentiles {
+				putFloat(openTSDBPercentileKey(psKey), "%.2f", ps[psIdx]/du)
+			}
+			fmt.Fprintf(w, "put %s.%s.one-minute %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", t.Rate1()), tags)
+			fmt.Fprintf(w, "put %s.%s.five-minute %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", t.Rate5()), tags)
+			fmt.Fprintf(w, "put %s.%s.fifteen-minute %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", t.Rate15()), tags)
+			fmt.Fprintf(w, "put %s.%s.mean-rate %d %s %s\n", c.Prefix, name, now, c.FloatFormat.format("%.2f", t.RateMean()), tags)
+			if min, max, ok := resetInterval(c.IntervalExtremes, i); ok {
+				putInt("interval-min", min/int64(du))
+				putInt("interval-max", max/int64(du))
+			}
 		}
-		w.Flush()
 	})
-	return nil
+	if nil != err {
+		return err
+	}
+	if nil != sum {
+		fmt.Fprintf(w, "put %s.flush.lines %d %d host=%s\n", c.Prefix, now, sum.lines, shortHostname)
+		fmt.Fprintf(w, "put %s.flush.crc32 %d %d host=%s\n", c.Prefix, now, sum.crc, shortHostname)
+	}
+	return w.Flush()
+}
+
+// openTSDBPercentileKey returns the key under which a percentile is exported,
+// such as "99-percentile" for 0.99 and "999-percentile" for 0.999.
+func openTSDBPercentileKey(p float64) string {
+	return strings.Replace(strconv.FormatFloat(p*100.0, 'f', -1, 64), ".", "", 1) + "-percentile"
+}
+
+// openTSDBTaggedName splits a name made by TaggedName into the name of the
+// family and its tags, formatted with the host tag as OpenTSDB expects.
+func openTSDBTaggedName(tagged, host string) (name, tags string) {
+	name, tagMap := SplitTaggedName(tagged)
+	tags = "host=" + host
+	keys := make([]string, 0, len(tagMap))
+	for k := range tagMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tags += " " + k + "=" + tagMap[k]
+	}
+	return name, tags
 }
@@ -1,7 +1,11 @@
 package metrics
 
 import (
+	"bytes"
+	"context"
 	"net"
+	"strings"
+	"testing"
 	"time"
 )
 
@@ -19,3 +23,30 @@ func ExampleOpenTSDBWithConfig() {
 		DurationUnit:  time.Millisecond,
 	})
 }
+
+func TestOpenTSDBTaggedName(t *testing.T) {
+	name, tags := openTSDBTaggedName(TaggedName("requests", map[string]string{"status": "200", "code": "ok"}), "web1")
+	if "requests" != name {
+		t.Errorf("name: requests != %q\n", name)
+	}
+	if "host=web1 code=ok status=200" != tags {
+		t.Errorf("tags: %q\n", tags)
+	}
+}
+
+func TestOpenTSDBOnceContextDryRun(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGauge("queue", r).Update(5)
+	var buf bytes.Buffer
+	if err := OpenTSDBOnceContext(context.Background(), OpenTSDBConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.HasPrefix(s, "put prefix.queue.value ") {
+		t.Errorf("opentsdb: %q\n", s)
+	}
+}
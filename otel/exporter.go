@@ -0,0 +1,239 @@
+package otel
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// ScopeName is the name of the instrumentation scope under which an
+// Exporter pushes metrics.
+const ScopeName = "github.com/rcrowley/go-metrics"
+
+// An Exporter walks a Registry periodically and pushes what it finds through
+// an OpenTelemetry SDK metric exporter, such as one from otlpmetricgrpc or
+// otlpmetrichttp, so that a service instrumented with go-metrics feeds an
+// OpenTelemetry Collector pipeline without being rewritten:
+//
+//	exp, err := otlpmetricgrpc.New(ctx)
+//	e := otel.NewExporter(metrics.DefaultRegistry, exp, resource.Default())
+//	go e.Export(10e9)
+//
+// Each metric becomes a stream named by its name, without tags, whose
+// attributes are the tags of a name made by metrics.TaggedName.  Every
+// stream is cumulative from the Exporter's construction.  Counters become
+// non-monotonic int64 sums; CounterFloat64s, non-monotonic float64 sums;
+// meters, monotonic int64 sums of their count; gauges and GaugeFloat64s,
+// gauges; and histograms, duration histograms, timers, staged timers, and
+// summaries, summaries of their exported percentiles, with durations in
+// seconds and a stage attribute for each stage of a staged timer.
+// Histogram2Ds and healthchecks are skipped.
+type Exporter struct {
+	exporter sdkmetric.Exporter
+	registry metrics.Registry
+	resource *resource.Resource
+	start    time.Time
+}
+
+// NewExporter constructs a new Exporter of the given registry, which is
+// DefaultRegistry if nil, through the given SDK exporter, describing the
+// metrics as those of the given resource, which is resource.Default() if
+// nil.
+func NewExporter(r metrics.Registry, exp sdkmetric.Exporter, res *resource.Resource) *Exporter {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	if nil == res {
+		res = resource.Default()
+	}
+	return &Exporter{exporter: exp, registry: r, resource: res, start: time.Now()}
+}
+
+// Export pushes the registry periodically.  This is designed to be called
+// as a goroutine.
+func (e *Exporter) Export(d time.Duration) {
+	for _ = range time.Tick(d) {
+		if err := e.ExportOnce(context.Background()); nil != err {
+			log.Println(err)
+		}
+	}
+}
+
+// ExportOnce pushes the registry once.
+func (e *Exporter) ExportOnce(ctx context.Context) error {
+	rm := e.collect(time.Now())
+	return e.exporter.Export(ctx, &rm)
+}
+
+// Shutdown shuts the SDK exporter down, after which it exports no more.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.exporter.Shutdown(ctx)
+}
+
+// collect converts the registry to ResourceMetrics as of the given time,
+// with one Metrics for each family of tagged names.
+func (e *Exporter) collect(now time.Time) metricdata.ResourceMetrics {
+	var (
+		families = make(map[string]*metricdata.Metrics)
+		names    []string
+	)
+	e.registry.Each(func(name string, i interface{}) {
+		family, tags := metrics.SplitTaggedName(name)
+		data, unit := e.data(now, i, tags)
+		if nil == data {
+			return
+		}
+		m, ok := families[family]
+		if !ok {
+			families[family] = &metricdata.Metrics{Name: family, Unit: unit, Data: data}
+			names = append(names, family)
+			return
+		}
+		m.Data = mergeData(m.Data, data)
+	})
+	sort.Strings(names)
+	sm := metricdata.ScopeMetrics{Scope: instrumentation.Scope{Name: ScopeName}}
+	for _, name := range names {
+		sm.Metrics = append(sm.Metrics, *families[name])
+	}
+	return metricdata.ResourceMetrics{Resource: e.resource, ScopeMetrics: []metricdata.ScopeMetrics{sm}}
+}
+
+// data returns the aggregation of one metric and its unit, or nil if it's of
+// a kind which isn't exported.
+func (e *Exporter) data(now time.Time, i interface{}, tags map[string]string) (metricdata.Aggregation, string) {
+	attrs := attributes(tags)
+	point := func(attrs attribute.Set, count int64, sum float64, qs, vs []float64) metricdata.SummaryDataPoint {
+		dp := metricdata.SummaryDataPoint{Attributes: attrs, StartTime: e.start, Time: now, Count: uint64(count), Sum: sum}
+		for j, q := range qs {
+			dp.QuantileValues = append(dp.QuantileValues, metricdata.QuantileValue{Quantile: q, Value: vs[j]})
+		}
+		return dp
+	}
+	switch metric := i.(type) {
+	case metrics.Counter:
+		return metricdata.Sum[int64]{
+			DataPoints:  []metricdata.DataPoint[int64]{{Attributes: attrs, StartTime: e.start, Time: now, Value: metric.Count()}},
+			Temporality: metricdata.CumulativeTemporality,
+		}, ""
+	case metrics.CounterFloat64:
+		return metricdata.Sum[float64]{
+			DataPoints:  []metricdata.DataPoint[float64]{{Attributes: attrs, StartTime: e.start, Time: now, Value: metric.Count()}},
+			Temporality: metricdata.CumulativeTemporality,
+		}, ""
+	case metrics.Gauge:
+		return metricdata.Gauge[int64]{
+			DataPoints: []metricdata.DataPoint[int64]{{Attributes: attrs, Time: now, Value: metric.Value()}},
+		}, ""
+	case metrics.GaugeFloat64:
+		return metricdata.Gauge[float64]{
+			DataPoints: []metricdata.DataPoint[float64]{{Attributes: attrs, Time: now, Value: metric.Value()}},
+		}, ""
+	case metrics.Meter:
+		return metricdata.Sum[int64]{
+			DataPoints:  []metricdata.DataPoint[int64]{{Attributes: attrs, StartTime: e.start, Time: now, Value: metric.Count()}},
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+		}, ""
+	case metrics.Histogram:
+		h := metric.Snapshot()
+		qs := metrics.ExportedPercentiles(e.registry, i)
+		return metricdata.Summary{
+			DataPoints: []metricdata.SummaryDataPoint{point(attrs, h.Count(), float64(h.Sum()), qs, h.Percentiles(qs))},
+		}, ""
+	case metrics.DurationHistogram:
+		h := metric.Snapshot()
+		qs := metrics.ExportedPercentiles(e.registry, i)
+		return metricdata.Summary{
+			DataPoints: []metricdata.SummaryDataPoint{point(attrs, h.Count(), h.Sum().Seconds(), qs, seconds(h.Percentiles(qs)))},
+		}, "s"
+	case metrics.StagedTimer:
+		t := metric.Snapshot()
+		var summary metricdata.Summary
+		for _, stage := range append(t.Stages(), metrics.TotalStage) {
+			h := t.Stage(stage)
+			qs := metrics.ExportedPercentiles(e.registry, h)
+			summary.DataPoints = append(summary.DataPoints, point(attributes(withTag(tags, "stage", stage)), h.Count(), h.Sum().Seconds(), qs, seconds(h.Percentiles(qs))))
+		}
+		return summary, "s"
+	case metrics.Summary:
+		s := metric.Snapshot()
+		return metricdata.Summary{
+			DataPoints: []metricdata.SummaryDataPoint{point(attrs, s.Count(), s.Sum(), s.Objectives(), s.Quantiles())},
+		}, ""
+	case metrics.Timer:
+		t := metric.Snapshot()
+		qs := metrics.ExportedPercentiles(e.registry, i)
+		ps := t.Percentiles(qs)
+		for j := range ps {
+			ps[j] /= float64(time.Second)
+		}
+		return metricdata.Summary{
+			DataPoints: []metricdata.SummaryDataPoint{point(attrs, t.Count(), float64(t.Sum())/float64(time.Second), qs, ps)},
+		}, "s"
+	}
+	return nil, ""
+}
+
+// attributes returns the attribute set of the given tags.
+func attributes(tags map[string]string) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(tags))
+	for k, v := range tags {
+		kvs = append(kvs, attribute.String(k, v))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+// mergeData appends the data points of b to those of a if they're of the
+// same kind, which they are unless the members of a family of tagged names
+// are of different kinds, in which case the first kind wins.
+func mergeData(a, b metricdata.Aggregation) metricdata.Aggregation {
+	switch a := a.(type) {
+	case metricdata.Gauge[int64]:
+		if b, ok := b.(metricdata.Gauge[int64]); ok {
+			a.DataPoints = append(a.DataPoints, b.DataPoints...)
+		}
+		return a
+	case metricdata.Gauge[float64]:
+		if b, ok := b.(metricdata.Gauge[float64]); ok {
+			a.DataPoints = append(a.DataPoints, b.DataPoints...)
+		}
+		return a
+	case metricdata.Sum[int64]:
+		if b, ok := b.(metricdata.Sum[int64]); ok && a.IsMonotonic == b.IsMonotonic {
+			a.DataPoints = append(a.DataPoints, b.DataPoints...)
+		}
+		return a
+	case metricdata.Summary:
+		if b, ok := b.(metricdata.Summary); ok {
+			a.DataPoints = append(a.DataPoints, b.DataPoints...)
+		}
+		return a
+	}
+	return a
+}
+
+func seconds(ds []time.Duration) []float64 {
+	fs := make([]float64, len(ds))
+	for i, d := range ds {
+		fs[i] = d.Seconds()
+	}
+	return fs
+}
+
+func withTag(tags map[string]string, k, v string) map[string]string {
+	with := make(map[string]string, len(tags)+1)
+	for tk, tv := range tags {
+		with[tk] = tv
+	}
+	with[k] = v
+	return with
+}
@@ -0,0 +1,59 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type testExporter struct {
+	exported []metricdata.ResourceMetrics
+}
+
+func (*testExporter) Aggregation(sdkmetric.InstrumentKind) sdkmetric.Aggregation { return nil }
+
+func (e *testExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.exported = append(e.exported, *rm)
+	return nil
+}
+
+func (*testExporter) ForceFlush(context.Context) error { return nil }
+
+func (*testExporter) Shutdown(context.Context) error { return nil }
+
+func (*testExporter) Temporality(sdkmetric.InstrumentKind) metricdata.Temporality {
+	return metricdata.CumulativeTemporality
+}
+
+func TestExporter(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"colo": "SJC"}), r).Inc(2)
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"colo": "LAX"}), r).Inc(1)
+	metrics.GetOrRegisterTimer("latency", r).Update(time.Second)
+	metrics.GetOrRegisterCounterFloat64("cpu", r).Inc(1.5)
+	metrics.GetOrRegisterHistogram2D("size_by_latency", r, []int64{1}, []int64{1})
+	exp := &testExporter{}
+	if err := NewExporter(r, exp, nil).ExportOnce(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(exp.exported) || 1 != len(exp.exported[0].ScopeMetrics) {
+		t.Fatalf("exported: %v\n", exp.exported)
+	}
+	ms := exp.exported[0].ScopeMetrics[0].Metrics
+	if 3 != len(ms) || "cpu" != ms[0].Name || "latency" != ms[1].Name || "requests" != ms[2].Name {
+		t.Fatalf("metrics: %v\n", ms)
+	}
+	if s, ok := ms[0].Data.(metricdata.Sum[float64]); !ok || 1 != len(s.DataPoints) || 1.5 != s.DataPoints[0].Value || s.IsMonotonic {
+		t.Errorf("cpu: %v\n", ms[0].Data)
+	}
+	if s, ok := ms[1].Data.(metricdata.Summary); !ok || 1 != s.DataPoints[0].Count || 1 != s.DataPoints[0].Sum || "s" != ms[1].Unit {
+		t.Errorf("latency: %v\n", ms[1])
+	}
+	if s, ok := ms[2].Data.(metricdata.Sum[int64]); !ok || 2 != len(s.DataPoints) || s.IsMonotonic {
+		t.Errorf("requests: %v\n", ms[2].Data)
+	}
+}
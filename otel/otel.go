@@ -0,0 +1,198 @@
+// Package otel bridges instruments written against the OpenTelemetry metrics
+// API into a go-metrics Registry, so that they're exported by the same
+// reporters as everything else while an application migrates, and exports a
+// Registry through the OpenTelemetry SDK's exporters in the other direction.
+package otel
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// A Bridge is an OpenTelemetry SDK metric Reader which copies what it
+// collects into a Registry.  Give it to a MeterProvider:
+//
+//	b := otel.NewBridge(metrics.DefaultRegistry)
+//	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(b))
+//	go b.Capture(10e9)
+//
+// Each stream becomes a metric named after its instrument and tagged with
+// its attributes as by metrics.TaggedName.  Int64 gauges become Gauges, float64
+// gauges and sums GaugeFloat64s, monotonic int64 sums Counters, other int64
+// sums Gauges, and histograms Histograms, which are given the registry's
+// SampleConfig and updated with each bucket's new observations weighted by
+// their number.  Exponential histograms and summaries are ignored.
+type Bridge struct {
+	*sdkmetric.ManualReader
+	buckets  map[string][]uint64
+	mutex    sync.Mutex
+	registry metrics.Registry
+}
+
+// NewBridge constructs a new Bridge into the given registry, which is
+// DefaultRegistry if nil, with a ManualReader configured by the given
+// options.
+func NewBridge(r metrics.Registry, opts ...sdkmetric.ManualReaderOption) *Bridge {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return &Bridge{
+		ManualReader: sdkmetric.NewManualReader(opts...),
+		buckets:      make(map[string][]uint64),
+		registry:     r,
+	}
+}
+
+// Capture collects from the instruments and updates the registry
+// periodically.  This is designed to be called as a goroutine.
+func (b *Bridge) Capture(d time.Duration) {
+	for _ = range time.Tick(d) {
+		if err := b.CaptureOnce(context.Background()); nil != err {
+			log.Println(err)
+		}
+	}
+}
+
+// CaptureOnce collects from the instruments and updates the registry.
+func (b *Bridge) CaptureOnce(ctx context.Context) error {
+	var rm metricdata.ResourceMetrics
+	if err := b.Collect(ctx, &rm); nil != err {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			b.update(m)
+		}
+	}
+	return nil
+}
+
+func (b *Bridge) update(m metricdata.Metrics) {
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		for _, dp := range data.DataPoints {
+			metrics.GetOrRegisterGauge(taggedName(m.Name, dp.Attributes), b.registry).Update(dp.Value)
+		}
+	case metricdata.Gauge[float64]:
+		for _, dp := range data.DataPoints {
+			metrics.GetOrRegisterGaugeFloat64(taggedName(m.Name, dp.Attributes), b.registry).Update(dp.Value)
+		}
+	case metricdata.Sum[int64]:
+		for _, dp := range data.DataPoints {
+			name := taggedName(m.Name, dp.Attributes)
+			if data.IsMonotonic {
+				c := metrics.GetOrRegisterCounter(name, b.registry)
+				if metricdata.DeltaTemporality == data.Temporality {
+					c.Inc(dp.Value)
+				} else {
+					c.Inc(dp.Value - c.Count())
+				}
+				continue
+			}
+			g := metrics.GetOrRegisterGauge(name, b.registry)
+			if metricdata.DeltaTemporality == data.Temporality {
+				g.Update(g.Value() + dp.Value)
+			} else {
+				g.Update(dp.Value)
+			}
+		}
+	case metricdata.Sum[float64]:
+		for _, dp := range data.DataPoints {
+			g := metrics.GetOrRegisterGaugeFloat64(taggedName(m.Name, dp.Attributes), b.registry)
+			if metricdata.DeltaTemporality == data.Temporality {
+				g.Update(g.Value() + dp.Value)
+			} else {
+				g.Update(dp.Value)
+			}
+		}
+	case metricdata.Histogram[int64]:
+		updateHistograms(b, m.Name, data.Temporality, data.DataPoints)
+	case metricdata.Histogram[float64]:
+		updateHistograms(b, m.Name, data.Temporality, data.DataPoints)
+	}
+}
+
+// updateHistograms updates a Histogram for each data point with the values
+// observed since the last collection.  Cumulative bucket counts are compared
+// with those seen last time and, if any has fallen because the stream was
+// reset, taken as new in their entirety.
+func updateHistograms[N int64 | float64](b *Bridge, name string, temporality metricdata.Temporality, dps []metricdata.HistogramDataPoint[N]) {
+	for _, dp := range dps {
+		tagged := taggedName(name, dp.Attributes)
+		h := metrics.GetOrRegisterHistogram(tagged, b.registry, nil)
+		var previous []uint64
+		if metricdata.CumulativeTemporality == temporality {
+			previous = b.buckets[tagged]
+			if len(previous) != len(dp.BucketCounts) {
+				previous = nil
+			}
+			for i, count := range previous {
+				if dp.BucketCounts[i] < count {
+					previous = nil
+					break
+				}
+			}
+			b.buckets[tagged] = append([]uint64(nil), dp.BucketCounts...)
+		}
+		for i, count := range dp.BucketCounts {
+			if nil != previous {
+				count -= previous[i]
+			}
+			if 0 < count {
+				h.UpdateWeighted(bucketValue(dp, i), float64(count))
+			}
+		}
+	}
+}
+
+// bucketValue returns the value which stands for the observations in the
+// given bucket of a data point: the midpoint of its bounds, narrowed by the
+// data point's minimum and maximum where they're known.  The first bucket's
+// lower bound and the overflow bucket's upper bound are their only bounds
+// unless the minimum and maximum say otherwise.
+func bucketValue[N int64 | float64](dp metricdata.HistogramDataPoint[N], i int) int64 {
+	bounds := dp.Bounds
+	if 0 == len(bounds) {
+		return int64(math.Floor(float64(dp.Sum)/float64(dp.Count) + 0.5))
+	}
+	var lo, hi float64
+	switch {
+	case 0 == i:
+		lo, hi = bounds[0], bounds[0]
+	case len(bounds) == i:
+		lo, hi = bounds[i-1], bounds[i-1]
+	default:
+		lo, hi = bounds[i-1], bounds[i]
+	}
+	if min, ok := dp.Min.Value(); ok && (0 == i || lo < float64(min)) {
+		lo = math.Min(float64(min), hi)
+	}
+	if max, ok := dp.Max.Value(); ok && (len(bounds) == i || float64(max) < hi) {
+		hi = math.Max(float64(max), lo)
+	}
+	return int64(math.Floor((lo+hi)/2 + 0.5))
+}
+
+// taggedName returns the name of an instrument tagged with a stream's
+// attributes.
+func taggedName(name string, attrs attribute.Set) string {
+	if 0 == attrs.Len() {
+		return name
+	}
+	tags := make(map[string]string, attrs.Len())
+	for iter := attrs.Iter(); iter.Next(); {
+		kv := iter.Attribute()
+		tags[string(kv.Key)] = kv.Value.Emit()
+	}
+	return metrics.TaggedName(name, tags)
+}
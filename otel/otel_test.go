@@ -0,0 +1,81 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func testBridgeCounter(t *testing.T, opts ...sdkmetric.ManualReaderOption) {
+	r := metrics.NewRegistry()
+	b := NewBridge(r, opts...)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(b))
+	defer provider.Shutdown(context.Background())
+	c, err := provider.Meter("test").Int64Counter("requests")
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	attrs := otelmetric.WithAttributes(attribute.String("colo", "SJC"))
+	name := metrics.TaggedName("requests", map[string]string{"colo": "SJC"})
+	c.Add(ctx, 3, attrs)
+	if err := b.CaptureOnce(ctx); nil != err {
+		t.Fatal(err)
+	}
+	if n := metrics.GetOrRegisterCounter(name, r).Count(); 3 != n {
+		t.Errorf("count: %d != 3\n", n)
+	}
+	c.Add(ctx, 4, attrs)
+	if err := b.CaptureOnce(ctx); nil != err {
+		t.Fatal(err)
+	}
+	if n := metrics.GetOrRegisterCounter(name, r).Count(); 7 != n {
+		t.Errorf("count: %d != 7\n", n)
+	}
+	if err := b.CaptureOnce(ctx); nil != err {
+		t.Fatal(err)
+	}
+	if n := metrics.GetOrRegisterCounter(name, r).Count(); 7 != n {
+		t.Errorf("count: %d != 7 without new observations\n", n)
+	}
+}
+
+func TestBridgeCounterCumulative(t *testing.T) {
+	testBridgeCounter(t)
+}
+
+func TestBridgeCounterDelta(t *testing.T) {
+	testBridgeCounter(t, sdkmetric.WithTemporalitySelector(func(sdkmetric.InstrumentKind) metricdata.Temporality {
+		return metricdata.DeltaTemporality
+	}))
+}
+
+func TestBridgeHistogram(t *testing.T) {
+	r := metrics.NewRegistry()
+	b := NewBridge(r)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(b))
+	defer provider.Shutdown(context.Background())
+	h, err := provider.Meter("test").Int64Histogram("latency", otelmetric.WithExplicitBucketBoundaries(10, 20))
+	if nil != err {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	h.Record(ctx, 15)
+	h.Record(ctx, 15)
+	if err := b.CaptureOnce(ctx); nil != err {
+		t.Fatal(err)
+	}
+	h.Record(ctx, 15)
+	if err := b.CaptureOnce(ctx); nil != err {
+		t.Fatal(err)
+	}
+	s := metrics.GetOrRegisterHistogram("latency", r, nil).Snapshot()
+	if 3 != s.Count() || 15 != s.Min() || 15 != s.Max() {
+		t.Errorf("histogram: count %d, min %d, max %d\n", s.Count(), s.Min(), s.Max())
+	}
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+)
+
+// DefaultMaxPacketSize is the largest datagram a reporter sends over UDP
+// unless configured otherwise, which fits in a single Ethernet frame along
+// with the IP and UDP headers of an IPv4 or IPv6 packet with some options.
+const DefaultMaxPacketSize = 1432
+
+// packetWriter packs the lines written to it into as few datagrams as
+// possible, each no larger than max bytes, and never splits a line between
+// datagrams.  A line too long to fit is sent in a datagram of its own.
+// Lines are held until the next line shows that no more will fit, so Flush
+// must be called to send the last of them.
+type packetWriter struct {
+	conn    io.Writer // Each Write sends one datagram
+	max     int
+	pending []byte
+}
+
+// dialPacketContext connects to a UDP addr as by dialContext and returns a
+// packetWriter which sends datagrams of at most max bytes, or
+// DefaultMaxPacketSize if max isn't positive.
+func dialPacketContext(ctx context.Context, addr *net.UDPAddr, max int) (*packetWriter, func(), error) {
+	conn, closeConn, err := dialContext(ctx, addr)
+	if nil != err {
+		return nil, nil, err
+	}
+	if max <= 0 {
+		max = DefaultMaxPacketSize
+	}
+	return &packetWriter{conn: conn, max: max}, closeConn, nil
+}
+
+// Flush sends every line not yet sent, including a final one which lacks a
+// newline.
+func (pw *packetWriter) Flush() error {
+	return pw.send(true)
+}
+
+// Write buffers p and sends every datagram that's full.
+func (pw *packetWriter) Write(p []byte) (int, error) {
+	pw.pending = append(pw.pending, p...)
+	return len(p), pw.send(false)
+}
+
+// next returns the length of the next datagram to send from the pending
+// lines, or zero if there's none, which is the case until the pending lines
+// overflow a datagram unless final is set.
+func (pw *packetWriter) next(final bool) int {
+	n := 0
+	for {
+		i := bytes.IndexByte(pw.pending[n:], '\n')
+		end := n + i + 1
+		if i < 0 {
+			if !final {
+				return 0
+			}
+			end = len(pw.pending)
+			if n == end {
+				return n
+			}
+		}
+		if pw.max < end {
+			if 0 == n {
+				return end
+			}
+			return n
+		}
+		n = end
+	}
+}
+
+func (pw *packetWriter) send(final bool) error {
+	for {
+		n := pw.next(final)
+		if 0 == n {
+			return nil
+		}
+		_, err := pw.conn.Write(pw.pending[:n])
+		pw.pending = append(pw.pending[:0], pw.pending[n:]...)
+		if nil != err {
+			return err
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// datagrams records each Write as a datagram.
+type datagrams []string
+
+func (d *datagrams) Write(p []byte) (int, error) {
+	*d = append(*d, string(p))
+	return len(p), nil
+}
+
+func TestPacketWriter(t *testing.T) {
+	var d datagrams
+	pw := &packetWriter{conn: &d, max: 10}
+	pw.Write([]byte("aaa\nbbb\ncc"))
+	pw.Write([]byte("c\nddddddddddddd\ne"))
+	pw.Write([]byte("ee\n"))
+	if 3 != len(d) || "aaa\nbbb\n" != d[0] || "ccc\n" != d[1] || "ddddddddddddd\n" != d[2] {
+		t.Errorf("datagrams: %q\n", d)
+	}
+	if err := pw.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if 4 != len(d) || "eee\n" != d[3] {
+		t.Errorf("datagrams: %q\n", d)
+	}
+	pw.Write([]byte("fff"))
+	pw.Flush()
+	if 5 != len(d) || "fff" != d[4] {
+		t.Errorf("datagrams: %q\n", d)
+	}
+}
+
+func TestGraphiteOnceUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := NewRegistry()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		NewRegisteredCounter(name, r).Inc(47)
+	}
+	if err := GraphiteOnce(GraphiteConfig{
+		UDPAddr:       conn.LocalAddr().(*net.UDPAddr),
+		MaxPacketSize: 100,
+		Registry:      r,
+		DurationUnit:  time.Nanosecond,
+		Prefix:        "prefix",
+	}); nil != err {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	lines, packets := 0, 0
+	for lines < 8 {
+		n, _, err := conn.ReadFrom(buf)
+		if nil != err {
+			t.Fatalf("%v after %v lines\n", err, lines)
+		}
+		if 100 < n || !strings.HasSuffix(string(buf[:n]), "\n") {
+			t.Errorf("datagram: %q\n", buf[:n])
+		}
+		lines += strings.Count(string(buf[:n]), "\n")
+		packets++
+	}
+	if packets < 2 || 8 <= packets {
+		t.Errorf("packets: %v\n", packets)
+	}
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// PairedTimers record two correlated durations of each event, such as a
+// proxied request's time to first byte and its total duration, in a single
+// sample of pairs, so that a snapshot of both is taken from the same events
+// and the pairs themselves may be examined.  Sampling the two in histograms
+// of their own would keep different events in each and skew any comparison
+// of them.
+//
+// A PairedTimer is a StagedTimer with one stage, the first duration, and the
+// total, the second, so it's exported as any other StagedTimer is.  Its
+// durations are recorded by Update or by a timing from Start which calls
+// Stage once and then Stop; the histograms returned by Stage and Total are
+// read-only snapshots.
+//
+// A PairedTimer constructed while metrics are disabled records nothing.
+type PairedTimer struct {
+	disabled bool // constructed while metrics were disabled
+	mutex    sync.Mutex
+	count    int64
+	firstSum int64 // of every first duration recorded, like count
+	next     int
+	pairs    []TimedPair // the most recent, a ring once full
+	size     int
+	stage    string
+	totalSum int64
+}
+
+// A TimedPair is the two durations of one event recorded by a PairedTimer.
+type TimedPair struct {
+	First, Total time.Duration
+}
+
+// GetOrRegisterPairedTimer returns an existing PairedTimer or constructs and
+// registers a new one whose first durations are of the named stage.
+func GetOrRegisterPairedTimer(name, stage string, r Registry) *PairedTimer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() *PairedTimer {
+		return newPairedTimer(stage, r.SampleConfig())
+	}).(*PairedTimer)
+}
+
+// NewPairedTimer constructs a new PairedTimer whose first durations are of
+// the named stage, such as "first_byte".  It keeps as many of the most
+// recent pairs as DefaultSampleConfig's reservoir holds durations.
+func NewPairedTimer(stage string) *PairedTimer {
+	return newPairedTimer(stage, DefaultSampleConfig)
+}
+
+// NewRegisteredPairedTimer constructs and registers a new PairedTimer whose
+// first durations are of the named stage.
+func NewRegisteredPairedTimer(name, stage string, r Registry) *PairedTimer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	t := newPairedTimer(stage, r.SampleConfig())
+	r.Register(name, t)
+	return t
+}
+
+func newPairedTimer(stage string, c SampleConfig) *PairedTimer {
+	if metricsDisabled || UseNilMetrics {
+		return &PairedTimer{disabled: true, stage: stage}
+	}
+	size := c.Size
+	if size <= 0 {
+		size = defaultSampleSize
+	}
+	return &PairedTimer{pairs: make([]TimedPair, 0, size), size: size, stage: stage}
+}
+
+// Clear clears every pair.
+func (t *PairedTimer) Clear() {
+	if t.disabled {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.count, t.firstSum, t.next, t.totalSum = 0, 0, 0, 0
+	t.pairs = t.pairs[:0]
+}
+
+// Count returns the number of pairs recorded.
+func (t *PairedTimer) Count() int64 {
+	if t.disabled {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.count
+}
+
+// Pairs returns a copy of the pairs in the sample, oldest first.
+func (t *PairedTimer) Pairs() []TimedPair {
+	if t.disabled {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	pairs := make([]TimedPair, 0, len(t.pairs))
+	pairs = append(pairs, t.pairs[t.next:]...)
+	return append(pairs, t.pairs[:t.next]...)
+}
+
+// Snapshot returns a read-only copy of the paired timer, a
+// StagedTimerSnapshot whose stage and total histograms hold the same events.
+func (t *PairedTimer) Snapshot() StagedTimer {
+	if t.disabled {
+		return NilStagedTimer{}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	first := make([]int64, len(t.pairs))
+	total := make([]int64, len(t.pairs))
+	for i, p := range t.pairs {
+		first[i], total[i] = int64(p.First), int64(p.Total)
+	}
+	return &StagedTimerSnapshot{
+		stages: map[string]DurationHistogram{
+			t.stage: &DurationHistogramSnapshot{sample: &SampleSnapshot{count: t.count, sum: t.firstSum, values: first}},
+		},
+		total: &DurationHistogramSnapshot{sample: &SampleSnapshot{count: t.count, sum: t.totalSum, values: total}},
+	}
+}
+
+// Stage returns a snapshot of the histogram of first durations if the named
+// stage is the timer's, of total durations if it's TotalStage, and otherwise
+// an empty histogram.
+func (t *PairedTimer) Stage(stage string) DurationHistogram {
+	if stage != t.stage && TotalStage != stage {
+		return NilDurationHistogram{}
+	}
+	return t.Snapshot().Stage(stage)
+}
+
+// Stages returns the name of the timer's stage.
+func (t *PairedTimer) Stages() []string { return []string{t.stage} }
+
+// Start begins timing an event: the timing's first call to Stage records the
+// first duration and Stop records the pair.
+func (t *PairedTimer) Start() *StagedTiming {
+	now := time.Now()
+	if t.disabled {
+		return &StagedTiming{last: now, start: now, timer: NilStagedTimer{}}
+	}
+	return &StagedTiming{last: now, start: now, timer: &pairedTiming{PairedTimer: t}}
+}
+
+// String formats the statistics of the stage and of the total for
+// debugging.
+func (t *PairedTimer) String() string { return stagedTimerString(t) }
+
+// Total returns a snapshot of the histogram of total durations.
+func (t *PairedTimer) Total() DurationHistogram { return t.Snapshot().Total() }
+
+// Update records the two durations of one event.
+func (t *PairedTimer) Update(first, total time.Duration) {
+	if t.disabled {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.count++
+	t.firstSum += int64(first)
+	t.totalSum += int64(total)
+	p := TimedPair{First: first, Total: total}
+	if len(t.pairs) < t.size {
+		t.pairs = append(t.pairs, p)
+		return
+	}
+	t.pairs[t.next] = p
+	t.next = (t.next + 1) % t.size
+}
+
+// pairedTiming is the StagedTimer through which a StagedTiming started by a
+// PairedTimer records its pair: the first duration is held until Stop.
+type pairedTiming struct {
+	*PairedTimer
+	first time.Duration
+}
+
+func (t *pairedTiming) Stage(string) DurationHistogram { return pairedFirst{timing: t} }
+
+func (t *pairedTiming) Total() DurationHistogram { return pairedTotal{timing: t} }
+
+// pairedFirst and pairedTotal are the write-only histograms of a
+// pairedTiming.
+type pairedFirst struct {
+	NilDurationHistogram
+	timing *pairedTiming
+}
+
+func (h pairedFirst) Update(d time.Duration) { h.timing.first = d }
+
+func (h pairedFirst) UpdateSince(ts time.Time) { h.Update(time.Since(ts)) }
+
+type pairedTotal struct {
+	NilDurationHistogram
+	timing *pairedTiming
+}
+
+func (h pairedTotal) Update(d time.Duration) { h.timing.PairedTimer.Update(h.timing.first, d) }
+
+func (h pairedTotal) UpdateSince(ts time.Time) { h.Update(time.Since(ts)) }
@@ -0,0 +1,57 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPairedTimer(t *testing.T) {
+	r := NewRegistry()
+	pt := GetOrRegisterPairedTimer("proxy", "first_byte", r)
+	pt.Update(time.Millisecond, 10*time.Millisecond)
+	pt.Update(2*time.Millisecond, 5*time.Millisecond)
+	if pt != GetOrRegisterPairedTimer("proxy", "first_byte", r) {
+		t.Error("GetOrRegisterPairedTimer(): expected the registered timer")
+	}
+	s := r.Get("proxy").(StagedTimer).Snapshot()
+	if count := s.Count(); 2 != count {
+		t.Errorf("s.Count(): 2 != %v\n", count)
+	}
+	if max := s.Stage("first_byte").Max(); 2*time.Millisecond != max {
+		t.Errorf("s.Stage(\"first_byte\").Max(): %v != %v\n", 2*time.Millisecond, max)
+	}
+	if sum := s.Total().Sum(); 15*time.Millisecond != sum {
+		t.Errorf("s.Total().Sum(): %v != %v\n", 15*time.Millisecond, sum)
+	}
+	if pairs := pt.Pairs(); 2 != len(pairs) || (TimedPair{time.Millisecond, 10 * time.Millisecond}) != pairs[0] {
+		t.Errorf("pt.Pairs(): %v\n", pairs)
+	}
+}
+
+func TestPairedTimerRing(t *testing.T) {
+	pt := newPairedTimer("first_byte", SampleConfig{Size: 2})
+	for i := 1; i <= 3; i++ {
+		pt.Update(time.Duration(i), time.Duration(10*i))
+	}
+	pairs := pt.Pairs()
+	if 2 != len(pairs) || 2 != pairs[0].First || 3 != pairs[1].First {
+		t.Errorf("pt.Pairs(): %v\n", pairs)
+	}
+	if count := pt.Count(); 3 != count {
+		t.Errorf("pt.Count(): 3 != %v\n", count)
+	}
+}
+
+func TestPairedTimerStart(t *testing.T) {
+	pt := NewPairedTimer("first_byte")
+	timing := pt.Start()
+	timing.Stage("first_byte")
+	timing.Stop()
+	pairs := pt.Pairs()
+	if 1 != len(pairs) || pairs[0].Total < pairs[0].First {
+		t.Errorf("pt.Pairs(): %v\n", pairs)
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// parallelChunkSize is the number of metrics each worker encodes at a time.
+const parallelChunkSize = 256
+
+// Concurrency configures how many goroutines a reporter uses to encode a
+// registry's metrics and how their output is written.
+type Concurrency struct {
+	Workers int  // Goroutines encoding metrics; 0 or 1 encodes serially
+	Ordered bool // Write output in registry order, by name, rather than as each chunk is encoded
+}
+
+type encodedChunk struct {
+	metrics []namedMetric
+	buf     bytes.Buffer
+	done    chan struct{}
+}
+
+// encodeConcurrently calls encode for every metric each yields, typically a
+// Registry's Each method.  With more than one worker, the metrics are split
+// into chunks which are encoded concurrently into buffers of their own and
+// written to w either in the order each yielded them or, when c.Ordered is
+// false, as soon as each is complete.  The first error returned by w is
+// returned.
+func encodeConcurrently(w io.Writer, each func(func(string, interface{})), c Concurrency, encode func(io.Writer, string, interface{})) error {
+	if c.Workers <= 1 {
+		each(func(name string, i interface{}) {
+			encode(w, name, i)
+		})
+		return nil
+	}
+
+	var chunks []*encodedChunk
+	each(func(name string, i interface{}) {
+		if 0 == len(chunks) || parallelChunkSize == len(chunks[len(chunks)-1].metrics) {
+			chunks = append(chunks, &encodedChunk{
+				metrics: make([]namedMetric, 0, parallelChunkSize),
+				done:    make(chan struct{}),
+			})
+		}
+		chunk := chunks[len(chunks)-1]
+		chunk.metrics = append(chunk.metrics, namedMetric{name, i})
+	})
+
+	jobs := make(chan *encodedChunk, len(chunks))
+	completed := make(chan *encodedChunk, len(chunks))
+	for _, chunk := range chunks {
+		jobs <- chunk
+	}
+	close(jobs)
+	var wg sync.WaitGroup
+	for n := 0; n < c.Workers && n < len(chunks); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				for _, m := range chunk.metrics {
+					encode(&chunk.buf, m.name, m.m)
+				}
+				close(chunk.done)
+				completed <- chunk
+			}
+		}()
+	}
+	defer wg.Wait()
+
+	var err error
+	for _, chunk := range chunks {
+		if !c.Ordered {
+			chunk = <-completed
+		}
+		<-chunk.done
+		if nil == err {
+			_, err = chunk.buf.WriteTo(w)
+		}
+	}
+	return err
+}
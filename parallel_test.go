@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func BenchmarkEncodeConcurrently(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < 10000; i++ {
+		NewRegisteredTimer(fmt.Sprintf("timer-%d", i), r).Update(47)
+	}
+	encode := func(w io.Writer, name string, i interface{}) {
+		t := i.(Timer).Snapshot()
+		fmt.Fprintf(w, "%s %v %v\n", name, t.Mean(), t.Percentiles([]float64{0.5, 0.99}))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encodeConcurrently(ioutil.Discard, r.Each, Concurrency{Workers: 8}, encode)
+	}
+}
+
+func testEncodeConcurrently(t *testing.T, c Concurrency) []string {
+	r := NewRegistry()
+	for i := 0; i < 3*parallelChunkSize+1; i++ {
+		NewRegisteredCounter(fmt.Sprintf("counter-%d", i), r).Inc(int64(i))
+	}
+	b := &bytes.Buffer{}
+	if err := encodeConcurrently(b, r.Each, c, func(w io.Writer, name string, i interface{}) {
+		fmt.Fprintf(w, "%s %d\n", name, i.(Counter).Count())
+	}); nil != err {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if 3*parallelChunkSize+1 != len(lines) {
+		t.Fatalf("len(lines): %v != %v\n", 3*parallelChunkSize+1, len(lines))
+	}
+	return lines
+}
+
+func TestEncodeConcurrently(t *testing.T) {
+	serial := testEncodeConcurrently(t, Concurrency{})
+	sort.Strings(serial)
+	for _, c := range []Concurrency{{Workers: 4}, {Workers: 4, Ordered: true}} {
+		lines := testEncodeConcurrently(t, c)
+		sort.Strings(lines)
+		for i := range lines {
+			if serial[i] != lines[i] {
+				t.Fatalf("%+v: %q != %q\n", c, serial[i], lines[i])
+			}
+		}
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, io.ErrClosedPipe }
+
+func TestEncodeConcurrentlyError(t *testing.T) {
+	r := NewRegistry()
+	for i := 0; i < 2*parallelChunkSize; i++ {
+		NewRegisteredCounter(fmt.Sprintf("counter-%d", i), r)
+	}
+	if err := encodeConcurrently(errWriter{}, r.Each, Concurrency{Workers: 4}, func(w io.Writer, name string, i interface{}) {
+		fmt.Fprintln(w, name)
+	}); io.ErrClosedPipe != err {
+		t.Errorf("err: %v\n", err)
+	}
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// DefaultPercentiles are the percentiles reporters export from histograms,
+// duration histograms, and timers which, like their registries, haven't
+// been given a set of their own.
+var DefaultPercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// A PercentileSet carries the percentiles reporters should export from it.
+// Histograms, duration histograms, and timers, their snapshots, and
+// StandardRegistry are PercentileSets, whose SetPercentiles methods set the
+// percentiles and whose ExportedPercentiles methods return nil until then.
+type PercentileSet interface {
+	ExportedPercentiles() []float64
+}
+
+// ExportedPercentiles returns the percentiles reporters should export from
+// the given metric in r: its own, if it has been given some, or else r's, or
+// else DefaultPercentiles.
+func ExportedPercentiles(r Registry, i interface{}) []float64 {
+	return exportedPercentiles(r, i, nil)
+}
+
+// exportedPercentiles returns the percentiles to export from the given
+// metric in r, preferring a reporter's configured percentiles, if not nil,
+// to r's but not to the metric's own.
+func exportedPercentiles(r Registry, i interface{}, configured []float64) []float64 {
+	if s, ok := unwrap(i).(PercentileSet); ok {
+		if ps := s.ExportedPercentiles(); nil != ps {
+			return ps
+		}
+	}
+	if nil != configured {
+		return configured
+	}
+	if ps := registryPercentiles(r); nil != ps {
+		return ps
+	}
+	return DefaultPercentiles
+}
+
+// registryPercentiles returns the percentiles set for r or nil if none have
+// been.
+func registryPercentiles(r Registry) []float64 {
+	if s, ok := r.(PercentileSet); ok {
+		return s.ExportedPercentiles()
+	}
+	return nil
+}
+
+// percentileLabel labels a percentile for the text and JSON reporters: the
+// median, 75%, 99.9%, and so on.
+func percentileLabel(p float64) string {
+	if 0.5 == p {
+		return "median"
+	}
+	return strconv.FormatFloat(p*100.0, 'f', -1, 64) + "%"
+}
+
+// percentilesValue holds a metric's or a registry's percentiles.  Its zero
+// value holds none.
+type percentilesValue struct {
+	value atomic.Value // []float64
+}
+
+// load returns the percentiles set or nil if none have been.
+func (p *percentilesValue) load() []float64 {
+	ps, _ := p.value.Load().([]float64)
+	return ps
+}
+
+// store sets the percentiles, copying them so that the caller may reuse the
+// slice, or unsets them if ps is nil.
+func (p *percentilesValue) store(ps []float64) {
+	if nil != ps {
+		ps = append(make([]float64, 0, len(ps)), ps...)
+	}
+	p.value.Store(ps)
+}
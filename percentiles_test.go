@@ -0,0 +1,76 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportedPercentiles(t *testing.T) {
+	r := NewRegistry()
+	h := NewRegisteredHistogram("h", r, NewUniformSample(100)).(*StandardHistogram)
+	tm := NewRegisteredTimer("t", r).(*StandardTimer)
+	if ps := ExportedPercentiles(r, h); !reflect.DeepEqual(DefaultPercentiles, ps) {
+		t.Errorf("ExportedPercentiles(r, h): %v != %v\n", DefaultPercentiles, ps)
+	}
+
+	r.(*StandardRegistry).SetPercentiles([]float64{0.5, 0.9})
+	if ps := ExportedPercentiles(r, h); !reflect.DeepEqual([]float64{0.5, 0.9}, ps) {
+		t.Errorf("ExportedPercentiles(r, h): [0.5 0.9] != %v\n", ps)
+	}
+	if ps := ExportedPercentiles(&PrefixedRegistry{underlying: r, prefix: "prefix."}, tm); !reflect.DeepEqual([]float64{0.5, 0.9}, ps) {
+		t.Errorf("ExportedPercentiles(prefixed, tm): [0.5 0.9] != %v\n", ps)
+	}
+
+	own := []float64{0.99, 0.999}
+	tm.SetPercentiles(own)
+	own[0] = 0
+	if ps := ExportedPercentiles(r, tm); !reflect.DeepEqual([]float64{0.99, 0.999}, ps) {
+		t.Errorf("ExportedPercentiles(r, tm): [0.99 0.999] != %v\n", ps)
+	}
+	if ps := ExportedPercentiles(r, tm.Snapshot()); !reflect.DeepEqual([]float64{0.99, 0.999}, ps) {
+		t.Errorf("ExportedPercentiles(r, tm.Snapshot()): [0.99 0.999] != %v\n", ps)
+	}
+	if ps := ExportedPercentiles(r, h); !reflect.DeepEqual([]float64{0.5, 0.9}, ps) {
+		t.Errorf("ExportedPercentiles(r, h): [0.5 0.9] != %v\n", ps)
+	}
+
+	tm.SetPercentiles(nil)
+	if ps := ExportedPercentiles(r, tm); !reflect.DeepEqual([]float64{0.5, 0.9}, ps) {
+		t.Errorf("ExportedPercentiles(r, tm): [0.5 0.9] != %v\n", ps)
+	}
+}
+
+func TestPercentileLabel(t *testing.T) {
+	for p, label := range map[float64]string{
+		0.5:    "median",
+		0.75:   "75%",
+		0.999:  "99.9%",
+		0.9999: "99.99%",
+	} {
+		if l := percentileLabel(p); label != l {
+			t.Errorf("percentileLabel(%v): %q != %q\n", p, label, l)
+		}
+	}
+}
+
+func TestWriteOncePercentiles(t *testing.T) {
+	r := NewRegistry()
+	tm := NewRegisteredTimer("latency", r).(*StandardTimer)
+	tm.SetPercentiles([]float64{0.5, 0.9999})
+	tm.Update(time.Millisecond)
+	var buf bytes.Buffer
+	WriteOnce(r, &buf)
+	s := buf.String()
+	if !strings.Contains(s, "  median:") || !strings.Contains(s, "  99.99%:") {
+		t.Errorf("WriteOnce: %q\n", s)
+	}
+	if strings.Contains(s, "  95%:") {
+		t.Errorf("WriteOnce: %q\n", s)
+	}
+}
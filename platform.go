@@ -0,0 +1,12 @@
+//go:build !js && !wasip1 && !tinygo
+// +build !js,!wasip1,!tinygo
+
+package metrics
+
+// defaultSampleSize is the reservoir size of DefaultSampleConfig and of the
+// samples behind the runtime's and the garbage collector's histograms.
+const defaultSampleSize = 1028
+
+// defaultTickSource is DefaultTickSource's initial value: the arbiter, which
+// ticks every meter from the package's scheduler goroutine.
+var defaultTickSource TickSource = arbiter
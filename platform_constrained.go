@@ -0,0 +1,13 @@
+//go:build js || wasip1 || tinygo
+// +build js wasip1 tinygo
+
+package metrics
+
+// defaultSampleSize is smaller under js, wasip1, and TinyGo, whose heaps are
+// often limited to a few megabytes, so that each histogram and timer holds an
+// eighth as many values.
+const defaultSampleSize = 128
+
+// defaultTickSource ticks meters as they're read rather than from a
+// goroutine, which may not be scheduled until the host yields.
+var defaultTickSource TickSource = NewLazyTickSource()
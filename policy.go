@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// ValueAction describes what a reporter does with a value that falls into
+// one of the categories governed by a ValuePolicy.
+type ValueAction int
+
+const (
+	// ValueExport passes the value through unchanged, leaving it to the
+	// reporter to encode it as well as its backend allows.  Reporters whose
+	// wire format has no representation for NaN or ±Inf drop such values.
+	ValueExport ValueAction = iota
+
+	// ValueReject drops the value so that it is never sent.
+	ValueReject
+
+	// ValueClamp replaces the value with the nearest representable one: NaN
+	// becomes zero, ±Inf becomes ±math.MaxFloat64 and negative values
+	// become zero.
+	ValueClamp
+)
+
+// ValuePolicy determines how reporters treat NaN, ±Inf, and negative values
+// read from gauges, histograms, and timers.  Counters and meter rates are
+// not subject to the policy.
+type ValuePolicy struct {
+	NaN      ValueAction
+	Inf      ValueAction
+	Negative ValueAction
+}
+
+// DefaultValuePolicy is used by every reporter that has not been given a
+// ValuePolicy of its own.  It exports everything unchanged.  Reporters read
+// it without synchronization so it must be set before any of them start.
+var DefaultValuePolicy = ValuePolicy{
+	NaN:      ValueExport,
+	Inf:      ValueExport,
+	Negative: ValueExport,
+}
+
+// Float applies the policy to a float64 value, returning the value to report
+// and whether it should be reported at all.
+func (p ValuePolicy) Float(v float64) (float64, bool) {
+	switch {
+	case math.IsNaN(v):
+		switch p.NaN {
+		case ValueReject:
+			return 0, false
+		case ValueClamp:
+			return 0, true
+		}
+		return v, true
+	case math.IsInf(v, 0):
+		switch p.Inf {
+		case ValueReject:
+			return 0, false
+		case ValueClamp:
+			v = math.Copysign(math.MaxFloat64, v)
+		default:
+			return v, true
+		}
+	}
+	if v < 0 {
+		switch p.Negative {
+		case ValueReject:
+			return 0, false
+		case ValueClamp:
+			return 0, true
+		}
+	}
+	return v, true
+}
+
+// Int applies the policy to an int64 value, returning the value to report
+// and whether it should be reported at all.
+func (p ValuePolicy) Int(v int64) (int64, bool) {
+	if v < 0 {
+		switch p.Negative {
+		case ValueReject:
+			return 0, false
+		case ValueClamp:
+			return 0, true
+		}
+	}
+	return v, true
+}
+
+// valuePolicy returns the given policy or DefaultValuePolicy if it is nil.
+func valuePolicy(p *ValuePolicy) ValuePolicy {
+	if nil == p {
+		return DefaultValuePolicy
+	}
+	return *p
+}
+
+// isFinite reports whether v is neither NaN nor ±Inf.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// jsonFloat is a float64 which marshals NaN and ±Inf, which JSON cannot
+// represent, as the strings "NaN", "+Inf", and "-Inf".
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return json.Marshal(v)
+}
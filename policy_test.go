@@ -0,0 +1,124 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestValuePolicyExport(t *testing.T) {
+	p := ValuePolicy{}
+	if v, ok := p.Float(math.NaN()); !ok || !math.IsNaN(v) {
+		t.Errorf("p.Float(NaN): %v, %v\n", v, ok)
+	}
+	if v, ok := p.Float(math.Inf(-1)); !ok || !math.IsInf(v, -1) {
+		t.Errorf("p.Float(-Inf): %v, %v\n", v, ok)
+	}
+	if v, ok := p.Int(-47); !ok || -47 != v {
+		t.Errorf("p.Int(-47): %v, %v\n", v, ok)
+	}
+}
+
+func TestValuePolicyReject(t *testing.T) {
+	p := ValuePolicy{NaN: ValueReject, Inf: ValueReject, Negative: ValueReject}
+	if _, ok := p.Float(math.NaN()); ok {
+		t.Error("p.Float(NaN) wasn't rejected")
+	}
+	if _, ok := p.Float(math.Inf(1)); ok {
+		t.Error("p.Float(+Inf) wasn't rejected")
+	}
+	if _, ok := p.Float(-0.5); ok {
+		t.Error("p.Float(-0.5) wasn't rejected")
+	}
+	if _, ok := p.Int(-1); ok {
+		t.Error("p.Int(-1) wasn't rejected")
+	}
+	if v, ok := p.Float(47.5); !ok || 47.5 != v {
+		t.Errorf("p.Float(47.5): %v, %v\n", v, ok)
+	}
+}
+
+func TestValuePolicyClamp(t *testing.T) {
+	p := ValuePolicy{NaN: ValueClamp, Inf: ValueClamp, Negative: ValueClamp}
+	if v, ok := p.Float(math.NaN()); !ok || 0 != v {
+		t.Errorf("p.Float(NaN): %v, %v\n", v, ok)
+	}
+	if v, ok := p.Float(math.Inf(1)); !ok || math.MaxFloat64 != v {
+		t.Errorf("p.Float(+Inf): %v, %v\n", v, ok)
+	}
+	if v, ok := p.Float(math.Inf(-1)); !ok || 0 != v {
+		t.Errorf("p.Float(-Inf): %v, %v\n", v, ok)
+	}
+	if v, ok := p.Int(-47); !ok || 0 != v {
+		t.Errorf("p.Int(-47): %v, %v\n", v, ok)
+	}
+
+	p.Negative = ValueExport
+	if v, ok := p.Float(math.Inf(-1)); !ok || -math.MaxFloat64 != v {
+		t.Errorf("p.Float(-Inf): %v, %v\n", v, ok)
+	}
+}
+
+func TestRegistryMarshallJSONNonFinite(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("nan", r).Update(math.NaN())
+	NewRegisteredGaugeFloat64("inf", r).Update(math.Inf(1))
+	b := &bytes.Buffer{}
+	if err := json.NewEncoder(b).Encode(r); nil != err {
+		t.Fatal(err)
+	}
+	if s := b.String(); "{\"inf\":{\"value\":\"+Inf\"},\"nan\":{\"value\":\"NaN\"}}\n" != s {
+		t.Fatal(s)
+	}
+}
+
+func TestRegistryMarshallJSONPolicy(t *testing.T) {
+	defer func(p ValuePolicy) { DefaultValuePolicy = p }(DefaultValuePolicy)
+	DefaultValuePolicy = ValuePolicy{NaN: ValueReject, Negative: ValueClamp}
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("nan", r).Update(math.NaN())
+	NewRegisteredGauge("negative", r).Update(-47)
+	b, err := json.Marshal(r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if s := string(b); "{\"nan\":{},\"negative\":{\"value\":0}}" != s {
+		t.Fatal(s)
+	}
+}
+
+func TestWriteJSONOnceWithConfigPolicy(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("nan", r).Update(math.NaN())
+	NewRegisteredGauge("negative", r).Update(-47)
+	b := &bytes.Buffer{}
+	if err := WriteJSONOnceWithConfig(JSONConfig{
+		Registry:    r,
+		Writer:      b,
+		ValuePolicy: &ValuePolicy{NaN: ValueReject, Negative: ValueClamp},
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if s := b.String(); "{\"nan\":{},\"negative\":{\"value\":0}}\n" != s {
+		t.Fatal(s)
+	}
+}
+
+func TestWriteOnceWithConfigPolicy(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredGaugeFloat64("nan", r).Update(math.NaN())
+	NewRegisteredGauge("negative", r).Update(-47)
+	b := &bytes.Buffer{}
+	WriteOnceWithConfig(WriterConfig{
+		Registry:    r,
+		Writer:      b,
+		ValuePolicy: &ValuePolicy{NaN: ValueReject, Negative: ValueClamp},
+	})
+	if s := b.String(); "gauge nan\ngauge negative\n  value:               0\n" != s {
+		t.Fatalf("%q\n", s)
+	}
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import "time"
+
+// PollGauge registers a gauge of the given name, or uses the one already
+// registered, and updates it with the value f returns every interval until
+// the returned function is called to stop.
+//
+// Every polled gauge shares the package's one scheduler goroutine and timer,
+// so polling hundreds of gauges doesn't create hundreds of tickers.  Each
+// gauge is first polled at a random point within its interval so that
+// gauges with equal intervals don't all poll at once; thereafter it keeps
+// that phase.  Since f runs on the shared goroutine it should return
+// quickly.
+func PollGauge(name string, r Registry, interval time.Duration, f func() int64) (stop func()) {
+	g := GetOrRegisterGauge(name, r)
+	t := tasks.every("poll "+name, priorityCollect, interval, true, func(time.Time) {
+		g.Update(f())
+	})
+	return func() { tasks.stop(t) }
+}
@@ -0,0 +1,55 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPollGauge(t *testing.T) {
+	r := NewRegistry()
+	var n int64
+	stop := PollGauge("polled", r, time.Millisecond, func() int64 {
+		return atomic.AddInt64(&n, 1)
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&n) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	polled := atomic.LoadInt64(&n)
+	if polled < 3 {
+		t.Fatalf("polled %d times, expected at least 3\n", polled)
+	}
+	if value := GetOrRegisterGauge("polled", r).Value(); value < 1 {
+		t.Errorf("polled.Value(): %v < 1\n", value)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if after := atomic.LoadInt64(&n); polled+1 < after {
+		t.Errorf("polled %d times after stop\n", after-polled)
+	}
+	stop()
+}
+
+func TestPollGaugeShared(t *testing.T) {
+	r := NewRegistry()
+	var stops []func()
+	for i := 0; i < 100; i++ {
+		stops = append(stops, PollGauge("shared", r, time.Hour, func() int64 { return 0 }))
+	}
+	polls := 0
+	for _, task := range ScheduledTasks() {
+		if "poll shared" == task.Name {
+			polls++
+		}
+	}
+	if 100 != polls {
+		t.Errorf("ScheduledTasks(): 100 != %d polls\n", polls)
+	}
+	for _, stop := range stops {
+		stop()
+	}
+}
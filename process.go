@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	processMetrics struct {
+		CPUSystem        Gauge
+		CPUUser          Gauge
+		Handles          Gauge
+		Resident         Gauge
+		Virtual          Gauge
+		ReadProcessStats Timer
+	}
+
+	// errProcessStatsUnsupported is returned by readProcessStats on
+	// platforms other than Linux, Windows, and, built with cgo, macOS.
+	errProcessStatsUnsupported = errors.New("metrics: process statistics are unsupported on this platform")
+)
+
+// processStats are the statistics of the process which every platform's
+// readProcessStats reports, so that a service's process metrics mean the
+// same things wherever it runs.
+type processStats struct {
+	CPUSystem time.Duration // CPU time spent in the kernel
+	CPUUser   time.Duration // CPU time spent in user space
+	Handles   int64         // Open file descriptors or, on Windows, handles
+	Resident  int64         // Resident set or, on Windows, working set bytes
+	Virtual   int64         // Virtual memory or, on Windows, commit bytes
+}
+
+// Capture new values for the process's CPU time, memory, and open files or
+// handles.  This is designed to be called as a goroutine.
+func CaptureProcessStats(r Registry, d time.Duration) {
+	for _ = range tick("process", priorityCollect, d) {
+		CaptureProcessStatsOnce(r)
+	}
+}
+
+// Capture new values for the process's CPU time, memory, and open files or
+// handles.  Giving a registry which has not been given to
+// RegisterProcessStats will panic.  On platforms where the statistics can't
+// be read, currently all but Linux, Windows, and macOS built with cgo, the
+// metrics keep their values.
+func CaptureProcessStatsOnce(r Registry) {
+	t := time.Now()
+	stats, err := readProcessStats()
+	processMetrics.ReadProcessStats.UpdateSince(t)
+	if nil != err {
+		return
+	}
+	processMetrics.CPUSystem.Update(int64(stats.CPUSystem))
+	processMetrics.CPUUser.Update(int64(stats.CPUUser))
+	processMetrics.Handles.Update(stats.Handles)
+	processMetrics.Resident.Update(stats.Resident)
+	processMetrics.Virtual.Update(stats.Virtual)
+}
+
+// Register metrics for the process's CPU time, in nanoseconds, memory, in
+// bytes, and open files or handles, named process.cpu.system,
+// process.cpu.user, process.handles, process.memory.resident, and
+// process.memory.virtual.  Reading them is timed by process.read.
+func RegisterProcessStats(r Registry) {
+	processMetrics.CPUSystem = NewGauge()
+	processMetrics.CPUUser = NewGauge()
+	processMetrics.Handles = NewGauge()
+	processMetrics.Resident = NewGauge()
+	processMetrics.Virtual = NewGauge()
+	processMetrics.ReadProcessStats = NewTimer()
+
+	r.Register("process.cpu.system", processMetrics.CPUSystem)
+	r.Register("process.cpu.user", processMetrics.CPUUser)
+	r.Register("process.handles", processMetrics.Handles)
+	r.Register("process.memory.resident", processMetrics.Resident)
+	r.Register("process.memory.virtual", processMetrics.Virtual)
+	r.Register("process.read", processMetrics.ReadProcessStats)
+}
@@ -0,0 +1,77 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package metrics
+
+/*
+#include <libproc.h>
+#include <mach/mach.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+// readTaskInfo reads the task's resident and virtual memory and the CPU time,
+// in microseconds, of its live and terminated threads.
+static int readTaskInfo(long long *resident, long long *virtual, long long *user, long long *system) {
+	struct mach_task_basic_info info;
+	mach_msg_type_number_t count = MACH_TASK_BASIC_INFO_COUNT;
+	if (KERN_SUCCESS != task_info(mach_task_self(), MACH_TASK_BASIC_INFO, (task_info_t)&info, &count)) {
+		return -1;
+	}
+	struct task_thread_times_info times;
+	count = TASK_THREAD_TIMES_INFO_COUNT;
+	if (KERN_SUCCESS != task_info(mach_task_self(), TASK_THREAD_TIMES_INFO, (task_info_t)&times, &count)) {
+		return -1;
+	}
+	*resident = info.resident_size;
+	*virtual = info.virtual_size;
+	*user = (info.user_time.seconds + times.user_time.seconds) * 1000000LL +
+		info.user_time.microseconds + times.user_time.microseconds;
+	*system = (info.system_time.seconds + times.system_time.seconds) * 1000000LL +
+		info.system_time.microseconds + times.system_time.microseconds;
+	return 0;
+}
+
+// countFDs counts the process's open file descriptors.
+static int countFDs(void) {
+	int size = proc_pidinfo(getpid(), PROC_PIDLISTFDS, 0, NULL, 0);
+	if (size <= 0) {
+		return -1;
+	}
+	struct proc_fdinfo *fds = malloc(size);
+	if (NULL == fds) {
+		return -1;
+	}
+	size = proc_pidinfo(getpid(), PROC_PIDLISTFDS, 0, fds, size);
+	free(fds);
+	if (size <= 0) {
+		return -1;
+	}
+	return size / PROC_PIDLISTFD_SIZE;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"time"
+)
+
+// readProcessStats calls task_info for the task's memory and CPU time and
+// proc_pidinfo for its file descriptors.
+func readProcessStats() (processStats, error) {
+	var stats processStats
+	var resident, virtual, user, system C.longlong
+	if 0 != C.readTaskInfo(&resident, &virtual, &user, &system) {
+		return stats, errors.New("metrics: task_info failed")
+	}
+	stats.CPUSystem = time.Duration(system) * time.Microsecond
+	stats.CPUUser = time.Duration(user) * time.Microsecond
+	stats.Resident = int64(resident)
+	stats.Virtual = int64(virtual)
+	n := C.countFDs()
+	if n < 0 {
+		return stats, errors.New("metrics: proc_pidinfo failed")
+	}
+	stats.Handles = int64(n)
+	return stats, nil
+}
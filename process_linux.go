@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// clockTicks is the unit of the CPU times in /proc/self/stat, USER_HZ, which
+// is 100 on every architecture Linux supports.
+const clockTicks = 100
+
+// readProcessStats reads /proc/self/stat and counts /proc/self/fd.
+func readProcessStats() (processStats, error) {
+	var stats processStats
+	b, err := os.ReadFile("/proc/self/stat")
+	if nil != err {
+		return stats, err
+	}
+
+	// The command name in parentheses may itself contain spaces and
+	// parentheses, so the fields are counted from the last ')'.  The first
+	// of them is the state, the third field of the line.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return stats, errors.New("metrics: malformed /proc/self/stat")
+	}
+	fields := bytes.Fields(b[i+1:])
+	if len(fields) < 22 {
+		return stats, errors.New("metrics: malformed /proc/self/stat")
+	}
+	field := func(n int) int64 { // n counts from 1, as in proc(5)
+		v, _ := strconv.ParseInt(string(fields[n-3]), 10, 64)
+		return v
+	}
+	stats.CPUUser = time.Duration(field(14)) * time.Second / clockTicks
+	stats.CPUSystem = time.Duration(field(15)) * time.Second / clockTicks
+	stats.Virtual = field(23)
+	stats.Resident = field(24) * int64(os.Getpagesize())
+
+	f, err := os.Open("/proc/self/fd")
+	if nil != err {
+		return stats, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if nil != err {
+		return stats, err
+	}
+	stats.Handles = int64(len(names)) - 1 // Less the one opened to count them.
+	return stats, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !windows && !(darwin && cgo)
+// +build !linux
+// +build !windows
+// +build !darwin !cgo
+
+package metrics
+
+func readProcessStats() (processStats, error) {
+	return processStats{}, errProcessStatsUnsupported
+}
@@ -0,0 +1,27 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestProcessStats(t *testing.T) {
+	if _, err := readProcessStats(); nil != err {
+		t.Skip(err)
+	}
+	r := NewRegistry()
+	RegisterProcessStats(r)
+	CaptureProcessStatsOnce(r)
+	for _, name := range []string{
+		"process.handles",
+		"process.memory.resident",
+		"process.memory.virtual",
+	} {
+		if value := r.Get(name).(Gauge).Value(); value <= 0 {
+			t.Errorf("%s.Value(): %v <= 0\n", name, value)
+		}
+	}
+	if count := r.Get("process.read").(Timer).Count(); 1 != count {
+		t.Errorf("process.read.Count(): 1 != %v\n", count)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	procGetProcessHandleCount = syscall.NewLazyDLL("kernel32.dll").NewProc("GetProcessHandleCount")
+	procGetProcessMemoryInfo  = syscall.NewLazyDLL("psapi.dll").NewProc("GetProcessMemoryInfo")
+)
+
+// processMemoryCounters is the Win32 PROCESS_MEMORY_COUNTERS structure.
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// readProcessStats calls GetProcessTimes, GetProcessMemoryInfo, and
+// GetProcessHandleCount for the current process.
+func readProcessStats() (processStats, error) {
+	var stats processStats
+	h, err := syscall.GetCurrentProcess()
+	if nil != err {
+		return stats, err
+	}
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); nil != err {
+		return stats, err
+	}
+	stats.CPUSystem = filetimeDuration(kernel)
+	stats.CPUUser = filetimeDuration(user)
+
+	var counters processMemoryCounters
+	counters.cb = uint32(unsafe.Sizeof(counters))
+	if r, _, err := procGetProcessMemoryInfo.Call(
+		uintptr(h),
+		uintptr(unsafe.Pointer(&counters)),
+		uintptr(counters.cb),
+	); 0 == r {
+		return stats, err
+	}
+	stats.Resident = int64(counters.WorkingSetSize)
+	stats.Virtual = int64(counters.PagefileUsage)
+
+	var handles uint32
+	if r, _, err := procGetProcessHandleCount.Call(
+		uintptr(h),
+		uintptr(unsafe.Pointer(&handles)),
+	); 0 == r {
+		return stats, err
+	}
+	stats.Handles = int64(handles)
+	return stats, nil
+}
+
+// filetimeDuration converts a FILETIME holding a duration, as
+// GetProcessTimes's kernel and user times do, from 100-nanosecond units.
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,248 @@
+// Package promclient bridges a go-metrics Registry and the Prometheus
+// client library in both directions, so that a codebase instrumented with
+// both can serve one /metrics endpoint or export everything through one set
+// of go-metrics reporters.
+package promclient
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rcrowley/go-metrics"
+)
+
+// A Collector is a prometheus.Collector which collects every metric in a
+// Registry.  Names are sanitized by metrics.PrometheusName and prefixed with
+// a namespace, and the tags of names made by metrics.TaggedName become
+// labels.  Counters, gauges, and GaugeFloat64s become gauges, since a
+// go-metrics Counter may be decremented; CounterFloat64s and meters become
+// counters of their count; and histograms, duration histograms, timers,
+// staged timers, and summaries become summaries, with durations in seconds
+// and a stage label for each stage of a staged timer.  Histogram2Ds and
+// healthchecks are skipped.
+//
+// Describe describes nothing, so a Collector is unchecked and its metrics
+// may come and go as they're registered and unregistered.
+type Collector struct {
+	namespace string
+	registry  metrics.Registry
+}
+
+// NewCollector constructs a new Collector of the metrics in the given
+// registry, which is DefaultRegistry if nil.
+func NewCollector(r metrics.Registry, namespace string) *Collector {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return &Collector{namespace: namespace, registry: r}
+}
+
+// NewGatherer returns a prometheus.Gatherer of the metrics in the given
+// registry.  Combine it with another Gatherer to serve both from a single
+// endpoint:
+//
+//	g := prometheus.Gatherers{prometheus.DefaultGatherer, promclient.NewGatherer(nil, "app")}
+//	http.Handle("/metrics", promhttp.HandlerFor(g, promhttp.HandlerOpts{}))
+func NewGatherer(r metrics.Registry, namespace string) prometheus.Gatherer {
+	g := prometheus.NewRegistry()
+	g.MustRegister(NewCollector(r, namespace))
+	return g
+}
+
+// Describe describes nothing, which makes the Collector unchecked.
+func (c *Collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect sends a snapshot of every metric in the registry.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.registry.Each(func(name string, i interface{}) {
+		family, tags := metrics.SplitTaggedName(name)
+		fqName := metrics.PrometheusName(family)
+		if "" != c.namespace {
+			fqName = metrics.PrometheusName(c.namespace) + "_" + fqName
+		}
+		desc := func(tags map[string]string) *prometheus.Desc {
+			labels := make(prometheus.Labels, len(tags))
+			for k, v := range tags {
+				labels[metrics.PrometheusName(k)] = v
+			}
+			return prometheus.NewDesc(fqName, family, nil, labels)
+		}
+		value := func(t prometheus.ValueType, v float64) {
+			d := desc(tags)
+			m, err := prometheus.NewConstMetric(d, t, v)
+			if nil != err {
+				m = prometheus.NewInvalidMetric(d, err)
+			}
+			ch <- m
+		}
+		summary := func(tags map[string]string, count int64, sum float64, qs []float64, vs []float64) {
+			d := desc(tags)
+			values := make(map[float64]float64, len(qs))
+			for i, q := range qs {
+				values[q] = vs[i]
+			}
+			m, err := prometheus.NewConstSummary(d, uint64(count), sum, values)
+			if nil != err {
+				m = prometheus.NewInvalidMetric(d, err)
+			}
+			ch <- m
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			value(prometheus.GaugeValue, float64(metric.Count()))
+		case metrics.CounterFloat64:
+			value(prometheus.CounterValue, metric.Snapshot().Count())
+		case metrics.Gauge:
+			value(prometheus.GaugeValue, float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			value(prometheus.GaugeValue, metric.Value())
+		case metrics.Meter:
+			value(prometheus.CounterValue, float64(metric.Count()))
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			quantiles := metrics.ExportedPercentiles(c.registry, i)
+			summary(tags, h.Count(), float64(h.Sum()), quantiles, h.Percentiles(quantiles))
+		case metrics.DurationHistogram:
+			h := metric.Snapshot()
+			quantiles := metrics.ExportedPercentiles(c.registry, i)
+			summary(tags, h.Count(), h.Sum().Seconds(), quantiles, seconds(h.Percentiles(quantiles)))
+		case metrics.StagedTimer:
+			t := metric.Snapshot()
+			for _, stage := range append(t.Stages(), metrics.TotalStage) {
+				h := t.Stage(stage)
+				quantiles := metrics.ExportedPercentiles(c.registry, h)
+				summary(withTag(tags, "stage", stage), h.Count(), h.Sum().Seconds(), quantiles, seconds(h.Percentiles(quantiles)))
+			}
+		case metrics.Summary:
+			s := metric.Snapshot()
+			summary(tags, s.Count(), s.Sum(), s.Objectives(), s.Quantiles())
+		case metrics.Timer:
+			t := metric.Snapshot()
+			quantiles := metrics.ExportedPercentiles(c.registry, i)
+			ps := t.Percentiles(quantiles)
+			for i := range ps {
+				ps[i] /= float64(time.Second)
+			}
+			summary(tags, t.Count(), float64(t.Sum())/float64(time.Second), quantiles, ps)
+		}
+	})
+}
+
+func seconds(ds []time.Duration) []float64 {
+	fs := make([]float64, len(ds))
+	for i, d := range ds {
+		fs[i] = d.Seconds()
+	}
+	return fs
+}
+
+// An Importer copies the metrics gathered from a prometheus.Gatherer, such
+// as a prometheus.Registry, into a Registry so that they're exported by the
+// same reporters as everything else.  Each metric's name is its family's
+// name with a prefix and its labels become tags as by metrics.TaggedName.
+// Counters, gauges, and untyped metrics become GaugeFloat64s.  Summaries and
+// histograms become a Gauge of their count suffixed ".count", a GaugeFloat64
+// of their sum suffixed ".sum", and a GaugeFloat64 for each quantile tagged
+// quantile or a Gauge of each bucket's cumulative count suffixed ".bucket"
+// and tagged le, as Prometheus itself would expose them.
+type Importer struct {
+	gatherer prometheus.Gatherer
+	prefix   string
+	registry metrics.Registry
+}
+
+// NewImporter constructs a new Importer from the given gatherer, which is
+// prometheus.DefaultGatherer if nil, into the given registry, which is
+// DefaultRegistry if nil.
+func NewImporter(g prometheus.Gatherer, r metrics.Registry, prefix string) *Importer {
+	if nil == g {
+		g = prometheus.DefaultGatherer
+	}
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return &Importer{gatherer: g, prefix: prefix, registry: r}
+}
+
+// Capture gathers and updates the registry periodically.  This is designed
+// to be called as a goroutine.
+func (im *Importer) Capture(d time.Duration) {
+	for _ = range time.Tick(d) {
+		if err := im.CaptureOnce(); nil != err {
+			log.Println(err)
+		}
+	}
+}
+
+// CaptureOnce gathers and updates the registry.  Gathering may fail for
+// some metrics and succeed for others, in which case those gathered are
+// copied and the error is returned.
+func (im *Importer) CaptureOnce() error {
+	families, err := im.gatherer.Gather()
+	for _, mf := range families {
+		name := im.prefix + mf.GetName()
+		for _, m := range mf.GetMetric() {
+			tags := make(map[string]string, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				tags[l.GetName()] = l.GetValue()
+			}
+			im.update(name, tags, mf.GetType(), m)
+		}
+	}
+	return err
+}
+
+func (im *Importer) update(name string, tags map[string]string, t dto.MetricType, m *dto.Metric) {
+	gauge := func(name string, v float64) {
+		metrics.GetOrRegisterGaugeFloat64(metrics.TaggedName(name, tags), im.registry).Update(v)
+	}
+	switch t {
+	case dto.MetricType_COUNTER:
+		gauge(name, m.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		gauge(name, m.GetGauge().GetValue())
+	case dto.MetricType_UNTYPED:
+		gauge(name, m.GetUntyped().GetValue())
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		metrics.GetOrRegisterGauge(metrics.TaggedName(name+".count", tags), im.registry).Update(int64(s.GetSampleCount()))
+		gauge(name+".sum", s.GetSampleSum())
+		for _, q := range s.GetQuantile() {
+			metrics.GetOrRegisterGaugeFloat64(
+				metrics.TaggedName(name, withTag(tags, "quantile", formatFloat(q.GetQuantile()))),
+				im.registry,
+			).Update(q.GetValue())
+		}
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		metrics.GetOrRegisterGauge(metrics.TaggedName(name+".count", tags), im.registry).Update(int64(h.GetSampleCount()))
+		gauge(name+".sum", h.GetSampleSum())
+		for _, b := range h.GetBucket() {
+			metrics.GetOrRegisterGauge(
+				metrics.TaggedName(name+".bucket", withTag(tags, "le", formatFloat(b.GetUpperBound()))),
+				im.registry,
+			).Update(int64(b.GetCumulativeCount()))
+		}
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// withTag returns a copy of tags with one more.
+func withTag(tags map[string]string, k, v string) map[string]string {
+	c := make(map[string]string, len(tags)+1)
+	for tk, tv := range tags {
+		c[tk] = tv
+	}
+	c[k] = v
+	return c
+}
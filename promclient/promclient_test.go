@@ -0,0 +1,89 @@
+package promclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestGatherer(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"code": "200"}), r).Inc(3)
+	metrics.GetOrRegisterTimer("latency", r).Update(time.Second)
+	metrics.GetOrRegisterCounterFloat64("cpu", r).Inc(1.5)
+	families, err := NewGatherer(r, "app").Gather()
+	if nil != err {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+
+	mf := byName["app_requests"]
+	if nil == mf || dto.MetricType_GAUGE != mf.GetType() || 1 != len(mf.GetMetric()) {
+		t.Fatalf("app_requests: %v\n", mf)
+	}
+	m := mf.GetMetric()[0]
+	if 3 != m.GetGauge().GetValue() {
+		t.Errorf("app_requests: %v != 3\n", m.GetGauge().GetValue())
+	}
+	if l := m.GetLabel(); 1 != len(l) || "code" != l[0].GetName() || "200" != l[0].GetValue() {
+		t.Errorf("app_requests labels: %v\n", l)
+	}
+
+	mf = byName["app_cpu"]
+	if nil == mf || dto.MetricType_COUNTER != mf.GetType() || 1 != len(mf.GetMetric()) {
+		t.Fatalf("app_cpu: %v\n", mf)
+	}
+	if v := mf.GetMetric()[0].GetCounter().GetValue(); 1.5 != v {
+		t.Errorf("app_cpu: %v != 1.5\n", v)
+	}
+
+	mf = byName["app_latency"]
+	if nil == mf || dto.MetricType_SUMMARY != mf.GetType() || 1 != len(mf.GetMetric()) {
+		t.Fatalf("app_latency: %v\n", mf)
+	}
+	if s := mf.GetMetric()[0].GetSummary(); 1 != s.GetSampleCount() || 1 != s.GetSampleSum() {
+		t.Errorf("app_latency: count %d, sum %v\n", s.GetSampleCount(), s.GetSampleSum())
+	}
+}
+
+func TestImporter(t *testing.T) {
+	g := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "requests_total",
+		Help: "Requests served.",
+	}, []string{"code"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "latency_seconds",
+		Help:    "Request latency.",
+		Buckets: []float64{1},
+	})
+	g.MustRegister(requests, latency)
+	requests.WithLabelValues("200").Add(3)
+	latency.Observe(0.5)
+	latency.Observe(2)
+
+	r := metrics.NewRegistry()
+	if err := NewImporter(g, r, "prom.").CaptureOnce(); nil != err {
+		t.Fatal(err)
+	}
+	name := metrics.TaggedName("prom.requests_total", map[string]string{"code": "200"})
+	if c, ok := r.Get(name).(metrics.GaugeFloat64); !ok || 3 != c.Value() {
+		t.Errorf("%s: %v\n", name, r.Get(name))
+	}
+	if c, ok := r.Get("prom.latency_seconds.count").(metrics.Gauge); !ok || 2 != c.Value() {
+		t.Errorf("prom.latency_seconds.count: %v\n", r.Get("prom.latency_seconds.count"))
+	}
+	if s, ok := r.Get("prom.latency_seconds.sum").(metrics.GaugeFloat64); !ok || 2.5 != s.Value() {
+		t.Errorf("prom.latency_seconds.sum: %v\n", r.Get("prom.latency_seconds.sum"))
+	}
+	name = metrics.TaggedName("prom.latency_seconds.bucket", map[string]string{"le": "1"})
+	if b, ok := r.Get(name).(metrics.Gauge); !ok || 1 != b.Value() {
+		t.Errorf("%s: %v\n", name, r.Get(name))
+	}
+}
@@ -0,0 +1,241 @@
+// Package prometheus serves a Registry in the Prometheus text exposition
+// format without depending on the Prometheus client library, so that a
+// Prometheus server may scrape a service directly.  Use the promclient
+// package instead to serve a Registry alongside metrics registered with the
+// client library.
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns an http.Handler which responds to every request with the
+// metrics in the given registry, which is DefaultRegistry if nil, as by
+// WriteTo.
+//
+//	http.Handle("/metrics", prometheus.Handler(nil, "app"))
+func Handler(r metrics.Registry, namespace string) http.Handler {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		WriteTo(w, r, namespace)
+	})
+}
+
+// WriteTo writes the metrics in the given registry in the text exposition
+// format.  Names are sanitized by metrics.PrometheusName and prefixed with a
+// namespace, and the tags of names made by metrics.TaggedName become
+// labels.  Counters, CounterFloat64s, gauges, and GaugeFloat64s become
+// gauges, since a go-metrics Counter may be decremented; meters become counters of their
+// count and gauges of their rates suffixed "_rate1", "_rate5", "_rate15",
+// and "_rate_mean"; histograms, duration histograms, staged timers, and
+// summaries become summaries of their exported percentiles, with durations
+// in seconds and a stage label for each stage of a staged timer; and timers
+// become both a summary and a meter's rates.  Histogram2Ds and healthchecks
+// are skipped.
+func WriteTo(w io.Writer, r metrics.Registry, namespace string) error {
+	e := exposition{families: make(map[string]*family)}
+	r.Each(func(name string, i interface{}) {
+		e.add(r, namespace, name, i)
+	})
+	return e.write(w)
+}
+
+// exposition gathers the samples of each family, since the members of a
+// tagged family needn't be adjacent in the order of their names and the
+// format requires that a family's samples be written together.
+type exposition struct {
+	families map[string]*family
+}
+
+type family struct {
+	help, typ string
+	samples   []string
+}
+
+func (e *exposition) add(r metrics.Registry, namespace, name string, i interface{}) {
+	base, tags := metrics.SplitTaggedName(name)
+	fqName := metrics.PrometheusName(base)
+	if "" != namespace {
+		fqName = metrics.PrometheusName(namespace) + "_" + fqName
+	}
+	labels := make(map[string]string, len(tags))
+	for k, v := range tags {
+		labels[metrics.PrometheusName(k)] = v
+	}
+	value := func(suffix, typ string, v float64) {
+		e.family(fqName+suffix, typ, base).sample(fqName+suffix, labels, "", v)
+	}
+	rates := func(m interface {
+		Rate1() float64
+		Rate5() float64
+		Rate15() float64
+		RateMean() float64
+	}) {
+		value("_rate1", "gauge", m.Rate1())
+		value("_rate5", "gauge", m.Rate5())
+		value("_rate15", "gauge", m.Rate15())
+		value("_rate_mean", "gauge", m.RateMean())
+	}
+	summary := func(labels map[string]string, count int64, sum float64, qs, vs []float64) {
+		f := e.family(fqName, "summary", base)
+		for j, q := range qs {
+			f.sample(fqName, labels, strconv.FormatFloat(q, 'g', -1, 64), vs[j])
+		}
+		f.sample(fqName+"_sum", labels, "", sum)
+		f.sample(fqName+"_count", labels, "", float64(count))
+	}
+	switch metric := i.(type) {
+	case metrics.Counter:
+		value("", "gauge", float64(metric.Count()))
+	case metrics.CounterFloat64:
+		value("", "gauge", metric.Count())
+	case metrics.Gauge:
+		value("", "gauge", float64(metric.Value()))
+	case metrics.GaugeFloat64:
+		value("", "gauge", metric.Value())
+	case metrics.Meter:
+		m := metric.Snapshot()
+		value("", "counter", float64(m.Count()))
+		rates(m)
+	case metrics.Histogram:
+		h := metric.Snapshot()
+		quantiles := metrics.ExportedPercentiles(r, i)
+		summary(labels, h.Count(), float64(h.Sum()), quantiles, h.Percentiles(quantiles))
+	case metrics.DurationHistogram:
+		h := metric.Snapshot()
+		quantiles := metrics.ExportedPercentiles(r, i)
+		summary(labels, h.Count(), h.Sum().Seconds(), quantiles, seconds(h.Percentiles(quantiles)))
+	case metrics.StagedTimer:
+		t := metric.Snapshot()
+		for _, stage := range append(t.Stages(), metrics.TotalStage) {
+			h := t.Stage(stage)
+			quantiles := metrics.ExportedPercentiles(r, h)
+			summary(withLabel(labels, "stage", stage), h.Count(), h.Sum().Seconds(), quantiles, seconds(h.Percentiles(quantiles)))
+		}
+	case metrics.Summary:
+		s := metric.Snapshot()
+		summary(labels, s.Count(), s.Sum(), s.Objectives(), s.Quantiles())
+	case metrics.Timer:
+		t := metric.Snapshot()
+		quantiles := metrics.ExportedPercentiles(r, i)
+		ps := t.Percentiles(quantiles)
+		for j := range ps {
+			ps[j] /= float64(time.Second)
+		}
+		summary(labels, t.Count(), float64(t.Sum())/float64(time.Second), quantiles, ps)
+		rates(t)
+	}
+}
+
+// family returns the named family, adding it if it's new.  A family's type
+// is that of its first member.
+func (e *exposition) family(name, typ, help string) *family {
+	f, ok := e.families[name]
+	if !ok {
+		f = &family{help: help, typ: typ}
+		e.families[name] = f
+	}
+	return f
+}
+
+func (e *exposition) write(w io.Writer) error {
+	names := make([]string, 0, len(e.families))
+	for name := range e.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := e.families[name]
+		bw.WriteString("# HELP " + name + " " + escapeHelp(f.help) + "\n")
+		bw.WriteString("# TYPE " + name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			bw.WriteString(s)
+		}
+	}
+	return bw.Flush()
+}
+
+// sample adds a line with the given name, labels, quantile label if it's
+// not empty, and value.
+func (f *family) sample(name string, labels map[string]string, quantile string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if "" != quantile {
+		keys = append(keys, "quantile")
+	}
+	for j, k := range keys {
+		if 0 == j {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		l := labels[k]
+		if "quantile" == k && "" != quantile {
+			l = quantile
+		}
+		b.WriteString(k + `="` + escapeLabel(l) + `"`)
+	}
+	if 0 < len(keys) {
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + formatFloat(v) + "\n")
+	f.samples = append(f.samples, b.String())
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func seconds(ds []time.Duration) []float64 {
+	fs := make([]float64, len(ds))
+	for i, d := range ds {
+		fs[i] = d.Seconds()
+	}
+	return fs
+}
+
+func withLabel(labels map[string]string, k, v string) map[string]string {
+	with := make(map[string]string, len(labels)+1)
+	for lk, lv := range labels {
+		with[lk] = lv
+	}
+	with[k] = v
+	return with
+}
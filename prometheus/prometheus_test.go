@@ -0,0 +1,62 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"colo": "SJC"}), r).Inc(2)
+	metrics.GetOrRegisterGauge("inflight", r).Update(3)
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"colo": "LAX"}), r).Inc(1)
+	metrics.GetOrRegisterCounter("requests.errors", r).Inc(1)
+	metrics.GetOrRegisterCounterFloat64("cpu", r).Inc(1.5)
+	w := httptest.NewRecorder()
+	Handler(r, "app").ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ContentType != ct {
+		t.Errorf("Content-Type: %q != %q\n", ContentType, ct)
+	}
+	expected := `# HELP app_cpu cpu
+# TYPE app_cpu gauge
+app_cpu 1.5
+# HELP app_inflight inflight
+# TYPE app_inflight gauge
+app_inflight 3
+# HELP app_requests requests
+# TYPE app_requests gauge
+app_requests{colo="LAX"} 1
+app_requests{colo="SJC"} 2
+# HELP app_requests_errors requests.errors
+# TYPE app_requests_errors gauge
+app_requests_errors 1
+`
+	if body := w.Body.String(); expected != body {
+		t.Errorf("body:\n%s\n!=\n%s\n", expected, body)
+	}
+}
+
+func TestWriteToTimer(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterTimer(metrics.TaggedName("latency", map[string]string{"path": `/a"b`}), r).Update(2 * time.Second)
+	var b bytes.Buffer
+	if err := WriteTo(&b, r, ""); nil != err {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE latency summary\n",
+		`latency{path="/a\"b",quantile="0.5"} 2` + "\n",
+		`latency_sum{path="/a\"b"} 2` + "\n",
+		`latency_count{path="/a\"b"} 1` + "\n",
+		"# TYPE latency_rate1 gauge\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("expected %q in:\n%s\n", line, b.String())
+		}
+	}
+}
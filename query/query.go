@@ -0,0 +1,353 @@
+// Package query evaluates simple expressions against the live metrics in a
+// registry so that operators can ask ad-hoc questions of a running process,
+// such as the total request rate across every handler or the five slowest
+// endpoints, without exporting everything to a time-series database first.
+//
+// A selector is a pattern of metric names followed by a dot and the name of
+// a field, as named by metrics.MetricField.  In the pattern * matches any
+// run of characters, dots included, and ? matches any one character:
+//
+//	http.*.requests.rate1
+//	db.query.p99
+//
+// Selectors may be wrapped in functions which aggregate or rank the series
+// they select:
+//
+//	sum(http.*.requests.rate1)
+//	topk(5, *.p99)
+//	max(bottomk(3, pool.*.idle.value))
+//
+// The functions are sum, avg, min, max, and count, which return a single
+// series named after the expression, and topk and bottomk, which return the
+// k series with the greatest or least values.
+//
+// Handler serves the results as JSON:
+//
+//	http.Handle("/debug/metrics/query", query.Handler(metrics.DefaultRegistry))
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Series is one named value in the result of an expression.
+type Series struct {
+	Name  string `json:"name"`
+	Value Value  `json:"value"`
+}
+
+// Value is a float64 which marshals NaN and ±Inf, which JSON cannot
+// represent, as the strings "NaN", "+Inf", and "-Inf".
+type Value float64
+
+// MarshalJSON returns the JSON encoding of the value.
+func (v Value) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(f, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(f, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return json.Marshal(f)
+}
+
+// An Expr is a parsed expression.
+type Expr interface {
+	// Eval evaluates the expression against the metrics in a registry,
+	// returning its series sorted by name unless they've been ranked.
+	Eval(metrics.Registry) []Series
+
+	String() string
+}
+
+// Eval parses and evaluates an expression against the metrics in r.
+func Eval(r metrics.Registry, s string) ([]Series, error) {
+	e, err := Parse(s)
+	if nil != err {
+		return nil, err
+	}
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return e.Eval(r), nil
+}
+
+// Handler returns an http.Handler which evaluates the expression in its q
+// query parameter against the metrics in r and responds with the resulting
+// series as a JSON array of {"name": ..., "value": ...} objects.
+func Handler(r metrics.Registry) http.Handler {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		e, err := Parse(req.FormValue("q"))
+		if nil != err {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		series := e.Eval(r)
+		if nil == series {
+			series = []Series{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+	})
+}
+
+// Parse parses an expression.
+func Parse(s string) (Expr, error) {
+	p := &parser{s: s}
+	e, err := p.expr()
+	if nil != err {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return e, nil
+}
+
+// aggregations reduce a set of series to one value.  They are never given
+// an empty set.
+var aggregations = map[string]func([]Series) float64{
+	"avg": func(series []Series) float64 {
+		return sum(series) / float64(len(series))
+	},
+	"count": func(series []Series) float64 {
+		return float64(len(series))
+	},
+	"max": func(series []Series) float64 {
+		v := series[0].Value
+		for _, s := range series[1:] {
+			if s.Value > v {
+				v = s.Value
+			}
+		}
+		return float64(v)
+	},
+	"min": func(series []Series) float64 {
+		v := series[0].Value
+		for _, s := range series[1:] {
+			if s.Value < v {
+				v = s.Value
+			}
+		}
+		return float64(v)
+	},
+	"sum": sum,
+}
+
+func sum(series []Series) float64 {
+	var v float64
+	for _, s := range series {
+		v += float64(s.Value)
+	}
+	return v
+}
+
+type aggregation struct {
+	f    string
+	expr Expr
+}
+
+func (a *aggregation) Eval(r metrics.Registry) []Series {
+	series := a.expr.Eval(r)
+	if 0 == len(series) && "count" != a.f {
+		return nil
+	}
+	return []Series{{Name: a.String(), Value: Value(aggregations[a.f](series))}}
+}
+
+func (a *aggregation) String() string {
+	return fmt.Sprintf("%s(%v)", a.f, a.expr)
+}
+
+type rank struct {
+	f    string
+	k    int
+	expr Expr
+}
+
+// Eval returns the k series with the greatest values for topk or the least
+// for bottomk, in that order, ignoring NaN values.
+func (rk *rank) Eval(r metrics.Registry) []Series {
+	var series []Series
+	for _, s := range rk.expr.Eval(r) {
+		if !math.IsNaN(float64(s.Value)) {
+			series = append(series, s)
+		}
+	}
+	if "topk" == rk.f {
+		sort.Stable(sort.Reverse(byValue(series)))
+	} else {
+		sort.Stable(byValue(series))
+	}
+	if rk.k < len(series) {
+		series = series[:rk.k]
+	}
+	return series
+}
+
+func (rk *rank) String() string {
+	return fmt.Sprintf("%s(%d, %v)", rk.f, rk.k, rk.expr)
+}
+
+type selector struct {
+	pattern, field string
+}
+
+func (s *selector) Eval(r metrics.Registry) []Series {
+	var series []Series
+	r.Each(func(name string, i interface{}) {
+		if !match(s.pattern, name) {
+			return
+		}
+		if v, ok := metrics.MetricField(i, s.field); ok {
+			series = append(series, Series{Name: name + "." + s.field, Value: Value(v)})
+		}
+	})
+	sort.Sort(byName(series))
+	return series
+}
+
+func (s *selector) String() string {
+	return s.pattern + "." + s.field
+}
+
+// match reports whether name matches a pattern in which * matches any run of
+// characters and ? matches any one character.  Only the most recent * is
+// backtracked to, since a later * can match anything an earlier one could,
+// so matching takes time linear in the lengths of pattern and name.
+func match(pattern, name string) bool {
+	var p, n int
+	star, next := -1, 0 // Index of the last * seen and of the name after it
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && '*' == pattern[p]:
+			star, next = p, n
+			p++
+		case p < len(pattern) && ('?' == pattern[p] || pattern[p] == name[n]):
+			p++
+			n++
+		case 0 <= star:
+			p, next = star+1, next+1
+			n = next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && '*' == pattern[p] {
+		p++
+	}
+	return len(pattern) == p
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("query: %s at offset %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+// expr parses a selector or a function of an expression.
+func (p *parser) expr() (Expr, error) {
+	p.skipSpace()
+	start := p.pos
+	word := p.word()
+	if "" == word {
+		if p.pos < len(p.s) {
+			return nil, p.errorf("unexpected %q", p.s[p.pos:])
+		}
+		return nil, p.errorf("expected an expression")
+	}
+	if p.skipSpace(); !p.consume('(') {
+		i := strings.LastIndex(word, ".")
+		if i <= 0 || len(word)-1 == i {
+			p.pos = start
+			return nil, p.errorf("expected a selector of the form pattern.field, found %q", word)
+		}
+		return &selector{pattern: word[:i], field: word[i+1:]}, nil
+	}
+	var e Expr
+	switch word {
+	case "topk", "bottomk":
+		p.skipSpace()
+		digits := p.word()
+		k, err := strconv.Atoi(digits)
+		if nil != err || k < 1 {
+			return nil, p.errorf("expected a positive number of series, found %q", digits)
+		}
+		if p.skipSpace(); !p.consume(',') {
+			return nil, p.errorf("expected ','")
+		}
+		inner, err := p.expr()
+		if nil != err {
+			return nil, err
+		}
+		e = &rank{f: word, k: k, expr: inner}
+	default:
+		if _, ok := aggregations[word]; !ok {
+			p.pos = start
+			return nil, p.errorf("unknown function %q", word)
+		}
+		inner, err := p.expr()
+		if nil != err {
+			return nil, err
+		}
+		e = &aggregation{f: word, expr: inner}
+	}
+	if p.skipSpace(); !p.consume(')') {
+		return nil, p.errorf("expected ')'")
+	}
+	return e, nil
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.pos < len(p.s) && c == p.s[p.pos] {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// word parses a run of characters which may appear in a selector or the
+// name of a function.
+func (p *parser) word() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("(), \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+type byName []Series
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type byValue []Series
+
+func (s byValue) Len() int           { return len(s) }
+func (s byValue) Less(i, j int) bool { return s[i].Value < s[j].Value }
+func (s byValue) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,125 @@
+package query
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func newTestRegistry() metrics.Registry {
+	r := metrics.NewRegistry()
+	for i, handler := range []string{"index", "login", "search"} {
+		metrics.NewRegisteredCounter("http."+handler+".requests", r).Inc(int64(i + 1))
+		h := metrics.NewRegisteredHistogram("http."+handler+".latency", r, metrics.NewUniformSample(100))
+		h.Update(int64(10 * (i + 1)))
+	}
+	metrics.NewRegisteredGaugeFloat64("load", r).Update(math.NaN())
+	return r
+}
+
+func TestEval(t *testing.T) {
+	r := newTestRegistry()
+	for s, expected := range map[string][]Series{
+		"sum(http.*.requests.count)": {{"sum(http.*.requests.count)", 6}},
+		"count(http.*.p99)":          {{"count(http.*.p99)", 3}},
+		"max( http.*.latency.max )":  {{"max(http.*.latency.max)", 30}},
+		"topk(2, *.p99)": {
+			{"http.search.latency.p99", 30},
+			{"http.login.latency.p99", 20},
+		},
+		"bottomk(1, http.?????.requests.count)": {{"http.index.requests.count", 1}},
+		"http.login.requests.count":             {{"http.login.requests.count", 2}},
+		"sum(nothing.count)":                    nil,
+	} {
+		series, err := Eval(r, s)
+		if nil != err {
+			t.Errorf("Eval(%q): %v\n", s, err)
+			continue
+		}
+		if len(expected) != len(series) {
+			t.Errorf("Eval(%q): %v != %v\n", s, expected, series)
+			continue
+		}
+		for i := range series {
+			if expected[i] != series[i] {
+				t.Errorf("Eval(%q): %v != %v\n", s, expected, series)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"requests",
+		"median(*.p50)",
+		"topk(0, *.p99)",
+		"topk(5 *.p99)",
+		"sum(*.count",
+		"sum(*.count))",
+	} {
+		if _, err := Parse(s); nil == err {
+			t.Errorf("Parse(%q): expected an error\n", s)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler(newTestRegistry())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/?q="+url.QueryEscape("*.value"), nil))
+	var series []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &series); nil != err {
+		t.Fatal(err, w.Body.String())
+	}
+	if 1 != len(series) || "load.value" != series[0]["name"] || "NaN" != series[0]["value"] {
+		t.Errorf("series: %v\n", series)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/?q=sum(", nil))
+	if http.StatusBadRequest != w.Code {
+		t.Errorf("w.Code: %v != %v\n", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, name string
+		matched       bool
+	}{
+		{"http.*.count", "http.index.count", true},
+		{"http.*.count", "http.index.p99", false},
+		{"*", "", true},
+		{"?", "", false},
+		{"a*b*c", "abxbxc", true},
+		{"a*b*c", "abxbxcx", false},
+		{"*.p99", "http.search.latency.p99", true},
+		{"**a", "bba", true},
+	} {
+		if matched := match(c.pattern, c.name); c.matched != matched {
+			t.Errorf("match(%q, %q): %v != %v\n", c.pattern, c.name, c.matched, matched)
+		}
+	}
+}
+
+func TestMatchPathological(t *testing.T) {
+	pattern := strings.Repeat("*a", 6) + "*b"
+	name := strings.Repeat("a", 60)
+	done := make(chan bool)
+	go func() { done <- match(pattern, name) }()
+	select {
+	case matched := <-done:
+		if matched {
+			t.Errorf("match(%q, %q): true != false\n", pattern, name)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("match(%q, %q) took more than a second\n", pattern, name)
+	}
+}
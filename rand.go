@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// randSeed is advanced by every Rand newRand constructs so that no two share
+// a sequence.
+var randSeed = uint64(time.Now().UnixNano())
+
+// XorShiftRand is a Rand implementing Vigna's xorshift64* generator.  It is
+// far cheaper than math/rand's shared source, which serializes every caller
+// behind a lock, and small enough that every sample can have one of its
+// own.  Like *rand.Rand it is not safe for concurrent use.
+//
+// <http://vigna.di.unimi.it/ftp/papers/xorshift.pdf>
+type XorShiftRand struct {
+	state uint64
+}
+
+// NewXorShiftRand constructs a new XorShiftRand with the given seed.
+func NewXorShiftRand(seed int64) *XorShiftRand {
+	r := &XorShiftRand{}
+	r.Seed(seed)
+	return r
+}
+
+// newRand constructs a new XorShiftRand seeded differently from every other
+// it has constructed.
+func newRand() Rand {
+	return NewXorShiftRand(int64(atomic.AddUint64(&randSeed, 0x9e3779b97f4a7c15)))
+}
+
+// Float64 returns a pseudo-random number in [0.0, 1.0).
+func (r *XorShiftRand) Float64() float64 {
+	return float64(r.Uint64()>>11) / (1 << 53)
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer.
+func (r *XorShiftRand) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+// Int63n returns a non-negative pseudo-random number in [0, n).  It panics
+// if n <= 0.
+func (r *XorShiftRand) Int63n(n int64) int64 {
+	if n <= 0 {
+		panic("invalid argument to Int63n")
+	}
+	max := int64((1 << 63) - 1 - (1<<63)%uint64(n))
+	v := r.Int63()
+	for v > max {
+		v = r.Int63()
+	}
+	return v % n
+}
+
+// Intn returns a non-negative pseudo-random number in [0, n).  It panics if
+// n <= 0.
+func (r *XorShiftRand) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+	return int(r.Int63n(int64(n)))
+}
+
+// Seed resets the generator to the sequence determined by the given seed.
+// Seeds are scrambled with SplitMix64 so that similar seeds, such as
+// consecutive integers, begin dissimilar sequences.
+func (r *XorShiftRand) Seed(seed int64) {
+	z := uint64(seed) + 0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	if 0 == z {
+		z = 1
+	}
+	r.state = z
+}
+
+// Uint64 returns a pseudo-random 64-bit integer.
+func (r *XorShiftRand) Uint64() uint64 {
+	x := r.state
+	x ^= x >> 12
+	x ^= x << 25
+	x ^= x >> 27
+	r.state = x
+	return x * 0x2545f4914f6cdd1d
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func BenchmarkXorShiftRand(b *testing.B) {
+	r := NewXorShiftRand(1)
+	for i := 0; i < b.N; i++ {
+		r.Int63n(1028)
+	}
+}
+
+func BenchmarkGlobalRand(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		rand.Int63n(1028)
+	}
+}
+
+func BenchmarkUniformSampleParallel(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		s := NewUniformSample(1028)
+		for pb.Next() {
+			s.Update(1)
+		}
+	})
+}
+
+func BenchmarkExpDecaySampleParallel(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		s := NewExpDecaySample(1028, 0.015)
+		for pb.Next() {
+			s.Update(1)
+		}
+	})
+}
+
+func TestXorShiftRandSeed(t *testing.T) {
+	r1, r2 := NewXorShiftRand(47), NewXorShiftRand(47)
+	for i := 0; i < 100; i++ {
+		if v1, v2 := r1.Uint64(), r2.Uint64(); v1 != v2 {
+			t.Fatalf("r1.Uint64(): %v != r2.Uint64(): %v\n", v1, v2)
+		}
+	}
+	if NewXorShiftRand(0).Uint64() == NewXorShiftRand(1).Uint64() {
+		t.Error("seeds 0 and 1 began the same sequence")
+	}
+}
+
+func TestXorShiftRandDistribution(t *testing.T) {
+	r := NewXorShiftRand(1)
+	var counts [10]int
+	var sum float64
+	for i := 0; i < 100000; i++ {
+		counts[r.Intn(10)]++
+		f := r.Float64()
+		if f < 0 || 1 <= f {
+			t.Fatalf("r.Float64(): %v outside [0, 1)\n", f)
+		}
+		sum += f
+	}
+	for i, c := range counts {
+		if c < 9500 || 10500 < c {
+			t.Errorf("counts[%d]: %v\n", i, c)
+		}
+	}
+	if mean := sum / 100000; mean < 0.49 || 0.51 < mean {
+		t.Errorf("mean of r.Float64(): %v\n", mean)
+	}
+}
+
+func TestXorShiftRandInt63n(t *testing.T) {
+	r := NewXorShiftRand(1)
+	for _, n := range []int64{1, 2, 3, 1 << 62, 1<<63 - 1} {
+		for i := 0; i < 1000; i++ {
+			if v := r.Int63n(n); v < 0 || n <= v {
+				t.Fatalf("r.Int63n(%v): %v\n", n, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import "time"
+
+// REDMetrics bundles the rate, errors, and duration of the requests served
+// by one endpoint or service, the "RED" metrics which every request-driven
+// service exports, so that a single call records all three consistently.
+// A bundle named "api" registers the meters "api.requests" and "api.errors"
+// and the timer "api.duration".  A name made by TaggedName keeps its tags
+// on each metric.
+type REDMetrics struct {
+	duration Timer
+	errors   Meter
+	requests Meter
+}
+
+// GetOrRegisterREDMetrics returns the RED metrics of the given name in the
+// given registry, constructing and registering any which don't yet exist.
+func GetOrRegisterREDMetrics(name string, r Registry) *REDMetrics {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &REDMetrics{
+		duration: GetOrRegisterTimer(bundleName(name, "duration"), r),
+		errors:   GetOrRegisterMeter(bundleName(name, "errors"), r),
+		requests: GetOrRegisterMeter(bundleName(name, "requests"), r),
+	}
+}
+
+// NewREDMetrics constructs a new, unregistered bundle of RED metrics.
+func NewREDMetrics() *REDMetrics {
+	return &REDMetrics{
+		duration: NewTimer(),
+		errors:   NewMeter(),
+		requests: NewMeter(),
+	}
+}
+
+// NewRegisteredREDMetrics constructs and registers a new bundle of RED
+// metrics under the given name.
+func NewRegisteredREDMetrics(name string, r Registry) *REDMetrics {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	red := &REDMetrics{
+		duration: newTimer(r.SampleConfig()),
+		errors:   NewMeter(),
+		requests: NewMeter(),
+	}
+	r.Register(bundleName(name, "duration"), red.duration)
+	r.Register(bundleName(name, "errors"), red.errors)
+	r.Register(bundleName(name, "requests"), red.requests)
+	return red
+}
+
+// Duration returns the timer of requests' durations.
+func (red *REDMetrics) Duration() Timer {
+	return red.duration
+}
+
+// Errors returns the meter of requests which failed.
+func (red *REDMetrics) Errors() Meter {
+	return red.errors
+}
+
+// Observe records a request which took the given duration and failed if err
+// is not nil.
+func (red *REDMetrics) Observe(d time.Duration, err error) {
+	red.requests.Mark(1)
+	if nil != err {
+		red.errors.Mark(1)
+	}
+	red.duration.Update(d)
+}
+
+// ObserveSince records a request which started at the given time and failed
+// if err is not nil.
+func (red *REDMetrics) ObserveSince(start time.Time, err error) {
+	red.Observe(time.Since(start), err)
+}
+
+// Requests returns the meter of requests served, failed or not.
+func (red *REDMetrics) Requests() Meter {
+	return red.requests
+}
+
+// Time records a request served by the given function, which failed if it
+// returns an error.  The error is returned.
+func (red *REDMetrics) Time(f func() error) error {
+	start := time.Now()
+	err := f()
+	red.ObserveSince(start, err)
+	return err
+}
+
+// bundleName returns the name of one metric of a bundle: the given suffix
+// appended to the bundle's name, before its tags if it has any.
+func bundleName(name, suffix string) string {
+	base, tags := SplitTaggedName(name)
+	return TaggedName(base+"."+suffix, tags)
+}
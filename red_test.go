@@ -0,0 +1,40 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestREDMetrics(t *testing.T) {
+	r := NewRegistry()
+	red := GetOrRegisterREDMetrics("api", r)
+	red.Observe(time.Millisecond, nil)
+	red.Observe(3*time.Millisecond, errors.New("timeout"))
+	if err := red.Time(func() error { return errors.New("refused") }); nil == err {
+		t.Error("red.Time(): expected the function's error")
+	}
+	if count := r.Get("api.requests").(Meter).Count(); 3 != count {
+		t.Errorf("api.requests.Count(): 3 != %v\n", count)
+	}
+	if count := r.Get("api.errors").(Meter).Count(); 2 != count {
+		t.Errorf("api.errors.Count(): 2 != %v\n", count)
+	}
+	if max := r.Get("api.duration").(Timer).Max(); int64(3*time.Millisecond) != max {
+		t.Errorf("api.duration.Max(): %v != %v\n", 3*time.Millisecond, max)
+	}
+	if GetOrRegisterREDMetrics("api", r).Requests() != red.Requests() {
+		t.Error("GetOrRegisterREDMetrics(): expected the registered meters")
+	}
+}
+
+func TestREDMetricsTagged(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredREDMetrics(TaggedName("api", map[string]string{"route": "/users"}), r).Observe(time.Millisecond, nil)
+	if nil == r.Get("api.requests;route=/users") {
+		t.Error("api.requests;route=/users wasn't registered")
+	}
+}
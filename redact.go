@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// A TagTransform transforms the value of a tag before it's exported, for
+// example to hash a user ID or to drop a URL's query string.
+type TagTransform func(value string) string
+
+// HashTagValue returns a TagTransform which replaces each value with the
+// first 16 hex digits of its HMAC-SHA256 under the given key, so that values
+// remain distinct, and equal across processes sharing the key, without being
+// recoverable by the backend.
+func HashTagValue(key []byte) TagTransform {
+	return func(value string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+}
+
+// StripQuery is a TagTransform which drops the query string and fragment
+// from a URL or path.
+func StripQuery(value string) string {
+	if i := strings.IndexAny(value, "?#"); 0 <= i {
+		return value[:i]
+	}
+	return value
+}
+
+// TruncateTagValue returns a TagTransform which truncates each value to at
+// most n runes.
+func TruncateTagValue(n int) TagTransform {
+	return func(value string) string {
+		runes := 0
+		for i := range value {
+			if n == runes {
+				return value[:i]
+			}
+			runes++
+		}
+		return value
+	}
+}
+
+// RedactingRegistry is a Registry whose Each transforms the values of
+// certain tags of the names of an underlying registry's metrics, named as by
+// TaggedName, so that dimensional metrics may be exported to third-party
+// backends without leaking personal data.  Metrics whose names become equal
+// are aggregated as by a View, and those which can't be are each passed under
+// the transformed name.  Metrics without any of the tags, or whose names are
+// shared with no other, are passed through as they are.  Registration and every other method is delegated to the
+// underlying registry, which keeps the original names for local use.
+type RedactingRegistry struct {
+	Registry
+	every      TagTransform // Applied to tags without transforms of their own
+	transforms map[string]TagTransform
+}
+
+// NewRedactingRegistry constructs a RedactingRegistry which transforms the
+// values of the given registry's tags by their keys.  To apply more than one
+// transform to a tag, compose them in one function.
+func NewRedactingRegistry(r Registry, transforms map[string]TagTransform) *RedactingRegistry {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	rr := &RedactingRegistry{Registry: r, transforms: make(map[string]TagTransform, len(transforms))}
+	for k, t := range transforms {
+		rr.transforms[k] = t
+	}
+	return rr
+}
+
+// Each calls the given function with each metric under its transformed name,
+// in order of name.  Aggregates of more than one metric are read-only
+// snapshots.
+func (rr *RedactingRegistry) Each(f func(string, interface{})) {
+	var out namedMetricSlice
+	emit := func(name string, i interface{}) { out = append(out, namedMetric{name, i}) }
+	groups := make(map[string]map[string]interface{})
+	rr.Registry.Each(func(name string, i interface{}) {
+		redacted, ok := rr.redact(name)
+		if !ok {
+			emit(name, i)
+			return
+		}
+		if nil == groups[redacted] {
+			groups[redacted] = make(map[string]interface{})
+		}
+		groups[redacted][name] = i
+	})
+	redactions := make([]string, 0, len(groups))
+	for redacted := range groups {
+		redactions = append(redactions, redacted)
+	}
+	sort.Strings(redactions)
+	for _, redacted := range redactions {
+		names := make([]string, 0, len(groups[redacted]))
+		for name := range groups[redacted] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		group := make([]interface{}, len(names))
+		for i, name := range names {
+			group[i] = groups[redacted][name]
+		}
+		if 1 == len(group) {
+			emit(redacted, group[0])
+			continue
+		}
+		if metric, ok := aggregateMetrics(group); ok {
+			emit(redacted, metric)
+			continue
+		}
+		for _, i := range group {
+			emit(redacted, i)
+		}
+	}
+	sort.Stable(out)
+	for _, e := range out {
+		f(e.name, e.m)
+	}
+}
+
+// EstimateMemory returns the underlying registry's estimate, since
+// aggregates are constructed only while Each is running.
+func (rr *RedactingRegistry) EstimateMemory() int64 {
+	return rr.Registry.EstimateMemory()
+}
+
+// ExportedPercentiles returns the percentiles set for the underlying
+// registry.
+func (rr *RedactingRegistry) ExportedPercentiles() []float64 {
+	return registryPercentiles(rr.Registry)
+}
+
+// Get returns the metric or aggregate by the given transformed name or nil
+// if there is none.
+func (rr *RedactingRegistry) Get(name string) interface{} {
+	var metric interface{}
+	rr.Each(func(n string, i interface{}) {
+		if n == name && nil == metric {
+			metric = i
+		}
+	})
+	return metric
+}
+
+// RunHealthchecks runs the underlying registry's healthchecks.
+func (rr *RedactingRegistry) RunHealthchecks() {
+	rr.Registry.RunHealthchecks()
+}
+
+// Snapshot takes a snapshot of every metric under its redacted name in a
+// single pass.
+func (rr *RedactingRegistry) Snapshot() *RegistrySnapshot {
+	return NewRegistrySnapshot(rr)
+}
+
+// redact returns the name with its tags' values transformed and whether it
+// has any tag to transform.
+func (rr *RedactingRegistry) redact(name string) (string, bool) {
+	family, tags := SplitTaggedName(name)
+	redacted := false
+	for k, value := range tags {
+		t, ok := rr.transforms[k]
+		if !ok {
+			t = rr.every
+		}
+		if nil != t {
+			tags[k] = t(value)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return name, false
+	}
+	return TaggedName(family, tags), true
+}
@@ -0,0 +1,61 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactingRegistry(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter(TaggedName("requests", map[string]string{"path": "/search?q=secret", "status": "200"}), r).Inc(2)
+	GetOrRegisterCounter(TaggedName("requests", map[string]string{"path": "/search?q=other", "status": "200"}), r).Inc(3)
+	GetOrRegisterCounter(TaggedName("logins", map[string]string{"user": "alice"}), r).Inc(1)
+	GetOrRegisterGauge("goroutines", r).Update(47)
+	rr := NewRedactingRegistry(r, map[string]TagTransform{
+		"path": StripQuery,
+		"user": HashTagValue([]byte("key")),
+	})
+	seen := make(map[string]interface{})
+	rr.Each(func(name string, i interface{}) {
+		if _, ok := seen[name]; ok {
+			t.Errorf("%v seen twice\n", name)
+		}
+		if strings.Contains(name, "secret") || strings.Contains(name, "alice") {
+			t.Errorf("name: %v\n", name)
+		}
+		seen[name] = i
+	})
+	if 3 != len(seen) {
+		t.Errorf("len(seen): 3 != %v: %v\n", len(seen), seen)
+	}
+	if c, ok := seen["requests;path=/search;status=200"].(Counter); !ok || 5 != c.Count() {
+		t.Errorf("requests;path=/search;status=200: %v\n", seen["requests;path=/search;status=200"])
+	}
+	user := HashTagValue([]byte("key"))("alice")
+	if 16 != len(user) {
+		t.Errorf("len(user): 16 != %v\n", len(user))
+	}
+	if c, ok := rr.Get("logins;user=" + user).(Counter); !ok || 1 != c.Count() {
+		t.Errorf("rr.Get(\"logins;user=%v\"): %v\n", user, rr.Get("logins;user="+user))
+	}
+	if g, ok := seen["goroutines"].(Gauge); !ok || 47 != g.Value() {
+		t.Errorf("goroutines: %v\n", seen["goroutines"])
+	}
+}
+
+func TestTruncateTagValue(t *testing.T) {
+	truncate := TruncateTagValue(3)
+	for value, truncated := range map[string]string{
+		"":       "",
+		"ab":     "ab",
+		"abcdef": "abc",
+		"héllo":  "hél",
+	} {
+		if s := truncate(value); truncated != s {
+			t.Errorf("truncate(%q): %q != %q\n", value, truncated, s)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package metrics
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // DuplicateMetric is the error returned by Registry.Register when a metric
@@ -15,6 +17,14 @@ func (err DuplicateMetric) Error() string {
 	return fmt.Sprintf("duplicate metric: %s", string(err))
 }
 
+// InvalidMetric is the error returned by Registry.RegisterAll when a metric
+// has an empty name or is not of a type a Registry can hold.
+type InvalidMetric string
+
+func (err InvalidMetric) Error() string {
+	return fmt.Sprintf("invalid metric: %q", string(err))
+}
+
 // A Registry holds references to a set of metrics by name and can iterate
 // over them, calling callback functions provided by the user.
 //
@@ -22,9 +32,13 @@ func (err DuplicateMetric) Error() string {
 // the Registry API as appropriate.
 type Registry interface {
 
-	// Call the given function for each registered metric.
+	// Call the given function for each registered metric.  Every
+	// registry in this package calls it in order of name.
 	Each(func(string, interface{}))
 
+	// Estimate the bytes of heap used by the registry and its metrics.
+	EstimateMemory() int64
+
 	// Get the metric by the given name or nil if none is registered.
 	Get(string) interface{}
 
@@ -36,9 +50,29 @@ type Registry interface {
 	// Register the given metric under the given name.
 	Register(string, interface{}) error
 
+	// Register all the given metrics or, if any of them is invalid or
+	// already registered, none of them.
+	RegisterAll(map[string]interface{}) error
+
 	// Run all registered healthchecks.
 	RunHealthchecks()
 
+	// Get the config of the Sample given to histograms and timers
+	// registered without one of their own.
+	SampleConfig() SampleConfig
+
+	// Set the config of the Sample given to histograms and timers
+	// registered without one of their own.
+	SetSampleConfig(SampleConfig)
+
+	// Take a snapshot of every metric in a single pass, as
+	// NewRegistrySnapshot does.
+	Snapshot() *RegistrySnapshot
+
+	// Get the tenant with the given id, an isolated namespace within the
+	// registry with its own quotas.
+	Tenant(string) *TenantRegistry
+
 	// Unregister the metric with the given name.
 	Unregister(string)
 
@@ -46,30 +80,70 @@ type Registry interface {
 	UnregisterAll()
 }
 
-// The standard implementation of a Registry is a mutex-protected map
-// of names to metrics.
+// registryShards is the number of shards a StandardRegistry's map is split
+// into.  It must be a power of two.
+const registryShards = 32
+
+// The standard implementation of a Registry is a sharded, copy-on-write map
+// of names to metrics.  Readers use whichever version of each shard's map is
+// current without taking any lock, so looking up or iterating over a large
+// registry never blocks registration and vice versa.  Writers are serialized
+// per shard by a mutex and replace the shard's map with an updated copy, so
+// concurrent registrations of different names rarely contend and each copies
+// only a fraction of the registry.
 type StandardRegistry struct {
-	metrics map[string]interface{}
-	mutex   sync.Mutex
+	percentiles  percentilesValue
+	sampleConfig atomic.Value // SampleConfig
+	shards       [registryShards]registryShard
+	tenants      tenantSet
+}
+
+type registryShard struct {
+	metrics atomic.Value // map[string]interface{}, never modified once stored
+	mutex   sync.Mutex   // serializes writers
 }
 
 // Create a new registry.
 func NewRegistry() Registry {
-	return &StandardRegistry{metrics: make(map[string]interface{})}
+	return &StandardRegistry{}
 }
 
-// Call the given function for each registered metric.
+// Call the given function for each registered metric in order of name, so
+// that consecutive exports can be compared line by line.  The metrics are
+// those registered when Each was called; metrics registered or unregistered
+// by the function, or concurrently, are not reflected.
 func (r *StandardRegistry) Each(f func(string, interface{})) {
-	for name, i := range r.registered() {
-		f(name, i)
+	var shards [registryShards]map[string]interface{}
+	n := 0
+	for i := range r.shards {
+		shards[i] = r.shards[i].load()
+		n += len(shards[i])
+	}
+	entries := make([]namedMetric, 0, n)
+	for _, metrics := range shards {
+		for name, metric := range metrics {
+			entries = append(entries, namedMetric{name, metric})
+		}
+	}
+	sort.Sort(namedMetricSlice(entries))
+	for _, e := range entries {
+		f(e.name, e.m)
 	}
 }
 
+// EstimateMemory returns an approximation of the bytes of heap used by the
+// registry's names and metrics.  See EstimateMetricMemory.
+func (r *StandardRegistry) EstimateMemory() int64 {
+	n := int64(reflect.TypeOf(r).Elem().Size())
+	r.Each(func(name string, i interface{}) {
+		n += estimateEntryMemory(name, i)
+	})
+	return n
+}
+
 // Get the metric by the given name or nil if none is registered.
 func (r *StandardRegistry) Get(name string) interface{} {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	return r.metrics[name]
+	return r.shard(name).load()[name]
 }
 
 // Gets an existing metric or creates and registers a new one. Threadsafe
@@ -77,77 +151,237 @@ func (r *StandardRegistry) Get(name string) interface{} {
 // The interface can be the metric to register if not found in registry,
 // or a function returning the metric for lazy instantiation.
 func (r *StandardRegistry) GetOrRegister(name string, i interface{}) interface{} {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	if metric, ok := r.metrics[name]; ok {
+	shard := r.shard(name)
+	if metric, ok := shard.load()[name]; ok {
+		return metric
+	}
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if metric, ok := shard.load()[name]; ok {
 		return metric
 	}
 	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
 		i = v.Call(nil)[0].Interface()
 	}
-	r.register(name, i)
+	shard.register(name, i)
 	return i
 }
 
 // Register the given metric under the given name.  Returns a DuplicateMetric
 // if a metric by the given name is already registered.
 func (r *StandardRegistry) Register(name string, i interface{}) error {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	return r.register(name, i)
+	shard := r.shard(name)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	return shard.register(name, i)
+}
+
+// Register all the given metrics or none of them.  Returns an InvalidMetric
+// if any name is empty or any metric is not of a type the registry can hold
+// and a DuplicateMetric if any name is already registered.  Every shard
+// involved is locked for the duration so that no conflicting registration
+// can slip in, though a concurrent Each may observe some of the metrics
+// before the rest.
+func (r *StandardRegistry) RegisterAll(metrics map[string]interface{}) error {
+	names := make([]string, 0, len(metrics))
+	for name, _ := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var byShard [registryShards][]string
+	for _, name := range names {
+		i := shardIndex(name)
+		byShard[i] = append(byShard[i], name)
+	}
+	for i := range r.shards {
+		if 0 < len(byShard[i]) {
+			r.shards[i].mutex.Lock()
+			defer r.shards[i].mutex.Unlock()
+		}
+	}
+	for _, name := range names {
+		if "" == name || !isMetric(metrics[name]) {
+			EmitEvent(Event{Type: EventInvalid, Name: name, Metric: metrics[name], Err: InvalidMetric(name)})
+			return InvalidMetric(name)
+		}
+		if _, ok := r.shard(name).load()[name]; ok {
+			EmitEvent(Event{Type: EventConflicted, Name: name, Metric: metrics[name], Err: DuplicateMetric(name)})
+			return DuplicateMetric(name)
+		}
+	}
+	for i := range r.shards {
+		if 0 == len(byShard[i]) {
+			continue
+		}
+		updated := r.shards[i].copy()
+		for _, name := range byShard[i] {
+			updated[Intern(name)] = metrics[name]
+		}
+		r.shards[i].metrics.Store(updated)
+	}
+	for _, name := range names {
+		EmitEvent(Event{Type: EventRegistered, Name: name, Metric: metrics[name]})
+	}
+	return nil
 }
 
 // Run all registered healthchecks.
 func (r *StandardRegistry) RunHealthchecks() {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	for _, i := range r.metrics {
+	r.Each(func(name string, i interface{}) {
 		if h, ok := i.(Healthcheck); ok {
 			h.Check()
 		}
+	})
+}
+
+// Snapshot takes a snapshot of every registered metric in a single pass.
+func (r *StandardRegistry) Snapshot() *RegistrySnapshot {
+	return NewRegistrySnapshot(r)
+}
+
+// ExportedPercentiles returns the percentiles set by SetPercentiles or nil if
+// none have been.
+func (r *StandardRegistry) ExportedPercentiles() []float64 {
+	return r.percentiles.load()
+}
+
+// SampleConfig returns the config of the Sample given to histograms and
+// timers registered without one of their own, DefaultSampleConfig unless
+// SetSampleConfig has been called.
+func (r *StandardRegistry) SampleConfig() SampleConfig {
+	if c, ok := r.sampleConfig.Load().(SampleConfig); ok {
+		return c
 	}
+	return DefaultSampleConfig
 }
 
-// Unregister the metric with the given name.
+// SetSampleConfig sets the config of the Sample given to histograms and
+// timers registered without one of their own.  Metrics already registered
+// keep the samples they were constructed with.
+func (r *StandardRegistry) SetSampleConfig(c SampleConfig) {
+	r.sampleConfig.Store(c)
+}
+
+// SetPercentiles sets the percentiles reporters export from the registry's
+// histograms, duration histograms, and timers which haven't been given any
+// of their own, in place of DefaultPercentiles, or, given nil, unsets them.
+func (r *StandardRegistry) SetPercentiles(ps []float64) {
+	r.percentiles.store(ps)
+}
+
+// Tenant returns the tenant with the given id, constructing it with
+// DefaultTenantQuota if need be.  See TenantRegistry.
+func (r *StandardRegistry) Tenant(id string) *TenantRegistry {
+	return r.tenants.tenant(r, id)
+}
+
+// Unregister the metric with the given name, stopping it if it's a meter or a
+// timer so that its meter is no longer ticked.
 func (r *StandardRegistry) Unregister(name string) {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	delete(r.metrics, name)
+	shard := r.shard(name)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	i, ok := shard.load()[name]
+	if !ok {
+		return
+	}
+	metrics := shard.copy()
+	delete(metrics, name)
+	shard.metrics.Store(metrics)
+	stop(i)
+	EmitEvent(Event{Type: EventUnregistered, Name: name, Metric: i})
 }
 
 // Unregister all metrics.  (Mostly for testing.)
 func (r *StandardRegistry) UnregisterAll() {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	for name, _ := range r.metrics {
-		delete(r.metrics, name)
+	for i := range r.shards {
+		r.shards[i].mutex.Lock()
+		metrics := r.shards[i].load()
+		r.shards[i].metrics.Store(make(map[string]interface{}))
+		r.shards[i].mutex.Unlock()
+		for name, metric := range metrics {
+			stop(metric)
+			EmitEvent(Event{Type: EventUnregistered, Name: name, Metric: metric})
+		}
+	}
+}
+
+func (r *StandardRegistry) eachTenant(f func(*TenantRegistry)) {
+	r.tenants.each(f)
+}
+
+// shard returns the shard which holds the given name.
+func (r *StandardRegistry) shard(name string) *registryShard {
+	return &r.shards[shardIndex(name)]
+}
+
+// shardIndex hashes a name using 32-bit FNV-1a, inlined to avoid allocating a
+// hash.Hash32 on every lookup.
+func shardIndex(name string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= 16777619
 	}
+	return int(h & (registryShards - 1))
 }
 
-func (r *StandardRegistry) register(name string, i interface{}) error {
-	if _, ok := r.metrics[name]; ok {
+// copy returns a copy of the shard's current map of metrics which the caller
+// may modify before storing it.  It must be called with s.mutex held.
+func (s *registryShard) copy() map[string]interface{} {
+	current := s.load()
+	metrics := make(map[string]interface{}, len(current)+1)
+	for name, i := range current {
+		metrics[name] = i
+	}
+	return metrics
+}
+
+// load returns the shard's current map of metrics, which must not be
+// modified.
+func (s *registryShard) load() map[string]interface{} {
+	metrics, _ := s.metrics.Load().(map[string]interface{})
+	return metrics
+}
+
+// register must be called with s.mutex held.
+func (s *registryShard) register(name string, i interface{}) error {
+	if _, ok := s.load()[name]; ok {
+		EmitEvent(Event{Type: EventConflicted, Name: name, Metric: i, Err: DuplicateMetric(name)})
 		return DuplicateMetric(name)
 	}
-	switch i.(type) {
-	case Counter, Gauge, GaugeFloat64, Healthcheck, Histogram, Meter, Timer:
-		r.metrics[name] = i
+	if !isMetric(i) {
+		EmitEvent(Event{Type: EventInvalid, Name: name, Metric: i})
+		return nil
 	}
+	metrics := s.copy()
+	metrics[Intern(name)] = i
+	s.metrics.Store(metrics)
+	EmitEvent(Event{Type: EventRegistered, Name: name, Metric: i})
 	return nil
 }
 
-func (r *StandardRegistry) registered() map[string]interface{} {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	metrics := make(map[string]interface{}, len(r.metrics))
-	for name, i := range r.metrics {
-		metrics[name] = i
+// isMetric reports whether i is of a type a registry can hold.
+func isMetric(i interface{}) bool {
+	switch i.(type) {
+	case Counter, CounterFloat64, DurationHistogram, Gauge, GaugeFloat64, Healthcheck, Histogram, Histogram2D, Meter, StagedTimer, Summary, Timer:
+		return true
+	}
+	return false
+}
+
+// stop stops an unregistered metric, such as a StandardMeter, which is
+// otherwise kept alive by what ticks it.
+func stop(i interface{}) {
+	if s, ok := unwrap(i).(interface{ Stop() }); ok {
+		s.Stop()
 	}
-	return metrics
 }
 
 type PrefixedRegistry struct {
 	underlying Registry
 	prefix     string
+	tenants    tenantSet
 }
 
 func NewPrefixedRegistry(prefix string) Registry {
@@ -162,6 +396,11 @@ func (r *PrefixedRegistry) Each(fn func(string, interface{})) {
 	r.underlying.Each(fn)
 }
 
+// Estimate the bytes of heap used by the registry and its metrics.
+func (r *PrefixedRegistry) EstimateMemory() int64 {
+	return r.underlying.EstimateMemory()
+}
+
 // Get the metric by the given name or nil if none is registered.
 func (r *PrefixedRegistry) Get(name string) interface{} {
 	return r.underlying.Get(name)
@@ -181,11 +420,49 @@ func (r *PrefixedRegistry) Register(name string, metric interface{}) error {
 	return r.underlying.Register(realName, metric)
 }
 
+// Register all the given metrics or none of them. The names will be prefixed.
+func (r *PrefixedRegistry) RegisterAll(metrics map[string]interface{}) error {
+	prefixed := make(map[string]interface{}, len(metrics))
+	for name, metric := range metrics {
+		prefixed[r.prefix+name] = metric
+	}
+	return r.underlying.RegisterAll(prefixed)
+}
+
 // Run all registered healthchecks.
 func (r *PrefixedRegistry) RunHealthchecks() {
 	r.underlying.RunHealthchecks()
 }
 
+// Take a snapshot of every metric of the underlying registry with the
+// registry's prefix in a single pass.
+func (r *PrefixedRegistry) Snapshot() *RegistrySnapshot {
+	return NewRegistrySnapshot(r)
+}
+
+// Get the percentiles exported from the underlying registry's metrics.
+func (r *PrefixedRegistry) ExportedPercentiles() []float64 {
+	return registryPercentiles(r.underlying)
+}
+
+// Get the config of the Sample given to histograms and timers registered
+// without one of their own.
+func (r *PrefixedRegistry) SampleConfig() SampleConfig {
+	return r.underlying.SampleConfig()
+}
+
+// Set the config of the Sample given to histograms and timers registered
+// without one of their own.
+func (r *PrefixedRegistry) SetSampleConfig(c SampleConfig) {
+	r.underlying.SetSampleConfig(c)
+}
+
+// Get the tenant with the given id.  The names of its metrics will be
+// prefixed.
+func (r *PrefixedRegistry) Tenant(id string) *TenantRegistry {
+	return r.tenants.tenant(r, id)
+}
+
 // Unregister the metric with the given name. The name will be prefixed.
 func (r *PrefixedRegistry) Unregister(name string) {
 	realName := r.prefix + name
@@ -197,6 +474,10 @@ func (r *PrefixedRegistry) UnregisterAll() {
 	r.underlying.UnregisterAll()
 }
 
+func (r *PrefixedRegistry) eachTenant(f func(*TenantRegistry)) {
+	r.tenants.each(f)
+}
+
 var DefaultRegistry Registry = NewRegistry()
 
 // Call the given function for each registered metric.
@@ -204,6 +485,11 @@ func Each(f func(string, interface{})) {
 	DefaultRegistry.Each(f)
 }
 
+// Estimate the bytes of heap used by the default registry and its metrics.
+func EstimateMemory() int64 {
+	return DefaultRegistry.EstimateMemory()
+}
+
 // Get the metric by the given name or nil if none is registered.
 func Get(name string) interface{} {
 	return DefaultRegistry.Get(name)
@@ -229,11 +515,22 @@ func MustRegister(name string, i interface{}) {
 	}
 }
 
+// Register all the given metrics or none of them.  Returns an InvalidMetric
+// or DuplicateMetric if any of them cannot be registered.
+func RegisterAll(metrics map[string]interface{}) error {
+	return DefaultRegistry.RegisterAll(metrics)
+}
+
 // Run all registered healthchecks.
 func RunHealthchecks() {
 	DefaultRegistry.RunHealthchecks()
 }
 
+// Get the tenant with the given id.
+func Tenant(id string) *TenantRegistry {
+	return DefaultRegistry.Tenant(id)
+}
+
 // Unregister the metric with the given name.
 func Unregister(name string) {
 	DefaultRegistry.Unregister(name)
@@ -0,0 +1,134 @@
+package metrics
+
+import "time"
+
+// RegistrySnapshot is a read-only copy of every metric of a registry, each
+// replaced by its snapshot, taken in a single pass over the registry so that
+// exporters read counts and rates from as nearly the same moment as they can
+// rather than from each metric as they come to it.  Metrics aren't frozen
+// together, so an update made during the pass may be seen in one metric's
+// snapshot and not another's, but the pass takes no longer than copying the
+// metrics does.  Healthchecks, which have no snapshots, are included as they
+// are.
+type RegistrySnapshot struct {
+	metrics namedMetricSlice // in order of name
+	index   map[string]interface{}
+	time    time.Time
+}
+
+// NewRegistrySnapshot takes a snapshot of every metric of the given registry,
+// as every registry's Snapshot method does.
+func NewRegistrySnapshot(r Registry) *RegistrySnapshot {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	s := &RegistrySnapshot{index: make(map[string]interface{}), time: time.Now()}
+	r.Each(func(name string, i interface{}) {
+		i = snapshotMetric(i)
+		s.metrics = append(s.metrics, namedMetric{name, i})
+		s.index[name] = i
+	})
+	return s
+}
+
+// Counter returns the snapshot of the named Counter and whether there is
+// one.
+func (s *RegistrySnapshot) Counter(name string) (Counter, bool) {
+	c, ok := s.index[name].(Counter)
+	return c, ok
+}
+
+// CounterFloat64 returns the snapshot of the named CounterFloat64 and
+// whether there is one.
+func (s *RegistrySnapshot) CounterFloat64(name string) (CounterFloat64, bool) {
+	c, ok := s.index[name].(CounterFloat64)
+	return c, ok
+}
+
+// DurationHistogram returns the snapshot of the named DurationHistogram and
+// whether there is one.
+func (s *RegistrySnapshot) DurationHistogram(name string) (DurationHistogram, bool) {
+	h, ok := s.index[name].(DurationHistogram)
+	return h, ok
+}
+
+// Each calls the given function with the snapshot of each metric in order of
+// name.
+func (s *RegistrySnapshot) Each(f func(string, interface{})) {
+	for _, m := range s.metrics {
+		f(m.name, m.m)
+	}
+}
+
+// Gauge returns the snapshot of the named Gauge and whether there is one.
+func (s *RegistrySnapshot) Gauge(name string) (Gauge, bool) {
+	g, ok := s.index[name].(Gauge)
+	return g, ok
+}
+
+// GaugeFloat64 returns the snapshot of the named GaugeFloat64 and whether
+// there is one.
+func (s *RegistrySnapshot) GaugeFloat64(name string) (GaugeFloat64, bool) {
+	g, ok := s.index[name].(GaugeFloat64)
+	return g, ok
+}
+
+// Get returns the snapshot of the named metric or nil if there is none.
+func (s *RegistrySnapshot) Get(name string) interface{} {
+	return s.index[name]
+}
+
+// Histogram returns the snapshot of the named Histogram and whether there is
+// one.
+func (s *RegistrySnapshot) Histogram(name string) (Histogram, bool) {
+	h, ok := s.index[name].(Histogram)
+	return h, ok
+}
+
+// Len returns the number of metrics in the snapshot.
+func (s *RegistrySnapshot) Len() int { return len(s.metrics) }
+
+// Meter returns the snapshot of the named Meter and whether there is one.
+func (s *RegistrySnapshot) Meter(name string) (Meter, bool) {
+	m, ok := s.index[name].(Meter)
+	return m, ok
+}
+
+// Time returns when the snapshot was taken.
+func (s *RegistrySnapshot) Time() time.Time { return s.time }
+
+// Timer returns the snapshot of the named Timer and whether there is one.
+func (s *RegistrySnapshot) Timer(name string) (Timer, bool) {
+	t, ok := s.index[name].(Timer)
+	return t, ok
+}
+
+// snapshotMetric returns the snapshot of a metric, or the metric itself if
+// it has none.
+func snapshotMetric(i interface{}) interface{} {
+	switch metric := i.(type) {
+	case Counter:
+		return metric.Snapshot()
+	case CounterFloat64:
+		return metric.Snapshot()
+	case DurationHistogram:
+		return metric.Snapshot()
+	case Gauge:
+		return metric.Snapshot()
+	case GaugeFloat64:
+		return metric.Snapshot()
+	case Histogram:
+		return metric.Snapshot()
+	case Histogram2D:
+		return metric.Snapshot()
+	case Meter:
+		return metric.Snapshot()
+	case StagedTimer:
+		return metric.Snapshot()
+	case Summary:
+		return metric.Snapshot()
+	case Timer:
+		return metric.Snapshot()
+	}
+	return i
+}
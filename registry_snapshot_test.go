@@ -0,0 +1,55 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := NewRegistry()
+	c := NewRegisteredCounter("b.counter", r)
+	c.Inc(47)
+	NewRegisteredGauge("a.gauge", r).Update(3)
+	m := NewMeterWithTickSource(NewManualTickSource())
+	r.Register("c.meter", m)
+	m.Mark(2)
+	s := r.Snapshot()
+	c.Inc(1)
+	m.Mark(1)
+	if n := s.Len(); 3 != n {
+		t.Errorf("s.Len(): 3 != %v\n", n)
+	}
+	if sc, ok := s.Counter("b.counter"); !ok || 47 != sc.Count() {
+		t.Errorf("s.Counter(\"b.counter\"): %v, %v\n", sc, ok)
+	}
+	if sg, ok := s.Gauge("a.gauge"); !ok || 3 != sg.Value() {
+		t.Errorf("s.Gauge(\"a.gauge\"): %v, %v\n", sg, ok)
+	}
+	if sm, ok := s.Meter("c.meter"); !ok || 2 != sm.Count() {
+		t.Errorf("s.Meter(\"c.meter\"): %v, %v\n", sm, ok)
+	}
+	if _, ok := s.Timer("b.counter"); ok {
+		t.Error("s.Timer(\"b.counter\") of a counter")
+	}
+	if nil != s.Get("d.missing") {
+		t.Error("s.Get(\"d.missing\") isn't nil")
+	}
+	var names []string
+	s.Each(func(name string, i interface{}) {
+		if _, ok := i.(CounterSnapshot); "b.counter" == name && !ok {
+			t.Errorf("%s: %T isn't a snapshot\n", name, i)
+		}
+		names = append(names, name)
+	})
+	if 3 != len(names) || "a.gauge" != names[0] || "b.counter" != names[1] || "c.meter" != names[2] {
+		t.Errorf("s.Each(): %v\n", names)
+	}
+}
+
+func TestRegistrySnapshotPrefixed(t *testing.T) {
+	r := NewPrefixedRegistry("prefix.")
+	NewRegisteredCounter("counter", r).Inc(1)
+	if c, ok := r.Snapshot().Counter("prefix.counter"); !ok || 1 != c.Count() {
+		t.Errorf("r.Snapshot().Counter(\"prefix.counter\"): %v, %v\n", c, ok)
+	}
+}
@@ -1,6 +1,13 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
-import "testing"
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
 
 func BenchmarkRegistry(b *testing.B) {
 	r := NewRegistry()
@@ -11,6 +18,71 @@ func BenchmarkRegistry(b *testing.B) {
 	}
 }
 
+func BenchmarkRegistryGetOrRegisterParallel(b *testing.B) {
+	r := NewRegistry()
+	names := make([]string, 1000)
+	for i := range names {
+		names[i] = fmt.Sprintf("counter-%d", i)
+		r.Register(names[i], NewCounter())
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			r.GetOrRegister(names[i%len(names)], NewCounter)
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistryRegisterParallel(b *testing.B) {
+	r := NewRegistry()
+	var n int64
+	var mutex sync.Mutex
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mutex.Lock()
+			n++
+			i := n
+			mutex.Unlock()
+			name := fmt.Sprintf("dynamic-%d", i%4096)
+			r.GetOrRegister(name, NewCounter)
+			if 0 == i%2 {
+				r.Unregister(name)
+			}
+		}
+	})
+}
+
+func BenchmarkRegistryEachDuringRegistration(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < 1000; i++ {
+		r.Register(fmt.Sprintf("counter-%d", i), NewCounter())
+	}
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				r.GetOrRegister(fmt.Sprintf("dynamic-%d", i%100), NewCounter)
+			}
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Each(func(string, interface{}) {})
+	}
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+}
+
 func TestRegistry(t *testing.T) {
 	r := NewRegistry()
 	r.Register("foo", NewCounter())
@@ -141,6 +213,25 @@ func TestPrefixedRegistryRegister(t *testing.T) {
 	})
 }
 
+func TestRegistryUnregisterStops(t *testing.T) {
+	defer func(ts TickSource) { DefaultTickSource = ts }(DefaultTickSource)
+	ts := NewManualTickSource()
+	DefaultTickSource = ts
+	r := NewRegistry()
+	NewRegisteredMeter("foo", r)
+	NewRegisteredTimer("bar", r)
+	NewRegisteredMeter("baz", r)
+	r.Unregister("foo")
+	r.Unregister("bar")
+	if n := len(ts.meters); 1 != n {
+		t.Errorf("len(ts.meters): 1 != %v\n", n)
+	}
+	r.UnregisterAll()
+	if n := len(ts.meters); 0 != n {
+		t.Errorf("len(ts.meters): 0 != %v\n", n)
+	}
+}
+
 func TestPrefixedRegistryUnregister(t *testing.T) {
 	r := NewPrefixedRegistry("prefix.")
 
@@ -163,3 +254,181 @@ func TestPrefixedRegistryUnregister(t *testing.T) {
 		t.Fatal(i)
 	}
 }
+
+func TestRegistryRegisterAll(t *testing.T) {
+	r := NewRegistry()
+	if err := r.RegisterAll(map[string]interface{}{
+		"foo": NewCounter(),
+		"bar": NewGauge(),
+	}); nil != err {
+		t.Fatal(err)
+	}
+	if _, ok := r.Get("foo").(Counter); !ok {
+		t.Fatal(r.Get("foo"))
+	}
+	if _, ok := r.Get("bar").(Gauge); !ok {
+		t.Fatal(r.Get("bar"))
+	}
+}
+
+func TestRegistryRegisterAllDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewCounter())
+	err := r.RegisterAll(map[string]interface{}{
+		"bar": NewGauge(),
+		"foo": NewCounter(),
+	})
+	if DuplicateMetric("foo") != err {
+		t.Fatal(err)
+	}
+	if nil != r.Get("bar") {
+		t.Fatal(r.Get("bar"))
+	}
+}
+
+func TestRegistryRegisterAllInvalid(t *testing.T) {
+	r := NewRegistry()
+	if err := r.RegisterAll(map[string]interface{}{
+		"bar": NewGauge(),
+		"foo": "not a metric",
+	}); InvalidMetric("foo") != err {
+		t.Fatal(err)
+	}
+	if err := r.RegisterAll(map[string]interface{}{
+		"":    NewGauge(),
+		"bar": NewGauge(),
+	}); InvalidMetric("") != err {
+		t.Fatal(err)
+	}
+	i := 0
+	r.Each(func(string, interface{}) { i++ })
+	if 0 != i {
+		t.Fatal(i)
+	}
+}
+
+func TestPrefixedRegistryRegisterAll(t *testing.T) {
+	r := NewPrefixedRegistry("prefix.")
+	if err := r.RegisterAll(map[string]interface{}{"foo": NewCounter()}); nil != err {
+		t.Fatal(err)
+	}
+	r.Each(func(name string, m interface{}) {
+		if name != "prefix.foo" {
+			t.Fatal(name)
+		}
+	})
+}
+
+func TestRegistryEachSnapshot(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewCounter())
+	r.Register("bar", NewCounter())
+	i := 0
+	r.Each(func(name string, iface interface{}) {
+		i++
+		r.Register(name+".new", NewCounter())
+		r.Unregister("foo")
+		r.Unregister("bar")
+	})
+	if 2 != i {
+		t.Fatal(i)
+	}
+	names := make(map[string]bool)
+	r.Each(func(name string, iface interface{}) { names[name] = true })
+	if 2 != len(names) || !names["foo.new"] || !names["bar.new"] {
+		t.Fatal(names)
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	r := NewRegistry()
+	wg := &sync.WaitGroup{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				name := fmt.Sprintf("counter-%d", i)
+				r.GetOrRegister(name, NewCounter).(Counter).Inc(1)
+				r.Each(func(string, interface{}) {})
+				if 0 == g {
+					r.Unregister(fmt.Sprintf("counter-%d", i/2))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if nil == r.Get("counter-99") {
+		t.Fatal("counter-99 wasn't registered")
+	}
+}
+
+func TestRegistryRegisterAllAcrossShards(t *testing.T) {
+	r := NewRegistry()
+	metrics := make(map[string]interface{})
+	for i := 0; i < 4*registryShards; i++ {
+		metrics[fmt.Sprintf("counter-%d", i)] = NewCounter()
+	}
+	if err := r.RegisterAll(metrics); nil != err {
+		t.Fatal(err)
+	}
+	i := 0
+	r.Each(func(string, interface{}) { i++ })
+	if len(metrics) != i {
+		t.Fatal(i)
+	}
+	r.UnregisterAll()
+	i = 0
+	r.Each(func(string, interface{}) { i++ })
+	if 0 != i {
+		t.Fatal(i)
+	}
+}
+
+func TestRegistrySampleConfig(t *testing.T) {
+	r := NewRegistry()
+	if c := r.SampleConfig(); DefaultSampleConfig != c {
+		t.Errorf("r.SampleConfig(): %v != %v\n", DefaultSampleConfig, c)
+	}
+	c := SampleConfig{Type: SlidingWindowSampleType, Size: 256}
+	r.SetSampleConfig(c)
+	if s, ok := GetOrRegisterTimer("timer", r).(*StandardTimer).histogram.Sample().(*SlidingWindowSample); !ok || 256 != s.reservoirSize {
+		t.Errorf("timer sample: %#v\n", s)
+	}
+	if s, ok := GetOrRegisterHistogram("histogram", r, nil).Sample().(*SlidingWindowSample); !ok || 256 != s.reservoirSize {
+		t.Errorf("histogram sample: %#v\n", s)
+	}
+	if _, ok := GetOrRegisterHistogram("uniform", r, NewUniformSample(10)).Sample().(*UniformSample); !ok {
+		t.Error("histogram with its own sample was given the registry's")
+	}
+	p := NewPrefixedRegistry("prefix.")
+	p.SetSampleConfig(c)
+	if s, ok := NewRegisteredTimer("timer", p).(*StandardTimer).histogram.Sample().(*SlidingWindowSample); !ok || 256 != s.reservoirSize {
+		t.Errorf("prefixed timer sample: %#v\n", s)
+	}
+}
+
+func TestRegistryEachOrder(t *testing.T) {
+	r := NewRegistry()
+	names := []string{"a", "a.b", "a;x=1", "b", "ba", "c", "requests;status=200", "requests;status=500", "z"}
+	for i := len(names) - 1; 0 <= i; i-- {
+		r.Register(names[i], NewCounter())
+	}
+	tenant := r.Tenant("tenant")
+	for i := len(names) - 1; 0 <= i; i-- {
+		tenant.Register(names[i], NewCounter())
+	}
+	vr := NewViewRegistry(r, View{Name: "requests", Without: []string{"status"}})
+	for _, each := range []func(func(string, interface{})){r.Each, tenant.Each, vr.Each} {
+		var seen []string
+		each(func(name string, i interface{}) {
+			seen = append(seen, name)
+		})
+		for i := 1; i < len(seen); i++ {
+			if seen[i] < seen[i-1] {
+				t.Errorf("seen: %v\n", seen)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import "regexp"
+
+// RedactedTagValue replaces the value of each tag a Restriction strips.
+const RedactedTagValue = "redacted"
+
+// DefaultRestrictedTagValues are the patterns of potentially sensitive tag
+// values stripped by a Restriction without patterns of its own: email
+// addresses, IPv4 and IPv6 addresses, and UUIDs.
+var DefaultRestrictedTagValues = []*regexp.Regexp{
+	regexp.MustCompile(`[^@\s]+@[^@\s]+\.[^@\s]+`),
+	regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`),
+	regexp.MustCompile(`(?i)\b([0-9a-f]{1,4})?(:[0-9a-f]{0,4}){2,7}`),
+	regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`),
+}
+
+// A Restriction limits a push reporter to a minimal, numeric-only export for
+// destinations subject to compliance restrictions.  Every payload but names,
+// numbers, and tags is already left out of these reporters' output, so a
+// Restriction strips the remaining potentially sensitive payload, the values
+// of tags, by replacing each value matching any of its patterns with
+// RedactedTagValue.  Metrics whose names become equal are aggregated as by a
+// RedactingRegistry.  A nil *Restriction exports everything.
+type Restriction struct {
+	TagValues []*regexp.Regexp // Patterns of tag values to strip; nil means DefaultRestrictedTagValues
+}
+
+// registry returns r with the restriction's tag values stripped, or r itself
+// if rs is nil.
+func (rs *Restriction) registry(r Registry) Registry {
+	if nil == rs {
+		return r
+	}
+	return &RedactingRegistry{Registry: r, every: rs.redact}
+}
+
+// redact returns RedactedTagValue if the value matches any of the
+// restriction's patterns, or else the value itself.
+func (rs *Restriction) redact(value string) string {
+	patterns := rs.TagValues
+	if nil == patterns {
+		patterns = DefaultRestrictedTagValues
+	}
+	for _, p := range patterns {
+		if p.MatchString(value) {
+			return RedactedTagValue
+		}
+	}
+	return value
+}
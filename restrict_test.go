@@ -0,0 +1,59 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestriction(t *testing.T) {
+	rs := &Restriction{}
+	for value, redacted := range map[string]bool{
+		"alice@example.com":                    true,
+		"192.168.0.1":                          true,
+		"2001:db8::1":                          true,
+		"123e4567-e89b-12d3-a456-426614174000": true,
+		"/search":                              false,
+		"200":                                  false,
+	} {
+		if s := rs.redact(value); redacted != (RedactedTagValue == s) {
+			t.Errorf("rs.redact(%q): %q\n", value, s)
+		}
+	}
+	rs = &Restriction{TagValues: []*regexp.Regexp{regexp.MustCompile(`^user-`)}}
+	if s := rs.redact("user-47"); RedactedTagValue != s {
+		t.Errorf("rs.redact(\"user-47\"): %q\n", s)
+	}
+	if s := rs.redact("alice@example.com"); "alice@example.com" != s {
+		t.Errorf("rs.redact(\"alice@example.com\"): %q\n", s)
+	}
+}
+
+func TestGraphiteOnceRestricted(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredCounter(TaggedName("logins", map[string]string{"client": "10.0.0.1", "status": "200"}), r).Inc(2)
+	NewRegisteredCounter(TaggedName("logins", map[string]string{"client": "10.0.0.2", "status": "200"}), r).Inc(3)
+	NewRegisteredCounter("requests", r).Inc(47)
+	var buf bytes.Buffer
+	if err := GraphiteOnce(GraphiteConfig{
+		Registry:     r,
+		DurationUnit: time.Nanosecond,
+		Prefix:       "prefix",
+		DryRun:       &buf,
+		Restricted:   &Restriction{},
+	}); nil != err {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	if strings.Contains(s, "10.0.0") {
+		t.Errorf("graphite: %q\n", s)
+	}
+	if !strings.Contains(s, "prefix.logins.count;client=redacted;status=200 5 ") || !strings.Contains(s, "prefix.requests.count 47 ") {
+		t.Errorf("graphite: %q\n", s)
+	}
+}
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrRollupCycle is returned by RollupMeter.AddParent when the parent is the
+// meter itself or already rolls up into it.
+var ErrRollupCycle = errors.New("metrics: rollup meter would roll up into itself")
+
+// rollupLock serializes changes to every RollupMeter's parents so that two
+// meters can't concurrently be made each other's parent.
+var rollupLock sync.Mutex
+
+// GetOrRegisterRollupMeter returns an existing Meter or constructs and
+// registers a new RollupMeter which rolls up into the given parents.
+func GetOrRegisterRollupMeter(name string, r Registry, parents ...Meter) Meter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() Meter { return NewRollupMeter(parents...) }).(Meter)
+}
+
+// NewRollupMeter constructs a new RollupMeter, backed by a StandardMeter,
+// which rolls up into the given parents.
+func NewRollupMeter(parents ...Meter) *RollupMeter {
+	m := &RollupMeter{Meter: NewMeter()}
+	for _, parent := range parents {
+		m.AddParent(parent) // can't fail, since nothing rolls up into m yet
+	}
+	return m
+}
+
+// NewRegisteredRollupMeter constructs and registers a new RollupMeter which
+// rolls up into the given parents.
+func NewRegisteredRollupMeter(name string, r Registry, parents ...Meter) *RollupMeter {
+	m := NewRollupMeter(parents...)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, m)
+	return m
+}
+
+// RollupMeter is a Meter which marks its parents whenever it's marked, so
+// that, for example, a meter per endpoint can roll up into a total for the
+// service without each request being marked twice.  A parent which is itself
+// a RollupMeter marks its own parents in turn, so an event reaches every
+// ancestor once for each path leading to it.  Parents may be added but not
+// removed, and marking never blocks on their being added.
+type RollupMeter struct {
+	Meter
+	parents atomic.Pointer[[]Meter]
+}
+
+// AddParent makes the meter roll up into parent from now on.  It returns
+// ErrRollupCycle, leaving the meter unchanged, if parent is the meter itself
+// or one of its descendants.
+func (m *RollupMeter) AddParent(parent Meter) error {
+	rollupLock.Lock()
+	defer rollupLock.Unlock()
+	if rollsUpInto(parent, m) {
+		return ErrRollupCycle
+	}
+	var parents []Meter
+	if ps := m.parents.Load(); nil != ps {
+		parents = append(parents, *ps...)
+	}
+	parents = append(parents, parent)
+	m.parents.Store(&parents)
+	return nil
+}
+
+// Mark records the occurrence of n events in the meter and in each of its
+// parents.
+func (m *RollupMeter) Mark(n int64) {
+	m.Meter.Mark(n)
+	if ps := m.parents.Load(); nil != ps {
+		for _, parent := range *ps {
+			parent.Mark(n)
+		}
+	}
+}
+
+// Parents returns the meters the meter rolls up into.
+func (m *RollupMeter) Parents() []Meter {
+	ps := m.parents.Load()
+	if nil == ps {
+		return nil
+	}
+	return append([]Meter(nil), *ps...)
+}
+
+// String formats the count and rates for debugging.
+func (m *RollupMeter) String() string { return meterString(m) }
+
+func (m *RollupMeter) unwrapMetric() interface{} { return m.Meter }
+
+// rollsUpInto returns whether marking from would mark to, which it does if
+// they're the same meter or any of from's parents rolls up into to.  The
+// caller must hold rollupLock.
+func rollsUpInto(from Meter, to *RollupMeter) bool {
+	r, ok := from.(*RollupMeter)
+	if !ok {
+		return false
+	}
+	if r == to {
+		return true
+	}
+	if ps := r.parents.Load(); nil != ps {
+		for _, parent := range *ps {
+			if rollsUpInto(parent, to) {
+				return true
+			}
+		}
+	}
+	return false
+}
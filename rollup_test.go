@@ -0,0 +1,50 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestRollupMeter(t *testing.T) {
+	r := NewRegistry()
+	service := NewRegisteredMeter("service", r)
+	api := NewRegisteredRollupMeter("api", r, service)
+	users := GetOrRegisterRollupMeter("api.users", r, api)
+	NewRegisteredRollupMeter("api.orders", r, api).Mark(2)
+	users.Mark(3)
+	if count := users.Count(); 3 != count {
+		t.Errorf("users.Count(): 3 != %v\n", count)
+	}
+	if count := api.Count(); 5 != count {
+		t.Errorf("api.Count(): 5 != %v\n", count)
+	}
+	if count := service.Count(); 5 != count {
+		t.Errorf("service.Count(): 5 != %v\n", count)
+	}
+	if count := r.Get("api.users").(Meter).Snapshot().Count(); 3 != count {
+		t.Errorf("r.Get(\"api.users\").Snapshot().Count(): 3 != %v\n", count)
+	}
+}
+
+func TestRollupMeterCycle(t *testing.T) {
+	a := NewRollupMeter()
+	b := NewRollupMeter(a)
+	c := NewRollupMeter(b)
+	if err := a.AddParent(a); ErrRollupCycle != err {
+		t.Errorf("a.AddParent(a): ErrRollupCycle != %v\n", err)
+	}
+	if err := a.AddParent(c); ErrRollupCycle != err {
+		t.Errorf("a.AddParent(c): ErrRollupCycle != %v\n", err)
+	}
+	if n := len(a.Parents()); 0 != n {
+		t.Errorf("len(a.Parents()): 0 != %v\n", n)
+	}
+	total := NewMeter()
+	if err := a.AddParent(total); nil != err {
+		t.Fatal(err)
+	}
+	c.Mark(1)
+	if count := total.Count(); 1 != count {
+		t.Errorf("total.Count(): 1 != %v\n", count)
+	}
+}
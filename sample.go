@@ -1,56 +1,175 @@
 package metrics
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"math"
-	"math/rand"
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
 )
 
 const rescaleThreshold = time.Hour
 
+// adaptInterval is how often an adaptive ExpDecaySample resizes its
+// reservoir to the number of updates it saw in the last interval.  With the
+// default alpha of 0.015 a value's forward-decay weight falls by a factor of
+// e every 67 seconds, so a reservoir holding about a minute of updates keeps
+// the values which dominate its percentiles.
+const adaptInterval = time.Minute
+
 // Samples maintain a statistically-significant selection of values from
 // a stream.
-type Sample interface {
-	Clear()
-	Count() int64
-	Max() int64
-	Mean() float64
-	Min() int64
-	Percentile(float64) float64
-	Percentiles([]float64) []float64
-	Size() int
-	Snapshot() Sample
-	StdDev() float64
-	Sum() int64
-	Update(int64)
-	Values() []int64
-	Variance() float64
+type Sample = metricsiface.Sample
+
+// sampleTotalSum returns the sum of every value the given sample has
+// recorded, which like its Count isn't limited to the values it retains, or,
+// for a sample which doesn't track it, the sum of the values it retains.
+func sampleTotalSum(s Sample) int64 {
+	if t, ok := s.(interface {
+		totalSum() int64
+	}); ok {
+		return t.totalSum()
+	}
+	return s.Sum()
+}
+
+// A Rand supplies the random numbers a Sample uses to choose which values to
+// retain.  *rand.Rand satisfies it, but like *rand.Rand a Rand need not be
+// safe for concurrent use: each sample only calls it with its lock held.
+type Rand interface {
+	Float64() float64
+	Int63n(int64) int64
+	Intn(int) int
+}
+
+// SampleType selects the Sample implementation a SampleConfig describes.
+type SampleType int
+
+const (
+	// ExpDecaySampleType selects an ExpDecaySample.
+	ExpDecaySampleType SampleType = iota
+
+	// UniformSampleType selects a UniformSample.
+	UniformSampleType
+
+	// SlidingWindowSampleType selects a SlidingWindowSample.
+	SlidingWindowSampleType
+
+	// AdaptiveExpDecaySampleType selects an ExpDecaySample whose reservoir
+	// size adapts to its update rate.
+	AdaptiveExpDecaySampleType
+
+	// SlidingTimeWindowSampleType selects a SlidingTimeWindowSample.
+	SlidingTimeWindowSampleType
+)
+
+// A SampleConfig describes the Sample given to histograms and timers which
+// aren't constructed with one of their own.  Alpha is only used by
+// exponentially-decaying samples.  MinSize is only used by adaptive samples,
+// whose reservoir size ranges from MinSize to Size.  Window is only used by
+// sliding time window samples, which don't use Size.
+type SampleConfig struct {
+	Type    SampleType
+	Size    int
+	MinSize int
+	Alpha   float64
+	Window  time.Duration
+}
+
+// DefaultSampleConfig describes an exponentially-decaying sample with the
+// same reservoir size and alpha as UNIX load averages.  It's used by
+// NewTimer and by registries whose sample config hasn't been set.
+var DefaultSampleConfig = SampleConfig{
+	Type:  ExpDecaySampleType,
+	Size:  defaultSampleSize,
+	Alpha: 0.015,
+}
+
+// NewSample constructs a new Sample as described by the config.  It panics
+// if the config's type is unknown.
+func (c SampleConfig) NewSample() Sample {
+	switch c.Type {
+	case ExpDecaySampleType:
+		return NewExpDecaySample(c.Size, c.Alpha)
+	case UniformSampleType:
+		return NewUniformSample(c.Size)
+	case SlidingWindowSampleType:
+		return NewSlidingWindowSample(c.Size)
+	case AdaptiveExpDecaySampleType:
+		return NewAdaptiveExpDecaySample(c.MinSize, c.Size, c.Alpha)
+	case SlidingTimeWindowSampleType:
+		return NewSlidingTimeWindowSample(c.Window)
+	}
+	panic(fmt.Sprintf("metrics: unknown sample type %d", c.Type))
 }
 
 // ExpDecaySample is an exponentially-decaying sample using a forward-decaying
 // priority reservoir.  See Cormode et al's "Forward Decay: A Practical Time
-// Decay Model for Streaming Systems".
+// Decay Model for Streaming Systems".  It accepts any int64 value, negative
+// or not; see SampleMean and SampleSum for how extreme values affect the
+// statistics computed from it.
 //
 // <http://www.research.att.com/people/Cormode_Graham/library/publications/CormodeShkapenyukSrivastavaXu09.pdf>
 type ExpDecaySample struct {
-	alpha         float64
-	count         int64
-	mutex         sync.Mutex
-	reservoirSize int
-	t0, t1        time.Time
-	values        *expDecaySampleHeap
+	alpha            float64
+	count            int64
+	minSize, maxSize int
+	mutex            sync.Mutex
+	rand             Rand
+	reservoirSize    int
+	shared           bool  // values' slice is referred to by a snapshot
+	sum              int64 // of every value recorded, like count
+	t0, t1, t2       time.Time
+	updates          int
+	values           *expDecaySampleHeap
 }
 
 // NewExpDecaySample constructs a new exponentially-decaying sample with the
-// given reservoir size and alpha.
+// given reservoir size and alpha.  It draws random numbers from a Rand of its
+// own so that samples updated concurrently don't contend for math/rand's
+// shared source.
 func NewExpDecaySample(reservoirSize int, alpha float64) Sample {
-	if UseNilMetrics {
+	return NewExpDecaySampleWithRand(reservoirSize, alpha, newRand())
+}
+
+// NewAdaptiveExpDecaySample constructs a new exponentially-decaying sample
+// with the given alpha whose reservoir size adapts to its update rate.  The
+// reservoir starts at minSize values, at least one, and doubles, up to
+// maxSize, whenever more updates than it holds arrive before it next adapts.
+// On the first update after each minute it's resized to the number of
+// updates per minute since it last adapted, shrinking the reservoirs of
+// rarely-updated samples to minSize while hot ones keep maxSize and with it
+// the accuracy of their percentiles.
+func NewAdaptiveExpDecaySample(minSize, maxSize int, alpha float64) Sample {
+	if metricsDisabled || UseNilMetrics {
+		return NilSample{}
+	}
+	if minSize < 1 {
+		minSize = 1
+	}
+	if maxSize < minSize {
+		maxSize = minSize
+	}
+	s := NewExpDecaySampleWithRand(minSize, alpha, newRand()).(*ExpDecaySample)
+	s.minSize, s.maxSize = minSize, maxSize
+	s.t2 = s.t0.Add(adaptInterval)
+	return s
+}
+
+// NewExpDecaySampleWithRand constructs a new exponentially-decaying sample
+// with the given reservoir size and alpha which draws random numbers from r,
+// so that a seeded r makes the sample's contents reproducible.
+func NewExpDecaySampleWithRand(reservoirSize int, alpha float64, r Rand) Sample {
+	if metricsDisabled || UseNilMetrics {
 		return NilSample{}
 	}
 	s := &ExpDecaySample{
 		alpha:         alpha,
+		rand:          r,
 		reservoirSize: reservoirSize,
 		t0:            time.Now(),
 		values:        newExpDecaySampleHeap(reservoirSize),
@@ -64,9 +183,17 @@ func (s *ExpDecaySample) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.count = 0
+	s.sum = 0
 	s.t0 = time.Now()
 	s.t1 = s.t0.Add(rescaleThreshold)
-	s.values.Clear()
+	s.t2 = s.t0.Add(adaptInterval)
+	s.updates = 0
+	if s.shared {
+		s.values.s = make([]expDecaySample, 0, cap(s.values.s))
+		s.shared = false
+	} else {
+		s.values.Clear()
+	}
 }
 
 // Count returns the number of samples recorded, which may exceed the
@@ -112,18 +239,18 @@ func (s *ExpDecaySample) Size() int {
 	return s.values.Size()
 }
 
-// Snapshot returns a read-only copy of the sample.
+// Snapshot returns a read-only copy of the sample.  Taking it is O(1): the
+// snapshot shares the sample's reservoir, which the sample copies before it
+// next changes, and extracts and sorts its values only once they're read,
+// without holding the sample's lock.
 func (s *ExpDecaySample) Snapshot() Sample {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	vals := s.values.Values()
-	values := make([]int64, len(vals))
-	for i, v := range vals {
-		values[i] = v.v
-	}
+	s.shared = true
 	return &SampleSnapshot{
-		count:  s.count,
-		values: values,
+		count: s.count,
+		heap:  s.values.Values(),
+		sum:   s.sum,
 	}
 }
 
@@ -137,16 +264,37 @@ func (s *ExpDecaySample) Sum() int64 {
 	return SampleSum(s.Values())
 }
 
+// totalSum returns the sum of every value recorded since the sample was
+// last cleared.
+func (s *ExpDecaySample) totalSum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
 // Update samples a new value.
 func (s *ExpDecaySample) Update(v int64) {
 	s.update(time.Now(), v)
 }
 
+// UpdateWeighted samples a new value which stands for weight observations,
+// making it proportionally more likely to be retained.  Count grows by the
+// weight rounded to the nearest integer.  Weights only influence which values
+// are retained once the reservoir is full and non-positive weights are
+// ignored.
+func (s *ExpDecaySample) UpdateWeighted(v int64, weight float64) {
+	if !validWeight(weight) {
+		return
+	}
+	s.updateWeighted(time.Now(), v, weight)
+}
+
 // Values returns a copy of the values in the sample.
 func (s *ExpDecaySample) Values() []int64 {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	s.shared = true
 	vals := s.values.Values()
+	s.mutex.Unlock()
 	values := make([]int64, len(vals))
 	for i, v := range vals {
 		values[i] = v.v
@@ -162,14 +310,32 @@ func (s *ExpDecaySample) Variance() float64 {
 // update samples a new value at a particular timestamp.  This is a method all
 // its own to facilitate testing.
 func (s *ExpDecaySample) update(t time.Time, v int64) {
+	s.updateWeighted(t, v, 1)
+}
+
+// updateWeighted samples a new value with the given weight at a particular
+// timestamp.  A value's priority is its weight times its forward-decay
+// weight divided by a random number, which makes the reservoir a weighted
+// sample.  Priorities are kept as logarithms: the forward-decay weight
+// exp(alpha*(t-t0)) overflows float64 once alpha*(t-t0) exceeds about 709,
+// which happens within a rescale interval for large alphas or after a long
+// idle period, and a random number of exactly zero would otherwise divide by
+// zero.  Neither the priority nor its rescaling depends on the value itself,
+// so every int64, negative or not, is equally supported.
+func (s *ExpDecaySample) updateWeighted(t time.Time, v int64, weight float64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.count++
+	s.unshare()
+	s.count += weightCount(weight)
+	s.sum += v * weightCount(weight)
+	if 0 < s.maxSize {
+		s.adapt(t)
+	}
 	if s.values.Size() == s.reservoirSize {
 		s.values.Pop()
 	}
 	s.values.Push(expDecaySample{
-		k: math.Exp(t.Sub(s.t0).Seconds()*s.alpha) / rand.Float64(),
+		k: t.Sub(s.t0).Seconds()*s.alpha + math.Log(weight) - math.Log(s.rand.Float64()),
 		v: v,
 	})
 	if t.After(s.t1) {
@@ -179,12 +345,53 @@ func (s *ExpDecaySample) update(t time.Time, v int64) {
 		s.t0 = t
 		s.t1 = s.t0.Add(rescaleThreshold)
 		for _, v := range values {
-			v.k = v.k * math.Exp(-s.alpha*s.t0.Sub(t0).Seconds())
+			v.k -= s.alpha * s.t0.Sub(t0).Seconds()
 			s.values.Push(v)
 		}
 	}
 }
 
+// unshare copies the reservoir if a snapshot shares it, so that the
+// snapshot is unaffected by the change about to be made.  It must be called
+// with s.mutex held.
+func (s *ExpDecaySample) unshare() {
+	if s.shared {
+		values := make([]expDecaySample, len(s.values.s), cap(s.values.s))
+		copy(values, s.values.s)
+		s.values.s = values
+		s.shared = false
+	}
+}
+
+// adapt counts an update at a particular timestamp towards the update rate
+// of an adaptive sample and resizes its reservoir accordingly.
+func (s *ExpDecaySample) adapt(t time.Time) {
+	s.updates++
+	if t.After(s.t2) {
+		elapsed := t.Sub(s.t2) + adaptInterval
+		s.resize(int(float64(s.updates) * float64(adaptInterval) / float64(elapsed)))
+		s.t2 = t.Add(adaptInterval)
+		s.updates = 0
+	} else if s.reservoirSize < s.updates && s.reservoirSize < s.maxSize {
+		s.resize(2 * s.reservoirSize)
+	}
+}
+
+// resize changes the reservoir size of an adaptive sample, bounded by its
+// minimum and maximum, discarding the lowest-priority values if it shrinks.
+func (s *ExpDecaySample) resize(reservoirSize int) {
+	if reservoirSize < s.minSize {
+		reservoirSize = s.minSize
+	}
+	if s.maxSize < reservoirSize {
+		reservoirSize = s.maxSize
+	}
+	if reservoirSize != s.reservoirSize {
+		s.reservoirSize = reservoirSize
+		s.values.Resize(reservoirSize)
+	}
+}
+
 // NilSample is a no-op Sample.
 type NilSample struct{}
 
@@ -226,6 +433,9 @@ func (NilSample) Sum() int64 { return 0 }
 // Update is a no-op.
 func (NilSample) Update(v int64) {}
 
+// UpdateWeighted is a no-op.
+func (NilSample) UpdateWeighted(v int64, weight float64) {}
+
 // Values is a no-op.
 func (NilSample) Values() []int64 { return []int64{} }
 
@@ -246,12 +456,18 @@ func SampleMax(values []int64) int64 {
 	return max
 }
 
-// SampleMean returns the mean value of the slice of int64.
+// SampleMean returns the mean value of the slice of int64.  It is summed in
+// float64 so that it remains approximately correct for values whose sum
+// overflows int64.
 func SampleMean(values []int64) float64 {
 	if 0 == len(values) {
 		return 0.0
 	}
-	return float64(SampleSum(values)) / float64(len(values))
+	var sum float64
+	for _, v := range values {
+		sum += float64(v)
+	}
+	return sum / float64(len(values))
 }
 
 // SampleMin returns the minimum value of the slice of int64.
@@ -274,23 +490,104 @@ func SamplePercentile(values int64Slice, p float64) float64 {
 }
 
 // SamplePercentiles returns a slice of arbitrary percentiles of the slice of
-// int64.
+// int64, interpolated as DefaultInterpolation selects.
 func SamplePercentiles(values int64Slice, ps []float64) []float64 {
+	return SamplePercentilesInterpolated(values, ps, DefaultInterpolation)
+}
+
+// SamplePercentilesInterpolated returns a slice of arbitrary percentiles of
+// the slice of int64, interpolated as the given Interpolation selects.
+func SamplePercentilesInterpolated(values int64Slice, ps []float64, interpolation Interpolation) []float64 {
+	sort.Sort(values)
+	return interpolation.percentiles(values, ps)
+}
+
+// sortedPercentiles returns a slice of arbitrary percentiles of a sorted
+// slice of int64, interpolated as DefaultInterpolation selects.
+func sortedPercentiles(values []int64, ps []float64) []float64 {
+	return DefaultInterpolation.percentiles(values, ps)
+}
+
+// Interpolation selects how a percentile which falls between two of a
+// sample's values is computed.  Definitions differ between languages and
+// libraries, so dashboards comparing percentiles computed elsewhere should
+// select the same one.
+type Interpolation int
+
+const (
+	// WeibullInterpolation interpolates linearly at position p(n+1), the
+	// Weibull plotting position and Hyndman and Fan's definition 6, as this
+	// package always has.  It's the default.
+	WeibullInterpolation Interpolation = iota
+
+	// NearestRankInterpolation doesn't interpolate: the percentile is the
+	// smallest value which at least the fraction p of the values don't
+	// exceed, so it's always a value actually observed.
+	NearestRankInterpolation
+
+	// LinearInterpolation interpolates linearly at position p(n-1)+1,
+	// Hyndman and Fan's definition 7, as do NumPy, R, and Excel's
+	// PERCENTILE.INC by default.
+	LinearInterpolation
+
+	// HazenInterpolation interpolates linearly at position pn+1/2, Hazen's
+	// plotting position and Hyndman and Fan's definition 5.
+	HazenInterpolation
+)
+
+// DefaultInterpolation is how samples interpolate their percentiles.  Set it
+// before any percentiles are computed.
+var DefaultInterpolation = WeibullInterpolation
+
+var interpolationNames = [...]string{
+	WeibullInterpolation:     "weibull",
+	NearestRankInterpolation: "nearest-rank",
+	LinearInterpolation:      "linear",
+	HazenInterpolation:       "hazen",
+}
+
+func (i Interpolation) String() string {
+	if 0 <= i && int(i) < len(interpolationNames) {
+		return interpolationNames[i]
+	}
+	return fmt.Sprintf("Interpolation(%d)", int(i))
+}
+
+// percentiles returns a slice of arbitrary percentiles of a sorted slice of
+// int64.
+func (i Interpolation) percentiles(values []int64, ps []float64) []float64 {
 	scores := make([]float64, len(ps))
 	size := len(values)
-	if size > 0 {
-		sort.Sort(values)
-		for i, p := range ps {
-			pos := p * float64(size+1)
-			if pos < 1.0 {
-				scores[i] = float64(values[0])
-			} else if pos >= float64(size) {
-				scores[i] = float64(values[size-1])
-			} else {
-				lower := float64(values[int(pos)-1])
-				upper := float64(values[int(pos)])
-				scores[i] = lower + (pos-math.Floor(pos))*(upper-lower)
+	if 0 == size {
+		return scores
+	}
+	for j, p := range ps {
+		var pos float64 // One-based
+		switch i {
+		case NearestRankInterpolation:
+			rank := int(math.Ceil(p * float64(size)))
+			if rank < 1 {
+				rank = 1
+			} else if rank > size {
+				rank = size
 			}
+			scores[j] = float64(values[rank-1])
+			continue
+		case LinearInterpolation:
+			pos = p*float64(size-1) + 1
+		case HazenInterpolation:
+			pos = p*float64(size) + 0.5
+		default:
+			pos = p * float64(size+1)
+		}
+		if pos < 1.0 {
+			scores[j] = float64(values[0])
+		} else if pos >= float64(size) {
+			scores[j] = float64(values[size-1])
+		} else {
+			lower := float64(values[int(pos)-1])
+			upper := float64(values[int(pos)])
+			scores[j] = lower + (pos-math.Floor(pos))*(upper-lower)
 		}
 	}
 	return scores
@@ -298,8 +595,13 @@ func SamplePercentiles(values int64Slice, ps []float64) []float64 {
 
 // SampleSnapshot is a read-only copy of another Sample.
 type SampleSnapshot struct {
-	count  int64
-	values []int64
+	count        int64
+	heap         []expDecaySample // shared with an ExpDecaySample
+	loaded       sync.Once
+	sorted       sync.Once
+	sum          int64
+	values       []int64
+	sortedValues []int64
 }
 
 // Clear panics.
@@ -310,61 +612,112 @@ func (*SampleSnapshot) Clear() {
 // Count returns the count of inputs at the time the snapshot was taken.
 func (s *SampleSnapshot) Count() int64 { return s.count }
 
+// GoString formats the statistics of the snapshot for %#v.
+func (s *SampleSnapshot) GoString() string { return goString("SampleSnapshot", sampleString(s)) }
+
 // Max returns the maximal value at the time the snapshot was taken.
-func (s *SampleSnapshot) Max() int64 { return SampleMax(s.values) }
+func (s *SampleSnapshot) Max() int64 { return SampleMax(s.load()) }
 
 // Mean returns the mean value at the time the snapshot was taken.
-func (s *SampleSnapshot) Mean() float64 { return SampleMean(s.values) }
+func (s *SampleSnapshot) Mean() float64 { return SampleMean(s.load()) }
 
 // Min returns the minimal value at the time the snapshot was taken.
-func (s *SampleSnapshot) Min() int64 { return SampleMin(s.values) }
+func (s *SampleSnapshot) Min() int64 { return SampleMin(s.load()) }
 
 // Percentile returns an arbitrary percentile of values at the time the
 // snapshot was taken.
 func (s *SampleSnapshot) Percentile(p float64) float64 {
-	return SamplePercentile(s.values, p)
+	return s.Percentiles([]float64{p})[0]
 }
 
 // Percentiles returns a slice of arbitrary percentiles of values at the time
 // the snapshot was taken.
 func (s *SampleSnapshot) Percentiles(ps []float64) []float64 {
-	return SamplePercentiles(s.values, ps)
+	return sortedPercentiles(s.sort(), ps)
 }
 
 // Size returns the size of the sample at the time the snapshot was taken.
-func (s *SampleSnapshot) Size() int { return len(s.values) }
+func (s *SampleSnapshot) Size() int {
+	if nil != s.heap {
+		return len(s.heap)
+	}
+	return len(s.values)
+}
 
 // Snapshot returns the snapshot.
 func (s *SampleSnapshot) Snapshot() Sample { return s }
 
 // StdDev returns the standard deviation of values at the time the snapshot was
 // taken.
-func (s *SampleSnapshot) StdDev() float64 { return SampleStdDev(s.values) }
+func (s *SampleSnapshot) StdDev() float64 { return SampleStdDev(s.load()) }
+
+// String formats the statistics of the snapshot for debugging.
+func (s *SampleSnapshot) String() string { return sampleString(s) }
 
 // Sum returns the sum of values at the time the snapshot was taken.
-func (s *SampleSnapshot) Sum() int64 { return SampleSum(s.values) }
+func (s *SampleSnapshot) Sum() int64 { return SampleSum(s.load()) }
+
+// totalSum returns the sum of every value recorded at the time the snapshot
+// was taken.
+func (s *SampleSnapshot) totalSum() int64 { return s.sum }
 
 // Update panics.
 func (*SampleSnapshot) Update(int64) {
 	panic("Update called on a SampleSnapshot")
 }
 
+// UpdateWeighted panics.
+func (*SampleSnapshot) UpdateWeighted(int64, float64) {
+	panic("UpdateWeighted called on a SampleSnapshot")
+}
+
 // Values returns a copy of the values in the sample.
 func (s *SampleSnapshot) Values() []int64 {
-	values := make([]int64, len(s.values))
-	copy(values, s.values)
+	loaded := s.load()
+	values := make([]int64, len(loaded))
+	copy(values, loaded)
 	return values
 }
 
 // Variance returns the variance of values at the time the snapshot was taken.
-func (s *SampleSnapshot) Variance() float64 { return SampleVariance(s.values) }
+func (s *SampleSnapshot) Variance() float64 { return SampleVariance(s.load()) }
+
+// load returns the snapshot's values, first extracting them if the snapshot
+// shares the reservoir of an ExpDecaySample.
+func (s *SampleSnapshot) load() []int64 {
+	s.loaded.Do(func() {
+		if nil == s.heap {
+			return
+		}
+		values := make([]int64, len(s.heap))
+		for i, v := range s.heap {
+			values[i] = v.v
+		}
+		s.values = values
+	})
+	return s.values
+}
+
+// sort returns a sorted copy of the snapshot's values, sorting them the first
+// time it's called so that percentiles are computed without sorting again
+// and without disturbing the order of the values.
+func (s *SampleSnapshot) sort() []int64 {
+	s.sorted.Do(func() {
+		values := make([]int64, len(s.load()))
+		copy(values, s.values)
+		sort.Sort(int64Slice(values))
+		s.sortedValues = values
+	})
+	return s.sortedValues
+}
 
 // SampleStdDev returns the standard deviation of the slice of int64.
 func SampleStdDev(values []int64) float64 {
 	return math.Sqrt(SampleVariance(values))
 }
 
-// SampleSum returns the sum of the slice of int64.
+// SampleSum returns the sum of the slice of int64, which wraps around if it
+// overflows.
 func SampleSum(values []int64) int64 {
 	var sum int64
 	for _, v := range values {
@@ -387,23 +740,39 @@ func SampleVariance(values []int64) float64 {
 	return sum / float64(len(values))
 }
 
+// uniformSampleEncodingVersion is the first byte of a UniformSample encoded
+// by MarshalBinary.  Version 1 lacked the sum of every value recorded.
+const uniformSampleEncodingVersion = 2
+
 // A uniform sample using Vitter's Algorithm R.
 //
 // <http://www.cs.umd.edu/~samir/498/vitter.pdf>
 type UniformSample struct {
 	count         int64
 	mutex         sync.Mutex
+	rand          Rand
 	reservoirSize int
+	sum           int64 // of every value recorded, like count
 	values        []int64
+	weight        float64
 }
 
 // NewUniformSample constructs a new uniform sample with the given reservoir
-// size.
+// size.  It draws random numbers from a Rand of its own so that samples
+// updated concurrently don't contend for math/rand's shared source.
 func NewUniformSample(reservoirSize int) Sample {
-	if UseNilMetrics {
+	return NewUniformSampleWithRand(reservoirSize, newRand())
+}
+
+// NewUniformSampleWithRand constructs a new uniform sample with the given
+// reservoir size which draws random numbers from r, so that a seeded r makes
+// the sample's contents reproducible.
+func NewUniformSampleWithRand(reservoirSize int, r Rand) Sample {
+	if metricsDisabled || UseNilMetrics {
 		return NilSample{}
 	}
 	return &UniformSample{
+		rand:          r,
 		reservoirSize: reservoirSize,
 		values:        make([]int64, 0, reservoirSize),
 	}
@@ -414,7 +783,9 @@ func (s *UniformSample) Clear() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.count = 0
+	s.sum = 0
 	s.values = make([]int64, 0, s.reservoirSize)
+	s.weight = 0
 }
 
 // Count returns the number of samples recorded, which may exceed the
@@ -425,6 +796,23 @@ func (s *UniformSample) Count() int64 {
 	return s.count
 }
 
+// MarshalBinary encodes the sample's count, sum, and values so that it can be
+// checkpointed and restored by UnmarshalBinary.
+func (s *UniformSample) MarshalBinary() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	buf := make([]byte, 1, 1+4*binary.MaxVarintLen64+len(s.values)*binary.MaxVarintLen64)
+	buf[0] = uniformSampleEncodingVersion
+	buf = binary.AppendVarint(buf, s.count)
+	buf = binary.AppendVarint(buf, s.sum)
+	buf = binary.AppendUvarint(buf, math.Float64bits(s.weight))
+	buf = binary.AppendUvarint(buf, uint64(len(s.values)))
+	for _, v := range s.values {
+		buf = binary.AppendVarint(buf, v)
+	}
+	return buf, nil
+}
+
 // Max returns the maximum value in the sample, which may not be the maximum
 // value ever to be part of the sample.
 func (s *UniformSample) Max() int64 {
@@ -478,6 +866,7 @@ func (s *UniformSample) Snapshot() Sample {
 	copy(values, s.values)
 	return &SampleSnapshot{
 		count:  s.count,
+		sum:    s.sum,
 		values: values,
 	}
 }
@@ -496,21 +885,108 @@ func (s *UniformSample) Sum() int64 {
 	return SampleSum(s.values)
 }
 
+// UnmarshalBinary replaces the sample's count, sum, and values with those encoded
+// by MarshalBinary.  Values beyond the sample's reservoir size are dropped.
+// The sum of every value recorded, which the first version of the encoding
+// lacked, is estimated from the values' mean.
+func (s *UniformSample) UnmarshalBinary(data []byte) error {
+	if 0 == len(data) || data[0] < 1 || uniformSampleEncodingVersion < data[0] {
+		return errors.New("metrics: unknown UniformSample encoding")
+	}
+	version := data[0]
+	data = data[1:]
+	errTruncated := errors.New("metrics: truncated UniformSample encoding")
+	count, n := binary.Varint(data)
+	if n <= 0 {
+		return errTruncated
+	}
+	data = data[n:]
+	var sum int64
+	if 1 < version {
+		if sum, n = binary.Varint(data); n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+	}
+	weight, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errTruncated
+	}
+	data = data[n:]
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errTruncated
+	}
+	data = data[n:]
+	values := make([]int64, 0, s.reservoirSize)
+	for i := uint64(0); i < size; i++ {
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		if len(values) < s.reservoirSize {
+			values = append(values, v)
+		}
+	}
+	if 1 == version {
+		sum = int64(math.Floor(SampleMean(values)*float64(count) + 0.5))
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count, s.sum, s.values, s.weight = count, sum, values, math.Float64frombits(weight)
+	return nil
+}
+
+// totalSum returns the sum of every value recorded since the sample was
+// last cleared.
+func (s *UniformSample) totalSum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
 // Update samples a new value.
 func (s *UniformSample) Update(v int64) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.count++
+	s.sum += v
+	s.weight++
 	if len(s.values) < s.reservoirSize {
 		s.values = append(s.values, v)
 	} else {
-		r := rand.Int63n(s.count)
+		r := s.rand.Int63n(int64(math.Ceil(s.weight)))
 		if r < int64(len(s.values)) {
 			s.values[int(r)] = v
 		}
 	}
 }
 
+// UpdateWeighted samples a new value which stands for weight observations
+// using Chao's weighted extension of Algorithm R, in which a value replaces
+// one in the full reservoir with probability proportional to its weight.
+// Count grows by the weight rounded to the nearest integer.  Weights only
+// influence which values are retained once the reservoir is full and
+// non-positive weights are ignored.
+//
+// <http://www.jstor.org/stable/2336002>
+func (s *UniformSample) UpdateWeighted(v int64, weight float64) {
+	if !validWeight(weight) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count += weightCount(weight)
+	s.sum += v * weightCount(weight)
+	s.weight += weight
+	if len(s.values) < s.reservoirSize {
+		s.values = append(s.values, v)
+	} else if s.rand.Float64()*s.weight < float64(len(s.values))*weight {
+		s.values[s.rand.Intn(len(s.values))] = v
+	}
+}
+
 // Values returns a copy of the values in the sample.
 func (s *UniformSample) Values() []int64 {
 	s.mutex.Lock()
@@ -527,7 +1003,391 @@ func (s *UniformSample) Variance() float64 {
 	return SampleVariance(s.values)
 }
 
-// expDecaySample represents an individual sample in a heap.
+// SlidingWindowSample retains the most recent values in a stream, so unlike
+// the randomized samples its statistics describe exactly the last
+// reservoirSize updates.
+type SlidingWindowSample struct {
+	count         int64
+	mutex         sync.Mutex
+	next          int
+	reservoirSize int
+	sum           int64 // of every value recorded, like count
+	values        []int64
+}
+
+// NewSlidingWindowSample constructs a new sliding window sample which
+// retains the given number of most recent values.
+func NewSlidingWindowSample(reservoirSize int) Sample {
+	if metricsDisabled || UseNilMetrics {
+		return NilSample{}
+	}
+	return &SlidingWindowSample{
+		reservoirSize: reservoirSize,
+		values:        make([]int64, 0, reservoirSize),
+	}
+}
+
+// Clear clears all samples.
+func (s *SlidingWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count = 0
+	s.next = 0
+	s.sum = 0
+	s.values = make([]int64, 0, s.reservoirSize)
+}
+
+// Count returns the number of samples recorded, which may exceed the
+// reservoir size.
+func (s *SlidingWindowSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value in the sample, which may not be the maximum
+// value ever to be part of the sample.
+func (s *SlidingWindowSample) Max() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMax(s.values)
+}
+
+// Mean returns the mean of the values in the sample.
+func (s *SlidingWindowSample) Mean() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMean(s.values)
+}
+
+// Min returns the minimum value in the sample, which may not be the minimum
+// value ever to be part of the sample.
+func (s *SlidingWindowSample) Min() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleMin(s.values)
+}
+
+// Percentile returns an arbitrary percentile of values in the sample.
+func (s *SlidingWindowSample) Percentile(p float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentile(s.values, p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// sample.
+func (s *SlidingWindowSample) Percentiles(ps []float64) []float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SamplePercentiles(s.values, ps)
+}
+
+// Size returns the size of the sample, which is at most the reservoir size.
+func (s *SlidingWindowSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.values)
+}
+
+// Snapshot returns a read-only copy of the sample.
+func (s *SlidingWindowSample) Snapshot() Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := make([]int64, len(s.values))
+	copy(values, s.values)
+	return &SampleSnapshot{
+		count:  s.count,
+		sum:    s.sum,
+		values: values,
+	}
+}
+
+// StdDev returns the standard deviation of the values in the sample.
+func (s *SlidingWindowSample) StdDev() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleStdDev(s.values)
+}
+
+// Sum returns the sum of the values in the sample.
+func (s *SlidingWindowSample) Sum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleSum(s.values)
+}
+
+// totalSum returns the sum of every value recorded since the sample was
+// last cleared.
+func (s *SlidingWindowSample) totalSum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
+// Update samples a new value, displacing the oldest once the reservoir is
+// full.
+func (s *SlidingWindowSample) Update(v int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+	s.sum += v
+	s.update(v)
+}
+
+// UpdateWeighted samples a new value which stands for weight observations.
+// Count grows by the weight rounded to the nearest integer but the value
+// occupies a single place in the window.  Non-positive weights are ignored.
+func (s *SlidingWindowSample) UpdateWeighted(v int64, weight float64) {
+	if !validWeight(weight) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count += weightCount(weight)
+	s.sum += v * weightCount(weight)
+	s.update(v)
+}
+
+// Values returns a copy of the values in the sample, oldest first.
+func (s *SlidingWindowSample) Values() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := make([]int64, 0, len(s.values))
+	values = append(values, s.values[s.next:]...)
+	return append(values, s.values[:s.next]...)
+}
+
+// Variance returns the variance of the values in the sample.
+func (s *SlidingWindowSample) Variance() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return SampleVariance(s.values)
+}
+
+func (s *SlidingWindowSample) update(v int64) {
+	if 0 == s.reservoirSize {
+		return
+	}
+	if len(s.values) < s.reservoirSize {
+		s.values = append(s.values, v)
+		return
+	}
+	s.values[s.next] = v
+	s.next = (s.next + 1) % s.reservoirSize
+}
+
+// minSlidingTimeWindow is the capacity below which a SlidingTimeWindowSample
+// doesn't shrink its ring.
+const minSlidingTimeWindow = 16
+
+// SlidingTimeWindowSample retains every value recorded in the last window of
+// time, such as the last minute, so unlike an ExpDecaySample, whose
+// reservoir holds an outlier until it's displaced, its statistics describe
+// exactly the recent values and forget an outlier once it's older than the
+// window.  Its values are held in a ring which grows as the rate of updates
+// does and shrinks again once they've expired, so its memory is proportional
+// to the number of values recorded in a window.  Expired values are pruned
+// as values are recorded and as the sample is read or snapshotted.
+type SlidingTimeWindowSample struct {
+	count  int64
+	head   int // the index of the oldest value in the ring
+	mutex  sync.Mutex
+	n      int     // the number of values in the ring
+	sum    int64   // of every value recorded, like count
+	times  []int64 // when each value in the ring was recorded, in Unix nanoseconds
+	values []int64
+	window time.Duration
+}
+
+// NewSlidingTimeWindowSample constructs a new sliding time window sample
+// which retains the values recorded in the last window of time.
+func NewSlidingTimeWindowSample(window time.Duration) Sample {
+	if metricsDisabled || UseNilMetrics {
+		return NilSample{}
+	}
+	return &SlidingTimeWindowSample{window: window}
+}
+
+// Clear clears all samples.
+func (s *SlidingTimeWindowSample) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count, s.head, s.n, s.sum = 0, 0, 0, 0
+	s.times, s.values = nil, nil
+}
+
+// Count returns the number of samples recorded, which may exceed the number
+// in the window.
+func (s *SlidingTimeWindowSample) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value in the window.
+func (s *SlidingTimeWindowSample) Max() int64 {
+	return SampleMax(s.load(time.Now()))
+}
+
+// Mean returns the mean of the values in the window.
+func (s *SlidingTimeWindowSample) Mean() float64 {
+	return SampleMean(s.load(time.Now()))
+}
+
+// Min returns the minimum value in the window.
+func (s *SlidingTimeWindowSample) Min() int64 {
+	return SampleMin(s.load(time.Now()))
+}
+
+// Percentile returns an arbitrary percentile of values in the window.
+func (s *SlidingTimeWindowSample) Percentile(p float64) float64 {
+	return SamplePercentile(s.load(time.Now()), p)
+}
+
+// Percentiles returns a slice of arbitrary percentiles of values in the
+// window.
+func (s *SlidingTimeWindowSample) Percentiles(ps []float64) []float64 {
+	return SamplePercentiles(s.load(time.Now()), ps)
+}
+
+// Size returns the number of values in the window.
+func (s *SlidingTimeWindowSample) Size() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune(time.Now())
+	return s.n
+}
+
+// Snapshot returns a read-only copy of the values in the window.
+func (s *SlidingTimeWindowSample) Snapshot() Sample {
+	return s.snapshot(time.Now())
+}
+
+// StdDev returns the standard deviation of the values in the window.
+func (s *SlidingTimeWindowSample) StdDev() float64 {
+	return SampleStdDev(s.load(time.Now()))
+}
+
+// Sum returns the sum of the values in the window.
+func (s *SlidingTimeWindowSample) Sum() int64 {
+	return SampleSum(s.load(time.Now()))
+}
+
+// totalSum returns the sum of every value recorded since the sample was
+// last cleared.
+func (s *SlidingTimeWindowSample) totalSum() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
+// Update samples a new value.
+func (s *SlidingTimeWindowSample) Update(v int64) {
+	s.update(time.Now(), v, 1)
+}
+
+// UpdateWeighted samples a new value which stands for weight observations.
+// Count grows by the weight rounded to the nearest integer but the value
+// occupies a single place in the window.  Non-positive weights are ignored.
+func (s *SlidingTimeWindowSample) UpdateWeighted(v int64, weight float64) {
+	if !validWeight(weight) {
+		return
+	}
+	s.update(time.Now(), v, weightCount(weight))
+}
+
+// Values returns a copy of the values in the window, oldest first.
+func (s *SlidingTimeWindowSample) Values() []int64 {
+	return s.load(time.Now())
+}
+
+// Variance returns the variance of the values in the window.
+func (s *SlidingTimeWindowSample) Variance() float64 {
+	return SampleVariance(s.load(time.Now()))
+}
+
+// load returns a copy of the values in the window ending at the given time,
+// oldest first.
+func (s *SlidingTimeWindowSample) load(t time.Time) []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune(t)
+	return s.ordered()
+}
+
+// ordered returns a copy of the values in the ring, oldest first.  It must be
+// called with s.mutex held.
+func (s *SlidingTimeWindowSample) ordered() []int64 {
+	values := make([]int64, s.n)
+	for i := range values {
+		values[i] = s.values[(s.head+i)%len(s.values)]
+	}
+	return values
+}
+
+// prune drops the values older than the window ending at the given time and
+// shrinks the ring if it's mostly empty.  It must be called with s.mutex
+// held.
+func (s *SlidingTimeWindowSample) prune(t time.Time) {
+	cutoff := t.UnixNano() - int64(s.window)
+	for 0 < s.n && s.times[s.head] <= cutoff {
+		s.head = (s.head + 1) % len(s.values)
+		s.n--
+	}
+	size := len(s.values)
+	for minSlidingTimeWindow < size && s.n < size/4 {
+		size /= 2
+	}
+	if size != len(s.values) {
+		s.resize(size)
+	}
+}
+
+// resize moves the ring to slices of the given capacity, oldest first.  It
+// must be called with s.mutex held.
+func (s *SlidingTimeWindowSample) resize(size int) {
+	times, values := make([]int64, size), make([]int64, size)
+	for i := 0; i < s.n; i++ {
+		j := (s.head + i) % len(s.values)
+		times[i], values[i] = s.times[j], s.values[j]
+	}
+	s.head, s.times, s.values = 0, times, values
+}
+
+// snapshot returns a read-only copy of the values in the window ending at
+// the given time.
+func (s *SlidingTimeWindowSample) snapshot(t time.Time) Sample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.prune(t)
+	return &SampleSnapshot{
+		count:  s.count,
+		sum:    s.sum,
+		values: s.ordered(),
+	}
+}
+
+// update samples a new value, standing for n observations, at the given
+// time.
+func (s *SlidingTimeWindowSample) update(t time.Time, v int64, n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count += n
+	s.sum += v * n
+	s.prune(t)
+	if 0 == len(s.values) {
+		s.resize(minSlidingTimeWindow)
+	} else if s.n == len(s.values) {
+		s.resize(2 * len(s.values))
+	}
+	i := (s.head + s.n) % len(s.values)
+	s.times[i], s.values[i] = t.UnixNano(), v
+	s.n++
+}
+
+// expDecaySample represents an individual sample in a heap.  Its priority k
+// is a natural logarithm.
 type expDecaySample struct {
 	k float64
 	v int64
@@ -565,6 +1425,17 @@ func (h *expDecaySampleHeap) Pop() expDecaySample {
 	return s
 }
 
+// Resize pops the lowest-priority samples until at most reservoirSize
+// remain and reallocates the heap to hold exactly reservoirSize.
+func (h *expDecaySampleHeap) Resize(reservoirSize int) {
+	for len(h.s) > reservoirSize {
+		h.Pop()
+	}
+	s := make([]expDecaySample, len(h.s), reservoirSize)
+	copy(s, h.s)
+	h.s = s
+}
+
 func (h *expDecaySampleHeap) Size() int {
 	return len(h.s)
 }
@@ -607,3 +1478,13 @@ type int64Slice []int64
 func (p int64Slice) Len() int           { return len(p) }
 func (p int64Slice) Less(i, j int) bool { return p[i] < p[j] }
 func (p int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// validWeight reports whether weight is positive and finite.
+func validWeight(weight float64) bool {
+	return 0 < weight && !math.IsInf(weight, 1)
+}
+
+// weightCount returns the number of observations a weight stands for.
+func weightCount(weight float64) int64 {
+	return int64(math.Floor(weight + 0.5))
+}
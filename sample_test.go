@@ -1,9 +1,15 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
 import (
+	"math"
 	"math/rand"
 	"runtime"
+	"sort"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -66,6 +72,35 @@ func BenchmarkExpDecaySample1028(b *testing.B) {
 	benchmarkSample(b, NewExpDecaySample(1028, 0.015))
 }
 
+// BenchmarkExpDecaySampleContention measures updates made concurrently with
+// a reader taking snapshots and computing their percentiles, as a reporter
+// does.
+func BenchmarkExpDecaySampleContention(b *testing.B) {
+	s := NewExpDecaySample(1028, 0.015)
+	for i := 0; i < 1028; i++ {
+		s.Update(int64(i))
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				s.Snapshot().Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := int64(0); pb.Next(); i++ {
+			s.Update(i)
+		}
+	})
+	b.StopTimer()
+	close(done)
+}
+
 func BenchmarkUniformSample257(b *testing.B) {
 	benchmarkSample(b, NewUniformSample(257))
 }
@@ -78,9 +113,12 @@ func BenchmarkUniformSample1028(b *testing.B) {
 	benchmarkSample(b, NewUniformSample(1028))
 }
 
+func BenchmarkSlidingWindowSample1028(b *testing.B) {
+	benchmarkSample(b, NewSlidingWindowSample(1028))
+}
+
 func TestExpDecaySample10(t *testing.T) {
-	rand.Seed(1)
-	s := NewExpDecaySample(100, 0.99)
+	s := NewExpDecaySampleWithRand(100, 0.99, rand.New(rand.NewSource(1)))
 	for i := 0; i < 10; i++ {
 		s.Update(int64(i))
 	}
@@ -101,8 +139,7 @@ func TestExpDecaySample10(t *testing.T) {
 }
 
 func TestExpDecaySample100(t *testing.T) {
-	rand.Seed(1)
-	s := NewExpDecaySample(1000, 0.01)
+	s := NewExpDecaySampleWithRand(1000, 0.01, rand.New(rand.NewSource(1)))
 	for i := 0; i < 100; i++ {
 		s.Update(int64(i))
 	}
@@ -123,8 +160,7 @@ func TestExpDecaySample100(t *testing.T) {
 }
 
 func TestExpDecaySample1000(t *testing.T) {
-	rand.Seed(1)
-	s := NewExpDecaySample(100, 0.99)
+	s := NewExpDecaySampleWithRand(100, 0.99, rand.New(rand.NewSource(1)))
 	for i := 0; i < 1000; i++ {
 		s.Update(int64(i))
 	}
@@ -149,8 +185,7 @@ func TestExpDecaySample1000(t *testing.T) {
 // The priority becomes +Inf quickly after starting if this is done,
 // effectively freezing the set of samples until a rescale step happens.
 func TestExpDecaySampleNanosecondRegression(t *testing.T) {
-	rand.Seed(1)
-	s := NewExpDecaySample(100, 0.99)
+	s := NewExpDecaySampleWithRand(100, 0.99, rand.New(rand.NewSource(1)))
 	for i := 0; i < 100; i++ {
 		s.Update(10)
 	}
@@ -180,10 +215,145 @@ func TestExpDecaySampleRescale(t *testing.T) {
 	}
 }
 
+func TestAdaptiveExpDecaySample(t *testing.T) {
+	s := NewAdaptiveExpDecaySample(10, 1000, 0.015).(*ExpDecaySample)
+	if 10 != s.reservoirSize {
+		t.Errorf("s.reservoirSize: 10 != %v\n", s.reservoirSize)
+	}
+	t0 := s.t0
+	for i := 0; i < 100; i++ {
+		s.update(t0, int64(i))
+	}
+	if size := s.Size(); 100 != size {
+		t.Errorf("s.Size(): 100 != %v\n", size)
+	}
+	for i := 0; i < 5000; i++ {
+		s.update(t0.Add(time.Second), int64(i))
+	}
+	if size := s.Size(); 1000 != size {
+		t.Errorf("s.Size(): 1000 != %v\n", size)
+	}
+	s.update(t0.Add(2*time.Minute), 0)
+	if 1000 != s.reservoirSize {
+		t.Errorf("s.reservoirSize: 1000 != %v\n", s.reservoirSize)
+	}
+	for i := 0; i < 5; i++ {
+		s.update(t0.Add(3*time.Minute+30*time.Second), int64(i))
+	}
+	s.update(t0.Add(4*time.Minute), 0)
+	if size := s.Size(); 10 != size {
+		t.Errorf("s.Size(): 10 != %v\n", size)
+	}
+	if count := s.Count(); 5107 != count {
+		t.Errorf("s.Count(): 5107 != %v\n", count)
+	}
+}
+
+func TestAdaptiveExpDecaySampleMinSize(t *testing.T) {
+	s := NewAdaptiveExpDecaySample(0, 0, 0.015)
+	s.Update(1)
+	s.Update(2)
+	if size := s.Size(); 1 != size {
+		t.Errorf("s.Size(): 1 != %v\n", size)
+	}
+}
+
+func TestExpDecaySampleLargeAlpha(t *testing.T) {
+	now := time.Now()
+	s := NewExpDecaySampleWithRand(10, 1, rand.New(rand.NewSource(1))).(*ExpDecaySample)
+	for i := 0; i < 10; i++ {
+		s.update(now, 1)
+	}
+	for i := 0; i < 10; i++ {
+		s.update(now.Add(30*time.Minute), 2)
+	}
+	for _, v := range s.Values() {
+		if 2 != v {
+			t.Fatalf("s.Values() after half an hour: %v\n", s.Values())
+		}
+	}
+	for i := 0; i < 10; i++ {
+		s.update(now.Add(3*time.Hour), 3)
+	}
+	for _, v := range s.values.Values() {
+		if 3 != v.v || math.IsNaN(v.k) || math.IsInf(v.k, 0) {
+			t.Fatalf("s.values after rescaling: %v\n", s.values.Values())
+		}
+	}
+}
+
+// TestExpDecaySampleExact checks that a sample whose reservoir is never
+// filled retains every value, however extreme, and so reports exact
+// statistics.
+func TestExpDecaySampleExact(t *testing.T) {
+	ps := []float64{0, 0.25, 0.5, 0.75, 0.99, 1}
+	f := func(values []int64) bool {
+		s := NewExpDecaySample(len(values)+1, 0.015)
+		for _, v := range values {
+			s.Update(v)
+		}
+		exact := make(int64Slice, len(values))
+		copy(exact, values)
+		expected, actual := SamplePercentiles(exact, ps), s.Percentiles(ps)
+		for i := range ps {
+			if expected[i] != actual[i] {
+				return false
+			}
+		}
+		return SampleMin(exact) == s.Min() && SampleMax(exact) == s.Max()
+	}
+	if err := quick.Check(f, nil); nil != err {
+		t.Error(err)
+	}
+}
+
+// TestExpDecaySamplePercentiles checks that the percentiles of a sample of a
+// stream of values, including negative ones, are close in rank to the exact
+// percentiles of the whole stream: within three standard errors of a
+// reservoir of its size.
+func TestExpDecaySamplePercentiles(t *testing.T) {
+	const reservoirSize = 1028
+	ps := []float64{0.1, 0.5, 0.9}
+	tolerance := 3 / math.Sqrt(reservoirSize)
+	f := func(seed int64, offset int32) bool {
+		r := rand.New(rand.NewSource(seed))
+		now := time.Now()
+		s := NewExpDecaySampleWithRand(reservoirSize, 0.015, rand.New(rand.NewSource(^seed))).(*ExpDecaySample)
+		values := make(int64Slice, 10000)
+		for i := range values {
+			values[i] = int64(offset) + r.Int63n(1000000) - 500000
+			s.update(now.Add(time.Duration(i)*time.Millisecond), values[i])
+		}
+		sort.Sort(values)
+		for i, p := range s.Percentiles(ps) {
+			rank := float64(sort.Search(len(values), func(j int) bool {
+				return p <= float64(values[j])
+			})) / float64(len(values))
+			if math.Abs(rank-ps[i]) > tolerance {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 20}); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestExpDecaySampleWithRand(t *testing.T) {
+	now := time.Now()
+	testSampleWithRand(t, func(r Rand) Sample {
+		s := NewExpDecaySampleWithRand(100, 0.99, r)
+		for i := 1; i <= 10000; i++ {
+			s.(*ExpDecaySample).update(now.Add(time.Duration(i)), int64(i))
+		}
+		return s
+	})
+}
+
 func TestExpDecaySampleSnapshot(t *testing.T) {
 	now := time.Now()
-	rand.Seed(1)
-	s := NewExpDecaySample(100, 0.99)
+	s := NewExpDecaySampleWithRand(100, 0.99, rand.New(rand.NewSource(1)))
 	for i := 1; i <= 10000; i++ {
 		s.(*ExpDecaySample).update(now.Add(time.Duration(i)), int64(i))
 	}
@@ -192,19 +362,58 @@ func TestExpDecaySampleSnapshot(t *testing.T) {
 	testExpDecaySampleStatistics(t, snapshot)
 }
 
+func TestExpDecaySampleSnapshotCopyOnWrite(t *testing.T) {
+	s := NewExpDecaySampleWithRand(10, 0.99, rand.New(rand.NewSource(1)))
+	for i := 1; i <= 10; i++ {
+		s.Update(int64(i))
+	}
+	snapshot := s.Snapshot()
+	for i := 0; i < 100; i++ {
+		s.Update(1000)
+	}
+	if max := snapshot.Max(); 10 != max {
+		t.Errorf("snapshot.Max(): 10 != %v\n", max)
+	}
+	if sum := snapshot.Sum(); 55 != sum {
+		t.Errorf("snapshot.Sum(): 55 != %v\n", sum)
+	}
+	expected := s.Values()
+	snapshot = s.Snapshot()
+	s.Clear()
+	for i := 0; i < 10; i++ {
+		s.Update(1)
+	}
+	if sum, expectedSum := snapshot.Sum(), SampleSum(expected); expectedSum != sum {
+		t.Errorf("snapshot.Sum(): %v != %v\n", expectedSum, sum)
+	}
+	if p, expectedP := snapshot.Percentile(0.5), SamplePercentile(expected, 0.5); expectedP != p {
+		t.Errorf("snapshot.Percentile(0.5): %v != %v\n", expectedP, p)
+	}
+	if size := snapshot.Size(); 10 != size {
+		t.Errorf("snapshot.Size(): 10 != %v\n", size)
+	}
+}
+
 func TestExpDecaySampleStatistics(t *testing.T) {
 	now := time.Now()
-	rand.Seed(1)
-	s := NewExpDecaySample(100, 0.99)
+	s := NewExpDecaySampleWithRand(100, 0.99, rand.New(rand.NewSource(1)))
 	for i := 1; i <= 10000; i++ {
 		s.(*ExpDecaySample).update(now.Add(time.Duration(i)), int64(i))
 	}
 	testExpDecaySampleStatistics(t, s)
 }
 
+func TestSampleMeanOverflow(t *testing.T) {
+	if mean := SampleMean([]int64{math.MaxInt64, math.MaxInt64}); float64(math.MaxInt64) != mean {
+		t.Errorf("SampleMean(): %v != %v\n", float64(math.MaxInt64), mean)
+	}
+	if mean := SampleMean([]int64{math.MinInt64, -1}); float64(math.MinInt64)/2 != mean {
+		t.Errorf("SampleMean(): %v != %v\n", float64(math.MinInt64)/2, mean)
+	}
+}
+
 func TestUniformSample(t *testing.T) {
-	rand.Seed(1)
-	s := NewUniformSample(100)
+	s := NewUniformSampleWithRand(100, rand.New(rand.NewSource(1)))
 	for i := 0; i < 1000; i++ {
 		s.Update(int64(i))
 	}
@@ -225,8 +434,7 @@ func TestUniformSample(t *testing.T) {
 }
 
 func TestUniformSampleIncludesTail(t *testing.T) {
-	rand.Seed(1)
-	s := NewUniformSample(100)
+	s := NewUniformSampleWithRand(100, rand.New(rand.NewSource(1)))
 	max := 100
 	for i := 0; i < max; i++ {
 		s.Update(int64(i))
@@ -242,8 +450,18 @@ func TestUniformSampleIncludesTail(t *testing.T) {
 	}
 }
 
+func TestUniformSampleWithRand(t *testing.T) {
+	testSampleWithRand(t, func(r Rand) Sample {
+		s := NewUniformSampleWithRand(100, r)
+		for i := 1; i <= 10000; i++ {
+			s.Update(int64(i))
+		}
+		return s
+	})
+}
+
 func TestUniformSampleSnapshot(t *testing.T) {
-	s := NewUniformSample(100)
+	s := NewUniformSampleWithRand(100, rand.New(rand.NewSource(1)))
 	for i := 1; i <= 10000; i++ {
 		s.Update(int64(i))
 	}
@@ -253,14 +471,136 @@ func TestUniformSampleSnapshot(t *testing.T) {
 }
 
 func TestUniformSampleStatistics(t *testing.T) {
-	rand.Seed(1)
-	s := NewUniformSample(100)
+	s := NewUniformSampleWithRand(100, rand.New(rand.NewSource(1)))
 	for i := 1; i <= 10000; i++ {
 		s.Update(int64(i))
 	}
 	testUniformSampleStatistics(t, s)
 }
 
+func TestSlidingWindowSample(t *testing.T) {
+	s := NewSlidingWindowSample(100)
+	for i := 0; i < 1000; i++ {
+		s.Update(int64(i))
+	}
+	if count := s.Count(); 1000 != count {
+		t.Errorf("s.Count(): 1000 != %v\n", count)
+	}
+	if size := s.Size(); 100 != size {
+		t.Errorf("s.Size(): 100 != %v\n", size)
+	}
+	for i, v := range s.Values() {
+		if int64(900+i) != v {
+			t.Errorf("s.Values()[%d]: %v != %v\n", i, 900+i, v)
+		}
+	}
+	if min := s.Min(); 900 != min {
+		t.Errorf("s.Min(): 900 != %v\n", min)
+	}
+	if max := s.Max(); 999 != max {
+		t.Errorf("s.Max(): 999 != %v\n", max)
+	}
+	if mean := s.Mean(); 949.5 != mean {
+		t.Errorf("s.Mean(): 949.5 != %v\n", mean)
+	}
+}
+
+func TestSlidingWindowSampleUpdateWeighted(t *testing.T) {
+	s := NewSlidingWindowSample(2)
+	s.UpdateWeighted(1, 9)
+	s.UpdateWeighted(2, 0)
+	s.UpdateWeighted(3, 1)
+	s.UpdateWeighted(4, 1)
+	if count := s.Count(); 11 != count {
+		t.Errorf("s.Count(): 11 != %v\n", count)
+	}
+	if values := s.Values(); 2 != len(values) || 3 != values[0] || 4 != values[1] {
+		t.Errorf("s.Values(): [3 4] != %v\n", values)
+	}
+}
+
+func TestSlidingTimeWindowSample(t *testing.T) {
+	s := NewSlidingTimeWindowSample(time.Minute).(*SlidingTimeWindowSample)
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		s.update(now.Add(time.Duration(i-999)*100*time.Millisecond), int64(i), 1)
+	}
+	if count := s.Count(); 1000 != count {
+		t.Errorf("s.Count(): 1000 != %v\n", count)
+	}
+	values := s.load(now)
+	if 600 != len(values) {
+		t.Fatalf("len(s.load(now)): 600 != %v\n", len(values))
+	}
+	for i, v := range values {
+		if int64(400+i) != v {
+			t.Errorf("s.load(now)[%d]: %v != %v\n", i, 400+i, v)
+		}
+	}
+	snapshot := s.snapshot(now.Add(59 * time.Second))
+	if size := snapshot.Size(); 10 != size {
+		t.Errorf("snapshot.Size(): 10 != %v\n", size)
+	}
+	if min := snapshot.Min(); 990 != min {
+		t.Errorf("snapshot.Min(): 990 != %v\n", min)
+	}
+	if sum := snapshot.Sum(); 9945 != sum {
+		t.Errorf("snapshot.Sum(): 9945 != %v\n", sum)
+	}
+	if sum := sampleTotalSum(snapshot); 499500 != sum {
+		t.Errorf("sampleTotalSum(snapshot): 499500 != %v\n", sum)
+	}
+	if n := len(s.values); 32 != n {
+		t.Errorf("len(s.values): 32 != %v\n", n)
+	}
+	s.update(now.Add(2*time.Minute), 47, 1)
+	if values := s.load(now.Add(2 * time.Minute)); 1 != len(values) || 47 != values[0] {
+		t.Errorf("s.load(now + 2m): [47] != %v\n", values)
+	}
+}
+
+func TestSlidingTimeWindowSampleUpdateWeighted(t *testing.T) {
+	s := NewSlidingTimeWindowSample(time.Minute)
+	s.UpdateWeighted(1, 9)
+	s.UpdateWeighted(2, 0)
+	s.UpdateWeighted(3, 1)
+	if count := s.Count(); 10 != count {
+		t.Errorf("s.Count(): 10 != %v\n", count)
+	}
+	if values := s.Values(); 2 != len(values) || 1 != values[0] || 3 != values[1] {
+		t.Errorf("s.Values(): [1 3] != %v\n", values)
+	}
+}
+
+func TestSampleConfig(t *testing.T) {
+	if _, ok := DefaultSampleConfig.NewSample().(*ExpDecaySample); !ok {
+		t.Errorf("DefaultSampleConfig.NewSample(): %T\n", DefaultSampleConfig.NewSample())
+	}
+	s := SampleConfig{Type: SlidingWindowSampleType, Size: 256}.NewSample()
+	if w, ok := s.(*SlidingWindowSample); !ok || 256 != w.reservoirSize {
+		t.Errorf("SampleConfig{SlidingWindowSampleType, 256}.NewSample(): %#v\n", s)
+	}
+	if _, ok := (SampleConfig{Type: UniformSampleType, Size: 256}).NewSample().(*UniformSample); !ok {
+		t.Error("SampleConfig{UniformSampleType, 256}.NewSample() isn't a *UniformSample")
+	}
+	s = SampleConfig{Type: AdaptiveExpDecaySampleType, Size: 1028, MinSize: 16, Alpha: 0.015}.NewSample()
+	if e, ok := s.(*ExpDecaySample); !ok || 16 != e.minSize || 1028 != e.maxSize {
+		t.Errorf("SampleConfig{AdaptiveExpDecaySampleType, 1028, 16}.NewSample(): %#v\n", s)
+	}
+	s = SampleConfig{Type: SlidingTimeWindowSampleType, Window: time.Minute}.NewSample()
+	if w, ok := s.(*SlidingTimeWindowSample); !ok || time.Minute != w.window {
+		t.Errorf("SampleConfig{SlidingTimeWindowSampleType, 1m}.NewSample(): %#v\n", s)
+	}
+}
+
+func TestExpDecaySampleUpdateWeighted(t *testing.T) {
+	testSampleUpdateWeighted(t, NewExpDecaySampleWithRand(100, 0.015, rand.New(rand.NewSource(1))))
+}
+
+func TestUniformSampleUpdateWeighted(t *testing.T) {
+	testSampleUpdateWeighted(t, NewUniformSampleWithRand(100, rand.New(rand.NewSource(1))))
+}
+
 func benchmarkSample(b *testing.B, s Sample) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
@@ -361,3 +701,78 @@ func TestUniformSampleConcurrentUpdateCount(t *testing.T) {
 	}
 	quit <- struct{}{}
 }
+
+// testSampleUpdateWeighted records as many zeros as ones but gives the ones
+// nine times the weight, so about 90% of the values retained should be ones.
+func testSampleUpdateWeighted(t *testing.T, s Sample) {
+	for i := 0; i < 10000; i++ {
+		s.UpdateWeighted(0, 1)
+		s.UpdateWeighted(1, 9)
+	}
+	s.UpdateWeighted(2, 0)
+	s.UpdateWeighted(2, -1)
+	if count := s.Count(); 100000 != count {
+		t.Errorf("s.Count(): 100000 != %v\n", count)
+	}
+	if max := s.Max(); 1 != max {
+		t.Errorf("s.Max(): 1 != %v\n", max)
+	}
+	if mean := s.Mean(); mean < 0.8 || 0.97 < mean {
+		t.Errorf("s.Mean(): 0.9 != %v\n", mean)
+	}
+}
+
+// testSampleWithRand checks that samples filled identically from identically
+// seeded Rands retain identical values and that the shared source is left
+// untouched.
+func testSampleWithRand(t *testing.T, fill func(Rand) Sample) {
+	rand.Seed(1)
+	s1 := fill(rand.New(rand.NewSource(47)))
+	if v := rand.Int63(); 5577006791947779410 != v {
+		t.Errorf("rand.Int63(): 5577006791947779410 != %v\n", v)
+	}
+	s2 := fill(rand.New(rand.NewSource(47)))
+	v1, v2 := s1.Values(), s2.Values()
+	if len(v1) != len(v2) {
+		t.Fatalf("len(v1): %v != len(v2): %v\n", len(v1), len(v2))
+	}
+	for i := range v1 {
+		if v1[i] != v2[i] {
+			t.Fatalf("v1[%d]: %v != v2[%d]: %v\n", i, v1[i], i, v2[i])
+		}
+	}
+}
+
+func TestSamplePercentilesInterpolated(t *testing.T) {
+	for _, c := range []struct {
+		interpolation Interpolation
+		expected      []float64
+	}{
+		{WeibullInterpolation, []float64{1.25, 2.5, 4}},
+		{NearestRankInterpolation, []float64{1, 2, 4}},
+		{LinearInterpolation, []float64{1.75, 2.5, 3.7}},
+		{HazenInterpolation, []float64{1.5, 2.5, 4}},
+	} {
+		ps := SamplePercentilesInterpolated([]int64{4, 2, 3, 1}, []float64{0.25, 0.5, 0.9}, c.interpolation)
+		for i, p := range ps {
+			if math.Abs(c.expected[i]-p) > 1e-9 {
+				t.Errorf("%v: ps[%d]: %v != %v\n", c.interpolation, i, c.expected[i], p)
+			}
+		}
+	}
+}
+
+func TestDefaultInterpolation(t *testing.T) {
+	defer func(i Interpolation) { DefaultInterpolation = i }(DefaultInterpolation)
+	DefaultInterpolation = NearestRankInterpolation
+	s := NewUniformSample(100)
+	for i := 1; i <= 4; i++ {
+		s.Update(int64(i))
+	}
+	if p := s.Percentile(0.25); 1 != p {
+		t.Errorf("s.Percentile(0.25): 1 != %v\n", p)
+	}
+	if p := s.Snapshot().Percentile(0.25); 1 != p {
+		t.Errorf("s.Snapshot().Percentile(0.25): 1 != %v\n", p)
+	}
+}
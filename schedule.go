@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Schedule lets a push reporter flush some of its metrics at an interval
+// of their own, so that cheap, fast-moving gauges can be sent often while
+// large histogram families are sent rarely, cutting the backend's write
+// load.  Each metric is flushed by the first of a reporter's schedules whose
+// Filter selects it or, if none does, at the reporter's FlushInterval.  A
+// reporter's ChangeFilter counts the flushes of all its schedules together.
+type Schedule struct {
+	Interval time.Duration                         // Flush interval of the metrics selected
+	Filter   func(name string, i interface{}) bool // Selects the metrics flushed on this schedule
+}
+
+// scheduledRegistry is a Registry whose Each yields only the metrics which
+// fall to one of a reporter's schedules or, if index is -1, to none of them.
+type scheduledRegistry struct {
+	Registry
+	index     int
+	schedules []Schedule
+}
+
+// ExportedPercentiles returns the underlying registry's percentiles.
+func (r *scheduledRegistry) ExportedPercentiles() []float64 {
+	return registryPercentiles(r.Registry)
+}
+
+// Each calls the given function for each metric which falls to the
+// registry's schedule.
+func (r *scheduledRegistry) Each(f func(string, interface{})) {
+	r.Registry.Each(func(name string, i interface{}) {
+		if r.index == scheduleIndex(r.schedules, name, i) {
+			f(name, i)
+		}
+	})
+}
+
+// Snapshot takes a snapshot of every metric which falls to the registry's
+// schedule in a single pass.
+func (r *scheduledRegistry) Snapshot() *RegistrySnapshot {
+	return NewRegistrySnapshot(r)
+}
+
+// scheduleIndex returns the index of the first schedule whose Filter selects
+// the given metric or -1 if none does.
+func scheduleIndex(schedules []Schedule, name string, i interface{}) int {
+	for index, s := range schedules {
+		if nil != s.Filter && s.Filter(name, i) {
+			return index
+		}
+	}
+	return -1
+}
+
+// runSchedules runs flushes, as by runFlushes, of the metrics which fall to
+// none of the given schedules every interval and of those which fall to
+// each schedule at that schedule's interval, until ctx is done.  The flush
+// function is given the registry of metrics to flush.  A zero timeout
+// bounds each flush by its own schedule's interval.
+func runSchedules(ctx context.Context, reporter string, r Registry, interval, timeout time.Duration, schedules []Schedule, flush func(context.Context, Registry) error) {
+	if 0 == len(schedules) {
+		runFlushes(ctx, reporter, r, interval, timeout, func(ctx context.Context) error {
+			return flush(ctx, r)
+		})
+		return
+	}
+	var wg sync.WaitGroup
+	for index := -1; index < len(schedules); index++ {
+		scheduled := &scheduledRegistry{Registry: r, index: index, schedules: schedules}
+		d := interval
+		if 0 <= index {
+			d = schedules[index].Interval
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runFlushes(ctx, reporter, r, d, timeout, func(ctx context.Context) error {
+				return flush(ctx, scheduled)
+			})
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduledRegistry(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterGauge("queue", r)
+	GetOrRegisterHistogram("latency.http", r, NewUniformSample(10))
+	GetOrRegisterHistogram("latency.db", r, NewUniformSample(10))
+	GetOrRegisterCounter("requests", r)
+	schedules := []Schedule{
+		{Interval: time.Minute, Filter: func(name string, i interface{}) bool {
+			return strings.HasPrefix(name, "latency.db")
+		}},
+		{Interval: time.Minute, Filter: func(name string, i interface{}) bool {
+			_, ok := i.(Histogram)
+			return ok
+		}},
+	}
+	for index, expected := range map[int]string{
+		-1: "queue,requests",
+		0:  "latency.db",
+		1:  "latency.http",
+	} {
+		var names []string
+		(&scheduledRegistry{Registry: r, index: index, schedules: schedules}).Each(func(name string, i interface{}) {
+			names = append(names, name)
+		})
+		sort.Strings(names)
+		if actual := strings.Join(names, ","); expected != actual {
+			t.Errorf("schedule %d: %q != %q\n", index, expected, actual)
+		}
+	}
+}
+
+func TestRunSchedules(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterGauge("queue", r)
+	GetOrRegisterHistogram("latency", r, NewUniformSample(10))
+	schedules := []Schedule{{Interval: time.Millisecond, Filter: func(name string, i interface{}) bool {
+		return "queue" == name
+	}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	var mutex sync.Mutex
+	flushed := make(map[string]int)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runSchedules(ctx, "test", r, time.Hour, 0, schedules, func(ctx context.Context, r Registry) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			r.Each(func(name string, i interface{}) {
+				flushed[name]++
+			})
+			if 3 <= flushed["queue"] {
+				cancel()
+			}
+			return nil
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runSchedules(): expected to return once its context was cancelled")
+	}
+	if 3 != flushed["queue"] {
+		t.Errorf("flushed[\"queue\"]: 3 != %v\n", flushed["queue"])
+	}
+	if 0 != flushed["latency"] {
+		t.Errorf("flushed[\"latency\"]: 0 != %v\n", flushed["latency"])
+	}
+}
@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Priorities order the periodic tasks which fall due together so that those
+// which update metrics run before those which read them: meters tick, then
+// collectors such as CaptureRuntimeMemStats and PollGauge capture, and then
+// reporters flush.
+const (
+	priorityReport = iota
+	priorityCollect
+	priorityTick
+)
+
+// schedulerSlack is how early a task may run so that it shares a wakeup with
+// another task falling due just before it.
+const schedulerSlack = 10 * time.Millisecond
+
+// A ScheduledTask describes one of the package's periodic tasks: ticking
+// meters, polling gauges, capturing runtime statistics, expiring tenants'
+// metrics, or flushing a reporter.
+type ScheduledTask struct {
+	Name     string
+	Interval time.Duration
+	Next     time.Time // When the task next falls due
+	Runs     int64     // Times the task has fallen due
+}
+
+// ScheduledTasks returns every periodic task the package is running, in the
+// order in which they next fall due.
+func ScheduledTasks() []ScheduledTask {
+	return tasks.list()
+}
+
+// StopScheduledTasks stops every periodic task the package is running.
+// Functions which run a task as a goroutine, such as CaptureRuntimeMemStats
+// and the reporters, return; meters stop ticking, so their moving averages
+// freeze.  Tasks begun afterwards run as usual, and meters constructed
+// afterwards tick.
+func StopScheduledTasks() {
+	tasks.stopAll()
+	arbiter.reset()
+}
+
+// tasks is the scheduler which runs every one of the package's periodic
+// tasks on one goroutine and one timer, so that they share wakeups rather
+// than each keeping a ticker of its own.
+var tasks = &scheduler{rand: newRand(), wake: make(chan struct{}, 1)}
+
+// tick returns a channel on which the time is sent every d, like
+// time.Tick's, which is closed if the task is stopped.  Like time.Tick, a
+// non-positive d returns nil.
+func tick(name string, priority int, d time.Duration) <-chan time.Time {
+	if d <= 0 {
+		return nil
+	}
+	return tasks.ticker(name, priority, d).c
+}
+
+// A task is run by a scheduler every interval, either by calling f on the
+// scheduler's goroutine, which must return quickly, or by sending the time on
+// c, dropping ticks a slow receiver isn't ready for, as a time.Ticker does.
+type task struct {
+	c        chan time.Time
+	f        func(time.Time)
+	index    int // In scheduler.tasks or -1 once stopped
+	interval time.Duration
+	name     string
+	next     time.Time
+	priority int
+	runs     int64
+}
+
+// slack returns how early the task may run, which is less than half its
+// interval so that it runs at most once per wakeup.
+func (t *task) slack() time.Duration {
+	if t.interval/2 < schedulerSlack {
+		return t.interval / 2
+	}
+	return schedulerSlack
+}
+
+type scheduler struct {
+	mutex   sync.Mutex
+	rand    Rand
+	running bool
+	tasks   taskHeap
+	wake    chan struct{}
+}
+
+// every runs f every interval, first after a random fraction of the
+// interval if jitter is set so that tasks begun together don't fall due
+// together.
+func (s *scheduler) every(name string, priority int, interval time.Duration, jitter bool, f func(time.Time)) *task {
+	t := &task{f: f, interval: interval, name: name, priority: priority}
+	s.add(t, jitter)
+	return t
+}
+
+// list describes every task in the order in which they next fall due.
+func (s *scheduler) list() []ScheduledTask {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	list := make([]ScheduledTask, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		list = append(list, ScheduledTask{
+			Name:     t.name,
+			Interval: t.interval,
+			Next:     t.next,
+			Runs:     t.runs,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Next.Before(list[j].Next) })
+	return list
+}
+
+// stop stops the given task, closing its channel if it has one.
+func (s *scheduler) stop(t *task) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 <= t.index {
+		heap.Remove(&s.tasks, t.index)
+		if nil != t.c {
+			close(t.c)
+		}
+		s.notify()
+	}
+}
+
+// stopAll stops every task.
+func (s *scheduler) stopAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for 0 < len(s.tasks) {
+		if t := heap.Pop(&s.tasks).(*task); nil != t.c {
+			close(t.c)
+		}
+	}
+	s.notify()
+}
+
+// ticker sends the time on the task's channel every interval.
+func (s *scheduler) ticker(name string, priority int, interval time.Duration) *task {
+	t := &task{c: make(chan time.Time, 1), interval: interval, name: name, priority: priority}
+	s.add(t, false)
+	return t
+}
+
+func (s *scheduler) add(t *task, jitter bool) {
+	if t.interval <= 0 {
+		t.interval = time.Second
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t.next = time.Now().Add(t.interval)
+	if jitter {
+		t.next = t.next.Add(-time.Duration(s.rand.Int63n(int64(t.interval))))
+	}
+	heap.Push(&s.tasks, t)
+	if !s.running {
+		s.running = true
+		go s.run()
+	}
+	s.notify()
+}
+
+// due advances and returns every task which falls due by the given time,
+// highest priority first, and how long to wait for the next if none does.
+func (s *scheduler) due(now time.Time) ([]*task, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var due []*task
+	for 0 < len(s.tasks) && !s.tasks[0].next.After(now.Add(s.tasks[0].slack())) {
+		t := s.tasks[0]
+		t.runs++
+		if t.next = t.next.Add(t.interval); !t.next.After(now.Add(t.slack())) {
+			t.next = now.Add(t.interval) // Skip runs missed while starved.
+		}
+		heap.Fix(&s.tasks, 0)
+		due = append(due, t)
+	}
+	if 0 < len(due) {
+		sort.SliceStable(due, func(i, j int) bool { return due[i].priority > due[j].priority })
+		return due, 0
+	}
+	if 0 == len(s.tasks) {
+		return nil, time.Hour
+	}
+	return nil, s.tasks[0].next.Sub(now)
+}
+
+// notify wakes the scheduler's goroutine to reconsider when the next task
+// falls due.
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	for {
+		now := time.Now()
+		due, wait := s.due(now)
+		for _, t := range due {
+			if nil != t.f {
+				t.f(now)
+			} else {
+				s.send(t, now)
+			}
+		}
+		if 0 < len(due) {
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// send sends the time on the task's channel unless the task has been
+// stopped and its channel closed or its receiver isn't ready.
+func (s *scheduler) send(t *task, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if 0 <= t.index {
+		select {
+		case t.c <- now:
+		default:
+		}
+	}
+}
+
+// taskHeap is a container/heap of tasks ordered by when they next fall due.
+type taskHeap []*task
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	t := x.(*task)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
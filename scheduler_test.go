@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestScheduler() *scheduler {
+	return &scheduler{rand: newRand(), wake: make(chan struct{}, 1)}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := newTestScheduler()
+	var mutex sync.Mutex
+	var order []string
+	done := make(chan struct{})
+	record := func(name string) func(time.Time) {
+		return func(time.Time) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, name)
+			if 2 == len(order) {
+				close(done)
+			}
+		}
+	}
+	s.mutex.Lock()
+	report := &task{f: record("report"), interval: time.Hour, priority: priorityReport}
+	meters := &task{f: record("meters"), interval: time.Hour, priority: priorityTick}
+	report.next = time.Now()
+	meters.next = report.next.Add(time.Millisecond)
+	s.tasks.Push(report)
+	s.tasks.Push(meters)
+	s.running = true
+	s.mutex.Unlock()
+	go s.run()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tasks didn't run")
+	}
+	s.stopAll()
+	if "meters" != order[0] {
+		t.Errorf("order: %v, expected meters to tick first\n", order)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	s := newTestScheduler()
+	ticker := s.ticker("ticker", priorityReport, time.Millisecond)
+	if _, ok := <-ticker.c; !ok {
+		t.Fatal("<-ticker.c: closed before stopping")
+	}
+	if list := s.list(); 1 != len(list) || "ticker" != list[0].Name {
+		t.Errorf("s.list(): %v\n", list)
+	}
+	s.stopAll()
+	for range ticker.c {
+	}
+	if list := s.list(); 0 != len(list) {
+		t.Errorf("s.list(): %v after stopAll\n", list)
+	}
+	s.stop(ticker)
+}
@@ -0,0 +1,313 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// A Shadow duplicates the metrics it selects into shadow implementations,
+// such as a histogram with a sliding window sample shadowing one with an
+// exponentially decaying sample, so that a change of implementation can be
+// validated against live traffic before it's switched to.
+type Shadow struct {
+	Match  func(name string) bool               // Selects the metrics to shadow by name
+	New    func(metric interface{}) interface{} // Constructs a metric's shadow, of the same kind, or returns nil to leave it be
+	Suffix string                               // Appended to the shadow's name; empty means ".shadow"
+}
+
+func (s Shadow) suffix() string {
+	if "" == s.Suffix {
+		return ".shadow"
+	}
+	return s.Suffix
+}
+
+// ShadowRegistry is a Registry which shadows the metrics it gets or
+// registers by GetOrRegister, as the GetOrRegister constructors do, according
+// to the first of a set of Shadows which matches each name.  The metric it
+// returns updates both the metric and its shadow, which is registered under
+// the metric's name with the shadow's suffix so that both are exported.
+// Counters, CounterFloat64s, gauges, GaugeFloat64s, histograms, duration
+// histograms, meters, and timers may be shadowed; metrics registered by
+// Register are not, since their callers hold them already.  Every other
+// method is delegated to the underlying registry.
+type ShadowRegistry struct {
+	Registry
+	shadows []Shadow
+}
+
+// NewShadowRegistry constructs a ShadowRegistry which shadows metrics of the
+// given registry according to the given shadows.
+func NewShadowRegistry(r Registry, shadows ...Shadow) *ShadowRegistry {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &ShadowRegistry{Registry: r, shadows: shadows}
+}
+
+// ExportedPercentiles returns the underlying registry's percentiles.
+func (sr *ShadowRegistry) ExportedPercentiles() []float64 {
+	return registryPercentiles(sr.Registry)
+}
+
+// GetOrRegister gets an existing metric or registers the given one, or the
+// one returned by the given function, along with its shadow.
+func (sr *ShadowRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	s, ok := sr.shadow(name)
+	if !ok {
+		return sr.Registry.GetOrRegister(name, i)
+	}
+	metric := sr.Registry.GetOrRegister(name, func() interface{} {
+		metric := i
+		if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+			metric = v.Call(nil)[0].Interface()
+		}
+		return newShadowed(metric, s.New(metric))
+	})
+	if shadowed, ok := metric.(interface{ shadowMetric() interface{} }); ok {
+		sr.Registry.GetOrRegister(name+s.suffix(), shadowed.shadowMetric())
+	}
+	return metric
+}
+
+// Unregister unregisters the metric with the given name and its shadow.
+func (sr *ShadowRegistry) Unregister(name string) {
+	if s, ok := sr.shadow(name); ok && !strings.HasSuffix(name, s.suffix()) {
+		if _, ok := sr.Registry.Get(name).(interface{ shadowMetric() interface{} }); ok {
+			sr.Registry.Unregister(name + s.suffix())
+		}
+	}
+	sr.Registry.Unregister(name)
+}
+
+// shadow returns the first shadow which matches the given name.
+func (sr *ShadowRegistry) shadow(name string) (Shadow, bool) {
+	for _, s := range sr.shadows {
+		if nil != s.Match && nil != s.New && s.Match(name) {
+			return s, true
+		}
+	}
+	return Shadow{}, false
+}
+
+// newShadowed returns a metric which updates both the given metric and its
+// shadow or, if they aren't of the same kind, the metric itself.
+func newShadowed(metric, shadow interface{}) interface{} {
+	switch m := metric.(type) {
+	case Counter:
+		if s, ok := shadow.(Counter); ok {
+			return &shadowedCounter{m, s}
+		}
+	case CounterFloat64:
+		if s, ok := shadow.(CounterFloat64); ok {
+			return &shadowedCounterFloat64{m, s}
+		}
+	case DurationHistogram:
+		if s, ok := shadow.(DurationHistogram); ok {
+			return &shadowedDurationHistogram{m, s}
+		}
+	case Gauge:
+		if s, ok := shadow.(Gauge); ok {
+			return &shadowedGauge{m, s}
+		}
+	case GaugeFloat64:
+		if s, ok := shadow.(GaugeFloat64); ok {
+			return &shadowedGaugeFloat64{m, s}
+		}
+	case Histogram:
+		if s, ok := shadow.(Histogram); ok {
+			return &shadowedHistogram{m, s}
+		}
+	case Meter:
+		if s, ok := shadow.(Meter); ok {
+			return &shadowedMeter{m, s}
+		}
+	case Timer:
+		if s, ok := shadow.(Timer); ok {
+			return &shadowedTimer{m, s}
+		}
+	}
+	return metric
+}
+
+type shadowedCounter struct {
+	Counter
+	shadow Counter
+}
+
+func (c *shadowedCounter) Clear() {
+	c.Counter.Clear()
+	c.shadow.Clear()
+}
+
+func (c *shadowedCounter) Dec(n int64) {
+	c.Counter.Dec(n)
+	c.shadow.Dec(n)
+}
+
+func (c *shadowedCounter) Inc(n int64) {
+	c.Counter.Inc(n)
+	c.shadow.Inc(n)
+}
+
+func (c *shadowedCounter) shadowMetric() interface{} { return c.shadow }
+
+func (c *shadowedCounter) unwrapMetric() interface{} { return c.Counter }
+
+type shadowedCounterFloat64 struct {
+	CounterFloat64
+	shadow CounterFloat64
+}
+
+func (c *shadowedCounterFloat64) Clear() {
+	c.CounterFloat64.Clear()
+	c.shadow.Clear()
+}
+
+func (c *shadowedCounterFloat64) Dec(n float64) {
+	c.CounterFloat64.Dec(n)
+	c.shadow.Dec(n)
+}
+
+func (c *shadowedCounterFloat64) Inc(n float64) {
+	c.CounterFloat64.Inc(n)
+	c.shadow.Inc(n)
+}
+
+func (c *shadowedCounterFloat64) shadowMetric() interface{} { return c.shadow }
+
+func (c *shadowedCounterFloat64) unwrapMetric() interface{} { return c.CounterFloat64 }
+
+type shadowedDurationHistogram struct {
+	DurationHistogram
+	shadow DurationHistogram
+}
+
+func (h *shadowedDurationHistogram) Clear() {
+	h.DurationHistogram.Clear()
+	h.shadow.Clear()
+}
+
+func (h *shadowedDurationHistogram) Update(d time.Duration) {
+	h.DurationHistogram.Update(d)
+	h.shadow.Update(d)
+}
+
+func (h *shadowedDurationHistogram) UpdateSince(ts time.Time) {
+	h.Update(time.Since(ts))
+}
+
+func (h *shadowedDurationHistogram) shadowMetric() interface{} { return h.shadow }
+
+func (h *shadowedDurationHistogram) unwrapMetric() interface{} { return h.DurationHistogram }
+
+type shadowedGauge struct {
+	Gauge
+	shadow Gauge
+}
+
+func (g *shadowedGauge) Add(d int64) {
+	g.Gauge.Add(d)
+	g.shadow.Add(d)
+}
+
+func (g *shadowedGauge) SetMax(v int64) bool {
+	g.shadow.SetMax(v)
+	return g.Gauge.SetMax(v)
+}
+
+func (g *shadowedGauge) SetMin(v int64) bool {
+	g.shadow.SetMin(v)
+	return g.Gauge.SetMin(v)
+}
+
+func (g *shadowedGauge) Sub(d int64) {
+	g.Gauge.Sub(d)
+	g.shadow.Sub(d)
+}
+
+func (g *shadowedGauge) Update(v int64) {
+	g.Gauge.Update(v)
+	g.shadow.Update(v)
+}
+
+func (g *shadowedGauge) shadowMetric() interface{} { return g.shadow }
+
+func (g *shadowedGauge) unwrapMetric() interface{} { return g.Gauge }
+
+type shadowedGaugeFloat64 struct {
+	GaugeFloat64
+	shadow GaugeFloat64
+}
+
+func (g *shadowedGaugeFloat64) Update(v float64) {
+	g.GaugeFloat64.Update(v)
+	g.shadow.Update(v)
+}
+
+func (g *shadowedGaugeFloat64) shadowMetric() interface{} { return g.shadow }
+
+func (g *shadowedGaugeFloat64) unwrapMetric() interface{} { return g.GaugeFloat64 }
+
+type shadowedHistogram struct {
+	Histogram
+	shadow Histogram
+}
+
+func (h *shadowedHistogram) Clear() {
+	h.Histogram.Clear()
+	h.shadow.Clear()
+}
+
+func (h *shadowedHistogram) Update(v int64) {
+	h.Histogram.Update(v)
+	h.shadow.Update(v)
+}
+
+func (h *shadowedHistogram) UpdateWeighted(v int64, w float64) {
+	h.Histogram.UpdateWeighted(v, w)
+	h.shadow.UpdateWeighted(v, w)
+}
+
+func (h *shadowedHistogram) shadowMetric() interface{} { return h.shadow }
+
+func (h *shadowedHistogram) unwrapMetric() interface{} { return h.Histogram }
+
+type shadowedMeter struct {
+	Meter
+	shadow Meter
+}
+
+func (m *shadowedMeter) Mark(n int64) {
+	m.Meter.Mark(n)
+	m.shadow.Mark(n)
+}
+
+func (m *shadowedMeter) shadowMetric() interface{} { return m.shadow }
+
+func (m *shadowedMeter) unwrapMetric() interface{} { return m.Meter }
+
+type shadowedTimer struct {
+	Timer
+	shadow Timer
+}
+
+func (t *shadowedTimer) Time(f func()) {
+	ts := time.Now()
+	f()
+	t.Update(time.Since(ts))
+}
+
+func (t *shadowedTimer) Update(d time.Duration) {
+	t.Timer.Update(d)
+	t.shadow.Update(d)
+}
+
+func (t *shadowedTimer) UpdateSince(ts time.Time) {
+	t.Update(time.Since(ts))
+}
+
+func (t *shadowedTimer) shadowMetric() interface{} { return t.shadow }
+
+func (t *shadowedTimer) unwrapMetric() interface{} { return t.Timer }
@@ -0,0 +1,62 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShadowRegistry(t *testing.T) {
+	r := NewRegistry()
+	sr := NewShadowRegistry(r, Shadow{
+		Match: func(name string) bool { return strings.HasPrefix(name, "latency") },
+		New: func(metric interface{}) interface{} {
+			switch metric.(type) {
+			case Histogram:
+				return NewHistogram(NewUniformSample(10))
+			case Timer:
+				return NewTimer()
+			case CounterFloat64:
+				return NewCounterFloat64()
+			}
+			return nil
+		},
+	})
+	h := GetOrRegisterHistogram("latency.db", sr, NewExpDecaySample(1028, 0.015))
+	h.Update(47)
+	if h != GetOrRegisterHistogram("latency.db", sr, NewExpDecaySample(1028, 0.015)) {
+		t.Error("GetOrRegisterHistogram: not the same histogram twice")
+	}
+	if _, ok := r.Get("latency.db").(Histogram).Sample().(*ExpDecaySample); !ok {
+		t.Errorf("r.Get(\"latency.db\").Sample(): %T\n", r.Get("latency.db").(Histogram).Sample())
+	}
+	shadow, ok := r.Get("latency.db.shadow").(Histogram)
+	if !ok {
+		t.Fatalf("r.Get(\"latency.db.shadow\"): %v\n", r.Get("latency.db.shadow"))
+	}
+	if _, ok := shadow.Sample().(*UniformSample); !ok || 1 != shadow.Count() || 47 != shadow.Max() {
+		t.Errorf("shadow: %T %v %v\n", shadow.Sample(), shadow.Count(), shadow.Max())
+	}
+
+	GetOrRegisterTimer("latency.http", sr).Update(time.Millisecond)
+	if count := r.Get("latency.http.shadow").(Timer).Count(); 1 != count {
+		t.Errorf("latency.http.shadow: 1 != %v\n", count)
+	}
+	GetOrRegisterCounterFloat64("latency.cpu", sr).Inc(1.5)
+	if count := r.Get("latency.cpu.shadow").(CounterFloat64).Count(); 1.5 != count {
+		t.Errorf("latency.cpu.shadow: 1.5 != %v\n", count)
+	}
+	GetOrRegisterCounter("requests", sr).Inc(1)
+	GetOrRegisterCounter("latency.count", sr).Inc(1)
+	if nil != r.Get("requests.shadow") || nil != r.Get("latency.count.shadow") {
+		t.Error("unshadowed metrics shadowed")
+	}
+
+	sr.Unregister("latency.db")
+	if nil != r.Get("latency.db") || nil != r.Get("latency.db.shadow") {
+		t.Error("sr.Unregister: shadow still registered")
+	}
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// GetOrRegisterShardedCounter returns an existing Counter or constructs and
+// registers a new ShardedCounter.
+func GetOrRegisterShardedCounter(name string, r Registry) Counter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, NewShardedCounter).(Counter)
+}
+
+// NewShardedCounter constructs a new ShardedCounter with a shard for each of
+// GOMAXPROCS, rounded up to a power of two.
+func NewShardedCounter() Counter {
+	if metricsDisabled || UseNilMetrics {
+		return NilCounter{}
+	}
+	return &ShardedCounter{shards: newCounterShards()}
+}
+
+// NewRegisteredShardedCounter constructs and registers a new ShardedCounter.
+func NewRegisteredShardedCounter(name string, r Registry) Counter {
+	c := NewShardedCounter()
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// ShardedCounter is a Counter for counts incremented from many cores at once,
+// where a StandardCounter's single atomic becomes a cache line contended by
+// every core.  Its count is striped across shards, each on cache lines of its
+// own, and goroutines add to the shard of the processor they're running on,
+// so that increments rarely contend, at the cost of summing every shard on
+// Count and Snapshot.  Clear isn't atomic: an increment concurrent with it
+// may or may not survive it.
+type ShardedCounter struct {
+	shards counterShards
+}
+
+// Clear sets the counter to zero.
+func (c *ShardedCounter) Clear() { c.shards.clear() }
+
+// Count returns the current count, the sum of every shard.
+func (c *ShardedCounter) Count() int64 { return c.shards.sum() }
+
+// Dec decrements the counter by the given amount.
+func (c *ShardedCounter) Dec(i int64) { c.shards.add(-i) }
+
+// Inc increments the counter by the given amount.
+func (c *ShardedCounter) Inc(i int64) { c.shards.add(i) }
+
+// Snapshot returns a read-only copy of the counter.
+func (c *ShardedCounter) Snapshot() Counter {
+	return CounterSnapshot(c.Count())
+}
+
+// String formats the count for debugging.
+func (c *ShardedCounter) String() string { return counterString(c) }
+
+// GetOrRegisterShardedMeter returns an existing Meter or constructs and
+// registers a new sharded StandardMeter.
+func GetOrRegisterShardedMeter(name string, r Registry) Meter {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, NewShardedMeter).(Meter)
+}
+
+// NewShardedMeter constructs a new StandardMeter ticked by DefaultTickSource
+// whose count is striped across shards as a ShardedCounter's is, for meters
+// marked from many cores at once.  Mark adds to a shard and nothing else, so
+// the mean rate read by RateMean is refreshed only by ticks and snapshots.
+func NewShardedMeter() Meter {
+	if metricsDisabled || UseNilMetrics {
+		return NilMeter{}
+	}
+	m := newStandardMeter()
+	m.shards = newCounterShards()
+	m.tickBy(DefaultTickSource)
+	return m
+}
+
+// NewRegisteredShardedMeter constructs and registers a new sharded
+// StandardMeter.
+func NewRegisteredShardedMeter(name string, r Registry) Meter {
+	c := NewShardedMeter()
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// counterShard is one stripe of a sharded count, padded to two cache lines
+// since x86's spatial prefetcher fetches lines in pairs.
+type counterShard struct {
+	n atomic.Int64
+	_ [128 - 8]byte
+}
+
+// counterShards is a count striped across a power of two of shards.  The
+// nil counterShards is always zero.
+type counterShards []counterShard
+
+// newCounterShards constructs counterShards with a shard for each of
+// GOMAXPROCS, rounded up to a power of two.
+func newCounterShards() counterShards {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n *= 2
+	}
+	return make(counterShards, n)
+}
+
+func (s counterShards) add(n int64) {
+	hint := shardHints.Get().(*uint32)
+	s[*hint&uint32(len(s)-1)].n.Add(n)
+	shardHints.Put(hint)
+}
+
+func (s counterShards) clear() {
+	for i := range s {
+		s[i].n.Store(0)
+	}
+}
+
+func (s counterShards) sum() int64 {
+	var sum int64
+	for i := range s {
+		sum += s[i].n.Load()
+	}
+	return sum
+}
+
+// shardHints holds shard indices.  A sync.Pool keeps an item for each
+// processor, so a goroutine almost always gets back the index last put by
+// another on the same processor, spreading processors across shards without
+// any shared write.  Indices dropped by the garbage collector are replaced
+// by the next in turn.
+var (
+	shardHints = sync.Pool{New: func() interface{} {
+		hint := nextShardHint.Add(1)
+		return &hint
+	}}
+	nextShardHint atomic.Uint32
+)
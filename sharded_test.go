@@ -0,0 +1,97 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"sync"
+	"testing"
+)
+
+func BenchmarkShardedCounter(b *testing.B) {
+	c := NewShardedCounter()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc(1)
+		}
+	})
+}
+
+func BenchmarkShardedCounterStandard(b *testing.B) {
+	c := NewCounter()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc(1)
+		}
+	})
+}
+
+func BenchmarkShardedMeter(b *testing.B) {
+	m := NewShardedMeter()
+	defer m.(*StandardMeter).Stop()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.Mark(1)
+		}
+	})
+}
+
+func TestShardedCounter(t *testing.T) {
+	c := NewShardedCounter()
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Inc(2)
+				c.Dec(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if count := c.Count(); 16000 != count {
+		t.Errorf("c.Count(): 16000 != %v\n", count)
+	}
+	if count := c.Snapshot().Count(); 16000 != count {
+		t.Errorf("c.Snapshot().Count(): 16000 != %v\n", count)
+	}
+	c.Clear()
+	if count := c.Count(); 0 != count {
+		t.Errorf("c.Count(): 0 != %v\n", count)
+	}
+}
+
+func TestShardedMeter(t *testing.T) {
+	m := newStandardMeter()
+	m.shards = newCounterShards()
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Mark(1)
+			}
+		}()
+	}
+	wg.Wait()
+	m.Tick()
+	if count := m.Count(); 16000 != count {
+		t.Errorf("m.Count(): 16000 != %v\n", count)
+	}
+	if rate := m.Rate1(); 16000.0/5 != rate {
+		t.Errorf("m.Rate1(): %v != %v\n", 16000.0/5, rate)
+	}
+	if snapshot := m.Snapshot(); 16000 != snapshot.Count() || 0 == snapshot.RateMean() {
+		t.Errorf("m.Snapshot(): %v\n", snapshot)
+	}
+}
+
+func TestGetOrRegisterShardedCounter(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredShardedCounter("foo", r).Inc(47)
+	if c := GetOrRegisterShardedCounter("foo", r); 47 != c.Count() {
+		t.Fatal(c)
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// LoadShedderConfig configures a LoadShedder.  Either limit may be left zero
+// to ignore its metric.
+type LoadShedderConfig struct {
+	InFlight    Gauge         // Gauge of the requests in flight
+	MaxInFlight int64         // In-flight requests above which to shed
+	Latency     Timer         // Timer of the requests' latencies
+	MaxLatency  time.Duration // Latency percentile above which to shed
+	Percentile  float64       // Latency percentile to compare, 0.99 if zero
+	Hysteresis  float64       // Fraction below the limits at which to stop shedding, 0.1 if zero
+	Interval    time.Duration // Latency percentile recomputation interval, one second if zero
+}
+
+// A LoadShedder decides whether to admit work based on the metrics which
+// measure the load on a server, such as its requests in flight and their
+// latency.  It starts shedding load when either metric exceeds its limit and
+// stops only once both have fallen below their limits by the configured
+// hysteresis, so that it doesn't flap around a limit.
+//
+// The in-flight gauge is read on every decision but the latency percentile,
+// which is costly to compute, at most once per Interval.
+type LoadShedder struct {
+	config     LoadShedderConfig
+	latency    time.Duration
+	mutex      sync.Mutex
+	nextUpdate time.Time
+	shedding   bool
+}
+
+// NewLoadShedder constructs a new LoadShedder.
+func NewLoadShedder(c LoadShedderConfig) *LoadShedder {
+	if 0 == c.Percentile {
+		c.Percentile = 0.99
+	}
+	if 0 == c.Hysteresis {
+		c.Hysteresis = 0.1
+	}
+	if 0 == c.Interval {
+		c.Interval = time.Second
+	}
+	return &LoadShedder{config: c}
+}
+
+// Admit returns whether to admit a unit of work, false if load is being
+// shed.
+func (s *LoadShedder) Admit() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var inFlight int64
+	if nil != s.config.InFlight {
+		inFlight = s.config.InFlight.Value()
+	}
+	if nil != s.config.Latency {
+		if now := time.Now(); !now.Before(s.nextUpdate) {
+			s.latency = time.Duration(s.config.Latency.Percentile(s.config.Percentile))
+			s.nextUpdate = now.Add(s.config.Interval)
+		}
+	}
+	if s.shedding {
+		s.shedding = s.over(inFlight, s.latency, 1-s.config.Hysteresis)
+	} else {
+		s.shedding = s.over(inFlight, s.latency, 1)
+	}
+	return !s.shedding
+}
+
+// Shedding returns whether load was being shed as of the last decision.
+func (s *LoadShedder) Shedding() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.shedding
+}
+
+// over returns whether either metric exceeds its limit scaled by the given
+// factor.
+func (s *LoadShedder) over(inFlight int64, latency time.Duration, factor float64) bool {
+	if 0 < s.config.MaxInFlight && float64(inFlight) > factor*float64(s.config.MaxInFlight) {
+		return true
+	}
+	if 0 < s.config.MaxLatency && float64(latency) > factor*float64(s.config.MaxLatency) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadShedderInFlight(t *testing.T) {
+	g := NewGauge()
+	s := NewLoadShedder(LoadShedderConfig{InFlight: g, MaxInFlight: 100})
+	for _, c := range []struct {
+		inFlight int64
+		admit    bool
+	}{
+		{50, true},
+		{101, false},
+		{95, false}, // Within the hysteresis
+		{89, true},
+		{95, true},
+	} {
+		g.Update(c.inFlight)
+		if admit := s.Admit(); c.admit != admit {
+			t.Errorf("s.Admit() with %d in flight: %v != %v\n", c.inFlight, c.admit, admit)
+		}
+	}
+}
+
+func TestLoadShedderLatency(t *testing.T) {
+	timer := NewTimer()
+	s := NewLoadShedder(LoadShedderConfig{
+		Latency:    timer,
+		MaxLatency: 100 * time.Millisecond,
+		Interval:   time.Hour,
+	})
+	timer.Update(10 * time.Millisecond)
+	if !s.Admit() {
+		t.Error("s.Admit(): expected to admit below the latency limit")
+	}
+	for i := 0; i < 100; i++ {
+		timer.Update(time.Second)
+	}
+	if !s.Admit() {
+		t.Error("s.Admit(): expected the latency not to be recomputed within the interval")
+	}
+	s.nextUpdate = time.Time{}
+	if s.Admit() {
+		t.Error("s.Admit(): expected to shed above the latency limit")
+	}
+	if !s.Shedding() {
+		t.Error("s.Shedding(): expected true")
+	}
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// sliBuckets is the number of intervals into which a LatencySLI divides its
+// window, so that old observations expire a tenth of the window at a time.
+const sliBuckets = 10
+
+// A LatencySLI maintains the fraction of the durations observed in a sliding
+// window which were within a threshold, good events over total events, so
+// that a latency SLO is exported as a simple ratio from which burn rates may
+// be alerted on rather than derived from percentiles by every consumer.  It
+// updates a Timer with every duration as well, if it's given one, so that it
+// may take the timer's place where durations are recorded.
+//
+// The ratio is registered as a GaugeFloat64 and so exported as any other.
+// It's 1 while the window holds no observations, since none of them missed
+// the threshold.  A LatencySLI constructed while metrics are disabled
+// observes nothing but still updates its timer.
+type LatencySLI struct {
+	bucketAge time.Duration
+	buckets   [sliBuckets]sliBucket
+	disabled  bool // constructed while metrics were disabled
+	mutex     sync.Mutex
+	threshold time.Duration
+	timer     Timer
+}
+
+type sliBucket struct {
+	epoch, good, total int64
+}
+
+// GetOrRegisterLatencySLI returns an existing LatencySLI or constructs and
+// registers a new one whose ratio is registered under the given name.
+func GetOrRegisterLatencySLI(name string, r Registry, t Timer, threshold, window time.Duration) *LatencySLI {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return unwrap(r.GetOrRegister(name, func() GaugeFloat64 {
+		return &sliRatio{NewLatencySLI(t, threshold, window)}
+	})).(*sliRatio).sli
+}
+
+// NewLatencySLI constructs a new LatencySLI of the durations observed in the
+// last window which were within the given threshold, updating the given
+// timer, if it's not nil, with every duration.
+func NewLatencySLI(t Timer, threshold, window time.Duration) *LatencySLI {
+	if metricsDisabled || UseNilMetrics {
+		return &LatencySLI{disabled: true, threshold: threshold, timer: t}
+	}
+	bucketAge := window / sliBuckets
+	if bucketAge <= 0 {
+		bucketAge = 1
+	}
+	return &LatencySLI{bucketAge: bucketAge, threshold: threshold, timer: t}
+}
+
+// NewRegisteredLatencySLI constructs a new LatencySLI and registers its ratio
+// under the given name.
+func NewRegisteredLatencySLI(name string, r Registry, t Timer, threshold, window time.Duration) *LatencySLI {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	sli := NewLatencySLI(t, threshold, window)
+	r.Register(name, &sliRatio{sli})
+	return sli
+}
+
+// Good returns the number of durations observed in the window which were
+// within the threshold.
+func (sli *LatencySLI) Good() int64 {
+	good, _ := sli.counts(time.Now())
+	return good
+}
+
+// Ratio returns the fraction of the durations observed in the window which
+// were within the threshold.
+func (sli *LatencySLI) Ratio() float64 {
+	good, total := sli.counts(time.Now())
+	if 0 == total {
+		return 1
+	}
+	return float64(good) / float64(total)
+}
+
+// String formats the ratio and the counts it's of for debugging.
+func (sli *LatencySLI) String() string { return latencySLIString(sli) }
+
+// Threshold returns the duration within which an observation is good.
+func (sli *LatencySLI) Threshold() time.Duration { return sli.threshold }
+
+// Time records the duration of the execution of the given function.
+func (sli *LatencySLI) Time(f func()) {
+	ts := time.Now()
+	f()
+	sli.UpdateSince(ts)
+}
+
+// Timer returns the timer updated with every duration, or nil if there's
+// none.
+func (sli *LatencySLI) Timer() Timer { return sli.timer }
+
+// Total returns the number of durations observed in the window.
+func (sli *LatencySLI) Total() int64 {
+	_, total := sli.counts(time.Now())
+	return total
+}
+
+// Update records a duration.
+func (sli *LatencySLI) Update(d time.Duration) {
+	sli.update(time.Now(), d)
+}
+
+// UpdateSince records the duration since the given time.
+func (sli *LatencySLI) UpdateSince(ts time.Time) {
+	sli.Update(time.Since(ts))
+}
+
+// counts returns the numbers of good and of all durations observed in the
+// window ending at the given time.
+func (sli *LatencySLI) counts(t time.Time) (good, total int64) {
+	if sli.disabled {
+		return 0, 0
+	}
+	epoch := t.UnixNano() / int64(sli.bucketAge)
+	sli.mutex.Lock()
+	defer sli.mutex.Unlock()
+	for _, b := range sli.buckets {
+		if epoch-sliBuckets < b.epoch && b.epoch <= epoch {
+			good += b.good
+			total += b.total
+		}
+	}
+	return good, total
+}
+
+func (sli *LatencySLI) update(t time.Time, d time.Duration) {
+	if nil != sli.timer {
+		sli.timer.Update(d)
+	}
+	if sli.disabled {
+		return
+	}
+	epoch := t.UnixNano() / int64(sli.bucketAge)
+	sli.mutex.Lock()
+	defer sli.mutex.Unlock()
+	b := &sli.buckets[epoch%sliBuckets]
+	if b.epoch != epoch {
+		*b = sliBucket{epoch: epoch}
+	}
+	b.total++
+	if d <= sli.threshold {
+		b.good++
+	}
+}
+
+// sliRatio is the GaugeFloat64 under which a LatencySLI is registered.
+type sliRatio struct {
+	sli *LatencySLI
+}
+
+func (g *sliRatio) Snapshot() GaugeFloat64 { return GaugeFloat64Snapshot(g.Value()) }
+
+func (g *sliRatio) String() string { return gaugeFloat64String(g) }
+
+func (*sliRatio) Update(float64) {
+	panic("Update called on a LatencySLI's ratio")
+}
+
+func (g *sliRatio) Value() float64 { return g.sli.Ratio() }
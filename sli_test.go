@@ -0,0 +1,48 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencySLI(t *testing.T) {
+	r := NewRegistry()
+	timer := NewTimer()
+	sli := GetOrRegisterLatencySLI("api.sli", r, timer, 100*time.Millisecond, time.Minute)
+	if ratio := r.Get("api.sli").(GaugeFloat64).Value(); 1 != ratio {
+		t.Errorf("api.sli.Value(): 1 != %v with no observations\n", ratio)
+	}
+	sli.Update(50 * time.Millisecond)
+	sli.Update(100 * time.Millisecond)
+	sli.Update(150 * time.Millisecond)
+	sli.Update(time.Second)
+	if ratio := r.Get("api.sli").(GaugeFloat64).Value(); 0.5 != ratio {
+		t.Errorf("api.sli.Value(): 0.5 != %v\n", ratio)
+	}
+	if count := timer.Count(); 4 != count {
+		t.Errorf("timer.Count(): 4 != %v\n", count)
+	}
+	if GetOrRegisterLatencySLI("api.sli", r, nil, 0, 0) != sli {
+		t.Error("GetOrRegisterLatencySLI(): expected the registered SLI")
+	}
+}
+
+func TestLatencySLIWindow(t *testing.T) {
+	sli := NewLatencySLI(nil, time.Millisecond, 10*time.Second)
+	start := time.Unix(1000, 0)
+	sli.update(start, time.Second)
+	sli.update(start.Add(5*time.Second), 0)
+	if good, total := sli.counts(start.Add(9 * time.Second)); 1 != good || 2 != total {
+		t.Errorf("sli.counts(): 1, 2 != %v, %v\n", good, total)
+	}
+	if good, total := sli.counts(start.Add(10 * time.Second)); 1 != good || 1 != total {
+		t.Errorf("sli.counts(): 1, 1 != %v, %v after the first expired\n", good, total)
+	}
+	sli.update(start.Add(30*time.Second), time.Second)
+	if good, total := sli.counts(start.Add(30 * time.Second)); 0 != good || 1 != total {
+		t.Errorf("sli.counts(): 0, 1 != %v, %v\n", good, total)
+	}
+}
@@ -0,0 +1,209 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags used by SNMP.
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagCounter32      = 0x41
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMIBView   = 0x82
+	tagGetRequest     = 0xa0
+	tagGetNextRequest = 0xa1
+	tagGetResponse    = 0xa2
+)
+
+var errTruncated = errors.New("snmp: truncated BER encoding")
+
+// An oid is an object identifier as a slice of its sub-identifiers.
+type oid []uint32
+
+// parseOID parses an OID in dotted-decimal form, with or without a leading
+// dot.
+func parseOID(s string) (oid, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("snmp: OID %q has fewer than two sub-identifiers", s)
+	}
+	o := make(oid, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if nil != err {
+			return nil, fmt.Errorf("snmp: invalid OID %q", s)
+		}
+		o[i] = uint32(n)
+	}
+	if o[0] > 2 || o[0] < 2 && o[1] >= 40 {
+		return nil, fmt.Errorf("snmp: invalid OID %q", s)
+	}
+	return o, nil
+}
+
+// compare returns -1, 0, or 1 as o sorts before, with, or after p in
+// lexicographic order, the order of a MIB walk.
+func (o oid) compare(p oid) int {
+	for i := 0; i < len(o) && i < len(p); i++ {
+		if o[i] < p[i] {
+			return -1
+		}
+		if o[i] > p[i] {
+			return 1
+		}
+	}
+	switch {
+	case len(o) < len(p):
+		return -1
+	case len(o) > len(p):
+		return 1
+	}
+	return 0
+}
+
+func (o oid) String() string {
+	parts := make([]string, len(o))
+	for i, n := range o {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// appendTLV appends the BER encoding of a tag, length, and value to b.
+func appendTLV(b []byte, tag byte, value []byte) []byte {
+	b = append(b, tag)
+	if n := len(value); n < 0x80 {
+		b = append(b, byte(n))
+	} else {
+		var length []byte
+		for ; 0 < n; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		b = append(b, 0x80|byte(len(length)))
+		b = append(b, length...)
+	}
+	return append(b, value...)
+}
+
+// parseTLV parses the BER encoding of a tag, length, and value from the
+// start of b and returns them with the bytes which follow.
+func parseTLV(b []byte) (tag byte, value, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if 0x80 <= n {
+		octets := n & 0x7f
+		if 0 == octets || 4 < octets || len(b) < octets {
+			return 0, nil, nil, errTruncated
+		}
+		n = 0
+		for _, c := range b[:octets] {
+			n = n<<8 | int(c)
+		}
+		b = b[octets:]
+	}
+	if n < 0 || len(b) < n {
+		return 0, nil, nil, errTruncated
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+// parseExpected parses a TLV from the start of b which must have the given
+// tag.
+func parseExpected(b []byte, tag byte) (value, rest []byte, err error) {
+	t, value, rest, err := parseTLV(b)
+	if nil == err && tag != t {
+		err = fmt.Errorf("snmp: expected tag 0x%02x, found 0x%02x", tag, t)
+	}
+	return value, rest, err
+}
+
+func encodeInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; !(0 == v && b[0] < 0x80 || -1 == v && 0x80 <= b[0]); v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+func encodeUint(v uint64) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; 0 < v; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if 0x80 <= b[0] {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func decodeInt(b []byte) (int64, error) {
+	if 0 == len(b) || 8 < len(b) {
+		return 0, errors.New("snmp: invalid INTEGER")
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+func encodeOID(o oid) []byte {
+	b := appendBase128(nil, o[0]*40+o[1])
+	for _, n := range o[2:] {
+		b = appendBase128(b, n)
+	}
+	return b
+}
+
+func appendBase128(b []byte, n uint32) []byte {
+	var septets []byte
+	for septets = []byte{byte(n & 0x7f)}; 0x80 <= n; {
+		n >>= 7
+		septets = append([]byte{0x80 | byte(n&0x7f)}, septets...)
+	}
+	return append(b, septets...)
+}
+
+func decodeOID(b []byte) (oid, error) {
+	var (
+		o oid
+		n uint64
+	)
+	for i, c := range b {
+		n = n<<7 | uint64(c&0x7f)
+		if n > 0xffffffff {
+			return nil, errors.New("snmp: invalid OID")
+		}
+		if 0 != c&0x80 {
+			if len(b)-1 == i {
+				return nil, errTruncated
+			}
+			continue
+		}
+		if nil == o {
+			if n < 80 {
+				o = oid{uint32(n / 40), uint32(n % 40)}
+			} else {
+				o = oid{2, uint32(n - 80)}
+			}
+		} else {
+			o = append(o, uint32(n))
+		}
+		n = 0
+	}
+	if nil == o {
+		return nil, errors.New("snmp: empty OID")
+	}
+	return o, nil
+}
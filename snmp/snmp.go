@@ -0,0 +1,309 @@
+// Package snmp is a minimal, read-only SNMP agent which answers GET and
+// GETNEXT requests for metrics in a registry, for environments where a
+// legacy network management system is the only thing scraping hosts.
+//
+// Only SNMPv1 and SNMPv2c are spoken, requests whose community doesn't match
+// the agent's are dropped, and every other request type is answered with a
+// genErr, so the agent should be exposed only to the management network.
+//
+//	a, err := snmp.NewAgent(metrics.DefaultRegistry, "public", []snmp.Mapping{
+//		{OID: "1.3.6.1.4.1.99999.1.1.0", Name: "requests", Field: "count"},
+//		{OID: "1.3.6.1.4.1.99999.1.2.0", Name: "latency", Field: "p99", Scale: 1e-6},
+//	})
+//	if nil != err {
+//		log.Fatal(err)
+//	}
+//	go a.ListenAndServe(":161")
+package snmp
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// SNMP versions as encoded in messages.
+const (
+	version1  = 0
+	version2c = 1
+)
+
+// SNMP error statuses.
+const (
+	noError    = 0
+	noSuchName = 2
+	genErr     = 5
+)
+
+// A Mapping exposes one field of a metric in the registry, as named by
+// metrics.MetricField, at an OID.  Scalar OIDs conventionally end in ".0".
+//
+// Fields named "count" are exposed as Counter64 values, or as Counter32
+// values truncated to 32 bits to SNMPv1 managers, which lack Counter64.
+// Every other field is multiplied by Scale, or by one if Scale is zero, and
+// exposed as an INTEGER, rounded and clamped to 32 bits, since SNMP has no
+// floating-point type.  A Scale of 1e-6, for example, exposes nanosecond
+// durations in milliseconds and one of 1000 exposes rates in thousandths.
+type Mapping struct {
+	OID   string
+	Name  string
+	Field string
+	Scale float64
+}
+
+// Agent answers SNMP requests for the metrics in a registry.
+type Agent struct {
+	community string
+	entries   []entry // sorted by OID
+	registry  metrics.Registry
+}
+
+type entry struct {
+	oid oid
+	Mapping
+}
+
+// NewAgent constructs an Agent which answers requests with the given
+// community for the metrics in r according to the given mappings.  It
+// returns an error if an OID is invalid or mapped more than once.
+func NewAgent(r metrics.Registry, community string, mappings []Mapping) (*Agent, error) {
+	if nil == r {
+		r = metrics.DefaultRegistry
+	}
+	a := &Agent{community: community, registry: r}
+	for _, m := range mappings {
+		o, err := parseOID(m.OID)
+		if nil != err {
+			return nil, err
+		}
+		a.entries = append(a.entries, entry{o, m})
+	}
+	sort.Sort(byOID(a.entries))
+	for i := 1; i < len(a.entries); i++ {
+		if 0 == a.entries[i-1].oid.compare(a.entries[i].oid) {
+			return nil, fmt.Errorf("snmp: OID %v is mapped more than once", a.entries[i].oid)
+		}
+	}
+	return a, nil
+}
+
+// ListenAndServe listens for requests on the given UDP address, such as
+// ":161", and answers them until reading from the socket fails.
+func (a *Agent) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if nil != err {
+		return err
+	}
+	defer conn.Close()
+	return a.Serve(conn)
+}
+
+// Serve answers requests read from the given connection until reading from
+// it fails.  Malformed requests and those with the wrong community are
+// dropped.
+func (a *Agent) Serve(conn net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if nil != err {
+			return err
+		}
+		resp, err := a.handle(buf[:n])
+		if nil != err {
+			log.Printf("snmp: request from %v: %v", addr, err)
+			continue
+		}
+		if nil == resp {
+			continue
+		}
+		if _, err := conn.WriteTo(resp, addr); nil != err {
+			log.Printf("snmp: response to %v: %v", addr, err)
+		}
+	}
+}
+
+// handle returns the response to an encoded request or nil if the request
+// should be dropped.
+func (a *Agent) handle(req []byte) ([]byte, error) {
+	msg, _, err := parseExpected(req, tagSequence)
+	if nil != err {
+		return nil, err
+	}
+	value, msg, err := parseExpected(msg, tagInteger)
+	if nil != err {
+		return nil, err
+	}
+	version, err := decodeInt(value)
+	if nil != err {
+		return nil, err
+	}
+	if version1 != version && version2c != version {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+	community, msg, err := parseExpected(msg, tagOctetString)
+	if nil != err {
+		return nil, err
+	}
+	if a.community != string(community) {
+		return nil, nil
+	}
+	pduType, pdu, _, err := parseTLV(msg)
+	if nil != err {
+		return nil, err
+	}
+	requestID, pdu, err := parseExpected(pdu, tagInteger)
+	if nil != err {
+		return nil, err
+	}
+	if _, pdu, err = parseExpected(pdu, tagInteger); nil != err {
+		return nil, err
+	}
+	if _, pdu, err = parseExpected(pdu, tagInteger); nil != err {
+		return nil, err
+	}
+	list, _, err := parseExpected(pdu, tagSequence)
+	if nil != err {
+		return nil, err
+	}
+	var oids []oid
+	for 0 < len(list) {
+		var binding, value []byte
+		if binding, list, err = parseExpected(list, tagSequence); nil != err {
+			return nil, err
+		}
+		if value, _, err = parseExpected(binding, tagOID); nil != err {
+			return nil, err
+		}
+		o, err := decodeOID(value)
+		if nil != err {
+			return nil, err
+		}
+		oids = append(oids, o)
+	}
+
+	var (
+		bindings    []byte
+		errorStatus int64
+		errorIndex  int64
+	)
+	for i, o := range oids {
+		var binding []byte
+		switch pduType {
+		case tagGetRequest:
+			binding = a.get(o, version)
+		case tagGetNextRequest:
+			binding = a.getNext(o, version)
+		default:
+			errorStatus, errorIndex = genErr, int64(i+1)
+		}
+		if nil == binding {
+			if noError == errorStatus {
+				errorStatus, errorIndex = noSuchName, int64(i+1)
+			}
+			binding = appendTLV(appendTLV(nil, tagOID, encodeOID(o)), tagNull, nil)
+		}
+		bindings = append(bindings, appendTLV(nil, tagSequence, binding)...)
+	}
+	if noError != errorStatus {
+		bindings = nil
+		for _, o := range oids {
+			binding := appendTLV(appendTLV(nil, tagOID, encodeOID(o)), tagNull, nil)
+			bindings = append(bindings, appendTLV(nil, tagSequence, binding)...)
+		}
+	}
+
+	pdu = appendTLV(nil, tagInteger, requestID)
+	pdu = appendTLV(pdu, tagInteger, encodeInt(errorStatus))
+	pdu = appendTLV(pdu, tagInteger, encodeInt(errorIndex))
+	pdu = appendTLV(pdu, tagSequence, bindings)
+	msg = appendTLV(nil, tagInteger, encodeInt(version))
+	msg = appendTLV(msg, tagOctetString, community)
+	msg = appendTLV(msg, tagGetResponse, pdu)
+	return appendTLV(nil, tagSequence, msg), nil
+}
+
+// get returns the encoded variable binding for the given OID or, if it
+// isn't mapped to a value, an SNMPv2c exception or nil for SNMPv1.
+func (a *Agent) get(o oid, version int64) []byte {
+	i := sort.Search(len(a.entries), func(i int) bool {
+		return a.entries[i].oid.compare(o) >= 0
+	})
+	if i < len(a.entries) && 0 == a.entries[i].oid.compare(o) {
+		if binding := a.binding(a.entries[i], version); nil != binding {
+			return binding
+		}
+		return exception(o, tagNoSuchInstance, version)
+	}
+	return exception(o, tagNoSuchObject, version)
+}
+
+// getNext returns the encoded variable binding for the first OID after the
+// given one which is mapped to a value or, if there is none, an SNMPv2c
+// exception or nil for SNMPv1.
+func (a *Agent) getNext(o oid, version int64) []byte {
+	i := sort.Search(len(a.entries), func(i int) bool {
+		return a.entries[i].oid.compare(o) > 0
+	})
+	for ; i < len(a.entries); i++ {
+		if binding := a.binding(a.entries[i], version); nil != binding {
+			return binding
+		}
+	}
+	return exception(o, tagEndOfMIBView, version)
+}
+
+// binding returns the encoded variable binding for an entry or nil if its
+// metric isn't registered or has no such field.
+func (a *Agent) binding(e entry, version int64) []byte {
+	v, ok := metrics.MetricField(a.registry.Get(e.Name), e.Field)
+	if !ok {
+		return nil
+	}
+	b := appendTLV(nil, tagOID, encodeOID(e.oid))
+	if "count" == e.Field {
+		count := uint64(0)
+		if 0 < v {
+			count = uint64(v)
+		}
+		if version1 == version {
+			return appendTLV(b, tagCounter32, encodeUint(count&0xffffffff))
+		}
+		return appendTLV(b, tagCounter64, encodeUint(count))
+	}
+	if 0 != e.Scale {
+		v *= e.Scale
+	}
+	return appendTLV(b, tagInteger, encodeInt(clampInt32(v)))
+}
+
+// exception returns the encoded variable binding of an SNMPv2c exception
+// for the given OID or nil for SNMPv1, which reports a noSuchName error
+// instead.
+func exception(o oid, tag byte, version int64) []byte {
+	if version1 == version {
+		return nil
+	}
+	return appendTLV(appendTLV(nil, tagOID, encodeOID(o)), tag, nil)
+}
+
+func clampInt32(v float64) int64 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v >= math.MaxInt32:
+		return math.MaxInt32
+	case v <= math.MinInt32:
+		return math.MinInt32
+	}
+	return int64(math.Floor(v + 0.5))
+}
+
+type byOID []entry
+
+func (e byOID) Len() int           { return len(e) }
+func (e byOID) Less(i, j int) bool { return e[i].oid.compare(e[j].oid) < 0 }
+func (e byOID) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
@@ -0,0 +1,153 @@
+package snmp
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func request(t *testing.T, a *Agent, version int64, community string, pduType byte, oids ...string) (errorStatus int64, bindings [][2][]byte) {
+	var list []byte
+	for _, s := range oids {
+		o, err := parseOID(s)
+		if nil != err {
+			t.Fatal(err)
+		}
+		binding := appendTLV(appendTLV(nil, tagOID, encodeOID(o)), tagNull, nil)
+		list = appendTLV(list, tagSequence, binding)
+	}
+	pdu := appendTLV(nil, tagInteger, encodeInt(47))
+	pdu = appendTLV(pdu, tagInteger, encodeInt(0))
+	pdu = appendTLV(pdu, tagInteger, encodeInt(0))
+	pdu = appendTLV(pdu, tagSequence, list)
+	msg := appendTLV(nil, tagInteger, encodeInt(version))
+	msg = appendTLV(msg, tagOctetString, []byte(community))
+	msg = appendTLV(msg, pduType, pdu)
+	resp, err := a.handle(appendTLV(nil, tagSequence, msg))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if nil == resp {
+		return -1, nil
+	}
+
+	msg, _, err = parseExpected(resp, tagSequence)
+	if nil != err {
+		t.Fatal(err)
+	}
+	_, msg, _ = parseExpected(msg, tagInteger)
+	_, msg, _ = parseExpected(msg, tagOctetString)
+	pdu, _, err = parseExpected(msg, tagGetResponse)
+	if nil != err {
+		t.Fatal(err)
+	}
+	requestID, pdu, _ := parseExpected(pdu, tagInteger)
+	if id, _ := decodeInt(requestID); 47 != id {
+		t.Errorf("request ID: 47 != %v\n", id)
+	}
+	value, pdu, _ := parseExpected(pdu, tagInteger)
+	errorStatus, _ = decodeInt(value)
+	_, pdu, _ = parseExpected(pdu, tagInteger)
+	list, _, err = parseExpected(pdu, tagSequence)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for 0 < len(list) {
+		var binding []byte
+		binding, list, _ = parseExpected(list, tagSequence)
+		o, binding, _ := parseExpected(binding, tagOID)
+		tag, value, _, _ := parseTLV(binding)
+		bindings = append(bindings, [2][]byte{o, append([]byte{tag}, value...)})
+	}
+	return errorStatus, bindings
+}
+
+func newTestAgent(t *testing.T) *Agent {
+	r := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("requests", r).Inc(1 << 33)
+	metrics.NewRegisteredGaugeFloat64("load", r).Update(1.5)
+	a, err := NewAgent(r, "public", []Mapping{
+		{OID: "1.3.6.1.4.1.99999.1.2.0", Name: "load", Field: "value", Scale: 1000},
+		{OID: "1.3.6.1.4.1.99999.1.1.0", Name: "requests", Field: "count"},
+		{OID: "1.3.6.1.4.1.99999.1.3.0", Name: "missing", Field: "count"},
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAgentGet(t *testing.T) {
+	a := newTestAgent(t)
+	errorStatus, bindings := request(t, a, version2c, "public", tagGetRequest, "1.3.6.1.4.1.99999.1.1.0", "1.3.6.1.4.1.99999.1.3.0")
+	if noError != errorStatus || 2 != len(bindings) {
+		t.Fatalf("GET: %v, %v\n", errorStatus, bindings)
+	}
+	if tag, v := bindings[0][1][0], bindings[0][1][1:]; tagCounter64 != tag || "\x02\x00\x00\x00\x00" != string(v) {
+		t.Errorf("GET requests: 0x%02x %x\n", tag, v)
+	}
+	if tag := bindings[1][1][0]; tagNoSuchInstance != tag {
+		t.Errorf("GET missing: 0x%02x\n", tag)
+	}
+	if errorStatus, _ := request(t, a, version1, "public", tagGetRequest, "1.3.6.1.4.1.99999.1.3.0"); noSuchName != errorStatus {
+		t.Errorf("SNMPv1 GET missing: %v\n", errorStatus)
+	}
+	if errorStatus, bindings := request(t, a, version2c, "private", tagGetRequest, "1.3.6.1.4.1.99999.1.1.0"); nil != bindings {
+		t.Errorf("GET with the wrong community: %v, %v\n", errorStatus, bindings)
+	}
+}
+
+func TestAgentGetNext(t *testing.T) {
+	a := newTestAgent(t)
+	var walk []string
+	s := "1.3.6.1.4.1.99999"
+	for i := 0; i < 10; i++ {
+		errorStatus, bindings := request(t, a, version2c, "public", tagGetNextRequest, s)
+		if noError != errorStatus || 1 != len(bindings) {
+			t.Fatalf("GETNEXT %v: %v, %v\n", s, errorStatus, bindings)
+		}
+		if tagEndOfMIBView == bindings[0][1][0] {
+			break
+		}
+		o, err := decodeOID(bindings[0][0])
+		if nil != err {
+			t.Fatal(err)
+		}
+		s = o.String()
+		if tagInteger == bindings[0][1][0] {
+			if v, _ := decodeInt(bindings[0][1][1:]); 1500 != v {
+				t.Errorf("GETNEXT %v: 1500 != %v\n", s, v)
+			}
+		}
+		walk = append(walk, s)
+	}
+	if 2 != len(walk) || "1.3.6.1.4.1.99999.1.1.0" != walk[0] || "1.3.6.1.4.1.99999.1.2.0" != walk[1] {
+		t.Errorf("walk: %v\n", walk)
+	}
+}
+
+func TestNewAgentDuplicateOID(t *testing.T) {
+	if _, err := NewAgent(nil, "public", []Mapping{
+		{OID: "1.3.6.1.4.1.99999.1.1.0", Name: "a", Field: "count"},
+		{OID: ".1.3.6.1.4.1.99999.1.1.0", Name: "b", Field: "count"},
+	}); nil == err {
+		t.Error("NewAgent: expected an error")
+	}
+}
+
+func TestOID(t *testing.T) {
+	for _, s := range []string{"1.3.6.1.4.1.99999.1.128.0", "2.999.3", "1.3.6.1.2.1.1.1.0"} {
+		o, err := parseOID(s)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if p, err := decodeOID(encodeOID(o)); nil != err || s != p.String() {
+			t.Errorf("decodeOID(encodeOID(%v)): %v, %v\n", s, p, err)
+		}
+	}
+	for _, v := range []int64{0, 127, 128, -1, -129, 1 << 40} {
+		if w, err := decodeInt(encodeInt(v)); nil != err || v != w {
+			t.Errorf("decodeInt(encodeInt(%v)): %v, %v\n", v, w, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// A TraceHook bridges spans to a tracing system.  StartSpan is called when a
+// span starts and returns a token, such as the tracer's own span, which is
+// passed to EndSpan along with the span's duration when it ends.  Both may
+// be called concurrently.
+type TraceHook interface {
+	StartSpan(name string) interface{}
+	EndSpan(name string, token interface{}, d time.Duration)
+}
+
+// traceHook holds the TraceHook set by SetTraceHook wrapped in a struct,
+// since an atomic.Value can't hold nil.
+var traceHook atomic.Value
+
+type traceHookValue struct {
+	hook TraceHook
+}
+
+// SetTraceHook sets the TraceHook notified of every span or, if h is nil,
+// stops notifying one.  Spans started before it's called notify the hook
+// that was set when they started.
+func SetTraceHook(h TraceHook) {
+	traceHook.Store(traceHookValue{h})
+}
+
+// TimedSpan is a span started by Span or StartSpan which has yet to end.
+type TimedSpan struct {
+	ended int32
+	hook  TraceHook
+	name  string
+	start time.Time
+	timer Timer
+	token interface{}
+}
+
+// Span starts a span which, when it ends, updates the Timer of the given
+// name in the default registry.  See StartSpan.
+func Span(name string) *TimedSpan {
+	return StartSpan(name, nil)
+}
+
+// StartSpan starts a span which, when it ends, updates the Timer of the given
+// name in the given registry, constructing and registering it if need be, so
+// that one call both times and traces a unit of work:
+//
+//	defer metrics.StartSpan("db.query", r).End()
+//
+// If a TraceHook has been set its StartSpan is called now and its EndSpan
+// when the span ends.
+func StartSpan(name string, r Registry) *TimedSpan {
+	s := &TimedSpan{
+		name:  name,
+		timer: GetOrRegisterTimer(name, r),
+	}
+	if v, ok := traceHook.Load().(traceHookValue); ok && nil != v.hook {
+		s.hook = v.hook
+		s.token = v.hook.StartSpan(name)
+	}
+	s.start = time.Now()
+	return s
+}
+
+// End ends the span, updating its Timer with the time since it started and
+// notifying the TraceHook, if any.  Only the first call has any effect.
+func (s *TimedSpan) End() {
+	d := time.Since(s.start)
+	if !atomic.CompareAndSwapInt32(&s.ended, 0, 1) {
+		return
+	}
+	s.timer.Update(d)
+	if nil != s.hook {
+		s.hook.EndSpan(s.name, s.token, d)
+	}
+}
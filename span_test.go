@@ -0,0 +1,79 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testTraceHook struct {
+	mutex  sync.Mutex
+	starts []string
+	ends   []interface{}
+}
+
+func (h *testTraceHook) StartSpan(name string) interface{} {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.starts = append(h.starts, name)
+	return len(h.starts)
+}
+
+func (h *testTraceHook) EndSpan(name string, token interface{}, d time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.ends = append(h.ends, token)
+}
+
+func BenchmarkSpan(b *testing.B) {
+	r := NewRegistry()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		StartSpan("foo", r).End()
+	}
+}
+
+func TestSpan(t *testing.T) {
+	r := NewRegistry()
+	s := StartSpan("foo", r)
+	time.Sleep(time.Millisecond)
+	s.End()
+	s.End()
+	timer, ok := r.Get("foo").(Timer)
+	if !ok {
+		t.Fatal("foo isn't a registered Timer")
+	}
+	if count := timer.Count(); 1 != count {
+		t.Errorf("timer.Count(): 1 != %v\n", count)
+	}
+	if min := timer.Min(); min < int64(time.Millisecond) {
+		t.Errorf("timer.Min(): %v < 1ms\n", min)
+	}
+}
+
+func TestSpanTraceHook(t *testing.T) {
+	h := &testTraceHook{}
+	SetTraceHook(h)
+	defer SetTraceHook(nil)
+	r := NewRegistry()
+	outer := StartSpan("outer", r)
+	StartSpan("inner", r).End()
+	outer.End()
+	if 2 != len(h.starts) || "outer" != h.starts[0] || "inner" != h.starts[1] {
+		t.Errorf("h.starts: [outer inner] != %v\n", h.starts)
+	}
+	if 2 != len(h.ends) || 2 != h.ends[0] || 1 != h.ends[1] {
+		t.Errorf("h.ends: [2 1] != %v\n", h.ends)
+	}
+	SetTraceHook(nil)
+	StartSpan("outer", r).End()
+	if 2 != len(h.starts) {
+		t.Errorf("len(h.starts): 2 != %v\n", len(h.starts))
+	}
+	if count := GetOrRegisterTimer("outer", r).Count(); 2 != count {
+		t.Errorf("outer.Count(): 2 != %v\n", count)
+	}
+}
@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TotalStage is the name under which a StagedTimer's total durations are
+// exported alongside its stages.
+const TotalStage = "total"
+
+// StagedTimers break the latency of a request down by named stages, such as
+// parse, backend, and render, keeping a DurationHistogram of each stage's
+// durations and another of the total under a single registration.  They're
+// exported as one family of metrics distinguished by a stage tag.
+//
+// Stages are created the first time they're used, so their names should
+// come from a small fixed set rather than from request data.
+type StagedTimer interface {
+	Clear()
+	Count() int64
+	Snapshot() StagedTimer
+	Stage(string) DurationHistogram
+	Stages() []string
+	Start() *StagedTiming
+	Total() DurationHistogram
+}
+
+// GetOrRegisterStagedTimer returns an existing StagedTimer or constructs and
+// registers a new StandardStagedTimer whose histograms are given Samples as
+// described by the registry's SampleConfig.
+func GetOrRegisterStagedTimer(name string, r Registry) StagedTimer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() StagedTimer {
+		return newStagedTimer(r.SampleConfig())
+	}).(StagedTimer)
+}
+
+// NewStagedTimer constructs a new StandardStagedTimer whose histograms are
+// given Samples as described by DefaultSampleConfig.
+func NewStagedTimer() StagedTimer {
+	return newStagedTimer(DefaultSampleConfig)
+}
+
+// NewRegisteredStagedTimer constructs and registers a new
+// StandardStagedTimer whose histograms are given Samples as described by the
+// registry's SampleConfig.
+func NewRegisteredStagedTimer(name string, r Registry) StagedTimer {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	c := newStagedTimer(r.SampleConfig())
+	r.Register(name, c)
+	return c
+}
+
+func newStagedTimer(c SampleConfig) StagedTimer {
+	if metricsDisabled || UseNilMetrics {
+		return NilStagedTimer{}
+	}
+	return &StandardStagedTimer{
+		sampleConfig: c,
+		stages:       make(map[string]DurationHistogram),
+		total:        NewDurationHistogram(c.NewSample()),
+	}
+}
+
+// StagedTiming times a single request through the stages of a StagedTimer.
+type StagedTiming struct {
+	last, start time.Time
+	timer       StagedTimer
+}
+
+// Stage records the time since the last stage ended, or since the timing
+// started, as a duration of the named stage.
+func (t *StagedTiming) Stage(stage string) {
+	now := time.Now()
+	t.timer.Stage(stage).Update(now.Sub(t.last))
+	t.last = now
+}
+
+// Stop records the time since the timing started as a total duration.
+func (t *StagedTiming) Stop() {
+	t.timer.Total().UpdateSince(t.start)
+}
+
+// StagedTimerSnapshot is a read-only copy of another StagedTimer.
+type StagedTimerSnapshot struct {
+	stages map[string]DurationHistogram
+	total  DurationHistogram
+}
+
+// Clear panics.
+func (*StagedTimerSnapshot) Clear() {
+	panic("Clear called on a StagedTimerSnapshot")
+}
+
+// Count returns the number of total durations recorded at the time the
+// snapshot was taken.
+func (t *StagedTimerSnapshot) Count() int64 { return t.total.Count() }
+
+// GoString formats the statistics of the snapshot for %#v.
+func (t *StagedTimerSnapshot) GoString() string {
+	return goString("StagedTimerSnapshot", stagedTimerString(t))
+}
+
+// Snapshot returns the snapshot.
+func (t *StagedTimerSnapshot) Snapshot() StagedTimer { return t }
+
+// Stage returns a snapshot of the named stage's histogram or, if the stage
+// had not been used when the snapshot was taken, a NilDurationHistogram.
+func (t *StagedTimerSnapshot) Stage(stage string) DurationHistogram {
+	if TotalStage == stage {
+		return t.total
+	}
+	if h, ok := t.stages[stage]; ok {
+		return h
+	}
+	return NilDurationHistogram{}
+}
+
+// Stages returns the sorted names of the stages used at the time the
+// snapshot was taken.
+func (t *StagedTimerSnapshot) Stages() []string { return sortedStages(t.stages) }
+
+// Start panics.
+func (*StagedTimerSnapshot) Start() *StagedTiming {
+	panic("Start called on a StagedTimerSnapshot")
+}
+
+// String formats the statistics of each stage for debugging.
+func (t *StagedTimerSnapshot) String() string { return stagedTimerString(t) }
+
+// Total returns a snapshot of the histogram of total durations.
+func (t *StagedTimerSnapshot) Total() DurationHistogram { return t.total }
+
+// NilStagedTimer is a no-op StagedTimer.
+type NilStagedTimer struct{}
+
+// Clear is a no-op.
+func (NilStagedTimer) Clear() {}
+
+// Count is a no-op.
+func (NilStagedTimer) Count() int64 { return 0 }
+
+// Snapshot is a no-op.
+func (NilStagedTimer) Snapshot() StagedTimer { return NilStagedTimer{} }
+
+// Stage is a no-op.
+func (NilStagedTimer) Stage(string) DurationHistogram { return NilDurationHistogram{} }
+
+// Stages is a no-op.
+func (NilStagedTimer) Stages() []string { return []string{} }
+
+// Start is a no-op.
+func (NilStagedTimer) Start() *StagedTiming {
+	now := time.Now()
+	return &StagedTiming{last: now, start: now, timer: NilStagedTimer{}}
+}
+
+// Total is a no-op.
+func (NilStagedTimer) Total() DurationHistogram { return NilDurationHistogram{} }
+
+// StandardStagedTimer is the standard implementation of a StagedTimer and
+// keeps a StandardDurationHistogram for each stage and the total.
+type StandardStagedTimer struct {
+	mutex        sync.RWMutex
+	sampleConfig SampleConfig
+	stages       map[string]DurationHistogram
+	total        DurationHistogram
+}
+
+// Clear clears every stage's histogram and the total's.
+func (t *StandardStagedTimer) Clear() {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for _, h := range t.stages {
+		h.Clear()
+	}
+	t.total.Clear()
+}
+
+// Count returns the number of total durations recorded.
+func (t *StandardStagedTimer) Count() int64 { return t.total.Count() }
+
+// Snapshot returns a read-only copy of the staged timer.
+func (t *StandardStagedTimer) Snapshot() StagedTimer {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	stages := make(map[string]DurationHistogram, len(t.stages))
+	for stage, h := range t.stages {
+		stages[stage] = h.Snapshot()
+	}
+	return &StagedTimerSnapshot{stages: stages, total: t.total.Snapshot()}
+}
+
+// Stage returns the named stage's histogram, constructing it if the stage
+// has not been used before.  TotalStage names the histogram of totals.
+func (t *StandardStagedTimer) Stage(stage string) DurationHistogram {
+	if TotalStage == stage {
+		return t.total
+	}
+	t.mutex.RLock()
+	h, ok := t.stages[stage]
+	t.mutex.RUnlock()
+	if ok {
+		return h
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if h, ok := t.stages[stage]; ok {
+		return h
+	}
+	h = NewDurationHistogram(t.sampleConfig.NewSample())
+	t.stages[stage] = h
+	return h
+}
+
+// Stages returns the sorted names of the stages used.
+func (t *StandardStagedTimer) Stages() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return sortedStages(t.stages)
+}
+
+// Start begins timing a request.
+func (t *StandardStagedTimer) Start() *StagedTiming {
+	now := time.Now()
+	return &StagedTiming{last: now, start: now, timer: t}
+}
+
+// String formats the statistics of each stage for debugging.
+func (t *StandardStagedTimer) String() string { return stagedTimerString(t) }
+
+// Total returns the histogram of total durations.
+func (t *StandardStagedTimer) Total() DurationHistogram { return t.total }
+
+// eachStage calls f with each stage of a StagedTimer in sorted order and
+// then with TotalStage.
+func eachStage(t StagedTimer, f func(stage string, h DurationHistogram)) {
+	for _, stage := range t.Stages() {
+		f(stage, t.Stage(stage))
+	}
+	f(TotalStage, t.Total())
+}
+
+func sortedStages(stages map[string]DurationHistogram) []string {
+	names := make([]string, 0, len(stages))
+	for stage := range stages {
+		names = append(names, stage)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,101 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func BenchmarkStagedTimer(b *testing.B) {
+	t := NewStagedTimer()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		timing := t.Start()
+		timing.Stage("parse")
+		timing.Stage("backend")
+		timing.Stop()
+	}
+}
+
+func TestGetOrRegisterStagedTimer(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredStagedTimer("foo", r).Stage("parse").Update(47)
+	if st := GetOrRegisterStagedTimer("foo", r); 1 != st.Stage("parse").Count() {
+		t.Fatal(st)
+	}
+}
+
+func TestStagedTimer(t *testing.T) {
+	st := NewStagedTimer()
+	st.Stage("render").Update(time.Millisecond)
+	st.Stage("parse").Update(2 * time.Millisecond)
+	st.Stage("parse").Update(4 * time.Millisecond)
+	st.Total().Update(10 * time.Millisecond)
+	if stages := st.Stages(); !reflect.DeepEqual([]string{"parse", "render"}, stages) {
+		t.Errorf("st.Stages(): %v\n", stages)
+	}
+	if count := st.Count(); 1 != count {
+		t.Errorf("st.Count(): 1 != %v\n", count)
+	}
+	if mean := st.Stage("parse").Mean(); 3*time.Millisecond != mean {
+		t.Errorf("st.Stage(\"parse\").Mean(): 3ms != %v\n", mean)
+	}
+	if st.Total() != st.Stage(TotalStage) {
+		t.Error("st.Stage(TotalStage) isn't st.Total()")
+	}
+	st.Clear()
+	if count := st.Stage("parse").Count(); 0 != count {
+		t.Errorf("st.Stage(\"parse\").Count(): 0 != %v\n", count)
+	}
+}
+
+func TestStagedTiming(t *testing.T) {
+	st := NewStagedTimer()
+	timing := st.Start()
+	timing.Stage("parse")
+	timing.Stage("backend")
+	timing.Stop()
+	for _, stage := range []string{"backend", "parse", TotalStage} {
+		if count := st.Stage(stage).Count(); 1 != count {
+			t.Errorf("st.Stage(%q).Count(): 1 != %v\n", stage, count)
+		}
+	}
+	if st.Total().Max() < st.Stage("parse").Max()+st.Stage("backend").Max() {
+		t.Errorf("total %v < parse %v + backend %v\n", st.Total().Max(), st.Stage("parse").Max(), st.Stage("backend").Max())
+	}
+}
+
+func TestStagedTimerSnapshot(t *testing.T) {
+	st := NewStagedTimer()
+	st.Stage("parse").Update(time.Millisecond)
+	snapshot := st.Snapshot()
+	st.Stage("parse").Update(time.Millisecond)
+	st.Stage("render").Update(time.Millisecond)
+	if count := snapshot.Stage("parse").Count(); 1 != count {
+		t.Errorf("snapshot.Stage(\"parse\").Count(): 1 != %v\n", count)
+	}
+	if stages := snapshot.Stages(); !reflect.DeepEqual([]string{"parse"}, stages) {
+		t.Errorf("snapshot.Stages(): %v\n", stages)
+	}
+	if _, ok := snapshot.Stage("render").(NilDurationHistogram); !ok {
+		t.Errorf("snapshot.Stage(\"render\"): %v\n", snapshot.Stage("render"))
+	}
+}
+
+func TestStagedTimerWriteOnce(t *testing.T) {
+	r := NewRegistry()
+	st := NewRegisteredStagedTimer("request", r)
+	st.Stage("parse").Update(time.Millisecond)
+	st.Total().Update(time.Millisecond)
+	var b bytes.Buffer
+	WriteOnce(r, &b)
+	out := b.String()
+	if !strings.Contains(out, "staged timer request\n  stage parse\n") || !strings.Contains(out, "  stage total\n") {
+		t.Errorf("WriteOnce: %q\n", out)
+	}
+}
@@ -2,67 +2,172 @@
 package stathat
 
 import (
+	"fmt"
 	"github.com/rcrowley/go-metrics"
 	"github.com/stathat/go"
+	"io"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Config provides a container with configuration parameters for the
+// Stathat reporter.
+type Config struct {
+	Registry      metrics.Registry     // Registry to be exported
+	FlushInterval time.Duration        // Flush interval
+	UserKey       string               // StatHat EZ key
+	ValuePolicy   *metrics.ValuePolicy // NaN, ±Inf and negative value handling; nil means metrics.DefaultValuePolicy
+}
+
 func Stathat(r metrics.Registry, d time.Duration, userkey string) {
+	StathatWithConfig(Config{Registry: r, FlushInterval: d, UserKey: userkey})
+}
+
+// StathatWithConfig is a blocking reporter function just like Stathat, but it
+// takes a Config instead.
+func StathatWithConfig(c Config) {
 	for {
-		if err := sh(r, userkey); nil != err {
+		if err := sh(c.Registry, c.UserKey, c.poster(statHatPoster)); nil != err {
 			log.Println(err)
+			metrics.EmitEvent(metrics.Event{Type: metrics.EventReporterError, Name: "stathat", Err: err})
+		}
+		time.Sleep(c.FlushInterval)
+	}
+}
+
+// DryRun writes what Stathat would post to w, one "count name n" or
+// "value name v" line per stat, instead of posting it to StatHat.
+func DryRun(r metrics.Registry, w io.Writer) error {
+	return DryRunWithConfig(Config{Registry: r}, w)
+}
+
+// DryRunWithConfig writes what StathatWithConfig would post to w, just like
+// DryRun.
+func DryRunWithConfig(c Config, w io.Writer) error {
+	return sh(c.Registry, "", c.poster(poster{
+		count: func(name, _ string, count int) error {
+			_, err := fmt.Fprintf(w, "count %s %d\n", name, count)
+			return err
+		},
+		value: func(name, _ string, value float64) error {
+			_, err := fmt.Fprintf(w, "value %s %v\n", name, value)
+			return err
+		},
+	}))
+}
+
+// poster returns p with every value subject to the configured ValuePolicy.
+// Values the policy rejects are not posted.
+func (c Config) poster(p poster) poster {
+	policy := metrics.DefaultValuePolicy
+	if nil != c.ValuePolicy {
+		policy = *c.ValuePolicy
+	}
+	value := p.value
+	p.value = func(name, ezkey string, v float64) error {
+		if v, ok := policy.Float(v); ok {
+			return value(name, ezkey, v)
 		}
-		time.Sleep(d)
+		return nil
 	}
+	return p
 }
 
-func sh(r metrics.Registry, userkey string) error {
+// A poster posts counts and values to StatHat or, in a dry run, elsewhere.
+type poster struct {
+	count func(name, ezkey string, count int) error
+	value func(name, ezkey string, value float64) error
+}
+
+var statHatPoster = poster{count: stathat.PostEZCount, value: stathat.PostEZValue}
+
+func sh(r metrics.Registry, userkey string, p poster) error {
 	r.Each(func(name string, i interface{}) {
 		switch metric := i.(type) {
 		case metrics.Counter:
-			stathat.PostEZCount(name, userkey, int(metric.Count()))
+			p.count(name, userkey, int(metric.Count()))
 		case metrics.Gauge:
-			stathat.PostEZValue(name, userkey, float64(metric.Value()))
+			p.value(name, userkey, float64(metric.Value()))
 		case metrics.GaugeFloat64:
-			stathat.PostEZValue(name, userkey, float64(metric.Value()))
+			p.value(name, userkey, float64(metric.Value()))
 		case metrics.Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			stathat.PostEZCount(name+".count", userkey, int(h.Count()))
-			stathat.PostEZValue(name+".min", userkey, float64(h.Min()))
-			stathat.PostEZValue(name+".max", userkey, float64(h.Max()))
-			stathat.PostEZValue(name+".mean", userkey, float64(h.Mean()))
-			stathat.PostEZValue(name+".std-dev", userkey, float64(h.StdDev()))
-			stathat.PostEZValue(name+".50-percentile", userkey, float64(ps[0]))
-			stathat.PostEZValue(name+".75-percentile", userkey, float64(ps[1]))
-			stathat.PostEZValue(name+".95-percentile", userkey, float64(ps[2]))
-			stathat.PostEZValue(name+".99-percentile", userkey, float64(ps[3]))
-			stathat.PostEZValue(name+".999-percentile", userkey, float64(ps[4]))
+			percentiles := metrics.ExportedPercentiles(r, i)
+			ps := h.Percentiles(percentiles)
+			p.count(name+".count", userkey, int(h.Count()))
+			p.value(name+".min", userkey, float64(h.Min()))
+			p.value(name+".max", userkey, float64(h.Max()))
+			p.value(name+".mean", userkey, float64(h.Mean()))
+			p.value(name+".std-dev", userkey, float64(h.StdDev()))
+			for j, q := range percentiles {
+				key := strings.Replace(strconv.FormatFloat(q*100.0, 'f', -1, 64), ".", "", 1)
+				p.value(name+"."+key+"-percentile", userkey, float64(ps[j]))
+			}
+		case metrics.DurationHistogram:
+			h := metric.Snapshot()
+			percentiles := metrics.ExportedPercentiles(r, i)
+			ps := h.Percentiles(percentiles)
+			p.count(name+".count", userkey, int(h.Count()))
+			p.value(name+".min", userkey, float64(h.Min()))
+			p.value(name+".max", userkey, float64(h.Max()))
+			p.value(name+".mean", userkey, float64(h.Mean()))
+			p.value(name+".std-dev", userkey, float64(h.StdDev()))
+			for j, q := range percentiles {
+				key := strings.Replace(strconv.FormatFloat(q*100.0, 'f', -1, 64), ".", "", 1)
+				p.value(name+"."+key+"-percentile", userkey, float64(ps[j]))
+			}
 		case metrics.Meter:
 			m := metric.Snapshot()
-			stathat.PostEZCount(name+".count", userkey, int(m.Count()))
-			stathat.PostEZValue(name+".one-minute", userkey, float64(m.Rate1()))
-			stathat.PostEZValue(name+".five-minute", userkey, float64(m.Rate5()))
-			stathat.PostEZValue(name+".fifteen-minute", userkey, float64(m.Rate15()))
-			stathat.PostEZValue(name+".mean", userkey, float64(m.RateMean()))
+			p.count(name+".count", userkey, int(m.Count()))
+			p.value(name+".one-minute", userkey, float64(m.Rate1()))
+			p.value(name+".five-minute", userkey, float64(m.Rate5()))
+			p.value(name+".fifteen-minute", userkey, float64(m.Rate15()))
+			p.value(name+".mean", userkey, float64(m.RateMean()))
+		case metrics.Summary:
+			s := metric.Snapshot()
+			p.count(name+".count", userkey, int(s.Count()))
+			p.value(name+".sum", userkey, s.Sum())
+			qs := s.Quantiles()
+			for i, q := range s.Objectives() {
+				key := strings.Replace(strconv.FormatFloat(q*100.0, 'f', -1, 64), ".", "", 1)
+				p.value(name+"."+key+"-percentile", userkey, qs[i])
+			}
+		case metrics.StagedTimer:
+			t := metric.Snapshot()
+			for _, stage := range append(t.Stages(), metrics.TotalStage) {
+				h := t.Stage(stage)
+				prefix := name + "." + stage
+				percentiles := metrics.ExportedPercentiles(r, h)
+				ps := h.Percentiles(percentiles)
+				p.count(prefix+".count", userkey, int(h.Count()))
+				p.value(prefix+".min", userkey, float64(h.Min()))
+				p.value(prefix+".max", userkey, float64(h.Max()))
+				p.value(prefix+".mean", userkey, float64(h.Mean()))
+				p.value(prefix+".std-dev", userkey, float64(h.StdDev()))
+				for j, q := range percentiles {
+					key := strings.Replace(strconv.FormatFloat(q*100.0, 'f', -1, 64), ".", "", 1)
+					p.value(prefix+"."+key+"-percentile", userkey, float64(ps[j]))
+				}
+			}
 		case metrics.Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-			stathat.PostEZCount(name+".count", userkey, int(t.Count()))
-			stathat.PostEZValue(name+".min", userkey, float64(t.Min()))
-			stathat.PostEZValue(name+".max", userkey, float64(t.Max()))
-			stathat.PostEZValue(name+".mean", userkey, float64(t.Mean()))
-			stathat.PostEZValue(name+".std-dev", userkey, float64(t.StdDev()))
-			stathat.PostEZValue(name+".50-percentile", userkey, float64(ps[0]))
-			stathat.PostEZValue(name+".75-percentile", userkey, float64(ps[1]))
-			stathat.PostEZValue(name+".95-percentile", userkey, float64(ps[2]))
-			stathat.PostEZValue(name+".99-percentile", userkey, float64(ps[3]))
-			stathat.PostEZValue(name+".999-percentile", userkey, float64(ps[4]))
-			stathat.PostEZValue(name+".one-minute", userkey, float64(t.Rate1()))
-			stathat.PostEZValue(name+".five-minute", userkey, float64(t.Rate5()))
-			stathat.PostEZValue(name+".fifteen-minute", userkey, float64(t.Rate15()))
-			stathat.PostEZValue(name+".mean-rate", userkey, float64(t.RateMean()))
+			percentiles := metrics.ExportedPercentiles(r, i)
+			ps := t.Percentiles(percentiles)
+			p.count(name+".count", userkey, int(t.Count()))
+			p.value(name+".min", userkey, float64(t.Min()))
+			p.value(name+".max", userkey, float64(t.Max()))
+			p.value(name+".mean", userkey, float64(t.Mean()))
+			p.value(name+".std-dev", userkey, float64(t.StdDev()))
+			for j, q := range percentiles {
+				key := strings.Replace(strconv.FormatFloat(q*100.0, 'f', -1, 64), ".", "", 1)
+				p.value(name+"."+key+"-percentile", userkey, float64(ps[j]))
+			}
+			p.value(name+".one-minute", userkey, float64(t.Rate1()))
+			p.value(name+".five-minute", userkey, float64(t.Rate5()))
+			p.value(name+".fifteen-minute", userkey, float64(t.Rate15()))
+			p.value(name+".mean-rate", userkey, float64(t.RateMean()))
 		}
 	})
 	return nil
@@ -0,0 +1,40 @@
+package statsd
+
+import "io"
+
+// packetWriter packs lines into as few datagrams as possible, each no larger
+// than max bytes, and never splits what's added at once between datagrams.
+// Lines too long to fit are sent in a datagram of their own.  Flush must be
+// called to send the last of them.
+type packetWriter struct {
+	conn    io.Writer // Each Write sends one datagram
+	max     int
+	pending []byte
+	err     error // First error of a Write, after which nothing more is sent
+}
+
+// add appends one or more lines, each ending in a newline, sending the
+// pending datagram first if they'd overflow it.
+func (pw *packetWriter) add(lines string) {
+	if 0 < len(pw.pending) && pw.max < len(pw.pending)+len(lines)-1 {
+		pw.send()
+	}
+	pw.pending = append(pw.pending, lines...)
+}
+
+// Flush sends the pending datagram, if any, and returns the first error of
+// any Write.
+func (pw *packetWriter) Flush() error {
+	if 0 < len(pw.pending) {
+		pw.send()
+	}
+	return pw.err
+}
+
+// send writes the pending lines as one datagram, without the last newline.
+func (pw *packetWriter) send() {
+	if nil == pw.err {
+		_, pw.err = pw.conn.Write(pw.pending[:len(pw.pending)-1])
+	}
+	pw.pending = pw.pending[:0]
+}
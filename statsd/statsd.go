@@ -0,0 +1,315 @@
+// Package statsd flushes a Registry to a StatsD server, or with tags to a
+// DogStatsD agent, over UDP or a unixgram socket, sending counters as their
+// increase since the previous flush so that StatsD sums them as it would
+// counts sent by any other client.
+package statsd
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// DefaultPercentiles are the percentiles sent of histograms and timers which
+// export none of their own unless Config.Percentiles says otherwise.
+var DefaultPercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// Config provides a container with configuration parameters for the StatsD
+// exporter.
+type Config struct {
+	Addr          net.Addr             // *net.UDPAddr, or *net.UnixAddr of a unixgram socket
+	Registry      metrics.Registry     // Registry to be exported
+	FlushInterval time.Duration        // Flush interval
+	DurationUnit  time.Duration        // Unit of timer values; zero means time.Millisecond
+	Prefix        string               // Prefix to be prepended to metric names, followed by a period
+	Percentiles   []float64            // Percentiles to send of timers and histograms; nil means each metric's ExportedPercentiles
+	MaxPacketSize int                  // Largest datagram sent; zero means metrics.DefaultMaxPacketSize
+	ValuePolicy   *metrics.ValuePolicy // NaN, ±Inf and negative value handling; nil means metrics.DefaultValuePolicy
+
+	// DogStatsD sends the tags of names made by metrics.TaggedName in the
+	// "|#k:v" form of DogStatsD rather than leaving them in the name in the
+	// ";k=v" form of Graphite, which plain StatsD passes through.
+	DogStatsD bool
+	// Tags are sent with every metric when DogStatsD is set.
+	Tags map[string]string
+}
+
+// A Reporter sends a registry to StatsD.  Counters, meters, and the counts of
+// histograms and timers are sent as counters of their increase since the
+// previous flush, which is why a Reporter remembers what it last sent.
+// Gauges are sent as gauges and, since histograms and timers have already
+// been aggregated, their minimum, maximum, mean, standard deviation, and
+// percentiles are sent as gauges too, named by a suffix such as ".p99",
+// rather than as StatsD timings which StatsD would aggregate again.
+// Summaries are sent likewise.  Histogram2Ds, staged timers, and
+// healthchecks are skipped.
+//
+// Lines are packed into as few datagrams as fit within MaxPacketSize, so
+// that a flush of many metrics costs few packets.
+type Reporter struct {
+	config Config
+	conn   net.Conn
+	counts map[string]float64 // Last count sent of each counter, by registered name and suffix
+}
+
+// NewReporter constructs a new Reporter with the given configuration.  It
+// doesn't connect until the first flush.
+func NewReporter(c Config) *Reporter {
+	if nil == c.Registry {
+		c.Registry = metrics.DefaultRegistry
+	}
+	if 0 == c.DurationUnit {
+		c.DurationUnit = time.Millisecond
+	}
+	if c.MaxPacketSize <= 0 {
+		c.MaxPacketSize = metrics.DefaultMaxPacketSize
+	}
+	return &Reporter{config: c, counts: make(map[string]float64)}
+}
+
+// StatsD is a blocking exporter function which reports metrics in r to a
+// StatsD server located at addr, flushing them every d duration.
+func StatsD(r metrics.Registry, d time.Duration, addr net.Addr) {
+	WithConfig(Config{
+		Addr:          addr,
+		Registry:      r,
+		FlushInterval: d,
+	})
+}
+
+// WithConfig is a blocking exporter function just like StatsD, but it takes
+// a Config instead.
+func WithConfig(c Config) {
+	NewReporter(c).Run(context.Background())
+}
+
+// Run flushes the registry every FlushInterval until ctx is done, logging
+// failed flushes and emitting them as metrics.EventReporterError.  This is
+// designed to be called as a goroutine.
+func (r *Reporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+	defer r.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.Flush(); nil != err {
+			log.Println(err)
+			metrics.EmitEvent(metrics.Event{Type: metrics.EventReporterError, Name: "statsd", Err: err})
+		}
+	}
+}
+
+// Close closes the Reporter's connection, if it has one.  The next flush
+// connects again.
+func (r *Reporter) Close() error {
+	if nil == r.conn {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// Flush sends the registry once, returning a non-nil error on failed
+// connections or writes, after which the next flush connects again.  Counts
+// sent by a failed flush are taken as lost rather than sent again.
+func (r *Reporter) Flush() error {
+	if nil == r.conn {
+		conn, err := net.Dial(r.config.Addr.Network(), r.config.Addr.String())
+		if nil != err {
+			return err
+		}
+		r.conn = conn
+	}
+	w := &packetWriter{conn: r.conn, max: r.config.MaxPacketSize}
+	r.write(w)
+	if err := w.Flush(); nil != err {
+		r.Close()
+		return err
+	}
+	return nil
+}
+
+// write encodes every metric in the registry as lines of w.
+func (r *Reporter) write(w *packetWriter) {
+	var (
+		c      = &r.config
+		du     = float64(c.DurationUnit)
+		policy = metrics.DefaultValuePolicy
+		seen   = make(map[string]bool)
+	)
+	if nil != c.ValuePolicy {
+		policy = *c.ValuePolicy
+	}
+	c.Registry.Each(func(registered string, i interface{}) {
+		name, tags := r.nameAndTags(registered)
+		count := func(key string, n float64) {
+			seen[registered+key] = true
+			delta := n - r.counts[registered+key]
+			r.counts[registered+key] = n
+			if 0 != delta {
+				w.add(line(name+key, formatFloat(delta), "c", tags))
+			}
+		}
+		gauge := func(key string, v float64) {
+			v, ok := policy.Float(v)
+			if !ok {
+				return
+			}
+			if v < 0 && !c.DogStatsD {
+				// A sign makes a plain StatsD gauge relative, so zero it
+				// first in the same datagram.
+				w.add(line(name+key, "0", "g", tags) + line(name+key, formatFloat(v), "g", tags))
+				return
+			}
+			w.add(line(name+key, formatFloat(v), "g", tags))
+		}
+		sample := func(n int64, min, max, mean, stdDev float64, ps []float64, vs []float64, unit float64) {
+			count(".count", float64(n))
+			gauge(".min", min/unit)
+			gauge(".max", max/unit)
+			gauge(".mean", mean/unit)
+			gauge(".std-dev", stdDev/unit)
+			for j, p := range ps {
+				gauge(percentileKey(p), vs[j]/unit)
+			}
+		}
+		switch metric := i.(type) {
+		case metrics.Counter:
+			count("", float64(metric.Count()))
+		case metrics.CounterFloat64:
+			count("", metric.Count())
+		case metrics.Gauge:
+			gauge("", float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			gauge("", metric.Value())
+		case metrics.Meter:
+			count("", float64(metric.Count()))
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			ps := r.percentiles(h)
+			sample(h.Count(), float64(h.Min()), float64(h.Max()), h.Mean(), h.StdDev(), ps, h.Percentiles(ps), 1)
+		case metrics.DurationHistogram:
+			h := metric.Snapshot()
+			ps := r.percentiles(h)
+			ds := h.Percentiles(ps)
+			vs := make([]float64, len(ds))
+			for j, d := range ds {
+				vs[j] = float64(d)
+			}
+			sample(h.Count(), float64(h.Min()), float64(h.Max()), float64(h.Mean()), float64(h.StdDev()), ps, vs, du)
+		case metrics.Summary:
+			s := metric.Snapshot()
+			count(".count", float64(s.Count()))
+			gauge(".sum", s.Sum())
+			qs := s.Quantiles()
+			for j, q := range s.Objectives() {
+				gauge(percentileKey(q), qs[j])
+			}
+		case metrics.Timer:
+			t := metric.Snapshot()
+			ps := r.percentiles(t)
+			sample(t.Count(), float64(t.Min()), float64(t.Max()), t.Mean(), t.StdDev(), ps, t.Percentiles(ps), du)
+		}
+	})
+	for key := range r.counts {
+		if !seen[key] {
+			delete(r.counts, key)
+		}
+	}
+}
+
+// line formats a StatsD line, with the DogStatsD tags given, if any.
+func line(name, value, typ, tags string) string {
+	if "" == tags {
+		return name + ":" + value + "|" + typ + "\n"
+	}
+	return name + ":" + value + "|" + typ + "|#" + tags + "\n"
+}
+
+// nameAndTags returns the name to send of a metric, with its prefix, and the
+// DogStatsD tags to send with it, if any.
+func (r *Reporter) nameAndTags(name string) (string, string) {
+	c := &r.config
+	var tags map[string]string
+	if c.DogStatsD {
+		name, tags = metrics.SplitTaggedName(name)
+	}
+	if "" != c.Prefix {
+		name = c.Prefix + "." + name
+	}
+	name = sanitize(name)
+	if !c.DogStatsD || 0 == len(tags)+len(c.Tags) {
+		return name, ""
+	}
+	merged := make(map[string]string, len(tags)+len(c.Tags))
+	for k, v := range c.Tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for j, k := range keys {
+		if 0 < j {
+			b.WriteByte(',')
+		}
+		b.WriteString(sanitize(k))
+		if v := merged[k]; "" != v {
+			b.WriteByte(':')
+			b.WriteString(sanitize(v))
+		}
+	}
+	return name, b.String()
+}
+
+// percentiles returns the percentiles to send of a histogram or timer.
+func (r *Reporter) percentiles(i interface{}) []float64 {
+	if nil != r.config.Percentiles {
+		return r.config.Percentiles
+	}
+	if e, ok := i.(interface{ ExportedPercentiles() []float64 }); ok {
+		if ps := e.ExportedPercentiles(); nil != ps {
+			return ps
+		}
+	}
+	return DefaultPercentiles
+}
+
+// formatFloat formats a value as briefly as it can be parsed back exactly.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// percentileKey returns the suffix of a percentile, such as ".p99" or
+// ".p999".
+func percentileKey(p float64) string {
+	return ".p" + strings.Replace(strconv.FormatFloat(p*100, 'f', -1, 64), ".", "", 1)
+}
+
+// sanitize replaces the characters which delimit the fields of a StatsD line,
+// and whitespace, with underscores.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', ' ', '\t', '\n', '\r':
+			return '_'
+		}
+		return r
+	}, s)
+}
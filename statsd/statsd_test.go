@@ -0,0 +1,157 @@
+package statsd
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// listen returns a UDP socket on localhost and a function which receives
+// every datagram that arrives until a short wait goes unanswered.
+func listen(t *testing.T) (*net.UDPConn, func() []string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, func() []string {
+		var packets []string
+		buf := make([]byte, 65536)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, err := conn.Read(buf)
+			if nil != err {
+				return packets
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+	}
+}
+
+func lines(packets []string) []string {
+	var ls []string
+	for _, p := range packets {
+		ls = append(ls, strings.Split(p, "\n")...)
+	}
+	sort.Strings(ls)
+	return ls
+}
+
+func TestFlushCounterDeltas(t *testing.T) {
+	conn, receive := listen(t)
+	r := metrics.NewRegistry()
+	c := metrics.GetOrRegisterCounter("requests", r)
+	g := metrics.GetOrRegisterGauge("queue", r)
+	rep := NewReporter(Config{Addr: conn.LocalAddr(), Registry: r, Prefix: "app"})
+	defer rep.Close()
+
+	c.Inc(5)
+	g.Update(7)
+	if err := rep.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if ls, want := lines(receive()), []string{"app.queue:7|g", "app.requests:5|c"}; strings.Join(ls, " ") != strings.Join(want, " ") {
+		t.Fatalf("first flush: %q, want %q", ls, want)
+	}
+
+	c.Inc(3)
+	g.Update(-2)
+	if err := rep.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if ls, want := lines(receive()), []string{"app.queue:-2|g", "app.queue:0|g", "app.requests:3|c"}; strings.Join(ls, " ") != strings.Join(want, " ") {
+		t.Fatalf("second flush: %q, want %q", ls, want)
+	}
+
+	if err := rep.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	if ls, want := lines(receive()), []string{"app.queue:-2|g", "app.queue:0|g"}; strings.Join(ls, " ") != strings.Join(want, " ") {
+		t.Fatalf("idle flush: %q, want %q", ls, want)
+	}
+}
+
+func TestFlushDogStatsDTags(t *testing.T) {
+	conn, receive := listen(t)
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"code": "200"}), r).Inc(2)
+	metrics.GetOrRegisterCounter(metrics.TaggedName("requests", map[string]string{"code": "500"}), r).Inc(1)
+	metrics.GetOrRegisterGauge(metrics.TaggedName("queue", map[string]string{"shard": "a"}), r).Update(-3)
+	rep := NewReporter(Config{
+		Addr:      conn.LocalAddr(),
+		Registry:  r,
+		DogStatsD: true,
+		Tags:      map[string]string{"host": "web1"},
+	})
+	defer rep.Close()
+	if err := rep.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	want := []string{
+		"queue:-3|g|#host:web1,shard:a",
+		"requests:1|c|#code:500,host:web1",
+		"requests:2|c|#code:200,host:web1",
+	}
+	if ls := lines(receive()); strings.Join(ls, " ") != strings.Join(want, " ") {
+		t.Fatalf("%q, want %q", ls, want)
+	}
+}
+
+func TestFlushTimer(t *testing.T) {
+	conn, receive := listen(t)
+	r := metrics.NewRegistry()
+	tm := metrics.GetOrRegisterTimer("latency", r)
+	tm.Update(10 * time.Millisecond)
+	tm.Update(30 * time.Millisecond)
+	rep := NewReporter(Config{Addr: conn.LocalAddr(), Registry: r, Percentiles: []float64{0.5, 0.99}})
+	defer rep.Close()
+	if err := rep.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	want := []string{
+		"latency.count:2|c",
+		"latency.max:30|g",
+		"latency.mean:20|g",
+		"latency.min:10|g",
+		"latency.p50:20|g",
+		"latency.p99:30|g",
+		"latency.std-dev:10|g",
+	}
+	if ls := lines(receive()); strings.Join(ls, " ") != strings.Join(want, " ") {
+		t.Fatalf("%q, want %q", ls, want)
+	}
+}
+
+type datagrams [][]byte
+
+func (d *datagrams) Write(p []byte) (int, error) {
+	*d = append(*d, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestPacketWriter(t *testing.T) {
+	var d datagrams
+	pw := &packetWriter{conn: &d, max: 12}
+	pw.add("aaaa:1|c\n")
+	pw.add("b:1|c\n")
+	pw.add("cccccccccccccccc:1|c\n")
+	pw.add("d:1|c\n")
+	pw.add("e:1|c\n")
+	if err := pw.Flush(); nil != err {
+		t.Fatal(err)
+	}
+	want := [][]byte{[]byte("aaaa:1|c"), []byte("b:1|c"), []byte("cccccccccccccccc:1|c"), []byte("d:1|c\ne:1|c")}
+	if len(d) != len(want) {
+		t.Fatalf("%q, want %q", d, want)
+	}
+	for i := range want {
+		if !bytes.Equal(d[i], want[i]) {
+			t.Fatalf("%q, want %q", d, want)
+		}
+	}
+}
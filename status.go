@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// StatusCounters counts responses by their HTTP status code, exporting both
+// each exact code and its class.  A family named "http.status" registers the
+// counters "http.status.1xx" through "http.status.5xx" up front and a counter
+// such as "http.status.404" the first time each code is counted, so only the
+// codes a server actually returns are registered.  Codes outside 100 through
+// 599 are counted as "http.status.other".  A name made by TaggedName keeps
+// its tags on each counter.
+//
+// Counting a code already seen indexes an array rather than formatting a
+// name and looking it up in the registry, so it costs little more than
+// incrementing two counters.
+type StatusCounters struct {
+	classes  [5]Counter
+	codes    [500]atomic.Value // Counter, indexed by code-100
+	mutex    sync.Mutex
+	name     string
+	once     sync.Once    // registers the classes after the first
+	other    atomic.Value // Counter
+	registry Registry
+}
+
+// GetOrRegisterStatusCounters returns the status counters of the given name
+// in the given registry, constructing and registering the class counters if
+// they don't yet exist.  The status counters are registered along with the
+// 1xx counter, so every call with the same name and registry returns the
+// same ones unless that counter was registered some other way first.
+func GetOrRegisterStatusCounters(name string, r Registry) *StatusCounters {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	m := unwrap(r.GetOrRegister(bundleName(name, "1xx"), func() Counter {
+		c := &statusClass{Counter: NewCounter(), counters: &StatusCounters{name: name, registry: r}}
+		c.counters.classes[0] = c.Counter
+		return c
+	}))
+	var s *StatusCounters
+	if c, ok := m.(*statusClass); ok {
+		s = c.counters
+	} else {
+		s = &StatusCounters{name: name, registry: r}
+		s.classes[0] = m.(Counter)
+	}
+	s.once.Do(func() {
+		for i := 1; i < len(s.classes); i++ {
+			s.classes[i] = GetOrRegisterCounter(bundleName(name, strconv.Itoa(i+1)+"xx"), r)
+		}
+	})
+	return s
+}
+
+// ClassCount returns the count of responses with status codes in the given
+// class, 2 for 2xx and so on.
+func (s *StatusCounters) ClassCount(class int) int64 {
+	if class < 1 || 5 < class {
+		return 0
+	}
+	return s.classes[class-1].Count()
+}
+
+// Count returns the count of responses with the given status code.
+func (s *StatusCounters) Count(code int) int64 {
+	if c := s.load(code); nil != c {
+		return c.Count()
+	}
+	return 0
+}
+
+// Inc counts a response with the given status code.
+func (s *StatusCounters) Inc(code int) {
+	c := s.load(code)
+	if nil == c {
+		c = s.register(code)
+	}
+	c.Inc(1)
+	if 100 <= code && code < 600 {
+		s.classes[code/100-1].Inc(1)
+	}
+}
+
+// load returns the counter of the given code or nil if it hasn't yet been
+// registered.
+func (s *StatusCounters) load(code int) Counter {
+	v := &s.other
+	if 100 <= code && code < 600 {
+		v = &s.codes[code-100]
+	}
+	c, _ := v.Load().(Counter)
+	return c
+}
+
+// register constructs and registers the counter of the given code, or
+// returns it if it already exists.
+func (s *StatusCounters) register(code int) Counter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if c := s.load(code); nil != c {
+		return c
+	}
+	v, suffix := &s.other, "other"
+	if 100 <= code && code < 600 {
+		v, suffix = &s.codes[code-100], strconv.Itoa(code)
+	}
+	c := GetOrRegisterCounter(bundleName(s.name, suffix), s.registry)
+	v.Store(c)
+	return c
+}
+
+// statusClass is the 1xx Counter under which StatusCounters are registered.
+type statusClass struct {
+	Counter
+	counters *StatusCounters
+}
+
+func (c *statusClass) String() string { return counterString(c) }
@@ -0,0 +1,63 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func BenchmarkStatusCounters(b *testing.B) {
+	s := GetOrRegisterStatusCounters("http.status", NewRegistry())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Inc(200)
+	}
+}
+
+func TestStatusCounters(t *testing.T) {
+	r := NewRegistry()
+	s := GetOrRegisterStatusCounters("http.status", r)
+	s.Inc(200)
+	s.Inc(204)
+	s.Inc(404)
+	s.Inc(404)
+	s.Inc(999)
+	if count := s.Count(404); 2 != count {
+		t.Errorf("s.Count(404): 2 != %v\n", count)
+	}
+	if count := s.ClassCount(2); 2 != count {
+		t.Errorf("s.ClassCount(2): 2 != %v\n", count)
+	}
+	if count := r.Get("http.status.4xx").(Counter).Count(); 2 != count {
+		t.Errorf("http.status.4xx.Count(): 2 != %v\n", count)
+	}
+	if count := r.Get("http.status.other").(Counter).Count(); 1 != count {
+		t.Errorf("http.status.other.Count(): 1 != %v\n", count)
+	}
+	if count := r.Get("http.status.5xx").(Counter).Count(); 0 != count {
+		t.Errorf("http.status.5xx.Count(): 0 != %v\n", count)
+	}
+	if nil != r.Get("http.status.500") {
+		t.Error("http.status.500 was registered without being counted")
+	}
+	if GetOrRegisterStatusCounters("http.status", r) != s {
+		t.Error("GetOrRegisterStatusCounters returned new status counters")
+	}
+}
+
+func TestStatusCountersRegisteredCounter(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("http.status.1xx", r).Inc(1)
+	s := GetOrRegisterStatusCounters("http.status", r)
+	s.Inc(101)
+	if count := s.ClassCount(1); 2 != count {
+		t.Errorf("s.ClassCount(1): 2 != %v\n", count)
+	}
+}
+
+func TestStatusCountersTagged(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterStatusCounters(TaggedName("http.status", map[string]string{"route": "/users"}), r).Inc(503)
+	if nil == r.Get("http.status.503;route=/users") {
+		t.Error("http.status.503;route=/users wasn't registered")
+	}
+}
@@ -0,0 +1,241 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The stress tests update, read, register, unregister, and export metrics
+// from many goroutines at once, in random order, and check the guarantees
+// documented in the package's memory model.  They're meant to be run under
+// the race detector and skipped by go test -short.
+
+const (
+	stressGoroutines = 8
+	stressOps        = 1000
+)
+
+// soak is how long the soak tests run, given by go test -soak, so that
+// they're run for minutes or hours under the race detector before a release
+// and only briefly otherwise.
+var soak = flag.Duration("soak", 100*time.Millisecond, "how long to run the soak tests")
+
+func stress(t *testing.T, f func(rng *rand.Rand, g, op int)) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < stressGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for op := 0; op < stressOps; op++ {
+				f(rng, g, op)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestStressCounterGauge(t *testing.T) {
+	c, g := NewCounter(), NewGauge()
+	var incs, peak atomic.Int64
+	stress(t, func(rng *rand.Rand, _, _ int) {
+		switch rng.Intn(4) {
+		case 0:
+			n := rng.Int63n(10)
+			c.Inc(n)
+			incs.Add(n)
+		case 1:
+			v := rng.Int63n(1 << 20)
+			g.SetMax(v)
+			for {
+				p := peak.Load()
+				if v <= p || peak.CompareAndSwap(p, v) {
+					break
+				}
+			}
+		case 2:
+			if count := c.Snapshot().Count(); count > incs.Load() {
+				t.Errorf("c.Snapshot().Count(): %v observed before its increments\n", count)
+			}
+		case 3:
+			g.Snapshot()
+		}
+	})
+	if count := c.Count(); incs.Load() != count {
+		t.Errorf("c.Count(): %v != %v\n", incs.Load(), count)
+	}
+	if v := g.Value(); peak.Load() != v {
+		t.Errorf("g.Value(): %v != %v\n", peak.Load(), v)
+	}
+}
+
+func TestStressMeterMonotonic(t *testing.T) {
+	ts := NewManualTickSource()
+	m := NewMeterWithTickSource(ts)
+	var marks atomic.Int64
+	stress(t, func(rng *rand.Rand, g, _ int) {
+		switch rng.Intn(3) {
+		case 0:
+			m.Mark(1)
+			marks.Add(1)
+		case 1:
+			before := m.Count()
+			if after := m.Snapshot().Count(); after < before {
+				t.Errorf("m.Snapshot().Count(): %v < %v read before it\n", after, before)
+			}
+		case 2:
+			if 0 == g {
+				ts.Tick()
+			}
+		}
+	})
+	if count := m.Count(); marks.Load() != count {
+		t.Errorf("m.Count(): %v != %v\n", marks.Load(), count)
+	}
+}
+
+// TestStressMeterSnapshot checks that a meter's snapshots are consistent
+// while it's marked and ticked: that its moving averages, all with an alpha
+// of 1, account for the same events and that its mean rate is of its count.
+func TestStressMeterSnapshot(t *testing.T) {
+	m := newStandardMeter()
+	m.a1, m.a5, m.a15 = NewEWMA(1), NewEWMA(1), NewEWMA(1)
+	stress(t, func(rng *rand.Rand, g, _ int) {
+		switch rng.Intn(3) {
+		case 0:
+			m.Mark(rng.Int63n(100))
+		case 1:
+			before := time.Since(m.startTime).Seconds()
+			snapshot := m.Snapshot().(*MeterSnapshot)
+			after := time.Since(m.startTime).Seconds()
+			if snapshot.Rate1() != snapshot.Rate5() || snapshot.Rate1() != snapshot.Rate15() {
+				t.Errorf("snapshot rates %v, %v, and %v of different events\n", snapshot.Rate1(), snapshot.Rate5(), snapshot.Rate15())
+			}
+			count := snapshot.CountFloat()
+			if rateMean := snapshot.RateMean(); rateMean < count/after || count/before < rateMean {
+				t.Errorf("snapshot.RateMean(): %v not of snapshot.CountFloat() %v\n", rateMean, count)
+			}
+		case 2:
+			if 0 == g {
+				m.Tick()
+			}
+		}
+	})
+}
+
+func TestStressTimerSnapshot(t *testing.T) {
+	tm := NewCustomTimer(NewHistogram(NewUniformSample(100)), NewMeterWithTickSource(NewManualTickSource()))
+	stress(t, func(rng *rand.Rand, _, _ int) {
+		if 0 == rng.Intn(2) {
+			tm.Update(time.Duration(rng.Int63n(int64(time.Second))))
+			return
+		}
+		s := tm.Snapshot().(*TimerSnapshot)
+		if s.histogram.Count() != s.meter.Count() {
+			t.Errorf("timer snapshot: histogram count %v != meter count %v\n", s.histogram.Count(), s.meter.Count())
+		}
+	})
+}
+
+func TestStressRegistry(t *testing.T) {
+	r := NewRegistry()
+	GetOrRegisterCounter("always", r)
+	stress(t, func(rng *rand.Rand, _, _ int) {
+		name := fmt.Sprintf("metric.%d", rng.Intn(32))
+		switch rng.Intn(8) {
+		case 0:
+			GetOrRegisterCounter(name+".counter", r).Inc(1)
+		case 1:
+			GetOrRegisterMeter(name+".meter", r).Mark(1)
+		case 2:
+			GetOrRegisterTimer(name+".timer", r).Update(time.Millisecond)
+		case 3:
+			GetOrRegisterHistogram(name+".histogram", r, NewUniformSample(10)).Update(1)
+		case 4:
+			r.Unregister(name + []string{".counter", ".meter", ".timer", ".histogram"}[rng.Intn(4)])
+		case 5:
+			seen := false
+			r.Each(func(name string, i interface{}) {
+				seen = seen || "always" == name
+				if s, ok := i.(interface{ String() string }); ok {
+					_ = s.String()
+				}
+			})
+			if !seen {
+				t.Error("r.Each(): always wasn't seen")
+			}
+		case 6:
+			WriteOnce(r, io.Discard)
+		case 7:
+			WriteJSONOnce(r, io.Discard)
+		}
+	})
+}
+
+// TestSoakMeterTicks marks a meter from many goroutines while another ticks
+// it, for as long as -soak, and checks that every event is accounted for by
+// exactly one tick, so that none are lost or counted twice in the handoff
+// from the meter's count to its moving averages.  The meter's EWMAs have
+// an alpha of 1, so that each rate is the instant rate of its last tick, and
+// the counts of the ticks are recovered from them.
+func TestSoakMeterTicks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping soak test in short mode")
+	}
+	m := newStandardMeter()
+	m.a1, m.a5, m.a15 = NewEWMA(1), NewEWMA(1), NewEWMA(1)
+	interval := TickInterval().Seconds()
+	var (
+		ticked [3]int64
+		ticks  int
+		wg     sync.WaitGroup
+		done   = make(chan struct{})
+	)
+	tick := func() {
+		m.Tick()
+		snapshot := m.Snapshot()
+		for i, rate := range []float64{snapshot.Rate1(), snapshot.Rate5(), snapshot.Rate15()} {
+			ticked[i] += int64(math.Round(rate * interval))
+		}
+		ticks++
+	}
+	for g := 0; g < stressGoroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				m.Mark(rng.Int63n(100))
+			}
+		}(g)
+	}
+	for deadline := time.Now().Add(*soak); time.Now().Before(deadline); {
+		tick()
+	}
+	close(done)
+	wg.Wait()
+	tick()
+	for i, n := range ticked {
+		if count := m.Count(); count != n {
+			t.Errorf("EWMA %d: %v events ticked in %v ticks != m.Count() %v, drifting by %v\n", i, n, ticks, count, count-n)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The String methods of the metrics and their snapshots format them as
+// these functions do, on one line in the manner of the syslog reporter, so
+// that they may be printed with fmt or logged as they are.  Durations are
+// printed with their units and rates are per second.  The GoString methods
+// of the snapshots wrap the same in the snapshot's type, so that %#v shows
+// the statistics rather than the fields they're computed from.
+
+func attemptTimerString(t *AttemptTimer) string {
+	return fmt.Sprintf("attempt: {%s} attempts: {%s} total: {%s}", durationHistogramString(t.Attempt()), histogramString(t.Attempts()), timerString(t.Total()))
+}
+
+func counterString(c Counter) string {
+	return fmt.Sprintf("count: %d", c.Count())
+}
+
+func counterFloat64String(c CounterFloat64) string {
+	return fmt.Sprintf("count: %f", c.Count())
+}
+
+func durationHistogramString(h DurationHistogram) string {
+	h = h.Snapshot()
+	var b strings.Builder
+	fmt.Fprintf(&b, "count: %d sum: %v min: %v max: %v mean: %v stddev: %v", h.Count(), h.Sum(), h.Min(), h.Max(), h.Mean(), h.StdDev())
+	percentiles := ExportedPercentiles(nil, h)
+	for j, p := range h.Percentiles(percentiles) {
+		fmt.Fprintf(&b, " %s: %v", percentileLabel(percentiles[j]), p)
+	}
+	return b.String()
+}
+
+func ewmaString(e EWMA) string {
+	return fmt.Sprintf("rate: %.2f/s", e.Rate())
+}
+
+func gaugeString(g Gauge) string {
+	return fmt.Sprintf("value: %d", g.Value())
+}
+
+func gaugeFloat64String(g GaugeFloat64) string {
+	return fmt.Sprintf("value: %f", g.Value())
+}
+
+// goString formats a snapshot of a struct type for %#v.
+func goString(typeName, s string) string {
+	return fmt.Sprintf("&metrics.%s{%s}", typeName, s)
+}
+
+func healthcheckString(h Healthcheck) string {
+	if err := h.Error(); nil != err {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return "healthy"
+}
+
+func histogramString(h Histogram) string {
+	h = h.Snapshot()
+	var b strings.Builder
+	fmt.Fprintf(&b, "count: %d sum: %d min: %d max: %d mean: %.2f stddev: %.2f", h.Count(), h.Sum(), h.Min(), h.Max(), h.Mean(), h.StdDev())
+	percentiles := ExportedPercentiles(nil, h)
+	for j, p := range h.Percentiles(percentiles) {
+		fmt.Fprintf(&b, " %s: %.2f", percentileLabel(percentiles[j]), p)
+	}
+	return b.String()
+}
+
+func histogram2DString(h Histogram2D) string {
+	h = h.Snapshot()
+	return fmt.Sprintf("count: %d x-bounds: %v y-bounds: %v counts: %v", h.Count(), h.XBounds(), h.YBounds(), h.Counts())
+}
+
+func latencySLIString(sli *LatencySLI) string {
+	good, total := sli.counts(time.Now())
+	ratio := 1.0
+	if 0 != total {
+		ratio = float64(good) / float64(total)
+	}
+	return fmt.Sprintf("ratio: %f good: %d total: %d threshold: %v", ratio, good, total, sli.Threshold())
+}
+
+func meterString(m Meter) string {
+	m = m.Snapshot()
+	return fmt.Sprintf("count: %d 1-min: %.2f/s 5-min: %.2f/s 15-min: %.2f/s mean-rate: %.2f/s", m.Count(), m.Rate1(), m.Rate5(), m.Rate15(), m.RateMean())
+}
+
+func sampleString(s Sample) string {
+	s = s.Snapshot()
+	var b strings.Builder
+	fmt.Fprintf(&b, "count: %d sum: %d min: %d max: %d mean: %.2f stddev: %.2f", s.Count(), s.Sum(), s.Min(), s.Max(), s.Mean(), s.StdDev())
+	percentiles := ExportedPercentiles(nil, s)
+	for j, p := range s.Percentiles(percentiles) {
+		fmt.Fprintf(&b, " %s: %.2f", percentileLabel(percentiles[j]), p)
+	}
+	return b.String()
+}
+
+func stagedTimerString(t StagedTimer) string {
+	t = t.Snapshot()
+	var b strings.Builder
+	eachStage(t, func(stage string, h DurationHistogram) {
+		if 0 < b.Len() {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s: {%s}", stage, durationHistogramString(h))
+	})
+	return b.String()
+}
+
+func summaryString(s Summary) string {
+	s = s.Snapshot()
+	var b strings.Builder
+	fmt.Fprintf(&b, "count: %d sum: %.2f", s.Count(), s.Sum())
+	qs := s.Quantiles()
+	for j, q := range s.Objectives() {
+		fmt.Fprintf(&b, " %s: %.2f", percentileLabel(q), qs[j])
+	}
+	return b.String()
+}
+
+func timerString(t Timer) string {
+	t = t.Snapshot()
+	var b strings.Builder
+	fmt.Fprintf(&b, "count: %d sum: %v min: %v max: %v mean: %v stddev: %v", t.Count(), time.Duration(t.Sum()), time.Duration(t.Min()), time.Duration(t.Max()), time.Duration(t.Mean()), time.Duration(t.StdDev()))
+	percentiles := ExportedPercentiles(nil, t)
+	for j, p := range t.Percentiles(percentiles) {
+		fmt.Fprintf(&b, " %s: %v", percentileLabel(percentiles[j]), time.Duration(p))
+	}
+	fmt.Fprintf(&b, " 1-min: %.2f/s 5-min: %.2f/s 15-min: %.2f/s mean-rate: %.2f/s", t.Rate1(), t.Rate5(), t.Rate15(), t.RateMean())
+	return b.String()
+}
@@ -0,0 +1,110 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestString(t *testing.T) {
+	c := NewCounter()
+	c.Inc(47)
+	if s := fmt.Sprint(c); "count: 47" != s {
+		t.Errorf("fmt.Sprint(c): %q\n", s)
+	}
+	if s := fmt.Sprint(c.Snapshot()); "count: 47" != s {
+		t.Errorf("fmt.Sprint(c.Snapshot()): %q\n", s)
+	}
+
+	h := NewHistogram(NewUniformSample(100))
+	for i := int64(1); i <= 4; i++ {
+		h.Update(i)
+	}
+	if s := fmt.Sprint(h); "count: 4 sum: 10 min: 1 max: 4 mean: 2.50 stddev: 1.12 median: 2.50 75%: 3.75 95%: 4.00 99%: 4.00 99.9%: 4.00" != s {
+		t.Errorf("fmt.Sprint(h): %q\n", s)
+	}
+
+	tm := NewTimer()
+	tm.(*StandardTimer).SetPercentiles([]float64{0.5})
+	tm.Update(time.Millisecond)
+	if s := fmt.Sprint(tm); !strings.HasPrefix(s, "count: 1 sum: 1ms min: 1ms max: 1ms mean: 1ms stddev: 0s median: 1ms 1-min: ") || !strings.HasSuffix(s, "/s") {
+		t.Errorf("fmt.Sprint(tm): %q\n", s)
+	}
+
+	hc := NewHealthcheck(func(Healthcheck) {})
+	if s := fmt.Sprint(hc); "healthy" != s {
+		t.Errorf("fmt.Sprint(hc): %q\n", s)
+	}
+	hc.Unhealthy(fmt.Errorf("down"))
+	if s := fmt.Sprint(hc); "error: down" != s {
+		t.Errorf("fmt.Sprint(hc): %q\n", s)
+	}
+
+	st := NewStagedTimer()
+	st.Start().Stage("queue")
+	if s := fmt.Sprint(st); !strings.Contains(s, "queue: {count: 1 ") || !strings.Contains(s, TotalStage+": {count: ") {
+		t.Errorf("fmt.Sprint(st): %q\n", s)
+	}
+
+	at := NewAttemptTimer()
+	at.Observe([]time.Duration{time.Millisecond, time.Millisecond})
+	if s := fmt.Sprint(at); !strings.HasPrefix(s, "attempt: {count: 2 sum: 2ms ") || !strings.Contains(s, "} attempts: {count: 1 sum: 2 ") || !strings.Contains(s, "} total: {count: 1 sum: 2ms ") {
+		t.Errorf("fmt.Sprint(at): %q\n", s)
+	}
+
+	rm := NewRollupMeter()
+	rm.Mark(3)
+	if s := fmt.Sprint(rm); !strings.HasPrefix(s, "count: 3 1-min: ") {
+		t.Errorf("fmt.Sprint(rm): %q\n", s)
+	}
+
+	sli := NewLatencySLI(nil, time.Second, time.Minute)
+	sli.Update(time.Millisecond)
+	sli.Update(time.Minute)
+	if s := fmt.Sprint(sli); "ratio: 0.500000 good: 1 total: 2 threshold: 1s" != s {
+		t.Errorf("fmt.Sprint(sli): %q\n", s)
+	}
+
+	hs := NewHdrSample(1, 1000, 3)
+	for i := int64(1); i <= 4; i++ {
+		hs.Update(i)
+	}
+	if s := fmt.Sprint(hs); !strings.HasPrefix(s, "count: 4 sum: 10 min: 1 max: 4 mean: 2.50 ") {
+		t.Errorf("fmt.Sprint(hs): %q\n", s)
+	}
+	if s := fmt.Sprint(hs.Snapshot()); !strings.HasPrefix(s, "count: 4 sum: 10 min: 1 max: 4 mean: 2.50 ") {
+		t.Errorf("fmt.Sprint(hs.Snapshot()): %q\n", s)
+	}
+}
+
+func TestGoString(t *testing.T) {
+	c := NewCounter()
+	c.Inc(47)
+	if s := fmt.Sprintf("%#v", c.Snapshot()); "metrics.CounterSnapshot(47)" != s {
+		t.Errorf("fmt.Sprintf(\"%%#v\", c.Snapshot()): %q\n", s)
+	}
+
+	g := NewGaugeFloat64()
+	g.Update(1.5)
+	if s := fmt.Sprintf("%#v", g.Snapshot()); "metrics.GaugeFloat64Snapshot(1.5)" != s {
+		t.Errorf("fmt.Sprintf(\"%%#v\", g.Snapshot()): %q\n", s)
+	}
+
+	h := NewHistogram(NewUniformSample(100))
+	for i := int64(1); i <= 4; i++ {
+		h.Update(i)
+	}
+	if s := fmt.Sprintf("%#v", h.Snapshot()); "&metrics.HistogramSnapshot{"+h.Snapshot().(*HistogramSnapshot).String()+"}" != s {
+		t.Errorf("fmt.Sprintf(\"%%#v\", h.Snapshot()): %q\n", s)
+	}
+
+	m := NewMeter()
+	m.Mark(3)
+	if s := fmt.Sprintf("%#v", m.Snapshot()); !strings.HasPrefix(s, "&metrics.MeterSnapshot{count: 3 1-min: ") || !strings.HasSuffix(s, "/s}") {
+		t.Errorf("fmt.Sprintf(\"%%#v\", m.Snapshot()): %q\n", s)
+	}
+}
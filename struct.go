@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// structMetricTypes maps the type names accepted in `metric` struct tags to
+// constructors for metrics of that type, which give histograms and timers a
+// Sample as described by the registry's SampleConfig.
+var structMetricTypes = map[string]func(SampleConfig) interface{}{
+	"counter":        func(SampleConfig) interface{} { return NewCounter() },
+	"counterfloat64": func(SampleConfig) interface{} { return NewCounterFloat64() },
+	"durationhistogram": func(c SampleConfig) interface{} {
+		return NewDurationHistogram(c.NewSample())
+	},
+	"gauge":        func(SampleConfig) interface{} { return NewGauge() },
+	"gaugefloat64": func(SampleConfig) interface{} { return NewGaugeFloat64() },
+	"histogram": func(c SampleConfig) interface{} {
+		return NewHistogram(c.NewSample())
+	},
+	"meter":       func(SampleConfig) interface{} { return NewMeter() },
+	"stagedtimer": func(c SampleConfig) interface{} { return newStagedTimer(c) },
+	"summary": func(SampleConfig) interface{} {
+		return NewSummary(DefaultSummaryObjectives, DefaultSummaryMaxAge, DefaultSummaryAgeBuckets)
+	},
+	"timer": func(c SampleConfig) interface{} { return newTimer(c) },
+}
+
+// structMetricTypeNames maps the metric interfaces which may be the type of
+// a tagged struct field to the type name inferred for them.
+var structMetricTypeNames = map[reflect.Type]string{
+	reflect.TypeOf((*Counter)(nil)).Elem():           "counter",
+	reflect.TypeOf((*CounterFloat64)(nil)).Elem():    "counterfloat64",
+	reflect.TypeOf((*DurationHistogram)(nil)).Elem(): "durationhistogram",
+	reflect.TypeOf((*Gauge)(nil)).Elem():             "gauge",
+	reflect.TypeOf((*GaugeFloat64)(nil)).Elem():      "gaugefloat64",
+	reflect.TypeOf((*Histogram)(nil)).Elem():         "histogram",
+	reflect.TypeOf((*Meter)(nil)).Elem():             "meter",
+	reflect.TypeOf((*StagedTimer)(nil)).Elem():       "stagedtimer",
+	reflect.TypeOf((*Summary)(nil)).Elem():           "summary",
+	reflect.TypeOf((*Timer)(nil)).Elem():             "timer",
+}
+
+// RegisterStruct constructs and registers a metric for each field of the
+// struct pointed to by v which has a `metric` tag and assigns it to the
+// field.  The tag gives the metric's name followed by optional
+// comma-separated options:
+//
+//	type Metrics struct {
+//	    Requests Meter   `metric:"requests"`
+//	    Latency  Timer   `metric:"latency"`
+//	    Read     Counter `metric:"read,type=counter,unit=bytes"`
+//	    Backend  struct {
+//	        Errors Meter `metric:"errors"`
+//	    } `metric:"backend"`
+//	}
+//
+// The type option, one of counter, counterfloat64, durationhistogram, gauge,
+// gaugefloat64, histogram, meter, stagedtimer, summary, or timer, is inferred
+// from the field's type when it is omitted.  The unit option is appended to
+// the name as a final dot-separated component, so the Read field above is
+// registered as "read.bytes".  Tagged fields of struct type are walked
+// recursively with their name as a further prefix.  Names are joined to the
+// prefix with a dot.
+//
+// Either every metric is registered or, if any cannot be, none is and the
+// struct is left untouched.
+func RegisterStruct(r Registry, prefix string, v interface{}) error {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	p := reflect.ValueOf(v)
+	if reflect.Ptr != p.Kind() || reflect.Struct != p.Elem().Kind() {
+		return fmt.Errorf("metrics: RegisterStruct of non-pointer-to-struct %T", v)
+	}
+	metrics := make(map[string]interface{})
+	fields := make(map[string]reflect.Value)
+	err := walkStruct(p.Elem(), prefix, r.SampleConfig(), metrics, fields)
+	if nil == err {
+		err = r.RegisterAll(metrics)
+	}
+	if nil != err {
+		// Stop the meters already constructed, which would otherwise be
+		// ticked forever.
+		for _, metric := range metrics {
+			stop(metric)
+		}
+		return err
+	}
+	for name, field := range fields {
+		field.Set(reflect.ValueOf(metrics[name]))
+	}
+	return nil
+}
+
+// MustRegisterStruct is like RegisterStruct but panics if the struct is
+// malformed or any of its metrics cannot be registered.
+func MustRegisterStruct(r Registry, prefix string, v interface{}) {
+	if err := RegisterStruct(r, prefix, v); nil != err {
+		panic(err)
+	}
+}
+
+func walkStruct(v reflect.Value, prefix string, c SampleConfig, metrics map[string]interface{}, fields map[string]reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("metric")
+		if "" == tag || "-" == tag {
+			continue
+		}
+		if "" != f.PkgPath {
+			return fmt.Errorf("metrics: unexported field %s.%s has a metric tag", t, f.Name)
+		}
+		opts := strings.Split(tag, ",")
+		name := joinName(prefix, opts[0])
+		if "" == opts[0] {
+			return fmt.Errorf("metrics: field %s.%s has no metric name", t, f.Name)
+		}
+		if reflect.Struct == f.Type.Kind() {
+			if 1 != len(opts) {
+				return fmt.Errorf("metrics: struct field %s.%s has metric options", t, f.Name)
+			}
+			if err := walkStruct(v.Field(i), name, c, metrics, fields); nil != err {
+				return err
+			}
+			continue
+		}
+		typ := structMetricTypeNames[f.Type]
+		for _, opt := range opts[1:] {
+			kv := strings.SplitN(opt, "=", 2)
+			if 2 != len(kv) {
+				return fmt.Errorf("metrics: malformed option %q on field %s.%s", opt, t, f.Name)
+			}
+			switch kv[0] {
+			case "type":
+				typ = kv[1]
+			case "unit":
+				name = joinName(name, kv[1])
+			default:
+				return fmt.Errorf("metrics: unknown option %q on field %s.%s", kv[0], t, f.Name)
+			}
+		}
+		constructor, ok := structMetricTypes[typ]
+		if !ok {
+			return fmt.Errorf("metrics: field %s.%s has unknown metric type %q", t, f.Name, typ)
+		}
+		metric := constructor(c)
+		if !reflect.TypeOf(metric).AssignableTo(f.Type) {
+			stop(metric)
+			return fmt.Errorf("metrics: %s metric cannot be assigned to field %s.%s of type %s", typ, t, f.Name, f.Type)
+		}
+		if _, ok := metrics[name]; ok {
+			stop(metric)
+			return DuplicateMetric(name)
+		}
+		metrics[name] = metric
+		fields[name] = v.Field(i)
+	}
+	return nil
+}
+
+// joinName joins a prefix and a name with a dot.
+func joinName(prefix, name string) string {
+	if "" == prefix {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,116 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+type testStructMetrics struct {
+	Requests Meter          `metric:"requests"`
+	Latency  Timer          `metric:"latency"`
+	Read     Counter        `metric:"read,type=counter,unit=bytes"`
+	CPU      CounterFloat64 `metric:"cpu,unit=seconds"`
+	Size     interface{}    `metric:"size,type=histogram"`
+	Ignored  Gauge
+	Backend  struct {
+		Errors Meter `metric:"errors"`
+	} `metric:"backend"`
+}
+
+func TestRegisterStruct(t *testing.T) {
+	r := NewRegistry()
+	var m testStructMetrics
+	if err := RegisterStruct(r, "app", &m); nil != err {
+		t.Fatal(err)
+	}
+	m.Read.Inc(47)
+	if c, ok := r.Get("app.read.bytes").(Counter); !ok || 47 != c.Count() {
+		t.Fatal(r.Get("app.read.bytes"))
+	}
+	if _, ok := m.Size.(Histogram); !ok {
+		t.Fatal(m.Size)
+	}
+	m.CPU.Inc(1.5)
+	if c, ok := r.Get("app.cpu.seconds").(CounterFloat64); !ok || 1.5 != c.Count() {
+		t.Fatal(r.Get("app.cpu.seconds"))
+	}
+	for _, name := range []string{"app.requests", "app.latency", "app.size", "app.backend.errors"} {
+		if nil == r.Get(name) {
+			t.Error(name)
+		}
+	}
+	if r.Get("app.backend.errors") != m.Backend.Errors {
+		t.Fatal(m.Backend.Errors)
+	}
+	if nil != m.Ignored {
+		t.Fatal(m.Ignored)
+	}
+}
+
+func TestRegisterStructDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.Register("app.latency", NewCounter())
+	var m testStructMetrics
+	n := arbiterMeters()
+	if err := RegisterStruct(r, "app", &m); DuplicateMetric("app.latency") != err {
+		t.Fatal(err)
+	}
+	if nil != m.Requests || nil != r.Get("app.requests") {
+		t.Fatal(m.Requests)
+	}
+	if m := arbiterMeters(); n != m {
+		t.Errorf("arbiter meters: %v != %v\n", n, m)
+	}
+}
+
+func TestRegisterStructInvalidStops(t *testing.T) {
+	var m struct {
+		Requests Meter `metric:"requests"`
+		Latency  Gauge `metric:"latency,type=timer"`
+	}
+	n := arbiterMeters()
+	if err := RegisterStruct(NewRegistry(), "", &m); nil == err {
+		t.Fatal(err)
+	}
+	if m := arbiterMeters(); n != m {
+		t.Errorf("arbiter meters: %v != %v\n", n, m)
+	}
+}
+
+// arbiterMeters returns the number of meters the arbiter is ticking.
+func arbiterMeters() int {
+	arbiter.RLock()
+	defer arbiter.RUnlock()
+	return len(arbiter.meters)
+}
+
+func TestRegisterStructInvalid(t *testing.T) {
+	r := NewRegistry()
+	if err := RegisterStruct(r, "", testStructMetrics{}); nil == err {
+		t.Fatal(err)
+	}
+	var wrongType struct {
+		G Gauge `metric:"g,type=meter"`
+	}
+	if err := RegisterStruct(r, "", &wrongType); nil == err {
+		t.Fatal(err)
+	}
+	var unknownOption struct {
+		G Gauge `metric:"g,color=red"`
+	}
+	if err := RegisterStruct(r, "", &unknownOption); nil == err {
+		t.Fatal(err)
+	}
+}
+
+func TestMustRegisterStructPanics(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Fatal("MustRegisterStruct didn't panic")
+		}
+	}()
+	var m struct {
+		X interface{} `metric:"x"`
+	}
+	MustRegisterStruct(NewRegistry(), "", &m)
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A GaugeSubscription delivers a gauge's new values on C as the gauge is
+// updated, so a component such as a load-shedder can react to a metric
+// without polling it.  Updates are coalesced: C holds at most one value and
+// a subscriber which falls behind receives only the latest, never a stale
+// one, and updates never block on a slow subscriber.
+type GaugeSubscription struct {
+	C <-chan int64
+
+	c         chan int64
+	gauge     *StandardGauge
+	mutex     sync.Mutex
+	threshold int64
+	crossing  bool // Deliver only values which cross threshold
+}
+
+// gaugeSubscriptionsMutex serializes changes to every gauge's subscribers so
+// that a StandardGauge needn't carry a mutex of its own.
+var gaugeSubscriptionsMutex sync.Mutex
+
+// SubscribeGauge subscribes to every change in the value of the gauge of the
+// given name in the given registry, constructing and registering the gauge
+// if it doesn't yet exist.  It returns an error if the metric of that name
+// isn't a StandardGauge.
+func SubscribeGauge(name string, r Registry) (*GaugeSubscription, error) {
+	return subscribeGauge(name, r, &GaugeSubscription{})
+}
+
+// SubscribeGaugeThreshold subscribes to the gauge of the given name like
+// SubscribeGauge but delivers only the values which cross the given
+// threshold, rising to or above it from below or falling below it from at or
+// above it.
+func SubscribeGaugeThreshold(name string, r Registry, threshold int64) (*GaugeSubscription, error) {
+	return subscribeGauge(name, r, &GaugeSubscription{
+		threshold: threshold,
+		crossing:  true,
+	})
+}
+
+// Unsubscribe stops the delivery of the gauge's values.  C isn't closed, as
+// an update in progress may yet deliver a value on it.
+func (s *GaugeSubscription) Unsubscribe() {
+	gaugeSubscriptionsMutex.Lock()
+	defer gaugeSubscriptionsMutex.Unlock()
+	subscribers, _ := s.gauge.subscribers.Load().([]*GaugeSubscription)
+	remaining := make([]*GaugeSubscription, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		if subscriber != s {
+			remaining = append(remaining, subscriber)
+		}
+	}
+	s.gauge.subscribers.Store(remaining)
+}
+
+// notify delivers v, replacing any value not yet received, if the change
+// from old to v is one the subscriber wants.
+func (s *GaugeSubscription) notify(old, v int64) {
+	if s.crossing && (old >= s.threshold) == (v >= s.threshold) {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.crossing {
+		v = s.gauge.Value() // Concurrent updates may notify out of order.
+	}
+	select {
+	case <-s.c:
+	default:
+	}
+	s.c <- v
+}
+
+func subscribeGauge(name string, r Registry, s *GaugeSubscription) (*GaugeSubscription, error) {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	g, ok := unwrap(r.GetOrRegister(name, NewGauge)).(*StandardGauge)
+	if !ok {
+		return nil, fmt.Errorf("metrics: %s isn't a StandardGauge", name)
+	}
+	s.c = make(chan int64, 1)
+	s.C = s.c
+	s.gauge = g
+	gaugeSubscriptionsMutex.Lock()
+	defer gaugeSubscriptionsMutex.Unlock()
+	subscribers, _ := g.subscribers.Load().([]*GaugeSubscription)
+	g.subscribers.Store(append(subscribers[:len(subscribers):len(subscribers)], s))
+	return s, nil
+}
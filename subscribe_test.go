@@ -0,0 +1,84 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestSubscribeGauge(t *testing.T) {
+	r := NewRegistry()
+	s, err := SubscribeGauge("inflight", r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	g := GetOrRegisterGauge("inflight", r)
+	g.Update(1)
+	if v := <-s.C; 1 != v {
+		t.Errorf("<-s.C: 1 != %v\n", v)
+	}
+	g.Update(2)
+	g.Update(3)
+	if v := <-s.C; 3 != v {
+		t.Errorf("<-s.C: 3 != %v after coalescing\n", v)
+	}
+	g.Update(3)
+	select {
+	case v := <-s.C:
+		t.Errorf("<-s.C: %v delivered without a change\n", v)
+	default:
+	}
+	s.Unsubscribe()
+	g.Update(4)
+	select {
+	case v := <-s.C:
+		t.Errorf("<-s.C: %v delivered after Unsubscribe\n", v)
+	default:
+	}
+}
+
+func TestSubscribeGaugeThreshold(t *testing.T) {
+	r := NewRegistry()
+	s, err := SubscribeGaugeThreshold("inflight", r, 10)
+	if nil != err {
+		t.Fatal(err)
+	}
+	g := GetOrRegisterGauge("inflight", r)
+	g.Update(5)
+	g.Update(12)
+	if v := <-s.C; 12 != v {
+		t.Errorf("<-s.C: 12 != %v\n", v)
+	}
+	g.Update(15)
+	g.Update(9)
+	if v := <-s.C; 9 != v {
+		t.Errorf("<-s.C: 9 != %v\n", v)
+	}
+}
+
+func TestSubscribeGaugeNotStandard(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo", NewCounter())
+	if _, err := SubscribeGauge("foo", r); nil == err {
+		t.Error("SubscribeGauge(): expected an error subscribing to a counter")
+	}
+}
+
+func TestSubscribeGaugeSetMax(t *testing.T) {
+	r := NewRegistry()
+	s, err := SubscribeGauge("peak", r)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer s.Unsubscribe()
+	g := GetOrRegisterGauge("peak", r)
+	g.SetMax(5)
+	if v := <-s.C; 5 != v {
+		t.Errorf("<-s.C: 5 != %v\n", v)
+	}
+	g.SetMax(4)
+	select {
+	case v := <-s.C:
+		t.Errorf("<-s.C: %v delivered without a change\n", v)
+	default:
+	}
+}
@@ -0,0 +1,436 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
+)
+
+// quantileStreamBufferSize is the number of values a quantileStream buffers
+// before merging them into its summary.
+const quantileStreamBufferSize = 500
+
+// DefaultSummaryObjectives are the quantiles and errors targeted by the
+// Prometheus client libraries' summaries by default.
+var DefaultSummaryObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// DefaultSummaryMaxAge and DefaultSummaryAgeBuckets likewise match the
+// Prometheus client libraries' sliding window.
+const (
+	DefaultSummaryMaxAge     = 10 * time.Minute
+	DefaultSummaryAgeBuckets = 5
+)
+
+// Summaries track the count and sum of a series of float64 values and
+// estimate quantiles of those seen in a sliding time window.  Each quantile
+// is estimated to within its own absolute error target, so a summary with
+// objectives {0.5: 0.05, 0.99: 0.001} reports as its median a value ranked
+// between the 45th and 55th percentiles and as its 99th percentile one
+// ranked between the 98.9th and 99.1st.
+type Summary = metricsiface.Summary
+
+// GetOrRegisterSummary returns an existing Summary or constructs and
+// registers a new StandardSummary.
+func GetOrRegisterSummary(name string, r Registry, objectives map[float64]float64, maxAge time.Duration, ageBuckets int) Summary {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(name, func() Summary {
+		return NewSummary(objectives, maxAge, ageBuckets)
+	}).(Summary)
+}
+
+// NewSummary constructs a new StandardSummary which estimates the quantiles
+// given as the keys of objectives to within the absolute errors given as
+// their values.  Quantiles are estimated over values observed in the last
+// maxAge, which is divided into ageBuckets intervals so that old values
+// expire a bucket at a time; a maxAge of zero estimates quantiles over every
+// value ever observed.  It panics if a quantile is not between 0 and 1 or an
+// error is not between 0 and the lesser of the quantile and 1 minus it.
+func NewSummary(objectives map[float64]float64, maxAge time.Duration, ageBuckets int) Summary {
+	if metricsDisabled || UseNilMetrics {
+		return NilSummary{}
+	}
+	targets := make([]quantileTarget, 0, len(objectives))
+	for q, e := range objectives {
+		if q <= 0 || 1 <= q || e < 0 || math.Min(q, 1-q) < e {
+			panic(fmt.Sprintf("metrics: invalid summary objective %v: %v", q, e))
+		}
+		targets = append(targets, quantileTarget{q, e})
+	}
+	sort.Sort(quantileTargetSlice(targets))
+	if maxAge <= 0 || ageBuckets < 1 {
+		ageBuckets = 1
+	}
+	s := &StandardSummary{
+		streams: make([]*quantileStream, ageBuckets),
+		maxAge:  maxAge,
+	}
+	for i := range s.streams {
+		s.streams[i] = newQuantileStream(targets)
+	}
+	if 0 < maxAge {
+		s.bucketAge = maxAge / time.Duration(ageBuckets)
+		s.headExpires = time.Now().Add(maxAge)
+	}
+	return s
+}
+
+// NewRegisteredSummary constructs and registers a new StandardSummary.
+func NewRegisteredSummary(name string, r Registry, objectives map[float64]float64, maxAge time.Duration, ageBuckets int) Summary {
+	c := NewSummary(objectives, maxAge, ageBuckets)
+	if nil == r {
+		r = DefaultRegistry
+	}
+	r.Register(name, c)
+	return c
+}
+
+// SummarySnapshot is a read-only copy of another Summary.
+type SummarySnapshot struct {
+	count  int64
+	sum    float64
+	stream *quantileStream
+}
+
+// Count returns the number of values observed at the time the snapshot was
+// taken.
+func (s *SummarySnapshot) Count() int64 { return s.count }
+
+// GoString formats the statistics of the snapshot for %#v.
+func (s *SummarySnapshot) GoString() string { return goString("SummarySnapshot", summaryString(s)) }
+
+// Objectives returns the quantiles the summary was constructed to estimate,
+// in increasing order.
+func (s *SummarySnapshot) Objectives() []float64 {
+	return s.stream.objectives()
+}
+
+// Quantile returns an estimate of an arbitrary quantile of the values in the
+// window at the time the snapshot was taken.  Quantiles other than the
+// summary's objectives are not subject to any error target.
+func (s *SummarySnapshot) Quantile(q float64) float64 {
+	return s.stream.query(q)
+}
+
+// Quantiles returns estimates of the summary's objectives at the time the
+// snapshot was taken, in the order given by Objectives.
+func (s *SummarySnapshot) Quantiles() []float64 {
+	qs := s.stream.objectives()
+	for i, q := range qs {
+		qs[i] = s.stream.query(q)
+	}
+	return qs
+}
+
+// Snapshot returns the snapshot.
+func (s *SummarySnapshot) Snapshot() Summary { return s }
+
+// String formats the count, sum, and quantiles for debugging.
+func (s *SummarySnapshot) String() string { return summaryString(s) }
+
+// Sum returns the sum of the values observed at the time the snapshot was
+// taken.
+func (s *SummarySnapshot) Sum() float64 { return s.sum }
+
+// Update panics.
+func (*SummarySnapshot) Update(float64) {
+	panic("Update called on a SummarySnapshot")
+}
+
+// NilSummary is a no-op Summary.
+type NilSummary struct{}
+
+// Count is a no-op.
+func (NilSummary) Count() int64 { return 0 }
+
+// Objectives is a no-op.
+func (NilSummary) Objectives() []float64 { return []float64{} }
+
+// Quantile is a no-op.
+func (NilSummary) Quantile(q float64) float64 { return 0.0 }
+
+// Quantiles is a no-op.
+func (NilSummary) Quantiles() []float64 { return []float64{} }
+
+// Snapshot is a no-op.
+func (NilSummary) Snapshot() Summary { return NilSummary{} }
+
+// Sum is a no-op.
+func (NilSummary) Sum() float64 { return 0.0 }
+
+// Update is a no-op.
+func (NilSummary) Update(v float64) {}
+
+// StandardSummary is the standard implementation of a Summary.  It keeps one
+// quantile stream per age bucket, each of which sees every value, and
+// answers queries from the oldest; when that stream has covered maxAge it is
+// reset and the next oldest takes its place.
+type StandardSummary struct {
+	count       int64
+	sum         float64
+	mutex       sync.Mutex
+	streams     []*quantileStream
+	head        int
+	maxAge      time.Duration
+	bucketAge   time.Duration
+	headExpires time.Time
+}
+
+// Count returns the number of values observed.
+func (s *StandardSummary) Count() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.count
+}
+
+// Objectives returns the quantiles the summary was constructed to estimate,
+// in increasing order.
+func (s *StandardSummary) Objectives() []float64 {
+	return s.streams[0].objectives()
+}
+
+// Quantile returns an estimate of an arbitrary quantile of the values in the
+// window.  Quantiles other than the summary's objectives are not subject to
+// any error target.
+func (s *StandardSummary) Quantile(q float64) float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rotate(time.Now())
+	return s.streams[s.head].query(q)
+}
+
+// Quantiles returns estimates of the summary's objectives in the order given
+// by Objectives.
+func (s *StandardSummary) Quantiles() []float64 {
+	return s.Snapshot().Quantiles()
+}
+
+// Snapshot returns a read-only copy of the summary.
+func (s *StandardSummary) Snapshot() Summary {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rotate(time.Now())
+	return &SummarySnapshot{
+		count:  s.count,
+		sum:    s.sum,
+		stream: s.streams[s.head].copy(),
+	}
+}
+
+// String formats the count, sum, and quantiles for debugging.
+func (s *StandardSummary) String() string { return summaryString(s) }
+
+// Sum returns the sum of the values observed.
+func (s *StandardSummary) Sum() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sum
+}
+
+// Update observes a new value.
+func (s *StandardSummary) Update(v float64) {
+	s.update(time.Now(), v)
+}
+
+// rotate resets and retires each head stream that has covered maxAge as of
+// t.  It must be called with s.mutex held.
+func (s *StandardSummary) rotate(t time.Time) {
+	if 0 == s.maxAge || t.Before(s.headExpires) {
+		return
+	}
+	if !t.Before(s.headExpires.Add(s.maxAge)) {
+		for _, stream := range s.streams {
+			stream.reset()
+		}
+		s.headExpires = t.Add(s.bucketAge)
+		return
+	}
+	for !t.Before(s.headExpires) {
+		s.streams[s.head].reset()
+		s.head = (s.head + 1) % len(s.streams)
+		s.headExpires = s.headExpires.Add(s.bucketAge)
+	}
+}
+
+func (s *StandardSummary) update(t time.Time, v float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rotate(t)
+	s.count++
+	s.sum += v
+	for _, stream := range s.streams {
+		stream.insert(v)
+	}
+}
+
+// quantileTarget is a quantile and the absolute error allowed in estimating
+// it.
+type quantileTarget struct {
+	quantile, error float64
+}
+
+// quantileTargetSlice is a slice of quantileTargets that implements
+// sort.Interface.
+type quantileTargetSlice []quantileTarget
+
+func (ts quantileTargetSlice) Len() int { return len(ts) }
+
+func (ts quantileTargetSlice) Less(i, j int) bool {
+	return ts[i].quantile < ts[j].quantile
+}
+
+func (ts quantileTargetSlice) Swap(i, j int) { ts[i], ts[j] = ts[j], ts[i] }
+
+// quantileSample is a value in a quantileStream's summary.  Width is the
+// difference between the lowest possible rank of this value and the previous
+// one and delta the difference between its highest and lowest possible
+// ranks.
+type quantileSample struct {
+	value, width, delta float64
+}
+
+// quantileStream estimates targeted quantiles of a stream of values using
+// the algorithm of Cormode, Korn, Muthukrishnan, and Srivastava's "Effective
+// Computation of Biased Quantiles over Data Streams".  It is not safe for
+// concurrent use.
+//
+// <http://www.cs.rutgers.edu/~muthu/bquant.pdf>
+type quantileStream struct {
+	targets []quantileTarget
+	n       float64
+	samples []quantileSample
+	buffer  []float64
+}
+
+func newQuantileStream(targets []quantileTarget) *quantileStream {
+	return &quantileStream{
+		targets: targets,
+		buffer:  make([]float64, 0, quantileStreamBufferSize),
+	}
+}
+
+// copy returns a copy of the stream with every buffered value merged.
+func (s *quantileStream) copy() *quantileStream {
+	s.flush()
+	samples := make([]quantileSample, len(s.samples))
+	copy(samples, s.samples)
+	return &quantileStream{targets: s.targets, n: s.n, samples: samples}
+}
+
+func (s *quantileStream) insert(v float64) {
+	s.buffer = append(s.buffer, v)
+	if quantileStreamBufferSize == len(s.buffer) {
+		s.flush()
+	}
+}
+
+// invariant returns the greatest width plus delta a sample at rank r may
+// have while every target's error bound is still met.
+func (s *quantileStream) invariant(r float64) float64 {
+	m := math.MaxFloat64
+	for _, t := range s.targets {
+		var f float64
+		if t.quantile*s.n <= r {
+			f = 2 * t.error * r / t.quantile
+		} else {
+			f = 2 * t.error * (s.n - r) / (1 - t.quantile)
+		}
+		if f < m {
+			m = f
+		}
+	}
+	return m
+}
+
+// flush merges the buffered values into the summary and compresses it.
+func (s *quantileStream) flush() {
+	if 0 == len(s.buffer) {
+		return
+	}
+	sort.Float64s(s.buffer)
+	var r float64
+	i := 0
+	for _, v := range s.buffer {
+		for ; i < len(s.samples) && s.samples[i].value <= v; i++ {
+			r += s.samples[i].width
+		}
+		delta := 0.0
+		if i < len(s.samples) {
+			delta = math.Max(0, math.Floor(s.invariant(r))-1)
+		}
+		s.samples = append(s.samples, quantileSample{})
+		copy(s.samples[i+1:], s.samples[i:])
+		s.samples[i] = quantileSample{value: v, width: 1, delta: delta}
+		i++
+		s.n++
+		r++
+	}
+	s.buffer = s.buffer[:0]
+	s.compress()
+}
+
+// compress merges adjacent samples whose combined uncertainty still meets
+// the invariant.
+func (s *quantileStream) compress() {
+	if len(s.samples) < 2 {
+		return
+	}
+	xi := len(s.samples) - 1
+	x := s.samples[xi]
+	r := s.n - 1 - x.width
+	for i := len(s.samples) - 2; 0 <= i; i-- {
+		c := s.samples[i]
+		if c.width+x.width+x.delta <= s.invariant(r) {
+			x.width += c.width
+			s.samples[xi] = x
+			copy(s.samples[i:], s.samples[i+1:])
+			s.samples = s.samples[:len(s.samples)-1]
+			xi--
+		} else {
+			x = c
+			xi = i
+		}
+		r -= c.width
+	}
+}
+
+// objectives returns the target quantiles in increasing order.
+func (s *quantileStream) objectives() []float64 {
+	qs := make([]float64, len(s.targets))
+	for i, t := range s.targets {
+		qs[i] = t.quantile
+	}
+	return qs
+}
+
+// query returns an estimate of the qth quantile or zero if the stream is
+// empty.
+func (s *quantileStream) query(q float64) float64 {
+	s.flush()
+	if 0 == len(s.samples) {
+		return 0.0
+	}
+	t := math.Ceil(q * s.n)
+	t += math.Ceil(s.invariant(t) / 2)
+	p := s.samples[0]
+	var r float64
+	for _, c := range s.samples[1:] {
+		r += p.width
+		if r+c.width+c.delta > t {
+			return p.value
+		}
+		p = c
+	}
+	return p.value
+}
+
+func (s *quantileStream) reset() {
+	s.n = 0
+	s.samples = s.samples[:0]
+	s.buffer = s.buffer[:0]
+}
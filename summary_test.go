@@ -0,0 +1,122 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func BenchmarkSummary(b *testing.B) {
+	s := NewSummary(DefaultSummaryObjectives, DefaultSummaryMaxAge, DefaultSummaryAgeBuckets)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Update(float64(i))
+	}
+}
+
+func TestGetOrRegisterSummary(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredSummary("foo", r, DefaultSummaryObjectives, 0, 0).Update(47)
+	if s := GetOrRegisterSummary("foo", r, DefaultSummaryObjectives, 0, 0); 1 != s.Count() {
+		t.Fatal(s)
+	}
+}
+
+func TestSummaryObjectives(t *testing.T) {
+	objectives := map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+	s := NewSummary(objectives, 0, 0)
+	r := rand.New(rand.NewSource(1))
+	for _, v := range r.Perm(100000) {
+		s.Update(float64(v))
+	}
+	if count := s.Count(); 100000 != count {
+		t.Errorf("s.Count(): 100000 != %v\n", count)
+	}
+	if sum := s.Sum(); 4999950000 != sum {
+		t.Errorf("s.Sum(): 4999950000 != %v\n", sum)
+	}
+	qs := s.Quantiles()
+	for i, q := range s.Objectives() {
+		e := objectives[q]
+		if qs[i] < (q-e)*100000 || (q+e)*100000 < qs[i] {
+			t.Errorf("quantile %v: %v outside [%v, %v]\n", q, qs[i], (q-e)*100000, (q+e)*100000)
+		}
+	}
+}
+
+func TestSummaryEmpty(t *testing.T) {
+	s := NewSummary(DefaultSummaryObjectives, time.Minute, 5)
+	if count := s.Count(); 0 != count {
+		t.Errorf("s.Count(): 0 != %v\n", count)
+	}
+	if q := s.Quantile(0.5); 0.0 != q {
+		t.Errorf("s.Quantile(0.5): 0.0 != %v\n", q)
+	}
+	if qs := s.Quantiles(); 3 != len(qs) {
+		t.Errorf("len(s.Quantiles()): 3 != %v\n", len(qs))
+	}
+}
+
+func TestSummaryInvalidObjective(t *testing.T) {
+	defer func() {
+		if nil == recover() {
+			t.Error("NewSummary didn't panic")
+		}
+	}()
+	NewSummary(map[float64]float64{0.99: 0.05}, 0, 0)
+}
+
+func TestSummarySnapshot(t *testing.T) {
+	s := NewSummary(map[float64]float64{0.5: 0.01}, 0, 0)
+	for i := 1; i <= 100; i++ {
+		s.Update(float64(i))
+	}
+	snapshot := s.Snapshot()
+	for i := 0; i < 100; i++ {
+		s.Update(1000)
+	}
+	if count := snapshot.Count(); 100 != count {
+		t.Errorf("snapshot.Count(): 100 != %v\n", count)
+	}
+	if q := snapshot.Quantile(0.5); q < 49 || 51 < q {
+		t.Errorf("snapshot.Quantile(0.5): %v\n", q)
+	}
+}
+
+func TestSummaryWindow(t *testing.T) {
+	s := NewSummary(map[float64]float64{0.5: 0.01}, time.Minute, 2).(*StandardSummary)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		s.update(now, 1)
+	}
+	s.update(now.Add(70*time.Second), 2)
+	if q := s.Quantile(0.5); 1 != q {
+		t.Errorf("s.Quantile(0.5) before the window passes: 1 != %v\n", q)
+	}
+	for i := 0; i < 100; i++ {
+		s.update(now.Add(100*time.Second), 3)
+	}
+	s.mutex.Lock()
+	s.rotate(now.Add(100 * time.Second))
+	q := s.streams[s.head].query(0.5)
+	s.mutex.Unlock()
+	if 3 != q {
+		t.Errorf("quantile once the window has passed: 3 != %v\n", q)
+	}
+	if count := s.Count(); 201 != count {
+		t.Errorf("s.Count(): 201 != %v\n", count)
+	}
+}
+
+func TestSummaryIdle(t *testing.T) {
+	s := NewSummary(map[float64]float64{0.5: 0.01}, time.Minute, 5).(*StandardSummary)
+	now := time.Now()
+	s.update(now, 1)
+	s.update(now.Add(time.Hour), 2)
+	if q := s.streams[s.head].query(0.5); 2 != q {
+		t.Errorf("quantile after idling: 2 != %v\n", q)
+	}
+}
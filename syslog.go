@@ -1,45 +1,100 @@
-// +build !windows
+//go:build !windows && !tinygo
+// +build !windows,!tinygo
 
 package metrics
 
 import (
 	"fmt"
 	"log/syslog"
+	"strconv"
 	"time"
 )
 
+// SyslogConfig provides a container with configuration parameters for the
+// Syslog reporter.
+type SyslogConfig struct {
+	Registry      Registry       // Registry to be exported
+	FlushInterval time.Duration  // Flush interval
+	Writer        *syslog.Writer // Syslogger to which metrics are written
+	ValuePolicy   *ValuePolicy   // NaN, ±Inf and negative value handling; nil means DefaultValuePolicy
+}
+
 // Output each metric in the given registry to syslog periodically using
 // the given syslogger.
 func Syslog(r Registry, d time.Duration, w *syslog.Writer) {
-	for _ = range time.Tick(d) {
+	SyslogWithConfig(SyslogConfig{Registry: r, FlushInterval: d, Writer: w})
+}
+
+// SyslogWithConfig is a blocking reporter function just like Syslog, but it
+// takes a SyslogConfig instead.  Values its ValuePolicy rejects are left out
+// of each line.
+func SyslogWithConfig(c SyslogConfig) {
+	r, w, policy := c.Registry, c.Writer, valuePolicy(c.ValuePolicy)
+	intField := func(format, key string, v int64) string {
+		if v, ok := policy.Int(v); ok {
+			return fmt.Sprintf(format, key, v)
+		}
+		return ""
+	}
+	floatField := func(format, key string, v float64) string {
+		if v, ok := policy.Float(v); ok {
+			return fmt.Sprintf(format, key, v)
+		}
+		return ""
+	}
+	durationField := func(format, key string, d time.Duration) string {
+		if v, ok := policy.Int(int64(d)); ok {
+			return fmt.Sprintf(format, key, time.Duration(v))
+		}
+		return ""
+	}
+	for _ = range tick("syslog", priorityReport, c.FlushInterval) {
 		r.Each(func(name string, i interface{}) {
 			switch metric := i.(type) {
 			case Counter:
 				w.Info(fmt.Sprintf("counter %s: count: %d", name, metric.Count()))
+			case CounterFloat64:
+				w.Info(fmt.Sprintf("counter %s:", name) + floatField(" %s: %f", "count", metric.Count()))
 			case Gauge:
-				w.Info(fmt.Sprintf("gauge %s: value: %d", name, metric.Value()))
+				w.Info(fmt.Sprintf("gauge %s:", name) + intField(" %s: %d", "value", metric.Value()))
 			case GaugeFloat64:
-				w.Info(fmt.Sprintf("gauge %s: value: %f", name, metric.Value()))
+				w.Info(fmt.Sprintf("gauge %s:", name) + floatField(" %s: %f", "value", metric.Value()))
 			case Healthcheck:
 				metric.Check()
 				w.Info(fmt.Sprintf("healthcheck %s: error: %v", name, metric.Error()))
 			case Histogram:
 				h := metric.Snapshot()
-				ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				w.Info(fmt.Sprintf(
-					"histogram %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f median: %.2f 75%%: %.2f 95%%: %.2f 99%%: %.2f 99.9%%: %.2f",
-					name,
-					h.Count(),
-					h.Min(),
-					h.Max(),
-					h.Mean(),
-					h.StdDev(),
-					ps[0],
-					ps[1],
-					ps[2],
-					ps[3],
-					ps[4],
-				))
+				percentiles := ExportedPercentiles(r, i)
+				ps := h.Percentiles(percentiles)
+				line := fmt.Sprintf("histogram %s: count: %d", name, h.Count()) +
+					intField(" %s: %d", "min", h.Min()) +
+					intField(" %s: %d", "max", h.Max()) +
+					floatField(" %s: %.2f", "mean", h.Mean()) +
+					floatField(" %s: %.2f", "stddev", h.StdDev())
+				for j, p := range percentiles {
+					line += floatField(" %s: %.2f", percentileLabel(p), ps[j])
+				}
+				w.Info(line)
+			case DurationHistogram:
+				h := metric.Snapshot()
+				percentiles := ExportedPercentiles(r, i)
+				ps := h.Percentiles(percentiles)
+				line := fmt.Sprintf("duration histogram %s: count: %d", name, h.Count()) +
+					durationField(" %s: %v", "min", h.Min()) +
+					durationField(" %s: %v", "max", h.Max()) +
+					durationField(" %s: %v", "mean", h.Mean()) +
+					durationField(" %s: %v", "stddev", h.StdDev())
+				for j, p := range percentiles {
+					line += durationField(" %s: %v", percentileLabel(p), ps[j])
+				}
+				w.Info(line)
+			case Histogram2D:
+				h := metric.Snapshot()
+				line := fmt.Sprintf("histogram2d %s: count: %d", name, h.Count())
+				eachHistogram2DCell(h, func(x, y string, count int64) {
+					line += fmt.Sprintf(" x<=%s,y<=%s: %d", x, y, count)
+				})
+				w.Info(line)
 			case Meter:
 				m := metric.Snapshot()
 				w.Info(fmt.Sprintf(
@@ -51,27 +106,43 @@ func Syslog(r Registry, d time.Duration, w *syslog.Writer) {
 					m.Rate15(),
 					m.RateMean(),
 				))
+			case Summary:
+				s := metric.Snapshot()
+				line := fmt.Sprintf("summary %s: count: %d", name, s.Count()) +
+					floatField(" %s: %.2f", "sum", s.Sum())
+				qs := s.Quantiles()
+				for i, q := range s.Objectives() {
+					line += floatField(" %s%%: %.2f", strconv.FormatFloat(q*100.0, 'f', -1, 64), qs[i])
+				}
+				w.Info(line)
+			case StagedTimer:
+				eachStage(metric.Snapshot(), func(stage string, h DurationHistogram) {
+					percentiles := ExportedPercentiles(r, h)
+					ps := h.Percentiles(percentiles)
+					line := fmt.Sprintf("staged timer %s: stage: %s count: %d", name, stage, h.Count()) +
+						durationField(" %s: %v", "min", h.Min()) +
+						durationField(" %s: %v", "max", h.Max()) +
+						durationField(" %s: %v", "mean", h.Mean()) +
+						durationField(" %s: %v", "stddev", h.StdDev())
+					for j, p := range percentiles {
+						line += durationField(" %s: %v", percentileLabel(p), ps[j])
+					}
+					w.Info(line)
+				})
 			case Timer:
 				t := metric.Snapshot()
-				ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
-				w.Info(fmt.Sprintf(
-					"timer %s: count: %d min: %d max: %d mean: %.2f stddev: %.2f median: %.2f 75%%: %.2f 95%%: %.2f 99%%: %.2f 99.9%%: %.2f 1-min: %.2f 5-min: %.2f 15-min: %.2f mean-rate: %.2f",
-					name,
-					t.Count(),
-					t.Min(),
-					t.Max(),
-					t.Mean(),
-					t.StdDev(),
-					ps[0],
-					ps[1],
-					ps[2],
-					ps[3],
-					ps[4],
-					t.Rate1(),
-					t.Rate5(),
-					t.Rate15(),
-					t.RateMean(),
-				))
+				percentiles := ExportedPercentiles(r, i)
+				ps := t.Percentiles(percentiles)
+				line := fmt.Sprintf("timer %s: count: %d", name, t.Count()) +
+					intField(" %s: %d", "min", t.Min()) +
+					intField(" %s: %d", "max", t.Max()) +
+					floatField(" %s: %.2f", "mean", t.Mean()) +
+					floatField(" %s: %.2f", "stddev", t.StdDev())
+				for j, p := range percentiles {
+					line += floatField(" %s: %.2f", percentileLabel(p), ps[j])
+				}
+				line += fmt.Sprintf(" 1-min: %.2f 5-min: %.2f 15-min: %.2f mean-rate: %.2f", t.Rate1(), t.Rate5(), t.Rate15(), t.RateMean())
+				w.Info(line)
 			}
 		})
 	}
@@ -0,0 +1,119 @@
+package metrics
+
+// GetOrRegisterWithTags gets an existing metric or registers the given one,
+// or the one returned by the given function, under the given name with the
+// given tags, as by TaggedName, so that the exporters which support tags,
+// such as Graphite, OpenTSDB, and Prometheus, export them as labels rather
+// than as part of the name.  Tags already in the name are kept unless the
+// given tags replace them.  Since the tags are part of the name, they're
+// carried by Each, and so by every snapshot and exporter, without any change
+// to the metrics themselves.
+func GetOrRegisterWithTags(name string, tags map[string]string, i interface{}, r Registry) interface{} {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return r.GetOrRegister(withTags(name, tags), i)
+}
+
+// TaggedRegistry is a Registry which adds a set of tags, such as the host or
+// the colo, to the names of all the metrics it registers, as PrefixedRegistry
+// adds a prefix.  The tags of a metric's name take precedence over the
+// registry's.  Every other method is delegated to the underlying registry.
+type TaggedRegistry struct {
+	Registry
+	tags map[string]string
+}
+
+// NewTaggedRegistry constructs a TaggedRegistry which adds the given tags to
+// the names of the metrics it registers in the given registry.
+func NewTaggedRegistry(r Registry, tags map[string]string) *TaggedRegistry {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return &TaggedRegistry{Registry: r, tags: copied}
+}
+
+// ExportedPercentiles returns the underlying registry's percentiles.
+func (tr *TaggedRegistry) ExportedPercentiles() []float64 {
+	return registryPercentiles(tr.Registry)
+}
+
+// Get gets the metric with the given name and the registry's tags.
+func (tr *TaggedRegistry) Get(name string) interface{} {
+	return tr.Registry.Get(tr.name(name))
+}
+
+// GetOrRegister gets an existing metric or registers the given one under the
+// given name with the registry's tags.
+func (tr *TaggedRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	return tr.Registry.GetOrRegister(tr.name(name), i)
+}
+
+// GetOrRegisterWithTags gets an existing metric or registers the given one
+// under the given name with the registry's tags and the given ones, which
+// take precedence.
+func (tr *TaggedRegistry) GetOrRegisterWithTags(name string, tags map[string]string, i interface{}) interface{} {
+	return tr.GetOrRegister(withTags(name, tags), i)
+}
+
+// Register registers the given metric under the given name with the
+// registry's tags.
+func (tr *TaggedRegistry) Register(name string, i interface{}) error {
+	return tr.Registry.Register(tr.name(name), i)
+}
+
+// RegisterAll registers all the given metrics or none of them, each under its
+// name with the registry's tags.
+func (tr *TaggedRegistry) RegisterAll(metrics map[string]interface{}) error {
+	tagged := make(map[string]interface{}, len(metrics))
+	for name, metric := range metrics {
+		tagged[tr.name(name)] = metric
+	}
+	return tr.Registry.RegisterAll(tagged)
+}
+
+// Tags returns a copy of the tags the registry adds.
+func (tr *TaggedRegistry) Tags() map[string]string {
+	tags := make(map[string]string, len(tr.tags))
+	for k, v := range tr.tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Unregister unregisters the metric with the given name and the registry's
+// tags.
+func (tr *TaggedRegistry) Unregister(name string) {
+	tr.Registry.Unregister(tr.name(name))
+}
+
+// name returns the given name with the registry's tags added to those it
+// has already.
+func (tr *TaggedRegistry) name(name string) string {
+	family, tags := SplitTaggedName(name)
+	merged := tr.Tags()
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return TaggedName(family, merged)
+}
+
+// withTags returns the given name with the given tags added to, or replacing,
+// those it has already.
+func withTags(name string, tags map[string]string) string {
+	if 0 == len(tags) {
+		return name
+	}
+	family, merged := SplitTaggedName(name)
+	if nil == merged {
+		merged = make(map[string]string, len(tags))
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return TaggedName(family, merged)
+}
@@ -0,0 +1,37 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestGetOrRegisterWithTags(t *testing.T) {
+	r := NewRegistry()
+	c := GetOrRegisterWithTags("requests;colo=SJC", map[string]string{"host": "edge01"}, NewCounter, r).(Counter)
+	c.Inc(1)
+	if m, ok := r.Get("requests;colo=SJC;host=edge01").(Counter); !ok || 1 != m.Count() {
+		t.Errorf("r.Get(\"requests;colo=SJC;host=edge01\"): %v\n", r.Get("requests;colo=SJC;host=edge01"))
+	}
+	if m := GetOrRegisterWithTags("requests", map[string]string{"host": "edge01", "colo": "SJC"}, NewCounter, r); m != c {
+		t.Errorf("GetOrRegisterWithTags(): %v != %v\n", m, c)
+	}
+}
+
+func TestTaggedRegistry(t *testing.T) {
+	r := NewRegistry()
+	tr := NewTaggedRegistry(r, map[string]string{"host": "edge01", "colo": "SJC"})
+	GetOrRegisterCounter("requests", tr).Inc(1)
+	tr.GetOrRegisterWithTags("requests", map[string]string{"colo": "LAX"}, NewCounter).(Counter).Inc(2)
+	var names []string
+	r.Each(func(name string, i interface{}) { names = append(names, name) })
+	if 2 != len(names) || "requests;colo=LAX;host=edge01" != names[0] || "requests;colo=SJC;host=edge01" != names[1] {
+		t.Errorf("names: %v\n", names)
+	}
+	if c := GetOrRegisterCounter("requests", tr); 1 != c.Count() {
+		t.Errorf("c.Count(): 1 != %v\n", c.Count())
+	}
+	tr.Unregister("requests")
+	if nil != r.Get("requests;colo=SJC;host=edge01") {
+		t.Error("requests;colo=SJC;host=edge01 still registered")
+	}
+}
@@ -0,0 +1,695 @@
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TenantTag is the tag which distinguishes the metrics of each tenant in its
+// parent registry.
+const TenantTag = "tenant"
+
+// QuotaExceeded is the error returned by a TenantRegistry's Register and
+// RegisterAll when registering a metric would exceed the tenant's quota.
+type QuotaExceeded string
+
+func (err QuotaExceeded) Error() string {
+	return fmt.Sprintf("metric quota exceeded: %s", string(err))
+}
+
+// TenantQuota limits the metrics of a tenant.  Zero values are unlimited.
+type TenantQuota struct {
+	MaxMetrics    int           // Metrics the tenant may register
+	MaxUpdateRate float64       // Updates per second, in bursts of up to a second's worth, beyond which updates are dropped
+	Expiry        time.Duration // Time after which a metric which hasn't been updated is unregistered
+}
+
+// DefaultTenantQuota is the quota given to new tenants.
+var DefaultTenantQuota TenantQuota
+
+// TenantRegistry is an isolated namespace within a registry, returned by
+// Registry.Tenant, which lets multi-tenant services give each customer their
+// own metrics without any one of them exhausting the process's memory.
+//
+// A tenant's metrics are registered in its parent under names tagged with
+// the tenant's id, as by TaggedName, so exporters of the parent export every
+// tenant's metrics as members of shared families.  They are wrapped so that
+// updates beyond the tenant's rate quota are dropped and the time of each
+// metric's last update is known to ExpireTenants.  Once a tenant has as many
+// metrics as its quota allows, GetOrRegister returns a no-op metric rather
+// than registering another.
+type TenantRegistry struct {
+	dropped atomic.Int64 // updates dropped by the rate quota
+	id      string
+	parent  Registry
+	quota   atomic.Value // TenantQuota
+
+	mutex   sync.RWMutex
+	entries map[string]*tenantEntry
+
+	bucketMutex  sync.Mutex
+	bucketTokens float64
+	bucketTime   time.Time
+
+	sampleConfig atomic.Value // SampleConfig
+}
+
+type tenantEntry struct {
+	updated atomic.Int64 // UnixNano of the last update
+	metric  interface{}
+	name    string // in the parent registry
+	tenant  *TenantRegistry
+}
+
+// tenantSet holds the tenants of a registry.
+type tenantSet struct {
+	mutex   sync.Mutex
+	tenants map[string]*TenantRegistry
+}
+
+// tenant returns the tenant of the given parent with the given id,
+// constructing it if need be.
+func (s *tenantSet) tenant(parent Registry, id string) *TenantRegistry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if t, ok := s.tenants[id]; ok {
+		return t
+	}
+	if nil == s.tenants {
+		s.tenants = make(map[string]*TenantRegistry)
+	}
+	t := &TenantRegistry{
+		id:      id,
+		parent:  parent,
+		entries: make(map[string]*tenantEntry),
+	}
+	t.quota.Store(DefaultTenantQuota)
+	s.tenants[id] = t
+	return t
+}
+
+// each calls f with each tenant in the set.
+func (s *tenantSet) each(f func(*TenantRegistry)) {
+	s.mutex.Lock()
+	tenants := make([]*TenantRegistry, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		tenants = append(tenants, t)
+	}
+	s.mutex.Unlock()
+	for _, t := range tenants {
+		f(t)
+	}
+}
+
+// ExpireTenants unregisters the idle metrics of every tenant of the given
+// registry periodically.  This is designed to be called as a goroutine.
+func ExpireTenants(r Registry, d time.Duration) {
+	for _ = range tick("tenants", priorityCollect, d) {
+		ExpireTenantsOnce(r)
+	}
+}
+
+// ExpireTenantsOnce unregisters the metrics of every tenant of the given
+// registry which haven't been updated within their tenant's Expiry.
+func ExpireTenantsOnce(r Registry) {
+	if t, ok := r.(interface {
+		eachTenant(func(*TenantRegistry))
+	}); ok {
+		t.eachTenant(func(t *TenantRegistry) { t.Expire() })
+	}
+}
+
+// Dropped returns the number of updates dropped by the tenant's rate quota.
+func (t *TenantRegistry) Dropped() int64 {
+	return t.dropped.Load()
+}
+
+// Call the given function for each of the tenant's metrics in order of name.
+func (t *TenantRegistry) Each(f func(string, interface{})) {
+	t.mutex.RLock()
+	entries := make([]namedMetric, 0, len(t.entries))
+	for name, e := range t.entries {
+		entries = append(entries, namedMetric{name, e.metric})
+	}
+	t.mutex.RUnlock()
+	sort.Sort(namedMetricSlice(entries))
+	for _, e := range entries {
+		f(e.name, e.m)
+	}
+}
+
+// Estimate the bytes of heap used by the tenant's metrics.
+func (t *TenantRegistry) EstimateMemory() int64 {
+	n := int64(reflect.TypeOf(t).Elem().Size())
+	t.Each(func(name string, i interface{}) {
+		n += estimateEntryMemory(name, i)
+	})
+	return n
+}
+
+// Expire unregisters the tenant's metrics which haven't been updated within
+// its Expiry and returns the number unregistered.
+func (t *TenantRegistry) Expire() int {
+	expiry := t.Quota().Expiry
+	if 0 == expiry {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.expire(expiry)
+}
+
+// expire must be called with t.mutex held.
+func (t *TenantRegistry) expire(expiry time.Duration) int {
+	cutoff := time.Now().Add(-expiry).UnixNano()
+	n := 0
+	for name, e := range t.entries {
+		if e.updated.Load() < cutoff {
+			EmitEvent(Event{Type: EventExpired, Name: e.name, Metric: e.metric})
+			t.unregister(name, e)
+			n++
+		}
+	}
+	return n
+}
+
+// Get the metric by the given name or nil if none is registered.
+func (t *TenantRegistry) Get(name string) interface{} {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if e, ok := t.entries[name]; ok {
+		return e.metric
+	}
+	return nil
+}
+
+// Gets an existing metric or registers the given one.  The interface can be
+// the metric to register if not found in registry, or a function returning
+// the metric for lazy instantiation.  If the tenant is at its quota of
+// metrics a no-op metric of the same type is returned instead.
+func (t *TenantRegistry) GetOrRegister(name string, i interface{}) interface{} {
+	t.mutex.RLock()
+	e, ok := t.entries[name]
+	t.mutex.RUnlock()
+	if ok {
+		return e.metric
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if e, ok := t.entries[name]; ok {
+		return e.metric
+	}
+	if !t.hasRoom(1) {
+		return nilMetricFor(i)
+	}
+	if v := reflect.ValueOf(i); v.Kind() == reflect.Func {
+		i = v.Call(nil)[0].Interface()
+	}
+	if !isMetric(i) {
+		return i
+	}
+	e = t.newEntry(name, i)
+	if metric := t.parent.GetOrRegister(e.name, e.metric); metric != e.metric {
+		e.metric = metric
+	}
+	t.entries[name] = e
+	return e.metric
+}
+
+// Register the given metric under the given name.  Returns a DuplicateMetric
+// if a metric by the given name is already registered and a QuotaExceeded
+// if the tenant is at its quota of metrics.
+func (t *TenantRegistry) Register(name string, i interface{}) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.entries[name]; ok {
+		return DuplicateMetric(name)
+	}
+	if !isMetric(i) {
+		return nil
+	}
+	if !t.hasRoom(1) {
+		return QuotaExceeded(name)
+	}
+	e := t.newEntry(name, i)
+	if err := t.parent.Register(e.name, e.metric); nil != err {
+		return err
+	}
+	t.entries[name] = e
+	return nil
+}
+
+// Register all the given metrics or none of them.  Returns an InvalidMetric,
+// DuplicateMetric, or QuotaExceeded if any of them cannot be registered.
+func (t *TenantRegistry) RegisterAll(metrics map[string]interface{}) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := t.entries[name]; ok {
+			return DuplicateMetric(name)
+		}
+	}
+	if 0 < len(names) && !t.hasRoom(len(names)) {
+		return QuotaExceeded(names[0])
+	}
+	entries := make(map[string]*tenantEntry, len(metrics))
+	tagged := make(map[string]interface{}, len(metrics))
+	for _, name := range names {
+		if !isMetric(metrics[name]) {
+			return InvalidMetric(name)
+		}
+		e := t.newEntry(name, metrics[name])
+		entries[name] = e
+		tagged[e.name] = e.metric
+	}
+	if err := t.parent.RegisterAll(tagged); nil != err {
+		return err
+	}
+	for name, e := range entries {
+		t.entries[name] = e
+	}
+	return nil
+}
+
+// Quota returns the tenant's quota.
+func (t *TenantRegistry) Quota() TenantQuota {
+	return t.quota.Load().(TenantQuota)
+}
+
+// Run all of the tenant's healthchecks.
+func (t *TenantRegistry) RunHealthchecks() {
+	t.Each(func(name string, i interface{}) {
+		if h, ok := i.(Healthcheck); ok {
+			h.Check()
+		}
+	})
+}
+
+// Snapshot takes a snapshot of every one of the tenant's metrics in a single
+// pass.
+func (t *TenantRegistry) Snapshot() *RegistrySnapshot {
+	return NewRegistrySnapshot(t)
+}
+
+// ExportedPercentiles returns the percentiles exported from the tenant's
+// metrics which haven't been given any of their own, which are its parent's.
+func (t *TenantRegistry) ExportedPercentiles() []float64 {
+	return registryPercentiles(t.parent)
+}
+
+// SampleConfig returns the config of the Sample given to the tenant's
+// histograms and timers registered without one of their own, which is its
+// parent's unless SetSampleConfig has been called.
+func (t *TenantRegistry) SampleConfig() SampleConfig {
+	if c, ok := t.sampleConfig.Load().(SampleConfig); ok {
+		return c
+	}
+	return t.parent.SampleConfig()
+}
+
+// SetQuota sets the tenant's quota.  Metrics already registered beyond a
+// reduced MaxMetrics remain registered.
+func (t *TenantRegistry) SetQuota(q TenantQuota) {
+	t.quota.Store(q)
+}
+
+// SetSampleConfig sets the config of the Sample given to the tenant's
+// histograms and timers registered without one of their own.
+func (t *TenantRegistry) SetSampleConfig(c SampleConfig) {
+	t.sampleConfig.Store(c)
+}
+
+// Tenant returns the tenant of the tenant's parent whose id is this
+// tenant's id and the given id joined by a slash.  Its quota is its own.
+func (t *TenantRegistry) Tenant(id string) *TenantRegistry {
+	return t.parent.Tenant(t.id + "/" + id)
+}
+
+// Unregister the metric with the given name.
+func (t *TenantRegistry) Unregister(name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if e, ok := t.entries[name]; ok {
+		t.unregister(name, e)
+	}
+}
+
+// Unregister all of the tenant's metrics.
+func (t *TenantRegistry) UnregisterAll() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for name, e := range t.entries {
+		t.unregister(name, e)
+	}
+}
+
+// allow reports whether an update is within the tenant's rate quota and
+// notes the time of the update to its metric.
+func (e *tenantEntry) allow() bool {
+	t := e.tenant
+	q := t.Quota()
+	if 0 == q.Expiry && 0 == q.MaxUpdateRate {
+		return true
+	}
+	now := time.Now()
+	if 0 != q.Expiry {
+		e.updated.Store(now.UnixNano())
+	}
+	if 0 == q.MaxUpdateRate {
+		return true
+	}
+	t.bucketMutex.Lock()
+	defer t.bucketMutex.Unlock()
+	if t.bucketTime.IsZero() {
+		t.bucketTokens = q.MaxUpdateRate
+	} else {
+		t.bucketTokens += now.Sub(t.bucketTime).Seconds() * q.MaxUpdateRate
+		if t.bucketTokens > q.MaxUpdateRate {
+			t.bucketTokens = q.MaxUpdateRate
+		}
+	}
+	t.bucketTime = now
+	if t.bucketTokens < 1 {
+		t.dropped.Add(1)
+		return false
+	}
+	t.bucketTokens--
+	return true
+}
+
+// hasRoom reports whether n more metrics fit within the tenant's quota after
+// expiring its idle metrics if need be.  It must be called with t.mutex held.
+func (t *TenantRegistry) hasRoom(n int) bool {
+	q := t.Quota()
+	if 0 == q.MaxMetrics || len(t.entries)+n <= q.MaxMetrics {
+		return true
+	}
+	if 0 != q.Expiry {
+		t.expire(q.Expiry)
+	}
+	return len(t.entries)+n <= q.MaxMetrics
+}
+
+// newEntry wraps a metric for the tenant.
+func (t *TenantRegistry) newEntry(name string, i interface{}) *tenantEntry {
+	base, tags := SplitTaggedName(name)
+	if nil == tags {
+		tags = make(map[string]string, 1)
+	}
+	tags[TenantTag] = t.id
+	e := &tenantEntry{
+		name:   TaggedName(base, tags),
+		tenant: t,
+	}
+	e.updated.Store(time.Now().UnixNano())
+	e.metric = wrapTenantMetric(i, e)
+	return e
+}
+
+// unregister must be called with t.mutex held.
+func (t *TenantRegistry) unregister(name string, e *tenantEntry) {
+	if e.metric == t.parent.Get(e.name) {
+		t.parent.Unregister(e.name)
+	}
+	delete(t.entries, name)
+}
+
+// nilMetricFor returns a no-op metric of the type returned by a function
+// which constructs a metric, or the metric itself if it isn't a function or
+// no no-op metric is of its type.
+func nilMetricFor(i interface{}) interface{} {
+	typ := reflect.TypeOf(i)
+	if nil == typ || reflect.Func != typ.Kind() || 1 != typ.NumOut() {
+		return i
+	}
+	out := typ.Out(0)
+	for _, metric := range []interface{}{
+		NilCounter{},
+		NilCounterFloat64{},
+		NilDurationHistogram{},
+		NilGauge{},
+		NilGaugeFloat64{},
+		NilHealthcheck{},
+		NilHistogram{},
+		NilHistogram2D{},
+		NilMeter{},
+		NilStagedTimer{},
+		NilSummary{},
+		NilTimer{},
+	} {
+		if reflect.TypeOf(metric).AssignableTo(out) {
+			return metric
+		}
+	}
+	return reflect.ValueOf(i).Call(nil)[0].Interface()
+}
+
+// wrapTenantMetric wraps a metric so that its updates are subject to the
+// tenant's rate quota and noted for expiry.  Healthchecks are never updated
+// and so neither wrapped nor expired.
+func wrapTenantMetric(i interface{}, e *tenantEntry) interface{} {
+	switch metric := i.(type) {
+	case Counter:
+		return &tenantCounter{metric, e}
+	case CounterFloat64:
+		return &tenantCounterFloat64{metric, e}
+	case DurationHistogram:
+		return &tenantDurationHistogram{metric, e}
+	case Gauge:
+		return &tenantGauge{metric, e}
+	case GaugeFloat64:
+		return &tenantGaugeFloat64{metric, e}
+	case Histogram:
+		return &tenantHistogram{metric, e}
+	case Histogram2D:
+		return &tenantHistogram2D{metric, e}
+	case Meter:
+		return &tenantMeter{metric, e}
+	case StagedTimer:
+		return &tenantStagedTimer{metric, e}
+	case Summary:
+		return &tenantSummary{metric, e}
+	case Timer:
+		return &tenantTimer{metric, e}
+	case Healthcheck:
+		e.updated.Store(1<<63 - 1)
+	}
+	return i
+}
+
+type tenantCounter struct {
+	Counter
+	entry *tenantEntry
+}
+
+func (c *tenantCounter) Dec(i int64) {
+	if c.entry.allow() {
+		c.Counter.Dec(i)
+	}
+}
+
+func (c *tenantCounter) Inc(i int64) {
+	if c.entry.allow() {
+		c.Counter.Inc(i)
+	}
+}
+
+func (c *tenantCounter) unwrapMetric() interface{} { return c.Counter }
+
+type tenantCounterFloat64 struct {
+	CounterFloat64
+	entry *tenantEntry
+}
+
+func (c *tenantCounterFloat64) Dec(v float64) {
+	if c.entry.allow() {
+		c.CounterFloat64.Dec(v)
+	}
+}
+
+func (c *tenantCounterFloat64) Inc(v float64) {
+	if c.entry.allow() {
+		c.CounterFloat64.Inc(v)
+	}
+}
+
+func (c *tenantCounterFloat64) unwrapMetric() interface{} { return c.CounterFloat64 }
+
+type tenantDurationHistogram struct {
+	DurationHistogram
+	entry *tenantEntry
+}
+
+func (h *tenantDurationHistogram) Update(d time.Duration) {
+	if h.entry.allow() {
+		h.DurationHistogram.Update(d)
+	}
+}
+
+func (h *tenantDurationHistogram) UpdateSince(ts time.Time) {
+	if h.entry.allow() {
+		h.DurationHistogram.UpdateSince(ts)
+	}
+}
+
+func (h *tenantDurationHistogram) unwrapMetric() interface{} { return h.DurationHistogram }
+
+type tenantGauge struct {
+	Gauge
+	entry *tenantEntry
+}
+
+func (g *tenantGauge) Add(d int64) {
+	if g.entry.allow() {
+		g.Gauge.Add(d)
+	}
+}
+
+func (g *tenantGauge) SetMax(v int64) bool {
+	return g.entry.allow() && g.Gauge.SetMax(v)
+}
+
+func (g *tenantGauge) SetMin(v int64) bool {
+	return g.entry.allow() && g.Gauge.SetMin(v)
+}
+
+func (g *tenantGauge) Sub(d int64) {
+	if g.entry.allow() {
+		g.Gauge.Sub(d)
+	}
+}
+
+func (g *tenantGauge) Update(v int64) {
+	if g.entry.allow() {
+		g.Gauge.Update(v)
+	}
+}
+
+func (g *tenantGauge) unwrapMetric() interface{} { return g.Gauge }
+
+type tenantGaugeFloat64 struct {
+	GaugeFloat64
+	entry *tenantEntry
+}
+
+func (g *tenantGaugeFloat64) Update(v float64) {
+	if g.entry.allow() {
+		g.GaugeFloat64.Update(v)
+	}
+}
+
+func (g *tenantGaugeFloat64) unwrapMetric() interface{} { return g.GaugeFloat64 }
+
+type tenantHistogram struct {
+	Histogram
+	entry *tenantEntry
+}
+
+func (h *tenantHistogram) Update(v int64) {
+	if h.entry.allow() {
+		h.Histogram.Update(v)
+	}
+}
+
+func (h *tenantHistogram) UpdateWeighted(v int64, weight float64) {
+	if h.entry.allow() {
+		h.Histogram.UpdateWeighted(v, weight)
+	}
+}
+
+func (h *tenantHistogram) unwrapMetric() interface{} { return h.Histogram }
+
+type tenantHistogram2D struct {
+	Histogram2D
+	entry *tenantEntry
+}
+
+func (h *tenantHistogram2D) Update(x, y int64) {
+	if h.entry.allow() {
+		h.Histogram2D.Update(x, y)
+	}
+}
+
+func (h *tenantHistogram2D) unwrapMetric() interface{} { return h.Histogram2D }
+
+type tenantMeter struct {
+	Meter
+	entry *tenantEntry
+}
+
+func (m *tenantMeter) Mark(n int64) {
+	if m.entry.allow() {
+		m.Meter.Mark(n)
+	}
+}
+
+func (m *tenantMeter) unwrapMetric() interface{} { return m.Meter }
+
+type tenantStagedTimer struct {
+	StagedTimer
+	entry *tenantEntry
+}
+
+func (t *tenantStagedTimer) Stage(stage string) DurationHistogram {
+	return &tenantDurationHistogram{t.StagedTimer.Stage(stage), t.entry}
+}
+
+func (t *tenantStagedTimer) Start() *StagedTiming {
+	now := time.Now()
+	return &StagedTiming{last: now, start: now, timer: t}
+}
+
+func (t *tenantStagedTimer) Total() DurationHistogram {
+	return &tenantDurationHistogram{t.StagedTimer.Total(), t.entry}
+}
+
+func (t *tenantStagedTimer) unwrapMetric() interface{} { return t.StagedTimer }
+
+type tenantSummary struct {
+	Summary
+	entry *tenantEntry
+}
+
+func (s *tenantSummary) Update(v float64) {
+	if s.entry.allow() {
+		s.Summary.Update(v)
+	}
+}
+
+func (s *tenantSummary) unwrapMetric() interface{} { return s.Summary }
+
+type tenantTimer struct {
+	Timer
+	entry *tenantEntry
+}
+
+func (t *tenantTimer) Time(f func()) {
+	if t.entry.allow() {
+		t.Timer.Time(f)
+	} else {
+		f()
+	}
+}
+
+func (t *tenantTimer) Update(d time.Duration) {
+	if t.entry.allow() {
+		t.Timer.Update(d)
+	}
+}
+
+func (t *tenantTimer) UpdateSince(ts time.Time) {
+	if t.entry.allow() {
+		t.Timer.UpdateSince(ts)
+	}
+}
+
+func (t *tenantTimer) unwrapMetric() interface{} { return t.Timer }
@@ -0,0 +1,117 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func BenchmarkTenantCounter(b *testing.B) {
+	c := GetOrRegisterCounter("foo", NewRegistry().Tenant("acme"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Inc(1)
+	}
+}
+
+func TestTenant(t *testing.T) {
+	r := NewRegistry()
+	tenant := r.Tenant("acme")
+	if r.Tenant("acme") != tenant {
+		t.Fatal("r.Tenant(\"acme\") returned a different tenant")
+	}
+	GetOrRegisterCounter("requests;status=200", tenant).Inc(47)
+	if c, ok := r.Get("requests;status=200;tenant=acme").(Counter); !ok || 47 != c.Count() {
+		t.Errorf("r.Get(\"requests;status=200;tenant=acme\"): %v\n", r.Get("requests;status=200;tenant=acme"))
+	}
+	if nil != r.Tenant("other").Get("requests;status=200") {
+		t.Error("tenants aren't isolated")
+	}
+	i := 0
+	tenant.Each(func(name string, _ interface{}) {
+		if "requests;status=200" != name {
+			t.Errorf("name: requests;status=200 != %v\n", name)
+		}
+		i++
+	})
+	if 1 != i {
+		t.Errorf("tenant.Each: 1 != %v\n", i)
+	}
+	tenant.Unregister("requests;status=200")
+	if nil != r.Get("requests;status=200;tenant=acme") {
+		t.Error("tenant.Unregister didn't unregister from the parent")
+	}
+}
+
+func TestTenantExpiry(t *testing.T) {
+	r := NewRegistry()
+	tenant := r.Tenant("acme")
+	tenant.SetQuota(TenantQuota{Expiry: time.Hour})
+	c := GetOrRegisterCounter("foo", tenant)
+	GetOrRegisterCounter("bar", tenant).Inc(1)
+	tenant.entries["foo"].updated.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+	ExpireTenantsOnce(r)
+	if nil != tenant.Get("foo") || nil != r.Get("foo;tenant=acme") {
+		t.Error("foo wasn't expired")
+	}
+	if nil == tenant.Get("bar") {
+		t.Error("bar was expired")
+	}
+	c.Inc(1)
+}
+
+func TestTenantMaxMetrics(t *testing.T) {
+	tenant := NewRegistry().Tenant("acme")
+	tenant.SetQuota(TenantQuota{MaxMetrics: 1})
+	GetOrRegisterCounter("foo", tenant)
+	if c := GetOrRegisterCounter("bar", tenant); (NilCounter{}) != c {
+		t.Errorf("GetOrRegisterCounter(\"bar\", tenant): %T\n", c)
+	}
+	if err := tenant.Register("baz", NewGauge()); QuotaExceeded("baz") != err {
+		t.Errorf("tenant.Register(\"baz\"): %v\n", err)
+	}
+	if err := tenant.RegisterAll(map[string]interface{}{"baz": NewGauge()}); nil == err {
+		t.Error("tenant.RegisterAll: expected an error")
+	}
+}
+
+func TestTenantMaxUpdateRate(t *testing.T) {
+	tenant := NewRegistry().Tenant("acme")
+	tenant.SetQuota(TenantQuota{MaxUpdateRate: 10})
+	c := GetOrRegisterCounter("foo", tenant)
+	for i := 0; i < 100; i++ {
+		c.Inc(1)
+	}
+	if count := c.Count(); count < 10 || 20 < count {
+		t.Errorf("c.Count(): 10 != %v\n", count)
+	}
+	if dropped := tenant.Dropped(); 100 != dropped+c.Count() {
+		t.Errorf("tenant.Dropped(): %v != %v\n", 100-c.Count(), dropped)
+	}
+}
+
+func TestTenantMaxUpdateRateCounterFloat64(t *testing.T) {
+	tenant := NewRegistry().Tenant("acme")
+	tenant.SetQuota(TenantQuota{MaxUpdateRate: 10})
+	c := GetOrRegisterCounterFloat64("foo", tenant)
+	for i := 0; i < 100; i++ {
+		c.Inc(1)
+	}
+	if count := c.Count(); count < 10 || 20 < count {
+		t.Errorf("c.Count(): 10 != %v\n", count)
+	}
+	if dropped := tenant.Dropped(); 100 != float64(dropped)+c.Count() {
+		t.Errorf("tenant.Dropped(): %v != %v\n", 100-c.Count(), dropped)
+	}
+}
+
+func TestTenantMaxMetricsCounterFloat64(t *testing.T) {
+	tenant := NewRegistry().Tenant("acme")
+	tenant.SetQuota(TenantQuota{MaxMetrics: 1})
+	GetOrRegisterCounterFloat64("foo", tenant)
+	if c := GetOrRegisterCounterFloat64("bar", tenant); (NilCounterFloat64{}) != c {
+		t.Errorf("GetOrRegisterCounterFloat64(\"bar\", tenant): %T\n", c)
+	}
+}
@@ -3,41 +3,28 @@ package metrics
 import (
 	"sync"
 	"time"
+
+	"github.com/rcrowley/go-metrics/metricsiface"
 )
 
 // Timers capture the duration and rate of events.
-type Timer interface {
-	Count() int64
-	Max() int64
-	Mean() float64
-	Min() int64
-	Percentile(float64) float64
-	Percentiles([]float64) []float64
-	Rate1() float64
-	Rate5() float64
-	Rate15() float64
-	RateMean() float64
-	Snapshot() Timer
-	StdDev() float64
-	Sum() int64
-	Time(func())
-	Update(time.Duration)
-	UpdateSince(time.Time)
-	Variance() float64
-}
+type Timer = metricsiface.Timer
 
 // GetOrRegisterTimer returns an existing Timer or constructs and registers a
-// new StandardTimer.
+// new StandardTimer using a Sample as described by the registry's
+// SampleConfig.
 func GetOrRegisterTimer(name string, r Registry) Timer {
 	if nil == r {
 		r = DefaultRegistry
 	}
-	return r.GetOrRegister(name, NewTimer).(Timer)
+	return r.GetOrRegister(name, func() Timer {
+		return newTimer(r.SampleConfig())
+	}).(Timer)
 }
 
 // NewCustomTimer constructs a new StandardTimer from a Histogram and a Meter.
 func NewCustomTimer(h Histogram, m Meter) Timer {
-	if UseNilMetrics {
+	if metricsDisabled || UseNilMetrics {
 		return NilTimer{}
 	}
 	return &StandardTimer{
@@ -46,24 +33,30 @@ func NewCustomTimer(h Histogram, m Meter) Timer {
 	}
 }
 
-// NewRegisteredTimer constructs and registers a new StandardTimer.
+// NewRegisteredTimer constructs and registers a new StandardTimer using a
+// Sample as described by the registry's SampleConfig.
 func NewRegisteredTimer(name string, r Registry) Timer {
-	c := NewTimer()
 	if nil == r {
 		r = DefaultRegistry
 	}
+	c := newTimer(r.SampleConfig())
 	r.Register(name, c)
 	return c
 }
 
-// NewTimer constructs a new StandardTimer using an exponentially-decaying
-// sample with the same reservoir size and alpha as UNIX load averages.
+// NewTimer constructs a new StandardTimer using a Sample as described by
+// DefaultSampleConfig, by default an exponentially-decaying sample with the
+// same reservoir size and alpha as UNIX load averages.
 func NewTimer() Timer {
-	if UseNilMetrics {
+	return newTimer(DefaultSampleConfig)
+}
+
+func newTimer(c SampleConfig) Timer {
+	if metricsDisabled || UseNilMetrics {
 		return NilTimer{}
 	}
 	return &StandardTimer{
-		histogram: NewHistogram(NewExpDecaySample(1028, 0.015)),
+		histogram: NewHistogram(c.NewSample()),
 		meter:     NewMeter(),
 	}
 }
@@ -127,12 +120,50 @@ func (NilTimer) UpdateSince(time.Time) {}
 // Variance is a no-op.
 func (NilTimer) Variance() float64 { return 0.0 }
 
+// An IntervalTimer is a Timer which also tracks the exact minimum and
+// maximum durations recorded since its interval was last reset.  Its Min
+// and Max describe only the values its sample retains, which can miss the
+// very slowest request of a busy minute that latency alerts depend on.
+type IntervalTimer interface {
+	Timer
+
+	// ResetInterval returns the minimum and maximum durations, in
+	// nanoseconds, recorded since the interval was last reset, and whether
+	// any were, and begins a new interval.
+	ResetInterval() (min, max int64, ok bool)
+}
+
 // StandardTimer is the standard implementation of a Timer and uses a Histogram
-// and Meter.
+// and Meter.  It's an IntervalTimer.
 type StandardTimer struct {
-	histogram Histogram
-	meter     Meter
-	mutex     sync.Mutex
+	expected    time.Duration // set by SetExpectedInterval
+	histogram   Histogram
+	interval    timerInterval
+	meter       Meter
+	mutex       sync.Mutex
+	percentiles percentilesValue
+}
+
+// maxBackfill bounds the synthetic durations a StandardTimer records for one
+// duration longer than its expected interval.  Beyond it they're recorded in
+// as many groups, each as one duration weighted by the group's size.
+const maxBackfill = 1024
+
+// timerInterval holds the extremes of the durations recorded since a timer's
+// interval was last reset.
+type timerInterval struct {
+	count    int64
+	max, min int64
+}
+
+func (i *timerInterval) update(v int64) {
+	if 0 == i.count || v > i.max {
+		i.max = v
+	}
+	if 0 == i.count || v < i.min {
+		i.min = v
+	}
+	i.count++
 }
 
 // Count returns the number of events recorded.
@@ -140,6 +171,12 @@ func (t *StandardTimer) Count() int64 {
 	return t.histogram.Count()
 }
 
+// ExportedPercentiles returns the percentiles set by SetPercentiles or nil if
+// none have been.
+func (t *StandardTimer) ExportedPercentiles() []float64 {
+	return t.percentiles.load()
+}
+
 // Max returns the maximum value in the sample.
 func (t *StandardTimer) Max() int64 {
 	return t.histogram.Max()
@@ -191,17 +228,49 @@ func (t *StandardTimer) Snapshot() Timer {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 	return &TimerSnapshot{
-		histogram: t.histogram.Snapshot().(*HistogramSnapshot),
-		meter:     t.meter.Snapshot().(*MeterSnapshot),
+		histogram:   t.histogram.Snapshot().(*HistogramSnapshot),
+		meter:       t.meter.Snapshot().(*MeterSnapshot),
+		percentiles: t.percentiles.load(),
 	}
 }
 
+// SetExpectedInterval sets the interval at which the timed operation is
+// expected to begin, as in a load generator or a poller, to correct the
+// coordinated omission which otherwise hides a stall from the percentiles:
+// an operation which takes longer than the interval delays those which
+// should have begun meanwhile, so their durations, d - interval,
+// d - 2×interval, and so on down to the interval, are recorded in the sample
+// too.  They're counted by Count but not by the rates.  Zero unsets it.
+func (t *StandardTimer) SetExpectedInterval(d time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expected = d
+}
+
+// SetPercentiles sets the percentiles reporters export from the timer in
+// place of its registry's or DefaultPercentiles, or, given nil, unsets them.
+func (t *StandardTimer) SetPercentiles(ps []float64) {
+	t.percentiles.store(ps)
+}
+
 // StdDev returns the standard deviation of the values in the sample.
 func (t *StandardTimer) StdDev() float64 {
 	return t.histogram.StdDev()
 }
 
-// Sum returns the sum in the sample.
+// Stop stops ticking the timer's meter, if it has a Stop method, as a
+// StandardMeter does.
+func (t *StandardTimer) Stop() {
+	if m, ok := t.meter.(interface{ Stop() }); ok {
+		m.Stop()
+	}
+}
+
+// String formats the statistics and rates for debugging.
+func (t *StandardTimer) String() string { return timerString(t) }
+
+// Sum returns the sum of every duration recorded, not only of those the
+// sample retains.
 func (t *StandardTimer) Sum() int64 {
 	return t.histogram.Sum()
 }
@@ -213,20 +282,30 @@ func (t *StandardTimer) Time(f func()) {
 	t.Update(time.Since(ts))
 }
 
+// ResetInterval returns the minimum and maximum durations recorded since the
+// interval was last reset, and whether any were, and begins a new interval.
+// Reporters configured to send interval extremes reset them on every flush,
+// so only one reporter should be.
+func (t *StandardTimer) ResetInterval() (min, max int64, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	i := t.interval
+	t.interval = timerInterval{}
+	return i.min, i.max, 0 < i.count
+}
+
 // Record the duration of an event.
 func (t *StandardTimer) Update(d time.Duration) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	t.histogram.Update(int64(d))
-	t.meter.Mark(1)
+	t.update(int64(d))
 }
 
 // Record the duration of an event that started at a time and ends now.
 func (t *StandardTimer) UpdateSince(ts time.Time) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	t.histogram.Update(int64(time.Since(ts)))
-	t.meter.Mark(1)
+	t.update(int64(time.Since(ts)))
 }
 
 // Variance returns the variance of the values in the sample.
@@ -234,16 +313,63 @@ func (t *StandardTimer) Variance() float64 {
 	return t.histogram.Variance()
 }
 
+// Windows returns the windows of the moving averages of the timer's meter.
+func (t *StandardTimer) Windows() []time.Duration {
+	return MeterWindows(t.meter)
+}
+
+// backfill records the durations of the operations a duration of d delayed
+// when an interval is expected.  It must be called with t.mutex held.
+func (t *StandardTimer) backfill(d int64) {
+	e := int64(t.expected)
+	if e <= 0 || d < 2*e {
+		return
+	}
+	n := d/e - 1
+	if n <= maxBackfill {
+		for k := int64(1); k <= n; k++ {
+			t.histogram.Update(d - k*e)
+		}
+		return
+	}
+	share, remainder := n/maxBackfill, n%maxBackfill
+	k := int64(1)
+	for i := int64(0); i < maxBackfill; i++ {
+		size := share
+		if i < remainder {
+			size++
+		}
+		t.histogram.UpdateWeighted(d-(k+size/2)*e, float64(size))
+		k += size
+	}
+}
+
+// update records a duration.  It must be called with t.mutex held.
+func (t *StandardTimer) update(d int64) {
+	t.histogram.Update(d)
+	t.interval.update(d)
+	t.meter.Mark(1)
+	t.backfill(d)
+}
+
 // TimerSnapshot is a read-only copy of another Timer.
 type TimerSnapshot struct {
-	histogram *HistogramSnapshot
-	meter     *MeterSnapshot
+	histogram   *HistogramSnapshot
+	meter       *MeterSnapshot
+	percentiles []float64
 }
 
 // Count returns the number of events recorded at the time the snapshot was
 // taken.
 func (t *TimerSnapshot) Count() int64 { return t.histogram.Count() }
 
+// ExportedPercentiles returns the percentiles set for the timer at the time
+// the snapshot was taken or nil if none had been.
+func (t *TimerSnapshot) ExportedPercentiles() []float64 { return t.percentiles }
+
+// GoString formats the statistics of the snapshot for %#v.
+func (t *TimerSnapshot) GoString() string { return goString("TimerSnapshot", timerString(t)) }
+
 // Max returns the maximum value at the time the snapshot was taken.
 func (t *TimerSnapshot) Max() int64 { return t.histogram.Max() }
 
@@ -288,7 +414,11 @@ func (t *TimerSnapshot) Snapshot() Timer { return t }
 // was taken.
 func (t *TimerSnapshot) StdDev() float64 { return t.histogram.StdDev() }
 
-// Sum returns the sum at the time the snapshot was taken.
+// String formats the statistics and rates for debugging.
+func (t *TimerSnapshot) String() string { return timerString(t) }
+
+// Sum returns the sum of every duration recorded at the time the snapshot
+// was taken.
 func (t *TimerSnapshot) Sum() int64 { return t.histogram.Sum() }
 
 // Time panics.
@@ -309,3 +439,19 @@ func (*TimerSnapshot) UpdateSince(time.Time) {
 // Variance returns the variance of the values at the time the snapshot was
 // taken.
 func (t *TimerSnapshot) Variance() float64 { return t.histogram.Variance() }
+
+// Windows returns the windows of the moving averages of the timer's meter.
+func (t *TimerSnapshot) Windows() []time.Duration { return MeterWindows(t.meter) }
+
+// resetInterval resets the interval of the given metric, as by
+// IntervalTimer's ResetInterval, if enabled and the metric, or the metric a
+// tenant's wraps, is an IntervalTimer.
+func resetInterval(enabled bool, i interface{}) (min, max int64, ok bool) {
+	if !enabled {
+		return 0, 0, false
+	}
+	if t, isInterval := unwrap(i).(IntervalTimer); isInterval {
+		return t.ResetInterval()
+	}
+	return 0, 0, false
+}
@@ -1,3 +1,6 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
 package metrics
 
 import (
@@ -79,3 +82,52 @@ func TestTimerZero(t *testing.T) {
 		t.Errorf("tm.RateMean(): 0.0 != %v\n", rateMean)
 	}
 }
+
+func TestTimerResetInterval(t *testing.T) {
+	tm := NewTimer().(IntervalTimer)
+	if _, _, ok := tm.ResetInterval(); ok {
+		t.Error("tm.ResetInterval(): expected no durations in the first interval")
+	}
+	tm.Update(3 * time.Millisecond)
+	tm.Update(time.Millisecond)
+	tm.Update(2 * time.Millisecond)
+	min, max, ok := tm.ResetInterval()
+	if !ok || int64(time.Millisecond) != min || int64(3*time.Millisecond) != max {
+		t.Errorf("tm.ResetInterval(): %v, %v, %v\n", min, max, ok)
+	}
+	tm.Update(5 * time.Millisecond)
+	if min, max, _ := tm.ResetInterval(); int64(5*time.Millisecond) != min || int64(5*time.Millisecond) != max {
+		t.Errorf("tm.ResetInterval(): %v, %v after a reset\n", min, max)
+	}
+}
+
+func TestTimerExpectedInterval(t *testing.T) {
+	tm := NewTimer().(*StandardTimer)
+	tm.SetExpectedInterval(10 * time.Millisecond)
+	tm.Update(5 * time.Millisecond)
+	tm.Update(35 * time.Millisecond)
+	if count := tm.Count(); 4 != count {
+		t.Errorf("tm.Count(): 4 != %v\n", count)
+	}
+	if min := tm.Min(); int64(5*time.Millisecond) != min {
+		t.Errorf("tm.Min(): %v != %v\n", 5*time.Millisecond, min)
+	}
+	if p := tm.Percentile(0.5); float64(20*time.Millisecond) != p {
+		t.Errorf("tm.Percentile(0.5): %v != %v\n", 20*time.Millisecond, p)
+	}
+	if count := tm.Snapshot().(*TimerSnapshot).meter.Count(); 2 != count {
+		t.Errorf("tm.meter.Count(): 2 != %v\n", count)
+	}
+}
+
+func TestTimerExpectedIntervalBounded(t *testing.T) {
+	tm := NewCustomTimer(NewHistogram(NewUniformSample(10000)), NewMeter()).(*StandardTimer)
+	tm.SetExpectedInterval(time.Microsecond)
+	tm.Update(time.Second)
+	if count := tm.Count(); 1000000 != count {
+		t.Errorf("tm.Count(): 1000000 != %v\n", count)
+	}
+	if size := tm.histogram.Sample().Size(); maxBackfill+1 != size {
+		t.Errorf("tm.histogram.Sample().Size(): %v != %v\n", maxBackfill+1, size)
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+// USEMetrics bundles the utilization, saturation, and errors of one
+// resource, such as a connection pool, disk, or worker queue, the "USE"
+// metrics on which resource-oriented dashboards are built.  A bundle named
+// "db.pool" registers the GaugeFloat64 "db.pool.utilization", the Gauge
+// "db.pool.saturation" and Histogram "db.pool.saturation-histogram", and the
+// meter "db.pool.errors".  A name made by TaggedName keeps its tags on each
+// metric.
+//
+// Utilization is the fraction of the time or capacity the resource is busy,
+// from 0 to 1.  Saturation is the amount of work the resource can't yet
+// service, such as the length of its queue; the histogram records its
+// distribution between flushes, which the gauge alone would hide.
+type USEMetrics struct {
+	errors              Meter
+	saturation          Gauge
+	saturationHistogram Histogram
+	utilization         GaugeFloat64
+}
+
+// GetOrRegisterUSEMetrics returns the USE metrics of the given resource in
+// the given registry, constructing and registering any which don't yet
+// exist.
+func GetOrRegisterUSEMetrics(name string, r Registry) *USEMetrics {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	return &USEMetrics{
+		errors:              GetOrRegisterMeter(bundleName(name, "errors"), r),
+		saturation:          GetOrRegisterGauge(bundleName(name, "saturation"), r),
+		saturationHistogram: GetOrRegisterHistogram(bundleName(name, "saturation-histogram"), r, nil),
+		utilization:         GetOrRegisterGaugeFloat64(bundleName(name, "utilization"), r),
+	}
+}
+
+// NewUSEMetrics constructs a new, unregistered bundle of USE metrics.
+func NewUSEMetrics() *USEMetrics {
+	return &USEMetrics{
+		errors:              NewMeter(),
+		saturation:          NewGauge(),
+		saturationHistogram: NewHistogram(DefaultSampleConfig.NewSample()),
+		utilization:         NewGaugeFloat64(),
+	}
+}
+
+// NewRegisteredUSEMetrics constructs and registers a new bundle of USE
+// metrics for the given resource.
+func NewRegisteredUSEMetrics(name string, r Registry) *USEMetrics {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	use := &USEMetrics{
+		errors:              NewMeter(),
+		saturation:          NewGauge(),
+		saturationHistogram: NewHistogram(r.SampleConfig().NewSample()),
+		utilization:         NewGaugeFloat64(),
+	}
+	r.Register(bundleName(name, "errors"), use.errors)
+	r.Register(bundleName(name, "saturation"), use.saturation)
+	r.Register(bundleName(name, "saturation-histogram"), use.saturationHistogram)
+	r.Register(bundleName(name, "utilization"), use.utilization)
+	return use
+}
+
+// Errors returns the meter of the resource's errors.
+func (use *USEMetrics) Errors() Meter {
+	return use.errors
+}
+
+// MarkErrors records n errors of the resource.
+func (use *USEMetrics) MarkErrors(n int64) {
+	use.errors.Mark(n)
+}
+
+// Saturation returns the gauge of the resource's current saturation.
+func (use *USEMetrics) Saturation() Gauge {
+	return use.saturation
+}
+
+// SaturationHistogram returns the histogram of the resource's saturation.
+func (use *USEMetrics) SaturationHistogram() Histogram {
+	return use.saturationHistogram
+}
+
+// SetSaturation records the resource's current saturation, updating both
+// the gauge and the histogram.
+func (use *USEMetrics) SetSaturation(v int64) {
+	use.saturation.Update(v)
+	use.saturationHistogram.Update(v)
+}
+
+// SetUtilization records the resource's current utilization.
+func (use *USEMetrics) SetUtilization(v float64) {
+	use.utilization.Update(v)
+}
+
+// Utilization returns the gauge of the resource's current utilization.
+func (use *USEMetrics) Utilization() GaugeFloat64 {
+	return use.utilization
+}
@@ -0,0 +1,38 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestUSEMetrics(t *testing.T) {
+	r := NewRegistry()
+	use := GetOrRegisterUSEMetrics("db.pool", r)
+	use.SetUtilization(0.75)
+	use.SetSaturation(4)
+	use.SetSaturation(2)
+	use.MarkErrors(3)
+	if value := r.Get("db.pool.utilization").(GaugeFloat64).Value(); 0.75 != value {
+		t.Errorf("db.pool.utilization.Value(): 0.75 != %v\n", value)
+	}
+	if value := r.Get("db.pool.saturation").(Gauge).Value(); 2 != value {
+		t.Errorf("db.pool.saturation.Value(): 2 != %v\n", value)
+	}
+	if max := r.Get("db.pool.saturation-histogram").(Histogram).Max(); 4 != max {
+		t.Errorf("db.pool.saturation-histogram.Max(): 4 != %v\n", max)
+	}
+	if count := r.Get("db.pool.errors").(Meter).Count(); 3 != count {
+		t.Errorf("db.pool.errors.Count(): 3 != %v\n", count)
+	}
+	if GetOrRegisterUSEMetrics("db.pool", r).Saturation() != use.Saturation() {
+		t.Error("GetOrRegisterUSEMetrics(): expected the registered gauge")
+	}
+}
+
+func TestNewRegisteredUSEMetricsTagged(t *testing.T) {
+	r := NewRegistry()
+	NewRegisteredUSEMetrics(TaggedName("disk", map[string]string{"device": "sda"}), r).SetUtilization(1)
+	if nil == r.Get("disk.utilization;device=sda") {
+		t.Error("disk.utilization;device=sda wasn't registered")
+	}
+}
@@ -0,0 +1,338 @@
+package metrics
+
+import "sort"
+
+// A View collapses a family of tagged metrics, named as by TaggedName,
+// across some of their tags, in the manner of a Prometheus recording rule.
+// Members of the family whose remaining tags are equal are aggregated into
+// one metric named for the family and those tags: counters, gauges, and
+// meters are summed; histograms, timers, and staged timers pool their
+// samples; and two-dimensional histograms sum their cells if their bounds
+// agree.  Summaries, whose quantiles can't be aggregated, healthchecks, and
+// groups of mixed types are left as they are, under their own names.
+type View struct {
+	Name    string   // Family to aggregate
+	By      []string // Tags to keep; if empty, every tag but those in Without
+	Without []string // Tags to aggregate away
+}
+
+// ViewRegistry is a Registry whose Each aggregates the metrics of an
+// underlying registry according to a set of views at the time it's called,
+// so that cheap pre-aggregates can be exported to expensive backends while
+// the underlying registry keeps every detail for local use.  Metrics of
+// families without a view are passed through as they are.  Registration and
+// every other method is delegated to the underlying registry.
+type ViewRegistry struct {
+	Registry
+	views map[string]View
+}
+
+// NewViewRegistry constructs a ViewRegistry which aggregates the metrics of
+// the given registry according to the given views.
+func NewViewRegistry(r Registry, views ...View) *ViewRegistry {
+	if nil == r {
+		r = DefaultRegistry
+	}
+	vr := &ViewRegistry{Registry: r, views: make(map[string]View, len(views))}
+	for _, v := range views {
+		vr.views[v.Name] = v
+	}
+	return vr
+}
+
+// Each calls the given function with each aggregate and each metric of a
+// family without a view, in order of name.  Aggregates are read-only
+// snapshots.
+func (vr *ViewRegistry) Each(f func(string, interface{})) {
+	var out namedMetricSlice
+	emit := func(name string, i interface{}) { out = append(out, namedMetric{name, i}) }
+	groups := make(map[string]map[string]interface{})
+	vr.Registry.Each(func(name string, i interface{}) {
+		family, tags := SplitTaggedName(name)
+		v, ok := vr.views[family]
+		if !ok {
+			emit(name, i)
+			return
+		}
+		aggregate := TaggedName(family, v.keep(tags))
+		if nil == groups[aggregate] {
+			groups[aggregate] = make(map[string]interface{})
+		}
+		groups[aggregate][name] = i
+	})
+	aggregates := make([]string, 0, len(groups))
+	for aggregate := range groups {
+		aggregates = append(aggregates, aggregate)
+	}
+	sort.Strings(aggregates)
+	for _, aggregate := range aggregates {
+		names := make([]string, 0, len(groups[aggregate]))
+		for name := range groups[aggregate] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		group := make([]interface{}, len(names))
+		for i, name := range names {
+			group[i] = groups[aggregate][name]
+		}
+		if metric, ok := aggregateMetrics(group); ok {
+			emit(aggregate, metric)
+			continue
+		}
+		for i, name := range names {
+			emit(name, group[i])
+		}
+	}
+	sort.Stable(out)
+	for _, e := range out {
+		f(e.name, e.m)
+	}
+}
+
+// EstimateMemory returns the underlying registry's estimate, since
+// aggregates are constructed only while Each is running.
+func (vr *ViewRegistry) EstimateMemory() int64 {
+	return vr.Registry.EstimateMemory()
+}
+
+// Get returns the aggregate or metric of a family without a view by the
+// given name or nil if there is none.
+func (vr *ViewRegistry) Get(name string) interface{} {
+	if _, ok := vr.views[familyName(name)]; !ok {
+		return vr.Registry.Get(name)
+	}
+	var metric interface{}
+	vr.Each(func(n string, i interface{}) {
+		if n == name && nil == metric {
+			metric = i
+		}
+	})
+	return metric
+}
+
+// RunHealthchecks runs the underlying registry's healthchecks.
+func (vr *ViewRegistry) RunHealthchecks() {
+	vr.Registry.RunHealthchecks()
+}
+
+// Snapshot takes a snapshot of every aggregate and every metric of a family
+// without a view in a single pass.
+func (vr *ViewRegistry) Snapshot() *RegistrySnapshot {
+	return NewRegistrySnapshot(vr)
+}
+
+func familyName(name string) string {
+	family, _ := SplitTaggedName(name)
+	return family
+}
+
+// keep returns the tags which remain once the view has aggregated away the
+// rest.
+func (v View) keep(tags map[string]string) map[string]string {
+	kept := make(map[string]string, len(tags))
+	if 0 < len(v.By) {
+		for _, k := range v.By {
+			if value, ok := tags[k]; ok {
+				kept[k] = value
+			}
+		}
+		return kept
+	}
+	for k, value := range tags {
+		kept[k] = value
+	}
+	for _, k := range v.Without {
+		delete(kept, k)
+	}
+	return kept
+}
+
+// aggregateMetrics returns the aggregate of a group of metrics and whether
+// they could be aggregated.  A group of one is aggregated to its snapshot.
+func aggregateMetrics(group []interface{}) (interface{}, bool) {
+	switch group[0].(type) {
+	case Counter:
+		var count int64
+		for _, i := range group {
+			c, ok := i.(Counter)
+			if !ok {
+				return nil, false
+			}
+			count += c.Count()
+		}
+		return CounterSnapshot(count), true
+	case CounterFloat64:
+		var count float64
+		for _, i := range group {
+			c, ok := i.(CounterFloat64)
+			if !ok {
+				return nil, false
+			}
+			count += c.Count()
+		}
+		return CounterFloat64Snapshot(count), true
+	case Gauge:
+		var value int64
+		for _, i := range group {
+			g, ok := i.(Gauge)
+			if !ok {
+				return nil, false
+			}
+			value += g.Value()
+		}
+		return GaugeSnapshot(value), true
+	case GaugeFloat64:
+		var value float64
+		for _, i := range group {
+			g, ok := i.(GaugeFloat64)
+			if !ok {
+				return nil, false
+			}
+			value += g.Value()
+		}
+		return GaugeFloat64Snapshot(value), true
+	case DurationHistogram:
+		sample := &SampleSnapshot{}
+		for _, i := range group {
+			h, ok := i.(DurationHistogram)
+			if !ok {
+				return nil, false
+			}
+			poolSample(sample, h.Snapshot().Sample())
+		}
+		return &DurationHistogramSnapshot{sample: sample}, true
+	case Histogram:
+		sample := &SampleSnapshot{}
+		for _, i := range group {
+			h, ok := i.(Histogram)
+			if !ok {
+				return nil, false
+			}
+			poolSample(sample, h.Snapshot().Sample())
+		}
+		return &HistogramSnapshot{sample: sample}, true
+	case Histogram2D:
+		return aggregateHistogram2Ds(group)
+	case Meter:
+		meter := &MeterSnapshot{}
+		for _, i := range group {
+			m, ok := i.(Meter)
+			if !ok {
+				return nil, false
+			}
+			sumMeter(meter, m.Snapshot())
+		}
+		return meter, true
+	case StagedTimer:
+		return aggregateStagedTimers(group)
+	case Timer:
+		sample, meter := &SampleSnapshot{}, &MeterSnapshot{}
+		for _, i := range group {
+			t, ok := i.(Timer)
+			if !ok {
+				return nil, false
+			}
+			snapshot, ok := t.Snapshot().(*TimerSnapshot)
+			if !ok {
+				return nil, false
+			}
+			poolSample(sample, snapshot.histogram.Sample())
+			sumMeter(meter, snapshot.meter)
+		}
+		return &TimerSnapshot{histogram: &HistogramSnapshot{sample: sample}, meter: meter}, true
+	}
+	return nil, false
+}
+
+func aggregateHistogram2Ds(group []interface{}) (interface{}, bool) {
+	var aggregate *Histogram2DSnapshot
+	for _, i := range group {
+		h, ok := i.(Histogram2D)
+		if !ok {
+			return nil, false
+		}
+		snapshot := h.Snapshot()
+		if nil == aggregate {
+			aggregate = &Histogram2DSnapshot{
+				xBounds: snapshot.XBounds(),
+				yBounds: snapshot.YBounds(),
+				counts:  make([][]int64, len(snapshot.Counts())),
+			}
+			for x, row := range snapshot.Counts() {
+				aggregate.counts[x] = make([]int64, len(row))
+			}
+		} else if !equalInt64s(aggregate.xBounds, snapshot.XBounds()) || !equalInt64s(aggregate.yBounds, snapshot.YBounds()) {
+			return nil, false
+		}
+		for x, row := range snapshot.Counts() {
+			for y, count := range row {
+				aggregate.counts[x][y] += count
+			}
+		}
+		aggregate.count += snapshot.Count()
+	}
+	return aggregate, true
+}
+
+func aggregateStagedTimers(group []interface{}) (interface{}, bool) {
+	stages := make(map[string]*SampleSnapshot)
+	total := &SampleSnapshot{}
+	for _, i := range group {
+		t, ok := i.(StagedTimer)
+		if !ok {
+			return nil, false
+		}
+		snapshot := t.Snapshot()
+		for _, stage := range snapshot.Stages() {
+			if _, ok := stages[stage]; !ok {
+				stages[stage] = &SampleSnapshot{}
+			}
+			poolSample(stages[stage], snapshot.Stage(stage).Sample())
+		}
+		poolSample(total, snapshot.Total().Sample())
+	}
+	aggregate := &StagedTimerSnapshot{
+		stages: make(map[string]DurationHistogram, len(stages)),
+		total:  &DurationHistogramSnapshot{sample: total},
+	}
+	for stage, sample := range stages {
+		aggregate.stages[stage] = &DurationHistogramSnapshot{sample: sample}
+	}
+	return aggregate, true
+}
+
+// poolSample adds the count, sum, and values of a sample to a pooled
+// snapshot.
+// Every value counts equally, so a member whose reservoir is small relative
+// to its count is underrepresented in the pool's percentiles.
+func poolSample(pool *SampleSnapshot, s Sample) {
+	pool.count += s.Count()
+	pool.sum += sampleTotalSum(s)
+	pool.values = append(pool.values, s.Values()...)
+}
+
+// sumMeter adds the count and rates of a meter to a summed snapshot.
+func sumMeter(sum *MeterSnapshot, m Meter) {
+	sum.count += m.Count()
+	if f, ok := m.(MeterFloat64); ok {
+		sum.countFloat += f.CountFloat()
+	} else {
+		sum.countFloat += float64(m.Count())
+	}
+	sum.rate1 += m.Rate1()
+	sum.rate5 += m.Rate5()
+	sum.rate15 += m.Rate15()
+	sum.rateMean += m.RateMean()
+}
+
+func equalInt64s(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
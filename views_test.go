@@ -0,0 +1,61 @@
+//go:build !metrics_disabled
+// +build !metrics_disabled
+
+package metrics
+
+import "testing"
+
+func TestViewRegistry(t *testing.T) {
+	r := NewRegistry()
+	for _, endpoint := range []string{"/", "/login", "/search"} {
+		for status, n := range map[string]int64{"200": 10, "500": 1} {
+			tags := map[string]string{"endpoint": endpoint, "status": status}
+			GetOrRegisterCounter(TaggedName("requests", tags), r).Inc(n)
+			h := GetOrRegisterHistogram(TaggedName("latency", tags), r, NewUniformSample(100))
+			h.Update(n)
+		}
+	}
+	GetOrRegisterGauge("goroutines", r).Update(47)
+	vr := NewViewRegistry(r,
+		View{Name: "requests", Without: []string{"endpoint"}},
+		View{Name: "latency", By: []string{"status"}},
+	)
+	seen := make(map[string]interface{})
+	vr.Each(func(name string, i interface{}) {
+		if _, ok := seen[name]; ok {
+			t.Errorf("%v seen twice\n", name)
+		}
+		seen[name] = i
+	})
+	if 5 != len(seen) {
+		t.Errorf("len(seen): 5 != %v: %v\n", len(seen), seen)
+	}
+	if c, ok := seen["requests;status=200"].(Counter); !ok || 30 != c.Count() {
+		t.Errorf("requests;status=200: %v\n", seen["requests;status=200"])
+	}
+	if h, ok := seen["latency;status=500"].(Histogram); !ok || 3 != h.Count() || 3 != h.Sum() {
+		t.Errorf("latency;status=500: %v\n", seen["latency;status=500"])
+	}
+	if g, ok := seen["goroutines"].(Gauge); !ok || 47 != g.Value() {
+		t.Errorf("goroutines: %v\n", seen["goroutines"])
+	}
+	if c, ok := vr.Get("requests;status=500").(Counter); !ok || 3 != c.Count() {
+		t.Errorf("vr.Get(\"requests;status=500\"): %v\n", vr.Get("requests;status=500"))
+	}
+}
+
+func TestViewRegistryMixedTypes(t *testing.T) {
+	r := NewRegistry()
+	r.Register("foo;a=1", NewCounter())
+	r.Register("foo;a=2", NewGauge())
+	n := 0
+	NewViewRegistry(r, View{Name: "foo", Without: []string{"a"}}).Each(func(name string, i interface{}) {
+		if "foo;a=1" != name && "foo;a=2" != name {
+			t.Errorf("name: %v\n", name)
+		}
+		n++
+	})
+	if 2 != n {
+		t.Errorf("n: 2 != %v\n", n)
+	}
+}
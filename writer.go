@@ -4,55 +4,117 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"time"
 )
 
+// WriterConfig provides a container with configuration parameters for the
+// Write reporter.
+type WriterConfig struct {
+	Registry      Registry      // Registry to be exported
+	FlushInterval time.Duration // Flush interval
+	Writer        io.Writer     // Writer to which metrics are written
+	ValuePolicy   *ValuePolicy  // NaN, ±Inf and negative value handling; nil means DefaultValuePolicy
+}
+
 // Write sorts writes each metric in the given registry periodically to the
 // given io.Writer.
 func Write(r Registry, d time.Duration, w io.Writer) {
-	for _ = range time.Tick(d) {
-		WriteOnce(r, w)
+	WriteWithConfig(WriterConfig{Registry: r, FlushInterval: d, Writer: w})
+}
+
+// WriteWithConfig is a blocking reporter function just like Write, but it
+// takes a WriterConfig instead.
+func WriteWithConfig(c WriterConfig) {
+	for _ = range tick("write", priorityReport, c.FlushInterval) {
+		WriteOnceWithConfig(c)
 	}
 }
 
 // WriteOnce sorts and writes metrics in the given registry to the given
 // io.Writer.
 func WriteOnce(r Registry, w io.Writer) {
+	WriteOnceWithConfig(WriterConfig{Registry: r, Writer: w})
+}
+
+// WriteOnceWithConfig sorts and writes metrics in the configured registry to
+// the configured io.Writer, leaving out the values its ValuePolicy rejects.
+func WriteOnceWithConfig(c WriterConfig) {
+	r, w, policy := c.Registry, c.Writer, valuePolicy(c.ValuePolicy)
 	var namedMetrics namedMetricSlice
 	r.Each(func(name string, i interface{}) {
 		namedMetrics = append(namedMetrics, namedMetric{name, i})
 	})
 
+	putInt := func(format, key string, v int64) {
+		if v, ok := policy.Int(v); ok {
+			fmt.Fprintf(w, format, key, v)
+		}
+	}
+	putFloat := func(format, key string, v float64) {
+		if v, ok := policy.Float(v); ok {
+			fmt.Fprintf(w, format, key, v)
+		}
+	}
+	putDuration := func(format, key string, d time.Duration) {
+		if v, ok := policy.Int(int64(d)); ok {
+			fmt.Fprintf(w, format, key, time.Duration(v))
+		}
+	}
 	sort.Sort(namedMetrics)
 	for _, namedMetric := range namedMetrics {
 		switch metric := namedMetric.m.(type) {
 		case Counter:
 			fmt.Fprintf(w, "counter %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  count:       %9d\n", metric.Count())
+		case CounterFloat64:
+			fmt.Fprintf(w, "counter %s\n", namedMetric.name)
+			putFloat("  %-13s%f\n", "count:", metric.Count())
 		case Gauge:
 			fmt.Fprintf(w, "gauge %s\n", namedMetric.name)
-			fmt.Fprintf(w, "  value:       %9d\n", metric.Value())
+			putInt("  %-13s%9d\n", "value:", metric.Value())
 		case GaugeFloat64:
 			fmt.Fprintf(w, "gauge %s\n", namedMetric.name)
-			fmt.Fprintf(w, "  value:       %f\n", metric.Value())
+			putFloat("  %-13s%f\n", "value:", metric.Value())
 		case Healthcheck:
 			metric.Check()
 			fmt.Fprintf(w, "healthcheck %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  error:       %v\n", metric.Error())
 		case Histogram:
 			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			percentiles := ExportedPercentiles(r, namedMetric.m)
+			ps := h.Percentiles(percentiles)
 			fmt.Fprintf(w, "histogram %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  count:       %9d\n", h.Count())
-			fmt.Fprintf(w, "  min:         %9d\n", h.Min())
-			fmt.Fprintf(w, "  max:         %9d\n", h.Max())
-			fmt.Fprintf(w, "  mean:        %12.2f\n", h.Mean())
-			fmt.Fprintf(w, "  stddev:      %12.2f\n", h.StdDev())
-			fmt.Fprintf(w, "  median:      %12.2f\n", ps[0])
-			fmt.Fprintf(w, "  75%%:         %12.2f\n", ps[1])
-			fmt.Fprintf(w, "  95%%:         %12.2f\n", ps[2])
-			fmt.Fprintf(w, "  99%%:         %12.2f\n", ps[3])
-			fmt.Fprintf(w, "  99.9%%:       %12.2f\n", ps[4])
+			putInt("  %-13s%9d\n", "sum:", h.Sum())
+			putInt("  %-13s%9d\n", "min:", h.Min())
+			putInt("  %-13s%9d\n", "max:", h.Max())
+			putFloat("  %-13s%12.2f\n", "mean:", h.Mean())
+			putFloat("  %-13s%12.2f\n", "stddev:", h.StdDev())
+			for j, p := range percentiles {
+				putFloat("  %-13s%12.2f\n", percentileLabel(p)+":", ps[j])
+			}
+		case DurationHistogram:
+			h := metric.Snapshot()
+			percentiles := ExportedPercentiles(r, namedMetric.m)
+			ps := h.Percentiles(percentiles)
+			fmt.Fprintf(w, "duration histogram %s\n", namedMetric.name)
+			fmt.Fprintf(w, "  count:       %9d\n", h.Count())
+			putDuration("  %-13s%12v\n", "sum:", h.Sum())
+			putDuration("  %-13s%12v\n", "min:", h.Min())
+			putDuration("  %-13s%12v\n", "max:", h.Max())
+			putDuration("  %-13s%12v\n", "mean:", h.Mean())
+			putDuration("  %-13s%12v\n", "stddev:", h.StdDev())
+			for j, p := range percentiles {
+				putDuration("  %-13s%12v\n", percentileLabel(p)+":", ps[j])
+			}
+		case Histogram2D:
+			h := metric.Snapshot()
+			fmt.Fprintf(w, "histogram2d %s\n", namedMetric.name)
+			fmt.Fprintf(w, "  count:       %9d\n", h.Count())
+			eachHistogram2DCell(h, func(x, y string, count int64) {
+				fmt.Fprintf(w, "  %-24s %9d\n", "x<="+x+" y<="+y+":", count)
+			})
 		case Meter:
 			m := metric.Snapshot()
 			fmt.Fprintf(w, "meter %s\n", namedMetric.name)
@@ -61,20 +123,45 @@ func WriteOnce(r Registry, w io.Writer) {
 			fmt.Fprintf(w, "  5-min rate:  %12.2f\n", m.Rate5())
 			fmt.Fprintf(w, "  15-min rate: %12.2f\n", m.Rate15())
 			fmt.Fprintf(w, "  mean rate:   %12.2f\n", m.RateMean())
+		case Summary:
+			s := metric.Snapshot()
+			fmt.Fprintf(w, "summary %s\n", namedMetric.name)
+			fmt.Fprintf(w, "  count:       %9d\n", s.Count())
+			putFloat("  %-13s%12.2f\n", "sum:", s.Sum())
+			qs := s.Quantiles()
+			for i, q := range s.Objectives() {
+				putFloat("  %-12s %12.2f\n", strconv.FormatFloat(q*100.0, 'f', -1, 64)+"%:", qs[i])
+			}
+		case StagedTimer:
+			fmt.Fprintf(w, "staged timer %s\n", namedMetric.name)
+			eachStage(metric.Snapshot(), func(stage string, h DurationHistogram) {
+				percentiles := ExportedPercentiles(r, h)
+				ps := h.Percentiles(percentiles)
+				fmt.Fprintf(w, "  stage %s\n", stage)
+				fmt.Fprintf(w, "    count:     %9d\n", h.Count())
+				putDuration("    %-11s%12v\n", "sum:", h.Sum())
+				putDuration("    %-11s%12v\n", "min:", h.Min())
+				putDuration("    %-11s%12v\n", "max:", h.Max())
+				putDuration("    %-11s%12v\n", "mean:", h.Mean())
+				putDuration("    %-11s%12v\n", "stddev:", h.StdDev())
+				for j, p := range percentiles {
+					putDuration("    %-11s%12v\n", percentileLabel(p)+":", ps[j])
+				}
+			})
 		case Timer:
 			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.99, 0.999})
+			percentiles := ExportedPercentiles(r, namedMetric.m)
+			ps := t.Percentiles(percentiles)
 			fmt.Fprintf(w, "timer %s\n", namedMetric.name)
 			fmt.Fprintf(w, "  count:       %9d\n", t.Count())
-			fmt.Fprintf(w, "  min:         %9d\n", t.Min())
-			fmt.Fprintf(w, "  max:         %9d\n", t.Max())
-			fmt.Fprintf(w, "  mean:        %12.2f\n", t.Mean())
-			fmt.Fprintf(w, "  stddev:      %12.2f\n", t.StdDev())
-			fmt.Fprintf(w, "  median:      %12.2f\n", ps[0])
-			fmt.Fprintf(w, "  75%%:         %12.2f\n", ps[1])
-			fmt.Fprintf(w, "  95%%:         %12.2f\n", ps[2])
-			fmt.Fprintf(w, "  99%%:         %12.2f\n", ps[3])
-			fmt.Fprintf(w, "  99.9%%:       %12.2f\n", ps[4])
+			putInt("  %-13s%9d\n", "sum:", t.Sum())
+			putInt("  %-13s%9d\n", "min:", t.Min())
+			putInt("  %-13s%9d\n", "max:", t.Max())
+			putFloat("  %-13s%12.2f\n", "mean:", t.Mean())
+			putFloat("  %-13s%12.2f\n", "stddev:", t.StdDev())
+			for j, p := range percentiles {
+				putFloat("  %-13s%12.2f\n", percentileLabel(p)+":", ps[j])
+			}
 			fmt.Fprintf(w, "  1-min rate:  %12.2f\n", t.Rate1())
 			fmt.Fprintf(w, "  5-min rate:  %12.2f\n", t.Rate5())
 			fmt.Fprintf(w, "  15-min rate: %12.2f\n", t.Rate15())